@@ -23,6 +23,8 @@ import (
 	"github.com/medxamion/medxamion/internal/middleware"
 	"github.com/medxamion/medxamion/internal/models"
 	"github.com/medxamion/medxamion/internal/services"
+	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
 )
 
 func main() {
@@ -58,35 +60,115 @@ func main() {
 	deliveryModel := models.NewDeliveryModel(db)
 	attemptModel := models.NewAttemptModel(db)
 	deliveryAssignmentModel := models.NewDeliveryAssignmentModel(db)
+	deliveryNetworkModel := models.NewDeliveryNetworkModel(db)
+	helpRequestModel := models.NewHelpRequestModel(db)
+	examClientEventModel := models.NewExamClientEventModel(db)
+	examClientCredentialModel := models.NewExamClientCredentialModel(db)
+	deliveryKeyModel := models.NewDeliveryKeyModel(db)
+	deliveryStagingModel := models.NewDeliveryStagingModel(db)
+	examClientModel := models.NewExamClientModel(db)
+	deliveryQueueModel := models.NewDeliveryQueueModel(db)
+	roleModel := models.NewRoleModel(db)
+	permissionModel := models.NewPermissionModel(db)
+	loginSecurityModel := models.NewLoginSecurityModel(db)
+	deliveryAccessCodeModel := models.NewDeliveryAccessCodeModel(db)
+	passwordModel := models.NewPasswordModel(db)
+	oidcModel := models.NewOIDCModel(db)
+	clientModel := models.NewClientModel(db)
+	auditModel := models.NewAuditModel(db)
+	collusionReportModel := models.NewCollusionReportModel(db)
+
+	// Store the permissions the API checks, so they can be granted
+	authorizer := services.NewAuthorizer(userModel, permissionModel)
+	if err := authorizer.SyncPermissions(); err != nil {
+		log.Fatalf("Failed to sync permissions: %v", err)
+	}
+
+	// Without a configured enrollment token only the built-in exam-client can enroll
+	if cfg.ExamClientEnrollmentToken == "" {
+		token, err := utils.GenerateSecret(32)
+		if err != nil {
+			log.Fatalf("Failed to generate enrollment token: %v", err)
+		}
+		cfg.ExamClientEnrollmentToken = token
+		log.Println("EXAM_CLIENT_ENROLLMENT_TOKEN not set: only the built-in exam-client can enroll")
+	}
+	if time.Now().Before(cfg.LegacyTakerCodesUntil) {
+		log.Printf("Sequential taker codes log in until %s: regenerate the codes of groups still using them", cfg.LegacyTakerCodesUntil.Format(time.RFC3339))
+	}
 
 	// Initialize handlers first
-	examClientHandler := handlers.NewExamClientHandler()
+	examClientHandler := handlers.NewExamClientHandler(examClientModel, deliveryQueueModel, examClientCredentialModel, deliveryStagingModel)
 
 	// Initialize services
-	authService := services.NewAuthService(userModel, sessionModel, cfg)
-	schedulerService := services.NewSchedulerService(deliveryModel, examClientHandler)
+	loginProtection := services.NewLoginProtectionService(loginSecurityModel, cfg)
+	authService := services.NewAuthService(userModel, sessionModel, clientModel, authorizer, loginProtection, cfg)
+	twoFactorService := services.NewTwoFactorService(userModel, sessionModel, loginProtection, cfg)
+	passwordPolicy, err := services.NewPasswordPolicy(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load password policy: %v", err)
+	}
+	mailer, err := services.NewMailer(cfg)
+	if err != nil {
+		log.Fatalf("Invalid mail configuration: %v", err)
+	}
+	if mailer == nil && cfg.PasswordResetEnabled {
+		log.Fatalf("Password resets need a mailer: set SMTP_HOST, set MAIL_LOG=true in development, or set PASSWORD_RESET_ENABLED=false")
+	}
+	passwordService := services.NewPasswordService(passwordModel, userModel, participantModel, sessionModel, permissionModel, passwordPolicy, mailer, cfg)
+	oidcService, err := services.NewOIDCService(oidcModel, userModel, roleModel, authService, cfg)
+	if err != nil {
+		log.Fatalf("Failed to load single sign-on configuration: %v", err)
+	}
+	networkAccessService := services.NewNetworkAccessService(deliveryNetworkModel, examClientHandler)
+	examContentService := services.NewExamContentService(examModel, deliveryKeyModel)
+	collusionService := services.NewCollusionService(attemptModel, collusionReportModel)
+	auditService := services.NewAuditService(auditModel, cfg)
+	responseTimeService := services.NewResponseTimeService(attemptModel)
 
 	// Initialize middleware
 	authMiddleware := middleware.NewAuthMiddleware(authService, cfg)
 
 	// Initialize other handlers
 	authHandler := handlers.NewAuthHandler(authService, cfg)
-	userHandler := handlers.NewUserHandler(userModel)
-	groupHandler := handlers.NewGroupHandler(groupModel)
-	participantHandler := handlers.NewParticipantHandler(participantModel)
-	examHandler := handlers.NewExamHandler(examModel)
-	categoryHandler := handlers.NewCategoryHandler(categoryModel)
-	itemHandler := handlers.NewItemHandler(itemModel)
-	deliveryHandler := handlers.NewDeliveryHandler(deliveryModel)
-	attemptHandler := handlers.NewAttemptHandler(attemptModel)
-	deliveryAssignmentHandler := handlers.NewDeliveryAssignmentHandler(deliveryAssignmentModel, deliveryModel)
+	twoFactorHandler := handlers.NewTwoFactorHandler(twoFactorService, auditService)
+	sessionHandler := handlers.NewSessionHandler(authService)
+	loginSecurityHandler := handlers.NewLoginSecurityHandler(loginProtection)
+	passwordHandler := handlers.NewPasswordHandler(passwordService, participantModel, loginProtection, auditService)
+	oidcHandler := handlers.NewOIDCHandler(oidcService)
+	userHandler := handlers.NewUserHandler(userModel, clientModel, passwordService, auditService)
+	clientHandler := handlers.NewClientHandler(clientModel, userModel, authService, auditService)
+	roleHandler := handlers.NewRoleHandler(roleModel, permissionModel, userModel, authorizer, auditService)
+	groupHandler := handlers.NewGroupHandler(groupModel, clientModel, auditService)
+	participantHandler := handlers.NewParticipantHandler(participantModel, deliveryAccessCodeModel, examContentService, loginProtection, passwordService, auditService, cfg)
+	examHandler := handlers.NewExamHandler(examModel, auditService)
+	categoryHandler := handlers.NewCategoryHandler(categoryModel, auditService)
+	itemHandler := handlers.NewItemHandler(itemModel, auditService)
+	deliveryHandler := handlers.NewDeliveryHandler(deliveryModel, auditService)
+	attemptHandler := handlers.NewAttemptHandler(attemptModel, deliveryAssignmentModel, networkAccessService, auditService)
+	deliveryAssignmentHandler := handlers.NewDeliveryAssignmentHandler(deliveryAssignmentModel, deliveryModel, auditService)
+	deliveryNetworkHandler := handlers.NewDeliveryNetworkHandler(deliveryNetworkModel, deliveryAssignmentModel, auditService)
+	deliveryAdmissionHandler := handlers.NewDeliveryAdmissionHandler(deliveryAccessCodeModel, deliveryModel, groupModel, deliveryAssignmentModel, auditService)
+	collusionHandler := handlers.NewCollusionHandler(collusionService, deliveryAssignmentModel)
+	responseTimeHandler := handlers.NewResponseTimeHandler(responseTimeService, attemptModel, deliveryAssignmentModel)
+	proctorMessageHandler := handlers.NewProctorMessageHandler(examClientHandler, deliveryAssignmentModel)
+	auditHandler := handlers.NewAuditHandler(auditModel)
+	examClientCredentialHandler := handlers.NewExamClientCredentialHandler(examClientCredentialModel, examClientHandler, cfg.ExamClientEnrollmentToken)
 
 	// Initialize WebSocket hub
-	wsHub := handlers.NewWebSocketHub(deliveryModel)
-	wsHub.StartPeriodicUpdates()
+	wsHub := handlers.NewWebSocketHub(db, deliveryAssignmentModel, clientModel, authService, cfg)
+
+	// Initialize the scheduler, which stages exam content and releases delivery keys
+	schedulerService := services.NewSchedulerService(deliveryModel, deliveryStagingModel, examClientHandler, networkAccessService, examContentService, wsHub)
+	schedulerService.SetStagingWindow(cfg.ExamContentStagingLeadTime, cfg.ExamContentStagingAlertBefore)
+	schedulerService.SetCloseGracePeriod(cfg.DeliveryCloseGracePeriod)
+	schedulerService.SetCollusionAnalysis(collusionService)
+	deliveryStagingHandler := handlers.NewDeliveryStagingHandler(deliveryStagingModel, deliveryKeyModel, examClientCredentialModel, deliveryAssignmentModel)
 
 	// Initialize live progress handler
-	examClientLiveHandler := handlers.NewExamClientLiveHandler(deliveryModel, wsHub)
+	examClientLiveHandler := handlers.NewExamClientLiveHandler(deliveryModel, helpRequestModel, examClientEventModel, examClientHandler, wsHub, networkAccessService, examContentService, attemptModel, collusionService)
+	wsHub.SetSnapshotLoader(examClientLiveHandler.LoadProgressSnapshot)
+	helpRequestHandler := handlers.NewHelpRequestHandler(helpRequestModel, deliveryAssignmentModel, examClientHandler, wsHub)
 
 	// Setup router
 	router := chi.NewRouter()
@@ -104,9 +186,27 @@ func main() {
 	// Rate limiting
 	router.Use(httprate.LimitByIP(100, 1*time.Minute))
 
+	// Client IP (used for per-delivery network allow-lists)
+	trustedProxies, err := utils.ParseNetworks(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	router.Use(middleware.ClientIPMiddleware(cfg.TrustProxyHeaders, trustedProxies))
+
+	// Test codes are short, so test-code logins get a much stricter limit per client IP. Venue
+	// networks, where a room of participants may share one address, get a higher one.
+	router.Use(middleware.LimitPathByClientIP(http.MethodPost, "/api/participant/login-testcode", cfg.TestCodeLoginsPerMin, 1*time.Minute, networkAccessService.IsVenueNetwork, cfg.TestCodeLoginsPerMinVenue))
+
+	// Password reset requests send email, so they are limited per client IP as well
+	router.Use(middleware.LimitPathByClientIP(http.MethodPost, "/api/auth/password-reset", 5, 15*time.Minute, nil, 0))
+	router.Use(middleware.LimitPathByClientIP(http.MethodPost, "/api/participant/password-reset", 5, 15*time.Minute, nil, 0))
+
 	// Session middleware (applies to all routes)
 	router.Use(authMiddleware.SessionMiddleware())
 
+	// Signed requests from enrolled exam-clients (internal exam-client routes)
+	router.Use(middleware.ExamClientAuthMiddleware(examClientCredentialModel))
+
 	// WebSocket endpoint (before Huma API to avoid middleware conflicts)
 	router.HandleFunc("/api/deliveries/{id}/ws", wsHub.ServeWS)
 
@@ -119,11 +219,30 @@ func main() {
 		Name: "MedXam Team",
 	}
 
+	// Enforce the access rules declared on the operations registered below
+	api.UseMiddleware(middleware.Authorize(api))
+
+	// Records addressed by ID that the operations do not look up per client themselves
+	api.UseMiddleware(middleware.ScopeClientResources(api, []middleware.ClientResource{
+		{PathPrefix: "/api/deliveries/{id}", Param: "id", InClient: clientModel.DeliveryInClient},
+		{PathPrefix: "/api/deliveries/{deliveryId}", Param: "deliveryId", InClient: clientModel.DeliveryInClient},
+		{PathPrefix: "/api/attempts/{id}", Param: "id", InClient: clientModel.AttemptInClient},
+		{PathPrefix: "/api/participants/{id}", Param: "id", InClient: clientModel.ParticipantInClient},
+		{PathPrefix: "/api/users/{id}", Param: "id", ExemptPermission: tables.PermissionClientManage, Self: true, InClient: clientModel.UserInClient},
+	}))
+
 	// Register handlers
 	authHandler.Register(api)
+	twoFactorHandler.Register(api)
+	sessionHandler.Register(api)
+	passwordHandler.Register(api)
+	oidcHandler.Register(api)
+	loginSecurityHandler.Register(api)
 
-	// Register protected handlers (they have their own auth checks in handlers)
+	// Register protected handlers
 	userHandler.Register(api)
+	clientHandler.Register(api)
+	roleHandler.Register(api)
 	groupHandler.Register(api)
 	participantHandler.Register(api)
 	examHandler.Register(api)
@@ -132,8 +251,17 @@ func main() {
 	deliveryHandler.Register(api)
 	attemptHandler.Register(api)
 	examClientHandler.Register(api)
+	examClientCredentialHandler.Register(api)
+	deliveryStagingHandler.Register(api)
 	deliveryAssignmentHandler.Register(api)
+	deliveryNetworkHandler.Register(api)
+	deliveryAdmissionHandler.Register(api)
+	collusionHandler.Register(api)
+	responseTimeHandler.Register(api)
 	examClientLiveHandler.Register(api)
+	proctorMessageHandler.Register(api)
+	helpRequestHandler.Register(api)
+	auditHandler.Register(api)
 
 	// Health check endpoint
 	huma.Register(api, huma.Operation{
@@ -143,6 +271,7 @@ func main() {
 		Summary:     "Health check",
 		Description: "Check if the API is running and database is accessible.",
 		Tags:        []string{"System"},
+		Metadata:    middleware.Public(),
 	}, func(ctx context.Context, input *struct{}) (*struct {
 		Body struct {
 			Status   string    `json:"status"`
@@ -175,7 +304,7 @@ func main() {
 		}, nil
 	})
 
-	// Start session cleanup goroutine
+	// Start session, login failure, password reset token, single sign-on and audit log cleanup goroutine
 	go func() {
 		ticker := time.NewTicker(1 * time.Hour)
 		defer ticker.Stop()
@@ -184,16 +313,40 @@ func main() {
 			if err := authService.CleanupExpiredSessions(); err != nil {
 				log.Printf("Failed to cleanup expired sessions: %v", err)
 			}
+			if err := loginProtection.CleanupFailures(); err != nil {
+				log.Printf("Failed to cleanup login failures: %v", err)
+			}
+			if err := passwordService.CleanupResetTokens(); err != nil {
+				log.Printf("Failed to cleanup password reset tokens: %v", err)
+			}
+			if err := oidcService.Cleanup(); err != nil {
+				log.Printf("Failed to cleanup single sign-on logins: %v", err)
+			}
+			if err := auditService.Cleanup(); err != nil {
+				log.Printf("Failed to cleanup audit log: %v", err)
+			}
+		}
+	}()
+
+	// Fan live-monitoring deltas out to the clients connected to the other replicas
+	deltaCtx, cancelDeltas := context.WithCancel(context.Background())
+	defer cancelDeltas()
+
+	go func() {
+		if err := wsHub.ListenForDeltas(deltaCtx, cfg.DatabaseURL); err != nil {
+			log.Printf("Delta listener stopped: %v", err)
 		}
 	}()
 
-	// Start delivery scheduler service
+	// Start delivery scheduler service. Every replica serves the API, but only the one
+	// holding the scheduler lock schedules.
 	schedulerCtx, cancelScheduler := context.WithCancel(context.Background())
 	defer cancelScheduler()
 
+	schedulerElection := services.NewLeaderElection(db, services.SchedulerLockID, "delivery scheduler")
 	go func() {
 		log.Println("Starting delivery scheduler service...")
-		schedulerService.Start(schedulerCtx)
+		schedulerElection.Run(schedulerCtx, schedulerService.Start)
 	}()
 
 	// Start server
@@ -227,7 +380,7 @@ func main() {
 	// Give the server a moment to actually start accepting connections
 	time.Sleep(100 * time.Millisecond)
 
-	builtinExamClient := services.NewExamClientService("http://localhost:8080", 0) // Built-in client with unlimited capacity
+	builtinExamClient := services.NewExamClientService("http://localhost:8080", 0, cfg.ExamClientEnrollmentToken) // Built-in client with unlimited capacity
 	builtinCtx, cancelBuiltinClient := context.WithCancel(context.Background())
 	defer cancelBuiltinClient()
 
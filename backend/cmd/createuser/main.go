@@ -36,6 +36,7 @@ func main() {
 
 	// Initialize model
 	userModel := models.NewUserModel(db)
+	clientModel := models.NewClientModel(db)
 
 	// Get username and password from command line args
 	if len(os.Args) < 3 {
@@ -74,6 +75,17 @@ func main() {
 		log.Fatalf("Failed to create user: %v", err)
 	}
 
+	// The user works for the first client, so they can sign in to work with it
+	clientID, err := clientModel.FirstID()
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+	if clientID != 0 {
+		if err := clientModel.AddUser(clientID, user.ID); err != nil {
+			log.Fatalf("Failed to add user to client: %v", err)
+		}
+	}
+
 	fmt.Printf("Successfully created user '%s' with ID %d\n", username, user.ID)
 	fmt.Printf("You can now login with:\n")
 	fmt.Printf("  Username: %s\n", username)
@@ -19,6 +19,7 @@ func main() {
 		coordinatorURL = flag.String("coordinator", "http://localhost:8080", "Coordinator server URL")
 		maxDeliveries  = flag.Int("max-deliveries", 0, "Maximum concurrent deliveries (0 = unlimited)")
 		envFile        = flag.String("env", ".env", "Environment file path")
+		enrollToken    = flag.String("enrollment-token", "", "Token to enroll with the coordinator on first start")
 	)
 	flag.Parse()
 
@@ -31,6 +32,9 @@ func main() {
 	if envCoordinator := os.Getenv("COORDINATOR_URL"); envCoordinator != "" {
 		*coordinatorURL = envCoordinator
 	}
+	if envEnrollToken := os.Getenv("EXAM_CLIENT_ENROLLMENT_TOKEN"); envEnrollToken != "" {
+		*enrollToken = envEnrollToken
+	}
 	if envMaxDeliveries := os.Getenv("MAX_DELIVERIES"); envMaxDeliveries != "" {
 		if parsed, err := strconv.Atoi(envMaxDeliveries); err == nil {
 			*maxDeliveries = parsed
@@ -48,7 +52,7 @@ func main() {
 	}
 
 	// Create exam client service
-	examClient := services.NewExamClientService(*coordinatorURL, *maxDeliveries)
+	examClient := services.NewExamClientService(*coordinatorURL, *maxDeliveries, *enrollToken)
 
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
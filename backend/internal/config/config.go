@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,6 +16,114 @@ type Config struct {
 	SessionCookieName   string
 	SessionCookieSecure bool
 	SessionCookieDomain string
+	TrustProxyHeaders   bool
+
+	// Reverse proxies, as IP addresses or CIDR ranges, whose X-Forwarded-For entries are
+	// skipped to find the client address. When set, only requests from them may use the
+	// forwarding headers.
+	TrustedProxies []string
+
+	// Sessions a user may have at the same time when none of their roles sets a limit
+	// (0 is unlimited). Signing in beyond the limit ends the least recently used session.
+	SessionMaxConcurrent int
+
+	// WebSocket origins allowed besides the API's own host ("*" allows any origin)
+	WebSocketAllowedOrigins []string
+	// Time a WebSocket client has to authenticate when no session cookie was sent
+	WebSocketAuthTimeout time.Duration
+
+	// Token exam-clients exchange for their signing secret (empty disables enrollment)
+	ExamClientEnrollmentToken string
+
+	// How long before the start exam content is staged on an exam-client, and how long
+	// before the start incomplete staging is alerted
+	ExamContentStagingLeadTime    time.Duration
+	ExamContentStagingAlertBefore time.Duration
+
+	// How long after their end deliveries are closed and remaining attempts submitted
+	DeliveryCloseGracePeriod time.Duration
+
+	// Issuer shown by authenticator apps for two-factor codes, and how many wrong codes a
+	// session may enter before it is signed out
+	TwoFactorIssuer      string
+	TwoFactorMaxAttempts int
+
+	// Failed logins of an account before every further attempt is delayed and how long the
+	// delay gets, and failures before the account is locked out and how long lockouts get
+	LoginBackoffAfter    int
+	LoginBackoffBase     time.Duration
+	LoginBackoffMax      time.Duration
+	LoginLockoutAfter    int
+	LoginLockoutDuration time.Duration
+	LoginLockoutMax      time.Duration
+
+	// Test-code logins allowed per IP address and minute, and from networks on the allow-list
+	// of an unfinished delivery, where participants may share an address
+	TestCodeLoginsPerMin      int
+	TestCodeLoginsPerMinVenue int
+
+	// Sequential taker codes issued before codes were random keep logging in until this time,
+	// so groups with upcoming deliveries can be given new codes. Zero refuses them.
+	LegacyTakerCodesUntil time.Time
+
+	// Window in which failed logins from one IP address for too many accounts, or for one
+	// account from too many IP addresses, raise a security alert
+	LoginAlertWindow      time.Duration
+	LoginAlertIdentifiers int
+	LoginAlertAddresses   int
+
+	// Password policy: minimum length, how many character classes (lowercase, uppercase,
+	// digits, symbols) to mix, previous passwords that may not be reused, and a local file
+	// of breached passwords, one per line as plain text or SHA-1 hex (empty disables it)
+	PasswordMinLength    int
+	PasswordMinClasses   int
+	PasswordHistory      int
+	PasswordBreachedList string
+
+	// Whether users and participants can request password reset links by email; the server
+	// refuses to start with it and no mailer
+	PasswordResetEnabled bool
+
+	// Links in password reset emails, with the token appended, and how long they work
+	PasswordResetURL            string
+	ParticipantPasswordResetURL string
+	PasswordResetTTL            time.Duration
+
+	// SMTP server notifications are sent through and their sender
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+
+	// Write notifications, reset links included, to the log instead of sending them. Only for
+	// development without an SMTP server; refused in production.
+	MailLog bool
+
+	// OpenID Connect single sign-on for staff (an empty issuer disables it). The redirect URL
+	// is the API's callback as registered at the identity provider; after signing in the
+	// browser is sent to the post-login URL with a code the frontend exchanges for the session.
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCPostLoginURL string
+	OIDCScopes       []string
+	OIDCProviderName string
+
+	// Claims users are matched by on their first single sign-on ("email", "username"), in
+	// order, and the claim holding the username
+	OIDCMatchClaims   []string
+	OIDCUsernameClaim string
+
+	// Claim holding the groups of the user, and identity provider groups mapped to roles as
+	// "group=role" pairs. With a mapping, the mapped roles are given and taken away on every
+	// single sign-on.
+	OIDCGroupsClaim string
+	OIDCRoleMapping []string
+
+	// Days audit log entries are kept (0 keeps them forever)
+	AuditRetentionDays int
 }
 
 func Load() *Config {
@@ -22,6 +131,32 @@ func Load() *Config {
 	sessionLifetime, _ := time.ParseDuration(getEnv("SESSION_LIFETIME", "24h"))
 	sessionIdleTimeout, _ := time.ParseDuration(getEnv("SESSION_IDLE_TIMEOUT", "2h"))
 	sessionCookieSecure, _ := strconv.ParseBool(getEnv("SESSION_COOKIE_SECURE", "false"))
+	sessionMaxConcurrent, _ := strconv.Atoi(getEnv("SESSION_MAX_CONCURRENT", "3"))
+	trustProxyHeaders, _ := strconv.ParseBool(getEnv("TRUST_PROXY_HEADERS", "false"))
+	webSocketAuthTimeout, _ := time.ParseDuration(getEnv("WS_AUTH_TIMEOUT", "10s"))
+	stagingLeadTime, _ := time.ParseDuration(getEnv("EXAM_CONTENT_STAGING_LEAD", "3h"))
+	stagingAlertBefore, _ := time.ParseDuration(getEnv("EXAM_CONTENT_STAGING_ALERT", "30m"))
+	closeGracePeriod, _ := time.ParseDuration(getEnv("DELIVERY_CLOSE_GRACE", "5m"))
+	twoFactorMaxAttempts, _ := strconv.Atoi(getEnv("TWO_FACTOR_MAX_ATTEMPTS", "5"))
+	loginBackoffAfter, _ := strconv.Atoi(getEnv("LOGIN_BACKOFF_AFTER", "3"))
+	loginBackoffBase, _ := time.ParseDuration(getEnv("LOGIN_BACKOFF_BASE", "2s"))
+	loginBackoffMax, _ := time.ParseDuration(getEnv("LOGIN_BACKOFF_MAX", "1m"))
+	loginLockoutAfter, _ := strconv.Atoi(getEnv("LOGIN_LOCKOUT_AFTER", "10"))
+	loginLockoutDuration, _ := time.ParseDuration(getEnv("LOGIN_LOCKOUT_DURATION", "15m"))
+	loginLockoutMax, _ := time.ParseDuration(getEnv("LOGIN_LOCKOUT_MAX", "24h"))
+	testCodeLoginsPerMin, _ := strconv.Atoi(getEnv("TEST_CODE_LOGINS_PER_MINUTE", "30"))
+	testCodeLoginsPerMinVenue, _ := strconv.Atoi(getEnv("TEST_CODE_LOGINS_PER_MINUTE_VENUE", "600"))
+	loginAlertWindow, _ := time.ParseDuration(getEnv("LOGIN_ALERT_WINDOW", "15m"))
+	loginAlertIdentifiers, _ := strconv.Atoi(getEnv("LOGIN_ALERT_IDENTIFIERS", "10"))
+	loginAlertAddresses, _ := strconv.Atoi(getEnv("LOGIN_ALERT_ADDRESSES", "5"))
+	passwordMinLength, _ := strconv.Atoi(getEnv("PASSWORD_MIN_LENGTH", "10"))
+	passwordMinClasses, _ := strconv.Atoi(getEnv("PASSWORD_MIN_CLASSES", "3"))
+	passwordHistory, _ := strconv.Atoi(getEnv("PASSWORD_HISTORY", "5"))
+	passwordResetTTL, _ := time.ParseDuration(getEnv("PASSWORD_RESET_TTL", "1h"))
+	smtpPort, _ := strconv.Atoi(getEnv("SMTP_PORT", "587"))
+	oidcScopes := strings.Fields(getEnv("OIDC_SCOPES", "openid email profile"))
+	auditRetentionDays, _ := strconv.Atoi(getEnv("AUDIT_RETENTION_DAYS", "2555"))
+	legacyTakerCodesUntil := parseTime(getEnv("LEGACY_TAKER_CODES_UNTIL", ""))
 
 	return &Config{
 		DatabaseURL:         getEnv("DATABASE_URL", ""),
@@ -32,6 +167,73 @@ func Load() *Config {
 		SessionCookieName:   getEnv("SESSION_COOKIE_NAME", "medxam_session"),
 		SessionCookieSecure: sessionCookieSecure,
 		SessionCookieDomain: getEnv("SESSION_COOKIE_DOMAIN", ""),
+		TrustProxyHeaders:   trustProxyHeaders,
+		TrustedProxies:      splitList(getEnv("TRUSTED_PROXIES", "")),
+
+		SessionMaxConcurrent: sessionMaxConcurrent,
+
+		WebSocketAllowedOrigins: splitList(getEnv("WS_ALLOWED_ORIGINS", "http://localhost:3000,http://localhost:5173")),
+		WebSocketAuthTimeout:    webSocketAuthTimeout,
+
+		ExamClientEnrollmentToken: getEnv("EXAM_CLIENT_ENROLLMENT_TOKEN", ""),
+
+		ExamContentStagingLeadTime:    stagingLeadTime,
+		ExamContentStagingAlertBefore: stagingAlertBefore,
+
+		DeliveryCloseGracePeriod: closeGracePeriod,
+
+		TwoFactorIssuer:      getEnv("TWO_FACTOR_ISSUER", "MedXam"),
+		TwoFactorMaxAttempts: twoFactorMaxAttempts,
+
+		LoginBackoffAfter:    loginBackoffAfter,
+		LoginBackoffBase:     loginBackoffBase,
+		LoginBackoffMax:      loginBackoffMax,
+		LoginLockoutAfter:    loginLockoutAfter,
+		LoginLockoutDuration: loginLockoutDuration,
+		LoginLockoutMax:      loginLockoutMax,
+
+		TestCodeLoginsPerMin:      testCodeLoginsPerMin,
+		TestCodeLoginsPerMinVenue: testCodeLoginsPerMinVenue,
+
+		LegacyTakerCodesUntil: legacyTakerCodesUntil,
+
+		LoginAlertWindow:      loginAlertWindow,
+		LoginAlertIdentifiers: loginAlertIdentifiers,
+		LoginAlertAddresses:   loginAlertAddresses,
+
+		PasswordMinLength:    passwordMinLength,
+		PasswordMinClasses:   passwordMinClasses,
+		PasswordHistory:      passwordHistory,
+		PasswordBreachedList: getEnv("PASSWORD_BREACHED_LIST", ""),
+
+		PasswordResetEnabled: getEnv("PASSWORD_RESET_ENABLED", "true") == "true",
+
+		PasswordResetURL:            getEnv("PASSWORD_RESET_URL", "http://localhost:5173/reset-password?token="),
+		ParticipantPasswordResetURL: getEnv("PARTICIPANT_PASSWORD_RESET_URL", "http://localhost:5173/participant/reset-password?token="),
+		PasswordResetTTL:            passwordResetTTL,
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     smtpPort,
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		MailFrom:     getEnv("MAIL_FROM", "MedXam <no-reply@localhost>"),
+		MailLog:      getEnv("MAIL_LOG", "false") == "true",
+
+		OIDCIssuer:       strings.TrimSuffix(getEnv("OIDC_ISSUER", ""), "/"),
+		OIDCClientID:     getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/api/auth/oidc/callback"),
+		OIDCPostLoginURL: getEnv("OIDC_POST_LOGIN_URL", "http://localhost:5173/auth/sso"),
+		OIDCScopes:       oidcScopes,
+		OIDCProviderName: getEnv("OIDC_PROVIDER_NAME", "Institutional account"),
+
+		OIDCMatchClaims:   splitList(getEnv("OIDC_MATCH_CLAIMS", "email")),
+		OIDCUsernameClaim: getEnv("OIDC_USERNAME_CLAIM", "preferred_username"),
+
+		OIDCGroupsClaim: getEnv("OIDC_GROUPS_CLAIM", "groups"),
+		OIDCRoleMapping: splitList(getEnv("OIDC_ROLE_MAPPING", "")),
+
+		AuditRetentionDays: auditRetentionDays,
 	}
 }
 
@@ -41,3 +243,23 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// parseTime parses an RFC 3339 time or a date, which is the start of that day in UTC. An empty
+// or invalid value is the zero time.
+func parseTime(value string) time.Time {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t
+	}
+	t, _ := time.Parse("2006-01-02", value)
+	return t
+}
+
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
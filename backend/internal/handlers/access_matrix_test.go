@@ -0,0 +1,433 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/adapters/humachi"
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/go-chi/chi/v5"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+var (
+	accessPublic            = middleware.Access{Kind: middleware.AccessPublic}
+	accessExamClient        = middleware.Access{Kind: middleware.AccessExamClient}
+	accessSession           = middleware.Access{Kind: middleware.AccessSession}
+	accessAuthenticated     = middleware.Access{Kind: middleware.AccessAuthenticated}
+	accessDeliveryCommittee = middleware.Access{Kind: middleware.AccessDeliveryCommittee, Permission: tables.PermissionDeliveryControl}
+)
+
+func accessPermission(permission string) middleware.Access {
+	return middleware.Access{Kind: middleware.AccessPermission, Permission: permission}
+}
+
+// accessMatrix is the expected access rule of every API operation, by operation ID.
+// TestAccessMatrix checks it against the rules declared on the registered operations, so
+// an operation cannot be added, or its access changed, without changing it here too.
+var accessMatrix = map[string]middleware.Access{
+	// Authentication
+	"login":  accessPublic,
+	"logout": accessPublic,
+	"me":     accessSession,
+
+	// Two-factor authentication
+	"get-two-factor":            accessSession,
+	"setup-two-factor":          accessSession,
+	"confirm-two-factor":        accessSession,
+	"verify-two-factor":         accessSession,
+	"regenerate-recovery-codes": accessAuthenticated,
+	"disable-two-factor":        accessAuthenticated,
+	"reset-two-factor":          accessPermission(tables.PermissionUserManage),
+
+	// Sessions
+	"list-my-sessions":      accessAuthenticated,
+	"revoke-my-session":     accessAuthenticated,
+	"revoke-other-sessions": accessAuthenticated,
+	"list-user-sessions":    accessPermission(tables.PermissionUserManage),
+	"force-logout-user":     accessPermission(tables.PermissionUserManage),
+
+	// Passwords
+	"get-password-policy":                      accessPublic,
+	"change-my-password":                       accessSession,
+	"request-password-reset":                   accessPublic,
+	"reset-password":                           accessPublic,
+	"request-participant-password-reset":       accessPublic,
+	"participant-change-password":              accessPublic,
+	"reset-user-password":                      accessPermission(tables.PermissionUserManage),
+	"set-user-password-change-required":        accessPermission(tables.PermissionUserManage),
+	"reset-participant-password":               accessPermission(tables.PermissionParticipantManage),
+	"set-participant-password-change-required": accessPermission(tables.PermissionParticipantManage),
+
+	// Single sign-on
+	"get-oidc-status":     accessPublic,
+	"start-oidc-login":    accessPublic,
+	"oidc-callback":       accessPublic,
+	"exchange-oidc-login": accessPublic,
+
+	// Login security
+	"list-login-lockouts":        accessPermission(tables.PermissionSecurityManage),
+	"clear-login-lockout":        accessPermission(tables.PermissionSecurityManage),
+	"list-security-alerts":       accessPermission(tables.PermissionSecurityManage),
+	"acknowledge-security-alert": accessPermission(tables.PermissionSecurityManage),
+
+	// Users
+	"list-users":      accessAuthenticated,
+	"get-user":        accessAuthenticated,
+	"create-user":     accessPermission(tables.PermissionUserManage),
+	"update-user":     accessAuthenticated,
+	"delete-user":     accessPermission(tables.PermissionUserManage),
+	"change-password": accessAuthenticated,
+
+	// Clients
+	"get-current-client": accessAuthenticated,
+	"switch-client":      accessAuthenticated,
+	"list-clients":       accessPermission(tables.PermissionClientManage),
+	"get-client":         accessPermission(tables.PermissionClientManage),
+	"create-client":      accessPermission(tables.PermissionClientManage),
+	"update-client":      accessPermission(tables.PermissionClientManage),
+	"get-user-clients":   accessPermission(tables.PermissionClientManage),
+	"set-user-clients":   accessPermission(tables.PermissionClientManage),
+
+	// Roles and permissions
+	"list-roles":           accessPermission(tables.PermissionRoleManage),
+	"get-role":             accessPermission(tables.PermissionRoleManage),
+	"create-role":          accessPermission(tables.PermissionRoleManage),
+	"update-role":          accessPermission(tables.PermissionRoleManage),
+	"delete-role":          accessPermission(tables.PermissionRoleManage),
+	"set-role-permissions": accessPermission(tables.PermissionRoleManage),
+	"list-permissions":     accessPermission(tables.PermissionRoleManage),
+	"get-user-access":      accessPermission(tables.PermissionRoleManage),
+	"set-user-roles":       accessPermission(tables.PermissionRoleManage),
+	"set-user-permissions": accessPermission(tables.PermissionRoleManage),
+
+	// Groups
+	"list-groups":                  accessAuthenticated,
+	"get-group":                    accessAuthenticated,
+	"get-group-takers":             accessAuthenticated,
+	"create-group":                 accessPermission(tables.PermissionGroupManage),
+	"update-group":                 accessPermission(tables.PermissionGroupManage),
+	"delete-group":                 accessPermission(tables.PermissionGroupManage),
+	"list-deleted-groups":          accessPermission(tables.PermissionGroupManage),
+	"restore-group":                accessPermission(tables.PermissionGroupManage),
+	"add-taker-to-group":           accessPermission(tables.PermissionGroupManage),
+	"remove-taker-from-group":      accessPermission(tables.PermissionGroupManage),
+	"regenerate-taker-code":        accessPermission(tables.PermissionGroupManage),
+	"revoke-taker-code":            accessPermission(tables.PermissionGroupManage),
+	"regenerate-group-taker-codes": accessPermission(tables.PermissionGroupManage),
+
+	// Participants
+	"participant-login":          accessPublic,
+	"participant-login-testcode": accessPublic,
+	"list-participants":          accessAuthenticated,
+	"get-participant":            accessAuthenticated,
+	"get-participant-groups":     accessAuthenticated,
+	"create-participant":         accessPermission(tables.PermissionParticipantManage),
+	"update-participant":         accessPermission(tables.PermissionParticipantManage),
+	"delete-participant":         accessPermission(tables.PermissionParticipantManage),
+	"list-deleted-participants":  accessPermission(tables.PermissionParticipantManage),
+	"restore-participant":        accessPermission(tables.PermissionParticipantManage),
+	"verify-participant":         accessPermission(tables.PermissionParticipantManage),
+
+	// Exams
+	"list-exams":             accessAuthenticated,
+	"get-exam":               accessAuthenticated,
+	"get-exam-items":         accessAuthenticated,
+	"create-exam":            accessPermission(tables.PermissionExamCreate),
+	"update-exam":            accessPermission(tables.PermissionExamUpdate),
+	"delete-exam":            accessPermission(tables.PermissionExamDelete),
+	"list-deleted-exams":     accessPermission(tables.PermissionExamDelete),
+	"restore-exam":           accessPermission(tables.PermissionExamDelete),
+	"add-item-to-exam":       accessPermission(tables.PermissionExamUpdate),
+	"remove-item-from-exam":  accessPermission(tables.PermissionExamUpdate),
+	"update-exam-item-order": accessPermission(tables.PermissionExamUpdate),
+
+	// Categories
+	"list-categories":               accessAuthenticated,
+	"get-category":                  accessAuthenticated,
+	"get-categories-by-type":        accessAuthenticated,
+	"get-category-questions":        accessAuthenticated,
+	"create-category":               accessPermission(tables.PermissionCategoryManage),
+	"update-category":               accessPermission(tables.PermissionCategoryManage),
+	"delete-category":               accessPermission(tables.PermissionCategoryManage),
+	"add-question-to-category":      accessPermission(tables.PermissionCategoryManage),
+	"remove-question-from-category": accessPermission(tables.PermissionCategoryManage),
+
+	// Items
+	"list-items":              accessAuthenticated,
+	"get-item":                accessAuthenticated,
+	"get-item-with-questions": accessAuthenticated,
+	"get-item-questions":      accessAuthenticated,
+	"get-item-categories":     accessAuthenticated,
+	"create-item":             accessPermission(tables.PermissionItemManage),
+	"update-item":             accessPermission(tables.PermissionItemManage),
+	"delete-item":             accessPermission(tables.PermissionItemManage),
+	"list-deleted-items":      accessPermission(tables.PermissionItemManage),
+	"restore-item":            accessPermission(tables.PermissionItemManage),
+
+	// Deliveries
+	"list-deliveries":           accessAuthenticated,
+	"get-delivery":              accessAuthenticated,
+	"get-delivery-with-details": accessAuthenticated,
+	"get-participant-progress":  accessAuthenticated,
+	"get-delivery-attempts":     accessAuthenticated,
+	"create-delivery":           accessPermission(tables.PermissionDeliveryCreate),
+	"update-delivery":           accessPermission(tables.PermissionDeliveryUpdate),
+	"delete-delivery":           accessPermission(tables.PermissionDeliveryDelete),
+	"list-deleted-deliveries":   accessPermission(tables.PermissionDeliveryDelete),
+	"restore-delivery":          accessPermission(tables.PermissionDeliveryDelete),
+	"start-delivery":            accessPermission(tables.PermissionDeliveryControl),
+	"finish-delivery":           accessPermission(tables.PermissionDeliveryControl),
+
+	// Attempts and results
+	"list-attempts":            accessAuthenticated,
+	"get-attempt":              accessAuthenticated,
+	"get-attempt-with-details": accessAuthenticated,
+	"start-attempt":            accessAuthenticated,
+	"finish-attempt":           accessAuthenticated,
+	"save-answer":              accessAuthenticated,
+	"get-attempt-answers":      accessAuthenticated,
+	"flag-attempt-question":    accessDeliveryCommittee,
+	"get-attempt-review":       accessDeliveryCommittee,
+	"update-attempt-score":     accessPermission(tables.PermissionAttemptScore),
+	"get-delivery-results":     accessPermission(tables.PermissionResultRead),
+
+	// Delivery assignments
+	"assign-delivery-committee": accessPermission(tables.PermissionDeliveryAssign),
+	"assign-delivery-scorers":   accessPermission(tables.PermissionDeliveryAssign),
+	"get-delivery-assignments":  accessAuthenticated,
+	"get-user-deliveries":       accessPermission(tables.PermissionDeliveryAssigned),
+	"control-delivery":          accessDeliveryCommittee,
+	"get-scorer-users":          accessPermission(tables.PermissionDeliveryAssign),
+
+	// Delivery networks
+	"get-delivery-network-rules":       accessDeliveryCommittee,
+	"set-delivery-network-rules":       accessPermission(tables.PermissionDeliveryNetwork),
+	"list-delivery-network-overrides":  accessDeliveryCommittee,
+	"grant-delivery-network-override":  accessDeliveryCommittee,
+	"revoke-delivery-network-override": accessDeliveryCommittee,
+	"list-delivery-access-violations":  accessDeliveryCommittee,
+
+	// Delivery admission
+	"get-delivery-access-code":      accessDeliveryCommittee,
+	"generate-delivery-access-code": accessDeliveryCommittee,
+	"delete-delivery-access-code":   accessDeliveryCommittee,
+	"print-admission-slips":         accessPermission(tables.PermissionGroupManage),
+
+	// Delivery monitoring
+	"get-live-progress":                  accessAuthenticated,
+	"get-delivery-staging":               accessDeliveryCommittee,
+	"get-delivery-collusion-analysis":    accessDeliveryCommittee,
+	"export-delivery-collusion-analysis": accessDeliveryCommittee,
+	"get-delivery-collusion-report":      accessDeliveryCommittee,
+	"get-delivery-response-times":        accessDeliveryCommittee,
+	"get-attempt-pacing":                 accessDeliveryCommittee,
+	"get-attempt-answer-history":         accessDeliveryCommittee,
+	"send-proctor-message":               accessDeliveryCommittee,
+	"list-proctor-messages":              accessDeliveryCommittee,
+	"list-help-requests":                 accessDeliveryCommittee,
+	"claim-help-request":                 accessDeliveryCommittee,
+	"resolve-help-request":               accessDeliveryCommittee,
+
+	// Exam-clients
+	"list-exam-clients":              accessPermission(tables.PermissionExamClientManage),
+	"list-exam-client-credentials":   accessPermission(tables.PermissionExamClientManage),
+	"revoke-exam-client":             accessPermission(tables.PermissionExamClientManage),
+	"enroll-exam-client":             accessPublic,
+	"register-exam-client":           accessExamClient,
+	"update-client-status":           accessExamClient,
+	"get-client-assignment":          accessExamClient,
+	"unregister-exam-client":         accessExamClient,
+	"report-delivery-staging":        accessExamClient,
+	"get-delivery-key":               accessExamClient,
+	"receive-exam-client-event":      accessExamClient,
+	"receive-final-results":          accessExamClient,
+	"get-exam-client-network-policy": accessExamClient,
+
+	// Audit log
+	"list-audit-log":  accessPermission(tables.PermissionAuditView),
+	"get-audit-entry": accessPermission(tables.PermissionAuditView),
+}
+
+// accessProbes are the callers every operation is tried with, and the access kinds that
+// must let each of them in. Any other access kind must turn them away.
+var accessProbes = []struct {
+	name         string
+	session      func(required string) *tables.SessionData
+	examClientID string
+	allowed      []middleware.AccessKind
+}{
+	{
+		name:    "anonymous caller",
+		session: func(string) *tables.SessionData { return nil },
+		allowed: []middleware.AccessKind{middleware.AccessPublic},
+	},
+	{
+		name:         "exam-client",
+		session:      func(string) *tables.SessionData { return nil },
+		examClientID: "access-matrix-probe",
+		allowed:      []middleware.AccessKind{middleware.AccessPublic, middleware.AccessExamClient},
+	},
+	{
+		name:    "user without permissions",
+		session: func(string) *tables.SessionData { return &tables.SessionData{UserID: 1} },
+		allowed: []middleware.AccessKind{middleware.AccessPublic, middleware.AccessSession, middleware.AccessAuthenticated, middleware.AccessDeliveryCommittee},
+	},
+	{
+		name: "user with every other permission",
+		session: func(required string) *tables.SessionData {
+			session := &tables.SessionData{UserID: 1}
+			for _, permission := range tables.PermissionCatalog {
+				if permission.Name != required {
+					session.Permissions = append(session.Permissions, permission.Name)
+				}
+			}
+			return session
+		},
+		allowed: []middleware.AccessKind{middleware.AccessPublic, middleware.AccessSession, middleware.AccessAuthenticated, middleware.AccessDeliveryCommittee},
+	},
+	{
+		name: "user with the permission",
+		session: func(required string) *tables.SessionData {
+			return &tables.SessionData{UserID: 1, Permissions: []string{required}}
+		},
+		allowed: []middleware.AccessKind{middleware.AccessPublic, middleware.AccessSession, middleware.AccessAuthenticated, middleware.AccessDeliveryCommittee, middleware.AccessPermission},
+	},
+	{
+		name: "user waiting for a two-factor code",
+		session: func(required string) *tables.SessionData {
+			return &tables.SessionData{UserID: 1, Permissions: []string{required}, TwoFactorPending: tables.TwoFactorPendingVerify}
+		},
+		allowed: []middleware.AccessKind{middleware.AccessPublic, middleware.AccessSession},
+	},
+	{
+		name: "user who must change their password",
+		session: func(required string) *tables.SessionData {
+			return &tables.SessionData{UserID: 1, Permissions: []string{required}, PasswordChangeRequired: true}
+		},
+		allowed: []middleware.AccessKind{middleware.AccessPublic, middleware.AccessSession},
+	},
+}
+
+// accessGranted is the status answered by requests the authorization middleware lets in;
+// they stop before the handler, so the handlers need no dependencies
+const accessGranted = http.StatusTeapot
+
+// newAccessMatrixAPI registers every handler on a test API behind the authorization
+// middleware, routed by chi as in the server so /deleted paths do not match {id}
+func newAccessMatrixAPI(t *testing.T) humatest.TestAPI {
+	api := humatest.Wrap(t, humachi.New(chi.NewRouter(), huma.DefaultConfig("MedXam API", "1.0.0")))
+	api.UseMiddleware(middleware.Authorize(api))
+	api.UseMiddleware(func(ctx huma.Context, next func(huma.Context)) {
+		ctx.SetStatus(accessGranted)
+	})
+
+	for _, handler := range []interface{ Register(huma.API) }{
+		&AuthHandler{}, &TwoFactorHandler{}, &SessionHandler{}, &PasswordHandler{}, &OIDCHandler{},
+		&LoginSecurityHandler{}, &UserHandler{}, &ClientHandler{}, &RoleHandler{}, &GroupHandler{},
+		&ParticipantHandler{}, &ExamHandler{}, &CategoryHandler{}, &ItemHandler{}, &DeliveryHandler{},
+		&AttemptHandler{}, &ExamClientHandler{}, &ExamClientCredentialHandler{}, &DeliveryStagingHandler{},
+		&DeliveryAssignmentHandler{}, &DeliveryNetworkHandler{}, &DeliveryAdmissionHandler{},
+		&CollusionHandler{}, &ResponseTimeHandler{}, &ExamClientLiveHandler{}, &ProctorMessageHandler{},
+		&HelpRequestHandler{}, &AuditHandler{},
+	} {
+		handler.Register(api)
+	}
+	return api
+}
+
+var pathParameter = regexp.MustCompile(`\{[^}]+\}`)
+
+// TestAccessMatrix checks that every registered operation declares the access rule of the
+// access matrix, and that the authorization middleware lets in exactly the callers the rule
+// allows: callers without a session or exam-client signature get 401, signed-in users
+// without the permission 403.
+func TestAccessMatrix(t *testing.T) {
+	api := newAccessMatrixAPI(t)
+	registered := map[string]bool{}
+
+	for path, item := range api.OpenAPI().Paths {
+		for _, op := range []*huma.Operation{item.Get, item.Put, item.Post, item.Delete, item.Patch, item.Head, item.Options} {
+			if op == nil {
+				continue
+			}
+			registered[op.OperationID] = true
+			name := fmt.Sprintf("%s %s (%s)", op.Method, path, op.OperationID)
+
+			expected, ok := accessMatrix[op.OperationID]
+			if !ok {
+				t.Errorf("%s is missing from the access matrix", name)
+				continue
+			}
+			declared, ok := middleware.OperationAccess(op)
+			if !ok {
+				t.Errorf("%s declares no access rule", name)
+				continue
+			}
+			if declared != expected {
+				t.Errorf("%s declares %s, the access matrix expects %s", name, declared, expected)
+				continue
+			}
+			if declared.Permission != "" && !tables.IsKnownPermission(declared.Permission) {
+				t.Errorf("%s requires unknown permission %s", name, declared.Permission)
+			}
+
+			probeAccess(t, api, name, op.Method, pathParameter.ReplaceAllString(path, "1"), declared)
+		}
+	}
+
+	for operationID := range accessMatrix {
+		if !registered[operationID] {
+			t.Errorf("%s is in the access matrix but not registered", operationID)
+		}
+	}
+}
+
+// probeAccess calls an operation as every probe caller
+func probeAccess(t *testing.T, api humatest.TestAPI, name, method, path string, access middleware.Access) {
+	t.Helper()
+
+	for _, probe := range accessProbes {
+		session := probe.session(access.Permission)
+		ctx := context.Background()
+		if session != nil {
+			ctx = context.WithValue(ctx, middleware.SessionDataContextKey, session)
+		}
+		if probe.examClientID != "" {
+			ctx = context.WithValue(ctx, middleware.ExamClientIDContextKey, probe.examClientID)
+		}
+
+		allowed := false
+		for _, kind := range probe.allowed {
+			if kind == access.Kind {
+				allowed = true
+				break
+			}
+		}
+
+		expected := accessGranted
+		if !allowed {
+			// Callers without the credentials the rule asks for are unauthenticated
+			expected = http.StatusForbidden
+			if session == nil || access.Kind == middleware.AccessExamClient {
+				expected = http.StatusUnauthorized
+			}
+		}
+
+		if status := api.DoCtx(ctx, method, path).Code; status != expected {
+			t.Errorf("%s: %s is %s, expected %s", name, probe.name, accessOutcome(status), accessOutcome(expected))
+		}
+	}
+}
+
+func accessOutcome(status int) string {
+	if status == accessGranted {
+		return "allowed"
+	}
+	return fmt.Sprintf("denied with %d", status)
+}
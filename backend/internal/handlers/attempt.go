@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
 	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
 	"github.com/medxamion/medxamion/internal/tables"
 
 	"github.com/danielgtaylor/huma/v2"
@@ -12,11 +14,19 @@ import (
 )
 
 type AttemptHandler struct {
-	attemptRepo *models.AttemptModel
+	attemptRepo    *models.AttemptModel
+	assignmentRepo *models.DeliveryAssignmentModel
+	networkAccess  *services.NetworkAccessService
+	auditService   *services.AuditService
 }
 
-func NewAttemptHandler(attemptRepo *models.AttemptModel) *AttemptHandler {
-	return &AttemptHandler{attemptRepo: attemptRepo}
+func NewAttemptHandler(attemptRepo *models.AttemptModel, assignmentRepo *models.DeliveryAssignmentModel, networkAccess *services.NetworkAccessService, auditService *services.AuditService) *AttemptHandler {
+	return &AttemptHandler{
+		attemptRepo:    attemptRepo,
+		assignmentRepo: assignmentRepo,
+		networkAccess:  networkAccess,
+		auditService:   auditService,
+	}
 }
 
 func (h *AttemptHandler) Register(api huma.API) {
@@ -28,6 +38,7 @@ func (h *AttemptHandler) Register(api huma.API) {
 		Description: "Get a paginated list of exam attempts with search and filtering.",
 		Tags:        []string{"Attempts"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.ListAttempts)
 
 	huma.Register(api, huma.Operation{
@@ -38,6 +49,7 @@ func (h *AttemptHandler) Register(api huma.API) {
 		Description: "Get detailed information about a specific exam attempt.",
 		Tags:        []string{"Attempts"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetAttempt)
 
 	huma.Register(api, huma.Operation{
@@ -48,6 +60,7 @@ func (h *AttemptHandler) Register(api huma.API) {
 		Description: "Get attempt with complete taker, exam, and delivery information.",
 		Tags:        []string{"Attempts"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetAttemptWithDetails)
 
 	huma.Register(api, huma.Operation{
@@ -58,6 +71,7 @@ func (h *AttemptHandler) Register(api huma.API) {
 		Description: "Start a new exam attempt for a delivery.",
 		Tags:        []string{"Attempts"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.StartAttempt)
 
 	huma.Register(api, huma.Operation{
@@ -68,6 +82,7 @@ func (h *AttemptHandler) Register(api huma.API) {
 		Description: "Mark an exam attempt as finished.",
 		Tags:        []string{"Attempts"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.FinishAttempt)
 
 	huma.Register(api, huma.Operation{
@@ -78,6 +93,7 @@ func (h *AttemptHandler) Register(api huma.API) {
 		Description: "Save or update an answer to a question in an exam attempt.",
 		Tags:        []string{"Attempts"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.SaveAnswer)
 
 	huma.Register(api, huma.Operation{
@@ -88,8 +104,31 @@ func (h *AttemptHandler) Register(api huma.API) {
 		Description: "Get all answers for an exam attempt.",
 		Tags:        []string{"Attempts"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetAttemptAnswers)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "flag-attempt-question",
+		Method:      http.MethodPut,
+		Path:        "/api/attempts/{id}/questions/{questionId}/flag",
+		Summary:     "Flag question for review",
+		Description: "Mark or unmark a question the candidate wants to come back to before submitting.",
+		Tags:        []string{"Attempts"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.FlagQuestion)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-attempt-review",
+		Method:      http.MethodGet,
+		Path:        "/api/attempts/{id}/review",
+		Summary:     "Review attempt before submitting",
+		Description: "List unanswered and flagged questions of an exam attempt.",
+		Tags:        []string{"Attempts"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.GetAttemptReview)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "update-attempt-score",
 		Method:      http.MethodPut,
@@ -98,6 +137,7 @@ func (h *AttemptHandler) Register(api huma.API) {
 		Description: "Update the score and penalty for an exam attempt.",
 		Tags:        []string{"Attempts"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionAttemptScore),
 	}, h.UpdateAttemptScore)
 
 	huma.Register(api, huma.Operation{
@@ -108,6 +148,7 @@ func (h *AttemptHandler) Register(api huma.API) {
 		Description: "Get results summary for all attempts in a delivery.",
 		Tags:        []string{"Results"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionResultRead),
 	}, h.GetDeliveryResults)
 }
 
@@ -126,11 +167,6 @@ type ListAttemptsOutput struct {
 }
 
 func (h *AttemptHandler) ListAttempts(ctx context.Context, input *ListAttemptsInput) (*ListAttemptsOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	pagination := tables.Pagination{
 		Page:    input.Page,
 		PerPage: input.PerPage,
@@ -152,7 +188,7 @@ func (h *AttemptHandler) ListAttempts(ctx context.Context, input *ListAttemptsIn
 		IsFinished: isFinished,
 	}
 
-	result, err := h.attemptRepo.List(pagination, search)
+	result, err := h.attemptRepo.List(clientScope(ctx), pagination, search)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to get attempts", err)
 	}
@@ -170,11 +206,6 @@ type GetAttemptOutput struct {
 }
 
 func (h *AttemptHandler) GetAttempt(ctx context.Context, input *GetAttemptInput) (*GetAttemptOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	attempt, err := h.attemptRepo.GetByID(input.ID)
 	if err != nil {
 		return nil, huma.Error404NotFound("Attempt not found")
@@ -193,12 +224,7 @@ type GetAttemptWithDetailsOutput struct {
 }
 
 func (h *AttemptHandler) GetAttemptWithDetails(ctx context.Context, input *GetAttemptWithDetailsInput) (*GetAttemptWithDetailsOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	attempt, err := h.attemptRepo.GetWithDetails(input.ID)
+	attempt, err := h.attemptRepo.GetWithDetails(clientScope(ctx), input.ID)
 	if err != nil {
 		return nil, huma.Error404NotFound("Attempt not found")
 	}
@@ -225,9 +251,23 @@ func (h *AttemptHandler) StartAttempt(ctx context.Context, input *StartAttemptIn
 		return nil, huma.Error401Unauthorized("Authentication required")
 	}
 
+	// Only the observed address counts; the one reported by the client could be anything
+	ipAddress := middleware.GetClientIPFromContext(ctx)
+
 	// Use session user ID as the taker ID
-	attempt, err := h.attemptRepo.StartAttempt(sessionData.UserID, input.Body.DeliveryID, input.Body.IPAddress)
+	err := h.networkAccess.CheckAccess(input.Body.DeliveryID, sessionData.UserID, nil, ipAddress, "start_attempt")
+	if err != nil {
+		if errors.Is(err, services.ErrNetworkNotAllowed) {
+			return nil, huma.Error403Forbidden("Starting this exam is not allowed from your network")
+		}
+		return nil, huma.Error500InternalServerError("Failed to check network access", err)
+	}
+
+	attempt, err := h.attemptRepo.StartAttempt(clientScope(ctx), sessionData.UserID, input.Body.DeliveryID, ipAddress)
 	if err != nil {
+		if err.Error() == "delivery not found" {
+			return nil, huma.Error404NotFound("Delivery not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to start attempt", err)
 	}
 
@@ -257,11 +297,6 @@ type FinishAttemptOutput struct {
 }
 
 func (h *AttemptHandler) FinishAttempt(ctx context.Context, input *FinishAttemptInput) (*FinishAttemptOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	err := h.attemptRepo.FinishAttempt(input.ID)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to finish attempt", err)
@@ -292,9 +327,18 @@ type SaveAnswerOutput struct {
 }
 
 func (h *AttemptHandler) SaveAnswer(ctx context.Context, input *SaveAnswerInput) (*SaveAnswerOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
+	attempt, err := h.attemptRepo.GetByID(input.ID)
+	if err != nil {
+		return nil, huma.Error404NotFound("Attempt not found")
+	}
+
+	err = h.networkAccess.CheckAccess(attempt.DeliveryID, attempt.AttemptedBy, &attempt.ID,
+		middleware.GetClientIPFromContext(ctx), "save_answer")
+	if err != nil {
+		if errors.Is(err, services.ErrNetworkNotAllowed) {
+			return nil, huma.Error403Forbidden("Submitting answers is not allowed from your network")
+		}
+		return nil, huma.Error500InternalServerError("Failed to check network access", err)
 	}
 
 	attemptQuestion := &tables.AttemptQuestion{
@@ -304,8 +348,14 @@ func (h *AttemptHandler) SaveAnswer(ctx context.Context, input *SaveAnswerInput)
 		TimeSpent:  input.Body.TimeSpent,
 	}
 
-	err := h.attemptRepo.SaveAnswer(attemptQuestion)
+	err = h.attemptRepo.SaveAnswer(attemptQuestion)
 	if err != nil {
+		switch err.Error() {
+		case "attempt not found":
+			return nil, huma.Error404NotFound("Attempt not found")
+		case "attempt has ended":
+			return nil, huma.Error409Conflict("Attempt has ended")
+		}
 		return nil, huma.Error500InternalServerError("Failed to save answer", err)
 	}
 
@@ -330,11 +380,6 @@ type GetAttemptAnswersOutput struct {
 }
 
 func (h *AttemptHandler) GetAttemptAnswers(ctx context.Context, input *GetAttemptAnswersInput) (*GetAttemptAnswersOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	answers, err := h.attemptRepo.GetAttemptAnswers(input.ID)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to get attempt answers", err)
@@ -343,6 +388,104 @@ func (h *AttemptHandler) GetAttemptAnswers(ctx context.Context, input *GetAttemp
 	return &GetAttemptAnswersOutput{Body: answers}, nil
 }
 
+// Flag Question
+type FlagQuestionInput struct {
+	ID         int                       `path:"id" minimum:"1"`
+	QuestionID int                       `path:"questionId" minimum:"1"`
+	Body       tables.AttemptFlagRequest `json:"body"`
+}
+
+type FlagQuestionOutput struct {
+	Body struct {
+		Success  bool                    `json:"success"`
+		Message  string                  `json:"message"`
+		Question *tables.AttemptQuestion `json:"question,omitempty"`
+	} `json:"body"`
+}
+
+func (h *AttemptHandler) FlagQuestion(ctx context.Context, input *FlagQuestionInput) (*FlagQuestionOutput, error) {
+	attempt, err := h.getOpenAttempt(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.networkAccess.CheckAccess(attempt.DeliveryID, attempt.AttemptedBy, &attempt.ID,
+		middleware.GetClientIPFromContext(ctx), "flag_question")
+	if err != nil {
+		if errors.Is(err, services.ErrNetworkNotAllowed) {
+			return nil, huma.Error403Forbidden("Flagging questions is not allowed from your network")
+		}
+		return nil, huma.Error500InternalServerError("Failed to check network access", err)
+	}
+
+	question, err := h.attemptRepo.SetQuestionFlag(input.ID, input.QuestionID, input.Body.Flagged)
+	if err != nil {
+		switch err.Error() {
+		case "attempt not found":
+			return nil, huma.Error404NotFound("Attempt not found")
+		case "attempt has ended":
+			return nil, huma.Error409Conflict("Attempt has ended")
+		}
+		return nil, huma.Error500InternalServerError("Failed to flag question", err)
+	}
+
+	message := "Question flagged for review"
+	if !input.Body.Flagged {
+		message = "Question flag removed"
+	}
+
+	return &FlagQuestionOutput{
+		Body: struct {
+			Success  bool                    `json:"success"`
+			Message  string                  `json:"message"`
+			Question *tables.AttemptQuestion `json:"question,omitempty"`
+		}{
+			Success:  true,
+			Message:  message,
+			Question: question,
+		},
+	}, nil
+}
+
+// Get Attempt Review
+type GetAttemptReviewInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type GetAttemptReviewOutput struct {
+	Body *tables.AttemptReview `json:"body"`
+}
+
+func (h *AttemptHandler) GetAttemptReview(ctx context.Context, input *GetAttemptReviewInput) (*GetAttemptReviewOutput, error) {
+	if _, err := h.getOpenAttempt(ctx, input.ID); err != nil {
+		return nil, err
+	}
+
+	review, err := h.attemptRepo.GetAttemptReview(input.ID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get attempt review", err)
+	}
+
+	return &GetAttemptReviewOutput{Body: review}, nil
+}
+
+// getOpenAttempt gets an attempt that has not ended, checking committee access to its delivery
+func (h *AttemptHandler) getOpenAttempt(ctx context.Context, attemptID int) (*tables.Attempt, error) {
+	attempt, err := h.attemptRepo.GetByID(attemptID)
+	if err != nil {
+		return nil, huma.Error404NotFound("Attempt not found")
+	}
+
+	if _, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, attempt.DeliveryID); err != nil {
+		return nil, err
+	}
+
+	if attempt.EndedAt != nil {
+		return nil, huma.Error409Conflict("Attempt has ended")
+	}
+	return attempt, nil
+}
+
 // Update Attempt Score
 type UpdateAttemptScoreInput struct {
 	ID   int                   `path:"id" minimum:"1"`
@@ -357,27 +500,21 @@ type UpdateAttemptScoreOutput struct {
 }
 
 func (h *AttemptHandler) UpdateAttemptScore(ctx context.Context, input *UpdateAttemptScoreInput) (*UpdateAttemptScoreOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
+	before, err := h.attemptRepo.GetByID(input.ID)
+	if err != nil {
+		return nil, huma.Error404NotFound("Attempt not found")
 	}
 
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+	err = h.attemptRepo.UpdateScore(input.ID, input.Body.Score, input.Body.Penalty)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to update attempt score", err)
 	}
 
-	err := h.attemptRepo.UpdateScore(input.ID, input.Body.Score, input.Body.Penalty)
+	attempt, err := h.attemptRepo.GetByID(input.ID)
 	if err != nil {
-		return nil, huma.Error500InternalServerError("Failed to update attempt score", err)
+		return nil, huma.Error500InternalServerError("Failed to get attempt", err)
 	}
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityAttempt, input.ID, before, attempt)
 
 	return &UpdateAttemptScoreOutput{
 		Body: struct {
@@ -402,23 +539,6 @@ type GetDeliveryResultsOutput struct {
 }
 
 func (h *AttemptHandler) GetDeliveryResults(ctx context.Context, input *GetDeliveryResultsInput) (*GetDeliveryResultsOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
-	}
-
 	pagination := tables.Pagination{
 		Page:    input.Page,
 		PerPage: input.PerPage,
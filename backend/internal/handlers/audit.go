@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// AuditHandler serves the audit log of changes to records
+type AuditHandler struct {
+	auditRepo *models.AuditModel
+}
+
+func NewAuditHandler(auditRepo *models.AuditModel) *AuditHandler {
+	return &AuditHandler{auditRepo: auditRepo}
+}
+
+// auditActor is the signed-in user of a request, as recorded in the audit log
+func auditActor(ctx context.Context) tables.AuditActor {
+	actor := tables.AuditActor{IPAddress: middleware.GetClientIPFromContext(ctx)}
+	if sessionData := middleware.GetSessionDataFromContext(ctx); sessionData != nil {
+		actor.UserID = sessionData.UserID
+		actor.Name = sessionData.Name
+		actor.ClientID = sessionData.ClientID
+	}
+	return actor
+}
+
+// auditNoLink and auditLink record links between records in the audit log, such as a question
+// set in an exam, as a change of the record linked to: a field named after the linked record,
+// holding the details of the link, that is added or removed
+var auditNoLink = map[string]any{}
+
+func auditLink(field string, id int, details any) map[string]any {
+	return map[string]any{fmt.Sprintf("%s.%d", field, id): details}
+}
+
+// auditAction records an action that changes no field the API shows, such as a password
+// reset, as a change of a field named after it. Recorded with auditNoLink before, every
+// action is a change of its own.
+func auditAction(field string, details any) map[string]any {
+	return map[string]any{field: details}
+}
+
+// auditScope is the part of the audit log a request may see: that of the client the session
+// works with, or every client for users with client:manage
+func auditScope(ctx context.Context) models.ClientScope {
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+	if sessionData != nil && sessionData.HasPermission(tables.PermissionClientManage) {
+		return models.AllClients()
+	}
+	return clientScope(ctx)
+}
+
+func (h *AuditHandler) Register(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "list-audit-log",
+		Method:      http.MethodGet,
+		Path:        "/api/audit-log",
+		Summary:     "List audit log",
+		Description: "Get who created, updated and deleted records, newest first, with the changed fields before and after. Users with client:manage see every client.",
+		Tags:        []string{"Audit"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionAuditView),
+	}, h.ListAuditLog)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-audit-entry",
+		Method:      http.MethodGet,
+		Path:        "/api/audit-log/{id}",
+		Summary:     "Get audit entry",
+		Description: "Get one change from the audit log.",
+		Tags:        []string{"Audit"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionAuditView),
+	}, h.GetAuditEntry)
+}
+
+// List Audit Log
+type ListAuditLogInput struct {
+	Page       int       `query:"page" default:"1" minimum:"1"`
+	PerPage    int       `query:"per_page" default:"15" minimum:"1" maximum:"100"`
+	ClientID   int       `query:"client_id" minimum:"0" doc:"Only changes of records of a client, for users with client:manage"`
+	EntityType string    `query:"entity_type" enum:"exam,item,category,group,participant,delivery,user,role,client,attempt"`
+	EntityID   int       `query:"entity_id" minimum:"0" doc:"Only changes of one record, with entity_type"`
+	ActorID    int       `query:"actor_id" minimum:"0" doc:"Only changes made by a user"`
+	Action     string    `query:"action" enum:"create,update,delete"`
+	Field      string    `query:"field" maxLength:"64" doc:"Only changes of a field"`
+	From       time.Time `query:"from" doc:"Only changes made at or after this time"`
+	To         time.Time `query:"to" doc:"Only changes made before this time"`
+}
+
+type ListAuditLogOutput struct {
+	Body tables.PaginatedResponse `json:"body"`
+}
+
+func (h *AuditHandler) ListAuditLog(ctx context.Context, input *ListAuditLogInput) (*ListAuditLogOutput, error) {
+	if input.EntityID != 0 && input.EntityType == "" {
+		return nil, huma.Error400BadRequest("entity_id needs entity_type")
+	}
+
+	pagination := tables.Pagination{
+		Page:    input.Page,
+		PerPage: input.PerPage,
+	}
+
+	search := tables.AuditSearchRequest{
+		ClientID:   input.ClientID,
+		EntityType: input.EntityType,
+		EntityID:   input.EntityID,
+		ActorID:    input.ActorID,
+		Action:     input.Action,
+		Field:      input.Field,
+		From:       input.From,
+		To:         input.To,
+	}
+
+	result, err := h.auditRepo.List(auditScope(ctx), pagination, search)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get audit log", err)
+	}
+
+	return &ListAuditLogOutput{Body: *result}, nil
+}
+
+// Get Audit Entry
+type GetAuditEntryInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type GetAuditEntryOutput struct {
+	Body *tables.AuditEntry `json:"body"`
+}
+
+func (h *AuditHandler) GetAuditEntry(ctx context.Context, input *GetAuditEntryInput) (*GetAuditEntryOutput, error) {
+	entry, err := h.auditRepo.GetByID(auditScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "audit entry not found" {
+			return nil, huma.Error404NotFound("Audit entry not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to get audit entry", err)
+	}
+
+	return &GetAuditEntryOutput{Body: entry}, nil
+}
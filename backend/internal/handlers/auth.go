@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -30,8 +31,9 @@ func (h *AuthHandler) Register(api huma.API) {
 		Method:      http.MethodPost,
 		Path:        "/api/auth/login",
 		Summary:     "User login",
-		Description: "Authenticate user with username and password. Creates a new session (replacing any existing session).",
+		Description: "Authenticate user with username and password. Creates a new session, ending the least recently used session when the user is at their session limit. Repeated failures delay further attempts and then lock the username out, answered with 429 and Retry-After. When two_factor_pending is set, the session is limited until a two-factor code is verified or two-factor authentication is set up. When password_change_required is set, it is limited until the password is changed.",
 		Tags:        []string{"Authentication"},
+		Metadata:    middleware.Public(),
 	}, h.Login)
 
 	huma.Register(api, huma.Operation{
@@ -41,6 +43,7 @@ func (h *AuthHandler) Register(api huma.API) {
 		Summary:     "User logout",
 		Description: "Logout current user and destroy session.",
 		Tags:        []string{"Authentication"},
+		Metadata:    middleware.Public(),
 	}, h.Logout)
 
 	huma.Register(api, huma.Operation{
@@ -48,13 +51,15 @@ func (h *AuthHandler) Register(api huma.API) {
 		Method:      http.MethodGet,
 		Path:        "/api/auth/me",
 		Summary:     "Get current user",
-		Description: "Get information about the currently authenticated user.",
+		Description: "Get information about the currently authenticated user, including a session still waiting for two-factor authentication.",
 		Tags:        []string{"Authentication"},
+		Metadata:    middleware.RequireSession(),
 	}, h.GetCurrentUser)
 }
 
 type LoginInput struct {
-	Body tables.LoginRequest `json:"body"`
+	UserAgent string              `header:"User-Agent"`
+	Body      tables.LoginRequest `json:"body"`
 }
 
 type LoginOutput struct {
@@ -62,12 +67,14 @@ type LoginOutput struct {
 }
 
 func (h *AuthHandler) Login(ctx context.Context, input *LoginInput) (*LoginOutput, error) {
-	// For now, use placeholder values - we'll improve this later
-	ipAddress := "127.0.0.1" // TODO: Get actual IP from context
-	userAgent := "unknown"   // TODO: Get actual User-Agent from context
+	ipAddress := middleware.GetClientIPFromContext(ctx)
+	userAgent := input.UserAgent
+	if userAgent == "" {
+		userAgent = "unknown"
+	}
 
 	// Attempt login
-	session, user, err := h.authService.Login(
+	session, user, sessionData, err := h.authService.Login(
 		input.Body.Username,
 		input.Body.Password,
 		ipAddress,
@@ -75,6 +82,10 @@ func (h *AuthHandler) Login(ctx context.Context, input *LoginInput) (*LoginOutpu
 	)
 	if err != nil {
 		fmt.Printf("DEBUG: Login handler error: %v\n", err)
+		var blocked *services.LoginBlockedError
+		if errors.As(err, &blocked) {
+			return nil, loginBlockedError(blocked)
+		}
 		return &LoginOutput{
 			Body: tables.LoginResponse{
 				Success: false,
@@ -86,17 +97,35 @@ func (h *AuthHandler) Login(ctx context.Context, input *LoginInput) (*LoginOutpu
 	// TODO: Set session cookie when we figure out how to access response in Huma v2
 	// For now, return session ID in response body so we can test the login flow
 
+	return &LoginOutput{Body: newLoginResponse(session.ID, user, sessionData)}, nil
+}
+
+// newLoginResponse describes a new session, and what the user must do before it is fully
+// signed in
+func newLoginResponse(sessionID string, user *tables.User, sessionData *tables.SessionData) tables.LoginResponse {
 	// Remove password from response
 	user.Password = ""
 
-	return &LoginOutput{
-		Body: tables.LoginResponse{
-			Success:   true,
-			Message:   "Login successful",
-			User:      user,
-			SessionID: session.ID,
-		},
-	}, nil
+	message := "Login successful"
+	switch sessionData.TwoFactorPending {
+	case tables.TwoFactorPendingVerify:
+		message = "Enter your two-factor code to continue"
+	case tables.TwoFactorPendingEnroll:
+		message = "Set up two-factor authentication to continue"
+	default:
+		if sessionData.PasswordChangeRequired {
+			message = "Change your password to continue"
+		}
+	}
+
+	return tables.LoginResponse{
+		Success:                true,
+		Message:                message,
+		User:                   user,
+		SessionID:              sessionID,
+		TwoFactorPending:       sessionData.TwoFactorPending,
+		PasswordChangeRequired: sessionData.PasswordChangeRequired,
+	}
 }
 
 type LogoutOutput struct {
@@ -107,8 +136,12 @@ type LogoutOutput struct {
 }
 
 func (h *AuthHandler) Logout(ctx context.Context, input *struct{}) (*LogoutOutput, error) {
-	// TODO: Get session ID from cookie when we implement proper session handling
-	// For now, just return success
+	// TODO: Clear the session cookie when we figure out how to access response in Huma v2
+	if sessionID := middleware.GetSessionIDFromContext(ctx); sessionID != "" {
+		if err := h.authService.Logout(sessionID); err != nil {
+			return nil, huma.Error500InternalServerError("Failed to log out", err)
+		}
+	}
 
 	return &LogoutOutput{
 		Body: struct {
@@ -122,23 +122,14 @@ func GetDateRangeFromFilter(filter *DateFilter) (startDate, endDate *time.Time)
 }
 
 // ValidateListAccess checks if user has access to list resources
-func ValidateListAccess(ctx context.Context, requiredRole string) error {
+func ValidateListAccess(ctx context.Context, requiredPermission string) error {
 	sessionData := middleware.GetSessionDataFromContext(ctx)
 	if sessionData == nil {
 		return huma.Error401Unauthorized("Authentication required")
 	}
 
-	if requiredRole != "" {
-		hasRole := false
-		for _, role := range sessionData.Roles {
-			if role.Name == requiredRole {
-				hasRole = true
-				break
-			}
-		}
-		if !hasRole {
-			return huma.Error403Forbidden("Insufficient permissions")
-		}
+	if requiredPermission != "" && !sessionData.HasPermission(requiredPermission) {
+		return huma.Error403Forbidden("Insufficient permissions")
 	}
 
 	return nil
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
 	"github.com/medxamion/medxamion/internal/tables"
 
 	"github.com/danielgtaylor/huma/v2"
@@ -13,10 +14,11 @@ import (
 
 type CategoryHandler struct {
 	categoryRepo *models.CategoryModel
+	auditService *services.AuditService
 }
 
-func NewCategoryHandler(categoryRepo *models.CategoryModel) *CategoryHandler {
-	return &CategoryHandler{categoryRepo: categoryRepo}
+func NewCategoryHandler(categoryRepo *models.CategoryModel, auditService *services.AuditService) *CategoryHandler {
+	return &CategoryHandler{categoryRepo: categoryRepo, auditService: auditService}
 }
 
 func (h *CategoryHandler) Register(api huma.API) {
@@ -28,6 +30,7 @@ func (h *CategoryHandler) Register(api huma.API) {
 		Description: "Get a paginated list of question categories with search and type filtering.",
 		Tags:        []string{"Categories"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.ListCategories)
 
 	huma.Register(api, huma.Operation{
@@ -38,6 +41,7 @@ func (h *CategoryHandler) Register(api huma.API) {
 		Description: "Get detailed information about a specific category.",
 		Tags:        []string{"Categories"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetCategory)
 
 	huma.Register(api, huma.Operation{
@@ -48,6 +52,7 @@ func (h *CategoryHandler) Register(api huma.API) {
 		Description: "Create a new question category.",
 		Tags:        []string{"Categories"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionCategoryManage),
 	}, h.CreateCategory)
 
 	huma.Register(api, huma.Operation{
@@ -58,6 +63,7 @@ func (h *CategoryHandler) Register(api huma.API) {
 		Description: "Update category information.",
 		Tags:        []string{"Categories"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionCategoryManage),
 	}, h.UpdateCategory)
 
 	huma.Register(api, huma.Operation{
@@ -68,6 +74,7 @@ func (h *CategoryHandler) Register(api huma.API) {
 		Description: "Delete a question category.",
 		Tags:        []string{"Categories"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionCategoryManage),
 	}, h.DeleteCategory)
 
 	huma.Register(api, huma.Operation{
@@ -78,6 +85,7 @@ func (h *CategoryHandler) Register(api huma.API) {
 		Description: "Get all categories of a specific type (disease_group, region_group, etc.).",
 		Tags:        []string{"Categories"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetCategoriesByType)
 
 	huma.Register(api, huma.Operation{
@@ -88,6 +96,7 @@ func (h *CategoryHandler) Register(api huma.API) {
 		Description: "Get paginated list of questions in a category.",
 		Tags:        []string{"Categories"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetCategoryQuestions)
 
 	huma.Register(api, huma.Operation{
@@ -98,6 +107,7 @@ func (h *CategoryHandler) Register(api huma.API) {
 		Description: "Add a question to a category.",
 		Tags:        []string{"Categories"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionCategoryManage),
 	}, h.AddQuestionToCategory)
 
 	huma.Register(api, huma.Operation{
@@ -108,6 +118,7 @@ func (h *CategoryHandler) Register(api huma.API) {
 		Description: "Remove a question from a category.",
 		Tags:        []string{"Categories"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionCategoryManage),
 	}, h.RemoveQuestionFromCategory)
 }
 
@@ -124,11 +135,6 @@ type ListCategoriesOutput struct {
 }
 
 func (h *CategoryHandler) ListCategories(ctx context.Context, input *ListCategoriesInput) (*ListCategoriesOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	pagination := tables.Pagination{
 		Page:    input.Page,
 		PerPage: input.PerPage,
@@ -139,7 +145,7 @@ func (h *CategoryHandler) ListCategories(ctx context.Context, input *ListCategor
 		Type: tables.CategoryType(input.Type),
 	}
 
-	result, err := h.categoryRepo.List(pagination, search)
+	result, err := h.categoryRepo.List(clientScope(ctx), pagination, search)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to get categories", err)
 	}
@@ -157,12 +163,7 @@ type GetCategoryOutput struct {
 }
 
 func (h *CategoryHandler) GetCategory(ctx context.Context, input *GetCategoryInput) (*GetCategoryOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	category, err := h.categoryRepo.GetByID(input.ID)
+	category, err := h.categoryRepo.GetByID(clientScope(ctx), input.ID)
 	if err != nil {
 		return nil, huma.Error404NotFound("Category not found")
 	}
@@ -184,21 +185,8 @@ type CreateCategoryOutput struct {
 }
 
 func (h *CategoryHandler) CreateCategory(ctx context.Context, input *CreateCategoryInput) (*CreateCategoryOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+	if err := h.checkParent(ctx, input.Body.Parent); err != nil {
+		return nil, err
 	}
 
 	category := &tables.Category{
@@ -207,14 +195,15 @@ func (h *CategoryHandler) CreateCategory(ctx context.Context, input *CreateCateg
 		Parent:      input.Body.Parent,
 		Name:        input.Body.Name,
 		Description: input.Body.Description,
-		ClientID:    2, // Default client ID
 	}
 
-	err := h.categoryRepo.Create(category)
+	err := h.categoryRepo.Create(clientScope(ctx), category)
 	if err != nil {
-		return nil, huma.Error500InternalServerError("Failed to create category", err)
+		return nil, createInClientError(err, "Failed to create category")
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityCategory, category.ID, nil, category)
+
 	return &CreateCategoryOutput{
 		Body: struct {
 			Success  bool             `json:"success"`
@@ -243,28 +232,30 @@ type UpdateCategoryOutput struct {
 }
 
 func (h *CategoryHandler) UpdateCategory(ctx context.Context, input *UpdateCategoryInput) (*UpdateCategoryOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
+	if input.Body.Parent != nil {
+		if err := h.checkParent(ctx, *input.Body.Parent); err != nil {
+			return nil, err
+		}
 	}
 
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
+	before, err := h.categoryRepo.GetByID(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "category not found" {
+			return nil, huma.Error404NotFound("Category not found")
 		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+		return nil, huma.Error500InternalServerError("Failed to get category", err)
 	}
 
-	category, err := h.categoryRepo.Update(input.ID, &input.Body)
+	category, err := h.categoryRepo.Update(clientScope(ctx), input.ID, &input.Body)
 	if err != nil {
+		if err.Error() == "category not found" {
+			return nil, huma.Error404NotFound("Category not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to update category", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityCategory, category.ID, before, category)
+
 	return &UpdateCategoryOutput{
 		Body: struct {
 			Success  bool             `json:"success"`
@@ -291,28 +282,24 @@ type DeleteCategoryOutput struct {
 }
 
 func (h *CategoryHandler) DeleteCategory(ctx context.Context, input *DeleteCategoryInput) (*DeleteCategoryOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
+	before, err := h.categoryRepo.GetByID(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "category not found" {
+			return nil, huma.Error404NotFound("Category not found")
 		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+		return nil, huma.Error500InternalServerError("Failed to get category", err)
 	}
 
-	err := h.categoryRepo.Delete(input.ID)
+	err = h.categoryRepo.Delete(clientScope(ctx), input.ID)
 	if err != nil {
+		if err.Error() == "category not found" {
+			return nil, huma.Error404NotFound("Category not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to delete category", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityCategory, input.ID, before, nil)
+
 	return &DeleteCategoryOutput{
 		Body: struct {
 			Success bool   `json:"success"`
@@ -334,12 +321,7 @@ type GetCategoriesByTypeOutput struct {
 }
 
 func (h *CategoryHandler) GetCategoriesByType(ctx context.Context, input *GetCategoriesByTypeInput) (*GetCategoriesByTypeOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	categories, err := h.categoryRepo.GetByType(tables.CategoryType(input.Type))
+	categories, err := h.categoryRepo.GetByType(clientScope(ctx), tables.CategoryType(input.Type))
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to get categories", err)
 	}
@@ -359,18 +341,16 @@ type GetCategoryQuestionsOutput struct {
 }
 
 func (h *CategoryHandler) GetCategoryQuestions(ctx context.Context, input *GetCategoryQuestionsInput) (*GetCategoryQuestionsOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	pagination := tables.Pagination{
 		Page:    input.Page,
 		PerPage: input.PerPage,
 	}
 
-	result, err := h.categoryRepo.GetCategoryQuestions(input.ID, pagination)
+	result, err := h.categoryRepo.GetCategoryQuestions(clientScope(ctx), input.ID, pagination)
 	if err != nil {
+		if err.Error() == "category not found" {
+			return nil, huma.Error404NotFound("Category not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to get category questions", err)
 	}
 
@@ -393,28 +373,16 @@ type AddQuestionToCategoryOutput struct {
 }
 
 func (h *CategoryHandler) AddQuestionToCategory(ctx context.Context, input *AddQuestionToCategoryInput) (*AddQuestionToCategoryOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
-	}
-
-	err := h.categoryRepo.AddQuestion(input.ID, input.Body.QuestionID)
+	err := h.categoryRepo.AddQuestion(clientScope(ctx), input.ID, input.Body.QuestionID)
 	if err != nil {
+		if err.Error() == "category not found" {
+			return nil, huma.Error404NotFound("Category not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to add question to category", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityCategory, input.ID, auditNoLink, auditLink("questions", input.Body.QuestionID, true))
+
 	return &AddQuestionToCategoryOutput{
 		Body: struct {
 			Success bool   `json:"success"`
@@ -440,28 +408,13 @@ type RemoveQuestionFromCategoryOutput struct {
 }
 
 func (h *CategoryHandler) RemoveQuestionFromCategory(ctx context.Context, input *RemoveQuestionFromCategoryInput) (*RemoveQuestionFromCategoryOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
-	}
-
-	err := h.categoryRepo.RemoveQuestion(input.ID, input.QuestionID)
+	err := h.categoryRepo.RemoveQuestion(clientScope(ctx), input.ID, input.QuestionID)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to remove question from category", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityCategory, input.ID, auditLink("questions", input.QuestionID, true), auditNoLink)
+
 	return &RemoveQuestionFromCategoryOutput{
 		Body: struct {
 			Success bool   `json:"success"`
@@ -472,3 +425,17 @@ func (h *CategoryHandler) RemoveQuestionFromCategory(ctx context.Context, input
 		},
 	}, nil
 }
+
+// checkParent rejects a parent category outside the client of the request; 0 is no parent
+func (h *CategoryHandler) checkParent(ctx context.Context, parent int) error {
+	if parent == 0 {
+		return nil
+	}
+	if _, err := h.categoryRepo.GetByID(clientScope(ctx), parent); err != nil {
+		if err.Error() == "category not found" {
+			return huma.Error400BadRequest("Parent category not found")
+		}
+		return huma.Error500InternalServerError("Failed to get parent category", err)
+	}
+	return nil
+}
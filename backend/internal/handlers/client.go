@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// ClientHandler manages clients (tenants), the users working for them, and which client a
+// session works with
+type ClientHandler struct {
+	clientRepo   *models.ClientModel
+	userRepo     *models.UserModel
+	authService  *services.AuthService
+	auditService *services.AuditService
+}
+
+func NewClientHandler(clientRepo *models.ClientModel, userRepo *models.UserModel, authService *services.AuthService, auditService *services.AuditService) *ClientHandler {
+	return &ClientHandler{
+		clientRepo:   clientRepo,
+		userRepo:     userRepo,
+		authService:  authService,
+		auditService: auditService,
+	}
+}
+
+// clientScope is the client the session of a request works with. Requests without a session
+// get a scope matching no data.
+func clientScope(ctx context.Context) models.ClientScope {
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+	if sessionData == nil {
+		return models.ClientScope{}
+	}
+	return models.ForClient(sessionData.ClientID)
+}
+
+// createInClientError is the response to a failed create of client data, which needs the
+// session to work with a client
+func createInClientError(err error, message string) error {
+	if err.Error() == "no client selected" {
+		return huma.Error400BadRequest("No client selected")
+	}
+	return huma.Error500InternalServerError(message, err)
+}
+
+func (h *ClientHandler) Register(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-current-client",
+		Method:      http.MethodGet,
+		Path:        "/api/auth/client",
+		Summary:     "Get current client",
+		Description: "Get the client the session works with, with its settings, and the clients it can switch to.",
+		Tags:        []string{"Authentication", "Clients"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
+	}, h.GetCurrentClient)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "switch-client",
+		Method:      http.MethodPut,
+		Path:        "/api/auth/client",
+		Summary:     "Switch client",
+		Description: "Make the session work with another client the user works for. Users with client:manage can switch to any client.",
+		Tags:        []string{"Authentication", "Clients"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
+	}, h.SwitchClient)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-clients",
+		Method:      http.MethodGet,
+		Path:        "/api/clients",
+		Summary:     "List clients",
+		Description: "Get all clients with their settings and how many users work for them.",
+		Tags:        []string{"Clients"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionClientManage),
+	}, h.ListClients)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-client",
+		Method:      http.MethodGet,
+		Path:        "/api/clients/{id}",
+		Summary:     "Get client by ID",
+		Description: "Get a client with its settings.",
+		Tags:        []string{"Clients"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionClientManage),
+	}, h.GetClient)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "create-client",
+		Method:      http.MethodPost,
+		Path:        "/api/clients",
+		Summary:     "Create client",
+		Description: "Create a client. Settings left out get their defaults.",
+		Tags:        []string{"Clients"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionClientManage),
+	}, h.CreateClient)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "update-client",
+		Method:      http.MethodPut,
+		Path:        "/api/clients/{id}",
+		Summary:     "Update client",
+		Description: "Update the name and settings of a client. An empty logo URL removes the logo.",
+		Tags:        []string{"Clients"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionClientManage),
+	}, h.UpdateClient)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-user-clients",
+		Method:      http.MethodGet,
+		Path:        "/api/users/{id}/clients",
+		Summary:     "Get user clients",
+		Description: "Get the clients a user works for.",
+		Tags:        []string{"Clients", "Users"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionClientManage),
+	}, h.GetUserClients)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "set-user-clients",
+		Method:      http.MethodPut,
+		Path:        "/api/users/{id}/clients",
+		Summary:     "Set user clients",
+		Description: "Replace the clients a user works for. Their sessions move to another client when they no longer work for theirs.",
+		Tags:        []string{"Clients", "Users"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionClientManage),
+	}, h.SetUserClients)
+}
+
+// Get Current Client
+type CurrentClientOutput struct {
+	Body *tables.CurrentClient `json:"body"`
+}
+
+func (h *ClientHandler) GetCurrentClient(ctx context.Context, input *struct{}) (*CurrentClientOutput, error) {
+	return h.currentClientOutput(middleware.GetSessionDataFromContext(ctx))
+}
+
+// Switch Client
+type SwitchClientInput struct {
+	Body tables.SwitchClientRequest `json:"body"`
+}
+
+func (h *ClientHandler) SwitchClient(ctx context.Context, input *SwitchClientInput) (*CurrentClientOutput, error) {
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+
+	err := h.authService.SwitchClient(middleware.GetSessionIDFromContext(ctx), sessionData, input.Body.ClientID)
+	if err != nil {
+		if err.Error() == "client not found" {
+			return nil, huma.Error404NotFound("Client not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to switch client", err)
+	}
+
+	return h.currentClientOutput(sessionData)
+}
+
+// List Clients
+type ListClientsWithUsersOutput struct {
+	Body []tables.ClientWithUsers `json:"body"`
+}
+
+func (h *ClientHandler) ListClients(ctx context.Context, input *struct{}) (*ListClientsWithUsersOutput, error) {
+	clients, err := h.clientRepo.List()
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to list clients", err)
+	}
+
+	return &ListClientsWithUsersOutput{Body: clients}, nil
+}
+
+// Get Client
+type GetClientInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type GetClientOutput struct {
+	Body *tables.Client `json:"body"`
+}
+
+func (h *ClientHandler) GetClient(ctx context.Context, input *GetClientInput) (*GetClientOutput, error) {
+	client, err := h.clientRepo.GetByID(input.ID)
+	if err != nil {
+		if err.Error() == "client not found" {
+			return nil, huma.Error404NotFound("Client not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to get client", err)
+	}
+
+	return &GetClientOutput{Body: client}, nil
+}
+
+// Create Client
+type CreateClientInput struct {
+	Body tables.ClientCreateRequest `json:"body"`
+}
+
+type ClientOutput struct {
+	Body struct {
+		Success bool           `json:"success"`
+		Message string         `json:"message"`
+		Client  *tables.Client `json:"client,omitempty"`
+	} `json:"body"`
+}
+
+func (h *ClientHandler) CreateClient(ctx context.Context, input *CreateClientInput) (*ClientOutput, error) {
+	if err := validateClientSettings(&input.Body.ClientSettingsRequest); err != nil {
+		return nil, err
+	}
+
+	client, err := h.clientRepo.Create(&input.Body)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to create client", err)
+	}
+
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityClient, client.ID, nil, client)
+
+	return clientOutput("Client created successfully", client), nil
+}
+
+// Update Client
+type UpdateClientInput struct {
+	ID   int                        `path:"id" minimum:"1"`
+	Body tables.ClientUpdateRequest `json:"body"`
+}
+
+func (h *ClientHandler) UpdateClient(ctx context.Context, input *UpdateClientInput) (*ClientOutput, error) {
+	if err := validateClientSettings(&input.Body.ClientSettingsRequest); err != nil {
+		return nil, err
+	}
+
+	before, err := h.clientRepo.GetByID(input.ID)
+	if err != nil {
+		if err.Error() == "client not found" {
+			return nil, huma.Error404NotFound("Client not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to get client", err)
+	}
+
+	client, err := h.clientRepo.Update(input.ID, &input.Body)
+	if err != nil {
+		if err.Error() == "client not found" {
+			return nil, huma.Error404NotFound("Client not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to update client", err)
+	}
+
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityClient, client.ID, before, client)
+
+	return clientOutput("Client updated successfully", client), nil
+}
+
+// Get User Clients
+type GetUserClientsInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type UserClientsOutput struct {
+	Body []tables.Client `json:"body"`
+}
+
+func (h *ClientHandler) GetUserClients(ctx context.Context, input *GetUserClientsInput) (*UserClientsOutput, error) {
+	if _, err := h.userRepo.GetByID(input.ID); err != nil {
+		return nil, huma.Error404NotFound("User not found")
+	}
+
+	return h.userClientsOutput(input.ID)
+}
+
+// Set User Clients
+type SetUserClientsInput struct {
+	ID   int                       `path:"id" minimum:"1"`
+	Body tables.UserClientsRequest `json:"body"`
+}
+
+func (h *ClientHandler) SetUserClients(ctx context.Context, input *SetUserClientsInput) (*UserClientsOutput, error) {
+	if _, err := h.userRepo.GetByID(input.ID); err != nil {
+		return nil, huma.Error404NotFound("User not found")
+	}
+
+	before, err := h.userClientsOutput(input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.clientRepo.SetUserClients(input.ID, input.Body.ClientIDs); err != nil {
+		if err.Error() == "client not found" {
+			return nil, huma.Error400BadRequest("Client not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to set user clients", err)
+	}
+
+	output, err := h.userClientsOutput(input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityUser, input.ID, userClientIDs(before.Body), userClientIDs(output.Body))
+	return output, nil
+}
+
+// userClientIDs is the clients of a user as recorded in the audit log
+func userClientIDs(clients []tables.Client) map[string][]int {
+	ids := make([]int, 0, len(clients))
+	for _, client := range clients {
+		ids = append(ids, client.ID)
+	}
+	return map[string][]int{"client_ids": ids}
+}
+
+func (h *ClientHandler) currentClientOutput(sessionData *tables.SessionData) (*CurrentClientOutput, error) {
+	current := &tables.CurrentClient{}
+
+	if sessionData.HasPermission(tables.PermissionClientManage) {
+		clients, err := h.clientRepo.List()
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Failed to list clients", err)
+		}
+		current.Available = make([]tables.Client, 0, len(clients))
+		for _, client := range clients {
+			current.Available = append(current.Available, client.Client)
+		}
+	} else {
+		clients, err := h.clientRepo.ListForUser(sessionData.UserID)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Failed to list clients", err)
+		}
+		current.Available = clients
+	}
+
+	for i := range current.Available {
+		if current.Available[i].ID == sessionData.ClientID {
+			current.Client = &current.Available[i]
+		}
+	}
+
+	return &CurrentClientOutput{Body: current}, nil
+}
+
+func (h *ClientHandler) userClientsOutput(userID int) (*UserClientsOutput, error) {
+	clients, err := h.clientRepo.ListForUser(userID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get user clients", err)
+	}
+
+	return &UserClientsOutput{Body: clients}, nil
+}
+
+// validateClientSettings rejects a time zone Go does not know
+func validateClientSettings(settings *tables.ClientSettingsRequest) error {
+	if settings.Timezone != nil {
+		if _, err := time.LoadLocation(*settings.Timezone); err != nil {
+			return huma.Error400BadRequest("Unknown time zone " + *settings.Timezone)
+		}
+	}
+	return nil
+}
+
+func clientOutput(message string, client *tables.Client) *ClientOutput {
+	output := &ClientOutput{}
+	output.Body.Success = true
+	output.Body.Message = message
+	output.Body.Client = client
+	return output
+}
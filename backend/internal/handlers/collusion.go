@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+type CollusionHandler struct {
+	collusionService *services.CollusionService
+	assignmentRepo   *models.DeliveryAssignmentModel
+}
+
+func NewCollusionHandler(collusionService *services.CollusionService, assignmentRepo *models.DeliveryAssignmentModel) *CollusionHandler {
+	return &CollusionHandler{
+		collusionService: collusionService,
+		assignmentRepo:   assignmentRepo,
+	}
+}
+
+func (h *CollusionHandler) Register(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-delivery-collusion-analysis",
+		Method:      http.MethodGet,
+		Path:        "/api/deliveries/{id}/collusion-analysis",
+		Summary:     "Analyze answer similarity",
+		Description: "Rank pairs of candidates by answer similarity (g2 and Angoff's B), taking shared IP addresses and subnets into account.",
+		Tags:        []string{"Results"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.GetCollusionAnalysis)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "export-delivery-collusion-analysis",
+		Method:      http.MethodGet,
+		Path:        "/api/deliveries/{id}/collusion-analysis/export",
+		Summary:     "Export answer similarity analysis",
+		Description: "Download the ranked suspicious pairs with their evidence as CSV.",
+		Tags:        []string{"Results"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.ExportCollusionAnalysis)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-delivery-collusion-report",
+		Method:      http.MethodGet,
+		Path:        "/api/deliveries/{id}/collusion-report",
+		Summary:     "Get stored answer similarity analysis",
+		Description: "Get the answer similarity analysis stored when the delivery closed.",
+		Tags:        []string{"Results"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.GetCollusionReport)
+}
+
+// Get Collusion Analysis
+type GetCollusionAnalysisInput struct {
+	ID int `path:"id" minimum:"1"`
+	tables.CollusionAnalysisRequest
+}
+
+type GetCollusionAnalysisOutput struct {
+	Body *tables.CollusionReport `json:"body"`
+}
+
+func (h *CollusionHandler) GetCollusionAnalysis(ctx context.Context, input *GetCollusionAnalysisInput) (*GetCollusionAnalysisOutput, error) {
+	if _, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID); err != nil {
+		return nil, err
+	}
+
+	report, err := h.collusionService.Analyze(input.ID, input.CollusionAnalysisRequest)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to analyze answer similarity", err)
+	}
+
+	return &GetCollusionAnalysisOutput{Body: report}, nil
+}
+
+// Get Collusion Report
+type GetCollusionReportInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+func (h *CollusionHandler) GetCollusionReport(ctx context.Context, input *GetCollusionReportInput) (*GetCollusionAnalysisOutput, error) {
+	if _, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID); err != nil {
+		return nil, err
+	}
+
+	report, err := h.collusionService.GetStoredReport(input.ID)
+	if err != nil {
+		if err.Error() == "collusion report not found" {
+			return nil, huma.Error404NotFound("No answer similarity analysis has been stored for this delivery")
+		}
+		return nil, huma.Error500InternalServerError("Failed to get answer similarity analysis", err)
+	}
+
+	return &GetCollusionAnalysisOutput{Body: report}, nil
+}
+
+// Export Collusion Analysis
+type ExportCollusionAnalysisInput struct {
+	ID int `path:"id" minimum:"1"`
+	tables.CollusionAnalysisRequest
+}
+
+type ExportCollusionAnalysisOutput struct {
+	ContentType        string `header:"Content-Type"`
+	ContentDisposition string `header:"Content-Disposition"`
+	Body               []byte
+}
+
+func (h *CollusionHandler) ExportCollusionAnalysis(ctx context.Context, input *ExportCollusionAnalysisInput) (*ExportCollusionAnalysisOutput, error) {
+	if _, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID); err != nil {
+		return nil, err
+	}
+
+	report, err := h.collusionService.Analyze(input.ID, input.CollusionAnalysisRequest)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to analyze answer similarity", err)
+	}
+
+	var buf bytes.Buffer
+	if err := services.WriteCollusionCSV(&buf, report); err != nil {
+		return nil, huma.Error500InternalServerError("Failed to export answer similarity analysis", err)
+	}
+
+	return &ExportCollusionAnalysisOutput{
+		ContentType:        "text/csv; charset=utf-8",
+		ContentDisposition: fmt.Sprintf("attachment; filename=\"delivery_%d_collusion.csv\"", input.ID),
+		Body:               buf.Bytes(),
+	}, nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
 	"github.com/medxamion/medxamion/internal/tables"
 
 	"github.com/danielgtaylor/huma/v2"
@@ -14,10 +15,11 @@ import (
 
 type DeliveryHandler struct {
 	deliveryRepo *models.DeliveryModel
+	auditService *services.AuditService
 }
 
-func NewDeliveryHandler(deliveryRepo *models.DeliveryModel) *DeliveryHandler {
-	return &DeliveryHandler{deliveryRepo: deliveryRepo}
+func NewDeliveryHandler(deliveryRepo *models.DeliveryModel, auditService *services.AuditService) *DeliveryHandler {
+	return &DeliveryHandler{deliveryRepo: deliveryRepo, auditService: auditService}
 }
 
 func (h *DeliveryHandler) Register(api huma.API) {
@@ -29,6 +31,7 @@ func (h *DeliveryHandler) Register(api huma.API) {
 		Description: "Get a paginated list of exam deliveries with search and filtering.",
 		Tags:        []string{"Deliveries"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.ListDeliveries)
 
 	huma.Register(api, huma.Operation{
@@ -39,6 +42,7 @@ func (h *DeliveryHandler) Register(api huma.API) {
 		Description: "Get detailed information about a specific exam delivery.",
 		Tags:        []string{"Deliveries"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetDelivery)
 
 	huma.Register(api, huma.Operation{
@@ -49,6 +53,7 @@ func (h *DeliveryHandler) Register(api huma.API) {
 		Description: "Get delivery with complete exam and group information.",
 		Tags:        []string{"Deliveries"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetDeliveryWithDetails)
 
 	huma.Register(api, huma.Operation{
@@ -59,6 +64,7 @@ func (h *DeliveryHandler) Register(api huma.API) {
 		Description: "Schedule a new exam delivery for a group.",
 		Tags:        []string{"Deliveries"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionDeliveryCreate),
 	}, h.CreateDelivery)
 
 	huma.Register(api, huma.Operation{
@@ -69,6 +75,7 @@ func (h *DeliveryHandler) Register(api huma.API) {
 		Description: "Update delivery schedule and configuration.",
 		Tags:        []string{"Deliveries"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionDeliveryUpdate),
 	}, h.UpdateDelivery)
 
 	huma.Register(api, huma.Operation{
@@ -76,11 +83,34 @@ func (h *DeliveryHandler) Register(api huma.API) {
 		Method:      http.MethodDelete,
 		Path:        "/api/deliveries/{id}",
 		Summary:     "Delete delivery",
-		Description: "Delete an exam delivery (only if not started).",
+		Description: "Delete an exam delivery, keeping its attempts. Running deliveries cannot be deleted; deleted deliveries can be restored.",
 		Tags:        []string{"Deliveries"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionDeliveryDelete),
 	}, h.DeleteDelivery)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "list-deleted-deliveries",
+		Method:      http.MethodGet,
+		Path:        "/api/deliveries/deleted",
+		Summary:     "List deleted deliveries",
+		Description: "Get a paginated list of deleted deliveries, most recently deleted first.",
+		Tags:        []string{"Deliveries"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionDeliveryDelete),
+	}, h.ListDeletedDeliveries)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "restore-delivery",
+		Method:      http.MethodPost,
+		Path:        "/api/deliveries/{id}/restore",
+		Summary:     "Restore delivery",
+		Description: "Restore a deleted delivery.",
+		Tags:        []string{"Deliveries"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionDeliveryDelete),
+	}, h.RestoreDelivery)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "get-participant-progress",
 		Method:      http.MethodGet,
@@ -89,6 +119,7 @@ func (h *DeliveryHandler) Register(api huma.API) {
 		Description: "Get real-time progress of all participants in a delivery.",
 		Tags:        []string{"Deliveries"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetParticipantProgress)
 
 	huma.Register(api, huma.Operation{
@@ -99,6 +130,7 @@ func (h *DeliveryHandler) Register(api huma.API) {
 		Description: "Manually start a delivery that has automatic_start set to false.",
 		Tags:        []string{"Deliveries"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionDeliveryControl),
 	}, h.StartDelivery)
 
 	huma.Register(api, huma.Operation{
@@ -109,6 +141,7 @@ func (h *DeliveryHandler) Register(api huma.API) {
 		Description: "Mark a delivery as finished.",
 		Tags:        []string{"Deliveries"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionDeliveryControl),
 	}, h.FinishDelivery)
 
 	huma.Register(api, huma.Operation{
@@ -119,6 +152,7 @@ func (h *DeliveryHandler) Register(api huma.API) {
 		Description: "Get paginated list of attempts for a delivery.",
 		Tags:        []string{"Deliveries"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetDeliveryAttempts)
 }
 
@@ -171,7 +205,7 @@ func (h *DeliveryHandler) ListDeliveries(ctx context.Context, input *ListDeliver
 		}
 	}
 
-	result, err := h.deliveryRepo.List(pagination, search)
+	result, err := h.deliveryRepo.List(clientScope(ctx), pagination, search)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to get deliveries", err)
 	}
@@ -189,12 +223,7 @@ type GetDeliveryOutput struct {
 }
 
 func (h *DeliveryHandler) GetDelivery(ctx context.Context, input *GetDeliveryInput) (*GetDeliveryOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	delivery, err := h.deliveryRepo.GetByID(input.ID)
+	delivery, err := h.deliveryRepo.GetByID(clientScope(ctx), input.ID)
 	if err != nil {
 		return nil, huma.Error404NotFound("Delivery not found")
 	}
@@ -212,12 +241,7 @@ type GetDeliveryWithDetailsOutput struct {
 }
 
 func (h *DeliveryHandler) GetDeliveryWithDetails(ctx context.Context, input *GetDeliveryWithDetailsInput) (*GetDeliveryWithDetailsOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	delivery, err := h.deliveryRepo.GetWithDetails(input.ID)
+	delivery, err := h.deliveryRepo.GetWithDetails(clientScope(ctx), input.ID)
 	if err != nil {
 		return nil, huma.Error404NotFound("Delivery not found")
 	}
@@ -239,21 +263,8 @@ type CreateDeliveryOutput struct {
 }
 
 func (h *DeliveryHandler) CreateDelivery(ctx context.Context, input *CreateDeliveryInput) (*CreateDeliveryOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+	if err := validateDeliveryWindow(input.Body.ScheduledAt, input.Body.EndedAt); err != nil {
+		return nil, err
 	}
 
 	delivery := &tables.Delivery{
@@ -262,16 +273,22 @@ func (h *DeliveryHandler) CreateDelivery(ctx context.Context, input *CreateDeliv
 		Name:           input.Body.Name,
 		ScheduledAt:    input.Body.ScheduledAt,
 		Duration:       input.Body.Duration,
+		EndedAt:        input.Body.EndedAt,
 		IsAnytime:      input.Body.IsAnytime,
 		AutomaticStart: input.Body.AutomaticStart,
 		DisplayName:    input.Body.DisplayName,
 	}
 
-	err := h.deliveryRepo.Create(delivery)
+	err := h.deliveryRepo.Create(clientScope(ctx), delivery)
 	if err != nil {
+		if err.Error() == "exam or group not found" {
+			return nil, huma.Error400BadRequest("Exam or group not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to create delivery", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityDelivery, delivery.ID, nil, delivery)
+
 	return &CreateDeliveryOutput{
 		Body: struct {
 			Success  bool             `json:"success"`
@@ -300,28 +317,37 @@ type UpdateDeliveryOutput struct {
 }
 
 func (h *DeliveryHandler) UpdateDelivery(ctx context.Context, input *UpdateDeliveryInput) (*UpdateDeliveryOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
+	before, err := h.deliveryRepo.GetByID(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "delivery not found" {
+			return nil, huma.Error404NotFound("Delivery not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to get delivery", err)
 	}
 
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
+	if input.Body.ScheduledAt != nil || input.Body.EndedAt != nil {
+		scheduledAt, endedAt := before.ScheduledAt, before.EndedAt
+		if input.Body.ScheduledAt != nil {
+			scheduledAt = input.Body.ScheduledAt
+		}
+		if input.Body.EndedAt != nil {
+			endedAt = input.Body.EndedAt
+		}
+		if err := validateDeliveryWindow(scheduledAt, endedAt); err != nil {
+			return nil, err
 		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
 	}
 
-	delivery, err := h.deliveryRepo.Update(input.ID, &input.Body)
+	delivery, err := h.deliveryRepo.Update(clientScope(ctx), input.ID, &input.Body)
 	if err != nil {
+		if err.Error() == "delivery not found" {
+			return nil, huma.Error404NotFound("Delivery not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to update delivery", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityDelivery, delivery.ID, before, delivery)
+
 	return &UpdateDeliveryOutput{
 		Body: struct {
 			Success  bool             `json:"success"`
@@ -335,6 +361,14 @@ func (h *DeliveryHandler) UpdateDelivery(ctx context.Context, input *UpdateDeliv
 	}, nil
 }
 
+// validateDeliveryWindow checks that a delivery ends after it is scheduled to start
+func validateDeliveryWindow(scheduledAt, endedAt *time.Time) error {
+	if scheduledAt != nil && endedAt != nil && !endedAt.After(*scheduledAt) {
+		return huma.Error400BadRequest("ended_at must be after scheduled_at")
+	}
+	return nil
+}
+
 // Delete Delivery
 type DeleteDeliveryInput struct {
 	ID int `path:"id" minimum:"1"`
@@ -348,28 +382,27 @@ type DeleteDeliveryOutput struct {
 }
 
 func (h *DeliveryHandler) DeleteDelivery(ctx context.Context, input *DeleteDeliveryInput) (*DeleteDeliveryOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
+	before, err := h.deliveryRepo.GetByID(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "delivery not found" {
+			return nil, huma.Error404NotFound("Delivery not found")
 		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+		return nil, huma.Error500InternalServerError("Failed to get delivery", err)
 	}
 
-	err := h.deliveryRepo.Delete(input.ID)
+	err = h.deliveryRepo.Delete(clientScope(ctx), input.ID)
 	if err != nil {
+		if err.Error() == "delivery not found" {
+			return nil, huma.Error404NotFound("Delivery not found")
+		}
+		if err.Error() == "delivery is running" {
+			return nil, huma.Error409Conflict("Delivery is running; finish it first")
+		}
 		return nil, huma.Error500InternalServerError("Failed to delete delivery", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityDelivery, input.ID, before, nil)
+
 	return &DeleteDeliveryOutput{
 		Body: struct {
 			Success bool   `json:"success"`
@@ -381,6 +414,78 @@ func (h *DeliveryHandler) DeleteDelivery(ctx context.Context, input *DeleteDeliv
 	}, nil
 }
 
+// List Deleted Deliveries
+type ListDeletedDeliveriesInput struct {
+	Page    int `query:"page" default:"1" minimum:"1"`
+	PerPage int `query:"per_page" default:"15" minimum:"1" maximum:"100"`
+}
+
+type ListDeletedDeliveriesOutput struct {
+	Body tables.PaginatedResponse `json:"body"`
+}
+
+func (h *DeliveryHandler) ListDeletedDeliveries(ctx context.Context, input *ListDeletedDeliveriesInput) (*ListDeletedDeliveriesOutput, error) {
+	pagination := tables.Pagination{
+		Page:    input.Page,
+		PerPage: input.PerPage,
+	}
+
+	result, err := h.deliveryRepo.ListDeleted(clientScope(ctx), pagination)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get deleted deliveries", err)
+	}
+
+	return &ListDeletedDeliveriesOutput{Body: *result}, nil
+}
+
+// Restore Delivery
+type RestoreDeliveryInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type RestoreDeliveryOutput struct {
+	Body struct {
+		Success  bool             `json:"success"`
+		Message  string           `json:"message"`
+		Delivery *tables.Delivery `json:"delivery,omitempty"`
+	} `json:"body"`
+}
+
+func (h *DeliveryHandler) RestoreDelivery(ctx context.Context, input *RestoreDeliveryInput) (*RestoreDeliveryOutput, error) {
+	before, err := h.deliveryRepo.GetDeleted(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "delivery not found" {
+			return nil, huma.Error404NotFound("Deleted delivery not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to get deleted delivery", err)
+	}
+
+	delivery, err := h.deliveryRepo.Restore(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "delivery not found" {
+			return nil, huma.Error404NotFound("Deleted delivery not found")
+		}
+		if err.Error() == "exam or group is deleted" {
+			return nil, huma.Error409Conflict("Restore the exam and group of the delivery first")
+		}
+		return nil, huma.Error500InternalServerError("Failed to restore delivery", err)
+	}
+
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityDelivery, input.ID, before, delivery)
+
+	return &RestoreDeliveryOutput{
+		Body: struct {
+			Success  bool             `json:"success"`
+			Message  string           `json:"message"`
+			Delivery *tables.Delivery `json:"delivery,omitempty"`
+		}{
+			Success:  true,
+			Message:  "Delivery restored successfully",
+			Delivery: delivery,
+		},
+	}, nil
+}
+
 // Start Delivery
 type StartDeliveryInput struct {
 	ID int `path:"id" minimum:"1"`
@@ -394,25 +499,8 @@ type StartDeliveryOutput struct {
 }
 
 func (h *DeliveryHandler) StartDelivery(ctx context.Context, input *StartDeliveryInput) (*StartDeliveryOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
-	}
-
 	// Get delivery to check if it's manual start
-	delivery, err := h.deliveryRepo.GetByID(input.ID)
+	delivery, err := h.deliveryRepo.GetByID(clientScope(ctx), input.ID)
 	if err != nil {
 		return nil, huma.Error404NotFound("Delivery not found")
 	}
@@ -423,7 +511,7 @@ func (h *DeliveryHandler) StartDelivery(ctx context.Context, input *StartDeliver
 	}
 
 	// Update delivery to mark it as started
-	err = h.deliveryRepo.StartDelivery(input.ID)
+	err = h.deliveryRepo.StartDelivery(clientScope(ctx), input.ID)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to start delivery", err)
 	}
@@ -452,25 +540,11 @@ type FinishDeliveryOutput struct {
 }
 
 func (h *DeliveryHandler) FinishDelivery(ctx context.Context, input *FinishDeliveryInput) (*FinishDeliveryOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
-	}
-
-	err := h.deliveryRepo.FinishDelivery(input.ID)
+	err := h.deliveryRepo.FinishDelivery(clientScope(ctx), input.ID)
 	if err != nil {
+		if err.Error() == "delivery not found" {
+			return nil, huma.Error404NotFound("Delivery not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to finish delivery", err)
 	}
 
@@ -497,18 +571,16 @@ type GetDeliveryAttemptsOutput struct {
 }
 
 func (h *DeliveryHandler) GetDeliveryAttempts(ctx context.Context, input *GetDeliveryAttemptsInput) (*GetDeliveryAttemptsOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	pagination := tables.Pagination{
 		Page:    input.Page,
 		PerPage: input.PerPage,
 	}
 
-	result, err := h.deliveryRepo.GetDeliveryAttempts(input.ID, pagination)
+	result, err := h.deliveryRepo.GetDeliveryAttempts(clientScope(ctx), input.ID, pagination)
 	if err != nil {
+		if err.Error() == "delivery not found" {
+			return nil, huma.Error404NotFound("Delivery not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to get delivery attempts", err)
 	}
 
@@ -553,19 +625,14 @@ type GetParticipantProgressOutput struct {
 }
 
 func (h *DeliveryHandler) GetParticipantProgress(ctx context.Context, input *GetParticipantProgressInput) (*GetParticipantProgressOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	// Get delivery details
-	delivery, err := h.deliveryRepo.GetByID(input.ID)
+	delivery, err := h.deliveryRepo.GetByID(clientScope(ctx), input.ID)
 	if err != nil {
 		return nil, huma.Error404NotFound("Delivery not found")
 	}
 
 	// Get participant progress data
-	progressData, err := h.deliveryRepo.GetParticipantProgress(input.ID)
+	progressData, err := h.deliveryRepo.GetParticipantProgress(clientScope(ctx), input.ID)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to get participant progress", err)
 	}
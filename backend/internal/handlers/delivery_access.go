@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// ValidateDeliveryCommitteeAccess checks that the user can control every delivery or is an
+// active committee member of the delivery
+func ValidateDeliveryCommitteeAccess(ctx context.Context, assignmentRepo *models.DeliveryAssignmentModel, deliveryID int) (*tables.SessionData, error) {
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+	if sessionData == nil {
+		return nil, huma.Error401Unauthorized("Authentication required")
+	}
+
+	if sessionData.HasPermission(tables.PermissionDeliveryControl) {
+		return sessionData, nil
+	}
+
+	hasPermission, err := assignmentRepo.CheckUserDeliveryPermission(sessionData.UserID, deliveryID, "committee")
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to check permissions", err)
+	}
+	if !hasPermission {
+		return nil, huma.Error403Forbidden("Committee access required for this delivery")
+	}
+
+	return sessionData, nil
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// DeliveryAdmissionHandler manages the access code participants enter with their taker code,
+// and prints the admission slips with the taker codes of a delivery
+type DeliveryAdmissionHandler struct {
+	accessCodeRepo *models.DeliveryAccessCodeModel
+	deliveryRepo   *models.DeliveryModel
+	groupRepo      *models.GroupModel
+	assignmentRepo *models.DeliveryAssignmentModel
+	auditService   *services.AuditService
+}
+
+func NewDeliveryAdmissionHandler(accessCodeRepo *models.DeliveryAccessCodeModel, deliveryRepo *models.DeliveryModel, groupRepo *models.GroupModel, assignmentRepo *models.DeliveryAssignmentModel, auditService *services.AuditService) *DeliveryAdmissionHandler {
+	return &DeliveryAdmissionHandler{
+		accessCodeRepo: accessCodeRepo,
+		deliveryRepo:   deliveryRepo,
+		groupRepo:      groupRepo,
+		assignmentRepo: assignmentRepo,
+		auditService:   auditService,
+	}
+}
+
+func (h *DeliveryAdmissionHandler) Register(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-delivery-access-code",
+		Method:      http.MethodGet,
+		Path:        "/api/deliveries/{id}/access-code",
+		Summary:     "Get delivery access code",
+		Description: "Get the access code to announce in the room. Returns null when the delivery does not require one.",
+		Tags:        []string{"Delivery Admission"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.GetAccessCode)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "generate-delivery-access-code",
+		Method:      http.MethodPost,
+		Path:        "/api/deliveries/{id}/access-code",
+		Summary:     "Generate delivery access code",
+		Description: "Require participants to enter a new random access code with their taker code, replacing any previous access code. Committee members of the delivery can perform this action.",
+		Tags:        []string{"Delivery Admission"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.GenerateAccessCode)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-delivery-access-code",
+		Method:      http.MethodDelete,
+		Path:        "/api/deliveries/{id}/access-code",
+		Summary:     "Stop requiring access code",
+		Description: "Let participants log in to the delivery with their taker code alone.",
+		Tags:        []string{"Delivery Admission"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.DeleteAccessCode)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "print-admission-slips",
+		Method:      http.MethodGet,
+		Path:        "/api/deliveries/{id}/admission-slips",
+		Summary:     "Print admission slips",
+		Description: "Get a printable HTML page with an admission slip, holding the taker code, for every taker of the delivery's group.",
+		Tags:        []string{"Delivery Admission"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionGroupManage),
+	}, h.PrintAdmissionSlips)
+}
+
+// Get Access Code
+type DeliveryAccessCodeInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type DeliveryAccessCodeOutput struct {
+	Body *tables.DeliveryAccessCode `json:"body"`
+}
+
+func (h *DeliveryAdmissionHandler) GetAccessCode(ctx context.Context, input *DeliveryAccessCodeInput) (*DeliveryAccessCodeOutput, error) {
+	if _, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID); err != nil {
+		return nil, err
+	}
+
+	accessCode, err := h.accessCodeRepo.Get(input.ID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get access code", err)
+	}
+	return &DeliveryAccessCodeOutput{Body: accessCode}, nil
+}
+
+// Generate Access Code
+func (h *DeliveryAdmissionHandler) GenerateAccessCode(ctx context.Context, input *DeliveryAccessCodeInput) (*DeliveryAccessCodeOutput, error) {
+	sessionData, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := h.deliveryRepo.GetByID(clientScope(ctx), input.ID); err != nil {
+		return nil, huma.Error404NotFound("Delivery not found")
+	}
+
+	accessCode, err := h.accessCodeRepo.Generate(input.ID, sessionData.UserID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to generate access code", err)
+	}
+	// The code itself is a secret and is not recorded
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityDelivery, input.ID, auditNoLink, auditAction("access_code", "generated"))
+	return &DeliveryAccessCodeOutput{Body: accessCode}, nil
+}
+
+// Delete Access Code
+type DeleteDeliveryAccessCodeOutput struct {
+	Body struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	} `json:"body"`
+}
+
+func (h *DeliveryAdmissionHandler) DeleteAccessCode(ctx context.Context, input *DeliveryAccessCodeInput) (*DeleteDeliveryAccessCodeOutput, error) {
+	if _, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID); err != nil {
+		return nil, err
+	}
+
+	if err := h.accessCodeRepo.Delete(input.ID); err != nil {
+		return nil, huma.Error500InternalServerError("Failed to delete access code", err)
+	}
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityDelivery, input.ID, auditNoLink, auditAction("access_code", "removed"))
+
+	return &DeleteDeliveryAccessCodeOutput{
+		Body: struct {
+			Success bool   `json:"success"`
+			Message string `json:"message"`
+		}{
+			Success: true,
+			Message: "Access code no longer required",
+		},
+	}, nil
+}
+
+// Print Admission Slips
+type PrintAdmissionSlipsOutput struct {
+	ContentType string `header:"Content-Type"`
+	Body        []byte
+}
+
+func (h *DeliveryAdmissionHandler) PrintAdmissionSlips(ctx context.Context, input *DeliveryAccessCodeInput) (*PrintAdmissionSlipsOutput, error) {
+	delivery, err := h.deliveryRepo.GetWithDetails(clientScope(ctx), input.ID)
+	if err != nil {
+		return nil, huma.Error404NotFound("Delivery not found")
+	}
+
+	group, err := h.groupRepo.GetByID(clientScope(ctx), delivery.GroupID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get group", err)
+	}
+
+	takers, err := h.groupRepo.GetTakerCodeSlips(clientScope(ctx), delivery.GroupID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get taker codes", err)
+	}
+
+	accessCode, err := h.accessCodeRepo.Get(input.ID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get access code", err)
+	}
+
+	var buf bytes.Buffer
+	if err := services.WriteAdmissionSlips(&buf, delivery, group, takers, accessCode != nil); err != nil {
+		return nil, huma.Error500InternalServerError("Failed to print admission slips", err)
+	}
+
+	return &PrintAdmissionSlipsOutput{
+		ContentType: "text/html; charset=utf-8",
+		Body:        buf.Bytes(),
+	}, nil
+}
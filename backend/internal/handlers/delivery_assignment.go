@@ -7,18 +7,21 @@ import (
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/medxamion/medxamion/internal/middleware"
 	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
 	"github.com/medxamion/medxamion/internal/tables"
 )
 
 type DeliveryAssignmentHandler struct {
 	assignmentRepo *models.DeliveryAssignmentModel
 	deliveryRepo   *models.DeliveryModel
+	auditService   *services.AuditService
 }
 
-func NewDeliveryAssignmentHandler(assignmentRepo *models.DeliveryAssignmentModel, deliveryRepo *models.DeliveryModel) *DeliveryAssignmentHandler {
+func NewDeliveryAssignmentHandler(assignmentRepo *models.DeliveryAssignmentModel, deliveryRepo *models.DeliveryModel, auditService *services.AuditService) *DeliveryAssignmentHandler {
 	return &DeliveryAssignmentHandler{
 		assignmentRepo: assignmentRepo,
 		deliveryRepo:   deliveryRepo,
+		auditService:   auditService,
 	}
 }
 
@@ -32,6 +35,7 @@ func (h *DeliveryAssignmentHandler) Register(api huma.API) {
 		Description: "Assign committee members to a delivery. Only admins can perform this action.",
 		Tags:        []string{"Delivery Assignments"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionDeliveryAssign),
 	}, h.AssignCommittee)
 
 	huma.Register(api, huma.Operation{
@@ -42,6 +46,7 @@ func (h *DeliveryAssignmentHandler) Register(api huma.API) {
 		Description: "Assign scorers to a delivery. Only admins can perform this action.",
 		Tags:        []string{"Delivery Assignments"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionDeliveryAssign),
 	}, h.AssignScorers)
 
 	// Get delivery assignments
@@ -53,6 +58,7 @@ func (h *DeliveryAssignmentHandler) Register(api huma.API) {
 		Description: "Get committee and scorer assignments for a delivery.",
 		Tags:        []string{"Delivery Assignments"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetDeliveryAssignments)
 
 	// Committee/Scorer endpoints
@@ -64,6 +70,7 @@ func (h *DeliveryAssignmentHandler) Register(api huma.API) {
 		Description: "Get deliveries assigned to the current user as committee or scorer.",
 		Tags:        []string{"Committee/Scorer"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionDeliveryAssigned),
 	}, h.GetUserDeliveries)
 
 	huma.Register(api, huma.Operation{
@@ -74,6 +81,7 @@ func (h *DeliveryAssignmentHandler) Register(api huma.API) {
 		Description: "Committee members can control delivery state.",
 		Tags:        []string{"Committee/Scorer"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
 	}, h.ControlDelivery)
 
 	// Get users with specific roles for assignment
@@ -85,6 +93,7 @@ func (h *DeliveryAssignmentHandler) Register(api huma.API) {
 		Description: "Get all users with scorer role for assignment purposes.",
 		Tags:        []string{"Delivery Assignments"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionDeliveryAssign),
 	}, h.GetScorerUsers)
 }
 
@@ -104,27 +113,21 @@ type AssignCommitteeOutput struct {
 }
 
 func (h *DeliveryAssignmentHandler) AssignCommittee(ctx context.Context, input *AssignCommitteeInput) (*AssignCommitteeOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
+	before, err := h.assignmentRepo.GetDeliveryCommittee(input.ID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get delivery committee", err)
 	}
 
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "Administrator" || role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+	err = h.assignmentRepo.AssignCommitteeToDelivery(input.ID, input.Body.UserIDs)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to assign committee", err)
 	}
 
-	err := h.assignmentRepo.AssignCommitteeToDelivery(input.ID, input.Body.UserIDs)
+	committee, err := h.assignmentRepo.GetDeliveryCommittee(input.ID)
 	if err != nil {
-		return nil, huma.Error500InternalServerError("Failed to assign committee", err)
+		return nil, huma.Error500InternalServerError("Failed to get delivery committee", err)
 	}
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityDelivery, input.ID, assignedUserIDs("committee_ids", before), assignedUserIDs("committee_ids", committee))
 
 	return &AssignCommitteeOutput{
 		Body: struct {
@@ -153,27 +156,21 @@ type AssignScorersOutput struct {
 }
 
 func (h *DeliveryAssignmentHandler) AssignScorers(ctx context.Context, input *AssignScorersInput) (*AssignScorersOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
+	before, err := h.assignmentRepo.GetDeliveryScorers(input.ID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get delivery scorers", err)
 	}
 
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "Administrator" || role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+	err = h.assignmentRepo.AssignScorerToDelivery(input.ID, input.Body.UserIDs)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to assign scorers", err)
 	}
 
-	err := h.assignmentRepo.AssignScorerToDelivery(input.ID, input.Body.UserIDs)
+	scorers, err := h.assignmentRepo.GetDeliveryScorers(input.ID)
 	if err != nil {
-		return nil, huma.Error500InternalServerError("Failed to assign scorers", err)
+		return nil, huma.Error500InternalServerError("Failed to get delivery scorers", err)
 	}
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityDelivery, input.ID, assignedUserIDs("scorer_ids", before), assignedUserIDs("scorer_ids", scorers))
 
 	return &AssignScorersOutput{
 		Body: struct {
@@ -186,6 +183,15 @@ func (h *DeliveryAssignmentHandler) AssignScorers(ctx context.Context, input *As
 	}, nil
 }
 
+// assignedUserIDs is the committee or scorers of a delivery as recorded in the audit log
+func assignedUserIDs(field string, users []tables.UserWithRole) map[string][]int {
+	ids := make([]int, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.User.ID)
+	}
+	return map[string][]int{field: ids}
+}
+
 // Get Delivery Assignments
 type GetDeliveryAssignmentsInput struct {
 	ID int `path:"id" minimum:"1"`
@@ -199,11 +205,6 @@ type GetDeliveryAssignmentsOutput struct {
 }
 
 func (h *DeliveryAssignmentHandler) GetDeliveryAssignments(ctx context.Context, input *GetDeliveryAssignmentsInput) (*GetDeliveryAssignmentsOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	committee, err := h.assignmentRepo.GetDeliveryCommittee(input.ID)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to get committee", err)
@@ -236,21 +237,6 @@ type GetUserDeliveriesOutput struct {
 
 func (h *DeliveryAssignmentHandler) GetUserDeliveries(ctx context.Context, input *GetUserDeliveriesInput) (*GetUserDeliveriesOutput, error) {
 	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check if user has scorer/committee role
-	hasScorerRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "Scorer / Committee" || role.Name == "scorer" {
-			hasScorerRole = true
-			break
-		}
-	}
-	if !hasScorerRole {
-		return nil, huma.Error403Forbidden("Scorer/Committee role required")
-	}
 
 	deliveries, err := h.assignmentRepo.GetUserDeliveries(sessionData.UserID, input.Role)
 	if err != nil {
@@ -276,19 +262,9 @@ type ControlDeliveryOutput struct {
 }
 
 func (h *DeliveryAssignmentHandler) ControlDelivery(ctx context.Context, input *ControlDeliveryInput) (*ControlDeliveryOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check if user has committee permission for this delivery
-	hasPermission, err := h.assignmentRepo.CheckUserDeliveryPermission(sessionData.UserID, input.ID, "committee")
+	_, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID)
 	if err != nil {
-		return nil, huma.Error500InternalServerError("Failed to check permissions", err)
-	}
-
-	if !hasPermission {
-		return nil, huma.Error403Forbidden("Committee access required for this delivery")
+		return nil, err
 	}
 
 	// Implement delivery control logic based on action
@@ -298,7 +274,7 @@ func (h *DeliveryAssignmentHandler) ControlDelivery(ctx context.Context, input *
 	switch input.Body.Action {
 	case "start":
 		// Start the delivery
-		err = h.deliveryRepo.StartDelivery(input.ID)
+		err = h.deliveryRepo.StartDelivery(clientScope(ctx), input.ID)
 		if err != nil {
 			return nil, huma.Error500InternalServerError("Failed to start delivery", err)
 		}
@@ -306,7 +282,7 @@ func (h *DeliveryAssignmentHandler) ControlDelivery(ctx context.Context, input *
 
 	case "stop":
 		// Stop the delivery (mark as finished)
-		err = h.deliveryRepo.StopDelivery(input.ID)
+		err = h.deliveryRepo.StopDelivery(clientScope(ctx), input.ID)
 		if err != nil {
 			return nil, huma.Error500InternalServerError("Failed to stop delivery", err)
 		}
@@ -314,7 +290,7 @@ func (h *DeliveryAssignmentHandler) ControlDelivery(ctx context.Context, input *
 
 	case "pause":
 		// Pause the delivery
-		err = h.deliveryRepo.PauseDelivery(input.ID)
+		err = h.deliveryRepo.PauseDelivery(clientScope(ctx), input.ID)
 		if err != nil {
 			return nil, huma.Error500InternalServerError("Failed to pause delivery", err)
 		}
@@ -322,7 +298,7 @@ func (h *DeliveryAssignmentHandler) ControlDelivery(ctx context.Context, input *
 
 	case "resume":
 		// Resume the delivery
-		err = h.deliveryRepo.ResumeDelivery(input.ID)
+		err = h.deliveryRepo.ResumeDelivery(clientScope(ctx), input.ID)
 		if err != nil {
 			return nil, huma.Error500InternalServerError("Failed to resume delivery", err)
 		}
@@ -349,23 +325,6 @@ type GetScorerUsersOutput struct {
 }
 
 func (h *DeliveryAssignmentHandler) GetScorerUsers(ctx context.Context, input *struct{}) (*GetScorerUsersOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "Administrator" || role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
-	}
-
 	users, err := h.assignmentRepo.GetUsersWithRole("scorer")
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to get scorer users", err)
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+type DeliveryNetworkHandler struct {
+	networkRepo    *models.DeliveryNetworkModel
+	assignmentRepo *models.DeliveryAssignmentModel
+	auditService   *services.AuditService
+}
+
+func NewDeliveryNetworkHandler(networkRepo *models.DeliveryNetworkModel, assignmentRepo *models.DeliveryAssignmentModel, auditService *services.AuditService) *DeliveryNetworkHandler {
+	return &DeliveryNetworkHandler{
+		networkRepo:    networkRepo,
+		assignmentRepo: assignmentRepo,
+		auditService:   auditService,
+	}
+}
+
+func (h *DeliveryNetworkHandler) Register(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-delivery-network-rules",
+		Method:      http.MethodGet,
+		Path:        "/api/deliveries/{id}/network-rules",
+		Summary:     "Get delivery network allow-list",
+		Description: "Get the IP/CIDR ranges and exam-client hosts allowed to take a delivery.",
+		Tags:        []string{"Delivery Network"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.GetRules)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "set-delivery-network-rules",
+		Method:      http.MethodPut,
+		Path:        "/api/deliveries/{id}/network-rules",
+		Summary:     "Set delivery network allow-list",
+		Description: "Replace the allow-list of a delivery. An empty list removes all restrictions. Only admins can perform this action.",
+		Tags:        []string{"Delivery Network"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionDeliveryNetwork),
+	}, h.SetRules)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-delivery-network-overrides",
+		Method:      http.MethodGet,
+		Path:        "/api/deliveries/{id}/network-overrides",
+		Summary:     "List participant network overrides",
+		Description: "List participants allowed to bypass the delivery allow-list.",
+		Tags:        []string{"Delivery Network"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.ListOverrides)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "grant-delivery-network-override",
+		Method:      http.MethodPost,
+		Path:        "/api/deliveries/{id}/network-overrides",
+		Summary:     "Grant participant network override",
+		Description: "Allow a participant to start and answer from outside the allow-list. Committee members of the delivery can perform this action.",
+		Tags:        []string{"Delivery Network"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.GrantOverride)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "revoke-delivery-network-override",
+		Method:      http.MethodDelete,
+		Path:        "/api/deliveries/{id}/network-overrides/{takerId}",
+		Summary:     "Revoke participant network override",
+		Description: "Remove a participant's allow-list override.",
+		Tags:        []string{"Delivery Network"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.RevokeOverride)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-delivery-access-violations",
+		Method:      http.MethodGet,
+		Path:        "/api/deliveries/{id}/access-violations",
+		Summary:     "List rejected access attempts",
+		Description: "List attempt starts and answer submissions rejected by the allow-list.",
+		Tags:        []string{"Delivery Network"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.ListViolations)
+}
+
+// Get Network Rules
+type GetNetworkRulesInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type GetNetworkRulesOutput struct {
+	Body []tables.DeliveryNetworkRule `json:"body"`
+}
+
+func (h *DeliveryNetworkHandler) GetRules(ctx context.Context, input *GetNetworkRulesInput) (*GetNetworkRulesOutput, error) {
+	if _, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID); err != nil {
+		return nil, err
+	}
+
+	rules, err := h.networkRepo.GetRules(input.ID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get network rules", err)
+	}
+
+	return &GetNetworkRulesOutput{Body: rules}, nil
+}
+
+// Set Network Rules
+type SetNetworkRulesInput struct {
+	ID   int `path:"id" minimum:"1"`
+	Body struct {
+		Rules []tables.DeliveryNetworkRuleRequest `json:"rules" required:"true"`
+	} `json:"body"`
+}
+
+type SetNetworkRulesOutput struct {
+	Body struct {
+		Success bool                         `json:"success"`
+		Message string                       `json:"message"`
+		Rules   []tables.DeliveryNetworkRule `json:"rules"`
+	} `json:"body"`
+}
+
+func (h *DeliveryNetworkHandler) SetRules(ctx context.Context, input *SetNetworkRulesInput) (*SetNetworkRulesOutput, error) {
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+
+	before, err := h.networkRepo.GetRules(input.ID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get network rules", err)
+	}
+
+	rules, err := h.networkRepo.ReplaceRules(input.ID, input.Body.Rules, sessionData.UserID)
+	if err != nil {
+		return nil, huma.Error400BadRequest("Failed to set network rules", err)
+	}
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityDelivery, input.ID, networkRuleValues(before), networkRuleValues(rules))
+
+	return &SetNetworkRulesOutput{
+		Body: struct {
+			Success bool                         `json:"success"`
+			Message string                       `json:"message"`
+			Rules   []tables.DeliveryNetworkRule `json:"rules"`
+		}{
+			Success: true,
+			Message: "Network rules updated successfully",
+			Rules:   rules,
+		},
+	}, nil
+}
+
+// networkRuleValues is the allow-list of a delivery as recorded in the audit log
+func networkRuleValues(rules []tables.DeliveryNetworkRule) map[string][]string {
+	values := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		values = append(values, fmt.Sprintf("%s %s", rule.Kind, rule.Value))
+	}
+	return map[string][]string{"network_rules": values}
+}
+
+// List Network Overrides
+type ListNetworkOverridesInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type ListNetworkOverridesOutput struct {
+	Body []tables.DeliveryNetworkOverride `json:"body"`
+}
+
+func (h *DeliveryNetworkHandler) ListOverrides(ctx context.Context, input *ListNetworkOverridesInput) (*ListNetworkOverridesOutput, error) {
+	if _, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID); err != nil {
+		return nil, err
+	}
+
+	overrides, err := h.networkRepo.GetOverrides(input.ID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get network overrides", err)
+	}
+
+	return &ListNetworkOverridesOutput{Body: overrides}, nil
+}
+
+// Grant Network Override
+type GrantNetworkOverrideInput struct {
+	ID   int                                   `path:"id" minimum:"1"`
+	Body tables.DeliveryNetworkOverrideRequest `json:"body"`
+}
+
+type GrantNetworkOverrideOutput struct {
+	Body struct {
+		Success  bool                            `json:"success"`
+		Message  string                          `json:"message"`
+		Override *tables.DeliveryNetworkOverride `json:"override,omitempty"`
+	} `json:"body"`
+}
+
+func (h *DeliveryNetworkHandler) GrantOverride(ctx context.Context, input *GrantNetworkOverrideInput) (*GrantNetworkOverrideOutput, error) {
+	sessionData, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	override, err := h.networkRepo.SetOverride(input.ID, &input.Body, sessionData.UserID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to grant network override", err)
+	}
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityDelivery, input.ID, auditNoLink, auditLink("network_overrides", input.Body.TakerID, map[string]any{"reason": override.Reason, "expires_at": override.ExpiresAt}))
+
+	return &GrantNetworkOverrideOutput{
+		Body: struct {
+			Success  bool                            `json:"success"`
+			Message  string                          `json:"message"`
+			Override *tables.DeliveryNetworkOverride `json:"override,omitempty"`
+		}{
+			Success:  true,
+			Message:  "Network override granted successfully",
+			Override: override,
+		},
+	}, nil
+}
+
+// Revoke Network Override
+type RevokeNetworkOverrideInput struct {
+	ID      int `path:"id" minimum:"1"`
+	TakerID int `path:"takerId" minimum:"1"`
+}
+
+type RevokeNetworkOverrideOutput struct {
+	Body struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	} `json:"body"`
+}
+
+func (h *DeliveryNetworkHandler) RevokeOverride(ctx context.Context, input *RevokeNetworkOverrideInput) (*RevokeNetworkOverrideOutput, error) {
+	if _, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID); err != nil {
+		return nil, err
+	}
+
+	err := h.networkRepo.RemoveOverride(input.ID, input.TakerID)
+	if err != nil {
+		if err.Error() == "network override not found" {
+			return nil, huma.Error404NotFound("Network override not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to revoke network override", err)
+	}
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityDelivery, input.ID, auditLink("network_overrides", input.TakerID, true), auditNoLink)
+
+	return &RevokeNetworkOverrideOutput{
+		Body: struct {
+			Success bool   `json:"success"`
+			Message string `json:"message"`
+		}{
+			Success: true,
+			Message: "Network override revoked successfully",
+		},
+	}, nil
+}
+
+// List Access Violations
+type ListAccessViolationsInput struct {
+	ID      int `path:"id" minimum:"1"`
+	Page    int `query:"page" default:"1" minimum:"1"`
+	PerPage int `query:"per_page" default:"15" minimum:"1" maximum:"100"`
+}
+
+type ListAccessViolationsOutput struct {
+	Body tables.PaginatedResponse `json:"body"`
+}
+
+func (h *DeliveryNetworkHandler) ListViolations(ctx context.Context, input *ListAccessViolationsInput) (*ListAccessViolationsOutput, error) {
+	if _, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID); err != nil {
+		return nil, err
+	}
+
+	pagination := tables.Pagination{
+		Page:    input.Page,
+		PerPage: input.PerPage,
+	}
+
+	result, err := h.networkRepo.ListViolations(input.ID, pagination)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get access violations", err)
+	}
+
+	return &ListAccessViolationsOutput{Body: *result}, nil
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
+)
+
+// DeliveryStagingHandler tracks the exam content staged on exam-clients ahead of a delivery
+// and releases the delivery key to the exam-client that staged it
+type DeliveryStagingHandler struct {
+	stagingRepo    *models.DeliveryStagingModel
+	deliveryKeys   *models.DeliveryKeyModel
+	credentialRepo *models.ExamClientCredentialModel
+	assignmentRepo *models.DeliveryAssignmentModel
+}
+
+func NewDeliveryStagingHandler(stagingRepo *models.DeliveryStagingModel, deliveryKeys *models.DeliveryKeyModel, credentialRepo *models.ExamClientCredentialModel, assignmentRepo *models.DeliveryAssignmentModel) *DeliveryStagingHandler {
+	return &DeliveryStagingHandler{
+		stagingRepo:    stagingRepo,
+		deliveryKeys:   deliveryKeys,
+		credentialRepo: credentialRepo,
+		assignmentRepo: assignmentRepo,
+	}
+}
+
+func (h *DeliveryStagingHandler) Register(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-delivery-staging",
+		Method:      http.MethodGet,
+		Path:        "/api/deliveries/{id}/staging",
+		Summary:     "Get exam content staging",
+		Description: "Get the staging of the encrypted exam content on the exam-client that will run the delivery, and whether the delivery key was released.",
+		Tags:        []string{"Deliveries"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.GetStaging)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "report-delivery-staging",
+		Method:      http.MethodPost,
+		Path:        "/api/internal/exam-clients/{client_id}/deliveries/{id}/staging",
+		Summary:     "Report exam content staging",
+		Description: "Report that an exam-client stored and verified the staged exam content of a delivery, or failed to.",
+		Tags:        []string{"Internal", "Exam Clients"},
+		Metadata:    middleware.RequireExamClient(),
+	}, h.ReportStaging)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-delivery-key",
+		Method:      http.MethodGet,
+		Path:        "/api/internal/exam-clients/{client_id}/deliveries/{id}/key",
+		Summary:     "Get delivery key",
+		Description: "Get the delivery key, wrapped with the client secret, once it was released at the scheduled start. Only the exam-client that staged the delivery can get it.",
+		Tags:        []string{"Internal", "Exam Clients"},
+		Metadata:    middleware.RequireExamClient(),
+	}, h.GetKey)
+}
+
+// Get Staging
+type GetDeliveryStagingInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type GetDeliveryStagingOutput struct {
+	Body *tables.DeliveryStaging `json:"body"`
+}
+
+func (h *DeliveryStagingHandler) GetStaging(ctx context.Context, input *GetDeliveryStagingInput) (*GetDeliveryStagingOutput, error) {
+	if _, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID); err != nil {
+		return nil, err
+	}
+
+	staging, err := h.stagingRepo.Get(input.ID)
+	if err != nil {
+		if err.Error() == "delivery staging not found" {
+			return nil, huma.Error404NotFound("Delivery is not staged")
+		}
+		return nil, huma.Error500InternalServerError("Failed to get delivery staging", err)
+	}
+
+	return &GetDeliveryStagingOutput{Body: staging}, nil
+}
+
+// Report Staging
+type ReportDeliveryStagingInput struct {
+	ClientID string                      `path:"client_id"`
+	ID       int                         `path:"id" minimum:"1"`
+	Body     tables.StagingReportRequest `json:"body"`
+}
+
+type ReportDeliveryStagingOutput struct {
+	Body struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	} `json:"body"`
+}
+
+func (h *DeliveryStagingHandler) ReportStaging(ctx context.Context, input *ReportDeliveryStagingInput) (*ReportDeliveryStagingOutput, error) {
+	var err error
+	if input.Body.Status == tables.StagingStatusStaged {
+		err = h.stagingRepo.MarkStaged(input.ID, input.ClientID, input.Body.ContentDigest)
+	} else {
+		err = h.stagingRepo.MarkFailed(input.ID, input.ClientID, input.Body.Error)
+	}
+	if err != nil {
+		switch err.Error() {
+		case "delivery staging not found":
+			return nil, huma.Error404NotFound("Delivery staging not found")
+		case "delivery is staged by another exam client":
+			return nil, huma.Error403Forbidden("Delivery is staged by another exam client")
+		case "staged content digest mismatch":
+			return nil, huma.Error409Conflict("Staged content digest mismatch")
+		}
+		return nil, huma.Error500InternalServerError("Failed to record delivery staging", err)
+	}
+
+	log.Printf("Exam client %s reported staging of delivery %d: %s", input.ClientID, input.ID, input.Body.Status)
+
+	return &ReportDeliveryStagingOutput{
+		Body: struct {
+			Success bool   `json:"success"`
+			Message string `json:"message"`
+		}{
+			Success: true,
+			Message: "Staging recorded",
+		},
+	}, nil
+}
+
+// Get Key
+type GetDeliveryKeyInput struct {
+	ClientID string `path:"client_id"`
+	ID       int    `path:"id" minimum:"1"`
+}
+
+type GetDeliveryKeyOutput struct {
+	Body *tables.ReleasedDeliveryKey `json:"body"`
+}
+
+func (h *DeliveryStagingHandler) GetKey(ctx context.Context, input *GetDeliveryKeyInput) (*GetDeliveryKeyOutput, error) {
+	staging, err := h.stagingRepo.Get(input.ID)
+	if err != nil {
+		if err.Error() == "delivery staging not found" {
+			return nil, huma.Error404NotFound("Delivery staging not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to get delivery staging", err)
+	}
+
+	if staging.ClientID == nil || *staging.ClientID != middleware.GetExamClientIDFromContext(ctx) {
+		return nil, huma.Error403Forbidden("Delivery is staged by another exam client")
+	}
+	if staging.Status != tables.StagingStatusStaged {
+		return nil, huma.Error409Conflict("Delivery content is not staged")
+	}
+	if staging.ReleasedAt == nil {
+		return nil, huma.Error409Conflict("Delivery key is not released yet")
+	}
+
+	credential, err := h.credentialRepo.GetActive(input.ClientID)
+	if err != nil {
+		return nil, huma.Error403Forbidden("Exam client is not enrolled")
+	}
+
+	key, err := h.deliveryKeys.Get(input.ID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get delivery key", err)
+	}
+	defer utils.WipeKey(key)
+
+	// Wrapped so only the staging client can use it
+	wrapped, err := utils.WrapDeliveryKey(credential.Secret, input.ID, key)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to wrap delivery key", err)
+	}
+
+	if err := h.deliveryKeys.MarkReleased(input.ID, input.ClientID); err != nil {
+		return nil, huma.Error500InternalServerError("Failed to record delivery key release", err)
+	}
+	log.Printf("Released key of delivery %d to exam client %s", input.ID, input.ClientID)
+
+	return &GetDeliveryKeyOutput{
+		Body: &tables.ReleasedDeliveryKey{
+			DeliveryID:  input.ID,
+			DeliveryKey: wrapped,
+		},
+	}, nil
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
 	"github.com/medxamion/medxamion/internal/tables"
 
 	"github.com/danielgtaylor/huma/v2"
@@ -12,11 +13,12 @@ import (
 )
 
 type ExamHandler struct {
-	examRepo *models.ExamModel
+	examRepo     *models.ExamModel
+	auditService *services.AuditService
 }
 
-func NewExamHandler(examRepo *models.ExamModel) *ExamHandler {
-	return &ExamHandler{examRepo: examRepo}
+func NewExamHandler(examRepo *models.ExamModel, auditService *services.AuditService) *ExamHandler {
+	return &ExamHandler{examRepo: examRepo, auditService: auditService}
 }
 
 func (h *ExamHandler) Register(api huma.API) {
@@ -28,6 +30,7 @@ func (h *ExamHandler) Register(api huma.API) {
 		Description: "Get a paginated list of exams with search functionality.",
 		Tags:        []string{"Exams"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.ListExams)
 
 	huma.Register(api, huma.Operation{
@@ -38,6 +41,7 @@ func (h *ExamHandler) Register(api huma.API) {
 		Description: "Get detailed information about a specific exam.",
 		Tags:        []string{"Exams"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetExam)
 
 	huma.Register(api, huma.Operation{
@@ -48,6 +52,7 @@ func (h *ExamHandler) Register(api huma.API) {
 		Description: "Create a new examination definition.",
 		Tags:        []string{"Exams"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionExamCreate),
 	}, h.CreateExam)
 
 	huma.Register(api, huma.Operation{
@@ -58,6 +63,7 @@ func (h *ExamHandler) Register(api huma.API) {
 		Description: "Update examination information.",
 		Tags:        []string{"Exams"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionExamUpdate),
 	}, h.UpdateExam)
 
 	huma.Register(api, huma.Operation{
@@ -65,11 +71,34 @@ func (h *ExamHandler) Register(api huma.API) {
 		Method:      http.MethodDelete,
 		Path:        "/api/exams/{id}",
 		Summary:     "Delete exam",
-		Description: "Delete an examination definition.",
+		Description: "Delete an examination definition. Exams with deliveries cannot be deleted until their deliveries are; deleted exams can be restored.",
 		Tags:        []string{"Exams"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionExamDelete),
 	}, h.DeleteExam)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "list-deleted-exams",
+		Method:      http.MethodGet,
+		Path:        "/api/exams/deleted",
+		Summary:     "List deleted exams",
+		Description: "Get a paginated list of deleted exams, most recently deleted first.",
+		Tags:        []string{"Exams"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionExamDelete),
+	}, h.ListDeletedExams)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "restore-exam",
+		Method:      http.MethodPost,
+		Path:        "/api/exams/{id}/restore",
+		Summary:     "Restore exam",
+		Description: "Restore a deleted exam.",
+		Tags:        []string{"Exams"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionExamDelete),
+	}, h.RestoreExam)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "get-exam-items",
 		Method:      http.MethodGet,
@@ -78,6 +107,7 @@ func (h *ExamHandler) Register(api huma.API) {
 		Description: "Get paginated list of question sets in an exam.",
 		Tags:        []string{"Exams"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetExamItems)
 
 	huma.Register(api, huma.Operation{
@@ -88,6 +118,7 @@ func (h *ExamHandler) Register(api huma.API) {
 		Description: "Add a question set to an exam with specific order.",
 		Tags:        []string{"Exams"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionExamUpdate),
 	}, h.AddItemToExam)
 
 	huma.Register(api, huma.Operation{
@@ -98,6 +129,7 @@ func (h *ExamHandler) Register(api huma.API) {
 		Description: "Remove a question set from an exam.",
 		Tags:        []string{"Exams"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionExamUpdate),
 	}, h.RemoveItemFromExam)
 
 	huma.Register(api, huma.Operation{
@@ -108,6 +140,7 @@ func (h *ExamHandler) Register(api huma.API) {
 		Description: "Update the order of a question set in an exam.",
 		Tags:        []string{"Exams"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionExamUpdate),
 	}, h.UpdateItemOrder)
 }
 
@@ -124,11 +157,6 @@ type ListExamsOutput struct {
 }
 
 func (h *ExamHandler) ListExams(ctx context.Context, input *ListExamsInput) (*ListExamsOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	pagination := tables.Pagination{
 		Page:    input.Page,
 		PerPage: input.PerPage,
@@ -139,7 +167,7 @@ func (h *ExamHandler) ListExams(ctx context.Context, input *ListExamsInput) (*Li
 		Name: input.Name,
 	}
 
-	result, err := h.examRepo.List(pagination, search)
+	result, err := h.examRepo.List(clientScope(ctx), pagination, search)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to get exams", err)
 	}
@@ -157,12 +185,7 @@ type GetExamOutput struct {
 }
 
 func (h *ExamHandler) GetExam(ctx context.Context, input *GetExamInput) (*GetExamOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	exam, err := h.examRepo.GetByID(input.ID)
+	exam, err := h.examRepo.GetByID(clientScope(ctx), input.ID)
 	if err != nil {
 		return nil, huma.Error404NotFound("Exam not found")
 	}
@@ -184,23 +207,6 @@ type CreateExamOutput struct {
 }
 
 func (h *ExamHandler) CreateExam(ctx context.Context, input *CreateExamInput) (*CreateExamOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
-	}
-
 	exam := &tables.Exam{
 		Code:        input.Body.Code,
 		Name:        input.Body.Name,
@@ -208,14 +214,15 @@ func (h *ExamHandler) CreateExam(ctx context.Context, input *CreateExamInput) (*
 		IsMCQ:       input.Body.IsMCQ,
 		IsInterview: input.Body.IsInterview,
 		IsRandom:    input.Body.IsRandom,
-		ClientID:    2, // Default client ID
 	}
 
-	err := h.examRepo.Create(exam)
+	err := h.examRepo.Create(clientScope(ctx), exam)
 	if err != nil {
-		return nil, huma.Error500InternalServerError("Failed to create exam", err)
+		return nil, createInClientError(err, "Failed to create exam")
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityExam, exam.ID, nil, exam)
+
 	return &CreateExamOutput{
 		Body: struct {
 			Success bool         `json:"success"`
@@ -244,28 +251,24 @@ type UpdateExamOutput struct {
 }
 
 func (h *ExamHandler) UpdateExam(ctx context.Context, input *UpdateExamInput) (*UpdateExamOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
+	before, err := h.examRepo.GetByID(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "exam not found" {
+			return nil, huma.Error404NotFound("Exam not found")
 		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+		return nil, huma.Error500InternalServerError("Failed to get exam", err)
 	}
 
-	exam, err := h.examRepo.Update(input.ID, &input.Body)
+	exam, err := h.examRepo.Update(clientScope(ctx), input.ID, &input.Body)
 	if err != nil {
+		if err.Error() == "exam not found" {
+			return nil, huma.Error404NotFound("Exam not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to update exam", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityExam, exam.ID, before, exam)
+
 	return &UpdateExamOutput{
 		Body: struct {
 			Success bool         `json:"success"`
@@ -292,28 +295,27 @@ type DeleteExamOutput struct {
 }
 
 func (h *ExamHandler) DeleteExam(ctx context.Context, input *DeleteExamInput) (*DeleteExamOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
+	before, err := h.examRepo.GetByID(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "exam not found" {
+			return nil, huma.Error404NotFound("Exam not found")
 		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+		return nil, huma.Error500InternalServerError("Failed to get exam", err)
 	}
 
-	err := h.examRepo.Delete(input.ID)
+	err = h.examRepo.Delete(clientScope(ctx), input.ID)
 	if err != nil {
+		if err.Error() == "exam not found" {
+			return nil, huma.Error404NotFound("Exam not found")
+		}
+		if err.Error() == "exam has deliveries" {
+			return nil, huma.Error409Conflict("Exam has deliveries; delete them first")
+		}
 		return nil, huma.Error500InternalServerError("Failed to delete exam", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityExam, input.ID, before, nil)
+
 	return &DeleteExamOutput{
 		Body: struct {
 			Success bool   `json:"success"`
@@ -325,6 +327,75 @@ func (h *ExamHandler) DeleteExam(ctx context.Context, input *DeleteExamInput) (*
 	}, nil
 }
 
+// List Deleted Exams
+type ListDeletedExamsInput struct {
+	Page    int `query:"page" default:"1" minimum:"1"`
+	PerPage int `query:"per_page" default:"15" minimum:"1" maximum:"100"`
+}
+
+type ListDeletedExamsOutput struct {
+	Body tables.PaginatedResponse `json:"body"`
+}
+
+func (h *ExamHandler) ListDeletedExams(ctx context.Context, input *ListDeletedExamsInput) (*ListDeletedExamsOutput, error) {
+	pagination := tables.Pagination{
+		Page:    input.Page,
+		PerPage: input.PerPage,
+	}
+
+	result, err := h.examRepo.ListDeleted(clientScope(ctx), pagination)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get deleted exams", err)
+	}
+
+	return &ListDeletedExamsOutput{Body: *result}, nil
+}
+
+// Restore Exam
+type RestoreExamInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type RestoreExamOutput struct {
+	Body struct {
+		Success bool         `json:"success"`
+		Message string       `json:"message"`
+		Exam    *tables.Exam `json:"exam,omitempty"`
+	} `json:"body"`
+}
+
+func (h *ExamHandler) RestoreExam(ctx context.Context, input *RestoreExamInput) (*RestoreExamOutput, error) {
+	before, err := h.examRepo.GetDeleted(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "exam not found" {
+			return nil, huma.Error404NotFound("Deleted exam not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to get deleted exam", err)
+	}
+
+	exam, err := h.examRepo.Restore(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "exam not found" {
+			return nil, huma.Error404NotFound("Deleted exam not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to restore exam", err)
+	}
+
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityExam, input.ID, before, exam)
+
+	return &RestoreExamOutput{
+		Body: struct {
+			Success bool         `json:"success"`
+			Message string       `json:"message"`
+			Exam    *tables.Exam `json:"exam,omitempty"`
+		}{
+			Success: true,
+			Message: "Exam restored successfully",
+			Exam:    exam,
+		},
+	}, nil
+}
+
 // Get Exam Items
 type GetExamItemsInput struct {
 	ID      int `path:"id" minimum:"1"`
@@ -337,18 +408,16 @@ type GetExamItemsOutput struct {
 }
 
 func (h *ExamHandler) GetExamItems(ctx context.Context, input *GetExamItemsInput) (*GetExamItemsOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	pagination := tables.Pagination{
 		Page:    input.Page,
 		PerPage: input.PerPage,
 	}
 
-	result, err := h.examRepo.GetExamItems(input.ID, pagination)
+	result, err := h.examRepo.GetExamItems(clientScope(ctx), input.ID, pagination)
 	if err != nil {
+		if err.Error() == "exam not found" {
+			return nil, huma.Error404NotFound("Exam not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to get exam items", err)
 	}
 
@@ -372,28 +441,16 @@ type AddItemToExamOutput struct {
 }
 
 func (h *ExamHandler) AddItemToExam(ctx context.Context, input *AddItemToExamInput) (*AddItemToExamOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
-	}
-
-	err := h.examRepo.AddItem(input.ID, input.Body.ItemID, input.Body.Order)
+	err := h.examRepo.AddItem(clientScope(ctx), input.ID, input.Body.ItemID, input.Body.Order)
 	if err != nil {
+		if err.Error() == "exam or item not found" {
+			return nil, huma.Error404NotFound("Exam or item not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to add item to exam", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityExam, input.ID, auditNoLink, auditLink("items", input.Body.ItemID, map[string]int{"order": input.Body.Order}))
+
 	return &AddItemToExamOutput{
 		Body: struct {
 			Success bool   `json:"success"`
@@ -419,28 +476,13 @@ type RemoveItemFromExamOutput struct {
 }
 
 func (h *ExamHandler) RemoveItemFromExam(ctx context.Context, input *RemoveItemFromExamInput) (*RemoveItemFromExamOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
-	}
-
-	err := h.examRepo.RemoveItem(input.ID, input.ItemID)
+	err := h.examRepo.RemoveItem(clientScope(ctx), input.ID, input.ItemID)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to remove item from exam", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityExam, input.ID, auditLink("items", input.ItemID, true), auditNoLink)
+
 	return &RemoveItemFromExamOutput{
 		Body: struct {
 			Success bool   `json:"success"`
@@ -469,28 +511,13 @@ type UpdateItemOrderOutput struct {
 }
 
 func (h *ExamHandler) UpdateItemOrder(ctx context.Context, input *UpdateItemOrderInput) (*UpdateItemOrderOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
-	}
-
-	err := h.examRepo.UpdateItemOrder(input.ID, input.ItemID, input.Body.Order)
+	err := h.examRepo.UpdateItemOrder(clientScope(ctx), input.ID, input.ItemID, input.Body.Order)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to update item order", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityExam, input.ID, auditNoLink, auditLink("items", input.ItemID, map[string]int{"order": input.Body.Order}))
+
 	return &UpdateItemOrderOutput{
 		Body: struct {
 			Success bool   `json:"success"`
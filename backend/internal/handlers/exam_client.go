@@ -1,62 +1,48 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
-	"sync"
+	"net/http"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
 )
 
-// ExamClientHandler handles exam client registration and management
+// clientOfflineAfter is how long an exam-client that stopped reporting its status is still
+// considered online
+const clientOfflineAfter = 2 * time.Minute
+
+// ExamClientHandler handles exam client registration and management. The registry and the
+// assignment queue are kept in the database, so every coordinator replica serves them.
 type ExamClientHandler struct {
-	clients    map[string]*RegisteredClient
-	clientsMux sync.RWMutex
+	clientRepo *models.ExamClientModel
 
 	// Assignment queue
-	pendingDeliveries chan *DeliveryAssignment
-	assignmentMux     sync.Mutex
-}
+	queueRepo *models.DeliveryQueueModel
 
-// RegisteredClient represents a registered exam client
-type RegisteredClient struct {
-	ClientID      string    `json:"client_id"`
-	ClientIP      string    `json:"client_ip"`
-	Port          int       `json:"port"`
-	MaxDeliveries int       `json:"max_deliveries"`
-	Version       string    `json:"version"`
-	Capabilities  []string  `json:"capabilities"`
-	RegisteredAt  time.Time `json:"registered_at"`
-	LastSeen      time.Time `json:"last_seen"`
-	Status        string    `json:"status"` // "active", "inactive", "offline"
-
-	// Current status
-	ActiveDeliveries int                 `json:"active_deliveries"`
-	TotalProcessed   int                 `json:"total_processed"`
-	Uptime           int64               `json:"uptime"`
-	Deliveries       []*DeliveryInstance `json:"deliveries,omitempty"`
-}
+	// Credentials used to sign calls to the delivery servers of exam-clients
+	credentialRepo *models.ExamClientCredentialModel
 
-// DeliveryInstance represents a running delivery instance
-type DeliveryInstance struct {
-	ID           int       `json:"id"`
-	Name         string    `json:"name"`
-	Status       string    `json:"status"`
-	StartedAt    time.Time `json:"started_at"`
-	Participants int       `json:"participants"`
-	Port         int       `json:"port"`
+	// Staging of the exam content handed out with assignments
+	stagingRepo *models.DeliveryStagingModel
+
+	// HTTP client for calls to the delivery servers of exam-clients
+	httpClient *http.Client
 }
 
-// DeliveryAssignment represents a delivery to be assigned to a client
-type DeliveryAssignment struct {
-	DeliveryID   int                    `json:"delivery_id"`
-	DeliveryName string                 `json:"delivery_name"`
-	ExamData     map[string]interface{} `json:"exam_data"`
-	Config       map[string]interface{} `json:"config"`
-	AssignedAt   time.Time              `json:"assigned_at"`
-	ClientID     string                 `json:"client_id,omitempty"`
+// deliveryServerResponse is the response envelope of the delivery server API
+type deliveryServerResponse struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
 }
 
 // Registration request/response types
@@ -83,12 +69,13 @@ type RegisterClientOutput struct {
 type UpdateClientStatusInput struct {
 	ClientID string `path:"client_id" required:"true"`
 	Body     struct {
-		ClientID         string              `json:"client_id" required:"true"`
-		ActiveDeliveries int                 `json:"active_deliveries"`
-		MaxDeliveries    int                 `json:"max_deliveries"`
-		TotalProcessed   int                 `json:"total_processed"`
-		Uptime           int64               `json:"uptime"`
-		Deliveries       []*DeliveryInstance `json:"deliveries"`
+		ClientID         string                     `json:"client_id" required:"true"`
+		ActiveDeliveries int                        `json:"active_deliveries"`
+		MaxDeliveries    int                        `json:"max_deliveries"`
+		TotalProcessed   int                        `json:"total_processed"`
+		Uptime           int64                      `json:"uptime"`
+		Deliveries       []*tables.DeliveryInstance `json:"deliveries"`
+		OutboxBacklog    int                        `json:"outbox_backlog"`
 	}
 }
 
@@ -105,7 +92,7 @@ type GetAssignmentInput struct {
 }
 
 type GetAssignmentOutput struct {
-	Body *DeliveryAssignment `json:"body,omitempty"`
+	Body *tables.DeliveryAssignment `json:"body,omitempty"`
 }
 
 // List clients types
@@ -113,8 +100,8 @@ type ListClientsInput struct{}
 
 type ListClientsOutput struct {
 	Body struct {
-		Clients []*RegisteredClient `json:"clients"`
-		Total   int                 `json:"total"`
+		Clients []*tables.RegisteredClient `json:"clients"`
+		Total   int                        `json:"total"`
 	}
 }
 
@@ -131,10 +118,13 @@ type UnregisterClientOutput struct {
 }
 
 // NewExamClientHandler creates a new exam client handler
-func NewExamClientHandler() *ExamClientHandler {
+func NewExamClientHandler(clientRepo *models.ExamClientModel, queueRepo *models.DeliveryQueueModel, credentialRepo *models.ExamClientCredentialModel, stagingRepo *models.DeliveryStagingModel) *ExamClientHandler {
 	return &ExamClientHandler{
-		clients:           make(map[string]*RegisteredClient),
-		pendingDeliveries: make(chan *DeliveryAssignment, 100),
+		clientRepo:     clientRepo,
+		queueRepo:      queueRepo,
+		credentialRepo: credentialRepo,
+		stagingRepo:    stagingRepo,
+		httpClient:     &http.Client{Timeout: 10 * time.Second},
 	}
 }
 
@@ -148,6 +138,7 @@ func (h *ExamClientHandler) Register(api huma.API) {
 		Summary:     "Register an exam client",
 		Description: "Register a new exam client with the coordinator.",
 		Tags:        []string{"Internal", "Exam Clients"},
+		Metadata:    middleware.RequireExamClient(),
 	}, h.RegisterClient)
 
 	// Status updates
@@ -158,6 +149,7 @@ func (h *ExamClientHandler) Register(api huma.API) {
 		Summary:     "Update client status",
 		Description: "Update the status and metrics of an exam client.",
 		Tags:        []string{"Internal", "Exam Clients"},
+		Metadata:    middleware.RequireExamClient(),
 	}, h.UpdateClientStatus)
 
 	// Get assignments
@@ -168,6 +160,7 @@ func (h *ExamClientHandler) Register(api huma.API) {
 		Summary:     "Get delivery assignment",
 		Description: "Get a pending delivery assignment for the client.",
 		Tags:        []string{"Internal", "Exam Clients"},
+		Metadata:    middleware.RequireExamClient(),
 	}, h.GetAssignment)
 
 	// List clients (admin endpoint)
@@ -176,8 +169,10 @@ func (h *ExamClientHandler) Register(api huma.API) {
 		Method:      "GET",
 		Path:        "/api/internal/exam-clients",
 		Summary:     "List exam clients",
-		Description: "List all registered exam clients and their status.",
+		Description: "List all registered exam clients and their status. Only administrators can perform this action.",
 		Tags:        []string{"Internal", "Exam Clients"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionExamClientManage),
 	}, h.ListClients)
 
 	// Unregister client
@@ -188,23 +183,19 @@ func (h *ExamClientHandler) Register(api huma.API) {
 		Summary:     "Unregister exam client",
 		Description: "Remove an exam client from the coordinator.",
 		Tags:        []string{"Internal", "Exam Clients"},
+		Metadata:    middleware.RequireExamClient(),
 	}, h.UnregisterClient)
 }
 
 // RegisterClient handles client registration
 func (h *ExamClientHandler) RegisterClient(ctx context.Context, input *RegisterClientInput) (*RegisterClientOutput, error) {
-	h.clientsMux.Lock()
-	defer h.clientsMux.Unlock()
-
 	clientID := input.Body.ClientID
-
-	// Check if already registered
-	if existingClient, exists := h.clients[clientID]; exists {
-		log.Printf("Client %s re-registering (was last seen: %v)", clientID, existingClient.LastSeen)
+	if clientID != middleware.GetExamClientIDFromContext(ctx) {
+		return nil, huma.Error403Forbidden("Request signed by another exam client")
 	}
 
 	// Create/update client record
-	client := &RegisteredClient{
+	client := &tables.RegisteredClient{
 		ClientID:      clientID,
 		ClientIP:      input.Body.ClientIP,
 		Port:          input.Body.Port,
@@ -216,7 +207,13 @@ func (h *ExamClientHandler) RegisterClient(ctx context.Context, input *RegisterC
 		Status:        "active",
 	}
 
-	h.clients[clientID] = client
+	existed, err := h.clientRepo.Register(client)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to register exam client", err)
+	}
+	if existed {
+		log.Printf("Client %s re-registering", clientID)
+	}
 
 	log.Printf("Registered exam client: %s (%s:%d) - capacity: %d",
 		clientID, client.ClientIP, client.Port, client.MaxDeliveries)
@@ -236,11 +233,17 @@ func (h *ExamClientHandler) RegisterClient(ctx context.Context, input *RegisterC
 
 // UpdateClientStatus handles status updates from clients
 func (h *ExamClientHandler) UpdateClientStatus(ctx context.Context, input *UpdateClientStatusInput) (*UpdateClientStatusOutput, error) {
-	h.clientsMux.Lock()
-	defer h.clientsMux.Unlock()
-
-	client, exists := h.clients[input.ClientID]
-	if !exists {
+	err := h.clientRepo.UpdateStatus(input.ClientID, &tables.ExamClientStatus{
+		ActiveDeliveries: input.Body.ActiveDeliveries,
+		TotalProcessed:   input.Body.TotalProcessed,
+		Uptime:           input.Body.Uptime,
+		Deliveries:       input.Body.Deliveries,
+		OutboxBacklog:    input.Body.OutboxBacklog,
+	})
+	if err != nil {
+		if err.Error() != "exam client not registered" {
+			return nil, huma.Error500InternalServerError("Failed to update client status", err)
+		}
 		return &UpdateClientStatusOutput{
 			Body: struct {
 				Success bool   `json:"success"`
@@ -252,14 +255,6 @@ func (h *ExamClientHandler) UpdateClientStatus(ctx context.Context, input *Updat
 		}, nil
 	}
 
-	// Update client status
-	client.LastSeen = time.Now()
-	client.Status = "active"
-	client.ActiveDeliveries = input.Body.ActiveDeliveries
-	client.TotalProcessed = input.Body.TotalProcessed
-	client.Uptime = input.Body.Uptime
-	client.Deliveries = input.Body.Deliveries
-
 	return &UpdateClientStatusOutput{
 		Body: struct {
 			Success bool   `json:"success"`
@@ -273,11 +268,8 @@ func (h *ExamClientHandler) UpdateClientStatus(ctx context.Context, input *Updat
 
 // GetAssignment provides delivery assignments to clients
 func (h *ExamClientHandler) GetAssignment(ctx context.Context, input *GetAssignmentInput) (*GetAssignmentOutput, error) {
-	h.clientsMux.RLock()
-	client, exists := h.clients[input.ClientID]
-	h.clientsMux.RUnlock()
-
-	if !exists {
+	client, err := h.clientRepo.Get(input.ClientID)
+	if err != nil {
 		return &GetAssignmentOutput{}, fmt.Errorf("client not found")
 	}
 
@@ -288,43 +280,65 @@ func (h *ExamClientHandler) GetAssignment(ctx context.Context, input *GetAssignm
 	}
 
 	// Try to get pending assignment
-	select {
-	case assignment := <-h.pendingDeliveries:
-		assignment.ClientID = input.ClientID
-		assignment.AssignedAt = time.Now()
-
-		log.Printf("Assigned delivery %d to client %s", assignment.DeliveryID, input.ClientID)
-
-		return &GetAssignmentOutput{
-			Body: assignment,
-		}, nil
-	default:
+	assignment, err := h.queueRepo.Claim()
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get delivery assignment", err)
+	}
+	if assignment == nil {
 		// No pending assignments - return 204 No Content
 		return &GetAssignmentOutput{}, nil
 	}
+
+	assignment.ClientID = input.ClientID
+	assignment.AssignedAt = time.Now()
+
+	// The client stages the encrypted content; it fetches the key once it is released
+	if err := h.stagingRepo.MarkAssigned(assignment.DeliveryID, input.ClientID); err != nil {
+		if err.Error() == "delivery staging not found" {
+			// The staging was reset after this assignment was queued; it is queued again when needed
+			log.Printf("Dropped outdated assignment of delivery %d", assignment.DeliveryID)
+			return &GetAssignmentOutput{}, nil
+		}
+		h.requeue(assignment)
+		return nil, huma.Error500InternalServerError("Failed to assign delivery", err)
+	}
+
+	log.Printf("Assigned delivery %d to client %s", assignment.DeliveryID, input.ClientID)
+
+	return &GetAssignmentOutput{
+		Body: assignment,
+	}, nil
+}
+
+// requeue puts back an assignment that could not be handed out
+func (h *ExamClientHandler) requeue(assignment *tables.DeliveryAssignment) {
+	assignment.ClientID = ""
+	if err := h.queueRepo.Enqueue(assignment); err != nil {
+		log.Printf("Failed to requeue delivery %d: %v", assignment.DeliveryID, err)
+	}
 }
 
 // ListClients lists all registered clients
 func (h *ExamClientHandler) ListClients(ctx context.Context, input *ListClientsInput) (*ListClientsOutput, error) {
-	h.clientsMux.RLock()
-	defer h.clientsMux.RUnlock()
-
-	clients := make([]*RegisteredClient, 0, len(h.clients))
+	clients, err := h.clientRepo.List()
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to list exam clients", err)
+	}
 
 	// Mark clients as offline if not seen recently
-	cutoff := time.Now().Add(-2 * time.Minute)
+	cutoff := time.Now().Add(-clientOfflineAfter)
 
-	for _, client := range h.clients {
+	for _, client := range clients {
+		client.Status = "active"
 		if client.LastSeen.Before(cutoff) {
 			client.Status = "offline"
 		}
-		clients = append(clients, client)
 	}
 
 	return &ListClientsOutput{
 		Body: struct {
-			Clients []*RegisteredClient `json:"clients"`
-			Total   int                 `json:"total"`
+			Clients []*tables.RegisteredClient `json:"clients"`
+			Total   int                        `json:"total"`
 		}{
 			Clients: clients,
 			Total:   len(clients),
@@ -334,10 +348,9 @@ func (h *ExamClientHandler) ListClients(ctx context.Context, input *ListClientsI
 
 // UnregisterClient removes a client
 func (h *ExamClientHandler) UnregisterClient(ctx context.Context, input *UnregisterClientInput) (*UnregisterClientOutput, error) {
-	h.clientsMux.Lock()
-	defer h.clientsMux.Unlock()
-
-	delete(h.clients, input.ClientID)
+	if err := h.clientRepo.Delete(input.ClientID); err != nil {
+		return nil, huma.Error500InternalServerError("Failed to unregister exam client", err)
+	}
 
 	log.Printf("Unregistered exam client: %s", input.ClientID)
 
@@ -352,9 +365,16 @@ func (h *ExamClientHandler) UnregisterClient(ctx context.Context, input *Unregis
 	}, nil
 }
 
+// RemoveClient drops a client from the registry, e.g. after its credentials were revoked
+func (h *ExamClientHandler) RemoveClient(clientID string) {
+	if err := h.clientRepo.Delete(clientID); err != nil {
+		log.Printf("Failed to remove exam client %s: %v", clientID, err)
+	}
+}
+
 // AssignDelivery queues a delivery for assignment to available clients
-func (h *ExamClientHandler) AssignDelivery(deliveryID int, deliveryName string, examData map[string]interface{}) {
-	assignment := &DeliveryAssignment{
+func (h *ExamClientHandler) AssignDelivery(deliveryID int, deliveryName string, examData map[string]interface{}) error {
+	assignment := &tables.DeliveryAssignment{
 		DeliveryID:   deliveryID,
 		DeliveryName: deliveryName,
 		ExamData:     examData,
@@ -362,32 +382,37 @@ func (h *ExamClientHandler) AssignDelivery(deliveryID int, deliveryName string,
 		AssignedAt:   time.Now(),
 	}
 
-	select {
-	case h.pendingDeliveries <- assignment:
-		log.Printf("Queued delivery %d (%s) for assignment", deliveryID, deliveryName)
-	default:
-		log.Printf("Assignment queue full - delivery %d not queued", deliveryID)
+	if err := h.queueRepo.Enqueue(assignment); err != nil {
+		return err
 	}
+	log.Printf("Queued delivery %d (%s) for assignment", deliveryID, deliveryName)
+	return nil
+}
+
+// FinishDelivery tells the exam-client running a delivery that it closed, so remaining
+// attempts are force-submitted and the results exported
+func (h *ExamClientHandler) FinishDelivery(deliveryID int) error {
+	return h.callDeliveryServer(deliveryID, http.MethodPost, "/api/finish", nil, nil)
 }
 
 // GetAvailableCapacity returns total available capacity across all clients
 func (h *ExamClientHandler) GetAvailableCapacity() int {
-	h.clientsMux.RLock()
-	defer h.clientsMux.RUnlock()
+	clients, err := h.onlineClients()
+	if err != nil {
+		log.Printf("Failed to get exam client capacity: %v", err)
+		return 0
+	}
 
 	totalCapacity := 0
-	cutoff := time.Now().Add(-2 * time.Minute) // Consider offline if not seen for 2+ minutes
 	hasUnlimitedClient := false
 
-	for _, client := range h.clients {
-		if client.LastSeen.After(cutoff) { // Client is online
-			if client.MaxDeliveries == 0 { // Unlimited capacity
-				hasUnlimitedClient = true
-			} else {
-				available := client.MaxDeliveries - client.ActiveDeliveries
-				if available > 0 {
-					totalCapacity += available
-				}
+	for _, client := range clients {
+		if client.MaxDeliveries == 0 { // Unlimited capacity
+			hasUnlimitedClient = true
+		} else {
+			available := client.MaxDeliveries - client.ActiveDeliveries
+			if available > 0 {
+				totalCapacity += available
 			}
 		}
 	}
@@ -399,3 +424,105 @@ func (h *ExamClientHandler) GetAvailableCapacity() int {
 
 	return totalCapacity
 }
+
+// IsAssigned reports whether a delivery is assigned to an exam-client
+func (h *ExamClientHandler) IsAssigned(deliveryID int, clientID string) (bool, error) {
+	staging, err := h.stagingRepo.Get(deliveryID)
+	if err != nil {
+		if err.Error() == "delivery staging not found" {
+			return false, nil
+		}
+		return false, err
+	}
+	return staging.ClientID != nil && *staging.ClientID == clientID, nil
+}
+
+// GetClientIP returns the address of a registered exam-client that is currently online
+func (h *ExamClientHandler) GetClientIP(clientID string) (string, bool) {
+	client, err := h.clientRepo.Get(clientID)
+	if err != nil || client.LastSeen.Before(time.Now().Add(-clientOfflineAfter)) {
+		return "", false
+	}
+	return client.ClientIP, true
+}
+
+// GetDeliveryURL returns the base URL of the delivery server running a delivery on an online exam-client
+func (h *ExamClientHandler) GetDeliveryURL(deliveryID int) (string, bool) {
+	_, baseURL, ok := h.deliveryClient(deliveryID)
+	return baseURL, ok
+}
+
+// deliveryClient returns the online exam-client running a delivery and the base URL of its delivery server
+func (h *ExamClientHandler) deliveryClient(deliveryID int) (string, string, bool) {
+	clients, err := h.onlineClients()
+	if err != nil {
+		log.Printf("Failed to find exam client of delivery %d: %v", deliveryID, err)
+		return "", "", false
+	}
+
+	for _, client := range clients {
+		for _, delivery := range client.Deliveries {
+			if delivery.ID == deliveryID && delivery.Port > 0 {
+				return client.ClientID, fmt.Sprintf("http://%s:%d", client.ClientIP, delivery.Port), true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// onlineClients lists the exam-clients that reported their status recently
+func (h *ExamClientHandler) onlineClients() ([]*tables.RegisteredClient, error) {
+	return h.clientRepo.ListSeenSince(time.Now().Add(-clientOfflineAfter))
+}
+
+// callDeliveryServer calls the API of the delivery server running a delivery and decodes
+// the data of its response
+func (h *ExamClientHandler) callDeliveryServer(deliveryID int, method, path string, payload []byte, data interface{}) error {
+	clientID, baseURL, ok := h.deliveryClient(deliveryID)
+	if !ok {
+		return huma.Error409Conflict("Delivery is not running on an exam-client")
+	}
+
+	// The exam-client only accepts calls signed with its own secret
+	credential, err := h.credentialRepo.GetActive(clientID)
+	if err != nil {
+		return huma.Error409Conflict("Exam-client running the delivery is not enrolled")
+	}
+
+	req, err := http.NewRequest(method, baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return huma.Error500InternalServerError("Failed to reach exam-client", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err := utils.SignRequest(req, clientID, credential.Secret, payload); err != nil {
+		return huma.Error500InternalServerError("Failed to sign exam-client request", err)
+	}
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return huma.Error502BadGateway("Failed to reach exam-client", err)
+	}
+	defer resp.Body.Close()
+
+	var response deliveryServerResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return huma.Error502BadGateway("Invalid response from exam-client", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusBadRequest:
+		return huma.Error400BadRequest(response.Message)
+	case resp.StatusCode != http.StatusOK:
+		return huma.Error502BadGateway(fmt.Sprintf("Exam-client returned status %d: %s", resp.StatusCode, response.Message))
+	}
+
+	if len(response.Data) == 0 || string(response.Data) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(response.Data, data); err != nil {
+		return huma.Error502BadGateway("Invalid response from exam-client", err)
+	}
+	return nil
+}
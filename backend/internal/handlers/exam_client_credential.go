@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
+)
+
+// ExamClientCredentialHandler enrolls exam-clients and lets administrators revoke them
+type ExamClientCredentialHandler struct {
+	credentialRepo  *models.ExamClientCredentialModel
+	examClients     *ExamClientHandler
+	enrollmentToken string
+}
+
+func NewExamClientCredentialHandler(credentialRepo *models.ExamClientCredentialModel, examClients *ExamClientHandler, enrollmentToken string) *ExamClientCredentialHandler {
+	return &ExamClientCredentialHandler{
+		credentialRepo:  credentialRepo,
+		examClients:     examClients,
+		enrollmentToken: enrollmentToken,
+	}
+}
+
+func (h *ExamClientCredentialHandler) Register(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "enroll-exam-client",
+		Method:      http.MethodPost,
+		Path:        "/api/internal/exam-clients/enroll",
+		Summary:     "Enroll an exam client",
+		Description: "Exchange the enrollment token for the secret an exam client signs its requests with. A client ID can only be enrolled once.",
+		Tags:        []string{"Internal", "Exam Clients"},
+		Metadata:    middleware.Public(),
+	}, h.Enroll)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-exam-client-credentials",
+		Method:      http.MethodGet,
+		Path:        "/api/exam-clients/credentials",
+		Summary:     "List enrolled exam clients",
+		Description: "List enrolled exam clients with their enrollment and revocation. Only administrators can perform this action.",
+		Tags:        []string{"Exam Clients"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionExamClientManage),
+	}, h.ListCredentials)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "revoke-exam-client",
+		Method:      http.MethodPost,
+		Path:        "/api/exam-clients/{client_id}/revoke",
+		Summary:     "Revoke an exam client",
+		Description: "Revoke the credentials of an exam client. Its requests are rejected from then on and it must enroll again under a new client ID. Only administrators can perform this action.",
+		Tags:        []string{"Exam Clients"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionExamClientManage),
+	}, h.Revoke)
+}
+
+// Enroll Exam Client
+type EnrollExamClientInput struct {
+	Body tables.ExamClientEnrollmentRequest `json:"body"`
+}
+
+type EnrollExamClientOutput struct {
+	Body struct {
+		Success bool                         `json:"success"`
+		Message string                       `json:"message"`
+		Data    *tables.ExamClientEnrollment `json:"data,omitempty"`
+	} `json:"body"`
+}
+
+func (h *ExamClientCredentialHandler) Enroll(ctx context.Context, input *EnrollExamClientInput) (*EnrollExamClientOutput, error) {
+	if h.enrollmentToken == "" {
+		return nil, huma.Error403Forbidden("Exam client enrollment is disabled")
+	}
+	if subtle.ConstantTimeCompare([]byte(input.Body.EnrollmentToken), []byte(h.enrollmentToken)) != 1 {
+		log.Printf("Rejected enrollment of exam client %s from %s: invalid token", input.Body.ClientID, middleware.GetClientIPFromContext(ctx))
+		return nil, huma.Error401Unauthorized("Invalid enrollment token")
+	}
+
+	secret, err := utils.GenerateSecret(32)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to enroll exam client", err)
+	}
+
+	credential, err := h.credentialRepo.Enroll(input.Body.ClientID, secret, middleware.GetClientIPFromContext(ctx))
+	if err != nil {
+		if err.Error() == "exam client already enrolled" {
+			return nil, huma.Error409Conflict("Exam client already enrolled")
+		}
+		return nil, huma.Error500InternalServerError("Failed to enroll exam client", err)
+	}
+
+	log.Printf("Enrolled exam client %s", credential.ClientID)
+
+	return &EnrollExamClientOutput{
+		Body: struct {
+			Success bool                         `json:"success"`
+			Message string                       `json:"message"`
+			Data    *tables.ExamClientEnrollment `json:"data,omitempty"`
+		}{
+			Success: true,
+			Message: "Exam client enrolled",
+			Data: &tables.ExamClientEnrollment{
+				ClientID: credential.ClientID,
+				Secret:   credential.Secret,
+			},
+		},
+	}, nil
+}
+
+// List Exam Client Credentials
+type ListExamClientCredentialsInput struct{}
+
+type ListExamClientCredentialsOutput struct {
+	Body []tables.ExamClientCredential `json:"body"`
+}
+
+func (h *ExamClientCredentialHandler) ListCredentials(ctx context.Context, input *ListExamClientCredentialsInput) (*ListExamClientCredentialsOutput, error) {
+	credentials, err := h.credentialRepo.List()
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to list exam clients", err)
+	}
+
+	return &ListExamClientCredentialsOutput{Body: credentials}, nil
+}
+
+// Revoke Exam Client
+type RevokeExamClientInput struct {
+	ClientID string                         `path:"client_id"`
+	Body     tables.RevokeExamClientRequest `json:"body"`
+}
+
+type RevokeExamClientOutput struct {
+	Body struct {
+		Success bool                         `json:"success"`
+		Message string                       `json:"message"`
+		Data    *tables.ExamClientCredential `json:"data,omitempty"`
+	} `json:"body"`
+}
+
+func (h *ExamClientCredentialHandler) Revoke(ctx context.Context, input *RevokeExamClientInput) (*RevokeExamClientOutput, error) {
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+
+	credential, err := h.credentialRepo.Revoke(input.ClientID, sessionData.UserID, input.Body.Reason)
+	if err != nil {
+		switch err.Error() {
+		case "exam client not found":
+			return nil, huma.Error404NotFound("Exam client not found")
+		case "exam client already revoked":
+			return nil, huma.Error409Conflict("Exam client already revoked")
+		}
+		return nil, huma.Error500InternalServerError("Failed to revoke exam client", err)
+	}
+
+	h.examClients.RemoveClient(input.ClientID)
+	log.Printf("Revoked exam client %s (by user %d)", input.ClientID, sessionData.UserID)
+
+	return &RevokeExamClientOutput{
+		Body: struct {
+			Success bool                         `json:"success"`
+			Message string                       `json:"message"`
+			Data    *tables.ExamClientCredential `json:"data,omitempty"`
+		}{
+			Success: true,
+			Message: fmt.Sprintf("Exam client %s revoked", input.ClientID),
+			Data:    credential,
+		},
+	}, nil
+}
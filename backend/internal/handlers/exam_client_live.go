@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -10,17 +11,27 @@ import (
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/medxamion/medxamion/internal/middleware"
 	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
+	"github.com/medxamion/medxamion/internal/tables"
 )
 
 // ExamClientLiveHandler handles live progress queries to exam-clients
 type ExamClientLiveHandler struct {
-	deliveryModel *models.DeliveryModel
-	wsHub         *WebSocketHub
-	httpClient    *http.Client
+	deliveryModel    *models.DeliveryModel
+	helpRequestModel *models.HelpRequestModel
+	eventModel       *models.ExamClientEventModel
+	examClients      *ExamClientHandler
+	wsHub            *WebSocketHub
+	networkAccess    *services.NetworkAccessService
+	attemptModel     *models.AttemptModel
+	collusion        *services.CollusionService
+	examContent      *services.ExamContentService
+	httpClient       *http.Client
 }
 
 // ExamClientEvent represents an event from exam-client
 type ExamClientEvent struct {
+	EventID    string                 `json:"event_id,omitempty"` // set by the exam-client outbox, identifies retries
 	EventType  string                 `json:"event_type"`
 	DeliveryID int                    `json:"delivery_id"`
 	ClientID   string                 `json:"client_id"`
@@ -70,12 +81,29 @@ type FinalResultsOutput struct {
 	} `json:"body"`
 }
 
+// NetworkPolicyInput represents a network policy request from exam-client
+type NetworkPolicyInput struct {
+	DeliveryID int `path:"id" minimum:"1"`
+}
+
+// NetworkPolicyOutput represents the network allow-list of a delivery
+type NetworkPolicyOutput struct {
+	Body *tables.DeliveryNetworkPolicy `json:"body"`
+}
+
 // NewExamClientLiveHandler creates a new exam client live handler
-func NewExamClientLiveHandler(deliveryModel *models.DeliveryModel, wsHub *WebSocketHub) *ExamClientLiveHandler {
+func NewExamClientLiveHandler(deliveryModel *models.DeliveryModel, helpRequestModel *models.HelpRequestModel, eventModel *models.ExamClientEventModel, examClients *ExamClientHandler, wsHub *WebSocketHub, networkAccess *services.NetworkAccessService, examContent *services.ExamContentService, attemptModel *models.AttemptModel, collusion *services.CollusionService) *ExamClientLiveHandler {
 	return &ExamClientLiveHandler{
-		deliveryModel: deliveryModel,
-		wsHub:         wsHub,
-		httpClient:    &http.Client{Timeout: 10 * time.Second},
+		deliveryModel:    deliveryModel,
+		helpRequestModel: helpRequestModel,
+		eventModel:       eventModel,
+		examClients:      examClients,
+		wsHub:            wsHub,
+		networkAccess:    networkAccess,
+		examContent:      examContent,
+		attemptModel:     attemptModel,
+		collusion:        collusion,
+		httpClient:       &http.Client{Timeout: 10 * time.Second},
 	}
 }
 
@@ -89,6 +117,7 @@ func (h *ExamClientLiveHandler) Register(api huma.API) {
 		Description: "Query the active exam-client for real-time progress data.",
 		Tags:        []string{"Live Progress"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetLiveProgress)
 
 	huma.Register(api, huma.Operation{
@@ -98,6 +127,7 @@ func (h *ExamClientLiveHandler) Register(api huma.API) {
 		Summary:     "Receive event from exam-client",
 		Description: "Receive real-time events from exam-client services.",
 		Tags:        []string{"Internal"},
+		Metadata:    middleware.RequireExamClient(),
 	}, h.ReceiveEvent)
 
 	huma.Register(api, huma.Operation{
@@ -107,45 +137,87 @@ func (h *ExamClientLiveHandler) Register(api huma.API) {
 		Summary:     "Receive final results from exam-client",
 		Description: "Receive complete exam results when delivery finishes.",
 		Tags:        []string{"Internal"},
+		Metadata:    middleware.RequireExamClient(),
 	}, h.ReceiveFinalResults)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-exam-client-network-policy",
+		Method:      http.MethodGet,
+		Path:        "/api/internal/exam-clients/deliveries/{id}/network-policy",
+		Summary:     "Get delivery network policy",
+		Description: "Get the current network allow-list and participant overrides of a delivery.",
+		Tags:        []string{"Internal"},
+		Metadata:    middleware.RequireExamClient(),
+	}, h.GetNetworkPolicy)
 }
 
 // GetLiveProgress queries exam-client for live progress or falls back to database
 func (h *ExamClientLiveHandler) GetLiveProgress(ctx context.Context, input *LiveProgressQuery) (*LiveProgressQueryOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
+	// Check if delivery exists
+	if _, err := h.deliveryModel.GetByID(clientScope(ctx), input.DeliveryID); err != nil {
+		return nil, huma.Error404NotFound("Delivery not found")
 	}
 
-	// Check if delivery exists and get its details
-	delivery, err := h.deliveryModel.GetByID(input.DeliveryID)
+	data, source, err := h.loadProgress(input.DeliveryID)
 	if err != nil {
-		return nil, huma.Error404NotFound("Delivery not found")
+		return nil, huma.Error500InternalServerError("Failed to get progress data", err)
+	}
+
+	message := "Live progress retrieved from exam-client"
+	if source == "database" {
+		message = "Progress retrieved from database (exam-client unavailable)"
 	}
 
+	return &LiveProgressQueryOutput{
+		Body: struct {
+			Success bool        `json:"success"`
+			Message string      `json:"message"`
+			Data    interface{} `json:"data,omitempty"`
+			Source  string      `json:"source"`
+		}{
+			Success: true,
+			Message: message,
+			Data:    data,
+			Source:  source,
+		},
+	}, nil
+}
+
+// LoadProgressSnapshot loads the full progress of a delivery and its pending help
+// requests for WebSocket snapshots
+func (h *ExamClientLiveHandler) LoadProgressSnapshot(deliveryID int) (interface{}, error) {
+	data, _, err := h.loadProgress(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	helpRequests, err := h.helpRequestModel.ListPending(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	data["help_requests"] = helpRequests
+
+	return data, nil
+}
+
+// loadProgress queries the exam-client for live progress or falls back to the database. Its
+// callers check the delivery is of the client of the caller.
+func (h *ExamClientLiveHandler) loadProgress(deliveryID int) (map[string]interface{}, string, error) {
 	// Try to get live data from exam-client first
-	liveData, err := h.queryExamClientProgress(input.DeliveryID)
+	liveData, err := h.queryExamClientProgress(deliveryID)
 	if err == nil && liveData != nil {
-		// Successfully got live data from exam-client
-		return &LiveProgressQueryOutput{
-			Body: struct {
-				Success bool        `json:"success"`
-				Message string      `json:"message"`
-				Data    interface{} `json:"data,omitempty"`
-				Source  string      `json:"source"`
-			}{
-				Success: true,
-				Message: "Live progress retrieved from exam-client",
-				Data:    liveData,
-				Source:  "exam_client",
-			},
-		}, nil
+		return liveData, "exam_client", nil
 	}
 
 	// Fallback to database query
-	progressData, err := h.deliveryModel.GetParticipantProgress(input.DeliveryID)
+	delivery, err := h.deliveryModel.GetByID(models.AllClients(), deliveryID)
 	if err != nil {
-		return nil, huma.Error500InternalServerError("Failed to get progress data", err)
+		return nil, "", err
+	}
+
+	progressData, err := h.deliveryModel.GetParticipantProgress(models.AllClients(), deliveryID)
+	if err != nil {
+		return nil, "", err
 	}
 
 	// Calculate stats
@@ -176,19 +248,7 @@ func (h *ExamClientLiveHandler) GetLiveProgress(ctx context.Context, input *Live
 		"participants": progressData,
 	}
 
-	return &LiveProgressQueryOutput{
-		Body: struct {
-			Success bool        `json:"success"`
-			Message string      `json:"message"`
-			Data    interface{} `json:"data,omitempty"`
-			Source  string      `json:"source"`
-		}{
-			Success: true,
-			Message: "Progress retrieved from database (exam-client unavailable)",
-			Data:    fallbackData,
-			Source:  "database",
-		},
-	}, nil
+	return fallbackData, "database", nil
 }
 
 // ReceiveEvent handles events from exam-clients
@@ -198,54 +258,140 @@ func (h *ExamClientLiveHandler) ReceiveEvent(ctx context.Context, input *EventRe
 	// Log the event
 	fmt.Printf("Received event from exam-client: %s for delivery %d\n", event.EventType, event.DeliveryID)
 
-	// Trigger WebSocket broadcast for this delivery
-	h.wsHub.BroadcastProgressUpdate(event.DeliveryID)
+	if event.ClientID != middleware.GetExamClientIDFromContext(ctx) {
+		return nil, huma.Error403Forbidden("Request signed by another exam client")
+	}
+	if err := h.requireAssignment(ctx, event.DeliveryID); err != nil {
+		return nil, err
+	}
+
+	if event.EventID != "" {
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return nil, huma.Error400BadRequest("Invalid event data")
+		}
+		deliveryID := event.DeliveryID
+		recorded, err := h.eventModel.Record(&tables.ExamClientEventReceipt{
+			EventID:    event.EventID,
+			ClientID:   event.ClientID,
+			DeliveryID: &deliveryID,
+			EventType:  event.EventType,
+			Data:       data,
+			OccurredAt: &event.Timestamp,
+		})
+		if err != nil {
+			return nil, huma.Error500InternalServerError("Failed to record event", err)
+		}
+		if !recorded {
+			return eventReceived("Event already processed"), nil
+		}
+	}
+
+	switch event.EventType {
+	case "access_denied":
+		h.recordAccessDenied(event)
+	case "help_requested":
+		if err := h.recordHelpRequest(event); err != nil {
+			h.forgetEvent(event.EventID)
+			return nil, huma.Error500InternalServerError("Failed to record help request", err)
+		}
+	}
+
+	// Push the change to live-monitoring clients
+	if event.EventType != "help_requested" {
+		if delta, ok := progressDelta(event); ok {
+			h.wsHub.PublishDelta(event.DeliveryID, event.EventType, delta)
+		}
+	}
 
-	// TODO: Store event in database for audit trail if needed
+	return eventReceived("Event received and processed"), nil
+}
 
+func eventReceived(message string) *EventReceiveOutput {
 	return &EventReceiveOutput{
 		Body: struct {
 			Success bool   `json:"success"`
 			Message string `json:"message"`
 		}{
 			Success: true,
-			Message: "Event received and processed",
+			Message: message,
 		},
-	}, nil
+	}
+}
+
+// forgetEvent lets the exam-client retry an event whose processing failed
+func (h *ExamClientLiveHandler) forgetEvent(eventID string) {
+	if eventID == "" {
+		return
+	}
+	if err := h.eventModel.Forget(eventID); err != nil {
+		fmt.Printf("Failed to forget event %s: %v\n", eventID, err)
+	}
 }
 
 // ReceiveFinalResults handles final results from exam-clients
 func (h *ExamClientLiveHandler) ReceiveFinalResults(ctx context.Context, input *FinalResultsInput) (*FinalResultsOutput, error) {
-	finalData := input.Body
-
 	// Log the final data transfer
 	fmt.Printf("Received final results from exam-client %s\n", input.ClientID)
 
-	// TODO: Process and store the final results in PostgreSQL
-	// This would involve:
-	// 1. Validate the data structure
-	// 2. Convert SQLite data format to PostgreSQL format
-	// 3. Insert attempts, answers, and progress data
-	// 4. Update delivery status
-	// 5. Clean up any temporary state
-
-	// For now, just log the data
-	if deliveryID, ok := finalData["delivery_id"].(float64); ok {
-		fmt.Printf("Processing final results for delivery %d\n", int(deliveryID))
-
-		// Extract data components
-		if participants, ok := finalData["participants"].([]interface{}); ok {
-			fmt.Printf("  - %d participants\n", len(participants))
-		}
-		if attempts, ok := finalData["attempts"].([]interface{}); ok {
-			fmt.Printf("  - %d attempts\n", len(attempts))
+	// The results are encrypted with the delivery key; only the delivery and event IDs are in the clear
+	id, ok := input.Body["delivery_id"].(float64)
+	if !ok {
+		return nil, huma.Error400BadRequest("Final results have no delivery ID")
+	}
+	sealed, ok := input.Body["encrypted_results"].(string)
+	if !ok || sealed == "" {
+		return nil, huma.Error400BadRequest("Final results must be encrypted with the delivery key")
+	}
+	finalData, err := h.examContent.OpenResults(int(id), sealed)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidResults) || err.Error() == "delivery key not found" {
+			fmt.Printf("Rejected final results of delivery %d from exam-client %s: %v\n", int(id), input.ClientID, err)
+			return nil, huma.Error400BadRequest("Failed to decrypt final results")
 		}
-		if answers, ok := finalData["answers"].([]interface{}); ok {
-			fmt.Printf("  - %d answers\n", len(answers))
+		return nil, huma.Error500InternalServerError("Failed to decrypt final results", err)
+	}
+	deliveryID := int(id)
+	if err := h.requireAssignment(ctx, deliveryID); err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(finalData)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to read final results", err)
+	}
+	var results tables.FinalResults
+	if err := json.Unmarshal(encoded, &results); err != nil {
+		return nil, huma.Error400BadRequest("Final results are malformed")
+	}
+	results.DeliveryID = deliveryID
+
+	var receipt *tables.ExamClientEventReceipt
+	if eventID, ok := input.Body["event_id"].(string); ok && eventID != "" {
+		receipt = &tables.ExamClientEventReceipt{
+			EventID:    eventID,
+			ClientID:   input.ClientID,
+			DeliveryID: &deliveryID,
+			EventType:  tables.ExamClientEventFinalResults,
 		}
-		if progress, ok := finalData["progress"].([]interface{}); ok {
-			fmt.Printf("  - %d progress records\n", len(progress))
+	}
+
+	imported, err := h.attemptModel.ImportFinalResults(&results, receipt)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to import final results", err)
+	}
+
+	message := "Final results received and processed"
+	if imported {
+		fmt.Printf("Imported final results of delivery %d: %d attempts, %d answers, %d answer history entries\n",
+			deliveryID, len(results.Attempts), len(results.Answers), len(results.AnswerHistory))
+
+		// The analysis stored when the delivery closed did not have these answers yet
+		if _, err := h.collusion.AnalyzeAndStore(deliveryID); err != nil {
+			fmt.Printf("Failed to store collusion analysis of delivery %d: %v\n", deliveryID, err)
 		}
+	} else {
+		message = "Final results already processed"
 	}
 
 	return &FinalResultsOutput{
@@ -254,72 +400,171 @@ func (h *ExamClientLiveHandler) ReceiveFinalResults(ctx context.Context, input *
 			Message string `json:"message"`
 		}{
 			Success: true,
-			Message: "Final results received and processed",
+			Message: message,
 		},
 	}, nil
 }
 
-// queryExamClientProgress queries the exam-client directly for live progress
-func (h *ExamClientLiveHandler) queryExamClientProgress(deliveryID int) (map[string]interface{}, error) {
-	// TODO: Get exam-client URL from delivery assignment or registry
-	// For now, assume standard port pattern
-	examClientURL := fmt.Sprintf("http://localhost:%d", 8235+deliveryID%100)
+// GetNetworkPolicy returns the network allow-list enforced by exam-clients
+func (h *ExamClientLiveHandler) GetNetworkPolicy(ctx context.Context, input *NetworkPolicyInput) (*NetworkPolicyOutput, error) {
+	if err := h.requireAssignment(ctx, input.DeliveryID); err != nil {
+		return nil, err
+	}
 
-	// Query live progress API
-	url := fmt.Sprintf("%s/api/progress", examClientURL)
-	resp, err := h.httpClient.Get(url)
+	policy, err := h.networkAccess.GetPolicy(input.DeliveryID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query exam-client: %w", err)
+		return nil, huma.Error500InternalServerError("Failed to get network policy", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("exam-client returned status %d", resp.StatusCode)
-	}
+	return &NetworkPolicyOutput{Body: policy}, nil
+}
 
-	var response struct {
-		Success bool                     `json:"success"`
-		Message string                   `json:"message"`
-		Data    []map[string]interface{} `json:"data"`
+// recordAccessDenied stores a request rejected by an exam-client
+func (h *ExamClientLiveHandler) recordAccessDenied(event ExamClientEvent) {
+	violation := &tables.DeliveryAccessViolation{
+		DeliveryID: event.DeliveryID,
+		Source:     "exam_client",
+	}
+	if ip, ok := event.Data["ip_address"].(string); ok {
+		violation.IPAddress = ip
+	}
+	if action, ok := event.Data["action"].(string); ok {
+		violation.Action = action
 	}
+	if participantID, ok := event.Data["participant_id"].(float64); ok {
+		takerID := int(participantID)
+		violation.TakerID = &takerID
+	}
+	if attemptID, ok := event.Data["attempt_id"].(float64); ok {
+		id := int(attemptID)
+		violation.AttemptID = &id
+	}
+
+	h.networkAccess.RecordViolation(violation)
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+// recordHelpRequest adds a help request to the delivery's queue and pushes it to
+// live-monitoring clients
+func (h *ExamClientLiveHandler) recordHelpRequest(event ExamClientEvent) error {
+	participantID, ok := event.Data["participant_id"].(float64)
+	if !ok {
+		return fmt.Errorf("help request without participant")
+	}
+	requestID, ok := event.Data["help_request_id"].(float64)
+	if !ok {
+		return fmt.Errorf("help request without ID")
 	}
 
-	if !response.Success {
-		return nil, fmt.Errorf("exam-client reported error: %s", response.Message)
+	helpEvent := &tables.HelpRequestEvent{
+		DeliveryID:      event.DeliveryID,
+		TakerID:         int(participantID),
+		ClientRequestID: int(requestID),
+		ClientID:        event.ClientID,
+		RequestedAt:     event.Timestamp,
+	}
+	if message, ok := event.Data["message"].(string); ok {
+		helpEvent.Message = message
+	}
+	if requestedAt, ok := event.Data["requested_at"].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, requestedAt); err == nil {
+			helpEvent.RequestedAt = t
+		}
+	}
+	if helpEvent.RequestedAt.IsZero() {
+		helpEvent.RequestedAt = time.Now()
 	}
 
-	// Get delivery stats as well
-	statsURL := fmt.Sprintf("%s/api/delivery-stats", examClientURL)
-	statsResp, err := h.httpClient.Get(statsURL)
+	request, err := h.helpRequestModel.Record(helpEvent)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query delivery stats: %w", err)
+		return err
+	}
+
+	publishHelpRequest(h.wsHub, request)
+	return nil
+}
+
+// publishHelpRequest pushes the current state of a help request to live-monitoring clients
+func publishHelpRequest(wsHub *WebSocketHub, request *tables.HelpRequest) {
+	wsHub.PublishDelta(request.DeliveryID, "help_request", map[string]interface{}{
+		"participant_id": request.TakerID,
+		"help_request":   request,
+	})
+}
+
+// progressDelta converts an exam-client event into the change of one participant's
+// progress row, in the shape of the participants of a snapshot
+func progressDelta(event ExamClientEvent) (map[string]interface{}, bool) {
+	participantID, ok := event.Data["participant_id"]
+	if !ok {
+		return nil, false
+	}
+
+	timestamp := event.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	attempt := map[string]interface{}{
+		"last_activity": timestamp,
+	}
+	if attemptID, ok := event.Data["attempt_id"]; ok {
+		attempt["id"] = attemptID
+	}
+	for _, key := range []string{"questions_answered", "total_questions", "current_score"} {
+		if value, ok := event.Data[key]; ok {
+			attempt[key] = value
+		}
 	}
-	defer statsResp.Body.Close()
 
-	var statsResponse struct {
-		Success bool                   `json:"success"`
-		Data    map[string]interface{} `json:"data"`
+	switch event.EventType {
+	case "participant_started":
+		attempt["status"] = "in_progress"
+		attempt["started_at"] = timestamp
+		attempt["questions_answered"] = 0
+	case "answer_submitted":
+		attempt["status"] = "in_progress"
+	case "participant_completed":
+		attempt["status"] = "completed"
+		attempt["ended_at"] = timestamp
+		if score, ok := event.Data["final_score"]; ok {
+			attempt["current_score"] = score
+		}
+	default:
+		return map[string]interface{}{
+			"participant_id": participantID,
+			"details":        event.Data,
+		}, true
 	}
 
-	if statsResp.StatusCode == http.StatusOK {
-		json.NewDecoder(statsResp.Body).Decode(&statsResponse)
+	return map[string]interface{}{
+		"participant_id": participantID,
+		"attempt":        attempt,
+	}, true
+}
+
+// queryExamClientProgress queries the exam-client directly for live progress
+func (h *ExamClientLiveHandler) queryExamClientProgress(deliveryID int) (map[string]interface{}, error) {
+	participants := []map[string]interface{}{}
+	if err := h.examClients.callDeliveryServer(deliveryID, http.MethodGet, "/api/progress", nil, &participants); err != nil {
+		return nil, fmt.Errorf("failed to query exam-client: %w", err)
 	}
 
+	// Get delivery stats as well
+	stats := map[string]interface{}{}
+	statsErr := h.examClients.callDeliveryServer(deliveryID, http.MethodGet, "/api/delivery-stats", nil, &stats)
+
 	// Combine progress and stats
 	result := map[string]interface{}{
 		"delivery": map[string]interface{}{
 			"id":   deliveryID,
 			"name": fmt.Sprintf("Delivery %d", deliveryID),
 		},
-		"participants": response.Data,
+		"participants": participants,
 	}
 
-	if statsResponse.Success {
+	if statsErr == nil {
 		if deliveryData, ok := result["delivery"].(map[string]interface{}); ok {
-			for key, value := range statsResponse.Data {
+			for key, value := range stats {
 				deliveryData[key] = value
 			}
 		}
@@ -327,3 +572,15 @@ func (h *ExamClientLiveHandler) queryExamClientProgress(deliveryID int) (map[str
 
 	return result, nil
 }
+
+// requireAssignment checks the delivery is assigned to the exam-client that signed the request
+func (h *ExamClientLiveHandler) requireAssignment(ctx context.Context, deliveryID int) error {
+	assigned, err := h.examClients.IsAssigned(deliveryID, middleware.GetExamClientIDFromContext(ctx))
+	if err != nil {
+		return huma.Error500InternalServerError("Failed to check delivery assignment", err)
+	}
+	if !assigned {
+		return huma.Error403Forbidden("Delivery is assigned to another exam client")
+	}
+	return nil
+}
@@ -5,18 +5,22 @@ import (
 	"net/http"
 
 	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
 	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/medxamion/medxamion/internal/middleware"
 )
 
 type GroupHandler struct {
-	groupRepo *models.GroupModel
+	groupRepo    *models.GroupModel
+	clientRepo   *models.ClientModel
+	auditService *services.AuditService
 }
 
-func NewGroupHandler(groupRepo *models.GroupModel) *GroupHandler {
-	return &GroupHandler{groupRepo: groupRepo}
+func NewGroupHandler(groupRepo *models.GroupModel, clientRepo *models.ClientModel, auditService *services.AuditService) *GroupHandler {
+	return &GroupHandler{groupRepo: groupRepo, clientRepo: clientRepo, auditService: auditService}
 }
 
 func (h *GroupHandler) Register(api huma.API) {
@@ -28,6 +32,7 @@ func (h *GroupHandler) Register(api huma.API) {
 		Description: "Get a paginated list of groups with participant count.",
 		Tags:        []string{"Groups"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.ListGroups)
 
 	huma.Register(api, huma.Operation{
@@ -38,6 +43,7 @@ func (h *GroupHandler) Register(api huma.API) {
 		Description: "Get detailed information about a specific group.",
 		Tags:        []string{"Groups"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetGroup)
 
 	huma.Register(api, huma.Operation{
@@ -48,6 +54,7 @@ func (h *GroupHandler) Register(api huma.API) {
 		Description: "Create a new group for organizing candidates.",
 		Tags:        []string{"Groups"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionGroupManage),
 	}, h.CreateGroup)
 
 	huma.Register(api, huma.Operation{
@@ -58,6 +65,7 @@ func (h *GroupHandler) Register(api huma.API) {
 		Description: "Update group information.",
 		Tags:        []string{"Groups"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionGroupManage),
 	}, h.UpdateGroup)
 
 	huma.Register(api, huma.Operation{
@@ -65,11 +73,34 @@ func (h *GroupHandler) Register(api huma.API) {
 		Method:      http.MethodDelete,
 		Path:        "/api/groups/{id}",
 		Summary:     "Delete group",
-		Description: "Delete a group and all its associations.",
+		Description: "Delete a group, keeping its participants. Groups with deliveries cannot be deleted until their deliveries are; deleted groups can be restored.",
 		Tags:        []string{"Groups"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionGroupManage),
 	}, h.DeleteGroup)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "list-deleted-groups",
+		Method:      http.MethodGet,
+		Path:        "/api/groups/deleted",
+		Summary:     "List deleted groups",
+		Description: "Get a paginated list of deleted groups, most recently deleted first.",
+		Tags:        []string{"Groups"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionGroupManage),
+	}, h.ListDeletedGroups)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "restore-group",
+		Method:      http.MethodPost,
+		Path:        "/api/groups/{id}/restore",
+		Summary:     "Restore group",
+		Description: "Restore a deleted group.",
+		Tags:        []string{"Groups"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionGroupManage),
+	}, h.RestoreGroup)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "get-group-takers",
 		Method:      http.MethodGet,
@@ -78,6 +109,7 @@ func (h *GroupHandler) Register(api huma.API) {
 		Description: "Get paginated list of takers in a group.",
 		Tags:        []string{"Groups"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetGroupTakers)
 
 	huma.Register(api, huma.Operation{
@@ -85,9 +117,10 @@ func (h *GroupHandler) Register(api huma.API) {
 		Method:      http.MethodPost,
 		Path:        "/api/groups/{id}/takers",
 		Summary:     "Add taker to group",
-		Description: "Add a taker to a group with auto-generated code.",
+		Description: "Add a taker to a group with a random taker code in the group's format. A taker already in the group gets a new code.",
 		Tags:        []string{"Groups"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionGroupManage),
 	}, h.AddTakerToGroup)
 
 	huma.Register(api, huma.Operation{
@@ -98,7 +131,41 @@ func (h *GroupHandler) Register(api huma.API) {
 		Description: "Remove a taker from a group.",
 		Tags:        []string{"Groups"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionGroupManage),
 	}, h.RemoveTakerFromGroup)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "regenerate-taker-code",
+		Method:      http.MethodPost,
+		Path:        "/api/groups/{id}/takers/{taker_id}/code",
+		Summary:     "Regenerate taker code",
+		Description: "Give a taker of a group a new taker code. The old code no longer logs in.",
+		Tags:        []string{"Groups"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionGroupManage),
+	}, h.RegenerateTakerCode)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "revoke-taker-code",
+		Method:      http.MethodDelete,
+		Path:        "/api/groups/{id}/takers/{taker_id}/code",
+		Summary:     "Revoke taker code",
+		Description: "Remove the taker code of a taker of a group, who cannot log in with a code until a new one is generated.",
+		Tags:        []string{"Groups"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionGroupManage),
+	}, h.RevokeTakerCode)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "regenerate-group-taker-codes",
+		Method:      http.MethodPost,
+		Path:        "/api/groups/{id}/taker-codes",
+		Summary:     "Regenerate all taker codes",
+		Description: "Give every taker of a group a new taker code, for example to replace sequential codes issued before codes were random.",
+		Tags:        []string{"Groups"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionGroupManage),
+	}, h.RegenerateTakerCodes)
 }
 
 // List Groups
@@ -113,17 +180,12 @@ type ListGroupsOutput struct {
 }
 
 func (h *GroupHandler) ListGroups(ctx context.Context, input *ListGroupsInput) (*ListGroupsOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	pagination := tables.Pagination{
 		Page:    input.Page,
 		PerPage: input.PerPage,
 	}
 
-	result, err := h.groupRepo.List(pagination, input.Search)
+	result, err := h.groupRepo.List(clientScope(ctx), pagination, input.Search)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to get groups", err)
 	}
@@ -141,12 +203,7 @@ type GetGroupOutput struct {
 }
 
 func (h *GroupHandler) GetGroup(ctx context.Context, input *GetGroupInput) (*GetGroupOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	group, err := h.groupRepo.GetByID(input.ID)
+	group, err := h.groupRepo.GetByID(clientScope(ctx), input.ID)
 	if err != nil {
 		return nil, huma.Error404NotFound("Group not found")
 	}
@@ -168,36 +225,39 @@ type CreateGroupOutput struct {
 }
 
 func (h *GroupHandler) CreateGroup(ctx context.Context, input *CreateGroupInput) (*CreateGroupOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
+	// The taker code format defaults to the one of the client
+	client, err := h.clientRepo.GetByID(middleware.GetSessionDataFromContext(ctx).ClientID)
+	if err != nil {
+		if err.Error() == "client not found" {
+			return nil, huma.Error400BadRequest("No client selected")
 		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+		return nil, huma.Error500InternalServerError("Failed to get client", err)
 	}
 
 	group := &tables.Group{
-		Name:          input.Body.Name,
-		Description:   input.Body.Description,
-		Code:          input.Body.Code,
-		LastTakerCode: 1, // Start from 1
-		ClientID:      2, // Default client ID as seen in database
+		Name:            input.Body.Name,
+		Description:     input.Body.Description,
+		Code:            input.Body.Code,
+		LastTakerCode:   1, // Start from 1
+		TakerCodeFormat: client.TakerCodeFormat,
+	}
+	if input.Body.TakerCodePrefix != nil {
+		group.TakerCodePrefix = *input.Body.TakerCodePrefix
+	}
+	if input.Body.TakerCodeLength != nil {
+		group.TakerCodeLength = *input.Body.TakerCodeLength
+	}
+	if input.Body.TakerCodeGroupSize != nil {
+		group.TakerCodeGroupSize = *input.Body.TakerCodeGroupSize
 	}
 
-	err := h.groupRepo.Create(group)
+	err = h.groupRepo.Create(clientScope(ctx), group)
 	if err != nil {
-		return nil, huma.Error500InternalServerError("Failed to create group", err)
+		return nil, createInClientError(err, "Failed to create group")
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityGroup, group.ID, nil, group)
+
 	return &CreateGroupOutput{
 		Body: struct {
 			Success bool          `json:"success"`
@@ -226,28 +286,24 @@ type UpdateGroupOutput struct {
 }
 
 func (h *GroupHandler) UpdateGroup(ctx context.Context, input *UpdateGroupInput) (*UpdateGroupOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
+	before, err := h.groupRepo.GetByID(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "group not found" {
+			return nil, huma.Error404NotFound("Group not found")
 		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+		return nil, huma.Error500InternalServerError("Failed to get group", err)
 	}
 
-	group, err := h.groupRepo.Update(input.ID, &input.Body)
+	group, err := h.groupRepo.Update(clientScope(ctx), input.ID, &input.Body)
 	if err != nil {
+		if err.Error() == "group not found" {
+			return nil, huma.Error404NotFound("Group not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to update group", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityGroup, group.ID, before, group)
+
 	return &UpdateGroupOutput{
 		Body: struct {
 			Success bool          `json:"success"`
@@ -274,28 +330,27 @@ type DeleteGroupOutput struct {
 }
 
 func (h *GroupHandler) DeleteGroup(ctx context.Context, input *DeleteGroupInput) (*DeleteGroupOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
+	before, err := h.groupRepo.GetByID(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "group not found" {
+			return nil, huma.Error404NotFound("Group not found")
 		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+		return nil, huma.Error500InternalServerError("Failed to get group", err)
 	}
 
-	err := h.groupRepo.Delete(input.ID)
+	err = h.groupRepo.Delete(clientScope(ctx), input.ID)
 	if err != nil {
+		if err.Error() == "group not found" {
+			return nil, huma.Error404NotFound("Group not found")
+		}
+		if err.Error() == "group has deliveries" {
+			return nil, huma.Error409Conflict("Group has deliveries; delete them first")
+		}
 		return nil, huma.Error500InternalServerError("Failed to delete group", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityGroup, input.ID, before, nil)
+
 	return &DeleteGroupOutput{
 		Body: struct {
 			Success bool   `json:"success"`
@@ -307,6 +362,75 @@ func (h *GroupHandler) DeleteGroup(ctx context.Context, input *DeleteGroupInput)
 	}, nil
 }
 
+// List Deleted Groups
+type ListDeletedGroupsInput struct {
+	Page    int `query:"page" default:"1" minimum:"1"`
+	PerPage int `query:"per_page" default:"15" minimum:"1" maximum:"100"`
+}
+
+type ListDeletedGroupsOutput struct {
+	Body tables.PaginatedResponse `json:"body"`
+}
+
+func (h *GroupHandler) ListDeletedGroups(ctx context.Context, input *ListDeletedGroupsInput) (*ListDeletedGroupsOutput, error) {
+	pagination := tables.Pagination{
+		Page:    input.Page,
+		PerPage: input.PerPage,
+	}
+
+	result, err := h.groupRepo.ListDeleted(clientScope(ctx), pagination)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get deleted groups", err)
+	}
+
+	return &ListDeletedGroupsOutput{Body: *result}, nil
+}
+
+// Restore Group
+type RestoreGroupInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type RestoreGroupOutput struct {
+	Body struct {
+		Success bool          `json:"success"`
+		Message string        `json:"message"`
+		Group   *tables.Group `json:"group,omitempty"`
+	} `json:"body"`
+}
+
+func (h *GroupHandler) RestoreGroup(ctx context.Context, input *RestoreGroupInput) (*RestoreGroupOutput, error) {
+	before, err := h.groupRepo.GetDeleted(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "group not found" {
+			return nil, huma.Error404NotFound("Deleted group not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to get deleted group", err)
+	}
+
+	group, err := h.groupRepo.Restore(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "group not found" {
+			return nil, huma.Error404NotFound("Deleted group not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to restore group", err)
+	}
+
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityGroup, input.ID, before, group)
+
+	return &RestoreGroupOutput{
+		Body: struct {
+			Success bool          `json:"success"`
+			Message string        `json:"message"`
+			Group   *tables.Group `json:"group,omitempty"`
+		}{
+			Success: true,
+			Message: "Group restored successfully",
+			Group:   group,
+		},
+	}, nil
+}
+
 // Get Group Takers
 type GetGroupTakersInput struct {
 	ID      int `path:"id" minimum:"1"`
@@ -319,18 +443,16 @@ type GetGroupTakersOutput struct {
 }
 
 func (h *GroupHandler) GetGroupTakers(ctx context.Context, input *GetGroupTakersInput) (*GetGroupTakersOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	pagination := tables.Pagination{
 		Page:    input.Page,
 		PerPage: input.PerPage,
 	}
 
-	result, err := h.groupRepo.GetGroupTakers(input.ID, pagination)
+	result, err := h.groupRepo.GetGroupTakers(clientScope(ctx), input.ID, pagination)
 	if err != nil {
+		if err.Error() == "group not found" {
+			return nil, huma.Error404NotFound("Group not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to get group takers", err)
 	}
 
@@ -354,35 +476,25 @@ type AddTakerToGroupOutput struct {
 }
 
 func (h *GroupHandler) AddTakerToGroup(ctx context.Context, input *AddTakerToGroupInput) (*AddTakerToGroupOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
-	}
-
-	// Generate next taker code
-	code, err := h.groupRepo.GenerateNextTakerCode(input.ID)
+	group, err := h.groupRepo.GetByID(clientScope(ctx), input.ID)
 	if err != nil {
-		return nil, huma.Error500InternalServerError("Failed to generate taker code", err)
+		return nil, huma.Error404NotFound("Group not found")
 	}
 
-	// Add taker to group
-	err = h.groupRepo.AddTaker(input.ID, input.Body.TakerID, code)
+	// Add taker to group with a new taker code
+	code, err := h.groupRepo.AddTaker(clientScope(ctx), input.ID, input.Body.TakerID)
 	if err != nil {
+		if err.Error() == "group not found" {
+			return nil, huma.Error404NotFound("Group not found")
+		}
+		if err.Error() == "participant not found" {
+			return nil, huma.Error400BadRequest("Participant not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to add taker to group", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityGroup, input.ID, auditNoLink, auditLink("takers", input.Body.TakerID, true))
+
 	return &AddTakerToGroupOutput{
 		Body: struct {
 			Success bool   `json:"success"`
@@ -391,7 +503,7 @@ func (h *GroupHandler) AddTakerToGroup(ctx context.Context, input *AddTakerToGro
 		}{
 			Success: true,
 			Message: "Taker added to group successfully",
-			Code:    code,
+			Code:    utils.FormatTakerCode(code, group.TakerCodeGroupSize),
 		},
 	}, nil
 }
@@ -410,35 +522,116 @@ type RemoveTakerFromGroupOutput struct {
 }
 
 func (h *GroupHandler) RemoveTakerFromGroup(ctx context.Context, input *RemoveTakerFromGroupInput) (*RemoveTakerFromGroupOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
+	err := h.groupRepo.RemoveTaker(clientScope(ctx), input.ID, input.TakerID)
+	if err != nil {
+		if err.Error() == "group not found" {
+			return nil, huma.Error404NotFound("Group not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to remove taker from group", err)
+	}
+
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityGroup, input.ID, auditLink("takers", input.TakerID, true), auditNoLink)
+
+	return &RemoveTakerFromGroupOutput{
+		Body: struct {
+			Success bool   `json:"success"`
+			Message string `json:"message"`
+		}{
+			Success: true,
+			Message: "Taker removed from group successfully",
+		},
+	}, nil
+}
+
+// Regenerate Taker Code
+type TakerCodeInput struct {
+	ID      int `path:"id" minimum:"1"`
+	TakerID int `path:"taker_id" minimum:"1"`
+}
+
+type TakerCodeOutput struct {
+	Body tables.TakerCodeResponse `json:"body"`
+}
+
+func (h *GroupHandler) RegenerateTakerCode(ctx context.Context, input *TakerCodeInput) (*TakerCodeOutput, error) {
+	group, err := h.groupRepo.GetByID(clientScope(ctx), input.ID)
+	if err != nil {
+		return nil, huma.Error404NotFound("Group not found")
 	}
 
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
+	code, err := h.groupRepo.RegenerateTakerCode(clientScope(ctx), input.ID, input.TakerID)
+	if err != nil {
+		if err.Error() == "taker not in group" {
+			return nil, huma.Error404NotFound("Taker is not in this group")
 		}
+		return nil, huma.Error500InternalServerError("Failed to regenerate taker code", err)
 	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityGroup, input.ID, auditNoLink, auditLink("taker_codes", input.TakerID, "regenerated"))
+
+	return &TakerCodeOutput{
+		Body: tables.TakerCodeResponse{
+			Success: true,
+			Message: "Taker code regenerated",
+			Code:    utils.FormatTakerCode(code, group.TakerCodeGroupSize),
+		},
+	}, nil
+}
+
+// Revoke Taker Code
+func (h *GroupHandler) RevokeTakerCode(ctx context.Context, input *TakerCodeInput) (*TakerCodeOutput, error) {
+	err := h.groupRepo.RevokeTakerCode(clientScope(ctx), input.ID, input.TakerID)
+	if err != nil {
+		if err.Error() == "group not found" {
+			return nil, huma.Error404NotFound("Group not found")
+		}
+		if err.Error() == "taker not in group" {
+			return nil, huma.Error404NotFound("Taker is not in this group")
+		}
+		return nil, huma.Error500InternalServerError("Failed to revoke taker code", err)
 	}
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityGroup, input.ID, auditNoLink, auditLink("taker_codes", input.TakerID, "revoked"))
 
-	err := h.groupRepo.RemoveTaker(input.ID, input.TakerID)
+	return &TakerCodeOutput{
+		Body: tables.TakerCodeResponse{
+			Success: true,
+			Message: "Taker code revoked",
+		},
+	}, nil
+}
+
+// Regenerate Taker Codes
+type RegenerateTakerCodesInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type RegenerateTakerCodesOutput struct {
+	Body struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+		Count   int    `json:"count" doc:"How many taker codes were replaced"`
+	} `json:"body"`
+}
+
+func (h *GroupHandler) RegenerateTakerCodes(ctx context.Context, input *RegenerateTakerCodesInput) (*RegenerateTakerCodesOutput, error) {
+	if _, err := h.groupRepo.GetByID(clientScope(ctx), input.ID); err != nil {
+		return nil, huma.Error404NotFound("Group not found")
+	}
+
+	count, err := h.groupRepo.RegenerateTakerCodes(clientScope(ctx), input.ID)
 	if err != nil {
-		return nil, huma.Error500InternalServerError("Failed to remove taker from group", err)
+		return nil, huma.Error500InternalServerError("Failed to regenerate taker codes", err)
 	}
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityGroup, input.ID, auditNoLink, auditAction("taker_codes", map[string]int{"regenerated": count}))
 
-	return &RemoveTakerFromGroupOutput{
+	return &RegenerateTakerCodesOutput{
 		Body: struct {
 			Success bool   `json:"success"`
 			Message string `json:"message"`
+			Count   int    `json:"count" doc:"How many taker codes were replaced"`
 		}{
 			Success: true,
-			Message: "Taker removed from group successfully",
+			Message: "Taker codes regenerated",
+			Count:   count,
 		},
 	}, nil
 }
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// HelpRequestHandler manages the queue of participant help requests of a delivery
+type HelpRequestHandler struct {
+	helpRequestRepo *models.HelpRequestModel
+	assignmentRepo  *models.DeliveryAssignmentModel
+	examClients     *ExamClientHandler
+	wsHub           *WebSocketHub
+}
+
+func NewHelpRequestHandler(helpRequestRepo *models.HelpRequestModel, assignmentRepo *models.DeliveryAssignmentModel, examClients *ExamClientHandler, wsHub *WebSocketHub) *HelpRequestHandler {
+	return &HelpRequestHandler{
+		helpRequestRepo: helpRequestRepo,
+		assignmentRepo:  assignmentRepo,
+		examClients:     examClients,
+		wsHub:           wsHub,
+	}
+}
+
+func (h *HelpRequestHandler) Register(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "list-help-requests",
+		Method:      http.MethodGet,
+		Path:        "/api/deliveries/{id}/help-requests",
+		Summary:     "List participant help requests",
+		Description: "List the help requests of a delivery in queue order with the time each participant waited and lost.",
+		Tags:        []string{"Live Progress"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.ListHelpRequests)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "claim-help-request",
+		Method:      http.MethodPost,
+		Path:        "/api/deliveries/{id}/help-requests/{requestId}/claim",
+		Summary:     "Claim help request",
+		Description: "Take an open help request so other proctors know it is handled. The participant is told a proctor is coming.",
+		Tags:        []string{"Live Progress"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.ClaimHelpRequest)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "resolve-help-request",
+		Method:      http.MethodPost,
+		Path:        "/api/deliveries/{id}/help-requests/{requestId}/resolve",
+		Summary:     "Resolve help request",
+		Description: "Close a help request, optionally granting the participant extra minutes for the time lost.",
+		Tags:        []string{"Live Progress"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.ResolveHelpRequest)
+}
+
+// List Help Requests
+type ListHelpRequestsInput struct {
+	ID     int    `path:"id" minimum:"1"`
+	Status string `query:"status" enum:"open,claimed,resolved" doc:"Only requests with this status"`
+}
+
+type ListHelpRequestsOutput struct {
+	Body []tables.HelpRequest `json:"body"`
+}
+
+func (h *HelpRequestHandler) ListHelpRequests(ctx context.Context, input *ListHelpRequestsInput) (*ListHelpRequestsOutput, error) {
+	if _, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID); err != nil {
+		return nil, err
+	}
+
+	requests, err := h.helpRequestRepo.List(input.ID, input.Status)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get help requests", err)
+	}
+
+	return &ListHelpRequestsOutput{Body: requests}, nil
+}
+
+// Claim Help Request
+type ClaimHelpRequestInput struct {
+	ID        int `path:"id" minimum:"1"`
+	RequestID int `path:"requestId" minimum:"1"`
+}
+
+type HelpRequestOutput struct {
+	Body struct {
+		Success     bool                `json:"success"`
+		Message     string              `json:"message"`
+		HelpRequest *tables.HelpRequest `json:"help_request,omitempty"`
+	} `json:"body"`
+}
+
+func (h *HelpRequestHandler) ClaimHelpRequest(ctx context.Context, input *ClaimHelpRequestInput) (*HelpRequestOutput, error) {
+	sessionData, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := h.helpRequestRepo.Claim(input.ID, input.RequestID, sessionData.UserID)
+	if err != nil {
+		return nil, helpRequestError(err, "Failed to claim help request")
+	}
+
+	publishHelpRequest(h.wsHub, request)
+	h.notifyParticipant(request, proctorName(sessionData))
+
+	return newHelpRequestOutput("Help request claimed", request), nil
+}
+
+// Resolve Help Request
+type ResolveHelpRequestInput struct {
+	ID        int                              `path:"id" minimum:"1"`
+	RequestID int                              `path:"requestId" minimum:"1"`
+	Body      tables.ResolveHelpRequestRequest `json:"body"`
+}
+
+func (h *HelpRequestHandler) ResolveHelpRequest(ctx context.Context, input *ResolveHelpRequestInput) (*HelpRequestOutput, error) {
+	sessionData, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := h.helpRequestRepo.Resolve(input.ID, input.RequestID, sessionData.UserID, &input.Body)
+	if err != nil {
+		return nil, helpRequestError(err, "Failed to resolve help request")
+	}
+
+	sentBy := proctorName(sessionData)
+	publishHelpRequest(h.wsHub, request)
+	h.notifyParticipant(request, sentBy)
+
+	message := "Help request resolved"
+	if request.ExtraMinutes > 0 {
+		if err := h.grantExtraTime(request, sentBy); err != nil {
+			log.Printf("Failed to grant extra time for help request %d: %v", request.ID, err)
+			message = "Help request resolved, but the extra time could not be sent to the exam-client"
+		}
+	}
+
+	return newHelpRequestOutput(message, request), nil
+}
+
+// notifyParticipant tells the exam-client that a help request was claimed or resolved. The
+// queue on the coordinator is authoritative, so a failure is only logged.
+func (h *HelpRequestHandler) notifyParticipant(request *tables.HelpRequest, by string) {
+	payload, err := json.Marshal(tables.HelpRequestStatusUpdate{Status: request.Status, By: by})
+	if err != nil {
+		return
+	}
+
+	path := fmt.Sprintf("/api/help/%d/status", request.ClientRequestID)
+	if err := h.examClients.callDeliveryServer(request.DeliveryID, http.MethodPost, path, payload, nil); err != nil {
+		log.Printf("Failed to update help request %d on exam-client: %v", request.ID, err)
+	}
+}
+
+// grantExtraTime sends the extra minutes of a resolved help request as a time extension
+func (h *HelpRequestHandler) grantExtraTime(request *tables.HelpRequest, sentBy string) error {
+	payload, err := json.Marshal(tables.ProctorMessageDispatch{
+		ProctorMessageRequest: tables.ProctorMessageRequest{
+			Kind:           tables.ProctorMessageTimeExtension,
+			Message:        fmt.Sprintf("You have been given %d extra minutes for the time lost.", request.ExtraMinutes),
+			Minutes:        request.ExtraMinutes,
+			ParticipantIDs: []int{request.TakerID},
+		},
+		SentBy: sentBy,
+	})
+	if err != nil {
+		return err
+	}
+
+	return h.examClients.callDeliveryServer(request.DeliveryID, http.MethodPost, "/api/messages", payload, nil)
+}
+
+func newHelpRequestOutput(message string, request *tables.HelpRequest) *HelpRequestOutput {
+	return &HelpRequestOutput{
+		Body: struct {
+			Success     bool                `json:"success"`
+			Message     string              `json:"message"`
+			HelpRequest *tables.HelpRequest `json:"help_request,omitempty"`
+		}{
+			Success:     true,
+			Message:     message,
+			HelpRequest: request,
+		},
+	}
+}
+
+func helpRequestError(err error, message string) error {
+	switch {
+	case err.Error() == "help request not found":
+		return huma.Error404NotFound("Help request not found")
+	case strings.HasPrefix(err.Error(), "help request already"):
+		return huma.Error409Conflict(strings.ToUpper(err.Error()[:1]) + err.Error()[1:])
+	default:
+		return huma.Error500InternalServerError(message, err)
+	}
+}
+
+// proctorName is the name shown to participants for a proctor
+func proctorName(sessionData *tables.SessionData) string {
+	if sessionData.Name != "" {
+		return sessionData.Name
+	}
+	return sessionData.Username
+}
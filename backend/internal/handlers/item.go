@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
 	"github.com/medxamion/medxamion/internal/tables"
 
 	"github.com/danielgtaylor/huma/v2"
@@ -12,11 +13,12 @@ import (
 )
 
 type ItemHandler struct {
-	itemRepo *models.ItemModel
+	itemRepo     *models.ItemModel
+	auditService *services.AuditService
 }
 
-func NewItemHandler(itemRepo *models.ItemModel) *ItemHandler {
-	return &ItemHandler{itemRepo: itemRepo}
+func NewItemHandler(itemRepo *models.ItemModel, auditService *services.AuditService) *ItemHandler {
+	return &ItemHandler{itemRepo: itemRepo, auditService: auditService}
 }
 
 func (h *ItemHandler) Register(api huma.API) {
@@ -28,6 +30,7 @@ func (h *ItemHandler) Register(api huma.API) {
 		Description: "Get a paginated list of question sets with search and filtering.",
 		Tags:        []string{"Items"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.ListItems)
 
 	huma.Register(api, huma.Operation{
@@ -38,6 +41,7 @@ func (h *ItemHandler) Register(api huma.API) {
 		Description: "Get detailed information about a specific question set.",
 		Tags:        []string{"Items"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetItem)
 
 	huma.Register(api, huma.Operation{
@@ -48,6 +52,7 @@ func (h *ItemHandler) Register(api huma.API) {
 		Description: "Get a question set with all its questions included.",
 		Tags:        []string{"Items"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetItemWithQuestions)
 
 	huma.Register(api, huma.Operation{
@@ -58,6 +63,7 @@ func (h *ItemHandler) Register(api huma.API) {
 		Description: "Create a new question set (item).",
 		Tags:        []string{"Items"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionItemManage),
 	}, h.CreateItem)
 
 	huma.Register(api, huma.Operation{
@@ -68,6 +74,7 @@ func (h *ItemHandler) Register(api huma.API) {
 		Description: "Update question set information.",
 		Tags:        []string{"Items"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionItemManage),
 	}, h.UpdateItem)
 
 	huma.Register(api, huma.Operation{
@@ -75,11 +82,34 @@ func (h *ItemHandler) Register(api huma.API) {
 		Method:      http.MethodDelete,
 		Path:        "/api/items/{id}",
 		Summary:     "Delete question set",
-		Description: "Delete a question set and all its questions.",
+		Description: "Delete a question set with its questions. Question sets in an exam cannot be deleted; deleted question sets can be restored.",
 		Tags:        []string{"Items"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionItemManage),
 	}, h.DeleteItem)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "list-deleted-items",
+		Method:      http.MethodGet,
+		Path:        "/api/items/deleted",
+		Summary:     "List deleted question sets",
+		Description: "Get a paginated list of deleted question sets, most recently deleted first.",
+		Tags:        []string{"Items"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionItemManage),
+	}, h.ListDeletedItems)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "restore-item",
+		Method:      http.MethodPost,
+		Path:        "/api/items/{id}/restore",
+		Summary:     "Restore question set",
+		Description: "Restore a deleted question set.",
+		Tags:        []string{"Items"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionItemManage),
+	}, h.RestoreItem)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "get-item-questions",
 		Method:      http.MethodGet,
@@ -88,6 +118,7 @@ func (h *ItemHandler) Register(api huma.API) {
 		Description: "Get paginated list of questions in a question set.",
 		Tags:        []string{"Items"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetItemQuestions)
 
 	huma.Register(api, huma.Operation{
@@ -98,6 +129,7 @@ func (h *ItemHandler) Register(api huma.API) {
 		Description: "Get all categories that a question set belongs to.",
 		Tags:        []string{"Items"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetItemCategories)
 }
 
@@ -115,11 +147,6 @@ type ListItemsOutput struct {
 }
 
 func (h *ItemHandler) ListItems(ctx context.Context, input *ListItemsInput) (*ListItemsOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	pagination := tables.Pagination{
 		Page:    input.Page,
 		PerPage: input.PerPage,
@@ -140,7 +167,7 @@ func (h *ItemHandler) ListItems(ctx context.Context, input *ListItemsInput) (*Li
 		IsVignette: isVignette,
 	}
 
-	result, err := h.itemRepo.List(pagination, search)
+	result, err := h.itemRepo.List(clientScope(ctx), pagination, search)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to get items", err)
 	}
@@ -158,12 +185,7 @@ type GetItemOutput struct {
 }
 
 func (h *ItemHandler) GetItem(ctx context.Context, input *GetItemInput) (*GetItemOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	item, err := h.itemRepo.GetByID(input.ID)
+	item, err := h.itemRepo.GetByID(clientScope(ctx), input.ID)
 	if err != nil {
 		return nil, huma.Error404NotFound("Item not found")
 	}
@@ -181,12 +203,7 @@ type GetItemWithQuestionsOutput struct {
 }
 
 func (h *ItemHandler) GetItemWithQuestions(ctx context.Context, input *GetItemWithQuestionsInput) (*GetItemWithQuestionsOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	item, err := h.itemRepo.GetItemWithQuestions(input.ID)
+	item, err := h.itemRepo.GetItemWithQuestions(clientScope(ctx), input.ID)
 	if err != nil {
 		return nil, huma.Error404NotFound("Item not found")
 	}
@@ -208,24 +225,6 @@ type CreateItemOutput struct {
 }
 
 func (h *ItemHandler) CreateItem(ctx context.Context, input *CreateItemInput) (*CreateItemOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
-	}
-
-	clientID := 2 // Default client ID
 	item := &tables.Item{
 		Title:      input.Body.Title,
 		Content:    input.Body.Content,
@@ -233,14 +232,15 @@ func (h *ItemHandler) CreateItem(ctx context.Context, input *CreateItemInput) (*
 		IsVignette: input.Body.IsVignette,
 		IsRandom:   input.Body.IsRandom,
 		Score:      input.Body.Score,
-		ClientID:   &clientID,
 	}
 
-	err := h.itemRepo.Create(item)
+	err := h.itemRepo.Create(clientScope(ctx), item)
 	if err != nil {
-		return nil, huma.Error500InternalServerError("Failed to create item", err)
+		return nil, createInClientError(err, "Failed to create item")
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityItem, item.ID, nil, item)
+
 	return &CreateItemOutput{
 		Body: struct {
 			Success bool         `json:"success"`
@@ -269,28 +269,24 @@ type UpdateItemOutput struct {
 }
 
 func (h *ItemHandler) UpdateItem(ctx context.Context, input *UpdateItemInput) (*UpdateItemOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
+	before, err := h.itemRepo.GetByID(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "item not found" {
+			return nil, huma.Error404NotFound("Item not found")
 		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+		return nil, huma.Error500InternalServerError("Failed to get item", err)
 	}
 
-	item, err := h.itemRepo.Update(input.ID, &input.Body)
+	item, err := h.itemRepo.Update(clientScope(ctx), input.ID, &input.Body)
 	if err != nil {
+		if err.Error() == "item not found" {
+			return nil, huma.Error404NotFound("Item not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to update item", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityItem, item.ID, before, item)
+
 	return &UpdateItemOutput{
 		Body: struct {
 			Success bool         `json:"success"`
@@ -317,28 +313,27 @@ type DeleteItemOutput struct {
 }
 
 func (h *ItemHandler) DeleteItem(ctx context.Context, input *DeleteItemInput) (*DeleteItemOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
+	before, err := h.itemRepo.GetByID(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "item not found" {
+			return nil, huma.Error404NotFound("Item not found")
 		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+		return nil, huma.Error500InternalServerError("Failed to get item", err)
 	}
 
-	err := h.itemRepo.Delete(input.ID)
+	err = h.itemRepo.Delete(clientScope(ctx), input.ID)
 	if err != nil {
+		if err.Error() == "item not found" {
+			return nil, huma.Error404NotFound("Item not found")
+		}
+		if err.Error() == "item is in an exam" {
+			return nil, huma.Error409Conflict("Question set is in an exam; remove it from the exam first")
+		}
 		return nil, huma.Error500InternalServerError("Failed to delete item", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityItem, input.ID, before, nil)
+
 	return &DeleteItemOutput{
 		Body: struct {
 			Success bool   `json:"success"`
@@ -350,6 +345,75 @@ func (h *ItemHandler) DeleteItem(ctx context.Context, input *DeleteItemInput) (*
 	}, nil
 }
 
+// List Deleted Items
+type ListDeletedItemsInput struct {
+	Page    int `query:"page" default:"1" minimum:"1"`
+	PerPage int `query:"per_page" default:"15" minimum:"1" maximum:"100"`
+}
+
+type ListDeletedItemsOutput struct {
+	Body tables.PaginatedResponse `json:"body"`
+}
+
+func (h *ItemHandler) ListDeletedItems(ctx context.Context, input *ListDeletedItemsInput) (*ListDeletedItemsOutput, error) {
+	pagination := tables.Pagination{
+		Page:    input.Page,
+		PerPage: input.PerPage,
+	}
+
+	result, err := h.itemRepo.ListDeleted(clientScope(ctx), pagination)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get deleted question sets", err)
+	}
+
+	return &ListDeletedItemsOutput{Body: *result}, nil
+}
+
+// Restore Item
+type RestoreItemInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type RestoreItemOutput struct {
+	Body struct {
+		Success bool         `json:"success"`
+		Message string       `json:"message"`
+		Item    *tables.Item `json:"item,omitempty"`
+	} `json:"body"`
+}
+
+func (h *ItemHandler) RestoreItem(ctx context.Context, input *RestoreItemInput) (*RestoreItemOutput, error) {
+	before, err := h.itemRepo.GetDeleted(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "item not found" {
+			return nil, huma.Error404NotFound("Deleted question set not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to get deleted question set", err)
+	}
+
+	item, err := h.itemRepo.Restore(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "item not found" {
+			return nil, huma.Error404NotFound("Deleted question set not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to restore question set", err)
+	}
+
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityItem, input.ID, before, item)
+
+	return &RestoreItemOutput{
+		Body: struct {
+			Success bool         `json:"success"`
+			Message string       `json:"message"`
+			Item    *tables.Item `json:"item,omitempty"`
+		}{
+			Success: true,
+			Message: "Question set restored successfully",
+			Item:    item,
+		},
+	}, nil
+}
+
 // Get Item Questions
 type GetItemQuestionsInput struct {
 	ID      int `path:"id" minimum:"1"`
@@ -362,18 +426,16 @@ type GetItemQuestionsOutput struct {
 }
 
 func (h *ItemHandler) GetItemQuestions(ctx context.Context, input *GetItemQuestionsInput) (*GetItemQuestionsOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	pagination := tables.Pagination{
 		Page:    input.Page,
 		PerPage: input.PerPage,
 	}
 
-	result, err := h.itemRepo.GetItemQuestions(input.ID, pagination)
+	result, err := h.itemRepo.GetItemQuestions(clientScope(ctx), input.ID, pagination)
 	if err != nil {
+		if err.Error() == "item not found" {
+			return nil, huma.Error404NotFound("Item not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to get item questions", err)
 	}
 
@@ -390,12 +452,7 @@ type GetItemCategoriesOutput struct {
 }
 
 func (h *ItemHandler) GetItemCategories(ctx context.Context, input *GetItemCategoriesInput) (*GetItemCategoriesOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	categories, err := h.itemRepo.GetItemCategories(input.ID)
+	categories, err := h.itemRepo.GetItemCategories(clientScope(ctx), input.ID)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to get item categories", err)
 	}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/services"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// LoginSecurityHandler lets admins see and clear login lockouts, and see and acknowledge the
+// security alerts raised by suspicious login patterns
+type LoginSecurityHandler struct {
+	loginProtection *services.LoginProtectionService
+}
+
+func NewLoginSecurityHandler(loginProtection *services.LoginProtectionService) *LoginSecurityHandler {
+	return &LoginSecurityHandler{
+		loginProtection: loginProtection,
+	}
+}
+
+func (h *LoginSecurityHandler) Register(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "list-login-lockouts",
+		Method:      http.MethodGet,
+		Path:        "/api/security/lockouts",
+		Summary:     "List login lockouts",
+		Description: "Get the accounts and IP addresses that are locked out or have to wait before their next login attempt.",
+		Tags:        []string{"Security"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionSecurityManage),
+	}, h.ListLockouts)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "clear-login-lockout",
+		Method:      http.MethodDelete,
+		Path:        "/api/security/lockouts/{id}",
+		Summary:     "Clear login lockout",
+		Description: "Reset the failed logins of an account or IP address so it can log in again right away.",
+		Tags:        []string{"Security"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionSecurityManage),
+	}, h.ClearLockout)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-security-alerts",
+		Method:      http.MethodGet,
+		Path:        "/api/security/alerts",
+		Summary:     "List security alerts",
+		Description: "Get the most recent alerts raised by lockouts and suspicious login patterns.",
+		Tags:        []string{"Security"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionSecurityManage),
+	}, h.ListAlerts)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "acknowledge-security-alert",
+		Method:      http.MethodPost,
+		Path:        "/api/security/alerts/{id}/acknowledge",
+		Summary:     "Acknowledge security alert",
+		Description: "Mark a security alert as handled.",
+		Tags:        []string{"Security"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionSecurityManage),
+	}, h.AcknowledgeAlert)
+}
+
+// List Lockouts
+type ListLoginLockoutsOutput struct {
+	Body []tables.LoginThrottle `json:"body"`
+}
+
+func (h *LoginSecurityHandler) ListLockouts(ctx context.Context, input *struct{}) (*ListLoginLockoutsOutput, error) {
+	lockouts, err := h.loginProtection.ListLockouts()
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get login lockouts", err)
+	}
+	return &ListLoginLockoutsOutput{Body: lockouts}, nil
+}
+
+// Clear Lockout
+type ClearLoginLockoutInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type ClearLoginLockoutOutput struct {
+	Body struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	} `json:"body"`
+}
+
+func (h *LoginSecurityHandler) ClearLockout(ctx context.Context, input *ClearLoginLockoutInput) (*ClearLoginLockoutOutput, error) {
+	err := h.loginProtection.ClearLockout(input.ID)
+	if err != nil {
+		if err.Error() == "login lockout not found" {
+			return nil, huma.Error404NotFound("Login lockout not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to clear login lockout", err)
+	}
+
+	return &ClearLoginLockoutOutput{
+		Body: struct {
+			Success bool   `json:"success"`
+			Message string `json:"message"`
+		}{
+			Success: true,
+			Message: "Login lockout cleared",
+		},
+	}, nil
+}
+
+// List Alerts
+type ListSecurityAlertsInput struct {
+	Unacknowledged bool `query:"unacknowledged" doc:"Only return alerts nobody acknowledged yet"`
+	Limit          int  `query:"limit" default:"100" minimum:"1" maximum:"500"`
+}
+
+type ListSecurityAlertsOutput struct {
+	Body []tables.SecurityAlert `json:"body"`
+}
+
+func (h *LoginSecurityHandler) ListAlerts(ctx context.Context, input *ListSecurityAlertsInput) (*ListSecurityAlertsOutput, error) {
+	alerts, err := h.loginProtection.ListAlerts(input.Unacknowledged, input.Limit)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get security alerts", err)
+	}
+	return &ListSecurityAlertsOutput{Body: alerts}, nil
+}
+
+// Acknowledge Alert
+type AcknowledgeSecurityAlertInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type AcknowledgeSecurityAlertOutput struct {
+	Body struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	} `json:"body"`
+}
+
+func (h *LoginSecurityHandler) AcknowledgeAlert(ctx context.Context, input *AcknowledgeSecurityAlertInput) (*AcknowledgeSecurityAlertOutput, error) {
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+
+	err := h.loginProtection.AcknowledgeAlert(input.ID, sessionData.UserID)
+	if err != nil {
+		if err.Error() == "security alert not found" {
+			return nil, huma.Error404NotFound("Security alert not found or already acknowledged")
+		}
+		return nil, huma.Error500InternalServerError("Failed to acknowledge security alert", err)
+	}
+
+	return &AcknowledgeSecurityAlertOutput{
+		Body: struct {
+			Success bool   `json:"success"`
+			Message string `json:"message"`
+		}{
+			Success: true,
+			Message: "Security alert acknowledged",
+		},
+	}, nil
+}
+
+// loginBlockedError answers a login refused after too many failures with 429 and the seconds
+// until the next attempt is allowed
+func loginBlockedError(blocked *services.LoginBlockedError) error {
+	seconds := int(math.Ceil(blocked.RetryAfter.Seconds()))
+	headers := http.Header{"Retry-After": []string{fmt.Sprintf("%d", seconds)}}
+
+	message := fmt.Sprintf("Too many failed logins, try again in %d seconds", seconds)
+	if blocked.Locked {
+		message = fmt.Sprintf("Too many failed logins, locked out for %d minutes", int(math.Ceil(blocked.RetryAfter.Minutes())))
+	}
+	return huma.ErrorWithHeaders(huma.Error429TooManyRequests(message), headers)
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/services"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// OIDCHandler signs staff in through the OpenID Connect identity provider
+type OIDCHandler struct {
+	oidcService *services.OIDCService
+}
+
+func NewOIDCHandler(oidcService *services.OIDCService) *OIDCHandler {
+	return &OIDCHandler{oidcService: oidcService}
+}
+
+func (h *OIDCHandler) Register(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-oidc-status",
+		Method:      http.MethodGet,
+		Path:        "/api/auth/oidc",
+		Summary:     "Get single sign-on status",
+		Description: "Tell the login page whether staff can sign in with the identity provider, and under which name.",
+		Tags:        []string{"Authentication"},
+		Metadata:    middleware.Public(),
+	}, h.GetStatus)
+
+	huma.Register(api, huma.Operation{
+		OperationID:   "start-oidc-login",
+		Method:        http.MethodGet,
+		Path:          "/api/auth/oidc/login",
+		Summary:       "Start single sign-on",
+		Description:   "Redirect the browser to the identity provider to sign in.",
+		Tags:          []string{"Authentication"},
+		DefaultStatus: http.StatusFound,
+		Metadata:      middleware.Public(),
+	}, h.StartLogin)
+
+	huma.Register(api, huma.Operation{
+		OperationID:   "oidc-callback",
+		Method:        http.MethodGet,
+		Path:          "/api/auth/oidc/callback",
+		Summary:       "Complete single sign-on",
+		Description:   "Where the identity provider sends the browser back. Signs in the matching user and redirects to the frontend with a single-use code to exchange for the session, or with the reason the sign-in failed.",
+		Tags:          []string{"Authentication"},
+		DefaultStatus: http.StatusFound,
+		Metadata:      middleware.Public(),
+	}, h.Callback)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "exchange-oidc-login",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/oidc/exchange",
+		Summary:     "Exchange single sign-on code",
+		Description: "Get the session created by a single sign-on with the code the frontend was redirected with. The code works once, for one minute.",
+		Tags:        []string{"Authentication"},
+		Metadata:    middleware.Public(),
+	}, h.Exchange)
+}
+
+// Get Status
+type OIDCStatusOutput struct {
+	Body tables.OIDCStatus `json:"body"`
+}
+
+func (h *OIDCHandler) GetStatus(ctx context.Context, input *struct{}) (*OIDCStatusOutput, error) {
+	return &OIDCStatusOutput{Body: h.oidcService.Status()}, nil
+}
+
+// Redirects
+type OIDCRedirectOutput struct {
+	Location string `header:"Location"`
+}
+
+func (h *OIDCHandler) StartLogin(ctx context.Context, input *struct{}) (*OIDCRedirectOutput, error) {
+	if !h.oidcService.Enabled() {
+		return nil, huma.Error404NotFound("Single sign-on is not configured")
+	}
+
+	authURL, err := h.oidcService.AuthorizationURL()
+	if err != nil {
+		log.Printf("Failed to start single sign-on: %v", err)
+		return &OIDCRedirectOutput{Location: h.oidcService.PostLoginURL("", services.OIDCErrorFailed)}, nil
+	}
+	return &OIDCRedirectOutput{Location: authURL}, nil
+}
+
+// Callback
+type OIDCCallbackInput struct {
+	Code             string `query:"code"`
+	State            string `query:"state"`
+	Error            string `query:"error"`
+	ErrorDescription string `query:"error_description"`
+	UserAgent        string `header:"User-Agent"`
+}
+
+func (h *OIDCHandler) Callback(ctx context.Context, input *OIDCCallbackInput) (*OIDCRedirectOutput, error) {
+	if !h.oidcService.Enabled() {
+		return nil, huma.Error404NotFound("Single sign-on is not configured")
+	}
+
+	// The identity provider reports a refused or cancelled sign-in instead of a code
+	if input.Error != "" {
+		log.Printf("Identity provider refused single sign-on: %s %s", input.Error, input.ErrorDescription)
+		reason := services.OIDCErrorFailed
+		if input.Error == "access_denied" {
+			reason = services.OIDCErrorCancelled
+		}
+		return &OIDCRedirectOutput{Location: h.oidcService.PostLoginURL("", reason)}, nil
+	}
+
+	userAgent := input.UserAgent
+	if userAgent == "" {
+		userAgent = "unknown"
+	}
+	code, err := h.oidcService.Callback(input.Code, input.State, middleware.GetClientIPFromContext(ctx), userAgent)
+	if err != nil {
+		log.Printf("Single sign-on failed: %v", err)
+		reason := services.OIDCErrorFailed
+		switch err.Error() {
+		case "no matching user", "user is linked to another identity provider account":
+			reason = services.OIDCErrorNoAccount
+		}
+		return &OIDCRedirectOutput{Location: h.oidcService.PostLoginURL("", reason)}, nil
+	}
+	return &OIDCRedirectOutput{Location: h.oidcService.PostLoginURL(code, "")}, nil
+}
+
+// Exchange
+type OIDCExchangeInput struct {
+	Body tables.OIDCExchangeRequest `json:"body"`
+}
+
+func (h *OIDCHandler) Exchange(ctx context.Context, input *OIDCExchangeInput) (*LoginOutput, error) {
+	sessionID, user, sessionData, err := h.oidcService.Exchange(input.Body.Code)
+	if err != nil {
+		if err.Error() == "invalid or expired login code" {
+			return nil, huma.Error401Unauthorized("Sign-in code is invalid or expired")
+		}
+		return nil, huma.Error500InternalServerError("Failed to complete single sign-on", err)
+	}
+
+	return &LoginOutput{Body: newLoginResponse(sessionID, user, sessionData)}, nil
+}
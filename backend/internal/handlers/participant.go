@@ -2,21 +2,41 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/config"
 	"github.com/medxamion/medxamion/internal/middleware"
 	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
 	"github.com/medxamion/medxamion/internal/tables"
 	"github.com/medxamion/medxamion/internal/utils"
 )
 
 type ParticipantHandler struct {
 	participantRepo *models.ParticipantModel
+	accessCodeRepo  *models.DeliveryAccessCodeModel
+	examContent     *services.ExamContentService
+	loginProtection *services.LoginProtectionService
+	passwordService *services.PasswordService
+	auditService    *services.AuditService
+	config          *config.Config
 }
 
-func NewParticipantHandler(participantRepo *models.ParticipantModel) *ParticipantHandler {
-	return &ParticipantHandler{participantRepo: participantRepo}
+func NewParticipantHandler(participantRepo *models.ParticipantModel, accessCodeRepo *models.DeliveryAccessCodeModel, examContent *services.ExamContentService, loginProtection *services.LoginProtectionService, passwordService *services.PasswordService, auditService *services.AuditService, config *config.Config) *ParticipantHandler {
+	return &ParticipantHandler{
+		participantRepo: participantRepo,
+		accessCodeRepo:  accessCodeRepo,
+		examContent:     examContent,
+		loginProtection: loginProtection,
+		passwordService: passwordService,
+		auditService:    auditService,
+		config:          config,
+	}
 }
 
 func (h *ParticipantHandler) Register(api huma.API) {
@@ -25,8 +45,9 @@ func (h *ParticipantHandler) Register(api huma.API) {
 		Method:      http.MethodPost,
 		Path:        "/api/participant/login",
 		Summary:     "Participant login",
-		Description: "Authenticate a participant using registration number and password.",
+		Description: "Authenticate a participant using registration number and password. Repeated failures delay further attempts and then lock the registration number out, answered with 429 and Retry-After. When the participant's must_change_password is set, they must change their password before taking exams.",
 		Tags:        []string{"Participant Auth"},
+		Metadata:    middleware.Public(),
 	}, h.ParticipantLogin)
 
 	huma.Register(api, huma.Operation{
@@ -34,8 +55,9 @@ func (h *ParticipantHandler) Register(api huma.API) {
 		Method:      http.MethodPost,
 		Path:        "/api/participant/login-testcode",
 		Summary:     "Participant login with test code",
-		Description: "Authenticate a participant using their unique test code for exam delivery.",
+		Description: "Authenticate a participant using their unique test code for exam delivery, and the access code announced in the room when the delivery requires one. Test-code logins are strictly rate limited per IP address, and repeated invalid codes lock the IP address out, answered with 429 and Retry-After.",
 		Tags:        []string{"Participant Auth"},
+		Metadata:    middleware.Public(),
 	}, h.ParticipantLoginWithTestCode)
 
 	huma.Register(api, huma.Operation{
@@ -46,6 +68,7 @@ func (h *ParticipantHandler) Register(api huma.API) {
 		Description: "Get a paginated list of participants with optional search and group filtering.",
 		Tags:        []string{"Participants"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.ListParticipants)
 
 	huma.Register(api, huma.Operation{
@@ -56,6 +79,7 @@ func (h *ParticipantHandler) Register(api huma.API) {
 		Description: "Get detailed information about a specific participant.",
 		Tags:        []string{"Participants"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetParticipant)
 
 	huma.Register(api, huma.Operation{
@@ -66,6 +90,7 @@ func (h *ParticipantHandler) Register(api huma.API) {
 		Description: "Register a new participant for exams.",
 		Tags:        []string{"Participants"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionParticipantManage),
 	}, h.CreateParticipant)
 
 	huma.Register(api, huma.Operation{
@@ -76,6 +101,7 @@ func (h *ParticipantHandler) Register(api huma.API) {
 		Description: "Update participant information.",
 		Tags:        []string{"Participants"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionParticipantManage),
 	}, h.UpdateParticipant)
 
 	huma.Register(api, huma.Operation{
@@ -83,11 +109,34 @@ func (h *ParticipantHandler) Register(api huma.API) {
 		Method:      http.MethodDelete,
 		Path:        "/api/participants/{id}",
 		Summary:     "Delete participant",
-		Description: "Delete a participant account.",
+		Description: "Delete a participant account, which can then no longer log in. Their attempts are kept, and deleted participants can be restored.",
 		Tags:        []string{"Participants"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionParticipantManage),
 	}, h.DeleteParticipant)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "list-deleted-participants",
+		Method:      http.MethodGet,
+		Path:        "/api/participants/deleted",
+		Summary:     "List deleted participants",
+		Description: "Get a paginated list of deleted participants, most recently deleted first.",
+		Tags:        []string{"Participants"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionParticipantManage),
+	}, h.ListDeletedParticipants)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "restore-participant",
+		Method:      http.MethodPost,
+		Path:        "/api/participants/{id}/restore",
+		Summary:     "Restore participant",
+		Description: "Restore a deleted participant.",
+		Tags:        []string{"Participants"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionParticipantManage),
+	}, h.RestoreParticipant)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "verify-participant",
 		Method:      http.MethodPost,
@@ -96,6 +145,7 @@ func (h *ParticipantHandler) Register(api huma.API) {
 		Description: "Verify or unverify a participant account.",
 		Tags:        []string{"Participants"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionParticipantManage),
 	}, h.VerifyParticipant)
 
 	huma.Register(api, huma.Operation{
@@ -106,13 +156,15 @@ func (h *ParticipantHandler) Register(api huma.API) {
 		Description: "Get all groups that a participant belongs to.",
 		Tags:        []string{"Participants"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetParticipantGroups)
 }
 
 // Participant Login with Test Code
 type ParticipantLoginWithTestCodeInput struct {
 	Body struct {
-		TestCode string `json:"test_code" minLength:"1" maxLength:"255"`
+		TestCode   string `json:"test_code" minLength:"1" maxLength:"255" doc:"Taker code, with or without dashes"`
+		AccessCode string `json:"access_code,omitempty" maxLength:"32" doc:"Access code announced in the room, for deliveries that require one"`
 	} `json:"body"`
 }
 
@@ -127,21 +179,72 @@ type ParticipantLoginWithTestCodeOutput struct {
 	} `json:"body"`
 }
 
+// invalidTestCodeLogin answers every failed test-code login alike, whether the test code or
+// the access code was wrong
+const invalidTestCodeLogin = "Invalid test code or access code"
+
+// testCodeLoginLifetime is how long the credential of a test-code login starts an attempt
+// on the exam-client
+const testCodeLoginLifetime = 12 * time.Hour
+
 func (h *ParticipantHandler) ParticipantLoginWithTestCode(ctx context.Context, input *ParticipantLoginWithTestCodeInput) (*ParticipantLoginWithTestCodeOutput, error) {
+	ipAddress := middleware.GetClientIPFromContext(ctx)
+	testCode := utils.NormalizeTakerCode(input.Body.TestCode)
+	if err := h.checkLogin(tables.LoginScopeTestCode, testCode, ipAddress); err != nil {
+		return nil, err
+	}
+
+	// A wrong check character rejects typos and guesses without looking the code up. Until
+	// they are retired, sequential codes issued before codes were random are looked up as
+	// they were stored, since they have no check character and were not normalized.
+	lookupCode := testCode
+	legacy := !utils.ValidTakerCode(testCode)
+	if legacy {
+		lookupCode = strings.TrimSpace(input.Body.TestCode)
+		if lookupCode == "" || !time.Now().Before(h.config.LegacyTakerCodesUntil) {
+			h.loginProtection.RecordFailure(tables.LoginScopeTestCode, testCode, ipAddress)
+			return nil, huma.Error401Unauthorized(invalidTestCodeLogin)
+		}
+	}
+
 	// Find participant by test code in group_taker table
-	participant, delivery, err := h.participantRepo.GetByTestCode(input.Body.TestCode)
+	participant, delivery, err := h.participantRepo.GetByTestCode(lookupCode)
 	if err != nil || participant == nil {
-		return nil, huma.Error401Unauthorized("Invalid test code")
+		h.loginProtection.RecordFailure(tables.LoginScopeTestCode, testCode, ipAddress)
+		return nil, huma.Error401Unauthorized(invalidTestCodeLogin)
+	}
+	if legacy {
+		log.Printf("Participant %d logged in to delivery %d with a legacy taker code; regenerate the codes of group %d", participant.ID, delivery.ID, delivery.GroupID)
+	}
+
+	accessCode, err := h.accessCodeRepo.Get(delivery.ID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to check access code", err)
+	}
+	if accessCode != nil {
+		// A missing or wrong access code fails like a wrong test code, so it does not confirm
+		// the test code is valid
+		entered := utils.NormalizeTakerCode(input.Body.AccessCode)
+		if entered == "" || !utils.EqualCodes(entered, accessCode.Code) {
+			h.loginProtection.RecordFailure(tables.LoginScopeTestCode, testCode, ipAddress)
+			return nil, huma.Error401Unauthorized(invalidTestCodeLogin)
+		}
 	}
 
+	h.loginProtection.RecordSuccess(tables.LoginScopeTestCode, testCode, ipAddress)
+
 	// Check if participant is verified
 	if !participant.IsVerified {
 		return nil, huma.Error403Forbidden("Your account is not verified. Please contact the administrator.")
 	}
 
-	// TODO: Implement proper session management for test code login
-	token := "temp-token-" + input.Body.TestCode
-	var expiresAt int64 = 0
+	// The token is the credential the exam-client starts the attempt with, sealed with the
+	// delivery key so only this participant's attempt can be started with it
+	expiresAt := time.Now().Add(testCodeLoginLifetime)
+	token, err := h.examContent.IssueParticipantCredential(delivery.ID, participant.ID, expiresAt)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to log in", err)
+	}
 
 	// Remove password from response
 	participant.Password = nil
@@ -160,11 +263,26 @@ func (h *ParticipantHandler) ParticipantLoginWithTestCode(ctx context.Context, i
 			Participant: participant,
 			Delivery:    delivery,
 			Token:       token,
-			ExpiresAt:   expiresAt,
+			ExpiresAt:   expiresAt.Unix(),
 		},
 	}, nil
 }
 
+// checkLogin refuses a participant login while the account or IP address is locked out or
+// waiting out a backoff
+func (h *ParticipantHandler) checkLogin(scope, identifier, ipAddress string) error {
+	err := h.loginProtection.Check(scope, identifier, ipAddress)
+	if err == nil {
+		return nil
+	}
+
+	var blocked *services.LoginBlockedError
+	if errors.As(err, &blocked) {
+		return loginBlockedError(blocked)
+	}
+	return huma.Error500InternalServerError("Failed to check login", err)
+}
+
 // Participant Login
 type ParticipantLoginInput struct {
 	Body struct {
@@ -184,9 +302,15 @@ type ParticipantLoginOutput struct {
 }
 
 func (h *ParticipantHandler) ParticipantLogin(ctx context.Context, input *ParticipantLoginInput) (*ParticipantLoginOutput, error) {
+	ipAddress := middleware.GetClientIPFromContext(ctx)
+	if err := h.checkLogin(tables.LoginScopeParticipant, input.Body.RegistrationNumber, ipAddress); err != nil {
+		return nil, err
+	}
+
 	// Find participant by registration number
 	participant, err := h.participantRepo.GetByRegistrationNumber(input.Body.RegistrationNumber)
 	if err != nil || participant == nil {
+		h.loginProtection.RecordFailure(tables.LoginScopeParticipant, input.Body.RegistrationNumber, ipAddress)
 		return nil, huma.Error401Unauthorized("Invalid registration number or password")
 	}
 
@@ -197,12 +321,15 @@ func (h *ParticipantHandler) ParticipantLogin(ctx context.Context, input *Partic
 
 	// Verify password
 	if participant.Password == nil || *participant.Password == "" {
+		h.loginProtection.RecordFailure(tables.LoginScopeParticipant, input.Body.RegistrationNumber, ipAddress)
 		return nil, huma.Error401Unauthorized("Invalid registration number or password")
 	}
 
 	if !utils.CheckPasswordHash(input.Body.Password, *participant.Password) {
+		h.loginProtection.RecordFailure(tables.LoginScopeParticipant, input.Body.RegistrationNumber, ipAddress)
 		return nil, huma.Error401Unauthorized("Invalid registration number or password")
 	}
+	h.loginProtection.RecordSuccess(tables.LoginScopeParticipant, input.Body.RegistrationNumber, ipAddress)
 
 	// TODO: Implement participant session management
 	// This needs to be integrated with the existing session system
@@ -210,6 +337,11 @@ func (h *ParticipantHandler) ParticipantLogin(ctx context.Context, input *Partic
 	token := "temp-token"
 	var expiresAt int64 = 0
 
+	message := "Login successful"
+	if participant.MustChangePassword {
+		message = "Change your password to continue"
+	}
+
 	// Remove password from response
 	participant.Password = nil
 
@@ -222,7 +354,7 @@ func (h *ParticipantHandler) ParticipantLogin(ctx context.Context, input *Partic
 			ExpiresAt   int64               `json:"expires_at,omitempty"`
 		}{
 			Success:     true,
-			Message:     "Login successful",
+			Message:     message,
 			Participant: participant,
 			Token:       token,
 			ExpiresAt:   expiresAt,
@@ -243,11 +375,6 @@ type ListParticipantsOutput struct {
 }
 
 func (h *ParticipantHandler) ListParticipants(ctx context.Context, input *ListParticipantsInput) (*ListParticipantsOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	pagination := tables.Pagination{
 		Page:    input.Page,
 		PerPage: input.PerPage,
@@ -258,7 +385,7 @@ func (h *ParticipantHandler) ListParticipants(ctx context.Context, input *ListPa
 		groupID = &input.GroupID
 	}
 
-	result, err := h.participantRepo.List(pagination, input.Search, groupID)
+	result, err := h.participantRepo.List(clientScope(ctx), pagination, input.Search, groupID)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to get participants", err)
 	}
@@ -279,17 +406,12 @@ type GetParticipantOutput struct {
 }
 
 func (h *ParticipantHandler) GetParticipant(ctx context.Context, input *GetParticipantInput) (*GetParticipantOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	participant, err := h.participantRepo.GetByID(input.ID)
+	participant, err := h.participantRepo.GetByID(clientScope(ctx), input.ID)
 	if err != nil {
 		return nil, huma.Error404NotFound("Participant not found")
 	}
 
-	groups, err := h.participantRepo.GetParticipantGroups(input.ID)
+	groups, err := h.participantRepo.GetParticipantGroups(clientScope(ctx), input.ID)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to get participant groups", err)
 	}
@@ -324,26 +446,12 @@ type CreateParticipantOutput struct {
 }
 
 func (h *ParticipantHandler) CreateParticipant(ctx context.Context, input *CreateParticipantInput) (*CreateParticipantOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
-	}
-
 	// Hash password if provided
 	var hashedPassword *string
 	if input.Body.Password != nil {
+		if err := h.passwordService.ValidateNew(*input.Body.Password); err != nil {
+			return nil, passwordError(err, "Failed to check password")
+		}
 		hashed, err := utils.HashPassword(*input.Body.Password)
 		if err != nil {
 			return nil, huma.Error500InternalServerError("Failed to hash password", err)
@@ -351,19 +459,25 @@ func (h *ParticipantHandler) CreateParticipant(ctx context.Context, input *Creat
 		hashedPassword = &hashed
 	}
 
-	clientID := 2 // Default client ID as seen in database
 	participant := &tables.Participant{
 		Name:       input.Body.Name,
 		Reg:        input.Body.Reg,
 		Email:      input.Body.Email,
 		Password:   hashedPassword,
 		IsVerified: false,
-		ClientID:   &clientID,
 	}
 
-	err := h.participantRepo.Create(participant)
+	err := h.participantRepo.Create(clientScope(ctx), participant)
 	if err != nil {
-		return nil, huma.Error500InternalServerError("Failed to create participant", err)
+		return nil, createInClientError(err, "Failed to create participant")
+	}
+
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityParticipant, participant.ID, nil, participant)
+
+	if hashedPassword != nil {
+		if err := h.passwordService.RecordInitial(tables.PasswordAccountParticipant, participant.ID, *hashedPassword, false); err != nil {
+			return nil, huma.Error500InternalServerError("Failed to record password", err)
+		}
 	}
 
 	// Remove password from response
@@ -399,28 +513,24 @@ type UpdateParticipantOutput struct {
 }
 
 func (h *ParticipantHandler) UpdateParticipant(ctx context.Context, input *UpdateParticipantInput) (*UpdateParticipantOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
+	before, err := h.participantRepo.GetByID(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "participant not found" {
+			return nil, huma.Error404NotFound("Participant not found")
 		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+		return nil, huma.Error500InternalServerError("Failed to get participant", err)
 	}
 
-	participant, err := h.participantRepo.Update(input.ID, &input.Body)
+	participant, err := h.participantRepo.Update(clientScope(ctx), input.ID, &input.Body)
 	if err != nil {
+		if err.Error() == "participant not found" {
+			return nil, huma.Error404NotFound("Participant not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to update participant", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityParticipant, participant.ID, before, participant)
+
 	// Remove password from response
 	if participant.Password != nil {
 		*participant.Password = ""
@@ -452,28 +562,24 @@ type DeleteParticipantOutput struct {
 }
 
 func (h *ParticipantHandler) DeleteParticipant(ctx context.Context, input *DeleteParticipantInput) (*DeleteParticipantOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
+	before, err := h.participantRepo.GetByID(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "participant not found" {
+			return nil, huma.Error404NotFound("Participant not found")
 		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+		return nil, huma.Error500InternalServerError("Failed to get participant", err)
 	}
 
-	err := h.participantRepo.Delete(input.ID)
+	err = h.participantRepo.Delete(clientScope(ctx), input.ID)
 	if err != nil {
+		if err.Error() == "participant not found" {
+			return nil, huma.Error404NotFound("Participant not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to delete participant", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityParticipant, input.ID, before, nil)
+
 	return &DeleteParticipantOutput{
 		Body: struct {
 			Success bool   `json:"success"`
@@ -485,6 +591,75 @@ func (h *ParticipantHandler) DeleteParticipant(ctx context.Context, input *Delet
 	}, nil
 }
 
+// List Deleted Participants
+type ListDeletedParticipantsInput struct {
+	Page    int `query:"page" default:"1" minimum:"1"`
+	PerPage int `query:"per_page" default:"15" minimum:"1" maximum:"100"`
+}
+
+type ListDeletedParticipantsOutput struct {
+	Body tables.PaginatedResponse `json:"body"`
+}
+
+func (h *ParticipantHandler) ListDeletedParticipants(ctx context.Context, input *ListDeletedParticipantsInput) (*ListDeletedParticipantsOutput, error) {
+	pagination := tables.Pagination{
+		Page:    input.Page,
+		PerPage: input.PerPage,
+	}
+
+	result, err := h.participantRepo.ListDeleted(clientScope(ctx), pagination)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get deleted participants", err)
+	}
+
+	return &ListDeletedParticipantsOutput{Body: *result}, nil
+}
+
+// Restore Participant
+type RestoreParticipantInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type RestoreParticipantOutput struct {
+	Body struct {
+		Success     bool                `json:"success"`
+		Message     string              `json:"message"`
+		Participant *tables.Participant `json:"participant,omitempty"`
+	} `json:"body"`
+}
+
+func (h *ParticipantHandler) RestoreParticipant(ctx context.Context, input *RestoreParticipantInput) (*RestoreParticipantOutput, error) {
+	before, err := h.participantRepo.GetDeleted(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "participant not found" {
+			return nil, huma.Error404NotFound("Deleted participant not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to get deleted participant", err)
+	}
+
+	participant, err := h.participantRepo.Restore(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "participant not found" {
+			return nil, huma.Error404NotFound("Deleted participant not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to restore participant", err)
+	}
+
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityParticipant, input.ID, before, participant)
+
+	return &RestoreParticipantOutput{
+		Body: struct {
+			Success     bool                `json:"success"`
+			Message     string              `json:"message"`
+			Participant *tables.Participant `json:"participant,omitempty"`
+		}{
+			Success:     true,
+			Message:     "Participant restored successfully",
+			Participant: participant,
+		},
+	}, nil
+}
+
 // Verify Participant
 type VerifyParticipantInput struct {
 	ID   int `path:"id" minimum:"1"`
@@ -501,28 +676,26 @@ type VerifyParticipantOutput struct {
 }
 
 func (h *ParticipantHandler) VerifyParticipant(ctx context.Context, input *VerifyParticipantInput) (*VerifyParticipantOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check admin role
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
+	before, err := h.participantRepo.GetByID(clientScope(ctx), input.ID)
+	if err != nil {
+		if err.Error() == "participant not found" {
+			return nil, huma.Error404NotFound("Participant not found")
 		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+		return nil, huma.Error500InternalServerError("Failed to get participant", err)
 	}
 
-	err := h.participantRepo.SetVerified(input.ID, input.Body.Verified)
+	err = h.participantRepo.SetVerified(clientScope(ctx), input.ID, input.Body.Verified)
 	if err != nil {
+		if err.Error() == "participant not found" {
+			return nil, huma.Error404NotFound("Participant not found")
+		}
 		return nil, huma.Error500InternalServerError("Failed to update verification status", err)
 	}
 
+	if after, err := h.participantRepo.GetByID(clientScope(ctx), input.ID); err == nil {
+		h.auditService.Record(auditActor(ctx), tables.AuditEntityParticipant, input.ID, before, after)
+	}
+
 	message := "Participant verified successfully"
 	if !input.Body.Verified {
 		message = "Participant unverified successfully"
@@ -549,12 +722,7 @@ type GetParticipantGroupsOutput struct {
 }
 
 func (h *ParticipantHandler) GetParticipantGroups(ctx context.Context, input *GetParticipantGroupsInput) (*GetParticipantGroupsOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	groups, err := h.participantRepo.GetParticipantGroups(input.ID)
+	groups, err := h.participantRepo.GetParticipantGroups(clientScope(ctx), input.ID)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to get participant groups", err)
 	}
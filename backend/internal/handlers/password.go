@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// PasswordHandler lets users and participants change and reset their passwords under the
+// password policy, and admins reset passwords and require password changes
+type PasswordHandler struct {
+	passwordService *services.PasswordService
+	participantRepo *models.ParticipantModel
+	loginProtection *services.LoginProtectionService
+	auditService    *services.AuditService
+}
+
+func NewPasswordHandler(passwordService *services.PasswordService, participantRepo *models.ParticipantModel, loginProtection *services.LoginProtectionService, auditService *services.AuditService) *PasswordHandler {
+	return &PasswordHandler{
+		passwordService: passwordService,
+		participantRepo: participantRepo,
+		loginProtection: loginProtection,
+		auditService:    auditService,
+	}
+}
+
+func (h *PasswordHandler) Register(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-password-policy",
+		Method:      http.MethodGet,
+		Path:        "/api/auth/password-policy",
+		Summary:     "Get password policy",
+		Description: "Get the requirements new passwords must meet.",
+		Tags:        []string{"Authentication"},
+		Metadata:    middleware.Public(),
+	}, h.GetPolicy)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "change-my-password",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/password",
+		Summary:     "Change my password",
+		Description: "Change the password of the current user, including a session limited until the password is changed. Other sessions of the user are signed out.",
+		Tags:        []string{"Authentication"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireSession(),
+	}, h.ChangeMine)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "request-password-reset",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/password-reset",
+		Summary:     "Request password reset",
+		Description: "Email a password reset link to the user with the email address. The answer is the same whether or not the address belongs to a user.",
+		Tags:        []string{"Authentication"},
+		Metadata:    middleware.Public(),
+	}, h.RequestUserReset)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "reset-password",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/password-reset/confirm",
+		Summary:     "Reset password",
+		Description: "Set a new password with the token from a reset link, for users and participants. The token works once.",
+		Tags:        []string{"Authentication"},
+		Metadata:    middleware.Public(),
+	}, h.Reset)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "request-participant-password-reset",
+		Method:      http.MethodPost,
+		Path:        "/api/participant/password-reset",
+		Summary:     "Request participant password reset",
+		Description: "Email a password reset link to the participant with the email address. The answer is the same whether or not the address belongs to a participant.",
+		Tags:        []string{"Participant Auth"},
+		Metadata:    middleware.Public(),
+	}, h.RequestParticipantReset)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "participant-change-password",
+		Method:      http.MethodPost,
+		Path:        "/api/participant/change-password",
+		Summary:     "Change participant password",
+		Description: "Change the password of a participant with their registration number and current password. Wrong passwords count as failed logins.",
+		Tags:        []string{"Participant Auth"},
+		Metadata:    middleware.Public(),
+	}, h.ChangeParticipant)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "reset-user-password",
+		Method:      http.MethodPost,
+		Path:        "/api/users/{id}/password-reset",
+		Summary:     "Reset user password",
+		Description: "Stop the password of a user from working, sign them out and email them a reset link. Users without an email address get the link returned instead. Users with permissions the caller does not have cannot be reset.",
+		Tags:        []string{"Users"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionUserManage),
+	}, h.ResetUser)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "set-user-password-change-required",
+		Method:      http.MethodPut,
+		Path:        "/api/users/{id}/password-change-required",
+		Summary:     "Require user password change",
+		Description: "Set whether a user must change their password at their next login. Signed-in sessions are limited on their next request.",
+		Tags:        []string{"Users"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionUserManage),
+	}, h.SetUserChangeRequired)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "reset-participant-password",
+		Method:      http.MethodPost,
+		Path:        "/api/participants/{id}/password-reset",
+		Summary:     "Reset participant password",
+		Description: "Stop the password of a participant from working and email them a reset link. Participants without an email address get the link returned instead.",
+		Tags:        []string{"Participants"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionParticipantManage),
+	}, h.ResetParticipant)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "set-participant-password-change-required",
+		Method:      http.MethodPut,
+		Path:        "/api/participants/{id}/password-change-required",
+		Summary:     "Require participant password change",
+		Description: "Set whether a participant must change their password at their next login.",
+		Tags:        []string{"Participants"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionParticipantManage),
+	}, h.SetParticipantChangeRequired)
+}
+
+type PasswordActionOutput struct {
+	Body struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	} `json:"body"`
+}
+
+func passwordActionOutput(message string) *PasswordActionOutput {
+	output := &PasswordActionOutput{}
+	output.Body.Success = true
+	output.Body.Message = message
+	return output
+}
+
+// passwordError maps password service errors to API errors
+func passwordError(err error, message string) error {
+	var policyErr *services.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		return huma.Error400BadRequest("Password does not meet the password policy: " + policyErr.Error())
+	}
+
+	switch err.Error() {
+	case "current password is incorrect":
+		return huma.Error400BadRequest("Current password is incorrect")
+	case "invalid or expired reset token":
+		return huma.Error400BadRequest("Reset link is invalid or expired")
+	case "user not found":
+		return huma.Error404NotFound("User not found")
+	case "account not found":
+		return huma.Error404NotFound("Account not found")
+	case "account has permissions the administrator lacks":
+		return huma.Error403Forbidden("Cannot reset the password of a user with permissions you do not have")
+	}
+	return huma.Error500InternalServerError(message, err)
+}
+
+// Get Policy
+type PasswordPolicyOutput struct {
+	Body tables.PasswordPolicyInfo `json:"body"`
+}
+
+func (h *PasswordHandler) GetPolicy(ctx context.Context, input *struct{}) (*PasswordPolicyOutput, error) {
+	return &PasswordPolicyOutput{Body: h.passwordService.Policy()}, nil
+}
+
+// Change My Password
+type ChangeMyPasswordInput struct {
+	Body tables.ChangePasswordRequest `json:"body"`
+}
+
+func (h *PasswordHandler) ChangeMine(ctx context.Context, input *ChangeMyPasswordInput) (*PasswordActionOutput, error) {
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+
+	// Two-factor authentication comes before the password change
+	if sessionData.TwoFactorPending != "" {
+		return nil, huma.Error403Forbidden("Two-factor verification required")
+	}
+	if input.Body.NewPassword != input.Body.ConfirmPassword {
+		return nil, huma.Error400BadRequest("New password and confirmation do not match")
+	}
+
+	err := h.passwordService.ChangeUserPassword(sessionData.UserID, input.Body.CurrentPassword, input.Body.NewPassword, middleware.GetSessionIDFromContext(ctx))
+	if err != nil {
+		return nil, passwordError(err, "Failed to change password")
+	}
+	return passwordActionOutput("Password changed successfully"), nil
+}
+
+// Request Reset
+type RequestPasswordResetInput struct {
+	Body tables.PasswordResetRequest `json:"body"`
+}
+
+func (h *PasswordHandler) RequestUserReset(ctx context.Context, input *RequestPasswordResetInput) (*PasswordActionOutput, error) {
+	return h.requestReset(tables.PasswordAccountUser, input.Body.Email)
+}
+
+func (h *PasswordHandler) RequestParticipantReset(ctx context.Context, input *RequestPasswordResetInput) (*PasswordActionOutput, error) {
+	return h.requestReset(tables.PasswordAccountParticipant, input.Body.Email)
+}
+
+func (h *PasswordHandler) requestReset(accountType, email string) (*PasswordActionOutput, error) {
+	if err := h.passwordService.RequestReset(accountType, email); err != nil {
+		if err.Error() == "password reset disabled" {
+			return nil, huma.Error404NotFound("Password reset by email is not enabled")
+		}
+		return nil, huma.Error500InternalServerError("Failed to request password reset", err)
+	}
+	return passwordActionOutput("If the email address belongs to an account, a reset link was sent to it"), nil
+}
+
+// Reset
+type ResetPasswordInput struct {
+	Body tables.PasswordResetConfirmRequest `json:"body"`
+}
+
+func (h *PasswordHandler) Reset(ctx context.Context, input *ResetPasswordInput) (*PasswordActionOutput, error) {
+	if input.Body.NewPassword != input.Body.ConfirmPassword {
+		return nil, huma.Error400BadRequest("New password and confirmation do not match")
+	}
+
+	if err := h.passwordService.ResetPassword(input.Body.Token, input.Body.NewPassword); err != nil {
+		return nil, passwordError(err, "Failed to reset password")
+	}
+	return passwordActionOutput("Password reset successfully"), nil
+}
+
+// Change Participant Password
+type ParticipantChangePasswordInput struct {
+	Body tables.ParticipantChangePasswordRequest `json:"body"`
+}
+
+func (h *PasswordHandler) ChangeParticipant(ctx context.Context, input *ParticipantChangePasswordInput) (*PasswordActionOutput, error) {
+	if input.Body.NewPassword != input.Body.ConfirmPassword {
+		return nil, huma.Error400BadRequest("New password and confirmation do not match")
+	}
+
+	ipAddress := middleware.GetClientIPFromContext(ctx)
+	reg := input.Body.RegistrationNumber
+	if err := h.loginProtection.Check(tables.LoginScopeParticipant, reg, ipAddress); err != nil {
+		var blocked *services.LoginBlockedError
+		if errors.As(err, &blocked) {
+			return nil, loginBlockedError(blocked)
+		}
+		return nil, huma.Error500InternalServerError("Failed to check login", err)
+	}
+
+	participant, err := h.participantRepo.GetByRegistrationNumber(reg)
+	if err != nil {
+		h.loginProtection.RecordFailure(tables.LoginScopeParticipant, reg, ipAddress)
+		return nil, huma.Error401Unauthorized("Invalid registration number or password")
+	}
+
+	err = h.passwordService.ChangeParticipantPassword(participant, input.Body.CurrentPassword, input.Body.NewPassword)
+	if err != nil {
+		if err.Error() == "current password is incorrect" {
+			h.loginProtection.RecordFailure(tables.LoginScopeParticipant, reg, ipAddress)
+			return nil, huma.Error401Unauthorized("Invalid registration number or password")
+		}
+		return nil, passwordError(err, "Failed to change password")
+	}
+	h.loginProtection.RecordSuccess(tables.LoginScopeParticipant, reg, ipAddress)
+
+	return passwordActionOutput("Password changed successfully"), nil
+}
+
+// Admin Reset
+type AdminPasswordResetInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type AdminPasswordResetOutput struct {
+	Body tables.AdminPasswordReset `json:"body"`
+}
+
+func (h *PasswordHandler) ResetUser(ctx context.Context, input *AdminPasswordResetInput) (*AdminPasswordResetOutput, error) {
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+
+	// Users change their own password with the current one
+	if sessionData.UserID == input.ID {
+		return nil, huma.Error400BadRequest("Cannot reset your own password")
+	}
+
+	result, err := h.passwordService.AdminReset(clientScope(ctx), tables.PasswordAccountUser, input.ID, sessionData)
+	if err != nil {
+		return nil, passwordError(err, "Failed to reset password")
+	}
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityUser, input.ID, auditNoLink, auditAction("password", "reset"))
+	return &AdminPasswordResetOutput{Body: *result}, nil
+}
+
+func (h *PasswordHandler) ResetParticipant(ctx context.Context, input *AdminPasswordResetInput) (*AdminPasswordResetOutput, error) {
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+
+	result, err := h.passwordService.AdminReset(clientScope(ctx), tables.PasswordAccountParticipant, input.ID, sessionData)
+	if err != nil {
+		return nil, passwordError(err, "Failed to reset password")
+	}
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityParticipant, input.ID, auditNoLink, auditAction("password", "reset"))
+	return &AdminPasswordResetOutput{Body: *result}, nil
+}
+
+// Set Change Required
+type PasswordChangeRequiredInput struct {
+	ID   int                                  `path:"id" minimum:"1"`
+	Body tables.PasswordChangeRequiredRequest `json:"body"`
+}
+
+func (h *PasswordHandler) SetUserChangeRequired(ctx context.Context, input *PasswordChangeRequiredInput) (*PasswordActionOutput, error) {
+	return h.setChangeRequired(ctx, tables.PasswordAccountUser, input)
+}
+
+func (h *PasswordHandler) SetParticipantChangeRequired(ctx context.Context, input *PasswordChangeRequiredInput) (*PasswordActionOutput, error) {
+	return h.setChangeRequired(ctx, tables.PasswordAccountParticipant, input)
+}
+
+func (h *PasswordHandler) setChangeRequired(ctx context.Context, accountType string, input *PasswordChangeRequiredInput) (*PasswordActionOutput, error) {
+	if err := h.passwordService.SetMustChange(accountType, input.ID, input.Body.Required); err != nil {
+		return nil, passwordError(err, "Failed to update password change requirement")
+	}
+	// Account types are named after the audited records
+	h.auditService.Record(auditActor(ctx), accountType, input.ID, auditNoLink, auditAction("must_change_password", input.Body.Required))
+
+	if input.Body.Required {
+		return passwordActionOutput("Password change required at next login"), nil
+	}
+	return passwordActionOutput("Password change no longer required"), nil
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
+)
+
+// ProctorMessageHandler forwards proctor messages to the exam-client running a delivery,
+// which pushes them to the participants over the participant channel
+type ProctorMessageHandler struct {
+	examClients    *ExamClientHandler
+	assignmentRepo *models.DeliveryAssignmentModel
+}
+
+func NewProctorMessageHandler(examClients *ExamClientHandler, assignmentRepo *models.DeliveryAssignmentModel) *ProctorMessageHandler {
+	return &ProctorMessageHandler{
+		examClients:    examClients,
+		assignmentRepo: assignmentRepo,
+	}
+}
+
+func (h *ProctorMessageHandler) Register(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "send-proctor-message",
+		Method:      http.MethodPost,
+		Path:        "/api/deliveries/{id}/messages",
+		Summary:     "Send message to participants",
+		Description: "Broadcast an announcement, pause, time extension or lock to all participants of a running delivery, or send it to selected participants. Committee members of the delivery can perform this action.",
+		Tags:        []string{"Live Progress"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.SendMessage)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-proctor-messages",
+		Method:      http.MethodGet,
+		Path:        "/api/deliveries/{id}/messages",
+		Summary:     "List messages sent to participants",
+		Description: "List the messages sent during a running delivery with their delivery and acknowledgement per participant.",
+		Tags:        []string{"Live Progress"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.ListMessages)
+}
+
+// Send Proctor Message
+type SendProctorMessageInput struct {
+	ID   int                          `path:"id" minimum:"1"`
+	Body tables.ProctorMessageRequest `json:"body"`
+}
+
+type SendProctorMessageOutput struct {
+	Body struct {
+		Success bool                   `json:"success"`
+		Message string                 `json:"message"`
+		Data    *tables.ProctorMessage `json:"data,omitempty"`
+	} `json:"body"`
+}
+
+func (h *ProctorMessageHandler) SendMessage(ctx context.Context, input *SendProctorMessageInput) (*SendProctorMessageOutput, error) {
+	sessionData, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := utils.ValidateProctorMessage(&input.Body); err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+
+	payload, err := json.Marshal(tables.ProctorMessageDispatch{
+		ProctorMessageRequest: input.Body,
+		SentBy:                proctorName(sessionData),
+	})
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to send message", err)
+	}
+
+	var message tables.ProctorMessage
+	if err := h.examClients.callDeliveryServer(input.ID, http.MethodPost, "/api/messages", payload, &message); err != nil {
+		return nil, err
+	}
+
+	return &SendProctorMessageOutput{
+		Body: struct {
+			Success bool                   `json:"success"`
+			Message string                 `json:"message"`
+			Data    *tables.ProctorMessage `json:"data,omitempty"`
+		}{
+			Success: true,
+			Message: fmt.Sprintf("Message sent to %d participants, %d online", message.Recipients, message.Delivered),
+			Data:    &message,
+		},
+	}, nil
+}
+
+// List Proctor Messages
+type ListProctorMessagesInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type ListProctorMessagesOutput struct {
+	Body []tables.ProctorMessage `json:"body"`
+}
+
+func (h *ProctorMessageHandler) ListMessages(ctx context.Context, input *ListProctorMessagesInput) (*ListProctorMessagesOutput, error) {
+	if _, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID); err != nil {
+		return nil, err
+	}
+
+	messages := []tables.ProctorMessage{}
+	if err := h.examClients.callDeliveryServer(input.ID, http.MethodGet, "/api/messages", nil, &messages); err != nil {
+		return nil, err
+	}
+
+	return &ListProctorMessagesOutput{Body: messages}, nil
+}
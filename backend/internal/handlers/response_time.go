@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+type ResponseTimeHandler struct {
+	responseTimeService *services.ResponseTimeService
+	attemptRepo         *models.AttemptModel
+	assignmentRepo      *models.DeliveryAssignmentModel
+}
+
+func NewResponseTimeHandler(responseTimeService *services.ResponseTimeService, attemptRepo *models.AttemptModel, assignmentRepo *models.DeliveryAssignmentModel) *ResponseTimeHandler {
+	return &ResponseTimeHandler{
+		responseTimeService: responseTimeService,
+		attemptRepo:         attemptRepo,
+		assignmentRepo:      assignmentRepo,
+	}
+}
+
+func (h *ResponseTimeHandler) Register(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-delivery-response-times",
+		Method:      http.MethodGet,
+		Path:        "/api/deliveries/{id}/response-times",
+		Summary:     "Analyze response times",
+		Description: "Median time per question and rapid-guessing per question and candidate.",
+		Tags:        []string{"Results"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.GetResponseTimes)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-attempt-pacing",
+		Method:      http.MethodGet,
+		Path:        "/api/attempts/{id}/pacing",
+		Summary:     "Get attempt pacing curve",
+		Description: "Questions answered over time compared with an even pace over the allowed duration.",
+		Tags:        []string{"Results"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.GetPacing)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-attempt-answer-history",
+		Method:      http.MethodGet,
+		Path:        "/api/attempts/{id}/answer-history",
+		Summary:     "Get attempt answer history",
+		Description: "Every visit of a question with the time spent and the answer change it made.",
+		Tags:        []string{"Results"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireDeliveryCommittee(),
+	}, h.GetAnswerHistory)
+}
+
+// Get Response Times
+type GetResponseTimesInput struct {
+	ID int `path:"id" minimum:"1"`
+	tables.ResponseTimeAnalysisRequest
+}
+
+type GetResponseTimesOutput struct {
+	Body *tables.ResponseTimeReport `json:"body"`
+}
+
+func (h *ResponseTimeHandler) GetResponseTimes(ctx context.Context, input *GetResponseTimesInput) (*GetResponseTimesOutput, error) {
+	if _, err := ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, input.ID); err != nil {
+		return nil, err
+	}
+
+	report, err := h.responseTimeService.Analyze(input.ID, input.ResponseTimeAnalysisRequest)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to analyze response times", err)
+	}
+
+	return &GetResponseTimesOutput{Body: report}, nil
+}
+
+// Get Pacing
+type GetPacingInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type GetPacingOutput struct {
+	Body *tables.PacingCurve `json:"body"`
+}
+
+func (h *ResponseTimeHandler) GetPacing(ctx context.Context, input *GetPacingInput) (*GetPacingOutput, error) {
+	if err := h.validateAttemptAccess(ctx, input.ID); err != nil {
+		return nil, err
+	}
+
+	curve, err := h.responseTimeService.GetPacingCurve(input.ID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get pacing curve", err)
+	}
+
+	return &GetPacingOutput{Body: curve}, nil
+}
+
+// Get Answer History
+type GetAnswerHistoryInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type GetAnswerHistoryOutput struct {
+	Body []tables.AttemptQuestionHistory `json:"body"`
+}
+
+func (h *ResponseTimeHandler) GetAnswerHistory(ctx context.Context, input *GetAnswerHistoryInput) (*GetAnswerHistoryOutput, error) {
+	if err := h.validateAttemptAccess(ctx, input.ID); err != nil {
+		return nil, err
+	}
+
+	history, err := h.attemptRepo.GetAnswerHistory(input.ID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get answer history", err)
+	}
+
+	return &GetAnswerHistoryOutput{Body: history}, nil
+}
+
+// validateAttemptAccess checks committee access to the delivery of an attempt
+func (h *ResponseTimeHandler) validateAttemptAccess(ctx context.Context, attemptID int) error {
+	attempt, err := h.attemptRepo.GetByID(attemptID)
+	if err != nil {
+		return huma.Error404NotFound("Attempt not found")
+	}
+
+	_, err = ValidateDeliveryCommitteeAccess(ctx, h.assignmentRepo, attempt.DeliveryID)
+	return err
+}
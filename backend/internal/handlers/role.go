@@ -0,0 +1,465 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// RoleHandler manages roles, the permissions granted to them, and the roles and direct
+// permissions of users
+type RoleHandler struct {
+	roleRepo       *models.RoleModel
+	permissionRepo *models.PermissionModel
+	userRepo       *models.UserModel
+	authorizer     *services.Authorizer
+	auditService   *services.AuditService
+}
+
+func NewRoleHandler(roleRepo *models.RoleModel, permissionRepo *models.PermissionModel, userRepo *models.UserModel, authorizer *services.Authorizer, auditService *services.AuditService) *RoleHandler {
+	return &RoleHandler{
+		roleRepo:       roleRepo,
+		permissionRepo: permissionRepo,
+		userRepo:       userRepo,
+		authorizer:     authorizer,
+		auditService:   auditService,
+	}
+}
+
+func (h *RoleHandler) Register(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "list-roles",
+		Method:      http.MethodGet,
+		Path:        "/api/roles",
+		Summary:     "List roles",
+		Description: "Get all roles with the permissions granted to them.",
+		Tags:        []string{"Roles"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionRoleManage),
+	}, h.ListRoles)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-role",
+		Method:      http.MethodGet,
+		Path:        "/api/roles/{id}",
+		Summary:     "Get role by ID",
+		Description: "Get a role with the permissions granted to it.",
+		Tags:        []string{"Roles"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionRoleManage),
+	}, h.GetRole)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "create-role",
+		Method:      http.MethodPost,
+		Path:        "/api/roles",
+		Summary:     "Create role",
+		Description: "Create a role and grant it permissions.",
+		Tags:        []string{"Roles"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionRoleManage),
+	}, h.CreateRole)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "update-role",
+		Method:      http.MethodPut,
+		Path:        "/api/roles/{id}",
+		Summary:     "Update role",
+		Description: "Update the display name and description of a role.",
+		Tags:        []string{"Roles"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionRoleManage),
+	}, h.UpdateRole)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-role",
+		Method:      http.MethodDelete,
+		Path:        "/api/roles/{id}",
+		Summary:     "Delete role",
+		Description: "Delete a role, taking it away from its users. The administrator role cannot be deleted.",
+		Tags:        []string{"Roles"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionRoleManage),
+	}, h.DeleteRole)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "set-role-permissions",
+		Method:      http.MethodPut,
+		Path:        "/api/roles/{id}/permissions",
+		Summary:     "Set role permissions",
+		Description: "Replace the permissions granted to a role. The administrator role always has every permission.",
+		Tags:        []string{"Roles"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionRoleManage),
+	}, h.SetRolePermissions)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-permissions",
+		Method:      http.MethodGet,
+		Path:        "/api/permissions",
+		Summary:     "List permissions",
+		Description: "Get all permissions that can be granted to roles and users.",
+		Tags:        []string{"Roles"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionRoleManage),
+	}, h.ListPermissions)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-user-access",
+		Method:      http.MethodGet,
+		Path:        "/api/users/{id}/access",
+		Summary:     "Get user access",
+		Description: "Get the roles and direct permissions of a user, and the effective permissions they result in.",
+		Tags:        []string{"Roles", "Users"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionRoleManage),
+	}, h.GetUserAccess)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "set-user-roles",
+		Method:      http.MethodPut,
+		Path:        "/api/users/{id}/roles",
+		Summary:     "Set user roles",
+		Description: "Replace the roles of a user. Users cannot change their own roles.",
+		Tags:        []string{"Roles", "Users"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionRoleManage),
+	}, h.SetUserRoles)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "set-user-permissions",
+		Method:      http.MethodPut,
+		Path:        "/api/users/{id}/permissions",
+		Summary:     "Set user permissions",
+		Description: "Replace the permissions granted directly to a user, on top of those of their roles. Users cannot change their own permissions.",
+		Tags:        []string{"Roles", "Users"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionRoleManage),
+	}, h.SetUserPermissions)
+}
+
+// List Roles
+type ListRolesOutput struct {
+	Body []tables.RoleWithPermissions `json:"body"`
+}
+
+func (h *RoleHandler) ListRoles(ctx context.Context, input *struct{}) (*ListRolesOutput, error) {
+	roles, err := h.roleRepo.List()
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to list roles", err)
+	}
+
+	return &ListRolesOutput{Body: roles}, nil
+}
+
+// Get Role
+type GetRoleInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type GetRoleOutput struct {
+	Body *tables.RoleWithPermissions `json:"body"`
+}
+
+func (h *RoleHandler) GetRole(ctx context.Context, input *GetRoleInput) (*GetRoleOutput, error) {
+	role, err := h.roleRepo.GetByID(input.ID)
+	if err != nil {
+		if err.Error() == "role not found" {
+			return nil, huma.Error404NotFound("Role not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to get role", err)
+	}
+
+	return &GetRoleOutput{Body: role}, nil
+}
+
+// Create Role
+type CreateRoleInput struct {
+	Body tables.RoleCreateRequest `json:"body"`
+}
+
+type RoleOutput struct {
+	Body struct {
+		Success bool                        `json:"success"`
+		Message string                      `json:"message"`
+		Role    *tables.RoleWithPermissions `json:"role,omitempty"`
+	} `json:"body"`
+}
+
+func (h *RoleHandler) CreateRole(ctx context.Context, input *CreateRoleInput) (*RoleOutput, error) {
+	if err := validatePermissionNames(input.Body.Permissions); err != nil {
+		return nil, err
+	}
+
+	role, err := h.roleRepo.Create(&input.Body)
+	if err != nil {
+		switch err.Error() {
+		case "role already exists":
+			return nil, huma.Error409Conflict("Role already exists")
+		case "permission not found":
+			return nil, huma.Error400BadRequest("Permission not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to create role", err)
+	}
+
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityRole, role.ID, nil, role)
+
+	return roleOutput("Role created successfully", role), nil
+}
+
+// Update Role
+type UpdateRoleInput struct {
+	ID   int                      `path:"id" minimum:"1"`
+	Body tables.RoleUpdateRequest `json:"body"`
+}
+
+func (h *RoleHandler) UpdateRole(ctx context.Context, input *UpdateRoleInput) (*RoleOutput, error) {
+	before, err := h.roleRepo.GetByID(input.ID)
+	if err != nil {
+		if err.Error() == "role not found" {
+			return nil, huma.Error404NotFound("Role not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to get role", err)
+	}
+
+	role, err := h.roleRepo.Update(input.ID, &input.Body)
+	if err != nil {
+		if err.Error() == "role not found" {
+			return nil, huma.Error404NotFound("Role not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to update role", err)
+	}
+
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityRole, role.ID, before, role)
+
+	return roleOutput("Role updated successfully", role), nil
+}
+
+// Delete Role
+type DeleteRoleInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type DeleteRoleOutput struct {
+	Body struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	} `json:"body"`
+}
+
+func (h *RoleHandler) DeleteRole(ctx context.Context, input *DeleteRoleInput) (*DeleteRoleOutput, error) {
+	before, err := h.changeableRole(input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.roleRepo.Delete(input.ID); err != nil {
+		if err.Error() == "role not found" {
+			return nil, huma.Error404NotFound("Role not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to delete role", err)
+	}
+
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityRole, input.ID, before, nil)
+
+	return &DeleteRoleOutput{
+		Body: struct {
+			Success bool   `json:"success"`
+			Message string `json:"message"`
+		}{
+			Success: true,
+			Message: "Role deleted successfully",
+		},
+	}, nil
+}
+
+// Set Role Permissions
+type SetRolePermissionsInput struct {
+	ID   int                          `path:"id" minimum:"1"`
+	Body tables.SetPermissionsRequest `json:"body"`
+}
+
+func (h *RoleHandler) SetRolePermissions(ctx context.Context, input *SetRolePermissionsInput) (*RoleOutput, error) {
+	before, err := h.changeableRole(input.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validatePermissionNames(input.Body.Permissions); err != nil {
+		return nil, err
+	}
+
+	if err := h.roleRepo.SetPermissions(input.ID, input.Body.Permissions); err != nil {
+		if err.Error() == "permission not found" {
+			return nil, huma.Error400BadRequest("Permission not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to set role permissions", err)
+	}
+
+	role, err := h.roleRepo.GetByID(input.ID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get role", err)
+	}
+
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityRole, role.ID, before, role)
+
+	return roleOutput("Role permissions updated successfully", role), nil
+}
+
+// List Permissions
+type ListPermissionsOutput struct {
+	Body []tables.Permission `json:"body"`
+}
+
+func (h *RoleHandler) ListPermissions(ctx context.Context, input *struct{}) (*ListPermissionsOutput, error) {
+	permissions, err := h.permissionRepo.List()
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to list permissions", err)
+	}
+
+	return &ListPermissionsOutput{Body: permissions}, nil
+}
+
+// Get User Access
+type GetUserAccessInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type UserAccessOutput struct {
+	Body *tables.UserAccess `json:"body"`
+}
+
+func (h *RoleHandler) GetUserAccess(ctx context.Context, input *GetUserAccessInput) (*UserAccessOutput, error) {
+	if _, err := h.userRepo.GetByID(input.ID); err != nil {
+		return nil, huma.Error404NotFound("User not found")
+	}
+
+	return h.userAccessOutput(input.ID)
+}
+
+// Set User Roles
+type SetUserRolesInput struct {
+	ID   int                        `path:"id" minimum:"1"`
+	Body tables.SetUserRolesRequest `json:"body"`
+}
+
+func (h *RoleHandler) SetUserRoles(ctx context.Context, input *SetUserRolesInput) (*UserAccessOutput, error) {
+	if err := h.validateGrantee(ctx, input.ID); err != nil {
+		return nil, err
+	}
+
+	before, err := h.authorizer.UserAccess(input.ID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get user access", err)
+	}
+
+	if err := h.roleRepo.SetUserRoles(input.ID, input.Body.RoleIDs); err != nil {
+		if err.Error() == "role not found" {
+			return nil, huma.Error400BadRequest("Role not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to set user roles", err)
+	}
+
+	return h.auditedUserAccessOutput(ctx, input.ID, before)
+}
+
+// Set User Permissions
+type SetUserPermissionsInput struct {
+	ID   int                          `path:"id" minimum:"1"`
+	Body tables.SetPermissionsRequest `json:"body"`
+}
+
+func (h *RoleHandler) SetUserPermissions(ctx context.Context, input *SetUserPermissionsInput) (*UserAccessOutput, error) {
+	if err := h.validateGrantee(ctx, input.ID); err != nil {
+		return nil, err
+	}
+	if err := validatePermissionNames(input.Body.Permissions); err != nil {
+		return nil, err
+	}
+
+	before, err := h.authorizer.UserAccess(input.ID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get user access", err)
+	}
+
+	if err := h.permissionRepo.SetUserPermissions(input.ID, input.Body.Permissions); err != nil {
+		if err.Error() == "permission not found" {
+			return nil, huma.Error400BadRequest("Permission not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to set user permissions", err)
+	}
+
+	return h.auditedUserAccessOutput(ctx, input.ID, before)
+}
+
+// changeableRole gets a role that can be deleted or have its permissions replaced. The
+// administrator role always has every permission, so someone can always manage roles.
+func (h *RoleHandler) changeableRole(id int) (*tables.RoleWithPermissions, error) {
+	role, err := h.roleRepo.GetByID(id)
+	if err != nil {
+		if err.Error() == "role not found" {
+			return nil, huma.Error404NotFound("Role not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to get role", err)
+	}
+	if role.Name == tables.AdministratorRole {
+		return nil, huma.Error409Conflict("The administrator role cannot be changed")
+	}
+	return role, nil
+}
+
+// validateGrantee checks that the roles or permissions of a user can be changed by the
+// current user
+func (h *RoleHandler) validateGrantee(ctx context.Context, userID int) error {
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+	if sessionData.UserID == userID {
+		return huma.Error400BadRequest("Cannot change your own roles or permissions")
+	}
+
+	if _, err := h.userRepo.GetByID(userID); err != nil {
+		return huma.Error404NotFound("User not found")
+	}
+	return nil
+}
+
+func (h *RoleHandler) userAccessOutput(userID int) (*UserAccessOutput, error) {
+	access, err := h.authorizer.UserAccess(userID)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get user access", err)
+	}
+	return &UserAccessOutput{Body: access}, nil
+}
+
+// auditedUserAccessOutput records a change of the roles or permissions of a user in the audit
+// log, and responds with their access after it
+func (h *RoleHandler) auditedUserAccessOutput(ctx context.Context, userID int, before *tables.UserAccess) (*UserAccessOutput, error) {
+	output, err := h.userAccessOutput(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityUser, userID, before, output.Body)
+	return output, nil
+}
+
+func roleOutput(message string, role *tables.RoleWithPermissions) *RoleOutput {
+	output := &RoleOutput{}
+	output.Body.Success = true
+	output.Body.Message = message
+	output.Body.Role = role
+	return output
+}
+
+// validatePermissionNames rejects permissions the API does not know
+func validatePermissionNames(names []string) error {
+	for _, name := range names {
+		if !tables.IsKnownPermission(name) {
+			return huma.Error400BadRequest("Unknown permission: " + name)
+		}
+	}
+	return nil
+}
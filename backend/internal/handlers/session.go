@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/services"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// SessionHandler lets users see where they are signed in and end their other sessions, and
+// admins sign users out everywhere
+type SessionHandler struct {
+	authService *services.AuthService
+}
+
+func NewSessionHandler(authService *services.AuthService) *SessionHandler {
+	return &SessionHandler{
+		authService: authService,
+	}
+}
+
+func (h *SessionHandler) Register(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "list-my-sessions",
+		Method:      http.MethodGet,
+		Path:        "/api/auth/sessions",
+		Summary:     "List my sessions",
+		Description: "List the sessions of the current user with their device, IP address and last activity, most recently used first.",
+		Tags:        []string{"Authentication"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
+	}, h.ListMine)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "revoke-my-session",
+		Method:      http.MethodDelete,
+		Path:        "/api/auth/sessions/{id}",
+		Summary:     "Revoke session",
+		Description: "Sign out one session of the current user, such as a lost or shared device.",
+		Tags:        []string{"Authentication"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
+	}, h.RevokeMine)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "revoke-other-sessions",
+		Method:      http.MethodDelete,
+		Path:        "/api/auth/sessions",
+		Summary:     "Revoke other sessions",
+		Description: "Sign out every session of the current user except the one making the request.",
+		Tags:        []string{"Authentication"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
+	}, h.RevokeOthers)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "list-user-sessions",
+		Method:      http.MethodGet,
+		Path:        "/api/users/{id}/sessions",
+		Summary:     "List user sessions",
+		Description: "List the sessions of a user with their device, IP address and last activity.",
+		Tags:        []string{"Users"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionUserManage),
+	}, h.ListUser)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "force-logout-user",
+		Method:      http.MethodDelete,
+		Path:        "/api/users/{id}/sessions",
+		Summary:     "Force logout user",
+		Description: "Sign a user out of every session.",
+		Tags:        []string{"Users"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionUserManage),
+	}, h.ForceLogout)
+}
+
+type SessionListOutput struct {
+	Body struct {
+		Sessions []tables.SessionInfo `json:"sessions"`
+	} `json:"body"`
+}
+
+type SessionActionOutput struct {
+	Body struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	} `json:"body"`
+}
+
+func sessionActionOutput(message string) *SessionActionOutput {
+	output := &SessionActionOutput{}
+	output.Body.Success = true
+	output.Body.Message = message
+	return output
+}
+
+// List My Sessions
+func (h *SessionHandler) ListMine(ctx context.Context, input *struct{}) (*SessionListOutput, error) {
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+
+	sessions, err := h.authService.ListSessions(sessionData.UserID, middleware.GetSessionIDFromContext(ctx))
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to list sessions", err)
+	}
+
+	output := &SessionListOutput{}
+	output.Body.Sessions = sessions
+	return output, nil
+}
+
+// Revoke My Session
+type RevokeSessionInput struct {
+	ID string `path:"id" minLength:"1" maxLength:"64"`
+}
+
+func (h *SessionHandler) RevokeMine(ctx context.Context, input *RevokeSessionInput) (*SessionActionOutput, error) {
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+
+	err := h.authService.RevokeSession(sessionData.UserID, input.ID)
+	if err != nil {
+		if err.Error() == "session not found" {
+			return nil, huma.Error404NotFound("Session not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to revoke session", err)
+	}
+	return sessionActionOutput("Session revoked"), nil
+}
+
+// Revoke Other Sessions
+func (h *SessionHandler) RevokeOthers(ctx context.Context, input *struct{}) (*SessionActionOutput, error) {
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+
+	count, err := h.authService.RevokeOtherSessions(sessionData.UserID, middleware.GetSessionIDFromContext(ctx))
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to revoke sessions", err)
+	}
+	return sessionActionOutput(fmt.Sprintf("%d other sessions revoked", count)), nil
+}
+
+// List User Sessions
+type UserSessionsInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+func (h *SessionHandler) ListUser(ctx context.Context, input *UserSessionsInput) (*SessionListOutput, error) {
+	sessions, err := h.authService.ListSessions(input.ID, middleware.GetSessionIDFromContext(ctx))
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to list sessions", err)
+	}
+
+	output := &SessionListOutput{}
+	output.Body.Sessions = sessions
+	return output, nil
+}
+
+// Force Logout User
+func (h *SessionHandler) ForceLogout(ctx context.Context, input *UserSessionsInput) (*SessionActionOutput, error) {
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+
+	// Users sign themselves out with logout or revoke-other-sessions
+	if sessionData.UserID == input.ID {
+		return nil, huma.Error400BadRequest("Cannot force your own logout")
+	}
+
+	err := h.authService.EndUserSessions(input.ID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to log out user", err)
+	}
+	return sessionActionOutput("User logged out of every session"), nil
+}
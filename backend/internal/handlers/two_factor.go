@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/middleware"
+	"github.com/medxamion/medxamion/internal/services"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// TwoFactorHandler lets users set up and use TOTP two-factor authentication, and admins
+// reset it for users who lost their authenticator
+type TwoFactorHandler struct {
+	twoFactorService *services.TwoFactorService
+	auditService     *services.AuditService
+}
+
+func NewTwoFactorHandler(twoFactorService *services.TwoFactorService, auditService *services.AuditService) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		twoFactorService: twoFactorService,
+		auditService:     auditService,
+	}
+}
+
+func (h *TwoFactorHandler) Register(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-two-factor",
+		Method:      http.MethodGet,
+		Path:        "/api/auth/two-factor",
+		Summary:     "Get two-factor status",
+		Description: "Get whether two-factor authentication is enabled or required for the current user, and what the session still needs.",
+		Tags:        []string{"Authentication"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireSession(),
+	}, h.GetStatus)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "setup-two-factor",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/two-factor/setup",
+		Summary:     "Set up two-factor authentication",
+		Description: "Generate a new TOTP secret for the current user. Two-factor authentication is only enabled once a code from it is confirmed.",
+		Tags:        []string{"Authentication"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireSession(),
+	}, h.Setup)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "confirm-two-factor",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/two-factor/confirm",
+		Summary:     "Confirm two-factor authentication",
+		Description: "Enable two-factor authentication with a code from the secret that was set up, and get the recovery codes.",
+		Tags:        []string{"Authentication"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireSession(),
+	}, h.Confirm)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "verify-two-factor",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/two-factor/verify",
+		Summary:     "Verify two-factor code",
+		Description: "Complete a login with a code from the authenticator app or a recovery code. Too many wrong codes sign the session out.",
+		Tags:        []string{"Authentication"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireSession(),
+	}, h.Verify)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "regenerate-recovery-codes",
+		Method:      http.MethodPost,
+		Path:        "/api/auth/two-factor/recovery-codes",
+		Summary:     "Regenerate recovery codes",
+		Description: "Replace the recovery codes of the current user, after checking a two-factor code.",
+		Tags:        []string{"Authentication"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
+	}, h.RegenerateRecoveryCodes)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "disable-two-factor",
+		Method:      http.MethodDelete,
+		Path:        "/api/auth/two-factor",
+		Summary:     "Disable two-factor authentication",
+		Description: "Turn off two-factor authentication for the current user, after checking a two-factor code. Not allowed when a role of the user requires it.",
+		Tags:        []string{"Authentication"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
+	}, h.Disable)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "reset-two-factor",
+		Method:      http.MethodDelete,
+		Path:        "/api/users/{id}/two-factor",
+		Summary:     "Reset two-factor authentication",
+		Description: "Turn off two-factor authentication for a user who lost their authenticator and recovery codes, and sign them out.",
+		Tags:        []string{"Users"},
+		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionUserManage),
+	}, h.Reset)
+}
+
+// Get Status
+type TwoFactorStatusOutput struct {
+	Body tables.TwoFactorStatus `json:"body"`
+}
+
+func (h *TwoFactorHandler) GetStatus(ctx context.Context, input *struct{}) (*TwoFactorStatusOutput, error) {
+	user := middleware.GetUserFromContext(ctx)
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+
+	status, err := h.twoFactorService.Status(user, sessionData)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("Failed to get two-factor status", err)
+	}
+	return &TwoFactorStatusOutput{Body: *status}, nil
+}
+
+// Setup
+type TwoFactorSetupOutput struct {
+	Body tables.TwoFactorSetup `json:"body"`
+}
+
+func (h *TwoFactorHandler) Setup(ctx context.Context, input *struct{}) (*TwoFactorSetupOutput, error) {
+	user := middleware.GetUserFromContext(ctx)
+
+	setup, err := h.twoFactorService.Setup(user)
+	if err != nil {
+		return nil, twoFactorError(err, "Failed to set up two-factor authentication")
+	}
+	return &TwoFactorSetupOutput{Body: *setup}, nil
+}
+
+// Confirm
+type TwoFactorCodeInput struct {
+	Body tables.TwoFactorCodeRequest `json:"body"`
+}
+
+type RecoveryCodesOutput struct {
+	Body tables.RecoveryCodesResponse `json:"body"`
+}
+
+func (h *TwoFactorHandler) Confirm(ctx context.Context, input *TwoFactorCodeInput) (*RecoveryCodesOutput, error) {
+	user := middleware.GetUserFromContext(ctx)
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+	sessionID := middleware.GetSessionIDFromContext(ctx)
+
+	codes, err := h.twoFactorService.Confirm(user, sessionID, sessionData, input.Body.Code, middleware.GetClientIPFromContext(ctx))
+	if err != nil {
+		return nil, twoFactorError(err, "Failed to confirm two-factor authentication")
+	}
+
+	return &RecoveryCodesOutput{
+		Body: tables.RecoveryCodesResponse{
+			Success:       true,
+			Message:       "Two-factor authentication enabled",
+			RecoveryCodes: codes,
+		},
+	}, nil
+}
+
+// Verify
+type VerifyTwoFactorOutput struct {
+	Body struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	} `json:"body"`
+}
+
+func (h *TwoFactorHandler) Verify(ctx context.Context, input *TwoFactorCodeInput) (*VerifyTwoFactorOutput, error) {
+	user := middleware.GetUserFromContext(ctx)
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+	sessionID := middleware.GetSessionIDFromContext(ctx)
+
+	if sessionData.TwoFactorPending != tables.TwoFactorPendingVerify {
+		return nil, huma.Error409Conflict("The session is not waiting for a two-factor code")
+	}
+
+	err := h.twoFactorService.Verify(user, sessionID, sessionData, input.Body.Code, middleware.GetClientIPFromContext(ctx))
+	if err != nil {
+		return nil, twoFactorError(err, "Failed to verify two-factor code")
+	}
+
+	return &VerifyTwoFactorOutput{
+		Body: struct {
+			Success bool   `json:"success"`
+			Message string `json:"message"`
+		}{
+			Success: true,
+			Message: "Two-factor code verified",
+		},
+	}, nil
+}
+
+// Regenerate Recovery Codes
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(ctx context.Context, input *TwoFactorCodeInput) (*RecoveryCodesOutput, error) {
+	user := middleware.GetUserFromContext(ctx)
+
+	codes, err := h.twoFactorService.RegenerateRecoveryCodes(user, input.Body.Code)
+	if err != nil {
+		return nil, twoFactorError(err, "Failed to regenerate recovery codes")
+	}
+
+	return &RecoveryCodesOutput{
+		Body: tables.RecoveryCodesResponse{
+			Success:       true,
+			Message:       "Recovery codes regenerated",
+			RecoveryCodes: codes,
+		},
+	}, nil
+}
+
+// Disable
+type DisableTwoFactorOutput struct {
+	Body struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	} `json:"body"`
+}
+
+func (h *TwoFactorHandler) Disable(ctx context.Context, input *TwoFactorCodeInput) (*DisableTwoFactorOutput, error) {
+	user := middleware.GetUserFromContext(ctx)
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+
+	err := h.twoFactorService.Disable(user, sessionData, input.Body.Code)
+	if err != nil {
+		return nil, twoFactorError(err, "Failed to disable two-factor authentication")
+	}
+
+	return &DisableTwoFactorOutput{
+		Body: struct {
+			Success bool   `json:"success"`
+			Message string `json:"message"`
+		}{
+			Success: true,
+			Message: "Two-factor authentication disabled",
+		},
+	}, nil
+}
+
+// Reset
+type ResetTwoFactorInput struct {
+	ID int `path:"id" minimum:"1"`
+}
+
+type ResetTwoFactorOutput struct {
+	Body struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	} `json:"body"`
+}
+
+func (h *TwoFactorHandler) Reset(ctx context.Context, input *ResetTwoFactorInput) (*ResetTwoFactorOutput, error) {
+	sessionData := middleware.GetSessionDataFromContext(ctx)
+
+	// Users turn off their own two-factor authentication with a code
+	if sessionData.UserID == input.ID {
+		return nil, huma.Error400BadRequest("Cannot reset your own two-factor authentication")
+	}
+
+	err := h.twoFactorService.Reset(input.ID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to reset two-factor authentication", err)
+	}
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityUser, input.ID, auditNoLink, auditAction("two_factor", "reset"))
+
+	return &ResetTwoFactorOutput{
+		Body: struct {
+			Success bool   `json:"success"`
+			Message string `json:"message"`
+		}{
+			Success: true,
+			Message: "Two-factor authentication reset",
+		},
+	}, nil
+}
+
+// twoFactorError maps the errors of the two-factor service to API errors
+func twoFactorError(err error, message string) error {
+	var blocked *services.LoginBlockedError
+	if errors.As(err, &blocked) {
+		return loginBlockedError(blocked)
+	}
+
+	switch err.Error() {
+	case "invalid two-factor code":
+		return huma.Error400BadRequest("Invalid two-factor code")
+	case "too many invalid two-factor codes":
+		return huma.Error401Unauthorized("Too many invalid two-factor codes, sign in again")
+	case "two-factor authentication already enabled", "two-factor authentication already confirmed":
+		return huma.Error409Conflict("Two-factor authentication is already enabled")
+	case "two-factor authentication not set up":
+		return huma.Error409Conflict("Set up two-factor authentication first")
+	case "two-factor authentication not enabled":
+		return huma.Error409Conflict("Two-factor authentication is not enabled")
+	case "two-factor authentication required by role":
+		return huma.Error409Conflict("Two-factor authentication is required by your role")
+	}
+	return huma.Error500InternalServerError(message, err)
+}
@@ -10,15 +10,19 @@ import (
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/medxamion/medxamion/internal/middleware"
 	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
 	"github.com/medxamion/medxamion/internal/utils"
 )
 
 type UserHandler struct {
-	userRepo *models.UserModel
+	userRepo        *models.UserModel
+	clientRepo      *models.ClientModel
+	passwordService *services.PasswordService
+	auditService    *services.AuditService
 }
 
-func NewUserHandler(userRepo *models.UserModel) *UserHandler {
-	return &UserHandler{userRepo: userRepo}
+func NewUserHandler(userRepo *models.UserModel, clientRepo *models.ClientModel, passwordService *services.PasswordService, auditService *services.AuditService) *UserHandler {
+	return &UserHandler{userRepo: userRepo, clientRepo: clientRepo, passwordService: passwordService, auditService: auditService}
 }
 
 func (h *UserHandler) Register(api huma.API) {
@@ -27,9 +31,10 @@ func (h *UserHandler) Register(api huma.API) {
 		Method:      http.MethodGet,
 		Path:        "/api/users",
 		Summary:     "List users",
-		Description: "Get a paginated list of users with optional search.",
+		Description: "Get a paginated list of the users working for the current client, with optional search. Users with client:manage see the users of every client.",
 		Tags:        []string{"Users"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.ListUsers)
 
 	huma.Register(api, huma.Operation{
@@ -40,6 +45,7 @@ func (h *UserHandler) Register(api huma.API) {
 		Description: "Get detailed information about a specific user.",
 		Tags:        []string{"Users"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.GetUser)
 
 	huma.Register(api, huma.Operation{
@@ -47,9 +53,10 @@ func (h *UserHandler) Register(api huma.API) {
 		Method:      http.MethodPost,
 		Path:        "/api/users",
 		Summary:     "Create new user",
-		Description: "Create a new user account.",
+		Description: "Create a new user account working for the current client.",
 		Tags:        []string{"Users"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionUserManage),
 	}, h.CreateUser)
 
 	huma.Register(api, huma.Operation{
@@ -60,6 +67,7 @@ func (h *UserHandler) Register(api huma.API) {
 		Description: "Update user information.",
 		Tags:        []string{"Users"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.UpdateUser)
 
 	huma.Register(api, huma.Operation{
@@ -70,6 +78,7 @@ func (h *UserHandler) Register(api huma.API) {
 		Description: "Soft delete a user account.",
 		Tags:        []string{"Users"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequirePermission(tables.PermissionUserManage),
 	}, h.DeleteUser)
 
 	huma.Register(api, huma.Operation{
@@ -77,9 +86,10 @@ func (h *UserHandler) Register(api huma.API) {
 		Method:      http.MethodPost,
 		Path:        "/api/users/{id}/change-password",
 		Summary:     "Change user password",
-		Description: "Change password for a user.",
+		Description: "Change password for a user. Users changing their own password must give the current one. A password set by a user manager must be changed at the user's next login, and signs the user out.",
 		Tags:        []string{"Users"},
 		Security:    []map[string][]string{{"session": {}}},
+		Metadata:    middleware.RequireAuthentication(),
 	}, h.ChangePassword)
 }
 
@@ -95,18 +105,17 @@ type ListUsersOutput struct {
 }
 
 func (h *UserHandler) ListUsers(ctx context.Context, input *ListUsersInput) (*ListUsersOutput, error) {
-	// Check if user is authenticated
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	pagination := tables.Pagination{
 		Page:    input.Page,
 		PerPage: input.PerPage,
 	}
 
-	result, err := h.userRepo.List(pagination, input.Search)
+	scope := clientScope(ctx)
+	if middleware.GetSessionDataFromContext(ctx).HasPermission(tables.PermissionClientManage) {
+		scope = models.AllClients()
+	}
+
+	result, err := h.userRepo.List(scope, pagination, input.Search)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to get users", err)
 	}
@@ -127,11 +136,6 @@ type GetUserOutput struct {
 }
 
 func (h *UserHandler) GetUser(ctx context.Context, input *GetUserInput) (*GetUserOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
 	user, err := h.userRepo.GetByID(input.ID)
 	if err != nil {
 		return nil, huma.Error404NotFound("User not found")
@@ -170,21 +174,8 @@ type CreateUserOutput struct {
 }
 
 func (h *UserHandler) CreateUser(ctx context.Context, input *CreateUserInput) (*CreateUserOutput, error) {
-	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Check if user has admin role (you can adjust this based on your requirements)
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
+	if err := h.passwordService.ValidateNew(input.Body.Password); err != nil {
+		return nil, passwordError(err, "Failed to check password")
 	}
 
 	// Hash password
@@ -210,6 +201,8 @@ func (h *UserHandler) CreateUser(ctx context.Context, input *CreateUserInput) (*
 		Birthplace:       input.Body.Birthplace,
 		Birthday:         birthday,
 		ProfilePhotoPath: input.Body.ProfilePhotoPath,
+
+		MustChangePassword: input.Body.MustChangePassword,
 	}
 
 	err = h.userRepo.Create(user)
@@ -217,6 +210,18 @@ func (h *UserHandler) CreateUser(ctx context.Context, input *CreateUserInput) (*
 		return nil, huma.Error500InternalServerError("Failed to create user", err)
 	}
 
+	if clientID := middleware.GetSessionDataFromContext(ctx).ClientID; clientID != 0 {
+		if err := h.clientRepo.AddUser(clientID, user.ID); err != nil {
+			return nil, huma.Error500InternalServerError("Failed to add user to client", err)
+		}
+	}
+
+	if err := h.passwordService.RecordInitial(tables.PasswordAccountUser, user.ID, hashedPassword, user.MustChangePassword); err != nil {
+		return nil, huma.Error500InternalServerError("Failed to record password", err)
+	}
+
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityUser, user.ID, nil, user)
+
 	// Remove password from response
 	user.Password = ""
 
@@ -253,18 +258,18 @@ func (h *UserHandler) UpdateUser(ctx context.Context, input *UpdateUserInput) (*
 		return nil, huma.Error401Unauthorized("Authentication required")
 	}
 
-	// Users can update their own profile, or admins can update any user
+	// Users can update their own profile, or user managers can update any user
 	isOwnProfile := sessionData.UserID == input.ID
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
+	if !isOwnProfile && !sessionData.HasPermission(tables.PermissionUserManage) {
+		return nil, huma.Error403Forbidden("Permission denied")
 	}
 
-	if !isOwnProfile && !hasAdminRole {
-		return nil, huma.Error403Forbidden("Permission denied")
+	before, err := h.userRepo.GetByID(input.ID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to get user", err)
 	}
 
 	user, err := h.userRepo.Update(input.ID, &input.Body)
@@ -272,6 +277,8 @@ func (h *UserHandler) UpdateUser(ctx context.Context, input *UpdateUserInput) (*
 		return nil, huma.Error500InternalServerError("Failed to update user", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityUser, user.ID, before, user)
+
 	// Remove password from response
 	user.Password = ""
 
@@ -302,32 +309,27 @@ type DeleteUserOutput struct {
 
 func (h *UserHandler) DeleteUser(ctx context.Context, input *DeleteUserInput) (*DeleteUserOutput, error) {
 	sessionData := middleware.GetSessionDataFromContext(ctx)
-	if sessionData == nil {
-		return nil, huma.Error401Unauthorized("Authentication required")
-	}
-
-	// Only admins can delete users
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-	if !hasAdminRole {
-		return nil, huma.Error403Forbidden("Admin role required")
-	}
 
 	// Prevent self-deletion
 	if sessionData.UserID == input.ID {
 		return nil, huma.Error400BadRequest("Cannot delete your own account")
 	}
 
-	err := h.userRepo.Delete(input.ID)
+	before, err := h.userRepo.GetByID(input.ID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			return nil, huma.Error404NotFound("User not found")
+		}
+		return nil, huma.Error500InternalServerError("Failed to get user", err)
+	}
+
+	err = h.userRepo.Delete(input.ID)
 	if err != nil {
 		return nil, huma.Error500InternalServerError("Failed to delete user", err)
 	}
 
+	h.auditService.Record(auditActor(ctx), tables.AuditEntityUser, input.ID, before, nil)
+
 	return &DeleteUserOutput{
 		Body: struct {
 			Success bool   `json:"success"`
@@ -358,17 +360,9 @@ func (h *UserHandler) ChangePassword(ctx context.Context, input *ChangePasswordI
 		return nil, huma.Error401Unauthorized("Authentication required")
 	}
 
-	// Users can change their own password, or admins can change any user's password
+	// Users can change their own password, or user managers can change any user's password
 	isOwnProfile := sessionData.UserID == input.ID
-	hasAdminRole := false
-	for _, role := range sessionData.Roles {
-		if role.Name == "administrator" {
-			hasAdminRole = true
-			break
-		}
-	}
-
-	if !isOwnProfile && !hasAdminRole {
+	if !isOwnProfile && !sessionData.HasPermission(tables.PermissionUserManage) {
 		return nil, huma.Error403Forbidden("Permission denied")
 	}
 
@@ -377,28 +371,14 @@ func (h *UserHandler) ChangePassword(ctx context.Context, input *ChangePasswordI
 		return nil, huma.Error400BadRequest("New password and confirmation do not match")
 	}
 
-	// If changing own password, verify current password
+	var err error
 	if isOwnProfile {
-		user, err := h.userRepo.GetByID(input.ID)
-		if err != nil {
-			return nil, huma.Error404NotFound("User not found")
-		}
-
-		if !utils.CheckPasswordHash(input.Body.CurrentPassword, user.Password) {
-			return nil, huma.Error400BadRequest("Current password is incorrect")
-		}
+		err = h.passwordService.ChangeUserPassword(input.ID, input.Body.CurrentPassword, input.Body.NewPassword, middleware.GetSessionIDFromContext(ctx))
+	} else {
+		err = h.passwordService.SetUserPassword(input.ID, input.Body.NewPassword)
 	}
-
-	// Hash new password
-	hashedPassword, err := utils.HashPassword(input.Body.NewPassword)
-	if err != nil {
-		return nil, huma.Error500InternalServerError("Failed to hash password", err)
-	}
-
-	// Update password in database
-	err = h.userRepo.UpdatePassword(input.ID, hashedPassword)
 	if err != nil {
-		return nil, huma.Error500InternalServerError("Failed to update password", err)
+		return nil, passwordError(err, "Failed to update password")
 	}
 
 	return &ChangePasswordOutput{
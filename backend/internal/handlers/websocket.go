@@ -4,28 +4,67 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/medxamion/medxamion/internal/config"
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/middleware"
 	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/services"
+	"github.com/medxamion/medxamion/internal/tables"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow connections from localhost in development
-		// TODO: Configure this properly for production
-		return true
-	},
-}
+// Close codes sent when a WebSocket client fails authentication or authorization
+const (
+	wsCloseUnauthorized = 4401
+	wsCloseForbidden    = 4403
+)
+
+// Number of deltas kept per delivery so reconnecting clients can resume
+const deltaBufferSize = 1024
+
+// Rooms without clients are dropped after this long without deltas
+const idleRoomTimeout = time.Hour
 
 type WebSocketHub struct {
-	// Map of delivery ID to connected clients
-	deliveryClients map[int]map[*WebSocketClient]bool
-	mu              sync.RWMutex
-	deliveryRepo    *models.DeliveryModel
+	// Map of delivery ID to its clients and recent deltas
+	rooms          map[int]*deliveryRoom
+	mu             sync.Mutex
+	assignmentRepo *models.DeliveryAssignmentModel
+	clientRepo     *models.ClientModel
+	authService    *services.AuthService
+	upgrader       websocket.Upgrader
+	allowedOrigins []string
+	authTimeout    time.Duration
+	snapshotLoader SnapshotLoader
+
+	// Deltas are fanned out to the other replicas through PostgreSQL notifications;
+	// instanceID lets a replica skip the notifications it sent itself
+	db         *database.DB
+	instanceID string
+}
+
+// SnapshotLoader loads the full progress of a delivery for clients that cannot resume
+type SnapshotLoader func(deliveryID int) (interface{}, error)
+
+// deliveryRoom holds the subscribed clients and the recent deltas of one delivery.
+// Sequence numbers are only meaningful within a stream; a new stream starts when the
+// room is created (e.g. after a restart), so clients must compare the stream ID.
+type deliveryRoom struct {
+	clients      map[*WebSocketClient]bool
+	streamID     string
+	seq          uint64
+	deltas       []DeltaMessage
+	lastActivity time.Time
+	// publishMu keeps deltas, replays and snapshots in sequence order for every client
+	publishMu sync.Mutex
 }
 
 type WebSocketClient struct {
@@ -34,34 +73,88 @@ type WebSocketClient struct {
 	hub           *WebSocketHub
 	send          chan []byte
 	authenticated bool
+	// Session the client authenticated with, checked periodically so revoked sessions
+	// stop receiving progress
+	sessionID    string
+	closeMessage []byte
+	closed       bool
+	sendMu       sync.Mutex
 }
 
-type ProgressUpdate struct {
+// DeltaMessage is an incremental change of one participant's progress. Values are
+// absolute (e.g. questions_answered), so applying a delta twice is harmless.
+type DeltaMessage struct {
+	Type       string                 `json:"type"`
+	DeliveryID int                    `json:"delivery_id"`
+	StreamID   string                 `json:"stream_id"`
+	Seq        uint64                 `json:"seq"`
+	Event      string                 `json:"event"`
+	Data       map[string]interface{} `json:"data"`
+	Timestamp  time.Time              `json:"timestamp"`
+}
+
+// SnapshotMessage is the full progress of a delivery; deltas after Seq follow it
+type SnapshotMessage struct {
 	Type       string      `json:"type"`
 	DeliveryID int         `json:"delivery_id"`
+	StreamID   string      `json:"stream_id"`
+	Seq        uint64      `json:"seq"`
 	Data       interface{} `json:"data"`
 	Timestamp  time.Time   `json:"timestamp"`
 }
 
+// StreamStatusMessage answers a resume request ("resumed" or "snapshot_required")
+type StreamStatusMessage struct {
+	Type       string `json:"type"`
+	DeliveryID int    `json:"delivery_id"`
+	StreamID   string `json:"stream_id"`
+	Seq        uint64 `json:"seq"`
+}
+
 type AuthMessage struct {
 	Type      string `json:"type"`
 	SessionID string `json:"session_id"`
 }
 
+// ResumeMessage asks for the deltas after LastSeq of a stream
+type ResumeMessage struct {
+	Type     string `json:"type"`
+	StreamID string `json:"stream_id"`
+	LastSeq  uint64 `json:"last_seq"`
+}
+
 type AuthResponse struct {
-	Type        string `json:"type"`
-	Success     bool   `json:"success"`
-	Message     string `json:"message"`
-	DeliveryID  int    `json:"delivery_id,omitempty"`
+	Type       string `json:"type"`
+	Success    bool   `json:"success"`
+	Message    string `json:"message"`
+	DeliveryID int    `json:"delivery_id,omitempty"`
+	StreamID   string `json:"stream_id,omitempty"`
+	Seq        uint64 `json:"seq,omitempty"`
 }
 
-func NewWebSocketHub(deliveryRepo *models.DeliveryModel) *WebSocketHub {
-	return &WebSocketHub{
-		deliveryClients: make(map[int]map[*WebSocketClient]bool),
-		deliveryRepo:    deliveryRepo,
+func NewWebSocketHub(db *database.DB, assignmentRepo *models.DeliveryAssignmentModel, clientRepo *models.ClientModel, authService *services.AuthService, cfg *config.Config) *WebSocketHub {
+	h := &WebSocketHub{
+		db:             db,
+		instanceID:     uuid.NewString(),
+		rooms:          make(map[int]*deliveryRoom),
+		assignmentRepo: assignmentRepo,
+		clientRepo:     clientRepo,
+		authService:    authService,
+		allowedOrigins: cfg.WebSocketAllowedOrigins,
+		authTimeout:    cfg.WebSocketAuthTimeout,
 	}
+	h.upgrader = websocket.Upgrader{CheckOrigin: h.checkOrigin}
+	return h
+}
+
+// SetSnapshotLoader sets the source of full snapshots
+func (h *WebSocketHub) SetSnapshotLoader(loader SnapshotLoader) {
+	h.snapshotLoader = loader
 }
 
+// ServeWS upgrades a live-monitoring connection. A session cookie (or X-Session-ID header)
+// is authorized before the upgrade; otherwise the client must send an auth message within
+// the configured timeout. Clients receive no progress data until they are authorized.
 func (h *WebSocketHub) ServeWS(w http.ResponseWriter, r *http.Request) {
 	// Get delivery ID from URL
 	deliveryIDStr := chi.URLParam(r, "id")
@@ -71,163 +164,305 @@ func (h *WebSocketHub) ServeWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// WebSocket connections will authenticate via message after connection
+	// Session resolved by the session middleware, if any
+	sessionData := middleware.GetSessionDataFromContext(r.Context())
+	if sessionData != nil {
+		allowed, err := h.canMonitor(sessionData, deliveryID)
+		if err != nil {
+			log.Printf("Failed to check delivery permission: %v", err)
+			http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			http.Error(w, "Committee or scorer access required for this delivery", http.StatusForbidden)
+			return
+		}
+	}
 
-	// Upgrade connection to WebSocket
-	conn, err := upgrader.Upgrade(w, r, nil)
+	// Upgrade connection to WebSocket (origin is checked by the upgrader)
+	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade failed: %v", err)
 		return
 	}
 
 	client := &WebSocketClient{
-		conn:          conn,
-		deliveryID:    deliveryID,
-		hub:           h,
-		send:          make(chan []byte, 256),
-		authenticated: false,
+		conn:       conn,
+		deliveryID: deliveryID,
+		hub:        h,
+		send:       make(chan []byte, 256),
 	}
 
-	h.addClient(client)
-
-	// Send initial progress data
-	h.sendProgressUpdate(client)
-
 	// Start goroutines for reading and writing
 	go client.writePump()
+	if sessionData != nil {
+		client.authorize(sessionData.UserID, middleware.GetSessionIDFromContext(r.Context()))
+	}
 	go client.readPump()
 }
 
-func (h *WebSocketHub) addClient(client *WebSocketClient) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+// checkOrigin accepts requests without an Origin header (non-browser clients), requests
+// from the API's own host and origins listed in the configuration
+func (h *WebSocketHub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, allowed := range h.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+
+	log.Printf("Rejected WebSocket connection from origin %s", origin)
+	return false
+}
+
+// canMonitor checks that the user is an admin or an active committee member or scorer of the delivery
+func (h *WebSocketHub) canMonitor(sessionData *tables.SessionData, deliveryID int) (bool, error) {
+	if sessionData.TwoFactorPending != "" {
+		return false, nil
+	}
+	// Only deliveries of the client the session works with
+	inClient, err := h.clientRepo.DeliveryInClient(deliveryID, sessionData.ClientID)
+	if err != nil || !inClient {
+		return false, err
+	}
+	if sessionData.HasPermission(tables.PermissionDeliveryControl) {
+		return true, nil
+	}
+	return h.assignmentRepo.CheckUserDeliveryPermission(sessionData.UserID, deliveryID, "")
+}
+
+// room returns the room of a delivery, creating a new stream if needed. h.mu must be held.
+func (h *WebSocketHub) room(deliveryID int) *deliveryRoom {
+	room, ok := h.rooms[deliveryID]
+	if !ok {
+		room = &deliveryRoom{
+			clients:      make(map[*WebSocketClient]bool),
+			streamID:     uuid.NewString(),
+			lastActivity: time.Now(),
+		}
+		h.rooms[deliveryID] = room
+	}
+	return room
+}
 
-	if h.deliveryClients[client.deliveryID] == nil {
-		h.deliveryClients[client.deliveryID] = make(map[*WebSocketClient]bool)
+// lockedRoom returns the room of a delivery with its publish lock held
+func (h *WebSocketHub) lockedRoom(deliveryID int) *deliveryRoom {
+	for {
+		h.mu.Lock()
+		room := h.room(deliveryID)
+		h.mu.Unlock()
+
+		room.publishMu.Lock()
+
+		// The room may have been pruned while waiting for the lock
+		h.mu.Lock()
+		current := h.rooms[deliveryID] == room
+		h.mu.Unlock()
+		if current {
+			return room
+		}
+		room.publishMu.Unlock()
 	}
-	h.deliveryClients[client.deliveryID][client] = true
+}
+
+// pruneIdleRooms drops rooms nobody watches that have been quiet for a while. h.mu must be held.
+func (h *WebSocketHub) pruneIdleRooms() {
+	for deliveryID, room := range h.rooms {
+		if len(room.clients) == 0 && time.Since(room.lastActivity) > idleRoomTimeout {
+			delete(h.rooms, deliveryID)
+		}
+	}
+}
+
+// addClient subscribes a client to deltas. h.mu must be held.
+func (h *WebSocketHub) addClient(room *deliveryRoom, client *WebSocketClient) {
+	room.clients[client] = true
 
 	log.Printf("Client connected to delivery %d. Total clients: %d",
-		client.deliveryID, len(h.deliveryClients[client.deliveryID]))
+		client.deliveryID, len(room.clients))
 }
 
 func (h *WebSocketHub) removeClient(client *WebSocketClient) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	if clients, ok := h.deliveryClients[client.deliveryID]; ok {
-		if _, ok := clients[client]; ok {
-			delete(clients, client)
-			close(client.send)
-
-			// Clean up empty delivery rooms
-			if len(clients) == 0 {
-				delete(h.deliveryClients, client.deliveryID)
-			}
+	if room, ok := h.rooms[client.deliveryID]; ok {
+		if _, ok := room.clients[client]; ok {
+			delete(room.clients, client)
+			room.lastActivity = time.Now()
 
 			log.Printf("Client disconnected from delivery %d. Remaining clients: %d",
-				client.deliveryID, len(clients))
+				client.deliveryID, len(room.clients))
 		}
 	}
+	h.mu.Unlock()
+
+	client.close(nil)
 }
 
-func (h *WebSocketHub) sendProgressUpdate(client *WebSocketClient) {
-	// Only send updates to authenticated clients
-	if !client.authenticated {
-		return
+// publishLocal assigns the next sequence number to a participant change, keeps it for
+// resuming clients and pushes it to every client of the delivery connected to this replica
+func (h *WebSocketHub) publishLocal(deliveryID int, event string, data map[string]interface{}) {
+	room := h.lockedRoom(deliveryID)
+	defer room.publishMu.Unlock()
+
+	h.mu.Lock()
+	room.seq++
+	delta := DeltaMessage{
+		Type:       "delta",
+		DeliveryID: deliveryID,
+		StreamID:   room.streamID,
+		Seq:        room.seq,
+		Event:      event,
+		Data:       data,
+		Timestamp:  time.Now(),
+	}
+	if len(room.deltas) >= deltaBufferSize {
+		room.deltas = append(room.deltas[:0], room.deltas[1:]...)
 	}
+	room.deltas = append(room.deltas, delta)
+	room.lastActivity = delta.Timestamp
 
-	// Get current progress data
-	progressData, err := h.deliveryRepo.GetParticipantProgress(client.deliveryID)
-	if err != nil {
-		log.Printf("Error getting progress data: %v", err)
+	clients := make([]*WebSocketClient, 0, len(room.clients))
+	for client := range room.clients {
+		clients = append(clients, client)
+	}
+	h.pruneIdleRooms()
+	h.mu.Unlock()
+
+	if len(clients) == 0 {
 		return
 	}
 
-	// Get delivery info
-	delivery, err := h.deliveryRepo.GetByID(client.deliveryID)
+	message, err := json.Marshal(delta)
 	if err != nil {
-		log.Printf("Error getting delivery: %v", err)
+		log.Printf("Error marshaling delta: %v", err)
 		return
 	}
+	for _, client := range clients {
+		client.trySend(message)
+	}
+}
 
-	// Calculate stats
-	var completedCount, inProgressCount int
-	for _, data := range progressData {
-		if progressMap, ok := data.(map[string]interface{}); ok {
-			if attemptData, ok := progressMap["attempt"].(map[string]interface{}); ok {
-				status := attemptData["status"].(string)
-				switch status {
-				case "completed":
-					completedCount++
-				case "in_progress":
-					inProgressCount++
-				}
-			}
+// resume replays the deltas a client missed and subscribes it. When the deltas are no
+// longer available (other stream, or too far behind) the client is told to request a snapshot.
+func (h *WebSocketHub) resume(client *WebSocketClient, streamID string, lastSeq uint64) {
+	room := h.lockedRoom(client.deliveryID)
+	defer room.publishMu.Unlock()
+
+	h.mu.Lock()
+	status := StreamStatusMessage{
+		Type:       "snapshot_required",
+		DeliveryID: client.deliveryID,
+		StreamID:   room.streamID,
+		Seq:        room.seq,
+	}
+
+	var missed []DeltaMessage
+	canResume := streamID == room.streamID && lastSeq <= room.seq
+	if canResume && lastSeq < room.seq {
+		// The buffer must still hold the delta right after lastSeq
+		canResume = len(room.deltas) > 0 && room.deltas[0].Seq <= lastSeq+1
+		if canResume {
+			missed = room.deltas[len(room.deltas)-int(room.seq-lastSeq):]
+			missed = append([]DeltaMessage(nil), missed...)
 		}
 	}
+	if canResume {
+		status.Type = "resumed"
+		h.addClient(room, client)
+	}
+	h.mu.Unlock()
 
-	// Prepare update message
-	update := ProgressUpdate{
-		Type:       "progress_update",
-		DeliveryID: client.deliveryID,
-		Data: map[string]interface{}{
-			"delivery": map[string]interface{}{
-				"id":                delivery.ID,
-				"name":              delivery.Name,
-				"display_name":      delivery.DisplayName,
-				"participant_count": len(progressData),
-				"completed_count":   completedCount,
-				"in_progress_count": inProgressCount,
-			},
-			"participants": progressData,
-		},
-		Timestamp: time.Now(),
-	}
-
-	message, err := json.Marshal(update)
+	for _, delta := range missed {
+		client.sendJSON(delta)
+	}
+	client.sendJSON(status)
+}
+
+// snapshot sends the full progress of the delivery and subscribes the client to the deltas after it
+func (h *WebSocketHub) snapshot(client *WebSocketClient) {
+	if h.snapshotLoader == nil {
+		return
+	}
+
+	room := h.lockedRoom(client.deliveryID)
+	defer room.publishMu.Unlock()
+
+	data, err := h.snapshotLoader(client.deliveryID)
 	if err != nil {
-		log.Printf("Error marshaling update: %v", err)
+		log.Printf("Error loading snapshot for delivery %d: %v", client.deliveryID, err)
+		client.sendJSON(map[string]string{"type": "error", "message": "Failed to load progress snapshot"})
 		return
 	}
 
-	select {
-	case client.send <- message:
-	default:
-		// Client's send channel is full, close it
-		h.removeClient(client)
+	h.mu.Lock()
+	message := SnapshotMessage{
+		Type:       "snapshot",
+		DeliveryID: client.deliveryID,
+		StreamID:   room.streamID,
+		Seq:        room.seq,
+		Data:       data,
+		Timestamp:  time.Now(),
 	}
+	h.addClient(room, client)
+	h.mu.Unlock()
+
+	client.sendJSON(message)
 }
 
-// BroadcastProgressUpdate sends updates to all clients watching a delivery
-func (h *WebSocketHub) BroadcastProgressUpdate(deliveryID int) {
-	h.mu.RLock()
-	clients := h.deliveryClients[deliveryID]
-	h.mu.RUnlock()
+// authorize marks the client as authenticated. It receives progress once it asks
+// for a snapshot or resumes a stream.
+func (c *WebSocketClient) authorize(userID int, sessionID string) {
+	c.authenticated = true
+	c.sessionID = sessionID
+	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	log.Printf("User %d authorized for live monitoring of delivery %d", userID, c.deliveryID)
 
-	for client := range clients {
-		h.sendProgressUpdate(client)
-	}
+	c.sendAuthResponse(true, "Authentication successful", c.deliveryID)
 }
 
-// StartPeriodicUpdates sends updates every few seconds (as fallback)
-func (h *WebSocketHub) StartPeriodicUpdates() {
-	// Reduced frequency - now mainly serves as fallback
-	ticker := time.NewTicker(30 * time.Second)
-	go func() {
-		for range ticker.C {
-			h.mu.RLock()
-			deliveryIDs := make([]int, 0, len(h.deliveryClients))
-			for id := range h.deliveryClients {
-				deliveryIDs = append(deliveryIDs, id)
-			}
-			h.mu.RUnlock()
+// reject tells the client why it was refused and closes the connection
+func (c *WebSocketClient) reject(code int, message string) {
+	c.sendAuthResponse(false, message, 0)
+	c.close(websocket.FormatCloseMessage(code, message))
+}
 
-			for _, deliveryID := range deliveryIDs {
-				h.BroadcastProgressUpdate(deliveryID)
-			}
-		}
-	}()
+// close stops the write pump; closeMessage is sent as the close frame
+func (c *WebSocketClient) close(closeMessage []byte) {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.closeMessage = closeMessage
+	close(c.send)
+}
+
+// trySend queues a message, closing the client when its send channel is full
+func (c *WebSocketClient) trySend(message []byte) {
+	c.sendMu.Lock()
+	if c.closed {
+		c.sendMu.Unlock()
+		return
+	}
+	select {
+	case c.send <- message:
+		c.sendMu.Unlock()
+	default:
+		c.sendMu.Unlock()
+		// Client's send channel is full, close it
+		c.hub.removeClient(c)
+	}
 }
 
 func (c *WebSocketClient) readPump() {
@@ -236,9 +471,14 @@ func (c *WebSocketClient) readPump() {
 		c.conn.Close()
 	}()
 
-	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	// Clients without a session cookie must authenticate before the deadline
+	if !c.authenticated {
+		c.conn.SetReadDeadline(time.Now().Add(c.hub.authTimeout))
+	}
 	c.conn.SetPongHandler(func(string) error {
-		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		if c.authenticated {
+			c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		}
 		return nil
 	})
 
@@ -264,9 +504,29 @@ func (c *WebSocketClient) readPump() {
 			continue
 		}
 
+		if !c.authenticated {
+			if msgType != "auth" {
+				continue
+			}
+			if !c.handleAuthMessage(messageBytes) {
+				return
+			}
+			continue
+		}
+
 		switch msgType {
 		case "auth":
-			c.handleAuthMessage(messageBytes)
+			// Already authorized (session cookie or earlier auth message)
+			c.sendAuthResponse(true, "Authentication successful", c.deliveryID)
+		case "resume":
+			var resumeMsg ResumeMessage
+			if err := json.Unmarshal(messageBytes, &resumeMsg); err != nil {
+				log.Printf("Failed to parse resume message: %v", err)
+				continue
+			}
+			c.hub.resume(c, resumeMsg.StreamID, resumeMsg.LastSeq)
+		case "snapshot":
+			c.hub.snapshot(c)
 		case "ping":
 			// Respond to ping with pong
 			c.sendPong()
@@ -274,28 +534,40 @@ func (c *WebSocketClient) readPump() {
 	}
 }
 
-func (c *WebSocketClient) handleAuthMessage(messageBytes []byte) {
+// handleAuthMessage validates the session sent by the client and checks its access to the
+// delivery. It returns false when the connection was rejected.
+func (c *WebSocketClient) handleAuthMessage(messageBytes []byte) bool {
 	var authMsg AuthMessage
 	if err := json.Unmarshal(messageBytes, &authMsg); err != nil {
 		log.Printf("Failed to parse auth message: %v", err)
-		c.sendAuthResponse(false, "Invalid auth message format", 0)
-		return
+		c.reject(wsCloseUnauthorized, "Invalid auth message format")
+		return false
 	}
 
-	// Validate session using the auth service via middleware
-	// For now, we'll accept any session_id and authenticate the client
-	// In production, you would validate the session_id against your session store
 	if authMsg.SessionID == "" {
-		c.sendAuthResponse(false, "Session ID is required", 0)
-		return
+		c.reject(wsCloseUnauthorized, "Session ID is required")
+		return false
 	}
 
-	// Mark client as authenticated
-	c.authenticated = true
-	log.Printf("Client authenticated for delivery %d with session %s", c.deliveryID, authMsg.SessionID)
-	
-	// Send success response with delivery ID
-	c.sendAuthResponse(true, "Authentication successful", c.deliveryID)
+	_, sessionData, err := c.hub.authService.ValidateSession(authMsg.SessionID)
+	if err != nil {
+		c.reject(wsCloseUnauthorized, "Invalid or expired session")
+		return false
+	}
+
+	allowed, err := c.hub.canMonitor(sessionData, c.deliveryID)
+	if err != nil {
+		log.Printf("Failed to check delivery permission: %v", err)
+		c.reject(websocket.CloseInternalServerErr, "Failed to check permissions")
+		return false
+	}
+	if !allowed {
+		c.reject(wsCloseForbidden, "Committee or scorer access required for this delivery")
+		return false
+	}
+
+	c.authorize(sessionData.UserID, authMsg.SessionID)
+	return true
 }
 
 func (c *WebSocketClient) sendAuthResponse(success bool, message string, deliveryID int) {
@@ -304,42 +576,36 @@ func (c *WebSocketClient) sendAuthResponse(success bool, message string, deliver
 		Success: success,
 		Message: message,
 	}
-	
+
 	if success {
 		response.DeliveryID = deliveryID
+
+		// Current stream position, so the client knows whether it can resume
+		c.hub.mu.Lock()
+		room := c.hub.room(deliveryID)
+		response.StreamID = room.streamID
+		response.Seq = room.seq
+		c.hub.mu.Unlock()
 	}
 
-	responseBytes, err := json.Marshal(response)
+	c.sendJSON(response)
+}
+
+// sendJSON marshals and queues a message
+func (c *WebSocketClient) sendJSON(message interface{}) {
+	messageBytes, err := json.Marshal(message)
 	if err != nil {
-		log.Printf("Failed to marshal auth response: %v", err)
+		log.Printf("Failed to marshal WebSocket message: %v", err)
 		return
 	}
 
-	select {
-	case c.send <- responseBytes:
-	default:
-		// Client's send channel is full, close it
-		c.hub.removeClient(c)
-	}
+	c.trySend(messageBytes)
 }
 
 func (c *WebSocketClient) sendPong() {
-	pongResponse := map[string]string{
+	c.sendJSON(map[string]string{
 		"type": "pong",
-	}
-	
-	responseBytes, err := json.Marshal(pongResponse)
-	if err != nil {
-		log.Printf("Failed to marshal pong response: %v", err)
-		return
-	}
-
-	select {
-	case c.send <- responseBytes:
-	default:
-		// Client's send channel is full, close it
-		c.hub.removeClient(c)
-	}
+	})
 }
 
 func (c *WebSocketClient) writePump() {
@@ -354,13 +620,17 @@ func (c *WebSocketClient) writePump() {
 		case message, ok := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				c.conn.WriteMessage(websocket.CloseMessage, c.closeMessage)
 				return
 			}
 
 			c.conn.WriteMessage(websocket.TextMessage, message)
 
 		case <-ticker.C:
+			if c.authenticated && !c.hub.authService.SessionExists(c.sessionID) {
+				c.close(websocket.FormatCloseMessage(wsCloseUnauthorized, "Session ended"))
+				continue
+			}
 			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
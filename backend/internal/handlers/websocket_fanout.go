@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// deltaChannel is the PostgreSQL notification channel deltas are fanned out on
+const deltaChannel = "delivery_deltas"
+
+// maxDeltaNotification keeps notifications under the PostgreSQL payload limit (8000 bytes)
+const maxDeltaNotification = 7900
+
+// deltaNotification is a delta sent to the other coordinator replicas
+type deltaNotification struct {
+	Origin     string                 `json:"origin"`
+	DeliveryID int                    `json:"delivery_id"`
+	Event      string                 `json:"event"`
+	Data       map[string]interface{} `json:"data"`
+}
+
+// PublishDelta pushes a participant change to the clients of the delivery on this replica
+// and notifies the other replicas, which push it to their own clients. Each replica numbers
+// the deltas of its own stream.
+func (h *WebSocketHub) PublishDelta(deliveryID int, event string, data map[string]interface{}) {
+	h.publishLocal(deliveryID, event, data)
+
+	if h.db == nil {
+		return
+	}
+
+	payload, err := json.Marshal(deltaNotification{
+		Origin:     h.instanceID,
+		DeliveryID: deliveryID,
+		Event:      event,
+		Data:       data,
+	})
+	if err != nil {
+		log.Printf("Error marshaling delta notification: %v", err)
+		return
+	}
+	if len(payload) > maxDeltaNotification {
+		log.Printf("Delta %s of delivery %d is too large to reach other replicas (%d bytes)", event, deliveryID, len(payload))
+		return
+	}
+
+	if _, err := h.db.Exec(`SELECT pg_notify($1, $2)`, deltaChannel, string(payload)); err != nil {
+		log.Printf("Failed to notify other replicas of delta %s of delivery %d: %v", event, deliveryID, err)
+	}
+}
+
+// ListenForDeltas pushes the deltas published on other replicas to the clients of this
+// replica until ctx is done. Deltas sent while the listener reconnects are not received;
+// clients catch up with a snapshot after their next reconnect.
+func (h *WebSocketHub) ListenForDeltas(ctx context.Context, databaseURL string) error {
+	listener := pq.NewListener(databaseURL, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			log.Printf("Delta listener disconnected: %v", err)
+		case pq.ListenerEventReconnected:
+			log.Println("Delta listener reconnected")
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Printf("Delta listener failed to connect: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(deltaChannel); err != nil {
+		return err
+	}
+
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ping.C:
+			go listener.Ping()
+		case notification := <-listener.Notify:
+			// nil after a reconnect
+			if notification == nil {
+				continue
+			}
+
+			var delta deltaNotification
+			if err := json.Unmarshal([]byte(notification.Extra), &delta); err != nil {
+				log.Printf("Invalid delta notification: %v", err)
+				continue
+			}
+			if delta.Origin == h.instanceID {
+				continue
+			}
+			h.publishLocal(delta.DeliveryID, delta.Event, delta.Data)
+		}
+	}
+}
@@ -14,6 +14,7 @@ type contextKey string
 const (
 	UserContextKey        contextKey = "user"
 	SessionDataContextKey contextKey = "session_data"
+	SessionIDContextKey   contextKey = "session_id"
 )
 
 type AuthMiddleware struct {
@@ -69,6 +70,7 @@ func (m *AuthMiddleware) SessionMiddleware() func(http.Handler) http.Handler {
 			// Add user and session data to request context
 			ctx := context.WithValue(r.Context(), UserContextKey, user)
 			ctx = context.WithValue(ctx, SessionDataContextKey, sessionData)
+			ctx = context.WithValue(ctx, SessionIDContextKey, sessionID)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -88,37 +90,6 @@ func (m *AuthMiddleware) RequireAuth() func(http.Handler) http.Handler {
 	}
 }
 
-func (m *AuthMiddleware) RequireRole(roles ...string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			sessionData := GetSessionDataFromContext(r.Context())
-			if sessionData == nil {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
-
-			hasRequiredRole := false
-			for _, requiredRole := range roles {
-				if m.authService.HasRole(sessionData, requiredRole) {
-					hasRequiredRole = true
-					break
-				}
-			}
-
-			if !hasRequiredRole {
-				http.Error(w, "Forbidden", http.StatusForbidden)
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-func (m *AuthMiddleware) RequireAdmin() func(http.Handler) http.Handler {
-	return m.RequireRole("administrator")
-}
-
 // Helper functions to get user and session data from context
 func GetUserFromContext(ctx context.Context) *tables.User {
 	user, ok := ctx.Value(UserContextKey).(*tables.User)
@@ -135,3 +106,8 @@ func GetSessionDataFromContext(ctx context.Context) *tables.SessionData {
 	}
 	return sessionData
 }
+
+func GetSessionIDFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(SessionIDContextKey).(string)
+	return sessionID
+}
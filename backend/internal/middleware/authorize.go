@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// accessMetadataKey is the Huma operation metadata holding the access rule of the operation
+const accessMetadataKey = "access"
+
+// AccessKind is who may call an operation
+type AccessKind string
+
+const (
+	// AccessPublic operations can be called by anyone
+	AccessPublic AccessKind = "public"
+	// AccessExamClient operations must be signed by an enrolled exam-client
+	AccessExamClient AccessKind = "exam-client"
+	// AccessSession operations need a session, even one still waiting for a two-factor code
+	// or a password change
+	AccessSession AccessKind = "session"
+	// AccessAuthenticated operations need a signed-in user
+	AccessAuthenticated AccessKind = "authenticated"
+	// AccessPermission operations need a signed-in user with a permission
+	AccessPermission AccessKind = "permission"
+	// AccessDeliveryCommittee operations need a signed-in user; the handler then checks that
+	// they are committee of the delivery, or hold the permission to control every delivery
+	AccessDeliveryCommittee AccessKind = "delivery-committee"
+)
+
+// Access is the access rule of an operation
+type Access struct {
+	Kind       AccessKind `json:"kind"`
+	Permission string     `json:"permission,omitempty"`
+}
+
+func (a Access) String() string {
+	if a.Permission != "" {
+		return string(a.Kind) + " " + a.Permission
+	}
+	return string(a.Kind)
+}
+
+// Public declares an operation anyone can call
+func Public() map[string]any {
+	return accessMetadata(Access{Kind: AccessPublic})
+}
+
+// RequireExamClient declares an operation only enrolled exam-clients can call
+func RequireExamClient() map[string]any {
+	return accessMetadata(Access{Kind: AccessExamClient})
+}
+
+// RequireSession declares an operation any session can call, including one limited until
+// two-factor authentication is completed or the password is changed
+func RequireSession() map[string]any {
+	return accessMetadata(Access{Kind: AccessSession})
+}
+
+// RequireAuthentication declares an operation any signed-in user can call
+func RequireAuthentication() map[string]any {
+	return accessMetadata(Access{Kind: AccessAuthenticated})
+}
+
+// RequirePermission declares an operation only users with permission can call
+func RequirePermission(permission string) map[string]any {
+	return accessMetadata(Access{Kind: AccessPermission, Permission: permission})
+}
+
+// RequireDeliveryCommittee declares an operation on a delivery for its committee
+func RequireDeliveryCommittee() map[string]any {
+	return accessMetadata(Access{Kind: AccessDeliveryCommittee, Permission: tables.PermissionDeliveryControl})
+}
+
+func accessMetadata(access Access) map[string]any {
+	return map[string]any{accessMetadataKey: access}
+}
+
+// OperationAccess gets the access rule declared on an operation
+func OperationAccess(op *huma.Operation) (Access, bool) {
+	access, ok := op.Metadata[accessMetadataKey].(Access)
+	return access, ok
+}
+
+// CheckAccess decides whether a caller may call an operation with an access rule. It returns
+// 0 when the call is allowed, or the status and message to deny it with.
+func CheckAccess(access Access, sessionData *tables.SessionData, examClientID string) (int, string) {
+	switch access.Kind {
+	case AccessPublic:
+		return 0, ""
+	case AccessExamClient:
+		if examClientID == "" {
+			return http.StatusUnauthorized, "Exam client signature required"
+		}
+		return 0, ""
+	case AccessSession:
+		if sessionData == nil {
+			return http.StatusUnauthorized, "Authentication required"
+		}
+		return 0, ""
+	case AccessAuthenticated, AccessDeliveryCommittee:
+		if sessionData == nil {
+			return http.StatusUnauthorized, "Authentication required"
+		}
+		return checkSessionLimits(sessionData)
+	case AccessPermission:
+		if sessionData == nil {
+			return http.StatusUnauthorized, "Authentication required"
+		}
+		if status, message := checkSessionLimits(sessionData); status != 0 {
+			return status, message
+		}
+		if !sessionData.HasPermission(access.Permission) {
+			return http.StatusForbidden, "Permission " + access.Permission + " required"
+		}
+		return 0, ""
+	}
+	return http.StatusForbidden, "Operation has no access rule"
+}
+
+// checkSessionLimits denies sessions waiting for two-factor authentication or a password change
+func checkSessionLimits(sessionData *tables.SessionData) (int, string) {
+	switch sessionData.TwoFactorPending {
+	case tables.TwoFactorPendingVerify:
+		return http.StatusForbidden, "Two-factor verification required"
+	case tables.TwoFactorPendingEnroll:
+		return http.StatusForbidden, "Two-factor authentication must be set up"
+	}
+	if sessionData.PasswordChangeRequired {
+		return http.StatusForbidden, "Password change required"
+	}
+	return 0, ""
+}
+
+// Authorize enforces the access rules declared on the operations of api. Operations without
+// a rule are denied. It must be added before the operations are registered.
+func Authorize(api huma.API) func(ctx huma.Context, next func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		access, _ := OperationAccess(ctx.Operation())
+
+		status, message := CheckAccess(access, GetSessionDataFromContext(ctx.Context()), GetExamClientIDFromContext(ctx.Context()))
+		if status != 0 {
+			huma.WriteErr(api, ctx, status, message)
+			return
+		}
+
+		next(ctx)
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/medxamion/medxamion/internal/utils"
+)
+
+const ClientIPContextKey contextKey = "client_ip"
+
+// ClientIPMiddleware stores the caller's IP address in the request context.
+// Forwarding headers are only honoured when trustProxyHeaders is set, since
+// anyone can send them otherwise. Clients can also prepend their own entries
+// to X-Forwarded-For, so the address is the rightmost entry outside
+// trustedProxies, the one the last trusted proxy appended. With trustedProxies
+// set, requests not coming from one of them ignore the headers.
+func ClientIPMiddleware(trustProxyHeaders bool, trustedProxies []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := utils.RemoteIP(r.RemoteAddr)
+
+			fromProxy := len(trustedProxies) == 0 || utils.IPInNetworks(ip, trustedProxies)
+			if trustProxyHeaders && fromProxy {
+				if forwarded := forwardedClientIP(r.Header.Values("X-Forwarded-For"), trustedProxies); forwarded != "" {
+					ip = forwarded
+				} else if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+					ip = strings.TrimSpace(realIP)
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), ClientIPContextKey, ip)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// forwardedClientIP gets the rightmost X-Forwarded-For entry that is not a trusted proxy,
+// or the leftmost when every entry is one
+func forwardedClientIP(headers []string, trustedProxies []*net.IPNet) string {
+	entries := []string{}
+	for _, header := range headers {
+		for _, entry := range strings.Split(header, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !utils.IPInNetworks(entries[i], trustedProxies) {
+			return entries[i]
+		}
+	}
+	if len(entries) > 0 {
+		return entries[0]
+	}
+	return ""
+}
+
+// GetClientIPFromContext returns the caller's IP address stored by ClientIPMiddleware
+func GetClientIPFromContext(ctx context.Context) string {
+	ip, ok := ctx.Value(ClientIPContextKey).(string)
+	if !ok {
+		return ""
+	}
+	return ip
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// ClientResource is a kind of record, addressed by its ID in the path of operations, that
+// belongs to a client
+type ClientResource struct {
+	// PathPrefix matches the paths of the operations on the record, like /api/deliveries/{id}
+	PathPrefix string
+	// Param is the path parameter holding the ID of the record
+	Param string
+	// ExemptPermission lets users holding it reach the records of every client
+	ExemptPermission string
+	// Self marks user records, which users can always reach for themselves
+	Self bool
+	// InClient reports whether the record belongs to a client
+	InClient func(id, clientID int) (bool, error)
+}
+
+// ScopeClientResources answers 404 when a session calls an operation on a record of another
+// client than the one it works with. Calls without a session are left to the access rules.
+// It must be added before the operations are registered.
+func ScopeClientResources(api huma.API, resources []ClientResource) func(ctx huma.Context, next func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		sessionData := GetSessionDataFromContext(ctx.Context())
+		if sessionData == nil {
+			next(ctx)
+			return
+		}
+
+		path := ctx.Operation().Path
+		for _, resource := range resources {
+			if path != resource.PathPrefix && !strings.HasPrefix(path, resource.PathPrefix+"/") {
+				continue
+			}
+			if resource.ExemptPermission != "" && sessionData.HasPermission(resource.ExemptPermission) {
+				continue
+			}
+
+			id, err := strconv.Atoi(ctx.Param(resource.Param))
+			if err != nil {
+				// The operation rejects the malformed ID itself
+				continue
+			}
+			if resource.Self && id == sessionData.UserID {
+				continue
+			}
+
+			inClient, err := resource.InClient(id, sessionData.ClientID)
+			if err != nil {
+				huma.WriteErr(api, ctx, http.StatusInternalServerError, "Failed to check client", err)
+				return
+			}
+			if !inClient {
+				huma.WriteErr(api, ctx, http.StatusNotFound, "Not found")
+				return
+			}
+		}
+
+		next(ctx)
+	}
+}
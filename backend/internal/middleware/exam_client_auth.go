@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/utils"
+)
+
+const ExamClientIDContextKey contextKey = "exam_client_id"
+
+const (
+	examClientPathPrefix   = "/api/internal/exam-clients"
+	examClientEnrollPath   = examClientPathPrefix + "/enroll"
+	maxExamClientBodyBytes = 256 << 20 // final results carry the whole delivery
+)
+
+// ExamClientAuthMiddleware requires the internal exam-client endpoints to be signed with the
+// secret of an enrolled, non-revoked exam-client (see utils.SignRequest). Endpoints with a
+// client ID in their path only accept requests signed by that client. Enrollment itself is
+// authenticated with the enrollment token instead.
+func ExamClientAuthMiddleware(credentials *models.ExamClientCredentialModel) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, examClientPathPrefix+"/") || r.URL.Path == examClientEnrollPath {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			clientID := r.Header.Get(utils.HeaderClientID)
+			if clientID == "" {
+				respondExamClientError(w, http.StatusUnauthorized, "Exam client signature required")
+				return
+			}
+
+			credential, err := credentials.GetActive(clientID)
+			if err != nil {
+				if err.Error() != "exam client not found" && err.Error() != "exam client revoked" {
+					log.Printf("Failed to get credentials of exam client %s: %v", clientID, err)
+				}
+				respondExamClientError(w, http.StatusUnauthorized, "Unknown or revoked exam client")
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxExamClientBodyBytes))
+			if err != nil {
+				respondExamClientError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			now := time.Now()
+			if err := utils.VerifyRequestSignature(r, credential.Secret, body, now); err != nil {
+				respondExamClientError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+			// Nonces are stored in the database, so a request replayed to another replica fails too
+			fresh, err := credentials.UseNonce(clientID, r.Header.Get(utils.HeaderNonce), now, 2*utils.MaxSignatureAge)
+			if err != nil {
+				log.Printf("Failed to check request nonce of exam client %s: %v", clientID, err)
+				respondExamClientError(w, http.StatusInternalServerError, "Failed to check request")
+				return
+			}
+			if !fresh {
+				respondExamClientError(w, http.StatusUnauthorized, "Replayed request")
+				return
+			}
+
+			// /api/internal/exam-clients/{client_id}/... belongs to the signing client
+			segment := strings.SplitN(strings.TrimPrefix(r.URL.Path, examClientPathPrefix+"/"), "/", 2)[0]
+			switch segment {
+			case "register", "event", "deliveries":
+			default:
+				if segment != clientID {
+					respondExamClientError(w, http.StatusForbidden, "Request signed by another exam client")
+					return
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), ExamClientIDContextKey, clientID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetExamClientIDFromContext returns the exam-client that signed the request
+func GetExamClientIDFromContext(ctx context.Context) string {
+	clientID, ok := ctx.Value(ExamClientIDContextKey).(string)
+	if !ok {
+		return ""
+	}
+	return clientID
+}
+
+func respondExamClientError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"message": message,
+	})
+}
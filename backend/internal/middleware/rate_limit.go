@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/httprate"
+)
+
+// LimitPathByClientIP rate limits the requests to one path per client IP address, on top of
+// any limit for all routes. Addresses for which raised, when set, returns true get the higher
+// raisedLimit instead, such as a venue where many people share one address. It must come
+// after ClientIPMiddleware.
+func LimitPathByClientIP(method, path string, requestLimit int, windowLength time.Duration, raised func(ipAddress string) bool, raisedLimit int) func(http.Handler) http.Handler {
+	keyByClientIP := httprate.WithKeyFuncs(func(r *http.Request) (string, error) {
+		return GetClientIPFromContext(r.Context()), nil
+	})
+	limit := httprate.Limit(requestLimit, windowLength, keyByClientIP)
+	raisedLimitHandler := httprate.Limit(raisedLimit, windowLength, keyByClientIP)
+
+	return func(next http.Handler) http.Handler {
+		limited := limit(next)
+		raisedLimited := raisedLimitHandler(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == method && r.URL.Path == path {
+				if raised != nil && raised(GetClientIPFromContext(r.Context())) {
+					raisedLimited.ServeHTTP(w, r)
+					return
+				}
+				limited.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
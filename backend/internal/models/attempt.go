@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/medxamion/medxamion/internal/database"
 	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
 )
 
 type AttemptModel struct {
@@ -53,7 +55,7 @@ func (r *AttemptModel) GetByID(id int) (*tables.Attempt, error) {
 	return attempt, nil
 }
 
-func (r *AttemptModel) GetWithDetails(id int) (*tables.AttemptWithDetails, error) {
+func (r *AttemptModel) GetWithDetails(scope ClientScope, id int) (*tables.AttemptWithDetails, error) {
 	attemptDetails := &tables.AttemptWithDetails{}
 	query := `
 		SELECT a.id, a.attempted_by, a.exam_id, a.delivery_id, a.ip_address, a.started_at, a.ended_at,
@@ -75,9 +77,9 @@ func (r *AttemptModel) GetWithDetails(id int) (*tables.AttemptWithDetails, error
 		JOIN takers t ON a.attempted_by = t.id
 		JOIN exams e ON a.exam_id = e.id
 		JOIN deliveries d ON a.delivery_id = d.id
-		WHERE a.id = $1`
+		WHERE a.id = $1 AND ` + clientCondition("e.client_id", 2)
 
-	row := r.db.QueryRow(query, id)
+	row := r.db.QueryRow(query, id, scope.arg())
 	err := row.Scan(&attemptDetails.ID, &attemptDetails.AttemptedBy, &attemptDetails.ExamID,
 		&attemptDetails.DeliveryID, &attemptDetails.IPAddress, &attemptDetails.StartedAt,
 		&attemptDetails.EndedAt, &attemptDetails.ExtraMinute, &attemptDetails.Score,
@@ -106,11 +108,14 @@ func (r *AttemptModel) GetWithDetails(id int) (*tables.AttemptWithDetails, error
 	return attemptDetails, nil
 }
 
-func (r *AttemptModel) StartAttempt(attemptedBy, deliveryID int, ipAddress string) (*tables.Attempt, error) {
+func (r *AttemptModel) StartAttempt(scope ClientScope, attemptedBy, deliveryID int, ipAddress string) (*tables.Attempt, error) {
 	// Get delivery details to extract exam_id
 	var examID int
-	err := r.db.Get(&examID, "SELECT exam_id FROM deliveries WHERE id = $1", deliveryID)
+	err := r.db.Get(&examID, "SELECT exam_id FROM deliveries WHERE id = $1 AND "+examClientCondition("exam_id", 2), deliveryID, scope.arg())
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("delivery not found")
+		}
 		return nil, fmt.Errorf("failed to get delivery exam: %w", err)
 	}
 
@@ -167,12 +172,12 @@ func (r *AttemptModel) UpdateProgress(id int, progress int) error {
 	return nil
 }
 
-func (r *AttemptModel) List(pagination tables.Pagination, search tables.AttemptSearchRequest) (*tables.PaginatedResponse, error) {
+func (r *AttemptModel) List(scope ClientScope, pagination tables.Pagination, search tables.AttemptSearchRequest) (*tables.PaginatedResponse, error) {
 	offset := (pagination.Page - 1) * pagination.PerPage
 
-	whereClause := "WHERE 1=1"
-	args := []interface{}{pagination.PerPage, offset}
-	argIndex := 3
+	whereClause := "WHERE " + examClientCondition("a.exam_id", 1)
+	args := []interface{}{scope.arg()}
+	argIndex := 2
 
 	if search.TakerID != 0 {
 		whereClause += fmt.Sprintf(" AND a.attempted_by = $%d", argIndex)
@@ -200,11 +205,15 @@ func (r *AttemptModel) List(pagination tables.Pagination, search tables.AttemptS
 	// Get total count
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM attempts a %s", whereClause)
 	var total int
-	err := r.db.Get(&total, countQuery, args[2:]...)
+	err := r.db.Get(&total, countQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get total count: %w", err)
 	}
 
+	limitParam := fmt.Sprintf("$%d", argIndex)
+	offsetParam := fmt.Sprintf("$%d", argIndex+1)
+	args = append(args, pagination.PerPage, offset)
+
 	// Get attempts with taker and exam info
 	query := fmt.Sprintf(`
 		SELECT a.id, a.attempted_by, a.exam_id, a.delivery_id, a.ip_address,
@@ -217,7 +226,7 @@ func (r *AttemptModel) List(pagination tables.Pagination, search tables.AttemptS
 		JOIN exams e ON a.exam_id = e.id
 		%s 
 		ORDER BY a.created_at DESC
-		LIMIT $1 OFFSET $2`, whereClause)
+		LIMIT %s OFFSET %s`, whereClause, limitParam, offsetParam)
 
 	type AttemptWithInfo struct {
 		tables.Attempt
@@ -244,56 +253,327 @@ func (r *AttemptModel) List(pagination tables.Pagination, search tables.AttemptS
 	}, nil
 }
 
-func (r *AttemptModel) GetAttemptsByTaker(takerID int, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
+func (r *AttemptModel) GetAttemptsByTaker(scope ClientScope, takerID int, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
 	search := tables.AttemptSearchRequest{
 		TakerID: takerID,
 	}
-	return r.List(pagination, search)
+	return r.List(scope, pagination, search)
 }
 
-func (r *AttemptModel) GetAttemptsByDelivery(deliveryID int, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
+func (r *AttemptModel) GetAttemptsByDelivery(scope ClientScope, deliveryID int, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
 	search := tables.AttemptSearchRequest{
 		DeliveryID: deliveryID,
 	}
-	return r.List(pagination, search)
+	return r.List(scope, pagination, search)
 }
 
 // Attempt Questions
+
+// SaveAnswer records one visit of a question. TimeSpent is added to the time already spent on the
+// question; a nil Answer keeps the current answer. Every call is kept in attempt_question_history.
 func (r *AttemptModel) SaveAnswer(attemptQuestion *tables.AttemptQuestion) error {
-	// First try to update existing answer
-	updateQuery := `
-		UPDATE attempt_question 
-		SET answer = $3, updated_at = NOW()
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockOpenAttempt(tx, attemptQuestion.AttemptID); err != nil {
+		return err
+	}
+
+	var previous sql.NullString
+	err = tx.QueryRow(`
+		SELECT answer FROM attempt_question
 		WHERE attempt_id = $1 AND question_id = $2
-		RETURNING id`
+		FOR UPDATE`,
+		attemptQuestion.AttemptID, attemptQuestion.QuestionID,
+	).Scan(&previous)
+	exists := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get current answer: %w", err)
+	}
 
-	var id int
-	err := r.db.QueryRow(updateQuery, attemptQuestion.AttemptID, attemptQuestion.QuestionID,
-		attemptQuestion.Answer).Scan(&id)
+	var previousAnswer *string
+	if previous.Valid {
+		previousAnswer = &previous.String
+	}
+	kind := utils.AnswerEventKind(previousAnswer, attemptQuestion.Answer)
 
-	if err == sql.ErrNoRows {
-		// Insert new answer
-		insertQuery := `
-			INSERT INTO attempt_question (attempt_id, question_id, answer, created_at, updated_at)
-			VALUES ($1, $2, $3, NOW(), NOW())
-			RETURNING id, created_at, updated_at`
-
-		err = r.db.QueryRow(insertQuery, attemptQuestion.AttemptID, attemptQuestion.QuestionID,
-			attemptQuestion.Answer).Scan(
-			&attemptQuestion.ID, &attemptQuestion.CreatedAt, &attemptQuestion.UpdatedAt)
-	} else if err != nil {
-		return fmt.Errorf("failed to save answer: %w", err)
+	answer := attemptQuestion.Answer
+	if answer == nil {
+		answer = previousAnswer
+	}
+	visitTime := attemptQuestion.TimeSpent
+	changes := 0
+	if kind == tables.AnswerEventChange || kind == tables.AnswerEventClear {
+		changes = 1
+	}
+
+	if exists {
+		err = tx.QueryRow(`
+			UPDATE attempt_question
+			SET answer = $3, time_spent = time_spent + $4, visits = visits + 1,
+				answer_changes = answer_changes + $5, updated_at = NOW()
+			WHERE attempt_id = $1 AND question_id = $2
+			RETURNING id, time_spent, visits, answer_changes, created_at, updated_at`,
+			attemptQuestion.AttemptID, attemptQuestion.QuestionID, answer, visitTime, changes,
+		).Scan(&attemptQuestion.ID, &attemptQuestion.TimeSpent, &attemptQuestion.Visits,
+			&attemptQuestion.AnswerChanges, &attemptQuestion.CreatedAt, &attemptQuestion.UpdatedAt)
 	} else {
-		attemptQuestion.ID = id
+		err = tx.QueryRow(`
+			INSERT INTO attempt_question (attempt_id, question_id, answer, time_spent, visits, answer_changes, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, 1, 0, NOW(), NOW())
+			RETURNING id, time_spent, visits, answer_changes, created_at, updated_at`,
+			attemptQuestion.AttemptID, attemptQuestion.QuestionID, answer, visitTime,
+		).Scan(&attemptQuestion.ID, &attemptQuestion.TimeSpent, &attemptQuestion.Visits,
+			&attemptQuestion.AnswerChanges, &attemptQuestion.CreatedAt, &attemptQuestion.UpdatedAt)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save answer: %w", err)
+	}
+	attemptQuestion.Answer = answer
+
+	_, err = tx.Exec(`
+		INSERT INTO attempt_question_history (attempt_id, question_id, kind, previous_answer, answer, time_spent, source, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())`,
+		attemptQuestion.AttemptID, attemptQuestion.QuestionID, kind, previousAnswer, answer, visitTime,
+		tables.AnswerSourceCoordinator)
+	if err != nil {
+		return fmt.Errorf("failed to record answer history: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit answer: %w", err)
+	}
+	return nil
+}
+
+// ImportFinalResults stores the final results of an exam-client: each attempt is matched to
+// the taker's attempt at the delivery, or created, and its answers and answer history replace
+// those imported before. The event receipt is recorded in the same transaction; false is
+// returned without importing anything when the event was already recorded.
+func (r *AttemptModel) ImportFinalResults(results *tables.FinalResults, receipt *tables.ExamClientEventReceipt) (bool, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if receipt != nil {
+		recorded, err := recordExamClientEvent(tx, receipt)
+		if err != nil {
+			return false, err
+		}
+		if !recorded {
+			return false, nil
+		}
+	}
+
+	var examID int
+	err = tx.Get(&examID, "SELECT exam_id FROM deliveries WHERE id = $1", results.DeliveryID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, fmt.Errorf("delivery not found")
+		}
+		return false, fmt.Errorf("failed to get delivery exam: %w", err)
+	}
+
+	// Local attempt ID on the exam-client -> attempt ID on the coordinator
+	attemptIDs := make(map[int]int, len(results.Attempts))
+	for _, attempt := range results.Attempts {
+		var attemptID int
+		err = tx.Get(&attemptID, `
+			SELECT id FROM attempts
+			WHERE delivery_id = $1 AND attempted_by = $2
+			ORDER BY id DESC LIMIT 1
+			FOR UPDATE`,
+			results.DeliveryID, attempt.ParticipantID)
+		if err == sql.ErrNoRows {
+			err = tx.Get(&attemptID, `
+				INSERT INTO attempts (attempted_by, exam_id, delivery_id, ip_address, started_at, ended_at,
+									 extra_minute, score, progress, penalty, finish_scoring, created_at, updated_at)
+				VALUES ($1, $2, $3, '', $4, $5, 0, 0, 0, 0, false, NOW(), NOW())
+				RETURNING id`,
+				attempt.ParticipantID, examID, results.DeliveryID, attempt.StartedAt, attempt.EndedAt)
+		} else if err == nil {
+			_, err = tx.Exec(`
+				UPDATE attempts
+				SET started_at = COALESCE(started_at, $2), ended_at = COALESCE(ended_at, $3), updated_at = NOW()
+				WHERE id = $1`,
+				attemptID, attempt.StartedAt, attempt.EndedAt)
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to import attempt of taker %d: %w", attempt.ParticipantID, err)
+		}
+		attemptIDs[attempt.ID] = attemptID
+
+		_, err = tx.Exec(`DELETE FROM attempt_question_history WHERE attempt_id = $1 AND source = $2`,
+			attemptID, tables.AnswerSourceExamClient)
+		if err != nil {
+			return false, fmt.Errorf("failed to clear imported answer history: %w", err)
+		}
+	}
+
+	for _, answer := range results.Answers {
+		attemptID, ok := attemptIDs[answer.AttemptID]
+		if !ok {
+			return false, fmt.Errorf("answer to question %d of unknown attempt %d", answer.QuestionID, answer.AttemptID)
+		}
+
+		var value *string
+		if answer.Answer != "" {
+			value = &answer.Answer
+		}
+		result, err := tx.Exec(`
+			UPDATE attempt_question
+			SET answer = $3, time_spent = $4, visits = $5, answer_changes = $6,
+				flagged = $7, flagged_at = $8, updated_at = NOW()
+			WHERE attempt_id = $1 AND question_id = $2`,
+			attemptID, answer.QuestionID, value, answer.TimeSpent, answer.Visits, answer.AnswerChanges,
+			answer.Flagged, answer.FlaggedAt)
+		if err != nil {
+			return false, fmt.Errorf("failed to import answer: %w", err)
+		}
+		if rows, err := result.RowsAffected(); err != nil {
+			return false, fmt.Errorf("failed to import answer: %w", err)
+		} else if rows > 0 {
+			continue
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO attempt_question (attempt_id, question_id, answer, time_spent, visits, answer_changes,
+										  flagged, flagged_at, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())`,
+			attemptID, answer.QuestionID, value, answer.TimeSpent, answer.Visits, answer.AnswerChanges,
+			answer.Flagged, answer.FlaggedAt, answer.SubmittedAt)
+		if err != nil {
+			return false, fmt.Errorf("failed to import answer: %w", err)
+		}
+	}
+
+	for _, visit := range results.AnswerHistory {
+		attemptID, ok := attemptIDs[visit.AttemptID]
+		if !ok {
+			return false, fmt.Errorf("answer history of unknown attempt %d", visit.AttemptID)
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO attempt_question_history (attempt_id, question_id, kind, previous_answer, answer, time_spent, source, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			attemptID, visit.QuestionID, visit.Kind, visit.PreviousAnswer, visit.Answer, visit.TimeSpent,
+			tables.AnswerSourceExamClient, visit.CreatedAt)
+		if err != nil {
+			return false, fmt.Errorf("failed to import answer history: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit final results: %w", err)
 	}
+	return true, nil
+}
+
+// SetQuestionFlag flags or unflags a question for review, creating the question row if it was never visited
+func (r *AttemptModel) SetQuestionFlag(attemptID, questionID int, flagged bool) (*tables.AttemptQuestion, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockOpenAttempt(tx, attemptID); err != nil {
+		return nil, err
+	}
+
+	aq := &tables.AttemptQuestion{}
+	err = tx.Get(aq, `
+		UPDATE attempt_question
+		SET flagged = $3, flagged_at = CASE WHEN $3 THEN NOW() ELSE NULL END, updated_at = NOW()
+		WHERE attempt_id = $1 AND question_id = $2
+		RETURNING id, attempt_id, question_id, answer, flagged, flagged_at, created_at, updated_at`,
+		attemptID, questionID, flagged)
+
+	if err == sql.ErrNoRows {
+		err = tx.Get(aq, `
+			INSERT INTO attempt_question (attempt_id, question_id, flagged, flagged_at, created_at, updated_at)
+			VALUES ($1, $2, $3, CASE WHEN $3 THEN NOW() ELSE NULL END, NOW(), NOW())
+			RETURNING id, attempt_id, question_id, answer, flagged, flagged_at, created_at, updated_at`,
+			attemptID, questionID, flagged)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to flag question: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit question flag: %w", err)
+	}
+	return aq, nil
+}
 
+// lockOpenAttempt locks an attempt for an answer or flag write, failing once it has ended
+func lockOpenAttempt(tx *sqlx.Tx, attemptID int) error {
+	var open bool
+	err := tx.Get(&open, `SELECT ended_at IS NULL FROM attempts WHERE id = $1 FOR UPDATE`, attemptID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("attempt not found")
+		}
+		return fmt.Errorf("failed to lock attempt: %w", err)
+	}
+	if !open {
+		return fmt.Errorf("attempt has ended")
+	}
 	return nil
 }
 
+// GetAttemptReview lists every question of the attempt's exam with its answered and flagged state
+func (r *AttemptModel) GetAttemptReview(attemptID int) (*tables.AttemptReview, error) {
+	query := `
+		SELECT ROW_NUMBER() OVER (ORDER BY ei.order, q.order, q.id) as number,
+			   q.id as question_id, q.item_id,
+			   COALESCE(aq.answer IS NOT NULL AND TRIM(aq.answer) <> '', false) as answered,
+			   COALESCE(aq.flagged, false) as flagged
+		FROM attempts a
+		JOIN exam_item ei ON ei.exam_id = a.exam_id
+		JOIN questions q ON q.item_id = ei.item_id
+		LEFT JOIN attempt_question aq ON aq.attempt_id = a.id AND aq.question_id = q.id
+		WHERE a.id = $1
+		ORDER BY number`
+
+	questions := []tables.AttemptReviewQuestion{}
+	err := r.db.Select(&questions, query, attemptID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attempt review: %w", err)
+	}
+
+	review := &tables.AttemptReview{
+		AttemptID:           attemptID,
+		TotalQuestions:      len(questions),
+		UnansweredQuestions: []int{},
+		FlaggedQuestions:    []int{},
+		Questions:           questions,
+	}
+	for _, q := range questions {
+		if q.Answered {
+			review.Answered++
+		} else {
+			review.UnansweredQuestions = append(review.UnansweredQuestions, q.QuestionID)
+		}
+		if q.Flagged {
+			review.FlaggedQuestions = append(review.FlaggedQuestions, q.QuestionID)
+		}
+	}
+	review.Unanswered = len(review.UnansweredQuestions)
+	review.Flagged = len(review.FlaggedQuestions)
+
+	return review, nil
+}
+
 func (r *AttemptModel) GetAttemptAnswers(attemptID int) ([]tables.AttemptQuestion, error) {
 	query := `
 		SELECT id, attempt_id, question_id, answer, score, is_correct,
-			   created_at, updated_at
+			   time_spent, visits, answer_changes, flagged, flagged_at, created_at, updated_at
 		FROM attempt_question 
 		WHERE attempt_id = $1
 		ORDER BY question_id`
@@ -314,14 +594,17 @@ func (r *AttemptModel) GetAttemptAnswers(attemptID int) ([]tables.AttemptQuestio
 			&aq.Answer,
 			&aq.Score,
 			&aq.IsCorrect,
+			&aq.TimeSpent,
+			&aq.Visits,
+			&aq.AnswerChanges,
+			&aq.Flagged,
+			&aq.FlaggedAt,
 			&aq.CreatedAt,
 			&aq.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan answer row: %w", err)
 		}
-		// Set TimeSpent to 0 since it doesn't exist in DB
-		aq.TimeSpent = 0
 		answers = append(answers, aq)
 	}
 
@@ -386,3 +669,86 @@ func (r *AttemptModel) GetResultsSummary(deliveryID int, pagination tables.Pagin
 		TotalPages: totalPages,
 	}, nil
 }
+
+// GetDeliveryResponses gets every non-empty answer given in a delivery, for response-pattern analysis
+func (r *AttemptModel) GetDeliveryResponses(deliveryID int) ([]tables.CandidateResponse, error) {
+	query := `
+		SELECT a.id as attempt_id, a.attempted_by as taker_id, t.name as taker_name,
+			   COALESCE(gt.taker_code, t.reg, '') as taker_code,
+			   COALESCE(a.ip_address, '') as ip_address,
+			   aq.question_id, TRIM(aq.answer) as answer, aq.is_correct
+		FROM attempts a
+		JOIN takers t ON a.attempted_by = t.id
+		JOIN deliveries d ON a.delivery_id = d.id
+		LEFT JOIN group_taker gt ON gt.group_id = d.group_id AND gt.taker_id = t.id
+		JOIN attempt_question aq ON aq.attempt_id = a.id
+		WHERE a.delivery_id = $1 AND aq.answer IS NOT NULL AND TRIM(aq.answer) <> ''
+		ORDER BY a.id, aq.question_id`
+
+	responses := []tables.CandidateResponse{}
+	err := r.db.Select(&responses, query, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delivery responses: %w", err)
+	}
+	return responses, nil
+}
+
+// GetAnswerHistory gets every visit and answer change of an attempt in the order they happened
+func (r *AttemptModel) GetAnswerHistory(attemptID int) ([]tables.AttemptQuestionHistory, error) {
+	history := []tables.AttemptQuestionHistory{}
+	query := `
+		SELECT id, attempt_id, question_id, kind, previous_answer, answer, time_spent, created_at
+		FROM attempt_question_history
+		WHERE attempt_id = $1
+		ORDER BY created_at, id`
+
+	err := r.db.Select(&history, query, attemptID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get answer history: %w", err)
+	}
+	return history, nil
+}
+
+// GetDeliveryResponseTimes gets the time spent on every visited question of a delivery
+func (r *AttemptModel) GetDeliveryResponseTimes(deliveryID int) ([]tables.ItemResponseTime, error) {
+	query := `
+		SELECT a.id as attempt_id, t.name as taker_name,
+			   COALESCE(gt.taker_code, t.reg, '') as taker_code,
+			   aq.question_id,
+			   (aq.answer IS NOT NULL AND TRIM(aq.answer) <> '') as answered,
+			   aq.is_correct, aq.time_spent, aq.visits, aq.answer_changes
+		FROM attempts a
+		JOIN takers t ON a.attempted_by = t.id
+		JOIN deliveries d ON a.delivery_id = d.id
+		LEFT JOIN group_taker gt ON gt.group_id = d.group_id AND gt.taker_id = t.id
+		JOIN attempt_question aq ON aq.attempt_id = a.id
+		WHERE a.delivery_id = $1 AND aq.time_spent > 0
+		ORDER BY a.id, aq.question_id`
+
+	times := []tables.ItemResponseTime{}
+	err := r.db.Select(&times, query, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get response times: %w", err)
+	}
+	return times, nil
+}
+
+// GetTimeLimits gets the allowed time of an attempt in seconds, including extra minutes, and its number of questions
+func (r *AttemptModel) GetTimeLimits(attemptID int) (int, int, error) {
+	var duration, totalQuestions int
+	err := r.db.QueryRow(`
+		SELECT (d.duration + a.extra_minute) * 60,
+			   (SELECT COUNT(*) FROM exam_item ei JOIN questions q ON q.item_id = ei.item_id
+				WHERE ei.exam_id = a.exam_id)
+		FROM attempts a
+		JOIN deliveries d ON a.delivery_id = d.id
+		WHERE a.id = $1`, attemptID,
+	).Scan(&duration, &totalQuestions)
+	if err == sql.ErrNoRows {
+		return 0, 0, fmt.Errorf("attempt not found")
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get attempt time limits: %w", err)
+	}
+	return duration, totalQuestions, nil
+}
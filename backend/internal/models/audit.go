@@ -0,0 +1,154 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+type AuditModel struct {
+	db *database.DB
+}
+
+func NewAuditModel(db *database.DB) *AuditModel {
+	return &AuditModel{db: db}
+}
+
+const auditSelect = `
+	SELECT id, client_id, actor_id, actor_name, ip_address, entity_type, entity_id, action,
+		   changes, created_at
+	FROM audit_log`
+
+// auditClientCondition limits entries to the scope passed as argument n. Entries of users,
+// roles and clients belong to no client and are in every scope.
+func auditClientCondition(n int) string {
+	return fmt.Sprintf("($%d::int IS NULL OR client_id = $%d OR client_id IS NULL)", n, n)
+}
+
+// Create records an entry in the audit log
+func (r *AuditModel) Create(entry *tables.AuditEntry) error {
+	err := r.db.QueryRow(`
+		INSERT INTO audit_log (client_id, actor_id, actor_name, ip_address, entity_type, entity_id, action, changes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at`,
+		entry.ClientID, entry.ActorID, entry.ActorName, entry.IPAddress, entry.EntityType,
+		entry.EntityID, entry.Action, []byte(entry.Changes)).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create audit entry: %w", err)
+	}
+	return nil
+}
+
+func (r *AuditModel) GetByID(scope ClientScope, id int) (*tables.AuditEntry, error) {
+	entry := &tables.AuditEntry{}
+	err := r.db.Get(entry, auditSelect+` WHERE id = $1 AND `+auditClientCondition(2), id, scope.arg())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("audit entry not found")
+		}
+		return nil, fmt.Errorf("failed to get audit entry: %w", err)
+	}
+	return entry, nil
+}
+
+// List gets the entries of the audit log, newest first
+func (r *AuditModel) List(scope ClientScope, pagination tables.Pagination, search tables.AuditSearchRequest) (*tables.PaginatedResponse, error) {
+	offset := (pagination.Page - 1) * pagination.PerPage
+
+	whereClause := "WHERE " + auditClientCondition(1)
+	args := []interface{}{scope.arg()}
+	argIndex := 2
+
+	if search.ClientID != 0 {
+		whereClause += fmt.Sprintf(" AND client_id = $%d", argIndex)
+		args = append(args, search.ClientID)
+		argIndex++
+	}
+
+	if search.EntityType != "" {
+		whereClause += fmt.Sprintf(" AND entity_type = $%d", argIndex)
+		args = append(args, search.EntityType)
+		argIndex++
+	}
+
+	if search.EntityID != 0 {
+		whereClause += fmt.Sprintf(" AND entity_id = $%d", argIndex)
+		args = append(args, search.EntityID)
+		argIndex++
+	}
+
+	if search.ActorID != 0 {
+		whereClause += fmt.Sprintf(" AND actor_id = $%d", argIndex)
+		args = append(args, search.ActorID)
+		argIndex++
+	}
+
+	if search.Action != "" {
+		whereClause += fmt.Sprintf(" AND action = $%d", argIndex)
+		args = append(args, search.Action)
+		argIndex++
+	}
+
+	if search.Field != "" {
+		whereClause += fmt.Sprintf(" AND changes ? $%d", argIndex)
+		args = append(args, search.Field)
+		argIndex++
+	}
+
+	if !search.From.IsZero() {
+		whereClause += fmt.Sprintf(" AND created_at >= $%d", argIndex)
+		args = append(args, search.From)
+		argIndex++
+	}
+
+	if !search.To.IsZero() {
+		whereClause += fmt.Sprintf(" AND created_at < $%d", argIndex)
+		args = append(args, search.To)
+		argIndex++
+	}
+
+	// Get total count
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM audit_log %s", whereClause)
+	var total int
+	err := r.db.Get(&total, countQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get total count: %w", err)
+	}
+
+	limitParam := fmt.Sprintf("$%d", argIndex)
+	offsetParam := fmt.Sprintf("$%d", argIndex+1)
+	args = append(args, pagination.PerPage, offset)
+
+	// Get entries
+	query := fmt.Sprintf(`%s %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT %s OFFSET %s`, auditSelect, whereClause, limitParam, offsetParam)
+
+	entries := []tables.AuditEntry{}
+	err = r.db.Select(&entries, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit entries: %w", err)
+	}
+
+	totalPages := (total + pagination.PerPage - 1) / pagination.PerPage
+
+	return &tables.PaginatedResponse{
+		Data:       entries,
+		Total:      total,
+		Page:       pagination.Page,
+		PerPage:    pagination.PerPage,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// DeleteOlderThan removes the entries recorded before a time
+func (r *AuditModel) DeleteOlderThan(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM audit_log WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to cleanup audit log: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -17,13 +17,20 @@ func NewCategoryModel(db *database.DB) *CategoryModel {
 	return &CategoryModel{db: db}
 }
 
-func (r *CategoryModel) Create(category *tables.Category) error {
+// Create creates a category for the client of scope
+func (r *CategoryModel) Create(scope ClientScope, category *tables.Category) error {
+	clientID, err := scope.owner()
+	if err != nil {
+		return err
+	}
+	category.ClientID = clientID
+
 	query := `
 		INSERT INTO categories (type, code, parent, name, description, client_id, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
 		RETURNING id, created_at, updated_at`
 
-	err := r.db.QueryRow(query, string(category.Type), category.Code, category.Parent,
+	err = r.db.QueryRow(query, string(category.Type), category.Code, category.Parent,
 		category.Name, category.Description, category.ClientID).Scan(&category.ID, &category.CreatedAt, &category.UpdatedAt)
 
 	if err != nil {
@@ -32,15 +39,15 @@ func (r *CategoryModel) Create(category *tables.Category) error {
 	return nil
 }
 
-func (r *CategoryModel) GetByID(id int) (*tables.Category, error) {
+func (r *CategoryModel) GetByID(scope ClientScope, id int) (*tables.Category, error) {
 	category := &tables.Category{}
 	query := `
 		SELECT id, type, code, parent, name, description, client_id, 
 			   created_at, updated_at
 		FROM categories 
-		WHERE id = $1`
+		WHERE id = $1 AND ` + clientCondition("client_id", 2)
 
-	err := r.db.Get(category, query, id)
+	err := r.db.Get(category, query, id, scope.arg())
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("category not found")
@@ -50,7 +57,7 @@ func (r *CategoryModel) GetByID(id int) (*tables.Category, error) {
 	return category, nil
 }
 
-func (r *CategoryModel) Update(id int, updates *tables.CategoryUpdateRequest) (*tables.Category, error) {
+func (r *CategoryModel) Update(scope ClientScope, id int, updates *tables.CategoryUpdateRequest) (*tables.Category, error) {
 	setParts := []string{}
 	args := []interface{}{}
 	argIndex := 1
@@ -82,61 +89,68 @@ func (r *CategoryModel) Update(id int, updates *tables.CategoryUpdateRequest) (*
 	}
 
 	if len(setParts) == 0 {
-		return r.GetByID(id)
+		return r.GetByID(scope, id)
 	}
 
 	setParts = append(setParts, "updated_at = NOW()")
 	setClause := strings.Join(setParts, ", ")
-	args = append(args, id)
+	args = append(args, id, scope.arg())
 
 	query := fmt.Sprintf(`
 		UPDATE categories 
 		SET %s 
-		WHERE id = $%d`, setClause, argIndex)
+		WHERE id = $%d AND %s`, setClause, argIndex, clientCondition("client_id", argIndex+1))
 
-	_, err := r.db.Exec(query, args...)
+	result, err := r.db.Exec(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update category: %w", err)
 	}
+	if err := requireRow(result, "category not found"); err != nil {
+		return nil, err
+	}
 
-	return r.GetByID(id)
+	return r.GetByID(scope, id)
 }
 
-func (r *CategoryModel) Delete(id int) error {
-	query := `DELETE FROM categories WHERE id = $1`
-	_, err := r.db.Exec(query, id)
+func (r *CategoryModel) Delete(scope ClientScope, id int) error {
+	query := `DELETE FROM categories WHERE id = $1 AND ` + clientCondition("client_id", 2)
+	result, err := r.db.Exec(query, id, scope.arg())
 	if err != nil {
 		return fmt.Errorf("failed to delete category: %w", err)
 	}
-	return nil
+	return requireRow(result, "category not found")
 }
 
-func (r *CategoryModel) List(pagination tables.Pagination, search tables.CategorySearchRequest) (*tables.PaginatedResponse, error) {
+func (r *CategoryModel) List(scope ClientScope, pagination tables.Pagination, search tables.CategorySearchRequest) (*tables.PaginatedResponse, error) {
 	offset := (pagination.Page - 1) * pagination.PerPage
 
-	whereClause := "WHERE 1=1"
-	args := []interface{}{pagination.PerPage, offset}
-	argIndex := 3
+	whereClause := "WHERE " + clientCondition("c.client_id", 1)
+	args := []interface{}{scope.arg()}
+	argIndex := 2
 
 	if search.Name != "" {
-		whereClause += fmt.Sprintf(" AND name ILIKE $%d", argIndex)
+		whereClause += fmt.Sprintf(" AND c.name ILIKE $%d", argIndex)
 		args = append(args, "%"+search.Name+"%")
 		argIndex++
 	}
 	if search.Type != "" {
-		whereClause += fmt.Sprintf(" AND type = $%d", argIndex)
+		whereClause += fmt.Sprintf(" AND c.type = $%d", argIndex)
 		args = append(args, string(search.Type))
 		argIndex++
 	}
 
 	// Get total count
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM categories %s", whereClause)
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM categories c %s", whereClause)
 	var total int
-	err := r.db.Get(&total, countQuery, args[2:]...)
+	err := r.db.Get(&total, countQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get total count: %w", err)
 	}
 
+	limitParam := fmt.Sprintf("$%d", argIndex)
+	offsetParam := fmt.Sprintf("$%d", argIndex+1)
+	args = append(args, pagination.PerPage, offset)
+
 	// Get categories with question count
 	query := fmt.Sprintf(`
 		SELECT c.id, c.type, c.code, c.parent, c.name, c.description, c.client_id, 
@@ -148,7 +162,7 @@ func (r *CategoryModel) List(pagination tables.Pagination, search tables.Categor
 		GROUP BY c.id, c.type, c.code, c.parent, c.name, c.description, c.client_id,
 				 c.created_at, c.updated_at
 		ORDER BY c.created_at DESC
-		LIMIT $1 OFFSET $2`, whereClause)
+		LIMIT %s OFFSET %s`, whereClause, limitParam, offsetParam)
 
 	categories := []tables.CategoryWithCount{}
 	err = r.db.Select(&categories, query, args...)
@@ -167,25 +181,29 @@ func (r *CategoryModel) List(pagination tables.Pagination, search tables.Categor
 	}, nil
 }
 
-func (r *CategoryModel) GetByType(categoryType tables.CategoryType) ([]tables.Category, error) {
+func (r *CategoryModel) GetByType(scope ClientScope, categoryType tables.CategoryType) ([]tables.Category, error) {
 	categories := []tables.Category{}
 	query := `
 		SELECT id, type, code, parent, name, description, client_id, 
 			   created_at, updated_at
 		FROM categories 
-		WHERE type = $1
+		WHERE type = $1 AND ` + clientCondition("client_id", 2) + `
 		ORDER BY name`
 
-	err := r.db.Select(&categories, query, string(categoryType))
+	err := r.db.Select(&categories, query, string(categoryType), scope.arg())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get categories by type: %w", err)
 	}
 	return categories, nil
 }
 
-func (r *CategoryModel) GetCategoryQuestions(categoryID int, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
+func (r *CategoryModel) GetCategoryQuestions(scope ClientScope, categoryID int, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
 	offset := (pagination.Page - 1) * pagination.PerPage
 
+	if _, err := r.GetByID(scope, categoryID); err != nil {
+		return nil, err
+	}
+
 	// Get total count
 	countQuery := `
 		SELECT COUNT(*) 
@@ -225,44 +243,65 @@ func (r *CategoryModel) GetCategoryQuestions(categoryID int, pagination tables.P
 	}, nil
 }
 
-func (r *CategoryModel) AddQuestion(categoryID, questionID int) error {
+// AddQuestion adds a question to a category, both of the client of scope
+func (r *CategoryModel) AddQuestion(scope ClientScope, categoryID, questionID int) error {
+	if _, err := r.GetByID(scope, categoryID); err != nil {
+		return err
+	}
+
 	query := `
 		INSERT INTO category_question (category_id, question_id)
-		VALUES ($1, $2)
+		SELECT $1::int, q.id
+		FROM questions q
+		JOIN items i ON i.id = q.item_id
+		WHERE q.id = $2 AND i.deleted_at IS NULL AND ` + clientCondition("i.client_id", 3) + `
 		ON CONFLICT (category_id, question_id) DO NOTHING`
 
-	_, err := r.db.Exec(query, categoryID, questionID)
+	_, err := r.db.Exec(query, categoryID, questionID, scope.arg())
 	if err != nil {
 		return fmt.Errorf("failed to add question to category: %w", err)
 	}
 	return nil
 }
 
-func (r *CategoryModel) RemoveQuestion(categoryID, questionID int) error {
-	query := `DELETE FROM category_question WHERE category_id = $1 AND question_id = $2`
-	_, err := r.db.Exec(query, categoryID, questionID)
+func (r *CategoryModel) RemoveQuestion(scope ClientScope, categoryID, questionID int) error {
+	query := `
+		DELETE FROM category_question
+		WHERE category_id = $1 AND question_id = $2
+			AND EXISTS (SELECT 1 FROM categories c WHERE c.id = category_id AND ` + clientCondition("c.client_id", 3) + `)`
+	_, err := r.db.Exec(query, categoryID, questionID, scope.arg())
 	if err != nil {
 		return fmt.Errorf("failed to remove question from category: %w", err)
 	}
 	return nil
 }
 
-func (r *CategoryModel) AddItem(categoryID, itemID int) error {
+// AddItem adds an item to a category, both of the client of scope
+func (r *CategoryModel) AddItem(scope ClientScope, categoryID, itemID int) error {
+	if _, err := r.GetByID(scope, categoryID); err != nil {
+		return err
+	}
+
 	query := `
 		INSERT INTO category_item (category_id, item_id)
-		VALUES ($1, $2)
+		SELECT $1::int, i.id
+		FROM items i
+		WHERE i.id = $2 AND i.deleted_at IS NULL AND ` + clientCondition("i.client_id", 3) + `
 		ON CONFLICT (category_id, item_id) DO NOTHING`
 
-	_, err := r.db.Exec(query, categoryID, itemID)
+	_, err := r.db.Exec(query, categoryID, itemID, scope.arg())
 	if err != nil {
 		return fmt.Errorf("failed to add item to category: %w", err)
 	}
 	return nil
 }
 
-func (r *CategoryModel) RemoveItem(categoryID, itemID int) error {
-	query := `DELETE FROM category_item WHERE category_id = $1 AND item_id = $2`
-	_, err := r.db.Exec(query, categoryID, itemID)
+func (r *CategoryModel) RemoveItem(scope ClientScope, categoryID, itemID int) error {
+	query := `
+		DELETE FROM category_item
+		WHERE category_id = $1 AND item_id = $2
+			AND EXISTS (SELECT 1 FROM categories c WHERE c.id = category_id AND ` + clientCondition("c.client_id", 3) + `)`
+	_, err := r.db.Exec(query, categoryID, itemID, scope.arg())
 	if err != nil {
 		return fmt.Errorf("failed to remove item from category: %w", err)
 	}
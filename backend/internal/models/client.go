@@ -0,0 +1,222 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+type ClientModel struct {
+	db *database.DB
+}
+
+func NewClientModel(db *database.DB) *ClientModel {
+	return &ClientModel{db: db}
+}
+
+const clientSelect = `
+	SELECT c.id, c.name, c.taker_code_prefix, c.taker_code_length, c.taker_code_group_size,
+		   c.timezone, c.logo_url, c.created_at, c.updated_at
+	FROM clients c`
+
+// List lists all clients with how many users work for them
+func (r *ClientModel) List() ([]tables.ClientWithUsers, error) {
+	clients := []tables.ClientWithUsers{}
+	query := `
+		SELECT c.id, c.name, c.taker_code_prefix, c.taker_code_length, c.taker_code_group_size,
+			   c.timezone, c.logo_url, c.created_at, c.updated_at,
+			   (SELECT COUNT(*) FROM client_user cu WHERE cu.client_id = c.id) AS user_count
+		FROM clients c
+		ORDER BY c.name, c.id`
+
+	err := r.db.Select(&clients, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clients: %w", err)
+	}
+	return clients, nil
+}
+
+// ListForUser lists the clients a user works for
+func (r *ClientModel) ListForUser(userID int) ([]tables.Client, error) {
+	clients := []tables.Client{}
+	query := clientSelect + `
+		JOIN client_user cu ON cu.client_id = c.id
+		WHERE cu.user_id = $1
+		ORDER BY c.name, c.id`
+
+	err := r.db.Select(&clients, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user clients: %w", err)
+	}
+	return clients, nil
+}
+
+func (r *ClientModel) GetByID(id int) (*tables.Client, error) {
+	client := &tables.Client{}
+	err := r.db.Get(client, clientSelect+` WHERE c.id = $1`, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("client not found")
+		}
+		return nil, fmt.Errorf("failed to get client: %w", err)
+	}
+	return client, nil
+}
+
+// FirstID gets the ID of the oldest client, or 0 when there is none
+func (r *ClientModel) FirstID() (int, error) {
+	var id sql.NullInt64
+	err := r.db.Get(&id, `SELECT MIN(id) FROM clients`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get first client: %w", err)
+	}
+	return int(id.Int64), nil
+}
+
+// FirstIDForUser gets the ID of the oldest client a user works for, or 0 when there is none
+func (r *ClientModel) FirstIDForUser(userID int) (int, error) {
+	var id sql.NullInt64
+	err := r.db.Get(&id, `SELECT MIN(client_id) FROM client_user WHERE user_id = $1`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get first user client: %w", err)
+	}
+	return int(id.Int64), nil
+}
+
+// Create creates a client. Settings left unset get their defaults.
+func (r *ClientModel) Create(req *tables.ClientCreateRequest) (*tables.Client, error) {
+	var id int
+	err := r.db.QueryRow(`
+		INSERT INTO clients (name, taker_code_prefix, taker_code_length, taker_code_group_size,
+			timezone, logo_url, created_at, updated_at)
+		VALUES ($1, COALESCE($2, ''), COALESCE($3, 8), COALESCE($4, 4), COALESCE($5, 'Asia/Jakarta'),
+			NULLIF($6, ''), NOW(), NOW())
+		RETURNING id`,
+		req.Name, req.TakerCodePrefix, req.TakerCodeLength, req.TakerCodeGroupSize,
+		req.Timezone, req.LogoURL).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	return r.GetByID(id)
+}
+
+// Update updates the name and settings of a client. An empty logo URL removes the logo.
+func (r *ClientModel) Update(id int, req *tables.ClientUpdateRequest) (*tables.Client, error) {
+	result, err := r.db.Exec(`
+		UPDATE clients
+		SET name = COALESCE($1, name), taker_code_prefix = COALESCE($2, taker_code_prefix),
+			taker_code_length = COALESCE($3, taker_code_length),
+			taker_code_group_size = COALESCE($4, taker_code_group_size),
+			timezone = COALESCE($5, timezone),
+			logo_url = CASE WHEN $6::text IS NULL THEN logo_url ELSE NULLIF($6, '') END,
+			updated_at = NOW()
+		WHERE id = $7`,
+		req.Name, req.TakerCodePrefix, req.TakerCodeLength, req.TakerCodeGroupSize,
+		req.Timezone, req.LogoURL, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update client: %w", err)
+	}
+	if err := requireRow(result, "client not found"); err != nil {
+		return nil, err
+	}
+	return r.GetByID(id)
+}
+
+// IsMember reports whether a user works for a client
+func (r *ClientModel) IsMember(clientID, userID int) (bool, error) {
+	var member bool
+	err := r.db.Get(&member, `SELECT EXISTS (SELECT 1 FROM client_user WHERE client_id = $1 AND user_id = $2)`, clientID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check client membership: %w", err)
+	}
+	return member, nil
+}
+
+// AddUser makes a user work for a client
+func (r *ClientModel) AddUser(clientID, userID int) error {
+	_, err := r.db.Exec(`
+		INSERT INTO client_user (client_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`,
+		clientID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to add user to client: %w", err)
+	}
+	return nil
+}
+
+// SetUserClients replaces the clients a user works for
+func (r *ClientModel) SetUserClients(userID int, clientIDs []int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM client_user WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("failed to clear user clients: %w", err)
+	}
+
+	for _, clientID := range clientIDs {
+		var exists bool
+		err = tx.Get(&exists, "SELECT EXISTS(SELECT 1 FROM clients WHERE id = $1)", clientID)
+		if err != nil {
+			return fmt.Errorf("failed to check client %d: %w", clientID, err)
+		}
+		if !exists {
+			return fmt.Errorf("client not found")
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO client_user (client_id, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING`,
+			clientID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to add user to client %d: %w", clientID, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit user clients: %w", err)
+	}
+	return nil
+}
+
+// DeliveryInClient reports whether a delivery is of an exam of a client
+func (r *ClientModel) DeliveryInClient(deliveryID, clientID int) (bool, error) {
+	return r.exists(`
+		SELECT EXISTS (
+			SELECT 1 FROM deliveries d JOIN exams e ON e.id = d.exam_id
+			WHERE d.id = $1 AND e.client_id = $2
+		)`, deliveryID, clientID)
+}
+
+// AttemptInClient reports whether an attempt is at an exam of a client
+func (r *ClientModel) AttemptInClient(attemptID, clientID int) (bool, error) {
+	return r.exists(`
+		SELECT EXISTS (
+			SELECT 1 FROM attempts a JOIN exams e ON e.id = a.exam_id
+			WHERE a.id = $1 AND e.client_id = $2
+		)`, attemptID, clientID)
+}
+
+// ParticipantInClient reports whether a participant is of a client
+func (r *ClientModel) ParticipantInClient(participantID, clientID int) (bool, error) {
+	return r.exists(`SELECT EXISTS (SELECT 1 FROM takers WHERE id = $1 AND client_id = $2)`, participantID, clientID)
+}
+
+// UserInClient reports whether a user works for a client
+func (r *ClientModel) UserInClient(userID, clientID int) (bool, error) {
+	return r.IsMember(clientID, userID)
+}
+
+func (r *ClientModel) exists(query string, args ...interface{}) (bool, error) {
+	var exists bool
+	if err := r.db.Get(&exists, query, args...); err != nil {
+		return false, fmt.Errorf("failed to check client: %w", err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ClientScope is the client (tenant) a query works with. Every query of client data takes
+// one, so the data of another client cannot be reached by forgetting to filter. The zero
+// scope matches no data at all.
+type ClientScope struct {
+	clientID int
+	all      bool
+}
+
+// ForClient limits queries to the data of one client
+func ForClient(clientID int) ClientScope {
+	return ClientScope{clientID: clientID}
+}
+
+// AllClients lets queries reach the data of every client. It is for work that is not done
+// for a staff member: participant logins, exam-clients and the scheduler.
+func AllClients() ClientScope {
+	return ClientScope{all: true}
+}
+
+// arg is the query argument clientCondition compares with: NULL for every client, and the
+// client ID otherwise (0 for the zero scope, which no data has)
+func (s ClientScope) arg() any {
+	if s.all {
+		return nil
+	}
+	return s.clientID
+}
+
+// owner is the client new data is created for
+func (s ClientScope) owner() (int, error) {
+	if s.all || s.clientID == 0 {
+		return 0, fmt.Errorf("no client selected")
+	}
+	return s.clientID, nil
+}
+
+// clientCondition is the SQL condition limiting column to the scope passed as argument n
+func clientCondition(column string, n int) string {
+	return fmt.Sprintf("($%d::int IS NULL OR %s = $%d)", n, column, n)
+}
+
+// examClientCondition limits rows with an exam ID, such as deliveries and attempts, to the
+// exams of the scope passed as argument n
+func examClientCondition(examIDColumn string, n int) string {
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM exams ce WHERE ce.id = %s AND %s)", examIDColumn, clientCondition("ce.client_id", n))
+}
+
+// requireRow returns an error with message when a statement changed no row, because the
+// row does not exist or is outside the scope
+func requireRow(result sql.Result, message string) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return errors.New(message)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+type CollusionReportModel struct {
+	db *database.DB
+}
+
+func NewCollusionReportModel(db *database.DB) *CollusionReportModel {
+	return &CollusionReportModel{db: db}
+}
+
+// Save stores the collusion report of a delivery, replacing the previous one
+func (r *CollusionReportModel) Save(report *tables.CollusionReport) error {
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode collusion report: %w", err)
+	}
+
+	flagged := 0
+	for _, pair := range report.Pairs {
+		if pair.Flagged {
+			flagged++
+		}
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO collusion_reports (delivery_id, candidates, flagged_pairs, report, generated_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		ON CONFLICT (delivery_id) DO UPDATE SET
+			candidates = EXCLUDED.candidates, flagged_pairs = EXCLUDED.flagged_pairs,
+			report = EXCLUDED.report, generated_at = EXCLUDED.generated_at, updated_at = NOW()`,
+		report.DeliveryID, report.Candidates, flagged, payload, report.GeneratedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save collusion report: %w", err)
+	}
+	return nil
+}
+
+// Get gets the stored collusion report of a delivery
+func (r *CollusionReportModel) Get(deliveryID int) (*tables.CollusionReport, error) {
+	var payload []byte
+	err := r.db.QueryRow(`SELECT report FROM collusion_reports WHERE delivery_id = $1`, deliveryID).Scan(&payload)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("collusion report not found")
+		}
+		return nil, fmt.Errorf("failed to get collusion report: %w", err)
+	}
+
+	var report tables.CollusionReport
+	if err := json.Unmarshal(payload, &report); err != nil {
+		return nil, fmt.Errorf("failed to decode collusion report: %w", err)
+	}
+	return &report, nil
+}
@@ -22,6 +22,8 @@ type DeliveryListItem struct {
 	DisplayName    string     `json:"display_name"`
 	ScheduledAt    *time.Time `json:"scheduled_at"`
 	Duration       int        `json:"duration"`
+	EndedAt        *time.Time `json:"ended_at"`
+	ClosesAt       *time.Time `json:"closes_at"` // see deliveryClosesAt
 	IsAnytime      bool       `json:"is_anytime"`
 	AutomaticStart bool       `json:"automatic_start"`
 	IsFinished     *time.Time `json:"is_finished"`
@@ -36,7 +38,22 @@ func NewDeliveryModel(db *database.DB) *DeliveryModel {
 	return &DeliveryModel{db: db}
 }
 
-func (r *DeliveryModel) Create(delivery *tables.Delivery) error {
+// Create creates a delivery of an exam to a group, which must both be of the client of scope
+func (r *DeliveryModel) Create(scope ClientScope, delivery *tables.Delivery) error {
+	var inScope bool
+	err := r.db.Get(&inScope, `
+		SELECT EXISTS (
+			SELECT 1 FROM exams e
+			JOIN groups g ON g.id = $2 AND g.client_id = e.client_id AND g.deleted_at IS NULL
+			WHERE e.id = $1 AND e.deleted_at IS NULL AND `+clientCondition("e.client_id", 3)+`
+		)`, delivery.ExamID, delivery.GroupID, scope.arg())
+	if err != nil {
+		return fmt.Errorf("failed to check exam and group: %w", err)
+	}
+	if !inScope {
+		return fmt.Errorf("exam or group not found")
+	}
+
 	query := `
 		INSERT INTO deliveries (exam_id, group_id, name, scheduled_at, duration, ended_at,
 							   is_anytime, automatic_start, is_finished, last_status, 
@@ -44,7 +61,7 @@ func (r *DeliveryModel) Create(delivery *tables.Delivery) error {
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW(), NOW())
 		RETURNING id, created_at, updated_at`
 
-	err := r.db.QueryRow(query, delivery.ExamID, delivery.GroupID, delivery.Name,
+	err = r.db.QueryRow(query, delivery.ExamID, delivery.GroupID, delivery.Name,
 		delivery.ScheduledAt, delivery.Duration, delivery.EndedAt, delivery.IsAnytime,
 		delivery.AutomaticStart, delivery.IsFinished, delivery.LastStatus,
 		delivery.DisplayName).Scan(&delivery.ID, &delivery.CreatedAt, &delivery.UpdatedAt)
@@ -55,16 +72,16 @@ func (r *DeliveryModel) Create(delivery *tables.Delivery) error {
 	return nil
 }
 
-func (r *DeliveryModel) GetByID(id int) (*tables.Delivery, error) {
+func (r *DeliveryModel) GetByID(scope ClientScope, id int) (*tables.Delivery, error) {
 	delivery := &tables.Delivery{}
 	query := `
 		SELECT id, exam_id, group_id, name, scheduled_at, duration, ended_at,
 			   is_anytime, automatic_start, is_finished, last_status, display_name,
 			   created_at, updated_at
 		FROM deliveries 
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL AND ` + examClientCondition("exam_id", 2)
 
-	err := r.db.Get(delivery, query, id)
+	err := r.db.Get(delivery, query, id, scope.arg())
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("delivery not found")
@@ -74,7 +91,7 @@ func (r *DeliveryModel) GetByID(id int) (*tables.Delivery, error) {
 	return delivery, nil
 }
 
-func (r *DeliveryModel) GetWithDetails(id int) (*tables.DeliveryWithDetails, error) {
+func (r *DeliveryModel) GetWithDetails(scope ClientScope, id int) (*tables.DeliveryWithDetails, error) {
 	deliveryDetails := &tables.DeliveryWithDetails{}
 	query := `
 		SELECT d.id, d.exam_id, d.group_id, d.name, d.scheduled_at, d.duration, d.ended_at,
@@ -91,9 +108,9 @@ func (r *DeliveryModel) GetWithDetails(id int) (*tables.DeliveryWithDetails, err
 		FROM deliveries d
 		JOIN exams e ON d.exam_id = e.id
 		JOIN groups g ON d.group_id = g.id
-		WHERE d.id = $1`
+		WHERE d.id = $1 AND d.deleted_at IS NULL AND ` + clientCondition("e.client_id", 2)
 
-	row := r.db.QueryRow(query, id)
+	row := r.db.QueryRow(query, id, scope.arg())
 	err := row.Scan(&deliveryDetails.ID, &deliveryDetails.ExamID, &deliveryDetails.GroupID,
 		&deliveryDetails.Name, &deliveryDetails.ScheduledAt, &deliveryDetails.Duration,
 		&deliveryDetails.EndedAt, &deliveryDetails.IsAnytime, &deliveryDetails.AutomaticStart,
@@ -116,7 +133,7 @@ func (r *DeliveryModel) GetWithDetails(id int) (*tables.DeliveryWithDetails, err
 	return deliveryDetails, nil
 }
 
-func (r *DeliveryModel) Update(id int, updates *tables.DeliveryUpdateRequest) (*tables.Delivery, error) {
+func (r *DeliveryModel) Update(scope ClientScope, id int, updates *tables.DeliveryUpdateRequest) (*tables.Delivery, error) {
 	setParts := []string{}
 	args := []interface{}{}
 	argIndex := 1
@@ -136,6 +153,11 @@ func (r *DeliveryModel) Update(id int, updates *tables.DeliveryUpdateRequest) (*
 		args = append(args, *updates.Duration)
 		argIndex++
 	}
+	if updates.EndedAt != nil {
+		setParts = append(setParts, fmt.Sprintf("ended_at = $%d", argIndex))
+		args = append(args, *updates.EndedAt)
+		argIndex++
+	}
 	if updates.IsAnytime != nil {
 		setParts = append(setParts, fmt.Sprintf("is_anytime = $%d", argIndex))
 		args = append(args, *updates.IsAnytime)
@@ -153,42 +175,108 @@ func (r *DeliveryModel) Update(id int, updates *tables.DeliveryUpdateRequest) (*
 	}
 
 	if len(setParts) == 0 {
-		return r.GetByID(id)
+		return r.GetByID(scope, id)
 	}
 
 	setParts = append(setParts, "updated_at = NOW()")
 	setClause := strings.Join(setParts, ", ")
-	args = append(args, id)
+	args = append(args, id, scope.arg())
 
 	query := fmt.Sprintf(`
 		UPDATE deliveries 
 		SET %s 
-		WHERE id = $%d`, setClause, argIndex)
+		WHERE id = $%d AND deleted_at IS NULL AND %s`, setClause, argIndex, examClientCondition("exam_id", argIndex+1))
 
-	_, err := r.db.Exec(query, args...)
+	result, err := r.db.Exec(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update delivery: %w", err)
 	}
+	if err := requireRow(result, "delivery not found"); err != nil {
+		return nil, err
+	}
 
-	return r.GetByID(id)
+	return r.GetByID(scope, id)
 }
 
-func (r *DeliveryModel) Delete(id int) error {
-	query := `DELETE FROM deliveries WHERE id = $1`
-	_, err := r.db.Exec(query, id)
+// Delete soft deletes a delivery, keeping its attempts. Running deliveries cannot be deleted
+// until they are finished.
+func (r *DeliveryModel) Delete(scope ClientScope, id int) error {
+	var running bool
+	err := r.db.Get(&running, `
+		SELECT EXISTS (
+			SELECT 1 FROM deliveries
+			WHERE id = $1 AND is_finished IS NULL AND last_status IN ('started', 'running', 'ongoing', 'paused')
+		)`, id)
+	if err != nil {
+		return fmt.Errorf("failed to check delivery status: %w", err)
+	}
+	if running {
+		return fmt.Errorf("delivery is running")
+	}
+
+	query := `UPDATE deliveries SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL AND ` + examClientCondition("exam_id", 2)
+	result, err := r.db.Exec(query, id, scope.arg())
 	if err != nil {
 		return fmt.Errorf("failed to delete delivery: %w", err)
 	}
-	return nil
+	return requireRow(result, "delivery not found")
+}
+
+// deliveryClientCondition limits deliveries to the exams of the scope passed as argument n
+func deliveryClientCondition(n int) string {
+	return examClientCondition("exam_id", n)
+}
+
+// deliveryDeletedColumns are the columns of deleted deliveries, those of GetByID and deleted_at
+const deliveryDeletedColumns = `id, exam_id, group_id, name, scheduled_at, duration, ended_at,
+			   is_anytime, automatic_start, is_finished, last_status, display_name,
+			   created_at, updated_at, deleted_at`
+
+// ListDeleted gets the deleted deliveries, most recently deleted first
+func (r *DeliveryModel) ListDeleted(scope ClientScope, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
+	deliveries := []tables.Delivery{}
+	return listDeleted(r.db, &deliveries, "deliveries", deliveryDeletedColumns, deliveryClientCondition, scope, pagination)
+}
+
+// GetDeleted gets a deleted delivery
+func (r *DeliveryModel) GetDeleted(scope ClientScope, id int) (*tables.Delivery, error) {
+	delivery := &tables.Delivery{}
+	if err := getDeleted(r.db, delivery, "deliveries", deliveryDeletedColumns, deliveryClientCondition, scope, id, "delivery not found"); err != nil {
+		return nil, err
+	}
+	return delivery, nil
 }
 
-func (r *DeliveryModel) List(pagination tables.Pagination, search tables.DeliverySearchRequest) (*tables.PaginatedResponse, error) {
+// Restore restores a deleted delivery, whose exam and group must not be deleted
+func (r *DeliveryModel) Restore(scope ClientScope, id int) (*tables.Delivery, error) {
+	var deletedParent bool
+	err := r.db.Get(&deletedParent, `
+		SELECT EXISTS (
+			SELECT 1 FROM deliveries d
+			JOIN exams e ON e.id = d.exam_id
+			JOIN groups g ON g.id = d.group_id
+			WHERE d.id = $1 AND (e.deleted_at IS NOT NULL OR g.deleted_at IS NOT NULL)
+		)`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check delivery exam and group: %w", err)
+	}
+	if deletedParent {
+		return nil, fmt.Errorf("exam or group is deleted")
+	}
+
+	if err := restoreDeleted(r.db, "deliveries", deliveryClientCondition, scope, id, "delivery not found"); err != nil {
+		return nil, err
+	}
+	return r.GetByID(scope, id)
+}
+
+func (r *DeliveryModel) List(scope ClientScope, pagination tables.Pagination, search tables.DeliverySearchRequest) (*tables.PaginatedResponse, error) {
 	offset := (pagination.Page - 1) * pagination.PerPage
 
 	// Build WHERE clause and filter arguments separately
-	whereClause := "WHERE 1=1"
-	filterArgs := []interface{}{}
-	filterArgIndex := 1
+	whereClause := "WHERE d.deleted_at IS NULL AND " + examClientCondition("d.exam_id", 1)
+	filterArgs := []interface{}{scope.arg()}
+	filterArgIndex := 2
 
 	if search.Name != "" {
 		whereClause += fmt.Sprintf(" AND d.name ILIKE $%d", filterArgIndex)
@@ -286,7 +374,11 @@ func (r *DeliveryModel) List(pagination tables.Pagination, search tables.Deliver
 	}, nil
 }
 
-func (r *DeliveryModel) StartDelivery(id int) error {
+func (r *DeliveryModel) StartDelivery(scope ClientScope, id int) error {
+	if _, err := r.GetByID(scope, id); err != nil {
+		return err
+	}
+
 	// Use atomic update to prevent double start - only update if not already started
 	query := `
 		UPDATE deliveries 
@@ -334,13 +426,13 @@ func (r *DeliveryModel) StartDelivery(id int) error {
 	return nil
 }
 
-func (r *DeliveryModel) FinishDelivery(id int) error {
-	query := `UPDATE deliveries SET is_finished = NOW(), updated_at = NOW() WHERE id = $1`
-	_, err := r.db.Exec(query, id)
+func (r *DeliveryModel) FinishDelivery(scope ClientScope, id int) error {
+	query := `UPDATE deliveries SET is_finished = NOW(), updated_at = NOW() WHERE id = $1 AND ` + examClientCondition("exam_id", 2)
+	result, err := r.db.Exec(query, id, scope.arg())
 	if err != nil {
 		return fmt.Errorf("failed to finish delivery: %w", err)
 	}
-	return nil
+	return requireRow(result, "delivery not found")
 }
 
 func (r *DeliveryModel) UpdateStatus(id int, status string) error {
@@ -352,7 +444,11 @@ func (r *DeliveryModel) UpdateStatus(id int, status string) error {
 	return nil
 }
 
-func (r *DeliveryModel) PauseDelivery(id int) error {
+func (r *DeliveryModel) PauseDelivery(scope ClientScope, id int) error {
+	if _, err := r.GetByID(scope, id); err != nil {
+		return err
+	}
+
 	query := `UPDATE deliveries SET last_status = 'paused', updated_at = NOW() WHERE id = $1 AND last_status IN ('started', 'ongoing')`
 	result, err := r.db.Exec(query, id)
 	if err != nil {
@@ -371,7 +467,11 @@ func (r *DeliveryModel) PauseDelivery(id int) error {
 	return nil
 }
 
-func (r *DeliveryModel) ResumeDelivery(id int) error {
+func (r *DeliveryModel) ResumeDelivery(scope ClientScope, id int) error {
+	if _, err := r.GetByID(scope, id); err != nil {
+		return err
+	}
+
 	query := `UPDATE deliveries SET last_status = 'started', updated_at = NOW() WHERE id = $1 AND last_status = 'paused'`
 	result, err := r.db.Exec(query, id)
 	if err != nil {
@@ -390,7 +490,11 @@ func (r *DeliveryModel) ResumeDelivery(id int) error {
 	return nil
 }
 
-func (r *DeliveryModel) StopDelivery(id int) error {
+func (r *DeliveryModel) StopDelivery(scope ClientScope, id int) error {
+	if _, err := r.GetByID(scope, id); err != nil {
+		return err
+	}
+
 	query := `UPDATE deliveries SET is_finished = NOW(), last_status = 'stopped', updated_at = NOW() WHERE id = $1 AND is_finished IS NULL`
 	result, err := r.db.Exec(query, id)
 	if err != nil {
@@ -409,7 +513,11 @@ func (r *DeliveryModel) StopDelivery(id int) error {
 	return nil
 }
 
-func (r *DeliveryModel) GetParticipantProgress(deliveryID int) ([]interface{}, error) {
+func (r *DeliveryModel) GetParticipantProgress(scope ClientScope, deliveryID int) ([]interface{}, error) {
+	if _, err := r.GetByID(scope, deliveryID); err != nil {
+		return nil, err
+	}
+
 	query := `
 		SELECT 
 			p.id, p.name, COALESCE(p.email, '') as email, COALESCE(p.reg, '') as identifier,
@@ -507,9 +615,13 @@ func (r *DeliveryModel) GetParticipantProgress(deliveryID int) ([]interface{}, e
 	return progressList, nil
 }
 
-func (r *DeliveryModel) GetDeliveryAttempts(deliveryID int, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
+func (r *DeliveryModel) GetDeliveryAttempts(scope ClientScope, deliveryID int, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
 	offset := (pagination.Page - 1) * pagination.PerPage
 
+	if _, err := r.GetByID(scope, deliveryID); err != nil {
+		return nil, err
+	}
+
 	// Get total count of participants (not attempts)
 	countQuery := `
 		SELECT COUNT(DISTINCT dt.taker_id) 
@@ -646,27 +758,118 @@ func (r *DeliveryModel) GetDeliveryAttempts(deliveryID int, pagination tables.Pa
 	}, nil
 }
 
+// deliveryClosesAt is the SQL expression for the time a delivery closes: its end, or the
+// scheduled start plus the duration when it has none. Anytime deliveries accept attempts
+// until their end, so they close one duration later; without an end they never close.
+const deliveryClosesAt = `CASE WHEN d.is_anytime THEN d.ended_at + d.duration * INTERVAL '1 minute'
+			   ELSE COALESCE(d.ended_at, d.scheduled_at + d.duration * INTERVAL '1 minute') END`
+
 // GetDeliveriesForAutoStart retrieves deliveries that need to be automatically started
 func (r *DeliveryModel) GetDeliveriesForAutoStart(currentTime time.Time) ([]*DeliveryListItem, error) {
 	query := `
 		SELECT d.id, d.exam_id, d.group_id, d.display_name, d.scheduled_at, 
-			   d.duration, d.is_anytime, d.automatic_start, d.is_finished, 
+			   d.duration, d.ended_at, ` + deliveryClosesAt + `, d.is_anytime, d.automatic_start, d.is_finished, 
 			   d.last_status, d.created_at, d.updated_at,
 			   e.name as exam_title, g.name as group_name
 		FROM deliveries d
 		JOIN exams e ON d.exam_id = e.id
 		JOIN groups g ON d.group_id = g.id
 		WHERE d.automatic_start = true 
+		  AND d.deleted_at IS NULL
+		  AND d.scheduled_at IS NOT NULL
+		  AND d.scheduled_at <= $1
+		  AND (d.last_status IS NULL OR d.last_status NOT IN ('started', 'running', 'ongoing', 'finished'))
+		  AND d.is_finished IS NULL
+		ORDER BY d.scheduled_at ASC
+	`
+
+	return r.queryDeliveryListItems(query, currentTime)
+}
+
+// GetDeliveriesForStaging gets the automatically started deliveries scheduled before a time
+// whose exam content is not staged on an exam-client yet (never staged, waiting for capacity
+// or failed)
+func (r *DeliveryModel) GetDeliveriesForStaging(until time.Time) ([]*DeliveryListItem, error) {
+	query := `
+		SELECT d.id, d.exam_id, d.group_id, d.display_name, d.scheduled_at,
+			   d.duration, d.ended_at, ` + deliveryClosesAt + `, d.is_anytime, d.automatic_start, d.is_finished,
+			   d.last_status, d.created_at, d.updated_at,
+			   e.name as exam_title, g.name as group_name
+		FROM deliveries d
+		JOIN exams e ON d.exam_id = e.id
+		JOIN groups g ON d.group_id = g.id
+		LEFT JOIN delivery_staging s ON s.delivery_id = d.id
+		WHERE d.automatic_start = true
+		  AND d.deleted_at IS NULL
 		  AND d.scheduled_at IS NOT NULL
 		  AND d.scheduled_at <= $1
 		  AND (d.last_status IS NULL OR d.last_status NOT IN ('started', 'running', 'ongoing', 'finished'))
 		  AND d.is_finished IS NULL
+		  AND (s.delivery_id IS NULL OR s.status IN ('waiting', 'failed'))
+		ORDER BY d.scheduled_at ASC
+	`
+
+	return r.queryDeliveryListItems(query, until)
+}
+
+// GetDeliveriesForClosing gets the unfinished deliveries that closed at least grace before
+// currentTime, whether they were started or not
+func (r *DeliveryModel) GetDeliveriesForClosing(currentTime time.Time, grace time.Duration) ([]*DeliveryListItem, error) {
+	query := `
+		SELECT d.id, d.exam_id, d.group_id, d.display_name, d.scheduled_at,
+			   d.duration, d.ended_at, ` + deliveryClosesAt + `, d.is_anytime, d.automatic_start, d.is_finished,
+			   d.last_status, d.created_at, d.updated_at,
+			   e.name as exam_title, g.name as group_name
+		FROM deliveries d
+		JOIN exams e ON d.exam_id = e.id
+		JOIN groups g ON d.group_id = g.id
+		WHERE d.is_finished IS NULL
+		  AND ` + deliveryClosesAt + ` <= $1
 		ORDER BY d.scheduled_at ASC
 	`
 
-	rows, err := r.db.Query(query, currentTime)
+	return r.queryDeliveryListItems(query, currentTime.Add(-grace))
+}
+
+// CloseDelivery finishes a delivery whose time is up and ends the attempts still open on it
+func (r *DeliveryModel) CloseDelivery(id int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE deliveries
+		SET is_finished = NOW(), last_status = 'finished', updated_at = NOW()
+		WHERE id = $1 AND is_finished IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to close delivery: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("delivery cannot be closed - already finished")
+	}
+
+	_, err = tx.Exec(`UPDATE attempts SET ended_at = NOW(), updated_at = NOW() WHERE delivery_id = $1 AND ended_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to end open attempts: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (r *DeliveryModel) queryDeliveryListItems(query string, args ...interface{}) ([]*DeliveryListItem, error) {
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("error querying deliveries for auto start: %w", err)
+		return nil, fmt.Errorf("error querying deliveries: %w", err)
 	}
 	defer rows.Close()
 
@@ -681,6 +884,8 @@ func (r *DeliveryModel) GetDeliveriesForAutoStart(currentTime time.Time) ([]*Del
 			&delivery.DisplayName,
 			&delivery.ScheduledAt,
 			&delivery.Duration,
+			&delivery.EndedAt,
+			&delivery.ClosesAt,
 			&delivery.IsAnytime,
 			&delivery.AutomaticStart,
 			&delivery.IsFinished,
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
+)
+
+type DeliveryAccessCodeModel struct {
+	db *database.DB
+}
+
+func NewDeliveryAccessCodeModel(db *database.DB) *DeliveryAccessCodeModel {
+	return &DeliveryAccessCodeModel{db: db}
+}
+
+// Get gets the access code of a delivery, or nil when it does not require one
+func (r *DeliveryAccessCodeModel) Get(deliveryID int) (*tables.DeliveryAccessCode, error) {
+	var accessCode tables.DeliveryAccessCode
+	err := r.db.Get(&accessCode, `
+		SELECT delivery_id, code, created_by, created_at
+		FROM delivery_access_codes WHERE delivery_id = $1`, deliveryID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get delivery access code: %w", err)
+	}
+	return &accessCode, nil
+}
+
+// Generate requires a new random access code for a delivery, replacing any previous one
+func (r *DeliveryAccessCodeModel) Generate(deliveryID, userID int) (*tables.DeliveryAccessCode, error) {
+	code, err := utils.GenerateAccessCode()
+	if err != nil {
+		return nil, err
+	}
+
+	var accessCode tables.DeliveryAccessCode
+	err = r.db.Get(&accessCode, `
+		INSERT INTO delivery_access_codes (delivery_id, code, created_by, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (delivery_id) DO UPDATE SET
+			code = EXCLUDED.code, created_by = EXCLUDED.created_by, created_at = EXCLUDED.created_at
+		RETURNING delivery_id, code, created_by, created_at`,
+		deliveryID, code, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate delivery access code: %w", err)
+	}
+	return &accessCode, nil
+}
+
+// Delete stops requiring an access code for a delivery
+func (r *DeliveryAccessCodeModel) Delete(deliveryID int) error {
+	_, err := r.db.Exec(`DELETE FROM delivery_access_codes WHERE delivery_id = $1`, deliveryID)
+	if err != nil {
+		return fmt.Errorf("failed to delete delivery access code: %w", err)
+	}
+	return nil
+}
@@ -168,7 +168,7 @@ func (r *DeliveryAssignmentModel) GetUserDeliveries(userID int, roleType string)
 				   d.display_name, d.started_at, d.created_at, d.updated_at
 			FROM deliveries d
 			JOIN delivery_committee dc ON d.id = dc.delivery_id
-			WHERE dc.user_id = $1 AND dc.is_active = TRUE
+			WHERE dc.user_id = $1 AND dc.is_active = TRUE AND d.deleted_at IS NULL
 			ORDER BY d.scheduled_at DESC`
 	case "scorer":
 		query = `
@@ -177,7 +177,7 @@ func (r *DeliveryAssignmentModel) GetUserDeliveries(userID int, roleType string)
 				   d.display_name, d.started_at, d.created_at, d.updated_at
 			FROM deliveries d
 			JOIN delivery_scorer ds ON d.id = ds.delivery_id
-			WHERE ds.user_id = $1 AND ds.is_active = TRUE
+			WHERE ds.user_id = $1 AND ds.is_active = TRUE AND d.deleted_at IS NULL
 			ORDER BY d.scheduled_at DESC`
 	default:
 		// Get both committee and scorer deliveries
@@ -188,8 +188,9 @@ func (r *DeliveryAssignmentModel) GetUserDeliveries(userID int, roleType string)
 			FROM deliveries d
 			LEFT JOIN delivery_committee dc ON d.id = dc.delivery_id
 			LEFT JOIN delivery_scorer ds ON d.id = ds.delivery_id
-			WHERE (dc.user_id = $1 AND dc.is_active = TRUE) 
-				OR (ds.user_id = $1 AND ds.is_active = TRUE)
+			WHERE ((dc.user_id = $1 AND dc.is_active = TRUE) 
+				OR (ds.user_id = $1 AND ds.is_active = TRUE))
+				AND d.deleted_at IS NULL
 			ORDER BY d.scheduled_at DESC`
 	}
 
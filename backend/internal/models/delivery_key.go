@@ -0,0 +1,69 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
+)
+
+type DeliveryKeyModel struct {
+	db *database.DB
+}
+
+func NewDeliveryKeyModel(db *database.DB) *DeliveryKeyModel {
+	return &DeliveryKeyModel{db: db}
+}
+
+// GetOrCreate returns the key of a delivery, generating it the first time
+func (r *DeliveryKeyModel) GetOrCreate(deliveryID int) ([]byte, error) {
+	key, err := utils.GenerateDeliveryKey()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO delivery_keys (delivery_id, key_material, created_at, updated_at)
+		VALUES ($1, $2, NOW(), NOW())
+		ON CONFLICT (delivery_id) DO NOTHING`,
+		deliveryID, base64.StdEncoding.EncodeToString(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create delivery key: %w", err)
+	}
+
+	return r.Get(deliveryID)
+}
+
+// Get returns the key of a delivery
+func (r *DeliveryKeyModel) Get(deliveryID int) ([]byte, error) {
+	var deliveryKey tables.DeliveryKey
+	err := r.db.Get(&deliveryKey, `
+		SELECT delivery_id, key_material, released_at, released_to, created_at, updated_at
+		FROM delivery_keys WHERE delivery_id = $1`, deliveryID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("delivery key not found")
+		}
+		return nil, fmt.Errorf("failed to get delivery key: %w", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(deliveryKey.KeyMaterial)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode delivery key: %w", err)
+	}
+	return key, nil
+}
+
+// MarkReleased records that the key of a delivery was handed out to an exam-client
+func (r *DeliveryKeyModel) MarkReleased(deliveryID int, clientID string) error {
+	_, err := r.db.Exec(`
+		UPDATE delivery_keys SET released_at = NOW(), released_to = $2
+		WHERE delivery_id = $1`, deliveryID, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to mark delivery key released: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
+)
+
+type DeliveryNetworkModel struct {
+	db *database.DB
+}
+
+func NewDeliveryNetworkModel(db *database.DB) *DeliveryNetworkModel {
+	return &DeliveryNetworkModel{db: db}
+}
+
+// GetRules gets the allow-list of a delivery
+func (r *DeliveryNetworkModel) GetRules(deliveryID int) ([]tables.DeliveryNetworkRule, error) {
+	rules := []tables.DeliveryNetworkRule{}
+	query := `
+		SELECT id, delivery_id, kind, value, description, created_by, created_at, updated_at
+		FROM delivery_network_rule
+		WHERE delivery_id = $1
+		ORDER BY kind, value`
+
+	err := r.db.Select(&rules, query, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network rules: %w", err)
+	}
+	return rules, nil
+}
+
+// GetOpenNetworks gets the networks on the allow-lists of the deliveries not finished yet
+func (r *DeliveryNetworkModel) GetOpenNetworks() ([]string, error) {
+	networks := []string{}
+	query := `
+		SELECT DISTINCT r.value
+		FROM delivery_network_rule r
+		JOIN deliveries d ON d.id = r.delivery_id
+		WHERE r.kind = $1 AND d.is_finished IS NULL AND d.deleted_at IS NULL`
+
+	err := r.db.Select(&networks, query, tables.NetworkRuleKindCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open delivery networks: %w", err)
+	}
+	return networks, nil
+}
+
+// ReplaceRules replaces the allow-list of a delivery. An empty list removes all restrictions.
+func (r *DeliveryNetworkModel) ReplaceRules(deliveryID int, rules []tables.DeliveryNetworkRuleRequest, createdBy int) ([]tables.DeliveryNetworkRule, error) {
+	for i, rule := range rules {
+		if rule.Kind == "" {
+			rules[i].Kind = tables.NetworkRuleKindCIDR
+		}
+		if rules[i].Kind == tables.NetworkRuleKindCIDR {
+			network, err := utils.ParseNetwork(rule.Value)
+			if err != nil {
+				return nil, err
+			}
+			rules[i].Value = network.String()
+		}
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM delivery_network_rule WHERE delivery_id = $1", deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clear network rules: %w", err)
+	}
+
+	for _, rule := range rules {
+		_, err = tx.Exec(`
+			INSERT INTO delivery_network_rule (delivery_id, kind, value, description, created_by, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+			ON CONFLICT (delivery_id, kind, value) DO NOTHING`,
+			deliveryID, rule.Kind, rule.Value, rule.Description, createdBy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add network rule %s: %w", rule.Value, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit network rules: %w", err)
+	}
+
+	return r.GetRules(deliveryID)
+}
+
+// GetOverrides gets all participant overrides of a delivery
+func (r *DeliveryNetworkModel) GetOverrides(deliveryID int) ([]tables.DeliveryNetworkOverride, error) {
+	overrides := []tables.DeliveryNetworkOverride{}
+	query := `
+		SELECT o.id, o.delivery_id, o.taker_id, t.name as taker_name, o.reason, o.granted_by,
+			   o.expires_at, o.created_at, o.updated_at
+		FROM delivery_network_override o
+		JOIN takers t ON o.taker_id = t.id
+		WHERE o.delivery_id = $1
+		ORDER BY o.created_at DESC`
+
+	err := r.db.Select(&overrides, query, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network overrides: %w", err)
+	}
+	return overrides, nil
+}
+
+// GetActiveOverrideTakers gets the participants with a non-expired override
+func (r *DeliveryNetworkModel) GetActiveOverrideTakers(deliveryID int) ([]int, error) {
+	takerIDs := []int{}
+	query := `
+		SELECT taker_id FROM delivery_network_override
+		WHERE delivery_id = $1 AND (expires_at IS NULL OR expires_at > NOW())`
+
+	err := r.db.Select(&takerIDs, query, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get override takers: %w", err)
+	}
+	return takerIDs, nil
+}
+
+// HasActiveOverride checks if a participant may bypass the allow-list
+func (r *DeliveryNetworkModel) HasActiveOverride(deliveryID, takerID int) (bool, error) {
+	var count int
+	err := r.db.QueryRow(`
+		SELECT COUNT(*) FROM delivery_network_override
+		WHERE delivery_id = $1 AND taker_id = $2 AND (expires_at IS NULL OR expires_at > NOW())`,
+		deliveryID, takerID,
+	).Scan(&count)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("failed to check network override: %w", err)
+	}
+	return count > 0, nil
+}
+
+// SetOverride grants or updates a participant override
+func (r *DeliveryNetworkModel) SetOverride(deliveryID int, req *tables.DeliveryNetworkOverrideRequest, grantedBy int) (*tables.DeliveryNetworkOverride, error) {
+	override := &tables.DeliveryNetworkOverride{}
+	query := `
+		INSERT INTO delivery_network_override (delivery_id, taker_id, reason, granted_by, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		ON CONFLICT (delivery_id, taker_id)
+		DO UPDATE SET reason = $3, granted_by = $4, expires_at = $5, updated_at = NOW()
+		RETURNING id, delivery_id, taker_id, reason, granted_by, expires_at, created_at, updated_at`
+
+	err := r.db.Get(override, query, deliveryID, req.TakerID, req.Reason, grantedBy, req.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set network override: %w", err)
+	}
+	return override, nil
+}
+
+// RemoveOverride revokes a participant override
+func (r *DeliveryNetworkModel) RemoveOverride(deliveryID, takerID int) error {
+	result, err := r.db.Exec(
+		"DELETE FROM delivery_network_override WHERE delivery_id = $1 AND taker_id = $2",
+		deliveryID, takerID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to remove network override: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("network override not found")
+	}
+	return nil
+}
+
+// LogViolation records a request rejected by the allow-list
+func (r *DeliveryNetworkModel) LogViolation(violation *tables.DeliveryAccessViolation) error {
+	query := `
+		INSERT INTO delivery_access_violation (delivery_id, taker_id, attempt_id, ip_address, action, source, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING id, created_at`
+
+	err := r.db.QueryRow(query, violation.DeliveryID, violation.TakerID, violation.AttemptID,
+		violation.IPAddress, violation.Action, violation.Source).Scan(&violation.ID, &violation.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to log access violation: %w", err)
+	}
+	return nil
+}
+
+// ListViolations lists rejected requests of a delivery, newest first
+func (r *DeliveryNetworkModel) ListViolations(deliveryID int, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
+	offset := (pagination.Page - 1) * pagination.PerPage
+
+	var total int
+	err := r.db.Get(&total, "SELECT COUNT(*) FROM delivery_access_violation WHERE delivery_id = $1", deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get total count: %w", err)
+	}
+
+	violations := []tables.DeliveryAccessViolation{}
+	query := `
+		SELECT id, delivery_id, taker_id, attempt_id, ip_address, action, source, created_at
+		FROM delivery_access_violation
+		WHERE delivery_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3`
+
+	err = r.db.Select(&violations, query, deliveryID, pagination.PerPage, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access violations: %w", err)
+	}
+
+	totalPages := (total + pagination.PerPage - 1) / pagination.PerPage
+
+	return &tables.PaginatedResponse{
+		Data:       violations,
+		Total:      total,
+		Page:       pagination.Page,
+		PerPage:    pagination.PerPage,
+		TotalPages: totalPages,
+	}, nil
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+type DeliveryQueueModel struct {
+	db *database.DB
+}
+
+func NewDeliveryQueueModel(db *database.DB) *DeliveryQueueModel {
+	return &DeliveryQueueModel{db: db}
+}
+
+// Enqueue queues a delivery for the next exam-client asking for work, replacing an earlier
+// assignment of the same delivery
+func (r *DeliveryQueueModel) Enqueue(assignment *tables.DeliveryAssignment) error {
+	examData, err := json.Marshal(assignment.ExamData)
+	if err != nil {
+		return fmt.Errorf("failed to encode exam data: %w", err)
+	}
+	config, err := json.Marshal(assignment.Config)
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO delivery_queue (delivery_id, delivery_name, exam_data, config, queued_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (delivery_id) DO UPDATE SET
+			delivery_name = EXCLUDED.delivery_name, exam_data = EXCLUDED.exam_data,
+			config = EXCLUDED.config, queued_at = EXCLUDED.queued_at`,
+		assignment.DeliveryID, assignment.DeliveryName, examData, config)
+	if err != nil {
+		return fmt.Errorf("failed to queue delivery: %w", err)
+	}
+	return nil
+}
+
+// Claim takes the oldest queued delivery off the queue. Rows being claimed by another
+// replica are skipped. It returns nil when the queue is empty.
+func (r *DeliveryQueueModel) Claim() (*tables.DeliveryAssignment, error) {
+	var assignment tables.DeliveryAssignment
+	var examData, config []byte
+	err := r.db.QueryRow(`
+		DELETE FROM delivery_queue
+		WHERE delivery_id = (
+			SELECT delivery_id FROM delivery_queue
+			ORDER BY queued_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING delivery_id, delivery_name, exam_data, config`,
+	).Scan(&assignment.DeliveryID, &assignment.DeliveryName, &examData, &config)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to claim queued delivery: %w", err)
+	}
+
+	if err := json.Unmarshal(examData, &assignment.ExamData); err != nil {
+		return nil, fmt.Errorf("failed to decode exam data: %w", err)
+	}
+	if err := json.Unmarshal(config, &assignment.Config); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	return &assignment, nil
+}
@@ -0,0 +1,189 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+type DeliveryStagingModel struct {
+	db *database.DB
+}
+
+func NewDeliveryStagingModel(db *database.DB) *DeliveryStagingModel {
+	return &DeliveryStagingModel{db: db}
+}
+
+const deliveryStagingSelect = `
+	SELECT delivery_id, status, client_id, content_digest, content_size, question_count, release_at,
+		   queued_at, assigned_at, staged_at, released_at, alerted_at, last_error, created_at, updated_at
+	FROM delivery_staging`
+
+// Get gets the staging of a delivery
+func (r *DeliveryStagingModel) Get(deliveryID int) (*tables.DeliveryStaging, error) {
+	var staging tables.DeliveryStaging
+	err := r.db.Get(&staging, deliveryStagingSelect+` WHERE delivery_id = $1`, deliveryID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("delivery staging not found")
+		}
+		return nil, fmt.Errorf("failed to get delivery staging: %w", err)
+	}
+	return &staging, nil
+}
+
+// MarkWaiting records that a delivery is due for staging but no exam-client has capacity
+func (r *DeliveryStagingModel) MarkWaiting(deliveryID int, releaseAt time.Time) error {
+	_, err := r.db.Exec(`
+		INSERT INTO delivery_staging (delivery_id, status, release_at, created_at, updated_at)
+		VALUES ($1, 'waiting', $2, NOW(), NOW())
+		ON CONFLICT (delivery_id) DO UPDATE SET release_at = EXCLUDED.release_at
+		WHERE delivery_staging.status IN ('waiting', 'failed')`,
+		deliveryID, releaseAt)
+	if err != nil {
+		return fmt.Errorf("failed to record delivery staging: %w", err)
+	}
+	return nil
+}
+
+// Queue records the content package of a delivery queued for an exam-client to stage,
+// restarting a waiting or failed staging
+func (r *DeliveryStagingModel) Queue(deliveryID int, digest string, size, questionCount int, releaseAt time.Time) error {
+	_, err := r.db.Exec(`
+		INSERT INTO delivery_staging (delivery_id, status, content_digest, content_size, question_count,
+			release_at, queued_at, created_at, updated_at)
+		VALUES ($1, 'queued', $2, $3, $4, $5, NOW(), NOW(), NOW())
+		ON CONFLICT (delivery_id) DO UPDATE SET
+			status = 'queued',
+			client_id = NULL,
+			content_digest = EXCLUDED.content_digest,
+			content_size = EXCLUDED.content_size,
+			question_count = EXCLUDED.question_count,
+			release_at = EXCLUDED.release_at,
+			queued_at = NOW(),
+			assigned_at = NULL,
+			staged_at = NULL`,
+		deliveryID, digest, size, questionCount, releaseAt)
+	if err != nil {
+		return fmt.Errorf("failed to queue delivery staging: %w", err)
+	}
+	return nil
+}
+
+// MarkQueueFailed records that the content of a delivery could not be queued for an
+// exam-client, so it is staged again
+func (r *DeliveryStagingModel) MarkQueueFailed(deliveryID int, reason string) error {
+	_, err := r.db.Exec(`
+		UPDATE delivery_staging SET status = 'failed', last_error = $2
+		WHERE delivery_id = $1 AND status = 'queued'`,
+		deliveryID, reason)
+	if err != nil {
+		return fmt.Errorf("failed to mark delivery staging failed: %w", err)
+	}
+	return nil
+}
+
+// MarkAssigned records the exam-client that picked up the content of a delivery
+func (r *DeliveryStagingModel) MarkAssigned(deliveryID int, clientID string) error {
+	result, err := r.db.Exec(`
+		UPDATE delivery_staging SET status = 'assigned', client_id = $2, assigned_at = NOW()
+		WHERE delivery_id = $1 AND status = 'queued'`,
+		deliveryID, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to mark delivery staging assigned: %w", err)
+	}
+	return requireStagingRow(result)
+}
+
+// MarkStaged records that the assigned exam-client stored the content and verified its digest
+func (r *DeliveryStagingModel) MarkStaged(deliveryID int, clientID, digest string) error {
+	staging, err := r.Get(deliveryID)
+	if err != nil {
+		return err
+	}
+	if staging.ClientID == nil || *staging.ClientID != clientID {
+		return fmt.Errorf("delivery is staged by another exam client")
+	}
+	if staging.ContentDigest == nil || *staging.ContentDigest != digest {
+		return fmt.Errorf("staged content digest mismatch")
+	}
+
+	_, err = r.db.Exec(`
+		UPDATE delivery_staging SET status = 'staged', staged_at = NOW(), last_error = NULL
+		WHERE delivery_id = $1 AND client_id = $2`,
+		deliveryID, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to mark delivery staged: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed records that the assigned exam-client could not stage the content
+func (r *DeliveryStagingModel) MarkFailed(deliveryID int, clientID, reason string) error {
+	result, err := r.db.Exec(`
+		UPDATE delivery_staging SET status = 'failed', last_error = $3
+		WHERE delivery_id = $1 AND client_id = $2 AND status <> 'staged'`,
+		deliveryID, clientID, reason)
+	if err != nil {
+		return fmt.Errorf("failed to mark delivery staging failed: %w", err)
+	}
+	return requireStagingRow(result)
+}
+
+// MarkReleased records that the delivery key may be handed to the exam-client staging the delivery
+func (r *DeliveryStagingModel) MarkReleased(deliveryID int) error {
+	_, err := r.db.Exec(`
+		UPDATE delivery_staging SET released_at = COALESCE(released_at, NOW())
+		WHERE delivery_id = $1`, deliveryID)
+	if err != nil {
+		return fmt.Errorf("failed to release delivery key: %w", err)
+	}
+	return nil
+}
+
+// ListPendingRelease lists the stagings whose key was not released yet
+func (r *DeliveryStagingModel) ListPendingRelease() ([]tables.DeliveryStaging, error) {
+	stagings := []tables.DeliveryStaging{}
+	err := r.db.Select(&stagings, deliveryStagingSelect+`
+		WHERE released_at IS NULL ORDER BY release_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending delivery stagings: %w", err)
+	}
+	return stagings, nil
+}
+
+// ListIncomplete lists the stagings not complete although the delivery starts before a time,
+// that were not alerted yet
+func (r *DeliveryStagingModel) ListIncomplete(before time.Time) ([]tables.DeliveryStaging, error) {
+	stagings := []tables.DeliveryStaging{}
+	err := r.db.Select(&stagings, deliveryStagingSelect+`
+		WHERE status <> 'staged' AND alerted_at IS NULL AND release_at <= $1
+		ORDER BY release_at`, before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list incomplete delivery stagings: %w", err)
+	}
+	return stagings, nil
+}
+
+// MarkAlerted records that an incomplete staging was alerted
+func (r *DeliveryStagingModel) MarkAlerted(deliveryID int) error {
+	_, err := r.db.Exec(`UPDATE delivery_staging SET alerted_at = NOW() WHERE delivery_id = $1`, deliveryID)
+	if err != nil {
+		return fmt.Errorf("failed to mark delivery staging alerted: %w", err)
+	}
+	return nil
+}
+
+func requireStagingRow(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("delivery staging not found")
+	}
+	return nil
+}
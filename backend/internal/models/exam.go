@@ -17,14 +17,21 @@ func NewExamModel(db *database.DB) *ExamModel {
 	return &ExamModel{db: db}
 }
 
-func (r *ExamModel) Create(exam *tables.Exam) error {
+// Create creates an exam for the client of scope
+func (r *ExamModel) Create(scope ClientScope, exam *tables.Exam) error {
+	clientID, err := scope.owner()
+	if err != nil {
+		return err
+	}
+	exam.ClientID = clientID
+
 	query := `
 		INSERT INTO exams (code, name, description, options, is_mcq, is_interview, 
 						  is_random, client_id, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
 		RETURNING id, created_at, updated_at`
 
-	err := r.db.QueryRow(query, exam.Code, exam.Name, exam.Description, exam.Options,
+	err = r.db.QueryRow(query, exam.Code, exam.Name, exam.Description, exam.Options,
 		exam.IsMCQ, exam.IsInterview, exam.IsRandom, exam.ClientID).Scan(&exam.ID, &exam.CreatedAt, &exam.UpdatedAt)
 
 	if err != nil {
@@ -33,15 +40,15 @@ func (r *ExamModel) Create(exam *tables.Exam) error {
 	return nil
 }
 
-func (r *ExamModel) GetByID(id int) (*tables.Exam, error) {
+func (r *ExamModel) GetByID(scope ClientScope, id int) (*tables.Exam, error) {
 	exam := &tables.Exam{}
 	query := `
 		SELECT id, code, name, description, options, is_mcq, is_interview, 
 			   is_random, client_id, created_at, updated_at
 		FROM exams 
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL AND ` + clientCondition("client_id", 2)
 
-	err := r.db.Get(exam, query, id)
+	err := r.db.Get(exam, query, id, scope.arg())
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("exam not found")
@@ -51,15 +58,15 @@ func (r *ExamModel) GetByID(id int) (*tables.Exam, error) {
 	return exam, nil
 }
 
-func (r *ExamModel) GetByCode(code string) (*tables.Exam, error) {
+func (r *ExamModel) GetByCode(scope ClientScope, code string) (*tables.Exam, error) {
 	exam := &tables.Exam{}
 	query := `
 		SELECT id, code, name, description, options, is_mcq, is_interview, 
 			   is_random, client_id, created_at, updated_at
 		FROM exams 
-		WHERE code = $1`
+		WHERE code = $1 AND deleted_at IS NULL AND ` + clientCondition("client_id", 2)
 
-	err := r.db.Get(exam, query, code)
+	err := r.db.Get(exam, query, code, scope.arg())
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("exam not found")
@@ -69,7 +76,7 @@ func (r *ExamModel) GetByCode(code string) (*tables.Exam, error) {
 	return exam, nil
 }
 
-func (r *ExamModel) Update(id int, updates *tables.ExamUpdateRequest) (*tables.Exam, error) {
+func (r *ExamModel) Update(scope ClientScope, id int, updates *tables.ExamUpdateRequest) (*tables.Exam, error) {
 	setParts := []string{}
 	args := []interface{}{}
 	argIndex := 1
@@ -106,42 +113,83 @@ func (r *ExamModel) Update(id int, updates *tables.ExamUpdateRequest) (*tables.E
 	}
 
 	if len(setParts) == 0 {
-		return r.GetByID(id)
+		return r.GetByID(scope, id)
 	}
 
 	setParts = append(setParts, "updated_at = NOW()")
 	setClause := strings.Join(setParts, ", ")
-	args = append(args, id)
+	args = append(args, id, scope.arg())
 
 	query := fmt.Sprintf(`
 		UPDATE exams 
 		SET %s 
-		WHERE id = $%d`, setClause, argIndex)
+		WHERE id = $%d AND deleted_at IS NULL AND %s`, setClause, argIndex, clientCondition("client_id", argIndex+1))
 
-	_, err := r.db.Exec(query, args...)
+	result, err := r.db.Exec(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update exam: %w", err)
 	}
+	if err := requireRow(result, "exam not found"); err != nil {
+		return nil, err
+	}
 
-	return r.GetByID(id)
+	return r.GetByID(scope, id)
 }
 
-func (r *ExamModel) Delete(id int) error {
-	query := `DELETE FROM exams WHERE id = $1`
-	_, err := r.db.Exec(query, id)
+// Delete soft deletes an exam. Exams with deliveries, whose attempts need the exam, cannot
+// be deleted until their deliveries are.
+func (r *ExamModel) Delete(scope ClientScope, id int) error {
+	var hasDeliveries bool
+	err := r.db.Get(&hasDeliveries, `SELECT EXISTS (SELECT 1 FROM deliveries WHERE exam_id = $1 AND deleted_at IS NULL)`, id)
+	if err != nil {
+		return fmt.Errorf("failed to check exam deliveries: %w", err)
+	}
+	if hasDeliveries {
+		return fmt.Errorf("exam has deliveries")
+	}
+
+	query := `UPDATE exams SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL AND ` + clientCondition("client_id", 2)
+	result, err := r.db.Exec(query, id, scope.arg())
 	if err != nil {
 		return fmt.Errorf("failed to delete exam: %w", err)
 	}
-	return nil
+	return requireRow(result, "exam not found")
 }
 
-func (r *ExamModel) List(pagination tables.Pagination, search tables.ExamSearchRequest) (*tables.PaginatedResponse, error) {
+// examDeletedColumns are the columns of deleted exams, those of GetByID and deleted_at
+const examDeletedColumns = `id, code, name, description, options, is_mcq, is_interview,
+			   is_random, client_id, created_at, updated_at, deleted_at`
+
+// ListDeleted gets the deleted exams, most recently deleted first
+func (r *ExamModel) ListDeleted(scope ClientScope, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
+	exams := []tables.Exam{}
+	return listDeleted(r.db, &exams, "exams", examDeletedColumns, clientIDCondition, scope, pagination)
+}
+
+// GetDeleted gets a deleted exam
+func (r *ExamModel) GetDeleted(scope ClientScope, id int) (*tables.Exam, error) {
+	exam := &tables.Exam{}
+	if err := getDeleted(r.db, exam, "exams", examDeletedColumns, clientIDCondition, scope, id, "exam not found"); err != nil {
+		return nil, err
+	}
+	return exam, nil
+}
+
+// Restore restores a deleted exam
+func (r *ExamModel) Restore(scope ClientScope, id int) (*tables.Exam, error) {
+	if err := restoreDeleted(r.db, "exams", clientIDCondition, scope, id, "exam not found"); err != nil {
+		return nil, err
+	}
+	return r.GetByID(scope, id)
+}
+
+func (r *ExamModel) List(scope ClientScope, pagination tables.Pagination, search tables.ExamSearchRequest) (*tables.PaginatedResponse, error) {
 	offset := (pagination.Page - 1) * pagination.PerPage
 
 	// Build WHERE clause and arguments
-	whereClause := "WHERE 1=1"
-	args := []interface{}{}
-	argIndex := 1
+	whereClause := "WHERE deleted_at IS NULL AND " + clientCondition("client_id", 1)
+	args := []interface{}{scope.arg()}
+	argIndex := 2
 
 	if search.Code != "" {
 		whereClause += fmt.Sprintf(" AND code ILIKE $%d", argIndex)
@@ -203,15 +251,19 @@ func (r *ExamModel) List(pagination tables.Pagination, search tables.ExamSearchR
 	}, nil
 }
 
-func (r *ExamModel) GetExamItems(examID int, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
+func (r *ExamModel) GetExamItems(scope ClientScope, examID int, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
 	offset := (pagination.Page - 1) * pagination.PerPage
 
+	if _, err := r.GetByID(scope, examID); err != nil {
+		return nil, err
+	}
+
 	// Get total count
 	countQuery := `
 		SELECT COUNT(*) 
 		FROM exam_item ei 
 		JOIN items i ON ei.item_id = i.id 
-		WHERE ei.exam_id = $1`
+		WHERE ei.exam_id = $1 AND i.deleted_at IS NULL`
 	var total int
 	err := r.db.Get(&total, countQuery, examID)
 	if err != nil {
@@ -224,7 +276,7 @@ func (r *ExamModel) GetExamItems(examID int, pagination tables.Pagination) (*tab
 			   i.score, i.client_id, i.created_at, i.updated_at, ei.order
 		FROM exam_item ei 
 		JOIN items i ON ei.item_id = i.id 
-		WHERE ei.exam_id = $1
+		WHERE ei.exam_id = $1 AND i.deleted_at IS NULL
 		ORDER BY ei.order, i.id
 		LIMIT $2 OFFSET $3`
 
@@ -250,33 +302,92 @@ func (r *ExamModel) GetExamItems(examID int, pagination tables.Pagination) (*tab
 	}, nil
 }
 
-func (r *ExamModel) AddItem(examID, itemID, order int) error {
+// AddItem adds an item to an exam, both of the client of scope
+func (r *ExamModel) AddItem(scope ClientScope, examID, itemID, order int) error {
 	query := `
 		INSERT INTO exam_item (exam_id, item_id, "order")
-		VALUES ($1, $2, $3)
+		SELECT e.id, i.id, $3::int
+		FROM exams e, items i
+		WHERE e.id = $1 AND i.id = $2 AND e.deleted_at IS NULL AND i.deleted_at IS NULL
+			AND ` + clientCondition("e.client_id", 4) + ` AND ` + clientCondition("i.client_id", 4) + `
 		ON CONFLICT (exam_id, item_id) DO UPDATE SET "order" = EXCLUDED."order"`
 
-	_, err := r.db.Exec(query, examID, itemID, order)
+	result, err := r.db.Exec(query, examID, itemID, order, scope.arg())
 	if err != nil {
 		return fmt.Errorf("failed to add item to exam: %w", err)
 	}
-	return nil
+	return requireRow(result, "exam or item not found")
 }
 
-func (r *ExamModel) RemoveItem(examID, itemID int) error {
-	query := `DELETE FROM exam_item WHERE exam_id = $1 AND item_id = $2`
-	_, err := r.db.Exec(query, examID, itemID)
+func (r *ExamModel) RemoveItem(scope ClientScope, examID, itemID int) error {
+	query := `DELETE FROM exam_item WHERE exam_id = $1 AND item_id = $2 AND ` + examClientCondition("exam_id", 3)
+	_, err := r.db.Exec(query, examID, itemID, scope.arg())
 	if err != nil {
 		return fmt.Errorf("failed to remove item from exam: %w", err)
 	}
 	return nil
 }
 
-func (r *ExamModel) UpdateItemOrder(examID, itemID, order int) error {
-	query := `UPDATE exam_item SET "order" = $3 WHERE exam_id = $1 AND item_id = $2`
-	_, err := r.db.Exec(query, examID, itemID, order)
+func (r *ExamModel) UpdateItemOrder(scope ClientScope, examID, itemID, order int) error {
+	query := `UPDATE exam_item SET "order" = $3 WHERE exam_id = $1 AND item_id = $2 AND ` + examClientCondition("exam_id", 4)
+	_, err := r.db.Exec(query, examID, itemID, order, scope.arg())
 	if err != nil {
 		return fmt.Errorf("failed to update item order: %w", err)
 	}
 	return nil
 }
+
+// GetExamContent gets the questions of an exam in exam order, with their item and answer
+// options, for delivery to an exam-client. Correct answers are left out.
+func (r *ExamModel) GetExamContent(scope ClientScope, examID int) (*tables.ExamContent, error) {
+	if _, err := r.GetByID(scope, examID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT q.id, ROW_NUMBER() OVER (ORDER BY ei."order", i.id, q."order", q.id) AS position,
+			   i.id AS item_id, i.title AS item_title, i.content AS item_content,
+			   q.type, q.question, q.score
+		FROM exam_item ei
+		JOIN items i ON ei.item_id = i.id
+		JOIN questions q ON q.item_id = i.id
+		WHERE ei.exam_id = $1 AND i.deleted_at IS NULL
+		ORDER BY position`
+
+	questions := []tables.ExamContentQuestion{}
+	err := r.db.Select(&questions, query, examID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exam questions: %w", err)
+	}
+
+	optionsQuery := `
+		SELECT a.id, a.question_id, a.answer, a."order"
+		FROM answers a
+		JOIN questions q ON a.question_id = q.id
+		JOIN exam_item ei ON ei.item_id = q.item_id
+		JOIN items i ON i.id = ei.item_id
+		WHERE ei.exam_id = $1 AND i.deleted_at IS NULL
+		ORDER BY a."order", a.id`
+
+	options := []tables.ExamContentOption{}
+	err = r.db.Select(&options, optionsQuery, examID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exam answer options: %w", err)
+	}
+
+	byQuestion := make(map[int][]tables.ExamContentOption)
+	for _, option := range options {
+		byQuestion[option.QuestionID] = append(byQuestion[option.QuestionID], option)
+	}
+	for i := range questions {
+		questions[i].Options = byQuestion[questions[i].ID]
+		if questions[i].Options == nil {
+			questions[i].Options = []tables.ExamContentOption{}
+		}
+	}
+
+	return &tables.ExamContent{
+		ExamID:    examID,
+		Questions: questions,
+	}, nil
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+type ExamClientModel struct {
+	db *database.DB
+}
+
+func NewExamClientModel(db *database.DB) *ExamClientModel {
+	return &ExamClientModel{db: db}
+}
+
+const examClientSelect = `
+	SELECT client_id, client_ip, port, max_deliveries, version, capabilities, registered_at, last_seen,
+		   active_deliveries, total_processed, uptime, deliveries, outbox_backlog
+	FROM exam_clients`
+
+// Register records a registering exam-client. A client registering again keeps its row but
+// starts with a fresh status. It returns whether the client was registered before.
+func (r *ExamClientModel) Register(client *tables.RegisteredClient) (bool, error) {
+	capabilities, err := json.Marshal(client.Capabilities)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode capabilities: %w", err)
+	}
+
+	var existed bool
+	err = r.db.QueryRow(`
+		INSERT INTO exam_clients (client_id, client_ip, port, max_deliveries, version, capabilities,
+								  registered_at, last_seen, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7, NOW(), NOW())
+		ON CONFLICT (client_id) DO UPDATE SET
+			client_ip = EXCLUDED.client_ip, port = EXCLUDED.port,
+			max_deliveries = EXCLUDED.max_deliveries, version = EXCLUDED.version,
+			capabilities = EXCLUDED.capabilities, registered_at = EXCLUDED.registered_at,
+			last_seen = EXCLUDED.last_seen, active_deliveries = 0, total_processed = 0,
+			uptime = 0, deliveries = '[]', outbox_backlog = 0
+		RETURNING (xmax <> 0)`,
+		client.ClientID, client.ClientIP, client.Port, client.MaxDeliveries, client.Version,
+		capabilities, client.RegisteredAt).Scan(&existed)
+	if err != nil {
+		return false, fmt.Errorf("failed to register exam client: %w", err)
+	}
+	return existed, nil
+}
+
+// UpdateStatus records the status reported by a registered exam-client
+func (r *ExamClientModel) UpdateStatus(clientID string, status *tables.ExamClientStatus) error {
+	deliveries, err := json.Marshal(status.Deliveries)
+	if err != nil {
+		return fmt.Errorf("failed to encode deliveries: %w", err)
+	}
+
+	result, err := r.db.Exec(`
+		UPDATE exam_clients
+		SET last_seen = NOW(), active_deliveries = $2, total_processed = $3, uptime = $4,
+			deliveries = $5, outbox_backlog = $6
+		WHERE client_id = $1`,
+		clientID, status.ActiveDeliveries, status.TotalProcessed, status.Uptime, deliveries, status.OutboxBacklog)
+	if err != nil {
+		return fmt.Errorf("failed to update exam client status: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("exam client not registered")
+	}
+	return nil
+}
+
+// Get gets a registered exam-client
+func (r *ExamClientModel) Get(clientID string) (*tables.RegisteredClient, error) {
+	clients, err := r.query(examClientSelect+` WHERE client_id = $1`, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("exam client not registered")
+	}
+	return clients[0], nil
+}
+
+// List lists the registered exam-clients
+func (r *ExamClientModel) List() ([]*tables.RegisteredClient, error) {
+	return r.query(examClientSelect + ` ORDER BY client_id`)
+}
+
+// ListSeenSince lists the exam-clients that reported since a time, i.e. that are online
+func (r *ExamClientModel) ListSeenSince(since time.Time) ([]*tables.RegisteredClient, error) {
+	return r.query(examClientSelect+` WHERE last_seen >= $1 ORDER BY client_id`, since)
+}
+
+// Delete removes an exam-client from the registry
+func (r *ExamClientModel) Delete(clientID string) error {
+	if _, err := r.db.Exec(`DELETE FROM exam_clients WHERE client_id = $1`, clientID); err != nil {
+		return fmt.Errorf("failed to delete exam client: %w", err)
+	}
+	return nil
+}
+
+func (r *ExamClientModel) query(query string, args ...interface{}) ([]*tables.RegisteredClient, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query exam clients: %w", err)
+	}
+	defer rows.Close()
+
+	clients := []*tables.RegisteredClient{}
+	for rows.Next() {
+		var client tables.RegisteredClient
+		var capabilities, deliveries []byte
+		err := rows.Scan(&client.ClientID, &client.ClientIP, &client.Port, &client.MaxDeliveries,
+			&client.Version, &capabilities, &client.RegisteredAt, &client.LastSeen,
+			&client.ActiveDeliveries, &client.TotalProcessed, &client.Uptime, &deliveries, &client.OutboxBacklog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan exam client: %w", err)
+		}
+		if err := json.Unmarshal(capabilities, &client.Capabilities); err != nil {
+			return nil, fmt.Errorf("failed to decode capabilities: %w", err)
+		}
+		if err := json.Unmarshal(deliveries, &client.Deliveries); err != nil {
+			return nil, fmt.Errorf("failed to decode deliveries: %w", err)
+		}
+		clients = append(clients, &client)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate exam clients: %w", err)
+	}
+	return clients, nil
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+type ExamClientCredentialModel struct {
+	db *database.DB
+
+	// When expired nonces were last pruned by this replica
+	noncesPrunedAt time.Time
+	nonceMu        sync.Mutex
+}
+
+func NewExamClientCredentialModel(db *database.DB) *ExamClientCredentialModel {
+	return &ExamClientCredentialModel{db: db}
+}
+
+const examClientCredentialSelect = `
+	SELECT id, client_id, secret, enrolled_ip, enrolled_at, revoked_at, revoked_by, revoke_reason, created_at, updated_at
+	FROM exam_client_credentials`
+
+// Enroll stores the secret of a new exam-client. A client ID can only be enrolled once.
+func (r *ExamClientCredentialModel) Enroll(clientID, secret, ip string) (*tables.ExamClientCredential, error) {
+	var enrolledIP *string
+	if ip != "" {
+		enrolledIP = &ip
+	}
+
+	result, err := r.db.Exec(`
+		INSERT INTO exam_client_credentials (client_id, secret, enrolled_ip, enrolled_at, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW(), NOW())
+		ON CONFLICT (client_id) DO NOTHING`,
+		clientID, secret, enrolledIP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enroll exam client: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to enroll exam client: %w", err)
+	}
+	if rows == 0 {
+		return nil, fmt.Errorf("exam client already enrolled")
+	}
+
+	return r.GetByClientID(clientID)
+}
+
+// GetByClientID gets the credentials of an exam-client, including revoked ones
+func (r *ExamClientCredentialModel) GetByClientID(clientID string) (*tables.ExamClientCredential, error) {
+	var credential tables.ExamClientCredential
+	err := r.db.Get(&credential, examClientCredentialSelect+` WHERE client_id = $1`, clientID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("exam client not found")
+		}
+		return nil, fmt.Errorf("failed to get exam client credentials: %w", err)
+	}
+	return &credential, nil
+}
+
+// GetActive gets the credentials of an exam-client that was not revoked
+func (r *ExamClientCredentialModel) GetActive(clientID string) (*tables.ExamClientCredential, error) {
+	credential, err := r.GetByClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if credential.RevokedAt != nil {
+		return nil, fmt.Errorf("exam client revoked")
+	}
+	return credential, nil
+}
+
+// List lists the enrolled exam-clients, newest first
+func (r *ExamClientCredentialModel) List() ([]tables.ExamClientCredential, error) {
+	credentials := []tables.ExamClientCredential{}
+	err := r.db.Select(&credentials, examClientCredentialSelect+` ORDER BY enrolled_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list exam client credentials: %w", err)
+	}
+	return credentials, nil
+}
+
+// Revoke revokes the credentials of an exam-client
+func (r *ExamClientCredentialModel) Revoke(clientID string, revokedBy int, reason string) (*tables.ExamClientCredential, error) {
+	result, err := r.db.Exec(`
+		UPDATE exam_client_credentials
+		SET revoked_at = NOW(), revoked_by = $2, revoke_reason = NULLIF($3, '')
+		WHERE client_id = $1 AND revoked_at IS NULL`,
+		clientID, revokedBy, reason)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke exam client: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke exam client: %w", err)
+	}
+	if rows == 0 {
+		credential, err := r.GetByClientID(clientID)
+		if err != nil {
+			return nil, err
+		}
+		if credential.RevokedAt != nil {
+			return nil, fmt.Errorf("exam client already revoked")
+		}
+	}
+
+	return r.GetByClientID(clientID)
+}
+
+// UseNonce records the nonce of a signed request and returns false when the client already
+// used it. Nonces older than keep, which must outlast the signature window, are pruned at
+// most once a minute.
+func (r *ExamClientCredentialModel) UseNonce(clientID, nonce string, now time.Time, keep time.Duration) (bool, error) {
+	r.pruneNonces(now, keep)
+
+	result, err := r.db.Exec(`
+		INSERT INTO exam_client_nonces (client_id, nonce, used_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (client_id, nonce) DO NOTHING`,
+		clientID, nonce, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to record request nonce: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record request nonce: %w", err)
+	}
+	return rows > 0, nil
+}
+
+func (r *ExamClientCredentialModel) pruneNonces(now time.Time, keep time.Duration) {
+	r.nonceMu.Lock()
+	if now.Sub(r.noncesPrunedAt) < time.Minute {
+		r.nonceMu.Unlock()
+		return
+	}
+	r.noncesPrunedAt = now
+	r.nonceMu.Unlock()
+
+	if _, err := r.db.Exec(`DELETE FROM exam_client_nonces WHERE used_at < $1`, now.Add(-keep)); err != nil {
+		log.Printf("Failed to prune request nonces: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+type ExamClientEventModel struct {
+	db *database.DB
+}
+
+func NewExamClientEventModel(db *database.DB) *ExamClientEventModel {
+	return &ExamClientEventModel{db: db}
+}
+
+// Record stores a received event. It returns false when an event with the same event ID
+// was already recorded, i.e. the exam-client retried a send the coordinator processed.
+func (r *ExamClientEventModel) Record(event *tables.ExamClientEventReceipt) (bool, error) {
+	return recordExamClientEvent(r.db, event)
+}
+
+// recordExamClientEvent stores a received event with db, which may be a transaction
+// processing the event
+func recordExamClientEvent(db interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, event *tables.ExamClientEventReceipt) (bool, error) {
+	var data interface{}
+	if len(event.Data) > 0 {
+		data = []byte(event.Data)
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO exam_client_events (event_id, client_id, delivery_id, event_type, data, occurred_at, received_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (event_id) DO NOTHING`,
+		event.EventID, event.ClientID, event.DeliveryID, event.EventType, data, event.OccurredAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to record exam-client event: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record exam-client event: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// Forget removes a recorded event whose processing failed, so its retry is processed again
+func (r *ExamClientEventModel) Forget(eventID string) error {
+	if _, err := r.db.Exec(`DELETE FROM exam_client_events WHERE event_id = $1`, eventID); err != nil {
+		return fmt.Errorf("failed to forget exam-client event: %w", err)
+	}
+	return nil
+}
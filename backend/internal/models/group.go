@@ -7,6 +7,7 @@ import (
 
 	"github.com/medxamion/medxamion/internal/database"
 	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
 )
 
 type GroupModel struct {
@@ -17,14 +18,23 @@ func NewGroupModel(db *database.DB) *GroupModel {
 	return &GroupModel{db: db}
 }
 
-func (r *GroupModel) Create(group *tables.Group) error {
+// Create creates a group for the client of scope
+func (r *GroupModel) Create(scope ClientScope, group *tables.Group) error {
+	clientID, err := scope.owner()
+	if err != nil {
+		return err
+	}
+	group.ClientID = clientID
+
 	query := `
-		INSERT INTO groups (name, description, code, last_taker_code, client_id, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		INSERT INTO groups (name, description, code, last_taker_code, client_id,
+			taker_code_prefix, taker_code_length, taker_code_group_size, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
 		RETURNING id, created_at, updated_at`
 
-	err := r.db.QueryRow(query, group.Name, group.Description, group.Code,
-		group.LastTakerCode, group.ClientID).Scan(&group.ID, &group.CreatedAt, &group.UpdatedAt)
+	err = r.db.QueryRow(query, group.Name, group.Description, group.Code,
+		group.LastTakerCode, group.ClientID, group.TakerCodePrefix, group.TakerCodeLength,
+		group.TakerCodeGroupSize).Scan(&group.ID, &group.CreatedAt, &group.UpdatedAt)
 
 	if err != nil {
 		return fmt.Errorf("failed to create group: %w", err)
@@ -32,15 +42,16 @@ func (r *GroupModel) Create(group *tables.Group) error {
 	return nil
 }
 
-func (r *GroupModel) GetByID(id int) (*tables.Group, error) {
+func (r *GroupModel) GetByID(scope ClientScope, id int) (*tables.Group, error) {
 	group := &tables.Group{}
 	query := `
 		SELECT id, name, description, code, last_taker_code, closed_at, 
-			   client_id, created_at, updated_at
+			   client_id, taker_code_prefix, taker_code_length, taker_code_group_size,
+			   created_at, updated_at
 		FROM groups 
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL AND ` + clientCondition("client_id", 2)
 
-	err := r.db.Get(group, query, id)
+	err := r.db.Get(group, query, id, scope.arg())
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("group not found")
@@ -50,7 +61,7 @@ func (r *GroupModel) GetByID(id int) (*tables.Group, error) {
 	return group, nil
 }
 
-func (r *GroupModel) Update(id int, updates *tables.GroupUpdateRequest) (*tables.Group, error) {
+func (r *GroupModel) Update(scope ClientScope, id int, updates *tables.GroupUpdateRequest) (*tables.Group, error) {
 	setParts := []string{}
 	args := []interface{}{}
 	argIndex := 1
@@ -75,69 +86,134 @@ func (r *GroupModel) Update(id int, updates *tables.GroupUpdateRequest) (*tables
 		args = append(args, *updates.ClosedAt)
 		argIndex++
 	}
+	if updates.TakerCodePrefix != nil {
+		setParts = append(setParts, fmt.Sprintf("taker_code_prefix = $%d", argIndex))
+		args = append(args, *updates.TakerCodePrefix)
+		argIndex++
+	}
+	if updates.TakerCodeLength != nil {
+		setParts = append(setParts, fmt.Sprintf("taker_code_length = $%d", argIndex))
+		args = append(args, *updates.TakerCodeLength)
+		argIndex++
+	}
+	if updates.TakerCodeGroupSize != nil {
+		setParts = append(setParts, fmt.Sprintf("taker_code_group_size = $%d", argIndex))
+		args = append(args, *updates.TakerCodeGroupSize)
+		argIndex++
+	}
 
 	if len(setParts) == 0 {
-		return r.GetByID(id)
+		return r.GetByID(scope, id)
 	}
 
 	setParts = append(setParts, "updated_at = NOW()")
 	setClause := strings.Join(setParts, ", ")
-	args = append(args, id)
+	args = append(args, id, scope.arg())
 
 	query := fmt.Sprintf(`
 		UPDATE groups 
 		SET %s 
-		WHERE id = $%d`, setClause, argIndex)
+		WHERE id = $%d AND deleted_at IS NULL AND %s`, setClause, argIndex, clientCondition("client_id", argIndex+1))
 
-	_, err := r.db.Exec(query, args...)
+	result, err := r.db.Exec(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update group: %w", err)
 	}
+	if err := requireRow(result, "group not found"); err != nil {
+		return nil, err
+	}
 
-	return r.GetByID(id)
+	return r.GetByID(scope, id)
 }
 
-func (r *GroupModel) Delete(id int) error {
-	query := `DELETE FROM groups WHERE id = $1`
-	_, err := r.db.Exec(query, id)
+// Delete soft deletes a group, keeping its participants and taker codes. Groups with
+// deliveries, whose attempts need the group, cannot be deleted until their deliveries are.
+func (r *GroupModel) Delete(scope ClientScope, id int) error {
+	var hasDeliveries bool
+	err := r.db.Get(&hasDeliveries, `SELECT EXISTS (SELECT 1 FROM deliveries WHERE group_id = $1 AND deleted_at IS NULL)`, id)
+	if err != nil {
+		return fmt.Errorf("failed to check group deliveries: %w", err)
+	}
+	if hasDeliveries {
+		return fmt.Errorf("group has deliveries")
+	}
+
+	query := `UPDATE groups SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL AND ` + clientCondition("client_id", 2)
+	result, err := r.db.Exec(query, id, scope.arg())
 	if err != nil {
 		return fmt.Errorf("failed to delete group: %w", err)
 	}
-	return nil
+	return requireRow(result, "group not found")
 }
 
-func (r *GroupModel) List(pagination tables.Pagination, search string) (*tables.PaginatedResponse, error) {
+// groupDeletedColumns are the columns of deleted groups, those of GetByID and deleted_at
+const groupDeletedColumns = `id, name, description, code, last_taker_code, closed_at,
+			   client_id, taker_code_prefix, taker_code_length, taker_code_group_size,
+			   created_at, updated_at, deleted_at`
+
+// ListDeleted gets the deleted groups, most recently deleted first
+func (r *GroupModel) ListDeleted(scope ClientScope, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
+	groups := []tables.Group{}
+	return listDeleted(r.db, &groups, "groups", groupDeletedColumns, clientIDCondition, scope, pagination)
+}
+
+// GetDeleted gets a deleted group
+func (r *GroupModel) GetDeleted(scope ClientScope, id int) (*tables.Group, error) {
+	group := &tables.Group{}
+	if err := getDeleted(r.db, group, "groups", groupDeletedColumns, clientIDCondition, scope, id, "group not found"); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// Restore restores a deleted group
+func (r *GroupModel) Restore(scope ClientScope, id int) (*tables.Group, error) {
+	if err := restoreDeleted(r.db, "groups", clientIDCondition, scope, id, "group not found"); err != nil {
+		return nil, err
+	}
+	return r.GetByID(scope, id)
+}
+
+func (r *GroupModel) List(scope ClientScope, pagination tables.Pagination, search string) (*tables.PaginatedResponse, error) {
 	offset := (pagination.Page - 1) * pagination.PerPage
 
-	whereClause := "WHERE 1=1"
-	args := []interface{}{pagination.PerPage, offset}
-	argIndex := 3
+	whereClause := "WHERE g.deleted_at IS NULL AND " + clientCondition("g.client_id", 1)
+	args := []interface{}{scope.arg()}
+	argIndex := 2
 
 	if search != "" {
-		whereClause += fmt.Sprintf(" AND (name ILIKE $%d OR description ILIKE $%d)", argIndex, argIndex)
+		whereClause += fmt.Sprintf(" AND (g.name ILIKE $%d OR g.description ILIKE $%d)", argIndex, argIndex)
 		args = append(args, "%"+search+"%")
+		argIndex++
 	}
 
 	// Get total count
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM groups %s", whereClause)
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM groups g %s", whereClause)
 	var total int
-	err := r.db.Get(&total, countQuery, args[2:]...)
+	err := r.db.Get(&total, countQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get total count: %w", err)
 	}
 
+	limitParam := fmt.Sprintf("$%d", argIndex)
+	offsetParam := fmt.Sprintf("$%d", argIndex+1)
+	args = append(args, pagination.PerPage, offset)
+
 	// Get groups with participant count
 	query := fmt.Sprintf(`
 		SELECT g.id, g.name, g.description, g.code, g.last_taker_code, 
 			   g.closed_at, g.client_id, g.created_at, g.updated_at,
+			   g.taker_code_prefix, g.taker_code_length, g.taker_code_group_size,
 			   COUNT(gt.taker_id) as participant_count
 		FROM groups g
 		LEFT JOIN group_taker gt ON g.id = gt.group_id
+			AND EXISTS (SELECT 1 FROM takers t WHERE t.id = gt.taker_id AND t.deleted_at IS NULL)
 		%s 
 		GROUP BY g.id, g.name, g.description, g.code, g.last_taker_code, 
-				 g.closed_at, g.client_id, g.created_at, g.updated_at
+				 g.closed_at, g.client_id, g.created_at, g.updated_at,
+				 g.taker_code_prefix, g.taker_code_length, g.taker_code_group_size
 		ORDER BY g.created_at DESC
-		LIMIT $1 OFFSET $2`, whereClause)
+		LIMIT %s OFFSET %s`, whereClause, limitParam, offsetParam)
 
 	groups := []tables.GroupWithStats{}
 	err = r.db.Select(&groups, query, args...)
@@ -156,15 +232,19 @@ func (r *GroupModel) List(pagination tables.Pagination, search string) (*tables.
 	}, nil
 }
 
-func (r *GroupModel) GetGroupTakers(groupID int, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
+func (r *GroupModel) GetGroupTakers(scope ClientScope, groupID int, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
 	offset := (pagination.Page - 1) * pagination.PerPage
 
+	if _, err := r.GetByID(scope, groupID); err != nil {
+		return nil, err
+	}
+
 	// Get total count
 	countQuery := `
 		SELECT COUNT(*) 
 		FROM group_taker gt 
 		JOIN takers t ON gt.taker_id = t.id 
-		WHERE gt.group_id = $1`
+		WHERE gt.group_id = $1 AND t.deleted_at IS NULL`
 	var total int
 	err := r.db.Get(&total, countQuery, groupID)
 	if err != nil {
@@ -174,16 +254,16 @@ func (r *GroupModel) GetGroupTakers(groupID int, pagination tables.Pagination) (
 	// Get takers
 	query := `
 		SELECT t.id, t.name, t.reg, t.email, t.is_verified, t.client_id, 
-			   t.created_at, t.updated_at, gt.code
+			   t.created_at, t.updated_at, gt.taker_code
 		FROM group_taker gt 
 		JOIN takers t ON gt.taker_id = t.id 
-		WHERE gt.group_id = $1
-		ORDER BY gt.code
+		WHERE gt.group_id = $1 AND t.deleted_at IS NULL
+		ORDER BY t.name, t.id
 		LIMIT $2 OFFSET $3`
 
 	type TakerWithCode struct {
 		tables.Participant
-		Code string `db:"code" json:"code"`
+		Code *string `db:"taker_code" json:"code"`
 	}
 
 	takers := []TakerWithCode{}
@@ -203,20 +283,35 @@ func (r *GroupModel) GetGroupTakers(groupID int, pagination tables.Pagination) (
 	}, nil
 }
 
-func (r *GroupModel) AddTaker(groupID, takerID int, code string) error {
-	query := `
-		INSERT INTO group_taker (group_id, taker_id, code)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (group_id, taker_id) DO UPDATE SET code = EXCLUDED.code`
+// AddTaker adds a taker to a group with a new taker code, or gives a taker already in the
+// group a new code. It returns the code. Only takers of the group's client can be added.
+func (r *GroupModel) AddTaker(scope ClientScope, groupID, takerID int) (string, error) {
+	group, err := r.GetByID(scope, groupID)
+	if err != nil {
+		return "", err
+	}
 
-	_, err := r.db.Exec(query, groupID, takerID, code)
+	var sameClient bool
+	err = r.db.Get(&sameClient, `SELECT EXISTS (SELECT 1 FROM takers WHERE id = $1 AND client_id = $2 AND deleted_at IS NULL)`, takerID, group.ClientID)
 	if err != nil {
-		return fmt.Errorf("failed to add taker to group: %w", err)
+		return "", fmt.Errorf("failed to check taker: %w", err)
 	}
-	return nil
+	if !sameClient {
+		return "", fmt.Errorf("participant not found")
+	}
+
+	return r.issueTakerCode(group, takerID, `
+		INSERT INTO group_taker (group_id, taker_id, taker_code)
+		SELECT $1::int, $2::int, $3
+		WHERE NOT EXISTS (SELECT 1 FROM group_taker WHERE taker_code = $3)
+		ON CONFLICT (group_id, taker_id) DO UPDATE SET taker_code = EXCLUDED.taker_code`)
 }
 
-func (r *GroupModel) RemoveTaker(groupID, takerID int) error {
+func (r *GroupModel) RemoveTaker(scope ClientScope, groupID, takerID int) error {
+	if _, err := r.GetByID(scope, groupID); err != nil {
+		return err
+	}
+
 	query := `DELETE FROM group_taker WHERE group_id = $1 AND taker_id = $2`
 	_, err := r.db.Exec(query, groupID, takerID)
 	if err != nil {
@@ -225,19 +320,117 @@ func (r *GroupModel) RemoveTaker(groupID, takerID int) error {
 	return nil
 }
 
-func (r *GroupModel) GenerateNextTakerCode(groupID int) (string, error) {
-	// Get current last_taker_code and increment it
+// RegenerateTakerCode replaces the taker code of a taker in a group, so the old code no
+// longer logs in. It returns the new code.
+func (r *GroupModel) RegenerateTakerCode(scope ClientScope, groupID, takerID int) (string, error) {
+	group, err := r.GetByID(scope, groupID)
+	if err != nil {
+		return "", err
+	}
+
+	var inGroup bool
+	err = r.db.Get(&inGroup, `SELECT EXISTS (SELECT 1 FROM group_taker WHERE group_id = $1 AND taker_id = $2)`, groupID, takerID)
+	if err != nil {
+		return "", fmt.Errorf("failed to check group taker: %w", err)
+	}
+	if !inGroup {
+		return "", fmt.Errorf("taker not in group")
+	}
+
+	return r.issueTakerCode(group, takerID, `
+		UPDATE group_taker SET taker_code = $3
+		WHERE group_id = $1 AND taker_id = $2
+			AND NOT EXISTS (SELECT 1 FROM group_taker WHERE taker_code = $3)`)
+}
+
+// RevokeTakerCode removes the taker code of a taker in a group, who then cannot log in with
+// a code until a new one is generated
+func (r *GroupModel) RevokeTakerCode(scope ClientScope, groupID, takerID int) error {
+	if _, err := r.GetByID(scope, groupID); err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(`UPDATE group_taker SET taker_code = NULL WHERE group_id = $1 AND taker_id = $2`, groupID, takerID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke taker code: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("taker not in group")
+	}
+	return nil
+}
+
+// RegenerateTakerCodes gives every taker of a group a new taker code, replacing sequential
+// codes or codes that may have leaked. It returns how many codes were replaced.
+func (r *GroupModel) RegenerateTakerCodes(scope ClientScope, groupID int) (int, error) {
+	if _, err := r.GetByID(scope, groupID); err != nil {
+		return 0, err
+	}
+
+	var takerIDs []int
+	err := r.db.Select(&takerIDs, `SELECT taker_id FROM group_taker WHERE group_id = $1 ORDER BY taker_id`, groupID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get group takers: %w", err)
+	}
+
+	for _, takerID := range takerIDs {
+		if _, err := r.RegenerateTakerCode(scope, groupID, takerID); err != nil {
+			return 0, err
+		}
+	}
+	return len(takerIDs), nil
+}
+
+// GetTakerCodeSlips gets the takers of a group with their codes, by name, for admission slips
+func (r *GroupModel) GetTakerCodeSlips(scope ClientScope, groupID int) ([]tables.TakerCodeSlip, error) {
+	if _, err := r.GetByID(scope, groupID); err != nil {
+		return nil, err
+	}
+
+	slips := []tables.TakerCodeSlip{}
 	query := `
-		UPDATE groups 
-		SET last_taker_code = last_taker_code + 1, updated_at = NOW()
-		WHERE id = $1
-		RETURNING last_taker_code`
+		SELECT t.id AS taker_id, t.name, t.reg, gt.taker_code
+		FROM group_taker gt
+		JOIN takers t ON gt.taker_id = t.id
+		WHERE gt.group_id = $1 AND t.deleted_at IS NULL
+		ORDER BY t.name, t.id`
 
-	var nextCode int
-	err := r.db.QueryRow(query, groupID).Scan(&nextCode)
+	err := r.db.Select(&slips, query, groupID)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate next taker code: %w", err)
+		return nil, fmt.Errorf("failed to get taker codes: %w", err)
 	}
+	return slips, nil
+}
+
+// takerCodeAttempts is how often a taker code is generated again when it collides with an
+// existing one, which with random codes practically never happens
+const takerCodeAttempts = 5
+
+// issueTakerCode generates a taker code in the format of the group and stores it with query,
+// which gets the group ID, taker ID and code, and stores nothing when the code is in use
+func (r *GroupModel) issueTakerCode(group *tables.Group, takerID int, query string) (string, error) {
+	for attempt := 0; attempt < takerCodeAttempts; attempt++ {
+		code, err := utils.GenerateTakerCode(group.TakerCodePrefix, group.TakerCodeLength)
+		if err != nil {
+			return "", err
+		}
 
-	return fmt.Sprintf("%d", nextCode), nil
+		result, err := r.db.Exec(query, group.ID, takerID, code)
+		if err != nil {
+			return "", fmt.Errorf("failed to store taker code: %w", err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return "", fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rowsAffected > 0 {
+			return code, nil
+		}
+	}
+	return "", fmt.Errorf("failed to generate a unique taker code")
 }
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+type HelpRequestModel struct {
+	db *database.DB
+}
+
+func NewHelpRequestModel(db *database.DB) *HelpRequestModel {
+	return &HelpRequestModel{db: db}
+}
+
+const helpRequestSelect = `
+	SELECT hr.id, hr.delivery_id, hr.taker_id, t.name AS taker_name, hr.client_request_id, hr.client_id,
+		hr.message, hr.status, hr.requested_at, hr.claimed_by, u.name AS claimed_by_name, hr.claimed_at,
+		hr.resolved_by, hr.resolved_at, hr.resolution, hr.extra_minutes,
+		EXTRACT(EPOCH FROM (COALESCE(hr.claimed_at, hr.resolved_at, NOW()) - hr.requested_at))::int AS wait_seconds,
+		EXTRACT(EPOCH FROM (COALESCE(hr.resolved_at, NOW()) - hr.requested_at))::int AS time_lost_seconds,
+		hr.created_at, hr.updated_at
+	FROM help_requests hr
+	LEFT JOIN takers t ON t.id = hr.taker_id
+	LEFT JOIN users u ON u.id = hr.claimed_by`
+
+// Record stores a help request raised on an exam-client. A request that was already
+// recorded is returned unchanged.
+func (r *HelpRequestModel) Record(event *tables.HelpRequestEvent) (*tables.HelpRequest, error) {
+	var clientID *string
+	if event.ClientID != "" {
+		clientID = &event.ClientID
+	}
+
+	var id int
+	err := r.db.QueryRow(`
+		INSERT INTO help_requests (delivery_id, taker_id, client_request_id, client_id, message, status, requested_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), 'open', $6, NOW(), NOW())
+		ON CONFLICT (delivery_id, client_request_id) DO UPDATE SET delivery_id = EXCLUDED.delivery_id
+		RETURNING id`,
+		event.DeliveryID, event.TakerID, event.ClientRequestID, clientID, event.Message, event.RequestedAt).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record help request: %w", err)
+	}
+
+	return r.GetByID(event.DeliveryID, id)
+}
+
+// GetByID gets a help request of a delivery
+func (r *HelpRequestModel) GetByID(deliveryID, id int) (*tables.HelpRequest, error) {
+	var request tables.HelpRequest
+	err := r.db.Get(&request, helpRequestSelect+` WHERE hr.delivery_id = $1 AND hr.id = $2`, deliveryID, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("help request not found")
+		}
+		return nil, fmt.Errorf("failed to get help request: %w", err)
+	}
+	return &request, nil
+}
+
+// List gets the help requests of a delivery in queue order. An empty status returns all requests.
+func (r *HelpRequestModel) List(deliveryID int, status string) ([]tables.HelpRequest, error) {
+	requests := []tables.HelpRequest{}
+	query := helpRequestSelect + ` WHERE hr.delivery_id = $1 AND ($2 = '' OR hr.status = $2) ORDER BY hr.requested_at, hr.id`
+
+	err := r.db.Select(&requests, query, deliveryID, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get help requests: %w", err)
+	}
+	return requests, nil
+}
+
+// ListPending gets the open and claimed help requests of a delivery in queue order
+func (r *HelpRequestModel) ListPending(deliveryID int) ([]tables.HelpRequest, error) {
+	requests := []tables.HelpRequest{}
+	query := helpRequestSelect + ` WHERE hr.delivery_id = $1 AND hr.status <> 'resolved' ORDER BY hr.requested_at, hr.id`
+
+	err := r.db.Select(&requests, query, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get help requests: %w", err)
+	}
+	return requests, nil
+}
+
+// Claim assigns an open help request to a proctor
+func (r *HelpRequestModel) Claim(deliveryID, id, userID int) (*tables.HelpRequest, error) {
+	result, err := r.db.Exec(`
+		UPDATE help_requests SET status = 'claimed', claimed_by = $3, claimed_at = NOW()
+		WHERE delivery_id = $1 AND id = $2 AND status = 'open'`,
+		deliveryID, id, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim help request: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	request, err := r.GetByID(deliveryID, id)
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("help request already %s", request.Status)
+	}
+	return request, nil
+}
+
+// Resolve closes a help request. A request that nobody claimed is claimed by the resolving proctor.
+func (r *HelpRequestModel) Resolve(deliveryID, id, userID int, req *tables.ResolveHelpRequestRequest) (*tables.HelpRequest, error) {
+	result, err := r.db.Exec(`
+		UPDATE help_requests SET status = 'resolved',
+			claimed_by = COALESCE(claimed_by, $3), claimed_at = COALESCE(claimed_at, NOW()),
+			resolved_by = $3, resolved_at = NOW(), resolution = $4, extra_minutes = $5
+		WHERE delivery_id = $1 AND id = $2 AND status <> 'resolved'`,
+		deliveryID, id, userID, req.Resolution, req.ExtraMinutes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve help request: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	request, err := r.GetByID(deliveryID, id)
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("help request already resolved")
+	}
+	return request, nil
+}
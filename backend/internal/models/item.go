@@ -17,13 +17,20 @@ func NewItemModel(db *database.DB) *ItemModel {
 	return &ItemModel{db: db}
 }
 
-func (r *ItemModel) Create(item *tables.Item) error {
+// Create creates an item for the client of scope
+func (r *ItemModel) Create(scope ClientScope, item *tables.Item) error {
+	clientID, err := scope.owner()
+	if err != nil {
+		return err
+	}
+	item.ClientID = &clientID
+
 	query := `
 		INSERT INTO items (title, content, type, is_vignette, is_random, score, client_id, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
 		RETURNING id, created_at, updated_at`
 
-	err := r.db.QueryRow(query, item.Title, item.Content, item.Type, item.IsVignette,
+	err = r.db.QueryRow(query, item.Title, item.Content, item.Type, item.IsVignette,
 		item.IsRandom, item.Score, item.ClientID).Scan(&item.ID, &item.CreatedAt, &item.UpdatedAt)
 
 	if err != nil {
@@ -32,15 +39,15 @@ func (r *ItemModel) Create(item *tables.Item) error {
 	return nil
 }
 
-func (r *ItemModel) GetByID(id int) (*tables.Item, error) {
+func (r *ItemModel) GetByID(scope ClientScope, id int) (*tables.Item, error) {
 	item := &tables.Item{}
 	query := `
 		SELECT id, title, content, type, is_vignette, is_random, score, client_id,
 			   created_at, updated_at
 		FROM items 
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL AND ` + clientCondition("client_id", 2)
 
-	err := r.db.Get(item, query, id)
+	err := r.db.Get(item, query, id, scope.arg())
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("item not found")
@@ -50,7 +57,7 @@ func (r *ItemModel) GetByID(id int) (*tables.Item, error) {
 	return item, nil
 }
 
-func (r *ItemModel) Update(id int, updates *tables.ItemUpdateRequest) (*tables.Item, error) {
+func (r *ItemModel) Update(scope ClientScope, id int, updates *tables.ItemUpdateRequest) (*tables.Item, error) {
 	setParts := []string{}
 	args := []interface{}{}
 	argIndex := 1
@@ -87,66 +94,116 @@ func (r *ItemModel) Update(id int, updates *tables.ItemUpdateRequest) (*tables.I
 	}
 
 	if len(setParts) == 0 {
-		return r.GetByID(id)
+		return r.GetByID(scope, id)
 	}
 
 	setParts = append(setParts, "updated_at = NOW()")
 	setClause := strings.Join(setParts, ", ")
-	args = append(args, id)
+	args = append(args, id, scope.arg())
 
 	query := fmt.Sprintf(`
 		UPDATE items 
 		SET %s 
-		WHERE id = $%d`, setClause, argIndex)
+		WHERE id = $%d AND deleted_at IS NULL AND %s`, setClause, argIndex, clientCondition("client_id", argIndex+1))
 
-	_, err := r.db.Exec(query, args...)
+	result, err := r.db.Exec(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update item: %w", err)
 	}
+	if err := requireRow(result, "item not found"); err != nil {
+		return nil, err
+	}
 
-	return r.GetByID(id)
+	return r.GetByID(scope, id)
 }
 
-func (r *ItemModel) Delete(id int) error {
-	query := `DELETE FROM items WHERE id = $1`
-	_, err := r.db.Exec(query, id)
+// Delete soft deletes an item. Items in an exam cannot be deleted until they are removed
+// from it or the exam is deleted.
+func (r *ItemModel) Delete(scope ClientScope, id int) error {
+	var inExam bool
+	err := r.db.Get(&inExam, `
+		SELECT EXISTS (
+			SELECT 1 FROM exam_item ei
+			JOIN exams e ON e.id = ei.exam_id
+			WHERE ei.item_id = $1 AND e.deleted_at IS NULL
+		)`, id)
+	if err != nil {
+		return fmt.Errorf("failed to check item exams: %w", err)
+	}
+	if inExam {
+		return fmt.Errorf("item is in an exam")
+	}
+
+	query := `UPDATE items SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL AND ` + clientCondition("client_id", 2)
+	result, err := r.db.Exec(query, id, scope.arg())
 	if err != nil {
 		return fmt.Errorf("failed to delete item: %w", err)
 	}
-	return nil
+	return requireRow(result, "item not found")
 }
 
-func (r *ItemModel) List(pagination tables.Pagination, search tables.ItemSearchRequest) (*tables.PaginatedResponse, error) {
+// itemDeletedColumns are the columns of deleted items, those of GetByID and deleted_at
+const itemDeletedColumns = `id, title, content, type, is_vignette, is_random, score, client_id,
+			   created_at, updated_at, deleted_at`
+
+// ListDeleted gets the deleted items, most recently deleted first
+func (r *ItemModel) ListDeleted(scope ClientScope, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
+	items := []tables.Item{}
+	return listDeleted(r.db, &items, "items", itemDeletedColumns, clientIDCondition, scope, pagination)
+}
+
+// GetDeleted gets a deleted item
+func (r *ItemModel) GetDeleted(scope ClientScope, id int) (*tables.Item, error) {
+	item := &tables.Item{}
+	if err := getDeleted(r.db, item, "items", itemDeletedColumns, clientIDCondition, scope, id, "item not found"); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// Restore restores a deleted item
+func (r *ItemModel) Restore(scope ClientScope, id int) (*tables.Item, error) {
+	if err := restoreDeleted(r.db, "items", clientIDCondition, scope, id, "item not found"); err != nil {
+		return nil, err
+	}
+	return r.GetByID(scope, id)
+}
+
+func (r *ItemModel) List(scope ClientScope, pagination tables.Pagination, search tables.ItemSearchRequest) (*tables.PaginatedResponse, error) {
 	offset := (pagination.Page - 1) * pagination.PerPage
 
-	whereClause := "WHERE 1=1"
-	args := []interface{}{pagination.PerPage, offset}
-	argIndex := 3
+	whereClause := "WHERE i.deleted_at IS NULL AND " + clientCondition("i.client_id", 1)
+	args := []interface{}{scope.arg()}
+	argIndex := 2
 
 	if search.Title != "" {
-		whereClause += fmt.Sprintf(" AND title ILIKE $%d", argIndex)
+		whereClause += fmt.Sprintf(" AND i.title ILIKE $%d", argIndex)
 		args = append(args, "%"+search.Title+"%")
 		argIndex++
 	}
 	if search.Type != "" {
-		whereClause += fmt.Sprintf(" AND type = $%d", argIndex)
+		whereClause += fmt.Sprintf(" AND i.type = $%d", argIndex)
 		args = append(args, search.Type)
 		argIndex++
 	}
 	if search.IsVignette != nil {
-		whereClause += fmt.Sprintf(" AND is_vignette = $%d", argIndex)
+		whereClause += fmt.Sprintf(" AND i.is_vignette = $%d", argIndex)
 		args = append(args, *search.IsVignette)
 		argIndex++
 	}
 
 	// Get total count
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM items %s", whereClause)
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM items i %s", whereClause)
 	var total int
-	err := r.db.Get(&total, countQuery, args[2:]...)
+	err := r.db.Get(&total, countQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get total count: %w", err)
 	}
 
+	limitParam := fmt.Sprintf("$%d", argIndex)
+	offsetParam := fmt.Sprintf("$%d", argIndex+1)
+	args = append(args, pagination.PerPage, offset)
+
 	// Get items with question count
 	query := fmt.Sprintf(`
 		SELECT i.id, i.title, i.content, i.type, i.is_vignette, i.is_random, 
@@ -158,7 +215,7 @@ func (r *ItemModel) List(pagination tables.Pagination, search tables.ItemSearchR
 		GROUP BY i.id, i.title, i.content, i.type, i.is_vignette, i.is_random,
 				 i.score, i.client_id, i.created_at, i.updated_at
 		ORDER BY i.created_at DESC
-		LIMIT $1 OFFSET $2`, whereClause)
+		LIMIT %s OFFSET %s`, whereClause, limitParam, offsetParam)
 
 	type ItemWithQuestionCount struct {
 		tables.Item
@@ -182,9 +239,13 @@ func (r *ItemModel) List(pagination tables.Pagination, search tables.ItemSearchR
 	}, nil
 }
 
-func (r *ItemModel) GetItemQuestions(itemID int, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
+func (r *ItemModel) GetItemQuestions(scope ClientScope, itemID int, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
 	offset := (pagination.Page - 1) * pagination.PerPage
 
+	if _, err := r.GetByID(scope, itemID); err != nil {
+		return nil, err
+	}
+
 	// Get total count
 	countQuery := `SELECT COUNT(*) FROM questions WHERE item_id = $1`
 	var total int
@@ -219,8 +280,8 @@ func (r *ItemModel) GetItemQuestions(itemID int, pagination tables.Pagination) (
 	}, nil
 }
 
-func (r *ItemModel) GetItemWithQuestions(id int) (*tables.ItemWithQuestions, error) {
-	item, err := r.GetByID(id)
+func (r *ItemModel) GetItemWithQuestions(scope ClientScope, id int) (*tables.ItemWithQuestions, error) {
+	item, err := r.GetByID(scope, id)
 	if err != nil {
 		return nil, err
 	}
@@ -244,17 +305,17 @@ func (r *ItemModel) GetItemWithQuestions(id int) (*tables.ItemWithQuestions, err
 	}, nil
 }
 
-func (r *ItemModel) GetItemCategories(itemID int) ([]tables.Category, error) {
+func (r *ItemModel) GetItemCategories(scope ClientScope, itemID int) ([]tables.Category, error) {
 	categories := []tables.Category{}
 	query := `
 		SELECT c.id, c.type, c.code, c.parent, c.name, c.description, c.client_id,
 			   c.created_at, c.updated_at
 		FROM categories c
 		JOIN category_item ci ON c.id = ci.category_id
-		WHERE ci.item_id = $1
+		WHERE ci.item_id = $1 AND ` + clientCondition("c.client_id", 2) + `
 		ORDER BY c.name`
 
-	err := r.db.Select(&categories, query, itemID)
+	err := r.db.Select(&categories, query, itemID, scope.arg())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get item categories: %w", err)
 	}
@@ -0,0 +1,226 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+type LoginSecurityModel struct {
+	db *database.DB
+}
+
+func NewLoginSecurityModel(db *database.DB) *LoginSecurityModel {
+	return &LoginSecurityModel{db: db}
+}
+
+const loginThrottleSelect = `
+	SELECT id, scope, identifier, failures, lockouts, last_failure_at, last_ip, next_attempt_at,
+		locked_until, created_at, updated_at
+	FROM login_throttles`
+
+// GetThrottle gets the failure counter of an account or IP address, or nil when it has none
+func (r *LoginSecurityModel) GetThrottle(scope, identifier string) (*tables.LoginThrottle, error) {
+	var throttle tables.LoginThrottle
+	err := r.db.Get(&throttle, loginThrottleSelect+` WHERE scope = $1 AND identifier = $2`, scope, identifier)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get login throttle: %w", err)
+	}
+	return &throttle, nil
+}
+
+// RecordFailure counts a failed login against the counter of an account or IP address, and
+// logs the identifier that was tried for pattern detection. Failures of a counter whose last
+// failure was before resetBefore are forgotten first. It returns the updated counter.
+func (r *LoginSecurityModel) RecordFailure(scope, identifier, triedIdentifier, ipAddress string, resetBefore time.Time) (*tables.LoginThrottle, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var throttle tables.LoginThrottle
+	err = tx.Get(&throttle, `
+		INSERT INTO login_throttles (scope, identifier, failures, last_failure_at, last_ip)
+		VALUES ($1, $2, 1, NOW(), $3)
+		ON CONFLICT (scope, identifier) DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failure_at < $4 THEN 1 ELSE login_throttles.failures + 1 END,
+			last_failure_at = NOW(), last_ip = EXCLUDED.last_ip
+		RETURNING id, scope, identifier, failures, lockouts, last_failure_at, last_ip, next_attempt_at,
+			locked_until, created_at, updated_at`,
+		scope, identifier, ipAddress, resetBefore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO login_failures (scope, identifier, ip_address) VALUES ($1, $2, $3)`,
+		scope, triedIdentifier, ipAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to log login failure: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &throttle, nil
+}
+
+// SetBackoff sets when an account or IP address may try to log in again. A lockout also
+// counts towards the lockouts of the counter and restarts its failures.
+func (r *LoginSecurityModel) SetBackoff(id int, nextAttemptAt time.Time, lockedUntil *time.Time) error {
+	query := `
+		UPDATE login_throttles SET next_attempt_at = $2, locked_until = $3,
+			lockouts = lockouts + CASE WHEN $3::timestamptz IS NULL THEN 0 ELSE 1 END,
+			failures = CASE WHEN $3::timestamptz IS NULL THEN failures ELSE 0 END
+		WHERE id = $1`
+
+	_, err := r.db.Exec(query, id, nextAttemptAt, lockedUntil)
+	if err != nil {
+		return fmt.Errorf("failed to set login backoff: %w", err)
+	}
+	return nil
+}
+
+// ClearThrottle removes the failure counter of an account or IP address after a successful login
+func (r *LoginSecurityModel) ClearThrottle(scope, identifier string) error {
+	_, err := r.db.Exec(`DELETE FROM login_throttles WHERE scope = $1 AND identifier = $2`, scope, identifier)
+	if err != nil {
+		return fmt.Errorf("failed to clear login throttle: %w", err)
+	}
+	return nil
+}
+
+// ListLockouts gets the accounts and IP addresses that are locked out or waiting out a backoff
+func (r *LoginSecurityModel) ListLockouts() ([]tables.LoginThrottle, error) {
+	throttles := []tables.LoginThrottle{}
+	query := loginThrottleSelect + `
+		WHERE locked_until > NOW() OR next_attempt_at > NOW()
+		ORDER BY locked_until DESC NULLS LAST, next_attempt_at DESC`
+
+	err := r.db.Select(&throttles, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login lockouts: %w", err)
+	}
+	return throttles, nil
+}
+
+// ClearLockout removes a failure counter, so the account or IP address can log in right away
+func (r *LoginSecurityModel) ClearLockout(id int) error {
+	result, err := r.db.Exec(`DELETE FROM login_throttles WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to clear login lockout: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("login lockout not found")
+	}
+	return nil
+}
+
+// CountIdentifiersByIP counts the different accounts or test codes an IP address failed to
+// log in to since a time
+func (r *LoginSecurityModel) CountIdentifiersByIP(ipAddress string, since time.Time) (int, error) {
+	var count int
+	err := r.db.Get(&count, `
+		SELECT COUNT(DISTINCT (scope, identifier)) FROM login_failures
+		WHERE ip_address = $1 AND created_at >= $2`,
+		ipAddress, since)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count login failures by IP address: %w", err)
+	}
+	return count, nil
+}
+
+// CountIPsByIdentifier counts the different IP addresses that failed to log in to an account
+// since a time
+func (r *LoginSecurityModel) CountIPsByIdentifier(scope, identifier string, since time.Time) (int, error) {
+	var count int
+	err := r.db.Get(&count, `
+		SELECT COUNT(DISTINCT ip_address) FROM login_failures
+		WHERE scope = $1 AND identifier = $2 AND created_at >= $3`,
+		scope, identifier, since)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count login failures by account: %w", err)
+	}
+	return count, nil
+}
+
+// CleanupFailures removes logged failures older than maxAge
+func (r *LoginSecurityModel) CleanupFailures(maxAge time.Duration) error {
+	_, err := r.db.Exec(`DELETE FROM login_failures WHERE created_at < $1`, time.Now().Add(-maxAge))
+	if err != nil {
+		return fmt.Errorf("failed to cleanup login failures: %w", err)
+	}
+	return nil
+}
+
+// CreateAlert raises a security alert, unless the same alert is still unacknowledged since
+// a time. It reports whether the alert was raised.
+func (r *LoginSecurityModel) CreateAlert(alert *tables.SecurityAlert, since time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		INSERT INTO security_alerts (kind, scope, identifier, ip_address, details)
+		SELECT $1, $2, $3, $4, $5
+		WHERE NOT EXISTS (
+			SELECT 1 FROM security_alerts
+			WHERE kind = $1 AND scope = $2
+				AND identifier IS NOT DISTINCT FROM $3 AND ip_address IS NOT DISTINCT FROM $4
+				AND acknowledged_at IS NULL AND created_at >= $6
+		)`,
+		alert.Kind, alert.Scope, alert.Identifier, alert.IPAddress, alert.Details, since)
+	if err != nil {
+		return false, fmt.Errorf("failed to create security alert: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+// ListAlerts gets security alerts, newest first, optionally only the unacknowledged ones
+func (r *LoginSecurityModel) ListAlerts(unacknowledged bool, limit int) ([]tables.SecurityAlert, error) {
+	alerts := []tables.SecurityAlert{}
+	query := `
+		SELECT id, kind, scope, identifier, ip_address, details, created_at, acknowledged_at, acknowledged_by
+		FROM security_alerts
+		WHERE NOT $1 OR acknowledged_at IS NULL
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2`
+
+	err := r.db.Select(&alerts, query, unacknowledged, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get security alerts: %w", err)
+	}
+	return alerts, nil
+}
+
+// AcknowledgeAlert marks a security alert as handled by a user
+func (r *LoginSecurityModel) AcknowledgeAlert(id, userID int) error {
+	result, err := r.db.Exec(`
+		UPDATE security_alerts SET acknowledged_at = NOW(), acknowledged_by = $2
+		WHERE id = $1 AND acknowledged_at IS NULL`,
+		id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to acknowledge security alert: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("security alert not found")
+	}
+	return nil
+}
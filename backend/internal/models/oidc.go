@@ -0,0 +1,128 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// OIDCModel stores the pending single sign-on logins, the sessions handed to the frontend,
+// and the identity provider subjects of users
+type OIDCModel struct {
+	db *database.DB
+}
+
+func NewOIDCModel(db *database.DB) *OIDCModel {
+	return &OIDCModel{db: db}
+}
+
+// CreateState stores a login sent to the identity provider
+func (r *OIDCModel) CreateState(state *tables.OIDCLoginState) error {
+	_, err := r.db.Exec(`
+		INSERT INTO oidc_login_states (state, nonce, code_verifier, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, NOW())`,
+		state.State, state.Nonce, state.CodeVerifier, state.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create login state: %w", err)
+	}
+	return nil
+}
+
+// TakeState gets and deletes an unexpired login state, so each callback is used once
+func (r *OIDCModel) TakeState(state string) (*tables.OIDCLoginState, error) {
+	loginState := &tables.OIDCLoginState{}
+	err := r.db.Get(loginState, `
+		DELETE FROM oidc_login_states
+		WHERE state = $1
+		RETURNING state, nonce, code_verifier, expires_at, created_at`, state)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("unknown login state")
+		}
+		return nil, fmt.Errorf("failed to get login state: %w", err)
+	}
+	if time.Now().After(loginState.ExpiresAt) {
+		return nil, fmt.Errorf("unknown login state")
+	}
+	return loginState, nil
+}
+
+// CreateHandoff stores a session to hand over for a code
+func (r *OIDCModel) CreateHandoff(codeHash, sessionID string, expiresAt time.Time) error {
+	_, err := r.db.Exec(`
+		INSERT INTO oidc_login_handoffs (code_hash, session_id, expires_at, created_at)
+		VALUES ($1, $2, $3, NOW())`,
+		codeHash, sessionID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create login handoff: %w", err)
+	}
+	return nil
+}
+
+// TakeHandoff gets and deletes the session handed over for a code
+func (r *OIDCModel) TakeHandoff(codeHash string) (string, error) {
+	var handoff struct {
+		SessionID string    `db:"session_id"`
+		ExpiresAt time.Time `db:"expires_at"`
+	}
+	err := r.db.Get(&handoff, `
+		DELETE FROM oidc_login_handoffs
+		WHERE code_hash = $1
+		RETURNING session_id, expires_at`, codeHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("invalid or expired login code")
+		}
+		return "", fmt.Errorf("failed to get login handoff: %w", err)
+	}
+	if time.Now().After(handoff.ExpiresAt) {
+		return "", fmt.Errorf("invalid or expired login code")
+	}
+	return handoff.SessionID, nil
+}
+
+// Cleanup deletes expired login states and handoffs
+func (r *OIDCModel) Cleanup() error {
+	if _, err := r.db.Exec(`DELETE FROM oidc_login_states WHERE expires_at < NOW()`); err != nil {
+		return fmt.Errorf("failed to clean up login states: %w", err)
+	}
+	if _, err := r.db.Exec(`DELETE FROM oidc_login_handoffs WHERE expires_at < NOW()`); err != nil {
+		return fmt.Errorf("failed to clean up login handoffs: %w", err)
+	}
+	return nil
+}
+
+// GetUserIDBySubject gets the user linked to an identity provider subject, or 0 if none is
+func (r *OIDCModel) GetUserIDBySubject(subject string) (int, error) {
+	var userID int
+	err := r.db.Get(&userID, `SELECT id FROM users WHERE oidc_subject = $1 AND deleted_at IS NULL`, subject)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get user by subject: %w", err)
+	}
+	return userID, nil
+}
+
+// LinkSubject links a user to an identity provider subject. A user already linked to
+// another subject is not relinked.
+func (r *OIDCModel) LinkSubject(userID int, subject string) error {
+	result, err := r.db.Exec(`
+		UPDATE users SET oidc_subject = $1, updated_at = NOW()
+		WHERE id = $2 AND (oidc_subject IS NULL OR oidc_subject = $1)`, subject, userID)
+	if err != nil {
+		return fmt.Errorf("failed to link user to identity provider: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to link user to identity provider: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("user is linked to another identity provider account")
+	}
+	return nil
+}
@@ -17,13 +17,20 @@ func NewParticipantModel(db *database.DB) *ParticipantModel {
 	return &ParticipantModel{db: db}
 }
 
-func (r *ParticipantModel) Create(participant *tables.Participant) error {
+// Create creates a participant for the client of scope
+func (r *ParticipantModel) Create(scope ClientScope, participant *tables.Participant) error {
+	clientID, err := scope.owner()
+	if err != nil {
+		return err
+	}
+	participant.ClientID = &clientID
+
 	query := `
 		INSERT INTO takers (name, reg, email, password, is_verified, client_id, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
 		RETURNING id, created_at, updated_at`
 
-	err := r.db.QueryRow(query, participant.Name, participant.Reg, participant.Email,
+	err = r.db.QueryRow(query, participant.Name, participant.Reg, participant.Email,
 		participant.Password, participant.IsVerified, participant.ClientID).Scan(&participant.ID, &participant.CreatedAt, &participant.UpdatedAt)
 
 	if err != nil {
@@ -32,15 +39,15 @@ func (r *ParticipantModel) Create(participant *tables.Participant) error {
 	return nil
 }
 
-func (r *ParticipantModel) GetByID(id int) (*tables.Participant, error) {
+func (r *ParticipantModel) GetByID(scope ClientScope, id int) (*tables.Participant, error) {
 	participant := &tables.Participant{}
 	query := `
-		SELECT id, name, reg, email, password, is_verified, client_id, 
+		SELECT id, name, reg, email, password, is_verified, client_id, must_change_password,
 			   created_at, updated_at
 		FROM takers 
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL AND ` + clientCondition("client_id", 2)
 
-	err := r.db.Get(participant, query, id)
+	err := r.db.Get(participant, query, id, scope.arg())
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("participant not found")
@@ -53,10 +60,10 @@ func (r *ParticipantModel) GetByID(id int) (*tables.Participant, error) {
 func (r *ParticipantModel) GetByEmail(email string) (*tables.Participant, error) {
 	participant := &tables.Participant{}
 	query := `
-		SELECT id, name, reg, email, password, is_verified, client_id, 
+		SELECT id, name, reg, email, password, is_verified, client_id, must_change_password,
 			   created_at, updated_at
 		FROM takers 
-		WHERE email = $1`
+		WHERE email = $1 AND deleted_at IS NULL`
 
 	err := r.db.Get(participant, query, email)
 	if err != nil {
@@ -68,7 +75,7 @@ func (r *ParticipantModel) GetByEmail(email string) (*tables.Participant, error)
 	return participant, nil
 }
 
-func (r *ParticipantModel) Update(id int, updates *tables.ParticipantUpdateRequest) (*tables.Participant, error) {
+func (r *ParticipantModel) Update(scope ClientScope, id int, updates *tables.ParticipantUpdateRequest) (*tables.Participant, error) {
 	setParts := []string{}
 	args := []interface{}{}
 	argIndex := 1
@@ -95,41 +102,73 @@ func (r *ParticipantModel) Update(id int, updates *tables.ParticipantUpdateReque
 	}
 
 	if len(setParts) == 0 {
-		return r.GetByID(id)
+		return r.GetByID(scope, id)
 	}
 
 	setParts = append(setParts, "updated_at = NOW()")
 	setClause := strings.Join(setParts, ", ")
-	args = append(args, id)
+	args = append(args, id, scope.arg())
 
 	query := fmt.Sprintf(`
 		UPDATE takers 
 		SET %s 
-		WHERE id = $%d`, setClause, argIndex)
+		WHERE id = $%d AND deleted_at IS NULL AND %s`, setClause, argIndex, clientCondition("client_id", argIndex+1))
 
-	_, err := r.db.Exec(query, args...)
+	result, err := r.db.Exec(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update participant: %w", err)
 	}
+	if err := requireRow(result, "participant not found"); err != nil {
+		return nil, err
+	}
 
-	return r.GetByID(id)
+	return r.GetByID(scope, id)
 }
 
-func (r *ParticipantModel) Delete(id int) error {
-	query := `DELETE FROM takers WHERE id = $1`
-	_, err := r.db.Exec(query, id)
+// Delete soft deletes a participant, who can then no longer log in. Their attempts and group
+// memberships are kept.
+func (r *ParticipantModel) Delete(scope ClientScope, id int) error {
+	query := `UPDATE takers SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL AND ` + clientCondition("client_id", 2)
+	result, err := r.db.Exec(query, id, scope.arg())
 	if err != nil {
 		return fmt.Errorf("failed to delete participant: %w", err)
 	}
-	return nil
+	return requireRow(result, "participant not found")
 }
 
-func (r *ParticipantModel) List(pagination tables.Pagination, search string, groupID *int) (*tables.PaginatedResponse, error) {
+// participantDeletedColumns are the columns of deleted participants, those of GetByID and deleted_at
+const participantDeletedColumns = `id, name, reg, email, is_verified, client_id, must_change_password,
+			   created_at, updated_at, deleted_at`
+
+// ListDeleted gets the deleted participants, most recently deleted first
+func (r *ParticipantModel) ListDeleted(scope ClientScope, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
+	participants := []tables.Participant{}
+	return listDeleted(r.db, &participants, "takers", participantDeletedColumns, clientIDCondition, scope, pagination)
+}
+
+// GetDeleted gets a deleted participant
+func (r *ParticipantModel) GetDeleted(scope ClientScope, id int) (*tables.Participant, error) {
+	participant := &tables.Participant{}
+	if err := getDeleted(r.db, participant, "takers", participantDeletedColumns, clientIDCondition, scope, id, "participant not found"); err != nil {
+		return nil, err
+	}
+	return participant, nil
+}
+
+// Restore restores a deleted participant
+func (r *ParticipantModel) Restore(scope ClientScope, id int) (*tables.Participant, error) {
+	if err := restoreDeleted(r.db, "takers", clientIDCondition, scope, id, "participant not found"); err != nil {
+		return nil, err
+	}
+	return r.GetByID(scope, id)
+}
+
+func (r *ParticipantModel) List(scope ClientScope, pagination tables.Pagination, search string, groupID *int) (*tables.PaginatedResponse, error) {
 	offset := (pagination.Page - 1) * pagination.PerPage
 
-	whereClause := "WHERE 1=1"
-	args := []interface{}{pagination.PerPage, offset}
-	argIndex := 3
+	whereClause := "WHERE t.deleted_at IS NULL AND " + clientCondition("t.client_id", 1)
+	args := []interface{}{scope.arg()}
+	argIndex := 2
 
 	if search != "" {
 		whereClause += fmt.Sprintf(" AND (t.name ILIKE $%d OR t.email ILIKE $%d)", argIndex, argIndex)
@@ -146,18 +185,22 @@ func (r *ParticipantModel) List(pagination tables.Pagination, search string, gro
 	// Get total count
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM takers t %s", whereClause)
 	var total int
-	err := r.db.Get(&total, countQuery, args[2:]...)
+	err := r.db.Get(&total, countQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get total count: %w", err)
 	}
 
+	limitParam := fmt.Sprintf("$%d", argIndex)
+	offsetParam := fmt.Sprintf("$%d", argIndex+1)
+	args = append(args, pagination.PerPage, offset)
+
 	// Get takers
 	query := fmt.Sprintf(`
 		SELECT t.id, t.name, t.reg, t.email, t.is_verified, t.client_id, 
 			   t.created_at, t.updated_at
 		FROM takers t %s 
 		ORDER BY t.created_at DESC
-		LIMIT $1 OFFSET $2`, whereClause)
+		LIMIT %s OFFSET %s`, whereClause, limitParam, offsetParam)
 
 	participants := []tables.Participant{}
 	err = r.db.Select(&participants, query, args...)
@@ -176,17 +219,17 @@ func (r *ParticipantModel) List(pagination tables.Pagination, search string, gro
 	}, nil
 }
 
-func (r *ParticipantModel) GetParticipantGroups(participantID int) ([]tables.Group, error) {
+func (r *ParticipantModel) GetParticipantGroups(scope ClientScope, participantID int) ([]tables.Group, error) {
 	groups := []tables.Group{}
 	query := `
 		SELECT g.id, g.name, g.description, g.code, g.last_taker_code, 
 			   g.closed_at, g.client_id, g.created_at, g.updated_at
 		FROM groups g
 		JOIN group_taker gt ON g.id = gt.group_id
-		WHERE gt.taker_id = $1
+		WHERE gt.taker_id = $1 AND g.deleted_at IS NULL AND ` + clientCondition("g.client_id", 2) + `
 		ORDER BY g.name`
 
-	err := r.db.Select(&groups, query, participantID)
+	err := r.db.Select(&groups, query, participantID, scope.arg())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get participant groups: %w", err)
 	}
@@ -202,22 +245,22 @@ func (r *ParticipantModel) UpdatePassword(participantID int, hashedPassword stri
 	return nil
 }
 
-func (r *ParticipantModel) SetVerified(participantID int, verified bool) error {
-	query := `UPDATE takers SET is_verified = $1, updated_at = NOW() WHERE id = $2`
-	_, err := r.db.Exec(query, verified, participantID)
+func (r *ParticipantModel) SetVerified(scope ClientScope, participantID int, verified bool) error {
+	query := `UPDATE takers SET is_verified = $1, updated_at = NOW() WHERE id = $2 AND ` + clientCondition("client_id", 3)
+	result, err := r.db.Exec(query, verified, participantID, scope.arg())
 	if err != nil {
 		return fmt.Errorf("failed to update participant verification status: %w", err)
 	}
-	return nil
+	return requireRow(result, "participant not found")
 }
 
 func (r *ParticipantModel) GetByRegistrationNumber(regNumber string) (*tables.Participant, error) {
 	participant := &tables.Participant{}
 	query := `
-		SELECT id, name, reg, email, password, is_verified, client_id, 
+		SELECT id, name, reg, email, password, is_verified, client_id, must_change_password,
 			   created_at, updated_at
 		FROM takers 
-		WHERE reg = $1`
+		WHERE reg = $1 AND deleted_at IS NULL`
 
 	err := r.db.Get(participant, query, regNumber)
 	if err != nil {
@@ -244,6 +287,7 @@ func (r *ParticipantModel) GetByTestCode(testCode string) (*tables.Participant,
 		JOIN group_taker gt ON t.id = gt.taker_id
 		JOIN deliveries d ON d.group_id = gt.group_id
 		WHERE gt.taker_code = $1
+			AND t.deleted_at IS NULL AND d.deleted_at IS NULL
 			AND (d.is_finished IS NULL OR d.is_finished > NOW())
 		ORDER BY d.scheduled_at DESC
 		LIMIT 1`
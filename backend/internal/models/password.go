@@ -0,0 +1,242 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// passwordTables are the tables holding the passwords of each account type
+var passwordTables = map[string]string{
+	tables.PasswordAccountUser:        "users",
+	tables.PasswordAccountParticipant: "takers",
+}
+
+// PasswordModel stores passwords with their history, the forced password change flag and
+// password reset tokens of users and participants
+type PasswordModel struct {
+	db *database.DB
+}
+
+func NewPasswordModel(db *database.DB) *PasswordModel {
+	return &PasswordModel{db: db}
+}
+
+func passwordTable(accountType string) (string, error) {
+	table, ok := passwordTables[accountType]
+	if !ok {
+		return "", fmt.Errorf("unknown account type %q", accountType)
+	}
+	return table, nil
+}
+
+// RecentHashes gets the hashes of the current and previous passwords of an account, most
+// recent first
+func (r *PasswordModel) RecentHashes(accountType string, accountID int, limit int) ([]string, error) {
+	table, err := passwordTable(accountType)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := []string{}
+	var current sql.NullString
+	err = r.db.Get(&current, fmt.Sprintf(`SELECT password FROM %s WHERE id = $1`, table), accountID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("account not found")
+		}
+		return nil, fmt.Errorf("failed to get password: %w", err)
+	}
+	if current.Valid && current.String != "" {
+		hashes = append(hashes, current.String)
+	}
+
+	history := []string{}
+	query := `
+		SELECT password FROM password_history
+		WHERE account_type = $1 AND account_id = $2
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3`
+	if err := r.db.Select(&history, query, accountType, accountID, limit); err != nil {
+		return nil, fmt.Errorf("failed to get password history: %w", err)
+	}
+	for _, hash := range history {
+		if len(hashes) == 0 || hash != hashes[0] {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes, nil
+}
+
+// SetPassword replaces the password of an account, recording it in the password history and
+// keeping the last keepHistory passwords there
+func (r *PasswordModel) SetPassword(accountType string, accountID int, hashedPassword string, mustChange bool, keepHistory int) error {
+	table, err := passwordTable(accountType)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(fmt.Sprintf(`
+		UPDATE %s
+		SET password = $1, must_change_password = $2, password_changed_at = NOW(), updated_at = NOW()
+		WHERE id = $3`, table),
+		hashedPassword, mustChange, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("account not found")
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO password_history (account_type, account_id, password, created_at)
+		VALUES ($1, $2, $3, NOW())`,
+		accountType, accountID, hashedPassword)
+	if err != nil {
+		return fmt.Errorf("failed to record password history: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM password_history
+		WHERE account_type = $1 AND account_id = $2 AND id NOT IN (
+			SELECT id FROM password_history
+			WHERE account_type = $1 AND account_id = $2
+			ORDER BY created_at DESC, id DESC
+			LIMIT $3
+		)`,
+		accountType, accountID, keepHistory)
+	if err != nil {
+		return fmt.Errorf("failed to trim password history: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit password: %w", err)
+	}
+	return nil
+}
+
+// ClearPassword removes the password of an account, so it cannot log in until a new
+// password is set with a reset token
+func (r *PasswordModel) ClearPassword(accountType string, accountID int) error {
+	table, err := passwordTable(accountType)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(fmt.Sprintf(`UPDATE %s SET password = '', updated_at = NOW() WHERE id = $1`, table), accountID)
+	if err != nil {
+		return fmt.Errorf("failed to clear password: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("account not found")
+	}
+	return nil
+}
+
+// SetMustChange sets whether an account must change its password at the next login
+func (r *PasswordModel) SetMustChange(accountType string, accountID int, mustChange bool) error {
+	table, err := passwordTable(accountType)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(fmt.Sprintf(`UPDATE %s SET must_change_password = $1, updated_at = NOW() WHERE id = $2`, table), mustChange, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to update password change requirement: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("account not found")
+	}
+	return nil
+}
+
+// CreateResetToken stores a reset token, replacing the unused tokens of the account
+func (r *PasswordModel) CreateResetToken(accountType string, accountID int, tokenHash string, expiresAt time.Time, createdBy *int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM password_reset_tokens WHERE account_type = $1 AND account_id = $2 AND used_at IS NULL`, accountType, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to delete previous reset tokens: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO password_reset_tokens (account_type, account_id, token_hash, expires_at, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())`,
+		accountType, accountID, tokenHash, expiresAt, createdBy)
+	if err != nil {
+		return fmt.Errorf("failed to create reset token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit reset token: %w", err)
+	}
+	return nil
+}
+
+// GetResetToken gets an unused, unexpired reset token by its hash
+func (r *PasswordModel) GetResetToken(tokenHash string) (*tables.PasswordResetToken, error) {
+	token := &tables.PasswordResetToken{}
+	query := `
+		SELECT id, account_type, account_id, token_hash, expires_at, used_at, created_by, created_at
+		FROM password_reset_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()`
+
+	err := r.db.Get(token, query, tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("invalid or expired reset token")
+		}
+		return nil, fmt.Errorf("failed to get reset token: %w", err)
+	}
+	return token, nil
+}
+
+// UseResetToken marks a reset token used. It fails when the token was used meanwhile.
+func (r *PasswordModel) UseResetToken(id int) error {
+	result, err := r.db.Exec(`UPDATE password_reset_tokens SET used_at = NOW() WHERE id = $1 AND used_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to use reset token: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("invalid or expired reset token")
+	}
+	return nil
+}
+
+// CleanupResetTokens deletes used and expired reset tokens
+func (r *PasswordModel) CleanupResetTokens() error {
+	_, err := r.db.Exec(`DELETE FROM password_reset_tokens WHERE used_at IS NOT NULL OR expires_at < NOW()`)
+	if err != nil {
+		return fmt.Errorf("failed to clean up reset tokens: %w", err)
+	}
+	return nil
+}
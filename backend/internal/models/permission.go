@@ -0,0 +1,158 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+type PermissionModel struct {
+	db *database.DB
+}
+
+func NewPermissionModel(db *database.DB) *PermissionModel {
+	return &PermissionModel{db: db}
+}
+
+const permissionSelect = `
+	SELECT id, name, COALESCE(display_name, '') AS display_name, COALESCE(description, '') AS description,
+		   created_at, updated_at
+	FROM permissions`
+
+// List lists all permissions
+func (r *PermissionModel) List() ([]tables.Permission, error) {
+	permissions := []tables.Permission{}
+	err := r.db.Select(&permissions, permissionSelect+` ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list permissions: %w", err)
+	}
+	return permissions, nil
+}
+
+// SyncCatalog stores the permissions of the catalog and grants them all to the
+// administrator role
+func (r *PermissionModel) SyncCatalog(catalog []tables.Permission) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, permission := range catalog {
+		_, err = tx.Exec(`
+			INSERT INTO permissions (name, display_name, description, created_at, updated_at)
+			VALUES ($1, $2, $3, NOW(), NOW())
+			ON CONFLICT (name) DO UPDATE SET
+				display_name = EXCLUDED.display_name, description = EXCLUDED.description`,
+			permission.Name, permission.DisplayName, permission.Description)
+		if err != nil {
+			return fmt.Errorf("failed to store permission %s: %w", permission.Name, err)
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO permission_role (permission_id, role_id)
+			SELECT p.id, ro.id FROM permissions p, roles ro
+			WHERE p.name = $1 AND ro.name = $2
+			ON CONFLICT DO NOTHING`,
+			permission.Name, tables.AdministratorRole)
+		if err != nil {
+			return fmt.Errorf("failed to grant permission %s to administrators: %w", permission.Name, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit permissions: %w", err)
+	}
+	return nil
+}
+
+// GetEffective gets the names of the permissions a user has through their roles or as
+// direct grants
+func (r *PermissionModel) GetEffective(userID int) ([]string, error) {
+	names := []string{}
+	query := `
+		SELECT p.name
+		FROM permissions p
+		WHERE p.id IN (
+			SELECT pr.permission_id
+			FROM permission_role pr
+			JOIN role_user ru ON ru.role_id = pr.role_id
+			WHERE ru.user_id = $1
+		) OR p.id IN (
+			SELECT pu.permission_id FROM permission_user pu WHERE pu.user_id = $1
+		)
+		ORDER BY p.name`
+
+	err := r.db.Select(&names, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user permissions: %w", err)
+	}
+	return names, nil
+}
+
+// GetUserPermissions gets the names of the permissions granted directly to a user
+func (r *PermissionModel) GetUserPermissions(userID int) ([]string, error) {
+	names := []string{}
+	query := `
+		SELECT p.name
+		FROM permissions p
+		JOIN permission_user pu ON pu.permission_id = p.id
+		WHERE pu.user_id = $1
+		ORDER BY p.name`
+
+	err := r.db.Select(&names, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get direct user permissions: %w", err)
+	}
+	return names, nil
+}
+
+// SetUserPermissions replaces the permissions granted directly to a user
+func (r *PermissionModel) SetUserPermissions(userID int, names []string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM permission_user WHERE user_id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("failed to clear user permissions: %w", err)
+	}
+
+	for _, name := range names {
+		err = grantPermission(tx, `
+			INSERT INTO permission_user (permission_id, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING`, name, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit user permissions: %w", err)
+	}
+	return nil
+}
+
+// grantPermission runs an insert of a permission ID and grantee ID granting the permission
+// name, failing if it is unknown
+func grantPermission(tx *sqlx.Tx, query, name string, granteeID int) error {
+	var permissionID int
+	err := tx.Get(&permissionID, "SELECT id FROM permissions WHERE name = $1", name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("permission not found")
+		}
+		return fmt.Errorf("failed to get permission %s: %w", name, err)
+	}
+
+	if _, err = tx.Exec(query, permissionID, granteeID); err != nil {
+		return fmt.Errorf("failed to grant permission %s: %w", name, err)
+	}
+	return nil
+}
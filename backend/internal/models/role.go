@@ -0,0 +1,278 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+type RoleModel struct {
+	db *database.DB
+}
+
+func NewRoleModel(db *database.DB) *RoleModel {
+	return &RoleModel{db: db}
+}
+
+const roleSelect = `
+	SELECT id, name, COALESCE(display_name, '') AS display_name, COALESCE(description, '') AS description,
+		   two_factor_required, max_sessions, created_at, updated_at
+	FROM roles`
+
+// List lists all roles with their permissions
+func (r *RoleModel) List() ([]tables.RoleWithPermissions, error) {
+	roles := []tables.Role{}
+	err := r.db.Select(&roles, roleSelect+` ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+
+	result := make([]tables.RoleWithPermissions, 0, len(roles))
+	for _, role := range roles {
+		permissions, err := r.GetPermissions(role.ID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, tables.RoleWithPermissions{Role: role, Permissions: permissions})
+	}
+	return result, nil
+}
+
+// GetByID gets a role with its permissions
+func (r *RoleModel) GetByID(id int) (*tables.RoleWithPermissions, error) {
+	role := tables.Role{}
+	err := r.db.Get(&role, roleSelect+` WHERE id = $1`, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("role not found")
+		}
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	permissions, err := r.GetPermissions(id)
+	if err != nil {
+		return nil, err
+	}
+	return &tables.RoleWithPermissions{Role: role, Permissions: permissions}, nil
+}
+
+// GetPermissions gets the names of the permissions granted to a role
+func (r *RoleModel) GetPermissions(roleID int) ([]string, error) {
+	names := []string{}
+	query := `
+		SELECT p.name
+		FROM permissions p
+		JOIN permission_role pr ON pr.permission_id = p.id
+		WHERE pr.role_id = $1
+		ORDER BY p.name`
+
+	err := r.db.Select(&names, query, roleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role permissions: %w", err)
+	}
+	return names, nil
+}
+
+// Create creates a role with its permissions
+func (r *RoleModel) Create(req *tables.RoleCreateRequest) (*tables.RoleWithPermissions, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.Get(&exists, "SELECT EXISTS(SELECT 1 FROM roles WHERE name = $1)", req.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check role name: %w", err)
+	}
+	if exists {
+		return nil, fmt.Errorf("role already exists")
+	}
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO roles (name, display_name, description, two_factor_required, max_sessions, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		RETURNING id`,
+		req.Name, req.DisplayName, req.Description, req.TwoFactorRequired, req.MaxSessions).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create role: %w", err)
+	}
+
+	if err = setRolePermissions(tx, id, req.Permissions); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit role: %w", err)
+	}
+	return r.GetByID(id)
+}
+
+// Update updates the display name, description, two-factor requirement and session limit of a role
+func (r *RoleModel) Update(id int, req *tables.RoleUpdateRequest) (*tables.RoleWithPermissions, error) {
+	result, err := r.db.Exec(`
+		UPDATE roles
+		SET display_name = COALESCE($1, display_name), description = COALESCE($2, description),
+			two_factor_required = COALESCE($3, two_factor_required),
+			max_sessions = CASE WHEN $4 THEN NULL ELSE COALESCE($5, max_sessions) END, updated_at = NOW()
+		WHERE id = $6`,
+		req.DisplayName, req.Description, req.TwoFactorRequired, req.DefaultMaxSessions, req.MaxSessions, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update role: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return nil, fmt.Errorf("role not found")
+	}
+	return r.GetByID(id)
+}
+
+// Delete deletes a role, taking it away from its users
+func (r *RoleModel) Delete(id int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM permission_role WHERE role_id = $1", id); err != nil {
+		return fmt.Errorf("failed to clear role permissions: %w", err)
+	}
+	if _, err = tx.Exec("DELETE FROM role_user WHERE role_id = $1", id); err != nil {
+		return fmt.Errorf("failed to clear role users: %w", err)
+	}
+
+	result, err := tx.Exec("DELETE FROM roles WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("role not found")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit role deletion: %w", err)
+	}
+	return nil
+}
+
+// SetPermissions replaces the permissions granted to a role
+func (r *RoleModel) SetPermissions(roleID int, names []string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err = setRolePermissions(tx, roleID, names); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit role permissions: %w", err)
+	}
+	return nil
+}
+
+// SetUserRoles replaces the roles of a user
+func (r *RoleModel) SetUserRoles(userID int, roleIDs []int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM role_user WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("failed to clear user roles: %w", err)
+	}
+
+	for _, roleID := range roleIDs {
+		var exists bool
+		err = tx.Get(&exists, "SELECT EXISTS(SELECT 1 FROM roles WHERE id = $1)", roleID)
+		if err != nil {
+			return fmt.Errorf("failed to check role %d: %w", roleID, err)
+		}
+		if !exists {
+			return fmt.Errorf("role not found")
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO role_user (role_id, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING`,
+			roleID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to assign role %d: %w", roleID, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit user roles: %w", err)
+	}
+	return nil
+}
+
+// SyncManagedRoles gives a user the granted roles among the managed ones and takes away the
+// other managed roles, leaving their unmanaged roles alone. Unknown role names are ignored.
+func (r *RoleModel) SyncManagedRoles(userID int, managed, granted []string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DELETE FROM role_user
+		WHERE user_id = $1 AND role_id IN (
+			SELECT id FROM roles WHERE name = ANY($2) AND NOT name = ANY($3)
+		)`,
+		userID, pq.Array(managed), pq.Array(granted))
+	if err != nil {
+		return fmt.Errorf("failed to remove managed roles: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO role_user (role_id, user_id)
+		SELECT id, $1::int FROM roles WHERE name = ANY($2)
+		ON CONFLICT DO NOTHING`,
+		userID, pq.Array(granted))
+	if err != nil {
+		return fmt.Errorf("failed to assign managed roles: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit user roles: %w", err)
+	}
+	return nil
+}
+
+func setRolePermissions(tx *sqlx.Tx, roleID int, names []string) error {
+	if _, err := tx.Exec("DELETE FROM permission_role WHERE role_id = $1", roleID); err != nil {
+		return fmt.Errorf("failed to clear role permissions: %w", err)
+	}
+
+	for _, name := range names {
+		err := grantPermission(tx, `
+			INSERT INTO permission_role (permission_id, role_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING`, name, roleID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -18,11 +18,17 @@ func NewSessionModel(db *database.DB) *SessionModel {
 	return &SessionModel{db: db}
 }
 
-func (r *SessionModel) Create(userID int, ipAddress, userAgent string, sessionData *tables.SessionData) (*tables.Session, error) {
-	// First delete any existing sessions for this user (single session enforcement)
-	err := r.DeleteByUserID(userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to delete existing sessions: %w", err)
+// Create creates a session for a user. With maxSessions above 0, the least recently used
+// sessions of the user are deleted so that, with the new one, they have at most maxSessions.
+// A session still waiting for two-factor authentication does not count toward the limit
+// until it passes (see EnforceLimit).
+func (r *SessionModel) Create(userID int, ipAddress, userAgent string, sessionData *tables.SessionData, maxSessions int) (*tables.Session, error) {
+	pending := sessionData.TwoFactorPending != ""
+	if maxSessions > 0 && !pending {
+		err := r.trimUserSessions(userID, "", maxSessions-1)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	sessionID := uuid.New().String()
@@ -31,27 +37,76 @@ func (r *SessionModel) Create(userID int, ipAddress, userAgent string, sessionDa
 		return nil, fmt.Errorf("failed to marshal session data: %w", err)
 	}
 
-	lastActivity := int(time.Now().Unix())
+	now := time.Now()
+	lastActivity := int(now.Unix())
+	sessionUserID := int64(userID)
 
 	query := `
-		INSERT INTO sessions (id, user_id, ip_address, user_agent, payload, last_activity)
-		VALUES ($1, $2, $3, $4, $5, $6)`
+		INSERT INTO sessions (id, user_id, ip_address, user_agent, payload, last_activity, created_at, two_factor_pending)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
 
-	_, err = r.db.Exec(query, sessionID, userID, ipAddress, userAgent, string(payload), lastActivity)
+	_, err = r.db.Exec(query, sessionID, userID, ipAddress, userAgent, string(payload), lastActivity, now, pending)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
 	return &tables.Session{
 		ID:           sessionID,
-		UserID:       (*int64)(new(int64)),
+		UserID:       &sessionUserID,
 		IPAddress:    ipAddress,
 		UserAgent:    userAgent,
 		Payload:      string(payload),
 		LastActivity: lastActivity,
+		CreatedAt:    &now,
 	}, nil
 }
 
+// EnforceLimit ends the least recently used other sessions of a user so that, with
+// sessionID, they have at most maxSessions, 0 being unlimited. It is called once a session
+// passes two-factor authentication.
+func (r *SessionModel) EnforceLimit(userID int, sessionID string, maxSessions int) error {
+	if maxSessions <= 0 {
+		return nil
+	}
+	return r.trimUserSessions(userID, sessionID, maxSessions-1)
+}
+
+// trimUserSessions deletes the least recently used sessions of a user beyond keep, leaving
+// out exceptSessionID and sessions waiting for two-factor authentication
+func (r *SessionModel) trimUserSessions(userID int, exceptSessionID string, keep int) error {
+	query := `
+		DELETE FROM sessions
+		WHERE user_id = $1 AND id <> $3 AND NOT two_factor_pending AND id NOT IN (
+			SELECT id FROM sessions
+			WHERE user_id = $1 AND id <> $3 AND NOT two_factor_pending
+			ORDER BY last_activity DESC
+			LIMIT $2
+		)`
+
+	_, err := r.db.Exec(query, userID, keep, exceptSessionID)
+	if err != nil {
+		return fmt.Errorf("failed to end old sessions: %w", err)
+	}
+	return nil
+}
+
+// ListByUserID lists the sessions of a user, most recently used first
+func (r *SessionModel) ListByUserID(userID int) ([]tables.Session, error) {
+	sessions := []tables.Session{}
+	query := `
+		SELECT id, user_id, COALESCE(ip_address, '') AS ip_address, COALESCE(user_agent, '') AS user_agent,
+			   payload, last_activity, created_at
+		FROM sessions
+		WHERE user_id = $1
+		ORDER BY last_activity DESC`
+
+	err := r.db.Select(&sessions, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user sessions: %w", err)
+	}
+	return sessions, nil
+}
+
 func (r *SessionModel) GetByID(sessionID string) (*tables.Session, error) {
 	session := &tables.Session{}
 	query := `
@@ -95,6 +150,22 @@ func (r *SessionModel) DeleteByUserID(userID int) error {
 	return nil
 }
 
+// DeleteOthers deletes every session of a user except keepSessionID, and returns how many
+// were deleted
+func (r *SessionModel) DeleteOthers(userID int, keepSessionID string) (int, error) {
+	query := `DELETE FROM sessions WHERE user_id = $1 AND id <> $2`
+	result, err := r.db.Exec(query, userID, keepSessionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete user sessions: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	return int(rows), nil
+}
+
 func (r *SessionModel) CleanupExpired(maxAge time.Duration) error {
 	cutoff := int(time.Now().Add(-maxAge).Unix())
 	query := `DELETE FROM sessions WHERE last_activity < $1`
@@ -140,3 +211,18 @@ func (r *SessionModel) IsValid(sessionID string, maxIdleTime time.Duration) (boo
 
 	return true, nil
 }
+
+// UpdateSessionData replaces the data stored in a session
+func (r *SessionModel) UpdateSessionData(sessionID string, sessionData *tables.SessionData) error {
+	payload, err := json.Marshal(sessionData)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session data: %w", err)
+	}
+
+	query := `UPDATE sessions SET payload = $1, two_factor_pending = $2 WHERE id = $3`
+	_, err = r.db.Exec(query, string(payload), sessionData.TwoFactorPending != "", sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to update session data: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/medxamion/medxamion/internal/database"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// Exams, items, groups, participants and deliveries are soft deleted: Delete sets deleted_at,
+// and every query other than those of attempts and results leaves out rows with deleted_at
+// set. listDeleted and restoreDeleted serve the deleted rows of these tables; condition
+// limits the rows to the scope passed as argument n, like clientCondition.
+
+// listDeleted gets a page of the deleted rows of table, most recently deleted first, into
+// dest, a pointer to a slice
+func listDeleted(db *database.DB, dest any, table, columns string, condition func(n int) string, scope ClientScope, pagination tables.Pagination) (*tables.PaginatedResponse, error) {
+	offset := (pagination.Page - 1) * pagination.PerPage
+	whereClause := "WHERE deleted_at IS NOT NULL AND " + condition(1)
+
+	var total int
+	err := db.Get(&total, fmt.Sprintf("SELECT COUNT(*) FROM %s %s", table, whereClause), scope.arg())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get total count: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM %s %s
+		ORDER BY deleted_at DESC, id DESC
+		LIMIT $2 OFFSET $3`, columns, table, whereClause)
+
+	err = db.Select(dest, query, scope.arg(), pagination.PerPage, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deleted %s: %w", table, err)
+	}
+
+	totalPages := (total + pagination.PerPage - 1) / pagination.PerPage
+
+	return &tables.PaginatedResponse{
+		Data:       reflect.ValueOf(dest).Elem().Interface(),
+		Total:      total,
+		Page:       pagination.Page,
+		PerPage:    pagination.PerPage,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// getDeleted gets a deleted row of table into dest. It returns an error with notFound when
+// the row is not deleted or outside the scope.
+func getDeleted(db *database.DB, dest any, table, columns string, condition func(n int) string, scope ClientScope, id int, notFound string) error {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM %s
+		WHERE id = $1 AND deleted_at IS NOT NULL AND %s`, columns, table, condition(2))
+
+	err := db.Get(dest, query, id, scope.arg())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New(notFound)
+		}
+		return fmt.Errorf("failed to get deleted %s: %w", table, err)
+	}
+	return nil
+}
+
+// restoreDeleted clears deleted_at of a deleted row of table. It returns an error with
+// notFound when the row is not deleted or outside the scope.
+func restoreDeleted(db *database.DB, table string, condition func(n int) string, scope ClientScope, id int, notFound string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET deleted_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NOT NULL AND %s`, table, condition(2))
+
+	result, err := db.Exec(query, id, scope.arg())
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", table, err)
+	}
+	return requireRow(result, notFound)
+}
+
+// clientIDCondition is clientCondition on the client_id column of the tables with one
+func clientIDCondition(n int) string {
+	return clientCondition("client_id", n)
+}
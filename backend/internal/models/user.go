@@ -1,7 +1,9 @@
 package models
 
 import (
+	"crypto/subtle"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -21,8 +23,8 @@ func (r *UserModel) GetByUsername(username string) (*tables.User, error) {
 	user := &tables.User{}
 	query := `
 		SELECT id, avatar, name, username, email, email_verified_at, password, 
-			   two_factor_secret, two_factor_recovery_codes, gender, profile_photo_path, 
-			   birthplace, birthday, remember_token, last_login, 
+			   two_factor_secret, two_factor_recovery_codes, two_factor_confirmed_at, gender, profile_photo_path, 
+			   birthplace, birthday, remember_token, last_login, must_change_password, password_changed_at,
 			   created_at, updated_at, deleted_at
 		FROM users 
 		WHERE username = $1 AND deleted_at IS NULL`
@@ -41,8 +43,8 @@ func (r *UserModel) GetByID(id int) (*tables.User, error) {
 	user := &tables.User{}
 	query := `
 		SELECT id, avatar, name, username, email, email_verified_at, password, 
-			   two_factor_secret, two_factor_recovery_codes, gender, profile_photo_path, 
-			   birthplace, birthday, remember_token, last_login, 
+			   two_factor_secret, two_factor_recovery_codes, two_factor_confirmed_at, gender, profile_photo_path, 
+			   birthplace, birthday, remember_token, last_login, must_change_password, password_changed_at,
 			   created_at, updated_at, deleted_at
 		FROM users 
 		WHERE id = $1 AND deleted_at IS NULL`
@@ -57,16 +59,40 @@ func (r *UserModel) GetByID(id int) (*tables.User, error) {
 	return user, nil
 }
 
+// GetByEmail gets the user with an email address, ignoring case
+func (r *UserModel) GetByEmail(email string) (*tables.User, error) {
+	user := &tables.User{}
+	query := `
+		SELECT id, avatar, name, username, email, email_verified_at, password, 
+			   two_factor_secret, two_factor_recovery_codes, two_factor_confirmed_at, gender, profile_photo_path, 
+			   birthplace, birthday, remember_token, last_login, must_change_password, password_changed_at,
+			   created_at, updated_at, deleted_at
+		FROM users 
+		WHERE LOWER(email) = LOWER($1) AND deleted_at IS NULL
+		ORDER BY id
+		LIMIT 1`
+
+	err := r.db.Get(user, query, email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
 func (r *UserModel) Create(user *tables.User) error {
 	query := `
 		INSERT INTO users (avatar, name, username, email, password, gender, 
-						  profile_photo_path, birthplace, birthday, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), NOW())
+						  profile_photo_path, birthplace, birthday, must_change_password, password_changed_at,
+						  created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW(), NOW())
 		RETURNING id, created_at, updated_at`
 
 	err := r.db.QueryRow(query, user.Avatar, user.Name, user.Username, user.Email,
 		user.Password, user.Gender, user.ProfilePhotoPath, user.Birthplace,
-		user.Birthday).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+		user.Birthday, user.MustChangePassword).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
@@ -140,26 +166,32 @@ func (r *UserModel) UpdateLastLogin(id int) error {
 	return nil
 }
 
-func (r *UserModel) List(pagination tables.Pagination, search string) (*tables.PaginatedResponse, error) {
+// List lists the users working for the client of scope
+func (r *UserModel) List(scope ClientScope, pagination tables.Pagination, search string) (*tables.PaginatedResponse, error) {
 	offset := (pagination.Page - 1) * pagination.PerPage
 
-	whereClause := "WHERE deleted_at IS NULL"
-	args := []interface{}{pagination.PerPage, offset}
-	argIndex := 3
+	whereClause := "WHERE deleted_at IS NULL AND ($1::int IS NULL OR EXISTS (SELECT 1 FROM client_user cu WHERE cu.user_id = users.id AND cu.client_id = $1))"
+	args := []interface{}{scope.arg()}
+	argIndex := 2
 
 	if search != "" {
 		whereClause += fmt.Sprintf(" AND (name ILIKE $%d OR username ILIKE $%d OR email ILIKE $%d)", argIndex, argIndex, argIndex)
 		args = append(args, "%"+search+"%")
+		argIndex++
 	}
 
 	// Get total count
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM users %s", whereClause)
 	var total int
-	err := r.db.Get(&total, countQuery, args[2:]...)
+	err := r.db.Get(&total, countQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get total count: %w", err)
 	}
 
+	limitParam := fmt.Sprintf("$%d", argIndex)
+	offsetParam := fmt.Sprintf("$%d", argIndex+1)
+	args = append(args, pagination.PerPage, offset)
+
 	// Get users
 	query := fmt.Sprintf(`
 		SELECT id, avatar, name, username, email, email_verified_at, 
@@ -167,7 +199,7 @@ func (r *UserModel) List(pagination tables.Pagination, search string) (*tables.P
 			   created_at, updated_at
 		FROM users %s 
 		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2`, whereClause)
+		LIMIT %s OFFSET %s`, whereClause, limitParam, offsetParam)
 
 	users := []tables.User{}
 	err = r.db.Select(&users, query, args...)
@@ -198,7 +230,7 @@ func (r *UserModel) Delete(id int) error {
 func (r *UserModel) GetUserRoles(userID int) ([]tables.Role, error) {
 	roles := []tables.Role{}
 	query := `
-		SELECT r.id, r.name, r.created_at, r.updated_at
+		SELECT r.id, r.name, r.two_factor_required, r.max_sessions, r.created_at, r.updated_at
 		FROM roles r
 		JOIN role_user ru ON r.id = ru.role_id
 		WHERE ru.user_id = $1`
@@ -218,3 +250,176 @@ func (r *UserModel) UpdatePassword(userID int, hashedPassword string) error {
 	}
 	return nil
 }
+
+// SetTwoFactorSecret stores a new, unconfirmed two-factor secret, replacing any previous one
+func (r *UserModel) SetTwoFactorSecret(userID int, secret string) error {
+	query := `
+		UPDATE users
+		SET two_factor_secret = $1, two_factor_recovery_codes = NULL, two_factor_confirmed_at = NULL,
+			two_factor_last_step = NULL, updated_at = NOW()
+		WHERE id = $2 AND deleted_at IS NULL`
+	_, err := r.db.Exec(query, secret, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set two-factor secret: %w", err)
+	}
+	return nil
+}
+
+// ConfirmTwoFactor turns on two-factor authentication with the stored secret, once a code of
+// time step was checked, and stores the hashes of the recovery codes
+func (r *UserModel) ConfirmTwoFactor(userID int, step int64, recoveryCodeHashes []string) error {
+	codes, err := json.Marshal(recoveryCodeHashes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal recovery codes: %w", err)
+	}
+
+	query := `
+		UPDATE users
+		SET two_factor_confirmed_at = NOW(), two_factor_last_step = $1, two_factor_recovery_codes = $2,
+			updated_at = NOW()
+		WHERE id = $3 AND two_factor_secret IS NOT NULL AND two_factor_confirmed_at IS NULL`
+	result, err := r.db.Exec(query, step, string(codes), userID)
+	if err != nil {
+		return fmt.Errorf("failed to confirm two-factor authentication: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("two-factor authentication already confirmed")
+	}
+	return nil
+}
+
+// UseTwoFactorStep records that the code of time step was used. It returns false when a code
+// of that step, or a later one, was used already.
+func (r *UserModel) UseTwoFactorStep(userID int, step int64) (bool, error) {
+	query := `
+		UPDATE users
+		SET two_factor_last_step = $1
+		WHERE id = $2 AND (two_factor_last_step IS NULL OR two_factor_last_step < $1)`
+	result, err := r.db.Exec(query, step, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to record two-factor code: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// GetRecoveryCodeCount gets how many unused recovery codes a user has
+func (r *UserModel) GetRecoveryCodeCount(userID int) (int, error) {
+	var codes sql.NullString
+	err := r.db.Get(&codes, "SELECT two_factor_recovery_codes FROM users WHERE id = $1", userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get recovery codes: %w", err)
+	}
+
+	hashes, err := parseRecoveryCodes(codes)
+	if err != nil {
+		return 0, err
+	}
+	return len(hashes), nil
+}
+
+// SetRecoveryCodes replaces the recovery codes of a user with the given hashes
+func (r *UserModel) SetRecoveryCodes(userID int, recoveryCodeHashes []string) error {
+	codes, err := json.Marshal(recoveryCodeHashes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal recovery codes: %w", err)
+	}
+
+	query := `UPDATE users SET two_factor_recovery_codes = $1, updated_at = NOW() WHERE id = $2`
+	_, err = r.db.Exec(query, string(codes), userID)
+	if err != nil {
+		return fmt.Errorf("failed to set recovery codes: %w", err)
+	}
+	return nil
+}
+
+// UseRecoveryCode removes the recovery code with hash from a user's codes, so it cannot be
+// used again. It returns false when the user has no such code.
+func (r *UserModel) UseRecoveryCode(userID int, hash string) (bool, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var codes sql.NullString
+	err = tx.Get(&codes, "SELECT two_factor_recovery_codes FROM users WHERE id = $1 FOR UPDATE", userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get recovery codes: %w", err)
+	}
+
+	hashes, err := parseRecoveryCodes(codes)
+	if err != nil {
+		return false, err
+	}
+
+	remaining := make([]string, 0, len(hashes))
+	found := false
+	for _, stored := range hashes {
+		if !found && subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			found = true
+			continue
+		}
+		remaining = append(remaining, stored)
+	}
+	if !found {
+		return false, nil
+	}
+
+	updated, err := json.Marshal(remaining)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal recovery codes: %w", err)
+	}
+	_, err = tx.Exec("UPDATE users SET two_factor_recovery_codes = $1, updated_at = NOW() WHERE id = $2", string(updated), userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update recovery codes: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit recovery codes: %w", err)
+	}
+	return true, nil
+}
+
+// ResetTwoFactor turns off two-factor authentication for a user and removes their secret
+// and recovery codes
+func (r *UserModel) ResetTwoFactor(userID int) error {
+	query := `
+		UPDATE users
+		SET two_factor_secret = NULL, two_factor_recovery_codes = NULL, two_factor_confirmed_at = NULL,
+			two_factor_last_step = NULL, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL`
+	result, err := r.db.Exec(query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to reset two-factor authentication: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+func parseRecoveryCodes(codes sql.NullString) ([]string, error) {
+	hashes := []string{}
+	if !codes.Valid || codes.String == "" {
+		return hashes, nil
+	}
+	if err := json.Unmarshal([]byte(codes.String), &hashes); err != nil {
+		return nil, fmt.Errorf("failed to parse recovery codes: %w", err)
+	}
+	return hashes, nil
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
+)
+
+// admissionSlip is one printed slip
+type admissionSlip struct {
+	Name string
+	Reg  string
+	Code string
+}
+
+var admissionSlipsTemplate = template.Must(template.New("admission-slips").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Admission slips - {{.Delivery}}</title>
+<style>
+	body { font-family: sans-serif; margin: 0; }
+	.slip { box-sizing: border-box; width: 50%; float: left; height: 6.5cm; padding: 0.6cm; border: 1px dashed #999; page-break-inside: avoid; }
+	.exam { font-size: 10pt; color: #444; }
+	.name { font-size: 14pt; font-weight: bold; margin-top: 0.3cm; }
+	.reg { font-size: 10pt; }
+	.code { font-family: monospace; font-size: 20pt; letter-spacing: 0.1em; margin-top: 0.4cm; }
+	.note { font-size: 8pt; color: #444; margin-top: 0.3cm; }
+	@media print { .slip { border-color: #ccc; } }
+</style>
+</head>
+<body>
+{{range .Slips}}<div class="slip">
+	<div class="exam">{{$.Exam}} &middot; {{$.Delivery}}{{if $.ScheduledAt}} &middot; {{$.ScheduledAt}}{{end}}</div>
+	<div class="name">{{.Name}}</div>
+	<div class="reg">{{.Reg}}</div>
+	<div class="code">{{.Code}}</div>
+	<div class="note">Log in with this taker code{{if $.AccessCodeRequired}} and the access code announced in the room{{end}}. Keep it private.</div>
+</div>
+{{end}}</body>
+</html>
+`))
+
+// WriteAdmissionSlips writes printable admission slips for the takers of a delivery, one per
+// taker with a code. Takers whose code was revoked get no slip.
+func WriteAdmissionSlips(w io.Writer, delivery *tables.DeliveryWithDetails, group *tables.Group, takers []tables.TakerCodeSlip, accessCodeRequired bool) error {
+	data := struct {
+		Exam               string
+		Delivery           string
+		ScheduledAt        string
+		AccessCodeRequired bool
+		Slips              []admissionSlip
+	}{
+		Exam:               delivery.Exam.Name,
+		Delivery:           group.Name,
+		AccessCodeRequired: accessCodeRequired,
+	}
+	if delivery.DisplayName != nil && *delivery.DisplayName != "" {
+		data.Delivery = *delivery.DisplayName
+	} else if delivery.Name != nil && *delivery.Name != "" {
+		data.Delivery = *delivery.Name
+	}
+	if delivery.ScheduledAt != nil {
+		data.ScheduledAt = delivery.ScheduledAt.Format(time.RFC1123)
+	}
+
+	for _, taker := range takers {
+		if taker.Code == nil {
+			continue
+		}
+		slip := admissionSlip{
+			Name: taker.Name,
+			Code: utils.FormatTakerCode(*taker.Code, group.TakerCodeGroupSize),
+		}
+		if taker.Reg != nil {
+			slip.Reg = *taker.Reg
+		}
+		data.Slips = append(data.Slips, slip)
+	}
+
+	return admissionSlipsTemplate.Execute(w, data)
+}
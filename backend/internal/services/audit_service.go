@@ -0,0 +1,155 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/config"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// auditIgnoredFields change with every write and say nothing about what was changed
+var auditIgnoredFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+}
+
+// auditGlobalEntities are the records that belong to no client
+var auditGlobalEntities = map[string]bool{
+	tables.AuditEntityUser:   true,
+	tables.AuditEntityRole:   true,
+	tables.AuditEntityClient: true,
+}
+
+// AuditService records who created, updated and deleted records, with the changed fields
+// before and after, and removes entries past the retention period
+type AuditService struct {
+	auditModel *models.AuditModel
+	config     *config.Config
+}
+
+func NewAuditService(auditModel *models.AuditModel, config *config.Config) *AuditService {
+	return &AuditService{
+		auditModel: auditModel,
+		config:     config,
+	}
+}
+
+// Record records a change of a record by actor. before is nil for created records and after
+// for deleted ones. Both are compared by their JSON fields, so fields the API never shows,
+// such as password hashes, are never recorded. Updates changing nothing are not recorded.
+// The change is already made, so failures are logged rather than returned.
+func (s *AuditService) Record(actor tables.AuditActor, entityType string, entityID int, before, after any) {
+	action := tables.AuditActionUpdate
+	switch {
+	case before == nil:
+		action = tables.AuditActionCreate
+	case after == nil:
+		action = tables.AuditActionDelete
+	}
+
+	changes, err := auditChanges(before, after)
+	if err != nil {
+		log.Printf("Failed to record audit entry for %s %d: %v", entityType, entityID, err)
+		return
+	}
+	if action == tables.AuditActionUpdate && len(changes) == 0 {
+		return
+	}
+
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		log.Printf("Failed to record audit entry for %s %d: %v", entityType, entityID, err)
+		return
+	}
+
+	entry := &tables.AuditEntry{
+		ActorName:  actor.Name,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Action:     action,
+		Changes:    changesJSON,
+	}
+	if actor.UserID != 0 {
+		entry.ActorID = &actor.UserID
+	}
+	if actor.ClientID != 0 && !auditGlobalEntities[entityType] {
+		entry.ClientID = &actor.ClientID
+	}
+	if actor.IPAddress != "" {
+		entry.IPAddress = &actor.IPAddress
+	}
+
+	if err := s.auditModel.Create(entry); err != nil {
+		log.Printf("Failed to record audit entry for %s %d: %v", entityType, entityID, err)
+	}
+}
+
+// Cleanup removes the entries older than the retention period, unless entries are kept forever
+func (s *AuditService) Cleanup() error {
+	if s.config.AuditRetentionDays <= 0 {
+		return nil
+	}
+
+	removed, err := s.auditModel.DeleteOlderThan(time.Now().AddDate(0, 0, -s.config.AuditRetentionDays))
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		log.Printf("Removed %d audit entries older than %d days", removed, s.config.AuditRetentionDays)
+	}
+	return nil
+}
+
+// auditChanges compares the JSON fields of a record before and after a change
+func auditChanges(before, after any) (map[string]tables.AuditChange, error) {
+	oldFields, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]tables.AuditChange{}
+	for field, oldValue := range oldFields {
+		if newValue, ok := newFields[field]; !ok || !bytes.Equal(oldValue, newValue) {
+			changes[field] = tables.AuditChange{Old: oldValue, New: newFields[field]}
+		}
+	}
+	for field, newValue := range newFields {
+		if _, ok := oldFields[field]; !ok {
+			changes[field] = tables.AuditChange{New: newValue}
+		}
+	}
+	return changes, nil
+}
+
+// auditFields gets the JSON fields of a record, without the ignored ones and those that are
+// null, so a created or deleted record lists only the fields it has
+func auditFields(record any) (map[string]json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if record == nil {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode record: %w", err)
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to decode record: %w", err)
+	}
+
+	for field, value := range fields {
+		if auditIgnoredFields[field] || bytes.Equal(value, []byte("null")) {
+			delete(fields, field)
+		}
+	}
+	return fields, nil
+}
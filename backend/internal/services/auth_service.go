@@ -1,7 +1,10 @@
 package services
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"time"
 
 	"github.com/medxamion/medxamion/internal/config"
 	"github.com/medxamion/medxamion/internal/models"
@@ -10,28 +13,45 @@ import (
 )
 
 type AuthService struct {
-	userModel    *models.UserModel
-	sessionModel *models.SessionModel
-	config       *config.Config
+	userModel       *models.UserModel
+	sessionModel    *models.SessionModel
+	clientModel     *models.ClientModel
+	authorizer      *Authorizer
+	loginProtection *LoginProtectionService
+	config          *config.Config
 }
 
-func NewAuthService(userModel *models.UserModel, sessionModel *models.SessionModel, config *config.Config) *AuthService {
+func NewAuthService(userModel *models.UserModel, sessionModel *models.SessionModel, clientModel *models.ClientModel, authorizer *Authorizer, loginProtection *LoginProtectionService, config *config.Config) *AuthService {
 	return &AuthService{
-		userModel:    userModel,
-		sessionModel: sessionModel,
-		config:       config,
+		userModel:       userModel,
+		sessionModel:    sessionModel,
+		clientModel:     clientModel,
+		authorizer:      authorizer,
+		loginProtection: loginProtection,
+		config:          config,
 	}
 }
 
-func (s *AuthService) Login(username, password, ipAddress, userAgent string) (*tables.Session, *tables.User, error) {
+// Login checks the credentials of a user and creates their session. When the user has
+// two-factor authentication, or a role requires it, the session is limited until they
+// enter a code or set it up; the returned session data tells which. It is also limited
+// while the user must change their password. After too many failed
+// logins of the username it returns a LoginBlockedError without checking the credentials.
+// The failed logins are only cleared once the session needs no second factor.
+func (s *AuthService) Login(username, password, ipAddress, userAgent string) (*tables.Session, *tables.User, *tables.SessionData, error) {
 	// Debug logging
 	fmt.Printf("DEBUG: Login attempt for username: '%s'\n", username)
 
+	if err := s.loginProtection.Check(tables.LoginScopeUser, username, ipAddress); err != nil {
+		return nil, nil, nil, err
+	}
+
 	// Get user by username
 	user, err := s.userModel.GetByUsername(username)
 	if err != nil {
 		fmt.Printf("DEBUG: User lookup failed: %v\n", err)
-		return nil, nil, fmt.Errorf("invalid credentials")
+		s.loginProtection.RecordFailure(tables.LoginScopeUser, username, ipAddress)
+		return nil, nil, nil, fmt.Errorf("invalid credentials")
 	}
 
 	fmt.Printf("DEBUG: Found user: ID=%d, Username='%s'\n", user.ID, user.Username)
@@ -39,38 +59,48 @@ func (s *AuthService) Login(username, password, ipAddress, userAgent string) (*t
 	// Check password
 	if !utils.CheckPasswordHash(password, user.Password) {
 		fmt.Printf("DEBUG: Password check failed for user %s\n", username)
-		return nil, nil, fmt.Errorf("invalid credentials")
+		s.loginProtection.RecordFailure(tables.LoginScopeUser, username, ipAddress)
+		return nil, nil, nil, fmt.Errorf("invalid credentials")
 	}
 
 	fmt.Printf("DEBUG: Password check passed for user %s\n", username)
 
-	// Get user roles
-	roles, err := s.userModel.GetUserRoles(user.ID)
+	session, user, sessionData, err := s.StartSession(user, ipAddress, userAgent)
 	if err != nil {
-		fmt.Printf("DEBUG: Failed to get user roles for user %d: %v\n", user.ID, err)
-		return nil, nil, fmt.Errorf("failed to get user roles: %w", err)
+		return nil, nil, nil, err
 	}
+	// With two-factor authentication pending, the sign-in succeeds once the code is entered
+	if sessionData.TwoFactorPending == "" {
+		s.loginProtection.RecordSuccess(tables.LoginScopeUser, username, ipAddress)
+	}
+	return session, user, sessionData, nil
+}
 
-	fmt.Printf("DEBUG: Got %d roles for user %s\n", len(roles), username)
-
-	// Create session data
+// StartSession creates the session of a user whose identity was checked, with the same
+// two-factor and password change limits as a password login
+func (s *AuthService) StartSession(user *tables.User, ipAddress, userAgent string) (*tables.Session, *tables.User, *tables.SessionData, error) {
+	// Create session data with the user's roles and permissions
 	sessionData := &tables.SessionData{
 		UserID:   user.ID,
 		Username: user.Username,
 		Email:    user.Email,
 		Name:     user.Name,
-		Roles:    roles,
+	}
+	if err := s.authorizer.Resolve(sessionData); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to resolve user permissions: %w", err)
 	}
 
-	// Create session (this will delete any existing sessions for this user)
-	fmt.Printf("DEBUG: Creating session for user %s\n", username)
-	session, err := s.sessionModel.Create(user.ID, ipAddress, userAgent, sessionData)
-	if err != nil {
-		fmt.Printf("DEBUG: Failed to create session for user %d: %v\n", user.ID, err)
-		return nil, nil, fmt.Errorf("failed to create session: %w", err)
+	sessionData.TwoFactorPending = TwoFactorPending(user, sessionData)
+	sessionData.PasswordChangeRequired = user.MustChangePassword
+	if err := s.resolveClient(sessionData); err != nil {
+		return nil, nil, nil, err
 	}
 
-	fmt.Printf("DEBUG: Session created successfully for user %s, session ID: %s\n", username, session.ID)
+	// Create session (this ends the least recently used sessions beyond the user's limit)
+	session, err := s.sessionModel.Create(user.ID, ipAddress, userAgent, sessionData, s.MaxSessions(sessionData.Roles))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create session: %w", err)
+	}
 
 	// Update last login
 	err = s.userModel.UpdateLastLogin(user.ID)
@@ -79,7 +109,7 @@ func (s *AuthService) Login(username, password, ipAddress, userAgent string) (*t
 		fmt.Printf("Warning: failed to update last login for user %d: %v\n", user.ID, err)
 	}
 
-	return session, user, nil
+	return session, user, sessionData, nil
 }
 
 func (s *AuthService) Logout(sessionID string) error {
@@ -109,6 +139,17 @@ func (s *AuthService) ValidateSession(sessionID string) (*tables.User, *tables.S
 		return nil, nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
+	// Roles and permissions may have changed since login
+	if err := s.authorizer.Resolve(sessionData); err != nil {
+		return nil, nil, err
+	}
+	sessionData.TwoFactorPending = TwoFactorPending(user, sessionData)
+	sessionData.PasswordChangeRequired = user.MustChangePassword
+	// The user may have been removed from the client since
+	if err := s.resolveClient(sessionData); err != nil {
+		return nil, nil, err
+	}
+
 	// Update session activity
 	err = s.sessionModel.UpdateActivity(sessionID)
 	if err != nil {
@@ -119,17 +160,153 @@ func (s *AuthService) ValidateSession(sessionID string) (*tables.User, *tables.S
 	return user, sessionData, nil
 }
 
-func (s *AuthService) HasRole(sessionData *tables.SessionData, roleName string) bool {
-	for _, role := range sessionData.Roles {
-		if role.Name == roleName {
-			return true
+// SwitchClient makes a session work with another client, which the user must work for unless
+// they may manage every client
+func (s *AuthService) SwitchClient(sessionID string, sessionData *tables.SessionData, clientID int) error {
+	allowed, err := s.canUseClient(sessionData, clientID)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("client not found")
+	}
+
+	sessionData.ClientID = clientID
+	return s.sessionModel.UpdateSessionData(sessionID, sessionData)
+}
+
+// resolveClient keeps the client of a session when the user may still use it, and otherwise
+// falls back to the first client they work for. Users who may manage every client fall back
+// to the first client of all.
+func (s *AuthService) resolveClient(sessionData *tables.SessionData) error {
+	if sessionData.ClientID != 0 {
+		allowed, err := s.canUseClient(sessionData, sessionData.ClientID)
+		if err != nil {
+			return err
+		}
+		if allowed {
+			return nil
+		}
+	}
+
+	clientID, err := s.clientModel.FirstIDForUser(sessionData.UserID)
+	if err != nil {
+		return err
+	}
+	if clientID == 0 && sessionData.HasPermission(tables.PermissionClientManage) {
+		if clientID, err = s.clientModel.FirstID(); err != nil {
+			return err
+		}
+	}
+	sessionData.ClientID = clientID
+	return nil
+}
+
+// canUseClient reports whether a session may work with a client
+func (s *AuthService) canUseClient(sessionData *tables.SessionData, clientID int) (bool, error) {
+	if sessionData.HasPermission(tables.PermissionClientManage) {
+		if _, err := s.clientModel.GetByID(clientID); err != nil {
+			if err.Error() == "client not found" {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+	return s.clientModel.IsMember(clientID, sessionData.UserID)
+}
+
+// SessionExists reports whether a session was not signed out, revoked or cleaned up,
+// without counting as activity
+func (s *AuthService) SessionExists(sessionID string) bool {
+	_, err := s.sessionModel.GetByID(sessionID)
+	return err == nil
+}
+
+// MaxSessions returns how many sessions a user with roles may have at the same time, 0 being
+// unlimited. Roles without a limit of their own use the configured default, and the highest
+// limit of the roles applies.
+func (s *AuthService) MaxSessions(roles []tables.Role) int {
+	return maxSessions(s.config, roles)
+}
+
+func maxSessions(config *config.Config, roles []tables.Role) int {
+	if len(roles) == 0 {
+		return config.SessionMaxConcurrent
+	}
+
+	highest := -1
+	for _, role := range roles {
+		limit := config.SessionMaxConcurrent
+		if role.MaxSessions != nil {
+			limit = *role.MaxSessions
+		}
+		if limit == 0 {
+			return 0
 		}
+		if limit > highest {
+			highest = limit
+		}
+	}
+	return highest
+}
+
+// ListSessions lists the sessions of a user, marking currentSessionID as the current one
+func (s *AuthService) ListSessions(userID int, currentSessionID string) ([]tables.SessionInfo, error) {
+	sessions, err := s.sessionModel.ListByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]tables.SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, tables.SessionInfo{
+			ID:           sessionPublicID(session.ID),
+			Device:       utils.DescribeUserAgent(session.UserAgent),
+			UserAgent:    session.UserAgent,
+			IPAddress:    session.IPAddress,
+			CreatedAt:    session.CreatedAt,
+			LastActivity: time.Unix(int64(session.LastActivity), 0),
+			Current:      session.ID == currentSessionID,
+		})
+	}
+	return infos, nil
+}
+
+// RevokeSession ends a session of a user, given its ID from ListSessions
+func (s *AuthService) RevokeSession(userID int, publicID string) error {
+	sessions, err := s.sessionModel.ListByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if sessionPublicID(session.ID) == publicID {
+			return s.sessionModel.Delete(session.ID)
+		}
+	}
+	return fmt.Errorf("session not found")
+}
+
+// RevokeOtherSessions ends every session of a user but the current one, and returns how many
+// were ended
+func (s *AuthService) RevokeOtherSessions(userID int, currentSessionID string) (int, error) {
+	return s.sessionModel.DeleteOthers(userID, currentSessionID)
+}
+
+// EndUserSessions signs a user out everywhere
+func (s *AuthService) EndUserSessions(userID int) error {
+	if _, err := s.userModel.GetByID(userID); err != nil {
+		return fmt.Errorf("user not found")
 	}
-	return false
+	return s.sessionModel.DeleteByUserID(userID)
 }
 
-func (s *AuthService) IsAdmin(sessionData *tables.SessionData) bool {
-	return s.HasRole(sessionData, "administrator")
+// sessionPublicID derives the ID sessions are listed and revoked by, so the session IDs that
+// sign requests in are never shown
+func sessionPublicID(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:8])
 }
 
 func (s *AuthService) CleanupExpiredSessions() error {
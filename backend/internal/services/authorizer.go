@@ -0,0 +1,71 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// Authorizer resolves what users are allowed to do: their roles, and the effective
+// permissions granted by those roles or directly to them
+type Authorizer struct {
+	userModel       *models.UserModel
+	permissionModel *models.PermissionModel
+}
+
+func NewAuthorizer(userModel *models.UserModel, permissionModel *models.PermissionModel) *Authorizer {
+	return &Authorizer{
+		userModel:       userModel,
+		permissionModel: permissionModel,
+	}
+}
+
+// SyncPermissions stores the permission catalog, so roles and users can be granted every
+// permission the API checks. The administrator role gets all of them.
+func (a *Authorizer) SyncPermissions() error {
+	return a.permissionModel.SyncCatalog(tables.PermissionCatalog)
+}
+
+// Resolve sets the current roles and effective permissions of the session's user. It runs on
+// every request, so grants and revocations apply to existing sessions right away.
+func (a *Authorizer) Resolve(sessionData *tables.SessionData) error {
+	roles, err := a.userModel.GetUserRoles(sessionData.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user roles: %w", err)
+	}
+
+	permissions, err := a.permissionModel.GetEffective(sessionData.UserID)
+	if err != nil {
+		return err
+	}
+
+	sessionData.Roles = roles
+	sessionData.Permissions = permissions
+	return nil
+}
+
+// UserAccess gets how a user got their effective permissions
+func (a *Authorizer) UserAccess(userID int) (*tables.UserAccess, error) {
+	roles, err := a.userModel.GetUserRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	direct, err := a.permissionModel.GetUserPermissions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := a.permissionModel.GetEffective(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tables.UserAccess{
+		UserID:            userID,
+		Roles:             roles,
+		DirectPermissions: direct,
+		Permissions:       permissions,
+	}, nil
+}
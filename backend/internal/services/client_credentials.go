@@ -0,0 +1,128 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/utils"
+)
+
+// ClientCredentials identify an enrolled exam-client. The exam-client signs its requests to
+// the coordinator with the secret, and only accepts coordinator calls signed with it.
+type ClientCredentials struct {
+	ClientID string `json:"client_id"`
+	Secret   string `json:"secret"`
+
+	// Nonces of the coordinator calls to every delivery server of the client, so a signed
+	// call cannot be replayed to the same or another delivery
+	nonces *utils.NonceCache
+}
+
+// NewRequest creates a request to the coordinator signed with the client secret
+func (c *ClientCredentials) NewRequest(method, url string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err := utils.SignRequest(req, c.ClientID, c.Secret, body); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// Verify checks that a request was signed by the coordinator with the client secret.
+// Replayed requests are rejected separately with UseNonce.
+func (c *ClientCredentials) Verify(r *http.Request, body []byte, now time.Time) error {
+	if r.Header.Get(utils.HeaderClientID) != c.ClientID {
+		return fmt.Errorf("request is not signed for this exam client")
+	}
+	return utils.VerifyRequestSignature(r, c.Secret, body, now)
+}
+
+// UseNonce records the nonce of a verified coordinator request and returns false when it
+// was already used
+func (c *ClientCredentials) UseNonce(r *http.Request, now time.Time) bool {
+	return c.nonces.Use(r.Header.Get(utils.HeaderNonce), now)
+}
+
+// loadOrEnrollClient reads the credentials saved by an earlier run, or enrolls clientID with
+// the enrollment token and saves the issued credentials
+func loadOrEnrollClient(httpClient *http.Client, coordinatorURL, path, clientID, enrollmentToken string) (*ClientCredentials, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var credentials ClientCredentials
+		if err := json.Unmarshal(data, &credentials); err != nil {
+			return nil, fmt.Errorf("failed to read client credentials %s: %w", path, err)
+		}
+		if credentials.ClientID == "" || credentials.Secret == "" {
+			return nil, fmt.Errorf("client credentials %s are incomplete", path)
+		}
+		credentials.nonces = utils.NewNonceCache()
+		return &credentials, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read client credentials: %w", err)
+	}
+
+	if enrollmentToken == "" {
+		return nil, fmt.Errorf("exam client is not enrolled: set the enrollment token (EXAM_CLIENT_ENROLLMENT_TOKEN)")
+	}
+
+	credentials, err := enrollClient(httpClient, coordinatorURL, clientID, enrollmentToken)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = json.Marshal(credentials)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal client credentials: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save client credentials: %w", err)
+	}
+
+	return credentials, nil
+}
+
+// enrollClient exchanges the enrollment token for the client secret
+func enrollClient(httpClient *http.Client, coordinatorURL, clientID, enrollmentToken string) (*ClientCredentials, error) {
+	data, err := json.Marshal(map[string]string{
+		"client_id":        clientID,
+		"enrollment_token": enrollmentToken,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal enrollment: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/internal/exam-clients/enroll", coordinatorURL)
+	resp, err := httpClient.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to enroll: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("enrollment failed with status: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Data ClientCredentials `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode enrollment: %w", err)
+	}
+	if response.Data.Secret == "" {
+		return nil, fmt.Errorf("enrollment returned no secret")
+	}
+
+	response.Data.nonces = utils.NewNonceCache()
+	return &response.Data, nil
+}
@@ -0,0 +1,481 @@
+package services
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// Score bands used to condition option probabilities on ability (g2 assumes the
+// copier is compared with candidates of similar ability)
+const (
+	maxCollusionScoreBands      = 5
+	minCandidatesPerScoreBand   = 10
+	minResponsesForBandEstimate = 5
+)
+
+// storedCollusionAnalysis holds the parameters of the analysis stored when a delivery
+// closes: the defaults of an on-demand analysis, keeping the most pairs a request may ask for
+var storedCollusionAnalysis = tables.CollusionAnalysisRequest{
+	Threshold:          3.09,
+	ProximityThreshold: 2.33,
+	MinCommonItems:     10,
+	Limit:              1000,
+}
+
+// CollusionService detects pairs of candidates with unusually similar answer patterns
+type CollusionService struct {
+	attemptModel *models.AttemptModel
+	reportModel  *models.CollusionReportModel
+}
+
+// candidatePattern is the answer pattern of one attempt
+type candidatePattern struct {
+	attemptID int
+	takerName string
+	takerCode string
+	ipAddress string
+	answers   map[int]string
+	incorrect map[int]bool // only questions with known correctness
+	score     int
+	band      int
+}
+
+// optionStats counts how often each answer was chosen per question
+type optionStats struct {
+	counts map[int]map[string]int
+	totals map[int]int
+}
+
+func newOptionStats() *optionStats {
+	return &optionStats{
+		counts: make(map[int]map[string]int),
+		totals: make(map[int]int),
+	}
+}
+
+func (o *optionStats) add(questionID int, answer string) {
+	if o.counts[questionID] == nil {
+		o.counts[questionID] = make(map[string]int)
+	}
+	o.counts[questionID][answer]++
+	o.totals[questionID]++
+}
+
+// NewCollusionService creates a new collusion detection service
+func NewCollusionService(attemptModel *models.AttemptModel, reportModel *models.CollusionReportModel) *CollusionService {
+	return &CollusionService{attemptModel: attemptModel, reportModel: reportModel}
+}
+
+// Analyze runs the collusion analysis over all attempts of a delivery
+func (s *CollusionService) Analyze(deliveryID int, req tables.CollusionAnalysisRequest) (*tables.CollusionReport, error) {
+	responses, err := s.attemptModel.GetDeliveryResponses(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := AnalyzeResponsePatterns(responses, req)
+	report.DeliveryID = deliveryID
+	return report, nil
+}
+
+// AnalyzeAndStore runs the collusion analysis of a delivery with the default parameters
+// and stores the report, replacing the one stored before
+func (s *CollusionService) AnalyzeAndStore(deliveryID int) (*tables.CollusionReport, error) {
+	report, err := s.Analyze(deliveryID, storedCollusionAnalysis)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.reportModel.Save(report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// GetStoredReport gets the collusion report stored for a delivery
+func (s *CollusionService) GetStoredReport(deliveryID int) (*tables.CollusionReport, error) {
+	return s.reportModel.Get(deliveryID)
+}
+
+// AnalyzeResponsePatterns ranks candidate pairs by two established answer-copying indices:
+//
+//   - g2 (Frary, Tideman & Watts, 1977): the number of identical answers compared with the
+//     number expected from how popular each option was among candidates of similar score.
+//   - Angoff's B (1974): the number of identical incorrect answers compared with the number
+//     predicted, across all pairs, from the product of the two candidates' incorrect counts.
+//
+// Pairs that shared an IP address or a subnet are flagged at a lower threshold.
+func AnalyzeResponsePatterns(responses []tables.CandidateResponse, req tables.CollusionAnalysisRequest) *tables.CollusionReport {
+	candidates := buildCandidatePatterns(responses)
+	assignScoreBands(candidates)
+
+	overall := newOptionStats()
+	bandStats := make(map[int]*optionStats)
+	items := make(map[int]bool)
+	for _, c := range candidates {
+		if bandStats[c.band] == nil {
+			bandStats[c.band] = newOptionStats()
+		}
+		for questionID, answer := range c.answers {
+			overall.add(questionID, answer)
+			bandStats[c.band].add(questionID, answer)
+			items[questionID] = true
+		}
+	}
+
+	pairs := []tables.CollusionPair{}
+	errorProducts := []float64{}
+	for i := 0; i < len(candidates); i++ {
+		for j := i + 1; j < len(candidates); j++ {
+			pair, errorProduct, ok := comparePatterns(candidates[i], candidates[j], overall, bandStats, req.MinCommonItems)
+			if !ok {
+				continue
+			}
+			pairs = append(pairs, pair)
+			errorProducts = append(errorProducts, errorProduct)
+		}
+	}
+
+	applyAngoffB(pairs, errorProducts)
+
+	for i := range pairs {
+		pair := &pairs[i]
+		pair.Index = math.Max(pair.G2, pair.AngoffB)
+		proximate := pair.SameIP || pair.SameSubnet
+		pair.Flagged = pair.Index >= req.Threshold || (proximate && pair.Index >= req.ProximityThreshold)
+		pair.Evidence = buildCollusionEvidence(pair)
+	}
+
+	pairsAnalyzed := len(pairs)
+
+	sort.SliceStable(pairs, func(a, b int) bool {
+		if pairs[a].Index != pairs[b].Index {
+			return pairs[a].Index > pairs[b].Index
+		}
+		return pairs[a].IdenticalIncorrect > pairs[b].IdenticalIncorrect
+	})
+
+	if req.FlaggedOnly {
+		flagged := []tables.CollusionPair{}
+		for _, pair := range pairs {
+			if pair.Flagged {
+				flagged = append(flagged, pair)
+			}
+		}
+		pairs = flagged
+	}
+	if req.Limit > 0 && len(pairs) > req.Limit {
+		pairs = pairs[:req.Limit]
+	}
+
+	return &tables.CollusionReport{
+		Candidates:         len(candidates),
+		Items:              len(items),
+		PairsAnalyzed:      pairsAnalyzed,
+		Threshold:          req.Threshold,
+		ProximityThreshold: req.ProximityThreshold,
+		MinCommonItems:     req.MinCommonItems,
+		Pairs:              pairs,
+		GeneratedAt:        time.Now(),
+	}
+}
+
+// buildCandidatePatterns groups responses by attempt, preserving attempt order
+func buildCandidatePatterns(responses []tables.CandidateResponse) []*candidatePattern {
+	byAttempt := make(map[int]*candidatePattern)
+	candidates := []*candidatePattern{}
+
+	for _, response := range responses {
+		c, exists := byAttempt[response.AttemptID]
+		if !exists {
+			c = &candidatePattern{
+				attemptID: response.AttemptID,
+				takerName: response.TakerName,
+				takerCode: response.TakerCode,
+				ipAddress: response.IPAddress,
+				answers:   make(map[int]string),
+				incorrect: make(map[int]bool),
+			}
+			byAttempt[response.AttemptID] = c
+			candidates = append(candidates, c)
+		}
+
+		c.answers[response.QuestionID] = normalizeAnswer(response.Answer)
+		if response.IsCorrect != nil {
+			c.incorrect[response.QuestionID] = !*response.IsCorrect
+			if *response.IsCorrect {
+				c.score++
+			}
+		}
+	}
+
+	return candidates
+}
+
+// assignScoreBands splits candidates into equally sized score bands
+func assignScoreBands(candidates []*candidatePattern) {
+	bands := len(candidates) / minCandidatesPerScoreBand
+	if bands > maxCollusionScoreBands {
+		bands = maxCollusionScoreBands
+	}
+	if bands < 1 {
+		bands = 1
+	}
+
+	ranked := make([]*candidatePattern, len(candidates))
+	copy(ranked, candidates)
+	sort.SliceStable(ranked, func(a, b int) bool { return ranked[a].score < ranked[b].score })
+
+	for rank, c := range ranked {
+		c.band = rank * bands / len(ranked)
+	}
+}
+
+// comparePatterns computes the pair statistics except Angoff's B, which needs all pairs
+func comparePatterns(a, b *candidatePattern, overall *optionStats, bandStats map[int]*optionStats, minCommonItems int) (tables.CollusionPair, float64, bool) {
+	pair := tables.CollusionPair{
+		AttemptA:                    a.attemptID,
+		AttemptB:                    b.attemptID,
+		TakerA:                      a.takerName,
+		TakerB:                      b.takerName,
+		TakerCodeA:                  a.takerCode,
+		TakerCodeB:                  b.takerCode,
+		IdenticalIncorrectQuestions: []int{},
+	}
+
+	questionIDs := make([]int, 0, len(a.answers))
+	for questionID := range a.answers {
+		if _, ok := b.answers[questionID]; ok {
+			questionIDs = append(questionIDs, questionID)
+		}
+	}
+	if len(questionIDs) < minCommonItems {
+		return pair, 0, false
+	}
+	sort.Ints(questionIDs)
+	pair.CommonItems = len(questionIDs)
+
+	for _, questionID := range questionIDs {
+		answerA, answerB := a.answers[questionID], b.answers[questionID]
+		wrongA, knownA := a.incorrect[questionID]
+		wrongB, knownB := b.incorrect[questionID]
+
+		if knownA && wrongA {
+			pair.IncorrectA++
+		}
+		if knownB && wrongB {
+			pair.IncorrectB++
+		}
+		if answerA == answerB {
+			pair.IdenticalAnswers++
+			if knownA && knownB && wrongA && wrongB {
+				pair.IdenticalIncorrect++
+				pair.IdenticalIncorrectQuestions = append(pair.IdenticalIncorrectQuestions, questionID)
+			}
+		}
+	}
+
+	// g2 is directional (who copied from whom), keep the stronger direction
+	pair.G2 = math.Max(
+		g2Index(a, b, questionIDs, pair.IdenticalAnswers, overall, bandStats),
+		g2Index(b, a, questionIDs, pair.IdenticalAnswers, overall, bandStats),
+	)
+	pair.G2PValue = upperTailProbability(pair.G2)
+
+	pair.SameIP = a.ipAddress != "" && a.ipAddress == b.ipAddress
+	pair.SameSubnet = !pair.SameIP && sameSubnet(a.ipAddress, b.ipAddress)
+
+	return pair, float64(pair.IncorrectA * pair.IncorrectB), true
+}
+
+// g2Index standardizes the identical-answer count for copier c and source s
+func g2Index(c, s *candidatePattern, questionIDs []int, identical int, overall *optionStats, bandStats map[int]*optionStats) float64 {
+	expected, variance := 0.0, 0.0
+	for _, questionID := range questionIDs {
+		p := optionProbability(c, questionID, s.answers[questionID], overall, bandStats[c.band])
+		expected += p
+		variance += p * (1 - p)
+	}
+	if variance <= 0 {
+		return 0
+	}
+	return (float64(identical) - expected) / math.Sqrt(variance)
+}
+
+// optionProbability estimates how likely candidate c is to choose answer on a question,
+// excluding c's own response and smoothing so unseen options keep a small probability
+func optionProbability(c *candidatePattern, questionID int, answer string, overall, band *optionStats) float64 {
+	stats := overall
+	if band != nil && band.totals[questionID]-1 >= minResponsesForBandEstimate {
+		stats = band
+	}
+
+	count := float64(stats.counts[questionID][answer])
+	total := float64(stats.totals[questionID])
+	if own, ok := c.answers[questionID]; ok {
+		total--
+		if own == answer {
+			count--
+		}
+	}
+
+	options := float64(len(overall.counts[questionID]) + 1)
+	return (count + 0.5) / (total + 0.5*options)
+}
+
+// applyAngoffB regresses identical incorrect answers on the product of incorrect counts
+// over all pairs and standardizes each pair's residual
+func applyAngoffB(pairs []tables.CollusionPair, errorProducts []float64) {
+	n := float64(len(pairs))
+	if n < 3 {
+		return
+	}
+
+	var sumX, sumY, sumXX, sumXY float64
+	for i, pair := range pairs {
+		x, y := errorProducts[i], float64(pair.IdenticalIncorrect)
+		sumX += x
+		sumY += y
+		sumXX += x * x
+		sumXY += x * y
+	}
+
+	meanX, meanY := sumX/n, sumY/n
+	slope := 0.0
+	if denominator := sumXX - n*meanX*meanX; denominator > 0 {
+		slope = (sumXY - n*meanX*meanY) / denominator
+	}
+	intercept := meanY - slope*meanX
+
+	var residualSquares float64
+	for i, pair := range pairs {
+		residual := float64(pair.IdenticalIncorrect) - (intercept + slope*errorProducts[i])
+		residualSquares += residual * residual
+	}
+	sd := math.Sqrt(residualSquares / (n - 2))
+	if sd == 0 {
+		return
+	}
+
+	for i := range pairs {
+		predicted := intercept + slope*errorProducts[i]
+		pairs[i].AngoffB = (float64(pairs[i].IdenticalIncorrect) - predicted) / sd
+		pairs[i].AngoffBPValue = upperTailProbability(pairs[i].AngoffB)
+	}
+}
+
+// buildCollusionEvidence summarizes why a pair stands out
+func buildCollusionEvidence(pair *tables.CollusionPair) []string {
+	evidence := []string{
+		fmt.Sprintf("%d of %d common answers identical", pair.IdenticalAnswers, pair.CommonItems),
+	}
+	if pair.IdenticalIncorrect > 0 {
+		evidence = append(evidence, fmt.Sprintf("%d identical incorrect answers (questions %s)",
+			pair.IdenticalIncorrect, joinInts(pair.IdenticalIncorrectQuestions, ", ")))
+	}
+	evidence = append(evidence,
+		fmt.Sprintf("g2 = %.2f (p = %.4f)", pair.G2, pair.G2PValue),
+		fmt.Sprintf("Angoff B = %.2f (p = %.4f)", pair.AngoffB, pair.AngoffBPValue),
+	)
+	if pair.SameIP {
+		evidence = append(evidence, "same IP address")
+	}
+	if pair.SameSubnet {
+		evidence = append(evidence, "same subnet")
+	}
+	return evidence
+}
+
+// WriteCollusionCSV writes a collusion report as CSV, one ranked pair per row
+func WriteCollusionCSV(w io.Writer, report *tables.CollusionReport) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{
+		"rank", "attempt_a", "taker_a", "taker_code_a", "attempt_b", "taker_b", "taker_code_b",
+		"common_items", "identical_answers", "identical_incorrect", "incorrect_a", "incorrect_b",
+		"g2", "g2_p_value", "angoff_b", "angoff_b_p_value", "index",
+		"same_ip", "same_subnet", "flagged",
+		"identical_incorrect_questions", "evidence",
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for i, pair := range report.Pairs {
+		row := []string{
+			strconv.Itoa(i + 1),
+			strconv.Itoa(pair.AttemptA), csvSafe(pair.TakerA), csvSafe(pair.TakerCodeA),
+			strconv.Itoa(pair.AttemptB), csvSafe(pair.TakerB), csvSafe(pair.TakerCodeB),
+			strconv.Itoa(pair.CommonItems),
+			strconv.Itoa(pair.IdenticalAnswers),
+			strconv.Itoa(pair.IdenticalIncorrect),
+			strconv.Itoa(pair.IncorrectA),
+			strconv.Itoa(pair.IncorrectB),
+			strconv.FormatFloat(pair.G2, 'f', 3, 64),
+			strconv.FormatFloat(pair.G2PValue, 'g', 4, 64),
+			strconv.FormatFloat(pair.AngoffB, 'f', 3, 64),
+			strconv.FormatFloat(pair.AngoffBPValue, 'g', 4, 64),
+			strconv.FormatFloat(pair.Index, 'f', 3, 64),
+			strconv.FormatBool(pair.SameIP),
+			strconv.FormatBool(pair.SameSubnet),
+			strconv.FormatBool(pair.Flagged),
+			joinInts(pair.IdenticalIncorrectQuestions, ";"),
+			strings.Join(pair.Evidence, "; "),
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvSafe prefixes text cells a spreadsheet would evaluate as a formula with a quote
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// normalizeAnswer makes answers comparable regardless of case and surrounding whitespace
+func normalizeAnswer(answer string) string {
+	return strings.ToUpper(strings.TrimSpace(answer))
+}
+
+// upperTailProbability returns P(Z >= z) for a standard normal variable
+func upperTailProbability(z float64) float64 {
+	return 0.5 * math.Erfc(z/math.Sqrt2)
+}
+
+// sameSubnet reports whether two addresses share a /24 (IPv4) or /64 (IPv6) network
+func sameSubnet(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return false
+	}
+	if ipA.To4() != nil && ipB.To4() != nil {
+		mask := net.CIDRMask(24, 32)
+		return ipA.To4().Mask(mask).Equal(ipB.To4().Mask(mask))
+	}
+	mask := net.CIDRMask(64, 128)
+	return ipA.Mask(mask).Equal(ipB.Mask(mask))
+}
+
+func joinInts(values []int, separator string) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = strconv.Itoa(value)
+	}
+	return strings.Join(parts, separator)
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
+)
+
+// keyPollInterval is how often an exam-client asks for the delivery key once the delivery is due
+const keyPollInterval = time.Second
+
+// errKeyNotReleased is returned while the coordinator holds back the delivery key
+var errKeyNotReleased = errors.New("delivery key is not released yet")
+
+// errClosedBeforeStart is returned when a staged delivery closed before its key was released
+var errClosedBeforeStart = errors.New("delivery closed before its key was released")
+
+// awaitDeliveryKey waits for the scheduled start of a staged delivery, fetches the delivery
+// key and unpacks the staged exam content with it. It returns when the key was set or the
+// delivery was cancelled or closed (finishAt, zero for none).
+func (s *ExamClientService) awaitDeliveryKey(delivery *DeliveryInstance, releaseAt, finishAt time.Time, digest string) error {
+	if wait := time.Until(releaseAt); wait > 0 {
+		log.Printf("Delivery %d staged, waiting %s for its key", delivery.ID, wait.Round(time.Second))
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-delivery.Context.Done():
+			timer.Stop()
+			return delivery.Context.Err()
+		}
+	}
+
+	ticker := time.NewTicker(keyPollInterval)
+	defer ticker.Stop()
+
+	reported := delivery.stagingReported
+	for {
+		if !finishAt.IsZero() && time.Now().After(finishAt) {
+			return errClosedBeforeStart
+		}
+
+		// The coordinator only releases the key to a client that reported the content staged
+		if !reported {
+			if err := s.reportStaging(delivery.ID, tables.StagingStatusStaged, digest, ""); err != nil {
+				log.Printf("Failed to report staging of delivery %d: %v", delivery.ID, err)
+			} else {
+				reported = true
+			}
+		}
+
+		if reported {
+			key, err := s.fetchDeliveryKey(delivery.ID)
+			if err == nil {
+				delivery.Database.SetKey(key)
+				utils.WipeKey(key)
+
+				questions, err := delivery.Database.UnpackStagedContent()
+				if err != nil {
+					return fmt.Errorf("failed to unpack staged content: %w", err)
+				}
+				log.Printf("Unpacked %d encrypted questions for delivery %d", questions, delivery.ID)
+				return nil
+			}
+			if err != errKeyNotReleased {
+				log.Printf("Failed to fetch key of delivery %d: %v", delivery.ID, err)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-delivery.Context.Done():
+			return delivery.Context.Err()
+		}
+	}
+}
+
+// reportStaging tells the coordinator that the content of a delivery was staged, or why not
+func (s *ExamClientService) reportStaging(deliveryID int, status, digest, reason string) error {
+	data, err := json.Marshal(tables.StagingReportRequest{
+		Status:        status,
+		ContentDigest: digest,
+		Error:         reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/api/internal/exam-clients/%s/deliveries/%d/staging", s.coordinatorURL, s.clientID, deliveryID)
+	resp, err := s.coordinatorRequest(http.MethodPost, url, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("staging report failed with status %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// fetchDeliveryKey gets the delivery key released by the coordinator and unwraps it with the
+// client secret
+func (s *ExamClientService) fetchDeliveryKey(deliveryID int) ([]byte, error) {
+	url := fmt.Sprintf("%s/api/internal/exam-clients/%s/deliveries/%d/key", s.coordinatorURL, s.clientID, deliveryID)
+	resp, err := s.coordinatorRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusConflict:
+		return nil, errKeyNotReleased
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("key request failed with status %d: %s", resp.StatusCode, body)
+	}
+
+	var released tables.ReleasedDeliveryKey
+	if err := json.NewDecoder(resp.Body).Decode(&released); err != nil {
+		return nil, fmt.Errorf("failed to decode delivery key: %w", err)
+	}
+	return utils.UnwrapDeliveryKey(s.credentials.Secret, deliveryID, released.DeliveryKey)
+}
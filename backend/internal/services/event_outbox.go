@@ -0,0 +1,239 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	outboxBaseDelay    = time.Second
+	outboxMaxDelay     = 2 * time.Minute
+	outboxPollInterval = 200 * time.Millisecond
+)
+
+// EventOutbox sends the events and the final export of a delivery to the coordinator. Entries
+// are stored in the delivery's SQLite database before they are sent, so they survive
+// coordinator outages and exam-client restarts, and are sent one at a time in the order they
+// were queued. A failed send is retried with exponential backoff; an entry the coordinator
+// rejects as invalid is discarded so it does not block the entries after it. Every entry
+// carries an event ID the coordinator uses to ignore retries it already processed.
+type EventOutbox struct {
+	db             *ExamDeliveryDB
+	coordinatorURL string
+	credentials    *ClientCredentials
+	httpClient     *http.Client
+
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// outboxRejectedError is a send the coordinator refused and that would fail again if retried
+type outboxRejectedError struct {
+	status int
+	body   string
+}
+
+func (e *outboxRejectedError) Error() string {
+	return fmt.Sprintf("coordinator rejected entry with status %d: %s", e.status, e.body)
+}
+
+// NewEventOutbox creates the outbox of a delivery database
+func NewEventOutbox(db *ExamDeliveryDB, coordinatorURL string, credentials *ClientCredentials) *EventOutbox {
+	return &EventOutbox{
+		db:             db,
+		coordinatorURL: coordinatorURL,
+		credentials:    credentials,
+		httpClient:     &http.Client{Timeout: 30 * time.Second},
+		wake:           make(chan struct{}, 1),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+}
+
+// Start begins sending queued entries
+func (o *EventOutbox) Start() {
+	go o.run()
+}
+
+// Stop stops sending and waits for the send in progress. Unsent entries stay in the database.
+func (o *EventOutbox) Stop() {
+	o.stopOnce.Do(func() { close(o.stop) })
+	<-o.done
+}
+
+// Enqueue queues a payload to be POSTed to a coordinator path. The payload is given an
+// event_id field, which is returned.
+func (o *EventOutbox) Enqueue(path string, payload map[string]interface{}) (string, error) {
+	eventID := uuid.NewString()
+	payload["event_id"] = eventID
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal outbox entry: %w", err)
+	}
+
+	if err := o.db.EnqueueOutbox(eventID, path, data); err != nil {
+		return "", fmt.Errorf("failed to queue outbox entry: %w", err)
+	}
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return eventID, nil
+}
+
+// Backlog counts the entries waiting to be sent
+func (o *EventOutbox) Backlog() int {
+	count, err := o.db.OutboxBacklog()
+	if err != nil {
+		log.Printf("Failed to count outbox backlog of delivery %d: %v", o.db.deliveryID, err)
+		return 0
+	}
+	return count
+}
+
+// Flush waits until every queued entry was sent or discarded. It returns false when the
+// timeout expires or the outbox is stopped first.
+func (o *EventOutbox) Flush(timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if count, err := o.db.OutboxBacklog(); err == nil && count == 0 {
+			return true
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			return false
+		case <-o.stop:
+			return false
+		}
+	}
+}
+
+func (o *EventOutbox) run() {
+	defer close(o.done)
+
+	failures := 0
+	for {
+		entry, err := o.db.NextOutboxEntry()
+		if err != nil {
+			log.Printf("Failed to read outbox of delivery %d: %v", o.db.deliveryID, err)
+			if !o.sleep(outboxBaseDelay) {
+				return
+			}
+			continue
+		}
+
+		if entry == nil {
+			select {
+			case <-o.wake:
+				continue
+			case <-o.stop:
+				return
+			}
+		}
+
+		err = o.send(entry)
+		if err == nil {
+			failures = 0
+			if err := o.db.MarkOutboxSent(entry.ID); err != nil {
+				log.Printf("Failed to mark outbox entry %s sent: %v", entry.EventID, err)
+			}
+			continue
+		}
+
+		var rejected *outboxRejectedError
+		if errors.As(err, &rejected) {
+			log.Printf("Discarding outbox entry %s of delivery %d: %v", entry.EventID, o.db.deliveryID, err)
+			if err := o.db.DiscardOutboxEntry(entry.ID, rejected); err != nil {
+				log.Printf("Failed to discard outbox entry %s: %v", entry.EventID, err)
+			}
+			continue
+		}
+
+		failures++
+		delay := outboxBackoff(failures)
+		log.Printf("Failed to send outbox entry %s of delivery %d (attempt %d), retrying in %s: %v",
+			entry.EventID, o.db.deliveryID, entry.Attempts+1, delay, err)
+		if err := o.db.RecordOutboxFailure(entry.ID, err); err != nil {
+			log.Printf("Failed to record outbox failure of %s: %v", entry.EventID, err)
+		}
+		if !o.sleep(delay) {
+			return
+		}
+	}
+}
+
+// send POSTs an entry to the coordinator, signed when it is sent (not when it was queued)
+// so retries get a fresh timestamp
+func (o *EventOutbox) send(entry *OutboxEntry) error {
+	req, err := o.credentials.NewRequest(http.MethodPost, o.coordinatorURL+entry.Path, entry.Payload)
+	if err != nil {
+		return err
+	}
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && !outboxRetryStatus(resp.StatusCode) {
+		return &outboxRejectedError{status: resp.StatusCode, body: string(body)}
+	}
+	return fmt.Errorf("coordinator returned status %d: %s", resp.StatusCode, body)
+}
+
+// outboxRetryStatus reports client error statuses that are retried. Authentication failures
+// (clock skew, a revoked client) are retried rather than losing the entry.
+func outboxRetryStatus(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
+
+// sleep waits for a delay and returns false when the outbox is stopped first
+func (o *EventOutbox) sleep(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-o.stop:
+		return false
+	}
+}
+
+// outboxBackoff doubles the delay after every consecutive failure, up to outboxMaxDelay
+func outboxBackoff(failures int) time.Duration {
+	delay := outboxBaseDelay
+	for i := 1; i < failures && delay < outboxMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxDelay {
+		delay = outboxMaxDelay
+	}
+	return delay
+}
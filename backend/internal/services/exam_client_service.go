@@ -1,15 +1,17 @@
 package services
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
+
+	"github.com/medxamion/medxamion/internal/tables"
 )
 
 // ExamClientService manages multiple exam deliveries on a worker node
@@ -21,6 +23,10 @@ type ExamClientService struct {
 	maxDeliveries  int
 	dataDir        string // Directory for SQLite databases
 
+	// Enrollment with the coordinator
+	enrollmentToken string
+	credentials     *ClientCredentials
+
 	// Running deliveries
 	deliveries    map[int]*DeliveryInstance
 	deliveriesMux sync.RWMutex
@@ -29,6 +35,10 @@ type ExamClientService struct {
 	httpClient *http.Client
 	stopChan   chan struct{}
 
+	// Outboxes of finished deliveries that still have entries to send
+	draining    map[*EventOutbox]bool
+	drainingMux sync.Mutex
+
 	// Stats
 	totalProcessed int
 	startTime      time.Time
@@ -48,7 +58,10 @@ type DeliveryInstance struct {
 	// New fields for SQLite database and HTTP server
 	Database *ExamDeliveryDB     `json:"-"`
 	Server   *ExamDeliveryServer `json:"-"`
+	Outbox   *EventOutbox        `json:"-"`
 	DataDir  string              `json:"-"`
+
+	stagingReported bool
 }
 
 // ClientRegistration represents the data sent when registering with coordinator
@@ -69,6 +82,7 @@ type ClientStatus struct {
 	TotalProcessed   int                 `json:"total_processed"`
 	Uptime           int64               `json:"uptime"`
 	Deliveries       []*DeliveryInstance `json:"deliveries"`
+	OutboxBacklog    int                 `json:"outbox_backlog"` // events and exports not yet sent to the coordinator
 }
 
 // DeliveryAssignment represents a delivery assigned by the coordinator
@@ -79,8 +93,9 @@ type DeliveryAssignment struct {
 	Config       map[string]interface{} `json:"config"`
 }
 
-// NewExamClientService creates a new exam client service
-func NewExamClientService(coordinatorURL string, maxDeliveries int) *ExamClientService {
+// NewExamClientService creates a new exam client service. The enrollment token is only used
+// when the client has no saved credentials yet.
+func NewExamClientService(coordinatorURL string, maxDeliveries int, enrollmentToken string) *ExamClientService {
 	hostname, _ := os.Hostname()
 	clientID := fmt.Sprintf("exam-client-%s-%d", hostname, time.Now().Unix())
 
@@ -92,16 +107,18 @@ func NewExamClientService(coordinatorURL string, maxDeliveries int) *ExamClientS
 	}
 
 	return &ExamClientService{
-		coordinatorURL: coordinatorURL,
-		clientID:       clientID,
-		clientIP:       getLocalIP(),
-		port:           8234, // Default port for exam-client
-		maxDeliveries:  maxDeliveries,
-		dataDir:        dataDir,
-		deliveries:     make(map[int]*DeliveryInstance),
-		httpClient:     &http.Client{Timeout: 30 * time.Second},
-		stopChan:       make(chan struct{}),
-		startTime:      time.Now(),
+		coordinatorURL:  coordinatorURL,
+		clientID:        clientID,
+		clientIP:        getLocalIP(),
+		port:            8234, // Default port for exam-client
+		maxDeliveries:   maxDeliveries,
+		dataDir:         dataDir,
+		enrollmentToken: enrollmentToken,
+		deliveries:      make(map[int]*DeliveryInstance),
+		draining:        make(map[*EventOutbox]bool),
+		httpClient:      &http.Client{Timeout: 30 * time.Second},
+		stopChan:        make(chan struct{}),
+		startTime:       time.Now(),
 	}
 }
 
@@ -111,11 +128,22 @@ func (s *ExamClientService) Start(ctx context.Context) error {
 	log.Printf("Coordinator URL: %s", s.coordinatorURL)
 	log.Printf("Max deliveries: %d", s.maxDeliveries)
 
+	// Load the client credentials, enrolling on first start
+	credentials, err := loadOrEnrollClient(s.httpClient, s.coordinatorURL, filepath.Join(s.dataDir, "client_credentials.json"), s.clientID, s.enrollmentToken)
+	if err != nil {
+		return fmt.Errorf("failed to enroll with coordinator: %w", err)
+	}
+	s.credentials = credentials
+	s.clientID = credentials.ClientID
+
 	// Register with coordinator
 	if err := s.registerWithCoordinator(); err != nil {
 		return fmt.Errorf("failed to register with coordinator: %w", err)
 	}
 
+	// Send what earlier runs left in their outboxes
+	s.resumeOutboxes()
+
 	// Start status reporting loop
 	go s.statusReportingLoop(ctx)
 
@@ -159,7 +187,7 @@ func (s *ExamClientService) registerWithCoordinator() error {
 	}
 
 	url := fmt.Sprintf("%s/api/internal/exam-clients/register", s.coordinatorURL)
-	resp, err := s.httpClient.Post(url, "application/json", bytes.NewBuffer(data))
+	resp, err := s.coordinatorRequest(http.MethodPost, url, data)
 	if err != nil {
 		return fmt.Errorf("failed to register: %w", err)
 	}
@@ -173,6 +201,15 @@ func (s *ExamClientService) registerWithCoordinator() error {
 	return nil
 }
 
+// coordinatorRequest sends a request to the coordinator signed with the client secret
+func (s *ExamClientService) coordinatorRequest(method, url string, body []byte) (*http.Response, error) {
+	req, err := s.credentials.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	return s.httpClient.Do(req)
+}
+
 // statusReportingLoop periodically reports status to coordinator
 func (s *ExamClientService) statusReportingLoop(ctx context.Context) {
 	ticker := time.NewTicker(30 * time.Second) // Report every 30 seconds
@@ -223,6 +260,7 @@ func (s *ExamClientService) reportStatus() {
 		TotalProcessed:   s.totalProcessed,
 		Uptime:           int64(time.Since(s.startTime).Seconds()),
 		Deliveries:       deliveries,
+		OutboxBacklog:    s.outboxBacklog(deliveries),
 	}
 
 	data, err := json.Marshal(status)
@@ -231,17 +269,59 @@ func (s *ExamClientService) reportStatus() {
 		return
 	}
 
+	// Retry with backoff; a status that could not be sent is replaced by the next report
 	url := fmt.Sprintf("%s/api/internal/exam-clients/%s/status", s.coordinatorURL, s.clientID)
-	resp, err := s.httpClient.Post(url, "application/json", bytes.NewBuffer(data))
+	for attempt := 1; ; attempt++ {
+		err := s.postStatus(url, data)
+		if err == nil {
+			return
+		}
+		if attempt == statusReportAttempts {
+			log.Printf("Failed to report status after %d attempts: %v", attempt, err)
+			return
+		}
+
+		select {
+		case <-time.After(outboxBackoff(attempt)):
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// statusReportAttempts limits the retries of one status report
+const statusReportAttempts = 4
+
+// postStatus sends one status report
+func (s *ExamClientService) postStatus(url string, data []byte) error {
+	resp, err := s.coordinatorRequest(http.MethodPost, url, data)
 	if err != nil {
-		log.Printf("Failed to report status: %v", err)
-		return
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("Status report failed with status: %d", resp.StatusCode)
+		return fmt.Errorf("status report failed with status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// outboxBacklog counts the unsent entries of the running and finished deliveries
+func (s *ExamClientService) outboxBacklog(deliveries []*DeliveryInstance) int {
+	backlog := 0
+	for _, delivery := range deliveries {
+		if delivery.Outbox != nil {
+			backlog += delivery.Outbox.Backlog()
+		}
+	}
+
+	s.drainingMux.Lock()
+	for outbox := range s.draining {
+		backlog += outbox.Backlog()
 	}
+	s.drainingMux.Unlock()
+
+	return backlog
 }
 
 // pollForWork checks coordinator for new delivery assignments
@@ -256,7 +336,7 @@ func (s *ExamClientService) pollForWork() {
 	}
 
 	url := fmt.Sprintf("%s/api/internal/exam-clients/%s/assignments", s.coordinatorURL, s.clientID)
-	resp, err := s.httpClient.Get(url)
+	resp, err := s.coordinatorRequest(http.MethodGet, url, nil)
 	if err != nil {
 		log.Printf("Failed to poll for work: %v", err)
 		return
@@ -294,12 +374,33 @@ func (s *ExamClientService) startDelivery(assignment *DeliveryAssignment) error
 		return fmt.Errorf("delivery %d already running", assignment.DeliveryID)
 	}
 
+	policy, err := decodeNetworkPolicy(assignment.ExamData)
+	if err != nil {
+		return err
+	}
+
+	// The exam content arrives encrypted ahead of the start; the delivery key is only
+	// released by the coordinator at the scheduled start
+	content, _ := assignment.ExamData["content"].(string)
+	digest, _ := assignment.ExamData["content_digest"].(string)
+	if content == "" || digest == "" {
+		s.reportStagingFailure(assignment.DeliveryID, "assignment has no exam content")
+		return fmt.Errorf("assignment of delivery %d has no exam content", assignment.DeliveryID)
+	}
+
 	// Create SQLite database for this delivery
 	db, err := NewExamDeliveryDB(assignment.DeliveryID, s.dataDir)
 	if err != nil {
+		s.reportStagingFailure(assignment.DeliveryID, err.Error())
 		return fmt.Errorf("failed to create delivery database: %w", err)
 	}
 
+	if err := db.StageContent(content, digest); err != nil {
+		db.Close()
+		s.reportStagingFailure(assignment.DeliveryID, err.Error())
+		return fmt.Errorf("failed to stage exam content: %w", err)
+	}
+
 	// Create delivery instance
 	ctx, cancel := context.WithCancel(context.Background())
 	deliveryPort := s.port + 1 + (assignment.DeliveryID % 100) // Unique port per delivery (8235+)
@@ -307,7 +408,7 @@ func (s *ExamClientService) startDelivery(assignment *DeliveryAssignment) error
 	delivery := &DeliveryInstance{
 		ID:           assignment.DeliveryID,
 		Name:         assignment.DeliveryName,
-		Status:       "starting",
+		Status:       "staged",
 		StartedAt:    time.Now(),
 		Participants: 0,
 		Port:         deliveryPort,
@@ -318,11 +419,26 @@ func (s *ExamClientService) startDelivery(assignment *DeliveryAssignment) error
 	}
 
 	// Create HTTP server for this delivery
-	server := NewExamDeliveryServer(assignment.DeliveryID, deliveryPort, db, s.coordinatorURL, s.clientID)
+	outbox := NewEventOutbox(db, s.coordinatorURL, s.credentials)
+	server := NewExamDeliveryServer(assignment.DeliveryID, deliveryPort, db, outbox, s.coordinatorURL, s.credentials)
+	if err := server.SetNetworkPolicy(policy); err != nil {
+		cancel()
+		db.Close()
+		return err
+	}
+	server.SetAttemptWindow(decodeExamTime(assignment.ExamData, "attempts_until"))
 	delivery.Server = server
+	delivery.Outbox = outbox
+	outbox.Start()
 
 	s.deliveries[assignment.DeliveryID] = delivery
 
+	if err := s.reportStaging(delivery.ID, tables.StagingStatusStaged, digest, ""); err != nil {
+		log.Printf("Failed to report staging of delivery %d, retrying at start: %v", delivery.ID, err)
+	} else {
+		delivery.stagingReported = true
+	}
+
 	// Load participants from assignment data
 	if err := s.loadParticipants(delivery, assignment); err != nil {
 		log.Printf("Warning: Failed to load participants for delivery %d: %v", assignment.DeliveryID, err)
@@ -331,7 +447,7 @@ func (s *ExamClientService) startDelivery(assignment *DeliveryAssignment) error
 	// Start delivery in goroutine
 	go s.runDelivery(delivery, assignment)
 
-	log.Printf("Started delivery %d (%s) on port %d with SQLite database",
+	log.Printf("Staged delivery %d (%s) on port %d with SQLite database",
 		delivery.ID, delivery.Name, delivery.Port)
 
 	return nil
@@ -349,8 +465,11 @@ func (s *ExamClientService) runDelivery(delivery *DeliveryInstance, assignment *
 			if delivery.Status == "completed" {
 				s.exportFinalData(delivery)
 			}
-			delivery.Database.Close()
+			// The content and answers stay encrypted on disk; only the coordinator can read them now
+			delivery.Database.WipeKey()
+			// The database is closed once the outbox has sent everything
 			// TODO: Delete SQLite file after successful export
+			s.drainOutbox(delivery.Outbox, delivery.Database)
 		}
 
 		s.deliveriesMux.Lock()
@@ -361,6 +480,21 @@ func (s *ExamClientService) runDelivery(delivery *DeliveryInstance, assignment *
 		log.Printf("Delivery %d (%s) finished with status: %s", delivery.ID, delivery.Name, delivery.Status)
 	}()
 
+	// Wait for the scheduled start and the delivery key
+	releaseAt := decodeExamTime(assignment.ExamData, "scheduled_at")
+	finishAt := decodeExamTime(assignment.ExamData, "finish_at")
+	digest, _ := assignment.ExamData["content_digest"].(string)
+	if err := s.awaitDeliveryKey(delivery, releaseAt, finishAt, digest); err != nil {
+		if delivery.Context.Err() != nil || err == errClosedBeforeStart {
+			delivery.Status = "cancelled"
+			log.Printf("Delivery %d cancelled before its start: %v", delivery.ID, err)
+		} else {
+			delivery.Status = "failed"
+			log.Printf("Delivery %d failed to start: %v", delivery.ID, err)
+		}
+		return
+	}
+
 	delivery.Status = "running"
 	log.Printf("Starting HTTP server for delivery %d on port %d", delivery.ID, delivery.Port)
 
@@ -373,15 +507,35 @@ func (s *ExamClientService) runDelivery(delivery *DeliveryInstance, assignment *
 
 	log.Printf("Delivery %d (%s) is now running and accepting participants", delivery.ID, delivery.Name)
 
-	// Wait for delivery to complete or be cancelled
+	// The delivery closes at its end plus the grace period, even without the coordinator
+	closeAfter := 8 * time.Hour // Maximum exam duration (8 hours) when the delivery has no end
+	if !finishAt.IsZero() {
+		closeAfter = time.Until(finishAt)
+	}
+	closeTimer := time.NewTimer(closeAfter)
+	defer closeTimer.Stop()
+
+	// Wait for delivery to close or be cancelled
 	select {
 	case <-delivery.Context.Done():
 		delivery.Status = "cancelled"
 		log.Printf("Delivery %d cancelled", delivery.ID)
-	case <-time.After(8 * time.Hour): // Maximum exam duration (8 hours)
-		delivery.Status = "completed"
-		log.Printf("Delivery %d completed due to timeout", delivery.ID)
+		return
+	case <-delivery.Server.Finished():
+		log.Printf("Delivery %d closed by the coordinator", delivery.ID)
+	case <-closeTimer.C:
+		log.Printf("Delivery %d closed at its end", delivery.ID)
+	}
+
+	// Participants are shut out and the attempts still in progress are submitted as they are
+	// before the results are exported
+	submitted, err := delivery.Server.ForceSubmitAttempts()
+	if err != nil {
+		log.Printf("Failed to force-submit attempts of delivery %d: %v", delivery.ID, err)
+	} else if submitted > 0 {
+		log.Printf("Force-submitted %d attempts of delivery %d", submitted, delivery.ID)
 	}
+	delivery.Status = "completed"
 }
 
 // shutdownAllDeliveries gracefully shuts down all running deliveries
@@ -400,13 +554,7 @@ func (s *ExamClientService) shutdownAllDeliveries() {
 // unregisterWithCoordinator removes this client from coordinator
 func (s *ExamClientService) unregisterWithCoordinator() {
 	url := fmt.Sprintf("%s/api/internal/exam-clients/%s", s.coordinatorURL, s.clientID)
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		log.Printf("Failed to create unregister request: %v", err)
-		return
-	}
-
-	resp, err := s.httpClient.Do(req)
+	resp, err := s.coordinatorRequest(http.MethodDelete, url, nil)
 	if err != nil {
 		log.Printf("Failed to unregister: %v", err)
 		return
@@ -437,7 +585,7 @@ func (s *ExamClientService) loadParticipants(delivery *DeliveryInstance, assignm
 	return nil
 }
 
-// exportFinalData exports the final delivery data to the coordinator
+// exportFinalData queues the final delivery data for the coordinator
 func (s *ExamClientService) exportFinalData(delivery *DeliveryInstance) {
 	log.Printf("Exporting final data for delivery %d", delivery.ID)
 
@@ -447,26 +595,128 @@ func (s *ExamClientService) exportFinalData(delivery *DeliveryInstance) {
 		return
 	}
 
-	// Send to coordinator
-	dataJSON, err := json.Marshal(data)
+	// The export is encrypted with the delivery key both in the outbox and in transit
+	sealed, err := delivery.Database.SealExport(data)
 	if err != nil {
-		log.Printf("Failed to marshal export data: %v", err)
+		log.Printf("Failed to encrypt data for delivery %d: %v", delivery.ID, err)
+		return
+	}
+
+	path := fmt.Sprintf("/api/internal/exam-clients/%s/final-results", s.clientID)
+	payload := map[string]interface{}{
+		"delivery_id":       delivery.ID,
+		"encrypted_results": sealed,
+	}
+	if _, err := delivery.Outbox.Enqueue(path, payload); err != nil {
+		log.Printf("Failed to queue final data for delivery %d: %v", delivery.ID, err)
 		return
 	}
 
-	url := fmt.Sprintf("%s/api/internal/exam-clients/%s/final-results", s.coordinatorURL, s.clientID)
-	resp, err := s.httpClient.Post(url, "application/json", bytes.NewBuffer(dataJSON))
+	log.Printf("Queued final data for delivery %d", delivery.ID)
+}
+
+// drainOutbox keeps sending the outbox of a finished delivery in the background and closes
+// the database once it is empty. Entries left when the service stops are sent on the next start.
+func (s *ExamClientService) drainOutbox(outbox *EventOutbox, db *ExamDeliveryDB) {
+	s.drainingMux.Lock()
+	s.draining[outbox] = true
+	s.drainingMux.Unlock()
+
+	go func() {
+		defer func() {
+			outbox.Stop()
+			db.Close()
+
+			s.drainingMux.Lock()
+			delete(s.draining, outbox)
+			s.drainingMux.Unlock()
+		}()
+
+		for {
+			if outbox.Flush(time.Minute) {
+				log.Printf("Outbox of delivery %d sent", db.deliveryID)
+				return
+			}
+			select {
+			case <-s.stopChan:
+				return
+			default:
+			}
+		}
+	}()
+}
+
+// resumeOutboxes sends the entries left in the outboxes of delivery databases from earlier runs
+func (s *ExamClientService) resumeOutboxes() {
+	paths, err := filepath.Glob(filepath.Join(s.dataDir, "delivery_*.db"))
 	if err != nil {
-		log.Printf("Failed to send final data to coordinator: %v", err)
+		log.Printf("Failed to list delivery databases: %v", err)
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK {
-		log.Printf("Successfully exported final data for delivery %d", delivery.ID)
-	} else {
-		log.Printf("Failed to export final data for delivery %d, status: %d", delivery.ID, resp.StatusCode)
+	for _, path := range paths {
+		var deliveryID int
+		if _, err := fmt.Sscanf(filepath.Base(path), "delivery_%d_", &deliveryID); err != nil {
+			continue
+		}
+
+		db, err := OpenExamDeliveryDB(deliveryID, path)
+		if err != nil {
+			log.Printf("Failed to open %s: %v", path, err)
+			continue
+		}
+
+		backlog, err := db.OutboxBacklog()
+		if err != nil || backlog == 0 {
+			db.Close()
+			continue
+		}
+
+		log.Printf("Resuming outbox of delivery %d with %d unsent entries", deliveryID, backlog)
+		outbox := NewEventOutbox(db, s.coordinatorURL, s.credentials)
+		outbox.Start()
+		s.drainOutbox(outbox, db)
+	}
+}
+
+// reportStagingFailure tells the coordinator that a delivery could not be staged, so it is
+// staged again
+func (s *ExamClientService) reportStagingFailure(deliveryID int, reason string) {
+	if err := s.reportStaging(deliveryID, tables.StagingStatusFailed, "", reason); err != nil {
+		log.Printf("Failed to report staging failure of delivery %d: %v", deliveryID, err)
+	}
+}
+
+// decodeExamTime returns a time from assignment data, or the zero time when it is not set
+func decodeExamTime(examData map[string]interface{}, field string) time.Time {
+	value, ok := examData[field].(string)
+	if !ok {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// decodeNetworkPolicy extracts the network allow-list from assignment data
+func decodeNetworkPolicy(examData map[string]interface{}) (*tables.DeliveryNetworkPolicy, error) {
+	raw, ok := examData["network_policy"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal network policy: %w", err)
+	}
+
+	var policy tables.DeliveryNetworkPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to decode network policy: %w", err)
 	}
+	return &policy, nil
 }
 
 // getLocalIP gets the local IP address
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/utils"
+)
+
+// ErrInvalidResults is returned when final results cannot be decrypted with the delivery key
+var ErrInvalidResults = errors.New("final results could not be decrypted with the delivery key")
+
+// ExamContentService packages the exam content of deliveries for exam-clients. The content
+// is encrypted with the delivery key, which the exam-client only receives when the delivery
+// starts (see SchedulerService).
+type ExamContentService struct {
+	examModel    *models.ExamModel
+	deliveryKeys *models.DeliveryKeyModel
+}
+
+// NewExamContentService creates a new exam content service
+func NewExamContentService(examModel *models.ExamModel, deliveryKeys *models.DeliveryKeyModel) *ExamContentService {
+	return &ExamContentService{
+		examModel:    examModel,
+		deliveryKeys: deliveryKeys,
+	}
+}
+
+// ParticipantCredential is issued by the coordinator at test-code login and sealed with the
+// delivery key. The exam-client starts an attempt only for the participant it names.
+type ParticipantCredential struct {
+	ParticipantID int    `json:"participant_id"`
+	ExpiresAt     int64  `json:"expires_at"`
+	Nonce         string `json:"nonce"`
+}
+
+// IssueParticipantCredential seals a credential for a participant of a delivery, valid until expiresAt
+func (s *ExamContentService) IssueParticipantCredential(deliveryID, participantID int, expiresAt time.Time) (string, error) {
+	key, err := s.deliveryKeys.GetOrCreate(deliveryID)
+	if err != nil {
+		return "", err
+	}
+	defer utils.WipeKey(key)
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate credential nonce: %w", err)
+	}
+
+	data, err := json.Marshal(ParticipantCredential{
+		ParticipantID: participantID,
+		ExpiresAt:     expiresAt.Unix(),
+		Nonce:         hex.EncodeToString(nonce),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal participant credential: %w", err)
+	}
+
+	sealed, err := utils.Seal(key, data, utils.DeliveryAD(deliveryID, "participant"))
+	if err != nil {
+		return "", fmt.Errorf("failed to seal participant credential: %w", err)
+	}
+	return sealed, nil
+}
+
+// ContentPackage is the exam content of a delivery encrypted with the delivery key
+type ContentPackage struct {
+	Sealed    string
+	Digest    string // hex SHA-256 of Sealed, checked by the exam-client staging it
+	Questions int
+}
+
+// SealContent packages the exam content of a delivery encrypted with its delivery key
+func (s *ExamContentService) SealContent(deliveryID, examID int) (*ContentPackage, error) {
+	// Deliveries are staged by exam-clients, which serve every client
+	content, err := s.examModel.GetExamContent(models.AllClients(), examID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.deliveryKeys.GetOrCreate(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.WipeKey(key)
+
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal exam content: %w", err)
+	}
+
+	sealed, err := utils.Seal(key, data, utils.DeliveryAD(deliveryID, "content"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt exam content: %w", err)
+	}
+
+	digest := sha256.Sum256([]byte(sealed))
+	return &ContentPackage{
+		Sealed:    sealed,
+		Digest:    hex.EncodeToString(digest[:]),
+		Questions: len(content.Questions),
+	}, nil
+}
+
+// OpenResults decrypts the final results an exam-client exported for a delivery
+func (s *ExamContentService) OpenResults(deliveryID int, sealed string) (map[string]interface{}, error) {
+	key, err := s.deliveryKeys.Get(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.WipeKey(key)
+
+	data, err := utils.Open(key, sealed, utils.DeliveryAD(deliveryID, "results"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResults, err)
+	}
+
+	var results map[string]interface{}
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResults, err)
+	}
+	return results, nil
+}
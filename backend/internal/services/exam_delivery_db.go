@@ -1,19 +1,54 @@
 package services
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
 )
 
-// ExamDeliveryDB manages the local SQLite database for a delivery
+// ErrSequenceConflict is returned when a sequence number or idempotency key is reused for a different write
+var ErrSequenceConflict = errors.New("sequence number or idempotency key already used for another answer")
+
+// ErrAttemptNotInProgress is returned for answer and flag writes to an attempt that was
+// submitted or does not exist
+var ErrAttemptNotInProgress = errors.New("attempt is not in progress")
+
+// ErrUnknownParticipant is returned when a proctor message targets a participant not in the delivery
+var ErrUnknownParticipant = errors.New("unknown participant")
+
+// ErrDeliveryKeyUnavailable is returned when encrypted data is accessed before the coordinator
+// released the delivery key or after it was wiped
+var ErrDeliveryKeyUnavailable = errors.New("delivery key is not available")
+
+// ErrInvalidCredential is returned when a participant credential was not issued by the
+// coordinator for this delivery, has expired or names an unknown participant
+var ErrInvalidCredential = errors.New("invalid participant credential")
+
+// ErrContentDigestMismatch is returned when staged exam content does not match its digest
+var ErrContentDigestMismatch = errors.New("exam content does not match its digest")
+
+// ExamDeliveryDB manages the local SQLite database for a delivery. Exam content and answers
+// are encrypted with the delivery key, which is only held in memory.
 type ExamDeliveryDB struct {
 	db         *sql.DB
 	deliveryID int
 	dbPath     string
+
+	key   []byte
+	keyMu sync.RWMutex
 }
 
 // ParticipantData represents a participant in the local database
@@ -33,6 +68,7 @@ type AttemptData struct {
 	EndedAt         *time.Time `json:"ended_at"`
 	CurrentQuestion int        `json:"current_question"`
 	Status          string     `json:"status"`
+	ForceSubmitted  bool       `json:"force_submitted"` // ended by the delivery closing
 }
 
 // AnswerData represents an answer in the local database
@@ -43,6 +79,50 @@ type AnswerData struct {
 	Answer      string    `json:"answer"`
 	SubmittedAt time.Time `json:"submitted_at"`
 	Score       int       `json:"score"`
+	// TimeSpent is the accumulated time (seconds) over all visits of the question
+	TimeSpent     int        `json:"time_spent"`
+	Visits        int        `json:"visits"`
+	AnswerChanges int        `json:"answer_changes"`
+	Flagged       bool       `json:"flagged"`
+	FlaggedAt     *time.Time `json:"flagged_at"`
+}
+
+// AnswerHistoryData represents one visit of a question in the local database
+type AnswerHistoryData struct {
+	ID             int       `json:"id"`
+	AttemptID      int       `json:"attempt_id"`
+	QuestionID     int       `json:"question_id"`
+	Kind           string    `json:"kind"`
+	PreviousAnswer *string   `json:"previous_answer"`
+	Answer         *string   `json:"answer"`
+	TimeSpent      int       `json:"time_spent"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// AnswerSubmissionResult is the outcome of one answer write
+type AnswerSubmissionResult struct {
+	QuestionID int    `json:"question_id"`
+	Seq        int64  `json:"seq"`
+	Kind       string `json:"kind"`
+	// Duplicate is true when the write had already been applied (a retry)
+	Duplicate bool `json:"duplicate"`
+	// Stale is true when a write with a higher sequence number had already set the answer;
+	// only the visit and time spent were recorded
+	Stale bool `json:"stale"`
+}
+
+// HelpRequestData represents a participant's help request in the local database
+type HelpRequestData struct {
+	ID            int        `json:"id"`
+	ParticipantID int        `json:"participant_id"`
+	AttemptID     int        `json:"attempt_id"`
+	Message       string     `json:"message"`
+	Status        string     `json:"status"`
+	RequestedAt   time.Time  `json:"requested_at"`
+	ClaimedAt     *time.Time `json:"claimed_at"`
+	ClaimedBy     *string    `json:"claimed_by"`
+	ResolvedAt    *time.Time `json:"resolved_at"`
+	ResolvedBy    *string    `json:"resolved_by"`
 }
 
 // ProgressData represents participant progress
@@ -76,8 +156,12 @@ type DeliveryStats struct {
 func NewExamDeliveryDB(deliveryID int, dataDir string) (*ExamDeliveryDB, error) {
 	timestamp := time.Now().Format("20060102_150405")
 	dbName := fmt.Sprintf("delivery_%d_%s.db", deliveryID, timestamp)
-	dbPath := filepath.Join(dataDir, dbName)
+	return OpenExamDeliveryDB(deliveryID, filepath.Join(dataDir, dbName))
+}
 
+// OpenExamDeliveryDB opens the SQLite database of a delivery, creating it when the file does
+// not exist. Existing files are reopened to send what is left in their outbox.
+func OpenExamDeliveryDB(deliveryID int, dbPath string) (*ExamDeliveryDB, error) {
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
@@ -106,7 +190,9 @@ func (edb *ExamDeliveryDB) createTables() error {
 		name TEXT NOT NULL,
 		email TEXT NOT NULL,
 		identifier TEXT NOT NULL,
-		status TEXT DEFAULT 'not_started'
+		status TEXT DEFAULT 'not_started',
+		paused INTEGER DEFAULT 0,
+		locked INTEGER DEFAULT 0
 	);
 
 	-- Attempts table
@@ -117,6 +203,9 @@ func (edb *ExamDeliveryDB) createTables() error {
 		ended_at TIMESTAMP,
 		current_question INTEGER DEFAULT 1,
 		status TEXT DEFAULT 'in_progress',
+		acked_seq INTEGER DEFAULT 0,
+		max_seq INTEGER DEFAULT 0,
+		force_submitted INTEGER DEFAULT 0,
 		FOREIGN KEY (participant_id) REFERENCES participants(id)
 	);
 
@@ -125,9 +214,61 @@ func (edb *ExamDeliveryDB) createTables() error {
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		attempt_id INTEGER NOT NULL,
 		question_id INTEGER NOT NULL,
-		answer TEXT NOT NULL,
+		answer TEXT NOT NULL DEFAULT '',
 		submitted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		score INTEGER DEFAULT 0,
+		time_spent INTEGER DEFAULT 0,
+		visits INTEGER DEFAULT 0,
+		answer_changes INTEGER DEFAULT 0,
+		flagged INTEGER DEFAULT 0,
+		flagged_at TIMESTAMP,
+		seq INTEGER DEFAULT 0,
+		answer_seq INTEGER DEFAULT 0,
+		answered INTEGER DEFAULT 0,
+		FOREIGN KEY (attempt_id) REFERENCES attempts(id),
+		UNIQUE (attempt_id, question_id)
+	);
+
+	-- Exam content package staged ahead of the start, encrypted with the delivery key
+	CREATE TABLE IF NOT EXISTS staged_content (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		digest TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		staged_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Exam content, one encrypted question per row
+	CREATE TABLE IF NOT EXISTS exam_content (
+		question_id INTEGER PRIMARY KEY,
+		position INTEGER NOT NULL,
+		payload TEXT NOT NULL
+	);
+
+	-- Applied answer writes, to recognize retries by sequence number or idempotency key
+	CREATE TABLE IF NOT EXISTS answer_submissions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		attempt_id INTEGER NOT NULL,
+		seq INTEGER,
+		idempotency_key TEXT,
+		question_id INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		stale INTEGER DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (attempt_id) REFERENCES attempts(id),
+		UNIQUE (attempt_id, seq),
+		UNIQUE (attempt_id, idempotency_key)
+	);
+
+	-- Answer history table (one row per visit of a question)
+	CREATE TABLE IF NOT EXISTS answer_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		attempt_id INTEGER NOT NULL,
+		question_id INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		previous_answer TEXT,
+		answer TEXT,
+		time_spent INTEGER DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (attempt_id) REFERENCES attempts(id)
 	);
 
@@ -142,10 +283,75 @@ func (edb *ExamDeliveryDB) createTables() error {
 		FOREIGN KEY (participant_id) REFERENCES participants(id)
 	);
 
+	-- Participant sessions (issued when an exam starts, used by the participant channel)
+	CREATE TABLE IF NOT EXISTS participant_sessions (
+		token TEXT PRIMARY KEY,
+		participant_id INTEGER NOT NULL,
+		attempt_id INTEGER NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (participant_id) REFERENCES participants(id),
+		FOREIGN KEY (attempt_id) REFERENCES attempts(id)
+	);
+
+	-- Proctor messages sent to participants
+	CREATE TABLE IF NOT EXISTS proctor_messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		message TEXT NOT NULL DEFAULT '',
+		minutes INTEGER DEFAULT 0,
+		broadcast INTEGER DEFAULT 0,
+		sent_by TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Delivery and acknowledgement of proctor messages per recipient
+	CREATE TABLE IF NOT EXISTS message_receipts (
+		message_id INTEGER NOT NULL,
+		participant_id INTEGER NOT NULL,
+		delivered_at TIMESTAMP,
+		acknowledged_at TIMESTAMP,
+		PRIMARY KEY (message_id, participant_id),
+		FOREIGN KEY (message_id) REFERENCES proctor_messages(id),
+		FOREIGN KEY (participant_id) REFERENCES participants(id)
+	);
+
+	-- Help requests raised by participants
+	CREATE TABLE IF NOT EXISTS help_requests (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		participant_id INTEGER NOT NULL,
+		attempt_id INTEGER NOT NULL,
+		message TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'open',
+		requested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		claimed_at TIMESTAMP,
+		claimed_by TEXT,
+		resolved_at TIMESTAMP,
+		resolved_by TEXT,
+		FOREIGN KEY (participant_id) REFERENCES participants(id),
+		FOREIGN KEY (attempt_id) REFERENCES attempts(id)
+	);
+
+	-- Events and exports waiting to be sent to the coordinator, sent in id order
+	CREATE TABLE IF NOT EXISTS outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_id TEXT NOT NULL UNIQUE,
+		path TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		attempts INTEGER DEFAULT 0,
+		last_error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		sent_at TIMESTAMP,
+		discarded_at TIMESTAMP
+	);
+
 	-- Indexes for performance
 	CREATE INDEX IF NOT EXISTS idx_attempts_participant ON attempts(participant_id);
 	CREATE INDEX IF NOT EXISTS idx_answers_attempt ON answers(attempt_id);
 	CREATE INDEX IF NOT EXISTS idx_answers_question ON answers(question_id);
+	CREATE INDEX IF NOT EXISTS idx_answer_history_attempt ON answer_history(attempt_id);
+	CREATE INDEX IF NOT EXISTS idx_participant_sessions_participant ON participant_sessions(participant_id);
+	CREATE INDEX IF NOT EXISTS idx_message_receipts_participant ON message_receipts(participant_id);
+	CREATE INDEX IF NOT EXISTS idx_help_requests_participant ON help_requests(participant_id, status);
 	`
 
 	_, err := edb.db.Exec(schema)
@@ -235,36 +441,632 @@ func (edb *ExamDeliveryDB) StartAttempt(participantID int, totalQuestions int) (
 	return int(attemptID), tx.Commit()
 }
 
-// SubmitAnswer submits an answer and updates progress
-func (edb *ExamDeliveryDB) SubmitAnswer(attemptID, questionID int, answer string, score int) error {
+// ForceSubmitAttempts completes the attempts still in progress when the delivery closes and
+// returns them
+func (edb *ExamDeliveryDB) ForceSubmitAttempts() ([]AttemptData, error) {
 	tx, err := edb.db.Begin()
 	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id, participant_id FROM attempts WHERE status = 'in_progress'`)
+	if err != nil {
+		return nil, err
+	}
+	var attempts []AttemptData
+	for rows.Next() {
+		var a AttemptData
+		if err := rows.Scan(&a.ID, &a.ParticipantID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i := range attempts {
+		_, err := tx.Exec(`
+			UPDATE attempts SET ended_at = ?, status = 'completed', force_submitted = 1
+			WHERE id = ?
+		`, now, attempts[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(`UPDATE participants SET status = 'completed' WHERE id = ?`, attempts[i].ParticipantID)
+		if err != nil {
+			return nil, err
+		}
+		attempts[i].EndedAt = &now
+		attempts[i].Status = "completed"
+		attempts[i].ForceSubmitted = true
+	}
+
+	return attempts, tx.Commit()
+}
+
+// OpenParticipantCredential returns the participant named by a credential the coordinator
+// issued at test-code login
+func (edb *ExamDeliveryDB) OpenParticipantCredential(credential string, now time.Time) (int, error) {
+	data, err := edb.open(credential, "participant")
+	if err != nil {
+		if errors.Is(err, ErrDeliveryKeyUnavailable) {
+			return 0, err
+		}
+		return 0, ErrInvalidCredential
+	}
+
+	var parsed ParticipantCredential
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return 0, ErrInvalidCredential
+	}
+	if now.Unix() > parsed.ExpiresAt {
+		return 0, ErrInvalidCredential
+	}
+
+	var exists bool
+	err = edb.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM participants WHERE id = ?)`, parsed.ParticipantID).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, ErrInvalidCredential
+	}
+	return parsed.ParticipantID, nil
+}
+
+// SetKey sets the delivery key released by the coordinator
+func (edb *ExamDeliveryDB) SetKey(key []byte) {
+	edb.keyMu.Lock()
+	defer edb.keyMu.Unlock()
+
+	utils.WipeKey(edb.key)
+	edb.key = append([]byte(nil), key...)
+}
+
+// WipeKey erases the delivery key from memory. The encrypted content and answers can no
+// longer be read on this exam-client.
+func (edb *ExamDeliveryDB) WipeKey() {
+	edb.keyMu.Lock()
+	defer edb.keyMu.Unlock()
+
+	utils.WipeKey(edb.key)
+	edb.key = nil
+}
+
+// seal encrypts a value with the delivery key for the given purpose
+func (edb *ExamDeliveryDB) seal(plaintext []byte, purpose string) (string, error) {
+	edb.keyMu.RLock()
+	defer edb.keyMu.RUnlock()
+
+	if edb.key == nil {
+		return "", ErrDeliveryKeyUnavailable
+	}
+	return utils.Seal(edb.key, plaintext, utils.DeliveryAD(edb.deliveryID, purpose))
+}
+
+// open decrypts a value sealed with seal for the same purpose
+func (edb *ExamDeliveryDB) open(sealed, purpose string) ([]byte, error) {
+	edb.keyMu.RLock()
+	defer edb.keyMu.RUnlock()
+
+	if edb.key == nil {
+		return nil, ErrDeliveryKeyUnavailable
+	}
+	return utils.Open(edb.key, sealed, utils.DeliveryAD(edb.deliveryID, purpose))
+}
+
+// sealAnswer encrypts an answer. Blank answers are stored as an empty string, so unanswered questions
+// need no key.
+func (edb *ExamDeliveryDB) sealAnswer(attemptID, questionID int, answer string) (string, error) {
+	if strings.TrimSpace(answer) == "" {
+		return "", nil
+	}
+	return edb.seal([]byte(answer), answerPurpose(attemptID, questionID))
+}
+
+// openAnswer decrypts an answer sealed with sealAnswer
+func (edb *ExamDeliveryDB) openAnswer(attemptID, questionID int, sealed string) (string, error) {
+	if sealed == "" {
+		return "", nil
+	}
+	answer, err := edb.open(sealed, answerPurpose(attemptID, questionID))
+	if err != nil {
+		return "", err
+	}
+	return string(answer), nil
+}
+
+func answerPurpose(attemptID, questionID int) string {
+	return fmt.Sprintf("answer:%d:%d", attemptID, questionID)
+}
+
+// StageContent verifies the exam content package staged ahead of the start against its
+// digest and stores it as is; it cannot be read before the delivery key is released
+func (edb *ExamDeliveryDB) StageContent(sealed, digest string) error {
+	if err := verifyContentDigest(sealed, digest); err != nil {
 		return err
 	}
+
+	_, err := edb.db.Exec(`
+		INSERT INTO staged_content (id, digest, payload, staged_at) VALUES (1, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET digest = excluded.digest, payload = excluded.payload, staged_at = excluded.staged_at
+	`, digest, sealed, time.Now())
+	return err
+}
+
+// UnpackStagedContent stores the questions of the staged package once the delivery key is
+// set (see StoreExamContent) and removes the package. It returns the number of questions.
+func (edb *ExamDeliveryDB) UnpackStagedContent() (int, error) {
+	var digest, sealed string
+	err := edb.db.QueryRow(`SELECT digest, payload FROM staged_content WHERE id = 1`).Scan(&digest, &sealed)
+	if err != nil {
+		return 0, err
+	}
+	if err := verifyContentDigest(sealed, digest); err != nil {
+		return 0, err
+	}
+
+	questions, err := edb.StoreExamContent(sealed)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := edb.db.Exec(`DELETE FROM staged_content`); err != nil {
+		return 0, err
+	}
+	return questions, nil
+}
+
+func verifyContentDigest(sealed, digest string) error {
+	sum := sha256.Sum256([]byte(sealed))
+	if hex.EncodeToString(sum[:]) != strings.ToLower(digest) {
+		return ErrContentDigestMismatch
+	}
+	return nil
+}
+
+// StoreExamContent decrypts the exam content package sent with the assignment and stores its
+// questions, each encrypted on its own. It returns the number of questions.
+func (edb *ExamDeliveryDB) StoreExamContent(sealed string) (int, error) {
+	data, err := edb.open(sealed, "content")
+	if err != nil {
+		return 0, fmt.Errorf("failed to decrypt exam content: %w", err)
+	}
+
+	var content tables.ExamContent
+	if err := json.Unmarshal(data, &content); err != nil {
+		return 0, fmt.Errorf("failed to decode exam content: %w", err)
+	}
+
+	tx, err := edb.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, question := range content.Questions {
+		payload, err := json.Marshal(question)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal question %d: %w", question.ID, err)
+		}
+		sealedQuestion, err := edb.seal(payload, fmt.Sprintf("question:%d", question.ID))
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO exam_content (question_id, position, payload) VALUES (?, ?, ?)
+			ON CONFLICT (question_id) DO UPDATE SET position = excluded.position, payload = excluded.payload
+		`, question.ID, question.Position, sealedQuestion)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(content.Questions), tx.Commit()
+}
+
+// GetQuestion decrypts a question of the exam content. It returns sql.ErrNoRows when the
+// question is not part of the delivery.
+func (edb *ExamDeliveryDB) GetQuestion(questionID int) (*tables.ExamContentQuestion, error) {
+	var sealed string
+	err := edb.db.QueryRow(`SELECT payload FROM exam_content WHERE question_id = ?`, questionID).Scan(&sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := edb.open(sealed, fmt.Sprintf("question:%d", questionID))
+	if err != nil {
+		return nil, err
+	}
+
+	var question tables.ExamContentQuestion
+	if err := json.Unmarshal(data, &question); err != nil {
+		return nil, fmt.Errorf("failed to decode question %d: %w", questionID, err)
+	}
+	return &question, nil
+}
+
+// SealExport encrypts exported delivery data for the coordinator, which holds the delivery key
+func (edb *ExamDeliveryDB) SealExport(data map[string]interface{}) (string, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal export: %w", err)
+	}
+	return edb.seal(payload, "results")
+}
+
+// SubmitAnswer records one visit of a question and updates progress. See submitAnswer.
+func (edb *ExamDeliveryDB) SubmitAnswer(sub *AnswerSubmissionRequest) (*AnswerSubmissionResult, error) {
+	tx, err := edb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := edb.submitAnswer(tx, sub)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := updateAnswerProgress(tx, sub.AttemptID); err != nil {
+		return nil, err
+	}
+
+	return result, tx.Commit()
+}
+
+// SubmitAnswers applies a batch of answers queued by the exam UI (e.g. after a reconnect)
+// in sequence order, in one transaction
+func (edb *ExamDeliveryDB) SubmitAnswers(subs []AnswerSubmissionRequest) ([]AnswerSubmissionResult, error) {
+	sorted := make([]AnswerSubmissionRequest, len(subs))
+	copy(sorted, subs)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Seq < sorted[j].Seq })
+
+	tx, err := edb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
 	defer tx.Rollback()
 
-	// Insert answer
+	results := make([]AnswerSubmissionResult, 0, len(sorted))
+	attempts := make(map[int]bool)
+	for i := range sorted {
+		result, err := edb.submitAnswer(tx, &sorted[i])
+		if err != nil {
+			return nil, fmt.Errorf("seq %d: %w", sorted[i].Seq, err)
+		}
+		results = append(results, *result)
+		attempts[sorted[i].AttemptID] = true
+	}
+
+	for attemptID := range attempts {
+		if err := updateAnswerProgress(tx, attemptID); err != nil {
+			return nil, err
+		}
+	}
+
+	return results, tx.Commit()
+}
+
+// submitAnswer records one answer write. timeSpent is added to the time already spent on
+// the question; a nil answer keeps the current answer and score.
+//
+// Writes carrying a sequence number (Seq > 0) are ordered per attempt: a write whose Seq is
+// lower than the one that set the current answer (answer_seq, which writes carrying only time
+// or a visit do not advance) is stale, so only its visit and time are recorded (last write
+// wins in sequence order, not arrival order). A write whose Seq or
+// idempotency key was already applied is a duplicate and returns the original result.
+//
+// Only attempts in progress take new writes (ErrAttemptNotInProgress). Answers are stored
+// encrypted with the delivery key.
+func (edb *ExamDeliveryDB) submitAnswer(tx *sql.Tx, sub *AnswerSubmissionRequest) (*AnswerSubmissionResult, error) {
+	if sub.Seq > 0 || sub.IdempotencyKey != "" {
+		duplicate, err := findAnswerSubmission(tx, sub)
+		if err != nil || duplicate != nil {
+			return duplicate, err
+		}
+	}
+
+	if err := requireAttemptInProgress(tx, sub.AttemptID); err != nil {
+		return nil, err
+	}
+
+	var previousAnswer, previousSealed *string
+	var sealed string
+	var answerSeq int64
+	err := tx.QueryRow(`SELECT answer, answer_seq FROM answers WHERE attempt_id = ? AND question_id = ?`,
+		sub.AttemptID, sub.QuestionID).Scan(&sealed, &answerSeq)
+	if err == nil {
+		previous, err := edb.openAnswer(sub.AttemptID, sub.QuestionID, sealed)
+		if err != nil {
+			return nil, err
+		}
+		previousAnswer, previousSealed = &previous, &sealed
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	answer := sub.Answer
+	stale := sub.Seq > 0 && sub.Seq < answerSeq
+	if stale {
+		answer = nil
+	}
+
+	kind := utils.AnswerEventKind(previousAnswer, answer)
+
+	// A nil answer keeps the stored answer and whether it is answered
+	var sealedAnswer *string
+	var answered *bool
+	if answer != nil {
+		value, err := edb.sealAnswer(sub.AttemptID, sub.QuestionID, *answer)
+		if err != nil {
+			return nil, err
+		}
+		isAnswered := value != ""
+		sealedAnswer, answered = &value, &isAnswered
+	}
+	// Only a write carrying an answer advances the sequence that set the answer
+	var writeAnswerSeq *int64
+	if answer != nil {
+		writeAnswerSeq = &sub.Seq
+	}
+	changes := 0
+	if kind == tables.AnswerEventChange || kind == tables.AnswerEventClear {
+		changes = 1
+	}
+
+	now := time.Now()
+
+	// Insert or accumulate answer
 	_, err = tx.Exec(`
-		INSERT OR REPLACE INTO answers (attempt_id, question_id, answer, submitted_at, score)
-		VALUES (?, ?, ?, ?, ?)
-	`, attemptID, questionID, answer, time.Now(), score)
+		INSERT INTO answers (attempt_id, question_id, answer, submitted_at, score, time_spent, visits, answer_changes, seq, answer_seq, answered)
+		VALUES (?, ?, COALESCE(?, ''), ?, COALESCE(?, 0), ?, 1, 0, ?, COALESCE(?, 0), COALESCE(?, 0))
+		ON CONFLICT (attempt_id, question_id) DO UPDATE SET
+			answer = COALESCE(?, answer),
+			submitted_at = excluded.submitted_at,
+			score = COALESCE(?, score),
+			time_spent = time_spent + excluded.time_spent,
+			visits = visits + 1,
+			answer_changes = answer_changes + ?,
+			seq = MAX(seq, excluded.seq),
+			answer_seq = MAX(answer_seq, COALESCE(?, 0)),
+			answered = COALESCE(?, answered)
+	`, sub.AttemptID, sub.QuestionID, sealedAnswer, now, nullableScore(answer, sub.Score), sub.TimeSpent, sub.Seq, writeAnswerSeq, answered,
+		sealedAnswer, nullableScore(answer, sub.Score), changes, writeAnswerSeq, answered)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO answer_history (attempt_id, question_id, kind, previous_answer, answer, time_spent, created_at)
+		VALUES (?, ?, ?, ?, COALESCE(?, ?), ?, ?)
+	`, sub.AttemptID, sub.QuestionID, kind, previousSealed, sealedAnswer, previousSealed, sub.TimeSpent, now)
+	if err != nil {
+		return nil, err
 	}
 
-	// Update progress
 	_, err = tx.Exec(`
+		INSERT INTO answer_submissions (attempt_id, seq, idempotency_key, question_id, kind, stale, created_at)
+		VALUES (?, NULLIF(?, 0), NULLIF(?, ''), ?, ?, ?, ?)
+	`, sub.AttemptID, sub.Seq, sub.IdempotencyKey, sub.QuestionID, kind, stale, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if sub.Seq > 0 {
+		if err := advanceAnswerAck(tx, sub.AttemptID, sub.Seq); err != nil {
+			return nil, err
+		}
+	}
+
+	return &AnswerSubmissionResult{
+		QuestionID: sub.QuestionID,
+		Seq:        sub.Seq,
+		Kind:       kind,
+		Stale:      stale,
+	}, nil
+}
+
+// requireAttemptInProgress returns ErrAttemptNotInProgress unless the attempt is in progress
+func requireAttemptInProgress(tx *sql.Tx, attemptID int) error {
+	var status string
+	err := tx.QueryRow(`SELECT status FROM attempts WHERE id = ?`, attemptID).Scan(&status)
+	if err == sql.ErrNoRows || (err == nil && status != "in_progress") {
+		return ErrAttemptNotInProgress
+	}
+	return err
+}
+
+// findAnswerSubmission returns the result of an already applied write with the same sequence
+// number or idempotency key, or nil when the write is new
+func findAnswerSubmission(tx *sql.Tx, sub *AnswerSubmissionRequest) (*AnswerSubmissionResult, error) {
+	var result AnswerSubmissionResult
+	var seq sql.NullInt64
+	err := tx.QueryRow(`
+		SELECT question_id, seq, kind, stale FROM answer_submissions
+		WHERE attempt_id = ? AND (seq = NULLIF(?, 0) OR idempotency_key = NULLIF(?, ''))
+		ORDER BY id LIMIT 1
+	`, sub.AttemptID, sub.Seq, sub.IdempotencyKey).Scan(&result.QuestionID, &seq, &result.Kind, &result.Stale)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.Seq = seq.Int64
+	if result.QuestionID != sub.QuestionID || result.Seq != sub.Seq {
+		return nil, ErrSequenceConflict
+	}
+	result.Duplicate = true
+	return &result, nil
+}
+
+// advanceAnswerAck raises the highest applied sequence number of an attempt and moves the
+// acknowledged sequence over every write that has now arrived without a gap
+func advanceAnswerAck(tx *sql.Tx, attemptID int, seq int64) error {
+	var acked int64
+	err := tx.QueryRow(`SELECT acked_seq FROM attempts WHERE id = ?`, attemptID).Scan(&acked)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`
+		SELECT seq FROM answer_submissions
+		WHERE attempt_id = ? AND seq > ?
+		ORDER BY seq
+	`, attemptID, acked)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var next int64
+		if err := rows.Scan(&next); err != nil {
+			rows.Close()
+			return err
+		}
+		if next != acked+1 {
+			break
+		}
+		acked = next
+	}
+	rows.Close()
+
+	_, err = tx.Exec(`UPDATE attempts SET acked_seq = ?, max_seq = MAX(max_seq, ?) WHERE id = ?`, acked, seq, attemptID)
+	return err
+}
+
+// updateAnswerProgress recounts the answered questions and score of an attempt
+func updateAnswerProgress(tx *sql.Tx, attemptID int) error {
+	_, err := tx.Exec(`
 		UPDATE progress SET 
-			questions_answered = (SELECT COUNT(*) FROM answers WHERE attempt_id = ?),
+			questions_answered = (SELECT COUNT(*) FROM answers WHERE attempt_id = ? AND answered = 1),
 			current_score = (SELECT COALESCE(SUM(score), 0) FROM answers WHERE attempt_id = ?),
 			last_activity = ?
 		WHERE participant_id = (SELECT participant_id FROM attempts WHERE id = ?)
 	`, attemptID, attemptID, time.Now(), attemptID)
+	return err
+}
+
+// GetAnswerAck returns the acknowledged sequence number of an attempt (every write up to it
+// was applied) and the highest sequence number applied
+func (edb *ExamDeliveryDB) GetAnswerAck(attemptID int) (int64, int64, error) {
+	var acked, max int64
+	err := edb.db.QueryRow(`SELECT acked_seq, max_seq FROM attempts WHERE id = ?`, attemptID).Scan(&acked, &max)
+	return acked, max, err
+}
+
+func nullableScore(answer *string, score int) interface{} {
+	if answer == nil {
+		return nil
+	}
+	return score
+}
+
+// SetQuestionFlag flags or unflags a question for review. Only attempts in progress can
+// flag questions (ErrAttemptNotInProgress).
+func (edb *ExamDeliveryDB) SetQuestionFlag(attemptID, questionID int, flagged bool) error {
+	var flaggedAt interface{}
+	if flagged {
+		flaggedAt = time.Now()
+	}
+
+	result, err := edb.db.Exec(`
+		INSERT INTO answers (attempt_id, question_id, answer, submitted_at, flagged, flagged_at)
+		SELECT ?, ?, '', ?, ?, ?
+		WHERE EXISTS (SELECT 1 FROM attempts WHERE id = ? AND status = 'in_progress')
+		ON CONFLICT (attempt_id, question_id) DO UPDATE SET
+			flagged = excluded.flagged,
+			flagged_at = excluded.flagged_at
+	`, attemptID, questionID, time.Now(), flagged, flaggedAt, attemptID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if rows == 0 {
+		return ErrAttemptNotInProgress
+	}
+	return nil
+}
 
-	return tx.Commit()
+// GetAttemptReview lists the answered, unanswered and flagged questions of an attempt.
+// The exam-client does not hold the question list, so unanswered questions can only be
+// listed when questionIDs is given; otherwise only their number is known.
+func (edb *ExamDeliveryDB) GetAttemptReview(attemptID int, questionIDs []int) (*tables.AttemptReview, error) {
+	var totalQuestions int
+	err := edb.db.QueryRow(`
+		SELECT COALESCE(p.total_questions, 0) FROM attempts a
+		LEFT JOIN progress p ON p.participant_id = a.participant_id
+		WHERE a.id = ?
+	`, attemptID).Scan(&totalQuestions)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := edb.db.Query(`
+		SELECT question_id, answered, flagged FROM answers
+		WHERE attempt_id = ? ORDER BY question_id
+	`, attemptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make(map[int]tables.AttemptReviewQuestion)
+	known := []int{}
+	for rows.Next() {
+		var q tables.AttemptReviewQuestion
+		if err := rows.Scan(&q.QuestionID, &q.Answered, &q.Flagged); err != nil {
+			return nil, err
+		}
+		states[q.QuestionID] = q
+		known = append(known, q.QuestionID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(questionIDs) > 0 {
+		totalQuestions = len(questionIDs)
+	} else {
+		questionIDs = known
+	}
+
+	review := &tables.AttemptReview{
+		AttemptID:           attemptID,
+		TotalQuestions:      totalQuestions,
+		UnansweredQuestions: []int{},
+		FlaggedQuestions:    []int{},
+		Questions:           []tables.AttemptReviewQuestion{},
+	}
+	for i, questionID := range questionIDs {
+		q, ok := states[questionID]
+		if !ok {
+			q = tables.AttemptReviewQuestion{QuestionID: questionID}
+		}
+		q.Number = i + 1
+		if q.Answered {
+			review.Answered++
+		} else {
+			review.UnansweredQuestions = append(review.UnansweredQuestions, questionID)
+		}
+		if q.Flagged {
+			review.FlaggedQuestions = append(review.FlaggedQuestions, questionID)
+		}
+		review.Questions = append(review.Questions, q)
+	}
+	review.Unanswered = review.TotalQuestions - review.Answered
+	review.Flagged = len(review.FlaggedQuestions)
+
+	return review, nil
 }
 
 // CompleteAttempt marks an attempt as completed
@@ -296,6 +1098,455 @@ func (edb *ExamDeliveryDB) CompleteAttempt(attemptID int) error {
 	return tx.Commit()
 }
 
+// CreateParticipantSession issues the token a participant uses to open the participant channel
+func (edb *ExamDeliveryDB) CreateParticipantSession(participantID, attemptID int) (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", fmt.Errorf("failed to generate session token: %w", err)
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	_, err := edb.db.Exec(`
+		INSERT INTO participant_sessions (token, participant_id, attempt_id, created_at)
+		VALUES (?, ?, ?, ?)
+	`, token, participantID, attemptID, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// GetParticipantSession returns the participant and attempt of a session token
+func (edb *ExamDeliveryDB) GetParticipantSession(token string) (int, int, error) {
+	var participantID, attemptID int
+	err := edb.db.QueryRow(`SELECT participant_id, attempt_id FROM participant_sessions WHERE token = ?`,
+		token).Scan(&participantID, &attemptID)
+	return participantID, attemptID, err
+}
+
+// GetParticipantHold reports whether a proctor has paused or locked a participant
+func (edb *ExamDeliveryDB) GetParticipantHold(participantID int) (bool, bool, error) {
+	var paused, locked bool
+	err := edb.db.QueryRow(`SELECT paused, locked FROM participants WHERE id = ?`, participantID).Scan(&paused, &locked)
+	return paused, locked, err
+}
+
+// CreateProctorMessage stores a proctor message with a receipt per recipient and applies its
+// effect (pause, lock or time extension) to the recipients. An empty recipient list sends the
+// message to every participant. It returns the message and its recipients.
+func (edb *ExamDeliveryDB) CreateProctorMessage(req *tables.ProctorMessageDispatch) (*tables.ProctorMessage, []int, error) {
+	tx, err := edb.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	broadcast := len(req.ParticipantIDs) == 0
+	recipients := []int{}
+	if broadcast {
+		rows, err := tx.Query(`SELECT id FROM participants ORDER BY id`)
+		if err != nil {
+			return nil, nil, err
+		}
+		for rows.Next() {
+			var participantID int
+			if err := rows.Scan(&participantID); err != nil {
+				rows.Close()
+				return nil, nil, err
+			}
+			recipients = append(recipients, participantID)
+		}
+		rows.Close()
+	} else {
+		seen := make(map[int]bool, len(req.ParticipantIDs))
+		for _, participantID := range req.ParticipantIDs {
+			if seen[participantID] {
+				continue
+			}
+			seen[participantID] = true
+
+			var exists int
+			err := tx.QueryRow(`SELECT 1 FROM participants WHERE id = ?`, participantID).Scan(&exists)
+			if err == sql.ErrNoRows {
+				return nil, nil, fmt.Errorf("%w: %d", ErrUnknownParticipant, participantID)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			recipients = append(recipients, participantID)
+		}
+	}
+
+	now := time.Now()
+	result, err := tx.Exec(`
+		INSERT INTO proctor_messages (kind, message, minutes, broadcast, sent_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, req.Kind, req.Message, req.Minutes, broadcast, req.SentBy, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	messageID, err := result.LastInsertId()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message := &tables.ProctorMessage{
+		ID:         int(messageID),
+		Kind:       req.Kind,
+		Message:    req.Message,
+		Minutes:    req.Minutes,
+		Broadcast:  broadcast,
+		SentBy:     req.SentBy,
+		CreatedAt:  now,
+		Recipients: len(recipients),
+		Receipts:   []tables.ProctorMessageReceipt{},
+	}
+
+	for _, participantID := range recipients {
+		_, err := tx.Exec(`INSERT INTO message_receipts (message_id, participant_id) VALUES (?, ?)`, messageID, participantID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := applyProctorMessage(tx, req.Kind, req.Minutes, participantID); err != nil {
+			return nil, nil, err
+		}
+		message.Receipts = append(message.Receipts, tables.ProctorMessageReceipt{ParticipantID: participantID})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return message, recipients, nil
+}
+
+// applyProctorMessage applies the effect of a proctor message to one participant
+func applyProctorMessage(tx *sql.Tx, kind string, minutes, participantID int) error {
+	var err error
+	switch kind {
+	case tables.ProctorMessagePause:
+		_, err = tx.Exec(`UPDATE participants SET paused = 1 WHERE id = ?`, participantID)
+	case tables.ProctorMessageResume:
+		_, err = tx.Exec(`UPDATE participants SET paused = 0 WHERE id = ?`, participantID)
+	case tables.ProctorMessageLock:
+		_, err = tx.Exec(`UPDATE participants SET locked = 1 WHERE id = ?`, participantID)
+	case tables.ProctorMessageUnlock:
+		_, err = tx.Exec(`UPDATE participants SET locked = 0 WHERE id = ?`, participantID)
+	case tables.ProctorMessageTimeExtension:
+		_, err = tx.Exec(`UPDATE progress SET time_remaining = COALESCE(time_remaining, 0) + ? WHERE participant_id = ?`,
+			minutes*60, participantID)
+	}
+	return err
+}
+
+// GetPendingMessages returns the proctor messages a participant has not acknowledged yet, oldest first
+func (edb *ExamDeliveryDB) GetPendingMessages(participantID int) ([]tables.ProctorMessage, error) {
+	query := `
+		SELECT m.id, m.kind, m.message, m.minutes, m.broadcast, m.sent_by, m.created_at
+		FROM proctor_messages m
+		JOIN message_receipts r ON r.message_id = m.id
+		WHERE r.participant_id = ? AND r.acknowledged_at IS NULL
+		ORDER BY m.id
+	`
+
+	rows, err := edb.db.Query(query, participantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []tables.ProctorMessage{}
+	for rows.Next() {
+		var m tables.ProctorMessage
+		err := rows.Scan(&m.ID, &m.Kind, &m.Message, &m.Minutes, &m.Broadcast, &m.SentBy, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+// MarkMessageDelivered records that a message was pushed to a participant
+func (edb *ExamDeliveryDB) MarkMessageDelivered(messageID, participantID int) error {
+	_, err := edb.db.Exec(`
+		UPDATE message_receipts SET delivered_at = ?
+		WHERE message_id = ? AND participant_id = ? AND delivered_at IS NULL
+	`, time.Now(), messageID, participantID)
+	return err
+}
+
+// AcknowledgeMessage records a participant's acknowledgement of a message. It returns false
+// when the message was not sent to the participant or was already acknowledged.
+func (edb *ExamDeliveryDB) AcknowledgeMessage(messageID, participantID int) (bool, error) {
+	now := time.Now()
+	result, err := edb.db.Exec(`
+		UPDATE message_receipts SET acknowledged_at = ?, delivered_at = COALESCE(delivered_at, ?)
+		WHERE message_id = ? AND participant_id = ? AND acknowledged_at IS NULL
+	`, now, now, messageID, participantID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// GetProctorMessages returns all proctor messages, newest first, with their receipts
+func (edb *ExamDeliveryDB) GetProctorMessages() ([]tables.ProctorMessage, error) {
+	rows, err := edb.db.Query(`
+		SELECT id, kind, message, minutes, broadcast, sent_by, created_at
+		FROM proctor_messages
+		ORDER BY id DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []tables.ProctorMessage{}
+	index := make(map[int]int)
+	for rows.Next() {
+		var m tables.ProctorMessage
+		err := rows.Scan(&m.ID, &m.Kind, &m.Message, &m.Minutes, &m.Broadcast, &m.SentBy, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		m.Receipts = []tables.ProctorMessageReceipt{}
+		index[m.ID] = len(messages)
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	receiptRows, err := edb.db.Query(`
+		SELECT message_id, participant_id, delivered_at, acknowledged_at
+		FROM message_receipts
+		ORDER BY message_id, participant_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer receiptRows.Close()
+
+	for receiptRows.Next() {
+		var messageID int
+		var r tables.ProctorMessageReceipt
+		var deliveredAt, acknowledgedAt sql.NullTime
+		if err := receiptRows.Scan(&messageID, &r.ParticipantID, &deliveredAt, &acknowledgedAt); err != nil {
+			return nil, err
+		}
+
+		i, ok := index[messageID]
+		if !ok {
+			continue
+		}
+		m := &messages[i]
+		m.Recipients++
+		if deliveredAt.Valid {
+			r.DeliveredAt = &deliveredAt.Time
+			m.Delivered++
+		}
+		if acknowledgedAt.Valid {
+			r.AcknowledgedAt = &acknowledgedAt.Time
+			m.Acknowledged++
+		}
+		m.Receipts = append(m.Receipts, r)
+	}
+
+	return messages, receiptRows.Err()
+}
+
+// CreateHelpRequest raises a help request for a participant. A participant has at most one
+// pending request; while it is open or claimed, the pending request is returned instead.
+// The boolean result reports whether a new request was created.
+func (edb *ExamDeliveryDB) CreateHelpRequest(participantID, attemptID int, message string) (*HelpRequestData, bool, error) {
+	tx, err := edb.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	var pendingID int
+	err = tx.QueryRow(`
+		SELECT id FROM help_requests
+		WHERE participant_id = ? AND status <> 'resolved'
+		ORDER BY id DESC LIMIT 1
+	`, participantID).Scan(&pendingID)
+	if err == nil {
+		request, err := getHelpRequest(tx, pendingID)
+		return request, false, err
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO help_requests (participant_id, attempt_id, message, status, requested_at)
+		VALUES (?, ?, ?, 'open', ?)
+	`, participantID, attemptID, message, time.Now())
+	if err != nil {
+		return nil, false, err
+	}
+
+	requestID, err := result.LastInsertId()
+	if err != nil {
+		return nil, false, err
+	}
+
+	request, err := getHelpRequest(tx, int(requestID))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return request, true, tx.Commit()
+}
+
+// GetHelpRequests returns the help requests of a participant, newest first
+func (edb *ExamDeliveryDB) GetHelpRequests(participantID int) ([]HelpRequestData, error) {
+	return queryHelpRequests(edb.db, `WHERE participant_id = ? ORDER BY id DESC`, participantID)
+}
+
+// UpdateHelpRequestStatus records that a proctor claimed or resolved a help request
+func (edb *ExamDeliveryDB) UpdateHelpRequestStatus(requestID int, status, by string) (*HelpRequestData, error) {
+	var query string
+	switch status {
+	case tables.HelpRequestClaimed:
+		query = `UPDATE help_requests SET status = 'claimed', claimed_at = ?, claimed_by = ? WHERE id = ? AND status = 'open'`
+	case tables.HelpRequestResolved:
+		query = `UPDATE help_requests SET status = 'resolved', resolved_at = ?, resolved_by = ? WHERE id = ? AND status <> 'resolved'`
+	default:
+		return nil, fmt.Errorf("invalid help request status %q", status)
+	}
+
+	if _, err := edb.db.Exec(query, time.Now(), by, requestID); err != nil {
+		return nil, err
+	}
+
+	return getHelpRequest(edb.db, requestID)
+}
+
+// rowQuerier is implemented by *sql.DB and *sql.Tx
+type rowQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func getHelpRequest(q rowQuerier, requestID int) (*HelpRequestData, error) {
+	requests, err := queryHelpRequests(q, `WHERE id = ?`, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &requests[0], nil
+}
+
+func queryHelpRequests(q rowQuerier, where string, args ...interface{}) ([]HelpRequestData, error) {
+	rows, err := q.Query(`
+		SELECT id, participant_id, attempt_id, message, status, requested_at, claimed_at, claimed_by, resolved_at, resolved_by
+		FROM help_requests `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []HelpRequestData{}
+	for rows.Next() {
+		var h HelpRequestData
+		var claimedAt, resolvedAt sql.NullTime
+		var claimedBy, resolvedBy sql.NullString
+		err := rows.Scan(&h.ID, &h.ParticipantID, &h.AttemptID, &h.Message, &h.Status, &h.RequestedAt,
+			&claimedAt, &claimedBy, &resolvedAt, &resolvedBy)
+		if err != nil {
+			return nil, err
+		}
+		if claimedAt.Valid {
+			h.ClaimedAt = &claimedAt.Time
+		}
+		if claimedBy.Valid {
+			h.ClaimedBy = &claimedBy.String
+		}
+		if resolvedAt.Valid {
+			h.ResolvedAt = &resolvedAt.Time
+		}
+		if resolvedBy.Valid {
+			h.ResolvedBy = &resolvedBy.String
+		}
+		requests = append(requests, h)
+	}
+
+	return requests, rows.Err()
+}
+
+// OutboxEntry is an event or export waiting to be sent to the coordinator
+type OutboxEntry struct {
+	ID       int
+	EventID  string
+	Path     string
+	Payload  []byte
+	Attempts int
+}
+
+// EnqueueOutbox queues a payload to be POSTed to a coordinator path
+func (edb *ExamDeliveryDB) EnqueueOutbox(eventID, path string, payload []byte) error {
+	_, err := edb.db.Exec(`INSERT INTO outbox (event_id, path, payload, created_at) VALUES (?, ?, ?, ?)`,
+		eventID, path, string(payload), time.Now())
+	return err
+}
+
+// NextOutboxEntry returns the oldest entry that was neither sent nor discarded, or nil when the outbox is empty
+func (edb *ExamDeliveryDB) NextOutboxEntry() (*OutboxEntry, error) {
+	var entry OutboxEntry
+	var payload string
+	err := edb.db.QueryRow(`
+		SELECT id, event_id, path, payload, attempts FROM outbox
+		WHERE sent_at IS NULL AND discarded_at IS NULL
+		ORDER BY id LIMIT 1
+	`).Scan(&entry.ID, &entry.EventID, &entry.Path, &payload, &entry.Attempts)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry.Payload = []byte(payload)
+	return &entry, nil
+}
+
+// MarkOutboxSent records that the coordinator accepted an entry
+func (edb *ExamDeliveryDB) MarkOutboxSent(id int) error {
+	_, err := edb.db.Exec(`UPDATE outbox SET attempts = attempts + 1, last_error = NULL, sent_at = ? WHERE id = ?`, time.Now(), id)
+	return err
+}
+
+// RecordOutboxFailure records a failed send of an entry that will be retried
+func (edb *ExamDeliveryDB) RecordOutboxFailure(id int, sendErr error) error {
+	_, err := edb.db.Exec(`UPDATE outbox SET attempts = attempts + 1, last_error = ? WHERE id = ?`, sendErr.Error(), id)
+	return err
+}
+
+// DiscardOutboxEntry gives up on an entry the coordinator rejected, so it no longer blocks the entries after it
+func (edb *ExamDeliveryDB) DiscardOutboxEntry(id int, sendErr error) error {
+	_, err := edb.db.Exec(`UPDATE outbox SET attempts = attempts + 1, last_error = ?, discarded_at = ? WHERE id = ?`,
+		sendErr.Error(), time.Now(), id)
+	return err
+}
+
+// OutboxBacklog counts the entries waiting to be sent
+func (edb *ExamDeliveryDB) OutboxBacklog() (int, error) {
+	var count int
+	err := edb.db.QueryRow(`SELECT COUNT(*) FROM outbox WHERE sent_at IS NULL AND discarded_at IS NULL`).Scan(&count)
+	return count, err
+}
+
 // GetLiveProgress returns live progress for all participants
 func (edb *ExamDeliveryDB) GetLiveProgress() ([]LiveProgressResponse, error) {
 	query := `
@@ -423,7 +1674,7 @@ func (edb *ExamDeliveryDB) ExportAllData() (map[string]interface{}, error) {
 
 	// Get all attempts
 	attempts := []AttemptData{}
-	query := `SELECT id, participant_id, started_at, ended_at, current_question, status FROM attempts`
+	query := `SELECT id, participant_id, started_at, ended_at, current_question, status, force_submitted FROM attempts`
 	rows, err := edb.db.Query(query)
 	if err != nil {
 		return nil, err
@@ -433,7 +1684,7 @@ func (edb *ExamDeliveryDB) ExportAllData() (map[string]interface{}, error) {
 	for rows.Next() {
 		var a AttemptData
 		var startedAt, endedAt sql.NullTime
-		err := rows.Scan(&a.ID, &a.ParticipantID, &startedAt, &endedAt, &a.CurrentQuestion, &a.Status)
+		err := rows.Scan(&a.ID, &a.ParticipantID, &startedAt, &endedAt, &a.CurrentQuestion, &a.Status, &a.ForceSubmitted)
 		if err != nil {
 			return nil, err
 		}
@@ -448,7 +1699,7 @@ func (edb *ExamDeliveryDB) ExportAllData() (map[string]interface{}, error) {
 
 	// Get all answers
 	answers := []AnswerData{}
-	answerQuery := `SELECT id, attempt_id, question_id, answer, submitted_at, score FROM answers`
+	answerQuery := `SELECT id, attempt_id, question_id, answer, submitted_at, score, time_spent, visits, answer_changes, flagged, flagged_at FROM answers`
 	answerRows, err := edb.db.Query(answerQuery)
 	if err != nil {
 		return nil, err
@@ -457,13 +1708,54 @@ func (edb *ExamDeliveryDB) ExportAllData() (map[string]interface{}, error) {
 
 	for answerRows.Next() {
 		var a AnswerData
-		err := answerRows.Scan(&a.ID, &a.AttemptID, &a.QuestionID, &a.Answer, &a.SubmittedAt, &a.Score)
+		var flaggedAt sql.NullTime
+		err := answerRows.Scan(&a.ID, &a.AttemptID, &a.QuestionID, &a.Answer, &a.SubmittedAt, &a.Score,
+			&a.TimeSpent, &a.Visits, &a.AnswerChanges, &a.Flagged, &flaggedAt)
 		if err != nil {
 			return nil, err
 		}
+		if flaggedAt.Valid {
+			a.FlaggedAt = &flaggedAt.Time
+		}
+		if a.Answer, err = edb.openAnswer(a.AttemptID, a.QuestionID, a.Answer); err != nil {
+			return nil, err
+		}
 		answers = append(answers, a)
 	}
 
+	// Get answer history
+	history := []AnswerHistoryData{}
+	historyQuery := `SELECT id, attempt_id, question_id, kind, previous_answer, answer, time_spent, created_at FROM answer_history ORDER BY id`
+	historyRows, err := edb.db.Query(historyQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer historyRows.Close()
+
+	for historyRows.Next() {
+		var h AnswerHistoryData
+		var previousAnswer, answer sql.NullString
+		err := historyRows.Scan(&h.ID, &h.AttemptID, &h.QuestionID, &h.Kind, &previousAnswer, &answer, &h.TimeSpent, &h.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if previousAnswer.Valid {
+			value, err := edb.openAnswer(h.AttemptID, h.QuestionID, previousAnswer.String)
+			if err != nil {
+				return nil, err
+			}
+			h.PreviousAnswer = &value
+		}
+		if answer.Valid {
+			value, err := edb.openAnswer(h.AttemptID, h.QuestionID, answer.String)
+			if err != nil {
+				return nil, err
+			}
+			h.Answer = &value
+		}
+		history = append(history, h)
+	}
+
 	// Get all progress
 	progress := []ProgressData{}
 	progressQuery := `SELECT participant_id, questions_answered, total_questions, current_score, time_remaining, last_activity FROM progress`
@@ -486,12 +1778,27 @@ func (edb *ExamDeliveryDB) ExportAllData() (map[string]interface{}, error) {
 		progress = append(progress, p)
 	}
 
+	// Get proctor messages with their receipts
+	messages, err := edb.GetProctorMessages()
+	if err != nil {
+		return nil, err
+	}
+
+	// Get help requests
+	helpRequests, err := queryHelpRequests(edb.db, `ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+
 	return map[string]interface{}{
-		"delivery_id":  edb.deliveryID,
-		"participants": participants,
-		"attempts":     attempts,
-		"answers":      answers,
-		"progress":     progress,
-		"exported_at":  time.Now(),
+		"delivery_id":      edb.deliveryID,
+		"participants":     participants,
+		"attempts":         attempts,
+		"answers":          answers,
+		"answer_history":   history,
+		"progress":         progress,
+		"proctor_messages": messages,
+		"help_requests":    helpRequests,
+		"exported_at":      time.Now(),
 	}, nil
 }
@@ -2,18 +2,33 @@ package services
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
 )
 
+// networkPolicyRefreshInterval is how often the policy is reloaded from the coordinator, and
+// how often a rejected request may reload it sooner
+const networkPolicyRefreshInterval = 15 * time.Second
+
+// helpRequestInterval is how long an attempt must wait between help requests
+const helpRequestInterval = 15 * time.Second
+
 // ExamDeliveryServer handles HTTP requests for a specific delivery
 type ExamDeliveryServer struct {
 	deliveryID     int
@@ -22,20 +37,78 @@ type ExamDeliveryServer struct {
 	server         *http.Server
 	coordinatorURL string
 	clientID       string
+	credentials    *ClientCredentials
+	channel        *ParticipantChannel
+	outbox         *EventOutbox
+
+	// Network allow-list for participant requests (nil means unrestricted, empty allows none)
+	allowedNetworks []*net.IPNet
+	overrideTakers  map[int]bool
+	policyLoadedAt  time.Time
+	policyMux       sync.RWMutex
+
+	// Last moment an attempt can be started (zero means no limit), and closed when the
+	// coordinator closes the delivery
+	attemptsUntil time.Time
+	finish        chan struct{}
+	finishOnce    sync.Once
+
+	// Last help request of each attempt, to throttle them
+	lastHelpRequest map[int]time.Time
+	helpMux         sync.Mutex
+
+	// Participant requests hold closeMux for reading while they run; closing the delivery
+	// takes it for writing, so no request is still writing once it is closed
+	closeMux sync.RWMutex
+	closed   bool
+
+	// Closed when the server stops, ending the policy refresh
+	stopped  chan struct{}
+	stopOnce sync.Once
 }
 
 // ExamStartRequest represents a request to start an exam
 type ExamStartRequest struct {
-	ParticipantID  int `json:"participant_id"`
-	TotalQuestions int `json:"total_questions"`
+	// Credential is the token the coordinator returned at test-code login; it names the participant
+	Credential     string `json:"credential"`
+	TotalQuestions int    `json:"total_questions"`
 }
 
 // AnswerSubmissionRequest represents an answer submission
 type AnswerSubmissionRequest struct {
-	AttemptID  int    `json:"attempt_id"`
-	QuestionID int    `json:"question_id"`
-	Answer     string `json:"answer"`
-	Score      int    `json:"score"`
+	AttemptID  int     `json:"attempt_id"`
+	QuestionID int     `json:"question_id"`
+	Answer     *string `json:"answer"` // nil records a visit without answering
+	Score      int     `json:"score"`
+	TimeSpent  int     `json:"time_spent"` // seconds spent on the question since it was displayed
+	// Seq numbers the answer writes of an attempt from 1 so retries and late writes are
+	// recognized; 0 submits an unsequenced write
+	Seq int64 `json:"seq"`
+	// IdempotencyKey optionally identifies the write across retries
+	IdempotencyKey string `json:"idempotency_key"`
+}
+
+// AnswerBatchRequest submits the answers queued by the exam UI while it was offline
+type AnswerBatchRequest struct {
+	AttemptID int                       `json:"attempt_id"`
+	Answers   []AnswerSubmissionRequest `json:"answers"`
+}
+
+// maxAnswerBatch limits the answers of one batch submission
+const maxAnswerBatch = 500
+
+// QuestionFlagRequest flags or unflags a question for review
+type QuestionFlagRequest struct {
+	AttemptID  int  `json:"attempt_id"`
+	QuestionID int  `json:"question_id"`
+	Flagged    bool `json:"flagged"`
+}
+
+// HelpRequest is a participant's request for proctor assistance. The attempt is that of the
+// session token; attempt_id, when sent, must match it.
+type HelpRequest struct {
+	AttemptID int    `json:"attempt_id"`
+	Message   string `json:"message"`
 }
 
 // ExamCompleteRequest represents exam completion
@@ -51,14 +124,97 @@ type APIResponse struct {
 }
 
 // NewExamDeliveryServer creates a new HTTP server for a delivery
-func NewExamDeliveryServer(deliveryID, port int, db *ExamDeliveryDB, coordinatorURL, clientID string) *ExamDeliveryServer {
-	return &ExamDeliveryServer{
+func NewExamDeliveryServer(deliveryID, port int, db *ExamDeliveryDB, outbox *EventOutbox, coordinatorURL string, credentials *ClientCredentials) *ExamDeliveryServer {
+	eds := &ExamDeliveryServer{
 		deliveryID:     deliveryID,
 		port:           port,
 		db:             db,
+		outbox:         outbox,
 		coordinatorURL: coordinatorURL,
-		clientID:       clientID,
+		clientID:       credentials.ClientID,
+		credentials:    credentials,
+		finish:         make(chan struct{}),
+		stopped:        make(chan struct{}),
+
+		lastHelpRequest: make(map[int]time.Time),
 	}
+	eds.channel = NewParticipantChannel(db, eds.onMessageAcknowledged)
+	return eds
+}
+
+// SetNetworkPolicy sets the allow-list applied to participant requests. A restricted policy
+// without networks only lets through participants with an override.
+func (eds *ExamDeliveryServer) SetNetworkPolicy(policy *tables.DeliveryNetworkPolicy) error {
+	if policy == nil || (!policy.Restricted && len(policy.AllowedNetworks) == 0) {
+		eds.policyMux.Lock()
+		eds.allowedNetworks = nil
+		eds.overrideTakers = nil
+		eds.policyLoadedAt = time.Now()
+		eds.policyMux.Unlock()
+		return nil
+	}
+
+	networks, err := utils.ParseNetworks(policy.AllowedNetworks)
+	if err != nil {
+		return fmt.Errorf("invalid network policy: %w", err)
+	}
+	if networks == nil {
+		networks = []*net.IPNet{}
+	}
+
+	overrides := make(map[int]bool, len(policy.OverrideTakers))
+	for _, takerID := range policy.OverrideTakers {
+		overrides[takerID] = true
+	}
+
+	eds.policyMux.Lock()
+	eds.allowedNetworks = networks
+	eds.overrideTakers = overrides
+	eds.policyLoadedAt = time.Now()
+	eds.policyMux.Unlock()
+	return nil
+}
+
+// SetAttemptWindow sets the last moment an attempt can be started, for anytime deliveries.
+// It must be set before the server starts.
+func (eds *ExamDeliveryServer) SetAttemptWindow(until time.Time) {
+	eds.attemptsUntil = until
+}
+
+// Finished is closed when the coordinator closes the delivery
+func (eds *ExamDeliveryServer) Finished() <-chan struct{} {
+	return eds.finish
+}
+
+// ForceSubmitAttempts stops accepting participant requests, then completes the attempts
+// still in progress and reports them to the coordinator and the participants
+func (eds *ExamDeliveryServer) ForceSubmitAttempts() (int, error) {
+	eds.closeToParticipants()
+
+	attempts, err := eds.db.ForceSubmitAttempts()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, attempt := range attempts {
+		data := map[string]interface{}{
+			"participant_id": attempt.ParticipantID,
+			"attempt_id":     attempt.ID,
+			"forced":         true,
+		}
+		if progress, err := eds.getParticipantProgress(attempt.ID); err == nil {
+			data["final_score"] = progress.CurrentScore
+			data["total_questions"] = progress.TotalQuestions
+		}
+		eds.pushEventToCoordinator("participant_completed", data)
+
+		eds.channel.Notify(attempt.ParticipantID, map[string]interface{}{
+			"type":       "attempt_submitted",
+			"attempt_id": attempt.ID,
+			"reason":     "delivery_closed",
+		})
+	}
+	return len(attempts), nil
 }
 
 // Start starts the HTTP server
@@ -79,18 +235,34 @@ func (eds *ExamDeliveryServer) Start() error {
 
 	// Participant exam interface routes
 	router.Route("/exam", func(r chi.Router) {
-		r.Post("/start", eds.handleExamStart)
-		r.Get("/question/{id}", eds.handleGetQuestion)
-		r.Post("/answer", eds.handleAnswerSubmission)
-		r.Get("/progress/{participant_id}", eds.handleGetParticipantProgress)
-		r.Post("/complete", eds.handleExamComplete)
+		r.Group(func(r chi.Router) {
+			r.Use(eds.acceptParticipants)
+			r.Post("/start", eds.handleExamStart)
+			r.Get("/question/{id}", eds.handleGetQuestion)
+			r.Post("/answer", eds.handleAnswerSubmission)
+			r.Post("/answers/batch", eds.handleAnswerBatch)
+			r.Get("/answers/ack/{attempt_id}", eds.handleGetAnswerAck)
+			r.Post("/flag", eds.handleQuestionFlag)
+			r.Get("/review/{attempt_id}", eds.handleAttemptReview)
+			r.Get("/progress/{participant_id}", eds.handleGetParticipantProgress)
+			r.Post("/complete", eds.handleExamComplete)
+			r.Post("/help", eds.handleHelpRequest)
+			r.Get("/help/{attempt_id}", eds.handleGetHelpRequests)
+		})
+		// The channel stays open after the delivery closes, to tell participants their attempt was submitted
+		r.Get("/ws", eds.handleParticipantChannel)
 	})
 
-	// Live progress API routes (for coordinator)
+	// Live progress API routes (for coordinator, signed with the client secret)
 	router.Route("/api", func(r chi.Router) {
+		r.Use(eds.requireCoordinatorSignature)
 		r.Get("/progress", eds.handleLiveProgress)
 		r.Get("/participants", eds.handleGetParticipants)
 		r.Get("/delivery-stats", eds.handleGetDeliveryStats)
+		r.Get("/messages", eds.handleGetProctorMessages)
+		r.Post("/messages", eds.handleSendProctorMessage)
+		r.Post("/help/{id}/status", eds.handleHelpRequestStatus)
+		r.Post("/finish", eds.handleFinish)
 	})
 
 	// Health check
@@ -101,12 +273,55 @@ func (eds *ExamDeliveryServer) Start() error {
 		Handler: router,
 	}
 
+	go eds.networkPolicyLoop()
+
 	log.Printf("Starting exam delivery server for delivery %d on port %d", eds.deliveryID, eds.port)
 	return eds.server.ListenAndServe()
 }
 
+// networkPolicyLoop reloads the network policy regularly, so revoked overrides and new rules
+// take effect even while requests are allowed
+func (eds *ExamDeliveryServer) networkPolicyLoop() {
+	ticker := time.NewTicker(networkPolicyRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-eds.stopped:
+			return
+		case <-ticker.C:
+			if err := eds.refreshNetworkPolicy(); err != nil {
+				log.Printf("Failed to refresh network policy for delivery %d: %v", eds.deliveryID, err)
+			}
+		}
+	}
+}
+
+// acceptParticipants rejects participant requests once the delivery is closed
+func (eds *ExamDeliveryServer) acceptParticipants(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		eds.closeMux.RLock()
+		defer eds.closeMux.RUnlock()
+
+		if eds.closed {
+			eds.respondError(w, http.StatusGone, "The delivery is closed")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// closeToParticipants stops accepting participant requests and waits for those running
+func (eds *ExamDeliveryServer) closeToParticipants() {
+	eds.closeMux.Lock()
+	eds.closed = true
+	eds.closeMux.Unlock()
+}
+
 // Stop stops the HTTP server
 func (eds *ExamDeliveryServer) Stop() error {
+	eds.stopOnce.Do(func() { close(eds.stopped) })
+	eds.channel.Close()
 	if eds.server != nil {
 		return eds.server.Close()
 	}
@@ -135,16 +350,51 @@ func (eds *ExamDeliveryServer) handleExamStart(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	attemptID, err := eds.db.StartAttempt(req.ParticipantID, req.TotalQuestions)
+	participantID, err := eds.db.OpenParticipantCredential(req.Credential, time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidCredential):
+			eds.respondError(w, http.StatusUnauthorized, "Invalid or expired login, please log in again")
+		case errors.Is(err, ErrDeliveryKeyUnavailable):
+			eds.respondError(w, http.StatusServiceUnavailable, "Exam content is locked")
+		default:
+			log.Printf("Failed to check participant credential: %v", err)
+			eds.respondError(w, http.StatusInternalServerError, "Failed to start exam")
+		}
+		return
+	}
+
+	if !eds.allowParticipantRequest(w, r, participantID, 0, "start_attempt") {
+		return
+	}
+	if !eds.allowUnheldParticipant(w, participantID) {
+		return
+	}
+
+	// Anytime deliveries only accept attempts within their availability window
+	if !eds.attemptsUntil.IsZero() && time.Now().After(eds.attemptsUntil) {
+		eds.respondError(w, http.StatusForbidden, "The delivery no longer accepts new attempts")
+		return
+	}
+
+	attemptID, err := eds.db.StartAttempt(participantID, req.TotalQuestions)
 	if err != nil {
 		log.Printf("Failed to start attempt: %v", err)
 		eds.respondError(w, http.StatusInternalServerError, "Failed to start exam")
 		return
 	}
 
+	// Session token for the participant channel
+	sessionToken, err := eds.db.CreateParticipantSession(participantID, attemptID)
+	if err != nil {
+		log.Printf("Failed to create participant session: %v", err)
+		eds.respondError(w, http.StatusInternalServerError, "Failed to start exam")
+		return
+	}
+
 	// Push event to coordinator
-	go eds.pushEventToCoordinator("participant_started", map[string]interface{}{
-		"participant_id": req.ParticipantID,
+	eds.pushEventToCoordinator("participant_started", map[string]interface{}{
+		"participant_id": participantID,
 		"attempt_id":     attemptID,
 	})
 
@@ -152,13 +402,15 @@ func (eds *ExamDeliveryServer) handleExamStart(w http.ResponseWriter, r *http.Re
 		Success: true,
 		Message: "Exam started successfully",
 		Data: map[string]interface{}{
-			"attempt_id": attemptID,
+			"attempt_id":    attemptID,
+			"session_token": sessionToken,
 		},
 	}
 	eds.respondJSON(w, http.StatusOK, response)
 }
 
-// Handle get question (placeholder - would serve actual exam content)
+// Handle get question. Questions are only served with a participant session token, from the
+// allowed networks.
 func (eds *ExamDeliveryServer) handleGetQuestion(w http.ResponseWriter, r *http.Request) {
 	questionIDStr := chi.URLParam(r, "id")
 	questionID, err := strconv.Atoi(questionIDStr)
@@ -167,15 +419,33 @@ func (eds *ExamDeliveryServer) handleGetQuestion(w http.ResponseWriter, r *http.
 		return
 	}
 
-	// TODO: Implement actual question serving from cached exam data
+	participantID, attemptID, ok := eds.authenticateParticipant(w, r)
+	if !ok {
+		return
+	}
+	if !eds.allowParticipantRequest(w, r, participantID, attemptID, "get_question") {
+		return
+	}
+
+	// Questions are decrypted with the delivery key on every request, never cached in the clear
+	question, err := eds.db.GetQuestion(questionID)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			eds.respondError(w, http.StatusNotFound, "Question not found")
+		case errors.Is(err, ErrDeliveryKeyUnavailable):
+			eds.respondError(w, http.StatusServiceUnavailable, "Exam content is locked")
+		default:
+			log.Printf("Failed to get question %d: %v", questionID, err)
+			eds.respondError(w, http.StatusInternalServerError, "Failed to get question")
+		}
+		return
+	}
+
 	response := APIResponse{
 		Success: true,
 		Message: "Question retrieved successfully",
-		Data: map[string]interface{}{
-			"question_id": questionID,
-			"question":    "Sample question content would go here",
-			"options":     []string{"Option A", "Option B", "Option C", "Option D"},
-		},
+		Data:    question,
 	}
 	eds.respondJSON(w, http.StatusOK, response)
 }
@@ -188,29 +458,296 @@ func (eds *ExamDeliveryServer) handleAnswerSubmission(w http.ResponseWriter, r *
 		return
 	}
 
-	err := eds.db.SubmitAnswer(req.AttemptID, req.QuestionID, req.Answer, req.Score)
+	participantID, attemptID, ok := eds.authenticateAttempt(w, r, req.AttemptID)
+	if !ok {
+		return
+	}
+	req.AttemptID = attemptID
+
+	if !eds.allowParticipantRequest(w, r, participantID, req.AttemptID, "save_answer") {
+		return
+	}
+	if !eds.allowUnheldParticipant(w, participantID) {
+		return
+	}
+
+	if req.TimeSpent < 0 {
+		eds.respondError(w, http.StatusBadRequest, "Invalid time spent")
+		return
+	}
+
+	if req.Seq < 0 {
+		eds.respondError(w, http.StatusBadRequest, "Invalid sequence number")
+		return
+	}
+
+	result, err := eds.db.SubmitAnswer(&req)
 	if err != nil {
+		if errors.Is(err, ErrSequenceConflict) || errors.Is(err, ErrAttemptNotInProgress) {
+			eds.respondError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if errors.Is(err, ErrDeliveryKeyUnavailable) {
+			eds.respondError(w, http.StatusServiceUnavailable, "Answers cannot be stored: "+err.Error())
+			return
+		}
 		log.Printf("Failed to submit answer: %v", err)
 		eds.respondError(w, http.StatusInternalServerError, "Failed to submit answer")
 		return
 	}
 
-	// Get updated progress for event
-	progress, err := eds.getParticipantProgress(req.AttemptID)
-	if err == nil {
-		// Push event to coordinator
-		go eds.pushEventToCoordinator("answer_submitted", map[string]interface{}{
-			"attempt_id":         req.AttemptID,
-			"question_id":        req.QuestionID,
-			"questions_answered": progress.QuestionsAnswered,
-			"current_score":      progress.CurrentScore,
-			"total_questions":    progress.TotalQuestions,
-		})
+	// A retried write was already reported
+	if !result.Duplicate {
+		eds.pushAnswerSubmitted(participantID, req.AttemptID, req.QuestionID, result.Kind, req.TimeSpent)
+	}
+
+	ack, err := eds.answerAck(req.AttemptID)
+	if err != nil {
+		log.Printf("Failed to get answer ack: %v", err)
+		eds.respondError(w, http.StatusInternalServerError, "Failed to get answer ack")
+		return
 	}
+	ack["result"] = result
 
 	response := APIResponse{
 		Success: true,
 		Message: "Answer submitted successfully",
+		Data:    ack,
+	}
+	eds.respondJSON(w, http.StatusOK, response)
+}
+
+// Handle a batch of answers queued while the exam UI was offline. The answers are applied in
+// sequence order, so the last write wins regardless of the order in which they were queued.
+func (eds *ExamDeliveryServer) handleAnswerBatch(w http.ResponseWriter, r *http.Request) {
+	var req AnswerBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		eds.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if len(req.Answers) == 0 || len(req.Answers) > maxAnswerBatch {
+		eds.respondError(w, http.StatusBadRequest, fmt.Sprintf("A batch must contain 1 to %d answers", maxAnswerBatch))
+		return
+	}
+
+	participantID, attemptID, ok := eds.authenticateAttempt(w, r, req.AttemptID)
+	if !ok {
+		return
+	}
+	req.AttemptID = attemptID
+
+	if !eds.allowParticipantRequest(w, r, participantID, req.AttemptID, "save_answer") {
+		return
+	}
+	if !eds.allowUnheldParticipant(w, participantID) {
+		return
+	}
+
+	for i := range req.Answers {
+		answer := &req.Answers[i]
+		if answer.Seq <= 0 {
+			eds.respondError(w, http.StatusBadRequest, "Every batched answer needs a sequence number")
+			return
+		}
+		if answer.TimeSpent < 0 {
+			eds.respondError(w, http.StatusBadRequest, "Invalid time spent")
+			return
+		}
+		answer.AttemptID = req.AttemptID
+	}
+
+	results, err := eds.db.SubmitAnswers(req.Answers)
+	if err != nil {
+		if errors.Is(err, ErrSequenceConflict) || errors.Is(err, ErrAttemptNotInProgress) {
+			eds.respondError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if errors.Is(err, ErrDeliveryKeyUnavailable) {
+			eds.respondError(w, http.StatusServiceUnavailable, "Answers cannot be stored: "+err.Error())
+			return
+		}
+		log.Printf("Failed to submit answer batch: %v", err)
+		eds.respondError(w, http.StatusInternalServerError, "Failed to submit answers")
+		return
+	}
+
+	timeSpent := make(map[int64]int, len(req.Answers))
+	for _, answer := range req.Answers {
+		timeSpent[answer.Seq] = answer.TimeSpent
+	}
+	for _, result := range results {
+		if !result.Duplicate {
+			eds.pushAnswerSubmitted(participantID, req.AttemptID, result.QuestionID, result.Kind, timeSpent[result.Seq])
+		}
+	}
+
+	ack, err := eds.answerAck(req.AttemptID)
+	if err != nil {
+		log.Printf("Failed to get answer ack: %v", err)
+		eds.respondError(w, http.StatusInternalServerError, "Failed to get answer ack")
+		return
+	}
+	ack["results"] = results
+
+	response := APIResponse{
+		Success: true,
+		Message: "Answers submitted successfully",
+		Data:    ack,
+	}
+	eds.respondJSON(w, http.StatusOK, response)
+}
+
+// Handle get answer ack, used by the exam UI after a reconnect to find the answers it must resend
+func (eds *ExamDeliveryServer) handleGetAnswerAck(w http.ResponseWriter, r *http.Request) {
+	attemptID, err := strconv.Atoi(chi.URLParam(r, "attempt_id"))
+	if err != nil {
+		eds.respondError(w, http.StatusBadRequest, "Invalid attempt ID")
+		return
+	}
+
+	if _, _, ok := eds.authenticateAttempt(w, r, attemptID); !ok {
+		return
+	}
+
+	ack, err := eds.answerAck(attemptID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			eds.respondError(w, http.StatusNotFound, "Attempt not found")
+			return
+		}
+		log.Printf("Failed to get answer ack: %v", err)
+		eds.respondError(w, http.StatusInternalServerError, "Failed to get answer ack")
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Message: "Answer ack retrieved successfully",
+		Data:    ack,
+	}
+	eds.respondJSON(w, http.StatusOK, response)
+}
+
+// answerAck reports the highest sequence number up to which every answer write was applied
+// and the highest sequence number applied
+func (eds *ExamDeliveryServer) answerAck(attemptID int) (map[string]interface{}, error) {
+	acked, max, err := eds.db.GetAnswerAck(attemptID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"attempt_id": attemptID,
+		"acked_seq":  acked,
+		"max_seq":    max,
+	}, nil
+}
+
+// pushAnswerSubmitted reports an applied answer write with the updated progress to the coordinator
+func (eds *ExamDeliveryServer) pushAnswerSubmitted(participantID, attemptID, questionID int, kind string, timeSpent int) {
+	progress, err := eds.getParticipantProgress(attemptID)
+	if err != nil {
+		return
+	}
+
+	eds.pushEventToCoordinator("answer_submitted", map[string]interface{}{
+		"participant_id":     participantID,
+		"attempt_id":         attemptID,
+		"question_id":        questionID,
+		"kind":               kind,
+		"time_spent":         timeSpent,
+		"questions_answered": progress.QuestionsAnswered,
+		"current_score":      progress.CurrentScore,
+		"total_questions":    progress.TotalQuestions,
+	})
+}
+
+// Handle question flag
+func (eds *ExamDeliveryServer) handleQuestionFlag(w http.ResponseWriter, r *http.Request) {
+	var req QuestionFlagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		eds.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	participantID, attemptID, ok := eds.authenticateAttempt(w, r, req.AttemptID)
+	if !ok {
+		return
+	}
+	req.AttemptID = attemptID
+
+	if !eds.allowParticipantRequest(w, r, participantID, req.AttemptID, "flag_question") {
+		return
+	}
+	if !eds.allowUnheldParticipant(w, participantID) {
+		return
+	}
+
+	if err := eds.db.SetQuestionFlag(req.AttemptID, req.QuestionID, req.Flagged); err != nil {
+		if errors.Is(err, ErrAttemptNotInProgress) {
+			eds.respondError(w, http.StatusConflict, err.Error())
+			return
+		}
+		log.Printf("Failed to flag question: %v", err)
+		eds.respondError(w, http.StatusInternalServerError, "Failed to flag question")
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Message: "Question flag updated successfully",
+		Data: map[string]interface{}{
+			"question_id": req.QuestionID,
+			"flagged":     req.Flagged,
+		},
+	}
+	eds.respondJSON(w, http.StatusOK, response)
+}
+
+// Handle attempt review. The optional question_ids query parameter (comma separated)
+// lets the exam UI list unanswered questions the database has not seen yet.
+func (eds *ExamDeliveryServer) handleAttemptReview(w http.ResponseWriter, r *http.Request) {
+	attemptID, err := strconv.Atoi(chi.URLParam(r, "attempt_id"))
+	if err != nil {
+		eds.respondError(w, http.StatusBadRequest, "Invalid attempt ID")
+		return
+	}
+
+	participantID, _, ok := eds.authenticateAttempt(w, r, attemptID)
+	if !ok {
+		return
+	}
+	if !eds.allowParticipantRequest(w, r, participantID, attemptID, "attempt_review") {
+		return
+	}
+
+	var questionIDs []int
+	if raw := r.URL.Query().Get("question_ids"); raw != "" {
+		for _, part := range strings.Split(raw, ",") {
+			questionID, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				eds.respondError(w, http.StatusBadRequest, "Invalid question IDs")
+				return
+			}
+			questionIDs = append(questionIDs, questionID)
+		}
+	}
+
+	review, err := eds.db.GetAttemptReview(attemptID, questionIDs)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			eds.respondError(w, http.StatusNotFound, "Attempt not found")
+			return
+		}
+		log.Printf("Failed to get attempt review: %v", err)
+		eds.respondError(w, http.StatusInternalServerError, "Failed to get attempt review")
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Message: "Attempt review retrieved successfully",
+		Data:    review,
 	}
 	eds.respondJSON(w, http.StatusOK, response)
 }
@@ -248,6 +785,12 @@ func (eds *ExamDeliveryServer) handleExamComplete(w http.ResponseWriter, r *http
 		return
 	}
 
+	_, attemptID, ok := eds.authenticateAttempt(w, r, req.AttemptID)
+	if !ok {
+		return
+	}
+	req.AttemptID = attemptID
+
 	err := eds.db.CompleteAttempt(req.AttemptID)
 	if err != nil {
 		log.Printf("Failed to complete attempt: %v", err)
@@ -259,7 +802,8 @@ func (eds *ExamDeliveryServer) handleExamComplete(w http.ResponseWriter, r *http
 	progress, err := eds.getParticipantProgress(req.AttemptID)
 	if err == nil {
 		// Push event to coordinator
-		go eds.pushEventToCoordinator("participant_completed", map[string]interface{}{
+		eds.pushEventToCoordinator("participant_completed", map[string]interface{}{
+			"participant_id":  progress.ParticipantID,
 			"attempt_id":      req.AttemptID,
 			"final_score":     progress.CurrentScore,
 			"total_questions": progress.TotalQuestions,
@@ -273,6 +817,205 @@ func (eds *ExamDeliveryServer) handleExamComplete(w http.ResponseWriter, r *http
 	eds.respondJSON(w, http.StatusOK, response)
 }
 
+// Handle help request. A participant may ask for help even while paused or locked, with the
+// session token from /exam/start, at most once per helpRequestInterval.
+func (eds *ExamDeliveryServer) handleHelpRequest(w http.ResponseWriter, r *http.Request) {
+	var req HelpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		eds.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	participantID, attemptID, ok := eds.authenticateAttempt(w, r, req.AttemptID)
+	if !ok {
+		return
+	}
+	req.AttemptID = attemptID
+
+	if !eds.allowParticipantRequest(w, r, participantID, req.AttemptID, "request_help") {
+		return
+	}
+	if !eds.allowHelpRequest(req.AttemptID) {
+		eds.respondError(w, http.StatusTooManyRequests, "Please wait before asking for help again")
+		return
+	}
+
+	message := []rune(strings.TrimSpace(req.Message))
+	if len(message) > 500 {
+		message = message[:500]
+	}
+
+	helpRequest, created, err := eds.db.CreateHelpRequest(participantID, req.AttemptID, string(message))
+	if err != nil {
+		log.Printf("Failed to create help request: %v", err)
+		eds.respondError(w, http.StatusInternalServerError, "Failed to request help")
+		return
+	}
+
+	if created {
+		// Push event to coordinator
+		eds.pushEventToCoordinator("help_requested", map[string]interface{}{
+			"participant_id":  participantID,
+			"attempt_id":      req.AttemptID,
+			"help_request_id": helpRequest.ID,
+			"message":         helpRequest.Message,
+			"requested_at":    helpRequest.RequestedAt,
+		})
+	}
+
+	response := APIResponse{
+		Success: true,
+		Message: "Help requested, a proctor will come to you",
+		Data:    helpRequest,
+	}
+	eds.respondJSON(w, http.StatusOK, response)
+}
+
+// Handle get help requests of an attempt's participant
+func (eds *ExamDeliveryServer) handleGetHelpRequests(w http.ResponseWriter, r *http.Request) {
+	attemptID, err := strconv.Atoi(chi.URLParam(r, "attempt_id"))
+	if err != nil {
+		eds.respondError(w, http.StatusBadRequest, "Invalid attempt ID")
+		return
+	}
+
+	participantID, _, ok := eds.authenticateAttempt(w, r, attemptID)
+	if !ok {
+		return
+	}
+
+	requests, err := eds.db.GetHelpRequests(participantID)
+	if err != nil {
+		log.Printf("Failed to get help requests: %v", err)
+		eds.respondError(w, http.StatusInternalServerError, "Failed to get help requests")
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Message: "Help requests retrieved successfully",
+		Data:    requests,
+	}
+	eds.respondJSON(w, http.StatusOK, response)
+}
+
+// Handle help request status (for coordinator). The participant is told over the
+// participant channel that a proctor is coming or that the request was closed.
+func (eds *ExamDeliveryServer) handleHelpRequestStatus(w http.ResponseWriter, r *http.Request) {
+	requestID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		eds.respondError(w, http.StatusBadRequest, "Invalid help request ID")
+		return
+	}
+
+	var req tables.HelpRequestStatusUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		eds.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Status != tables.HelpRequestClaimed && req.Status != tables.HelpRequestResolved {
+		eds.respondError(w, http.StatusBadRequest, "Invalid help request status")
+		return
+	}
+
+	helpRequest, err := eds.db.UpdateHelpRequestStatus(requestID, req.Status, req.By)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			eds.respondError(w, http.StatusNotFound, "Help request not found")
+			return
+		}
+		log.Printf("Failed to update help request: %v", err)
+		eds.respondError(w, http.StatusInternalServerError, "Failed to update help request")
+		return
+	}
+
+	eds.channel.Notify(helpRequest.ParticipantID, map[string]interface{}{
+		"type":         "help_request",
+		"help_request": helpRequest,
+	})
+
+	response := APIResponse{
+		Success: true,
+		Message: "Help request updated successfully",
+		Data:    helpRequest,
+	}
+	eds.respondJSON(w, http.StatusOK, response)
+}
+
+// Handle participant channel. The session token from /exam/start is passed as the token
+// query parameter (browsers cannot set headers on WebSocket requests) or as a bearer token.
+func (eds *ExamDeliveryServer) handleParticipantChannel(w http.ResponseWriter, r *http.Request) {
+	participantID, attemptID, ok := eds.authenticateParticipant(w, r)
+	if !ok {
+		return
+	}
+
+	if !eds.allowParticipantRequest(w, r, participantID, attemptID, "open_channel") {
+		return
+	}
+
+	eds.channel.Serve(w, r, participantID, attemptID)
+}
+
+// Handle send proctor message (for coordinator)
+func (eds *ExamDeliveryServer) handleSendProctorMessage(w http.ResponseWriter, r *http.Request) {
+	var req tables.ProctorMessageDispatch
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		eds.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.ValidateProctorMessage(&req.ProctorMessageRequest); err != nil {
+		eds.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	message, recipients, err := eds.db.CreateProctorMessage(&req)
+	if err != nil {
+		if errors.Is(err, ErrUnknownParticipant) {
+			eds.respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("Failed to create proctor message: %v", err)
+		eds.respondError(w, http.StatusInternalServerError, "Failed to send message")
+		return
+	}
+
+	message.Delivered = eds.channel.Send(message, recipients)
+
+	response := APIResponse{
+		Success: true,
+		Message: "Message sent successfully",
+		Data:    message,
+	}
+	eds.respondJSON(w, http.StatusOK, response)
+}
+
+// Handle get proctor messages (for coordinator)
+func (eds *ExamDeliveryServer) handleGetProctorMessages(w http.ResponseWriter, r *http.Request) {
+	messages, err := eds.db.GetProctorMessages()
+	if err != nil {
+		log.Printf("Failed to get proctor messages: %v", err)
+		eds.respondError(w, http.StatusInternalServerError, "Failed to get messages")
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Message: "Messages retrieved successfully",
+		Data:    messages,
+	}
+	eds.respondJSON(w, http.StatusOK, response)
+}
+
+// onMessageAcknowledged reports a participant's acknowledgement to the coordinator
+func (eds *ExamDeliveryServer) onMessageAcknowledged(messageID, participantID int) {
+	eds.pushEventToCoordinator("message_acknowledged", map[string]interface{}{
+		"participant_id": participantID,
+		"message_id":     messageID,
+	})
+}
+
 // Handle live progress (for coordinator)
 func (eds *ExamDeliveryServer) handleLiveProgress(w http.ResponseWriter, r *http.Request) {
 	progress, err := eds.db.GetLiveProgress()
@@ -324,10 +1067,25 @@ func (eds *ExamDeliveryServer) handleGetDeliveryStats(w http.ResponseWriter, r *
 	eds.respondJSON(w, http.StatusOK, response)
 }
 
+// Handle finish. The coordinator closes the delivery at its end; remaining attempts are
+// force-submitted and the results exported once the delivery stops.
+func (eds *ExamDeliveryServer) handleFinish(w http.ResponseWriter, r *http.Request) {
+	eds.finishOnce.Do(func() {
+		log.Printf("Coordinator closed delivery %d", eds.deliveryID)
+		close(eds.finish)
+	})
+
+	response := APIResponse{
+		Success: true,
+		Message: "Delivery is closing",
+	}
+	eds.respondJSON(w, http.StatusOK, response)
+}
+
 // Helper function to get participant progress by attempt ID
 func (eds *ExamDeliveryServer) getParticipantProgress(attemptID int) (*ProgressData, error) {
 	query := `
-		SELECT p.questions_answered, p.total_questions, p.current_score, p.time_remaining, p.last_activity
+		SELECT p.participant_id, p.questions_answered, p.total_questions, p.current_score, p.time_remaining, p.last_activity
 		FROM progress p
 		JOIN attempts a ON p.participant_id = a.participant_id
 		WHERE a.id = ?
@@ -336,6 +1094,7 @@ func (eds *ExamDeliveryServer) getParticipantProgress(attemptID int) (*ProgressD
 	var progress ProgressData
 	var lastActivity *time.Time
 	err := eds.db.db.QueryRow(query, attemptID).Scan(
+		&progress.ParticipantID,
 		&progress.QuestionsAnswered,
 		&progress.TotalQuestions,
 		&progress.CurrentScore,
@@ -376,32 +1135,192 @@ func (eds *ExamDeliveryServer) getParticipantProgressByID(participantID int) (*P
 	return &progress, nil
 }
 
-// Push event to coordinator
-func (eds *ExamDeliveryServer) pushEventToCoordinator(eventType string, data map[string]interface{}) {
-	event := map[string]interface{}{
-		"event_type":  eventType,
-		"delivery_id": eds.deliveryID,
-		"client_id":   eds.clientID,
-		"data":        data,
-		"timestamp":   time.Now(),
+// authenticateParticipant gets the participant and attempt of the session token from
+// /exam/start, sent as the token query parameter or as a bearer token. It answers 401 and
+// returns false without a valid token.
+func (eds *ExamDeliveryServer) authenticateParticipant(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if token == "" {
+		eds.respondError(w, http.StatusUnauthorized, "Session token is required")
+		return 0, 0, false
 	}
 
-	eventJSON, err := json.Marshal(event)
+	participantID, attemptID, err := eds.db.GetParticipantSession(token)
 	if err != nil {
-		log.Printf("Failed to marshal event: %v", err)
-		return
+		if err == sql.ErrNoRows {
+			eds.respondError(w, http.StatusUnauthorized, "Invalid session token")
+			return 0, 0, false
+		}
+		log.Printf("Failed to get participant session: %v", err)
+		eds.respondError(w, http.StatusInternalServerError, "Failed to check session token")
+		return 0, 0, false
+	}
+	return participantID, attemptID, true
+}
+
+// authenticateAttempt authenticates the session token like authenticateParticipant and
+// answers 403 when the request names another attempt than the session's. An attempt ID of 0
+// stands for the session's attempt, which is returned.
+func (eds *ExamDeliveryServer) authenticateAttempt(w http.ResponseWriter, r *http.Request, attemptID int) (int, int, bool) {
+	participantID, sessionAttemptID, ok := eds.authenticateParticipant(w, r)
+	if !ok {
+		return 0, 0, false
 	}
+	if attemptID != 0 && attemptID != sessionAttemptID {
+		eds.respondError(w, http.StatusForbidden, "The session token is for another attempt")
+		return 0, 0, false
+	}
+	return participantID, sessionAttemptID, true
+}
+
+// allowHelpRequest reports whether an attempt may ask for help again, and if so records it
+func (eds *ExamDeliveryServer) allowHelpRequest(attemptID int) bool {
+	eds.helpMux.Lock()
+	defer eds.helpMux.Unlock()
+
+	if last, ok := eds.lastHelpRequest[attemptID]; ok && time.Since(last) < helpRequestInterval {
+		return false
+	}
+	eds.lastHelpRequest[attemptID] = time.Now()
+	return true
+}
+
+// allowParticipantRequest enforces the network allow-list. Rejected requests get a
+// 403 response and are reported to the coordinator.
+func (eds *ExamDeliveryServer) allowParticipantRequest(w http.ResponseWriter, r *http.Request, participantID, attemptID int, action string) bool {
+	ip := utils.RemoteIP(r.RemoteAddr)
 
-	url := fmt.Sprintf("%s/api/internal/exam-clients/event", eds.coordinatorURL)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(eventJSON))
+	if eds.isNetworkAllowed(ip, participantID) {
+		return true
+	}
+
+	// A proctor may have granted an override since the policy was loaded
+	eds.policyMux.RLock()
+	stale := time.Since(eds.policyLoadedAt) > networkPolicyRefreshInterval
+	eds.policyMux.RUnlock()
+	if stale {
+		if err := eds.refreshNetworkPolicy(); err != nil {
+			log.Printf("Failed to refresh network policy for delivery %d: %v", eds.deliveryID, err)
+		} else if eds.isNetworkAllowed(ip, participantID) {
+			return true
+		}
+	}
+
+	log.Printf("Rejected %s for delivery %d from %s (participant %d)", action, eds.deliveryID, ip, participantID)
+
+	data := map[string]interface{}{
+		"participant_id": participantID,
+		"ip_address":     ip,
+		"action":         action,
+	}
+	if attemptID > 0 {
+		data["attempt_id"] = attemptID
+	}
+	eds.pushEventToCoordinator("access_denied", data)
+
+	eds.respondError(w, http.StatusForbidden, "This exam is not available from your network")
+	return false
+}
+
+// allowUnheldParticipant rejects requests of participants a proctor has paused or locked
+func (eds *ExamDeliveryServer) allowUnheldParticipant(w http.ResponseWriter, participantID int) bool {
+	paused, locked, err := eds.db.GetParticipantHold(participantID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get hold status of participant %d: %v", participantID, err)
+		eds.respondError(w, http.StatusInternalServerError, "Failed to check exam status")
+		return false
+	}
+
+	switch {
+	case locked:
+		eds.respondError(w, http.StatusLocked, "Your exam has been locked by the proctor")
+		return false
+	case paused:
+		eds.respondError(w, http.StatusLocked, "Your exam is paused by the proctor")
+		return false
+	}
+	return true
+}
+
+// isNetworkAllowed checks an address against the current policy
+func (eds *ExamDeliveryServer) isNetworkAllowed(ip string, participantID int) bool {
+	eds.policyMux.RLock()
+	defer eds.policyMux.RUnlock()
+
+	if eds.allowedNetworks == nil {
+		return true
+	}
+	if eds.overrideTakers[participantID] {
+		return true
+	}
+	return utils.IPInNetworks(ip, eds.allowedNetworks)
+}
+
+// refreshNetworkPolicy reloads the allow-list from the coordinator
+func (eds *ExamDeliveryServer) refreshNetworkPolicy() error {
+	url := fmt.Sprintf("%s/api/internal/exam-clients/deliveries/%d/network-policy", eds.coordinatorURL, eds.deliveryID)
+	req, err := eds.credentials.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		log.Printf("Failed to push event to coordinator: %v", err)
-		return
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("Event push failed with status: %d", resp.StatusCode)
+		return fmt.Errorf("coordinator returned status %d", resp.StatusCode)
+	}
+
+	var policy tables.DeliveryNetworkPolicy
+	if err := json.NewDecoder(resp.Body).Decode(&policy); err != nil {
+		return err
+	}
+
+	return eds.SetNetworkPolicy(&policy)
+}
+
+// requireCoordinatorSignature only lets through requests the coordinator signed with the client
+// secret, each once: a signed /api/finish or other call cannot be replayed
+func (eds *ExamDeliveryServer) requireCoordinatorSignature(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			eds.respondError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+		if err := eds.credentials.Verify(r, body, now); err != nil {
+			eds.respondError(w, http.StatusUnauthorized, "Coordinator signature required: "+err.Error())
+			return
+		}
+		if !eds.credentials.UseNonce(r, now) {
+			eds.respondError(w, http.StatusUnauthorized, "Replayed request")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Push event to coordinator. The event is queued in the outbox, which sends the events of
+// the delivery in the order they were pushed.
+func (eds *ExamDeliveryServer) pushEventToCoordinator(eventType string, data map[string]interface{}) {
+	event := map[string]interface{}{
+		"event_type":  eventType,
+		"delivery_id": eds.deliveryID,
+		"client_id":   eds.clientID,
+		"data":        data,
+		"timestamp":   time.Now(),
+	}
+
+	if _, err := eds.outbox.Enqueue("/api/internal/exam-clients/event", event); err != nil {
+		log.Printf("Failed to queue %s event: %v", eventType, err)
 	}
 }
 
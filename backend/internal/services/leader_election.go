@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"log"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/database"
+)
+
+// SchedulerLockID is the advisory lock key held by the coordinator replica running the scheduler
+const SchedulerLockID int64 = 0x6d65_6478_7363_6864 // "medxschd"
+
+// LeaderElection runs a task on one coordinator replica at a time. The leader holds a
+// PostgreSQL session-level advisory lock on a dedicated connection; when the connection is
+// lost the lock is released by the database and another replica takes over.
+type LeaderElection struct {
+	db            *database.DB
+	lockID        int64
+	name          string
+	retryInterval time.Duration
+}
+
+// NewLeaderElection creates a leader election for the task holding lockID
+func NewLeaderElection(db *database.DB, lockID int64, name string) *LeaderElection {
+	return &LeaderElection{
+		db:            db,
+		lockID:        lockID,
+		name:          name,
+		retryInterval: 10 * time.Second,
+	}
+}
+
+// SetRetryInterval sets how often a follower tries to take the lock, and how often the
+// leader checks it still holds it
+func (l *LeaderElection) SetRetryInterval(interval time.Duration) {
+	l.retryInterval = interval
+}
+
+// Run blocks until ctx is done or run returns on its own. While this replica is the
+// leader, run is called with a context that is cancelled when leadership is lost.
+func (l *LeaderElection) Run(ctx context.Context, run func(ctx context.Context)) {
+	ticker := time.NewTicker(l.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		conn, err := l.acquire(ctx)
+		if err != nil {
+			log.Printf("Leader election for %s failed: %v", l.name, err)
+		} else if conn != nil {
+			if stopped := l.lead(ctx, conn, run); stopped {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// acquire tries to take the lock and returns the connection holding it, or nil when
+// another replica is the leader
+func (l *LeaderElection) acquire(ctx context.Context) (*sql.Conn, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, l.lockID).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !acquired {
+		conn.Close()
+		return nil, nil
+	}
+	return conn, nil
+}
+
+// lead runs the task while conn holds the lock. It returns true when the task or ctx
+// ended, and false when leadership was lost and should be contested again.
+func (l *LeaderElection) lead(ctx context.Context, conn *sql.Conn, run func(ctx context.Context)) bool {
+	log.Printf("This replica is now the leader for %s", l.name)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(leaderCtx)
+	}()
+
+	ticker := time.NewTicker(l.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			cancel()
+			l.release(conn)
+			return true
+		case <-ticker.C:
+			// The lock lives as long as the session; a broken connection means it is gone
+			if err := conn.PingContext(leaderCtx); err != nil {
+				log.Printf("Lost leadership for %s: %v", l.name, err)
+				cancel()
+				<-done
+				discard(conn)
+				return ctx.Err() != nil
+			}
+		}
+	}
+}
+
+// release gives up the lock and the connection holding it
+func (l *LeaderElection) release(conn *sql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, l.lockID); err != nil {
+		log.Printf("Failed to release leadership for %s: %v", l.name, err)
+		discard(conn)
+		return
+	}
+	conn.Close()
+	log.Printf("Released leadership for %s", l.name)
+}
+
+// discard closes the database session of conn instead of returning it to the pool, so a
+// lock it may still hold is released
+func discard(conn *sql.Conn) {
+	conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	conn.Close()
+}
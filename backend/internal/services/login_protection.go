@@ -0,0 +1,199 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/config"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// loginFailureRetention is how long failed logins are kept for pattern detection
+const loginFailureRetention = 24 * time.Hour
+
+// LoginBlockedError is a login refused without checking the credentials, because the account
+// or IP address failed too often
+type LoginBlockedError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LoginBlockedError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("login locked for %s", e.RetryAfter)
+	}
+	return fmt.Sprintf("login delayed for %s", e.RetryAfter)
+}
+
+// LoginProtectionService counts failed logins per account, or per IP address and test code
+// for test-code logins, delaying further attempts with a growing backoff and locking out after too many.
+// Suspicious patterns across accounts and IP addresses raise security alerts.
+type LoginProtectionService struct {
+	loginSecurityModel *models.LoginSecurityModel
+	config             *config.Config
+}
+
+func NewLoginProtectionService(loginSecurityModel *models.LoginSecurityModel, config *config.Config) *LoginProtectionService {
+	return &LoginProtectionService{
+		loginSecurityModel: loginSecurityModel,
+		config:             config,
+	}
+}
+
+// throttleIdentifier is what failures of a login are counted against. Test-code logins are
+// counted per IP address and test code, so a participant mistyping their codes does not lock
+// out a venue sharing one address; guessing across codes is held back by the per-IP rate
+// limit and the pattern alerts.
+func throttleIdentifier(scope, identifier, ipAddress string) string {
+	if scope == tables.LoginScopeTestCode {
+		return ipAddress + " " + strings.TrimSpace(identifier)
+	}
+	return strings.ToLower(strings.TrimSpace(identifier))
+}
+
+// Check returns a LoginBlockedError when a login may not be attempted yet
+func (s *LoginProtectionService) Check(scope, identifier, ipAddress string) error {
+	throttle, err := s.loginSecurityModel.GetThrottle(scope, throttleIdentifier(scope, identifier, ipAddress))
+	if err != nil {
+		return err
+	}
+	if throttle == nil {
+		return nil
+	}
+
+	now := time.Now()
+	if throttle.LockedUntil != nil && throttle.LockedUntil.After(now) {
+		return &LoginBlockedError{RetryAfter: throttle.LockedUntil.Sub(now), Locked: true}
+	}
+	if throttle.NextAttemptAt != nil && throttle.NextAttemptAt.After(now) {
+		return &LoginBlockedError{RetryAfter: throttle.NextAttemptAt.Sub(now)}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login and works out when the next attempt is allowed. Failures
+// are forgotten once none happened for the lockout duration. Errors are only logged, since
+// the login fails either way.
+func (s *LoginProtectionService) RecordFailure(scope, identifier, ipAddress string) {
+	now := time.Now()
+	key := throttleIdentifier(scope, identifier, ipAddress)
+
+	throttle, err := s.loginSecurityModel.RecordFailure(scope, key, strings.TrimSpace(identifier), ipAddress, now.Add(-s.config.LoginLockoutDuration))
+	if err != nil {
+		log.Printf("Failed to record login failure for %s %q: %v", scope, key, err)
+		return
+	}
+
+	switch {
+	case throttle.Failures >= s.config.LoginLockoutAfter:
+		lockout := s.config.LoginLockoutDuration << min(throttle.Lockouts, 16)
+		if lockout <= 0 || lockout > s.config.LoginLockoutMax {
+			lockout = s.config.LoginLockoutMax
+		}
+		lockedUntil := now.Add(lockout)
+		if err := s.loginSecurityModel.SetBackoff(throttle.ID, lockedUntil, &lockedUntil); err != nil {
+			log.Printf("Failed to lock out %s %q: %v", scope, key, err)
+		}
+		s.raiseAlert(tables.SecurityAlertLockout, scope, key, ipAddress,
+			fmt.Sprintf("Locked out for %s after %d failed logins", lockout, throttle.Failures))
+
+	case throttle.Failures >= s.config.LoginBackoffAfter:
+		delay := s.config.LoginBackoffBase << min(throttle.Failures-s.config.LoginBackoffAfter, 16)
+		if delay <= 0 || delay > s.config.LoginBackoffMax {
+			delay = s.config.LoginBackoffMax
+		}
+		if err := s.loginSecurityModel.SetBackoff(throttle.ID, now.Add(delay), nil); err != nil {
+			log.Printf("Failed to delay logins of %s %q: %v", scope, key, err)
+		}
+	}
+
+	s.detectPatterns(scope, key, ipAddress, now)
+}
+
+// RecordSuccess clears the failure counter of an account, or of a test code from an IP
+// address, after a successful login
+func (s *LoginProtectionService) RecordSuccess(scope, identifier, ipAddress string) {
+	key := throttleIdentifier(scope, identifier, ipAddress)
+	if err := s.loginSecurityModel.ClearThrottle(scope, key); err != nil {
+		log.Printf("Failed to clear login failures of %s %q: %v", scope, key, err)
+	}
+}
+
+// detectPatterns raises alerts for an IP address failing logins for many accounts or test
+// codes, and for an account failing logins from many IP addresses
+func (s *LoginProtectionService) detectPatterns(scope, key, ipAddress string, now time.Time) {
+	since := now.Add(-s.config.LoginAlertWindow)
+
+	identifiers, err := s.loginSecurityModel.CountIdentifiersByIP(ipAddress, since)
+	if err != nil {
+		log.Printf("Failed to check login failures of IP address %s: %v", ipAddress, err)
+	} else if identifiers >= s.config.LoginAlertIdentifiers {
+		s.raiseAlert(tables.SecurityAlertManyIdentifiers, scope, "", ipAddress,
+			fmt.Sprintf("%d accounts or test codes failed to log in from this IP address in %s", identifiers, s.config.LoginAlertWindow))
+	}
+
+	if scope == tables.LoginScopeTestCode {
+		return
+	}
+
+	addresses, err := s.loginSecurityModel.CountIPsByIdentifier(scope, key, since)
+	if err != nil {
+		log.Printf("Failed to check login failures of %s %q: %v", scope, key, err)
+	} else if addresses >= s.config.LoginAlertAddresses {
+		s.raiseAlert(tables.SecurityAlertManyAddresses, scope, key, "",
+			fmt.Sprintf("Failed to log in from %d IP addresses in %s", addresses, s.config.LoginAlertWindow))
+	}
+}
+
+// raiseAlert stores a security alert, unless the same one is still unacknowledged within the
+// alert window, and logs it
+func (s *LoginProtectionService) raiseAlert(kind, scope, identifier, ipAddress, details string) {
+	alert := &tables.SecurityAlert{
+		Kind:    kind,
+		Scope:   scope,
+		Details: details,
+	}
+	if identifier != "" {
+		alert.Identifier = &identifier
+	}
+	if ipAddress != "" {
+		alert.IPAddress = &ipAddress
+	}
+
+	raised, err := s.loginSecurityModel.CreateAlert(alert, time.Now().Add(-s.config.LoginAlertWindow))
+	if err != nil {
+		log.Printf("Failed to raise %s security alert: %v", kind, err)
+		return
+	}
+	if raised {
+		log.Printf("SECURITY ALERT (%s, %s): identifier=%q ip=%q: %s", kind, scope, identifier, ipAddress, details)
+	}
+}
+
+// ListLockouts gets the accounts and IP addresses that cannot log in right now
+func (s *LoginProtectionService) ListLockouts() ([]tables.LoginThrottle, error) {
+	return s.loginSecurityModel.ListLockouts()
+}
+
+// ClearLockout lets a locked out account or IP address log in again right away
+func (s *LoginProtectionService) ClearLockout(id int) error {
+	return s.loginSecurityModel.ClearLockout(id)
+}
+
+// ListAlerts gets the most recent security alerts
+func (s *LoginProtectionService) ListAlerts(unacknowledged bool, limit int) ([]tables.SecurityAlert, error) {
+	return s.loginSecurityModel.ListAlerts(unacknowledged, limit)
+}
+
+// AcknowledgeAlert marks a security alert as handled
+func (s *LoginProtectionService) AcknowledgeAlert(id, userID int) error {
+	return s.loginSecurityModel.AcknowledgeAlert(id, userID)
+}
+
+// CleanupFailures removes failed logins too old for pattern detection
+func (s *LoginProtectionService) CleanupFailures() error {
+	return s.loginSecurityModel.CleanupFailures(loginFailureRetention)
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/config"
+)
+
+// MailMessage is a plain-text notification to one recipient
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends notifications. Use NewMailer for the configured one, or a MemoryMailer to
+// capture messages instead of sending them.
+type Mailer interface {
+	Send(message MailMessage) error
+}
+
+// NewMailer returns an SMTPMailer when an SMTP server is configured, a LogMailer when asked
+// for outside production, and nil without either
+func NewMailer(cfg *config.Config) (Mailer, error) {
+	if cfg.SMTPHost == "" {
+		if !cfg.MailLog {
+			return nil, nil
+		}
+		if cfg.Environment == "production" {
+			return nil, fmt.Errorf("MAIL_LOG writes reset links to the log and is not allowed in production")
+		}
+		log.Printf("Warning: notifications are written to the log instead of being sent (MAIL_LOG)")
+		return LogMailer{}, nil
+	}
+	return &SMTPMailer{
+		addr:     net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+		host:     cfg.SMTPHost,
+		username: cfg.SMTPUsername,
+		password: cfg.SMTPPassword,
+		from:     cfg.MailFrom,
+	}, nil
+}
+
+// SMTPMailer sends messages through an SMTP server, with STARTTLS when the server offers it
+type SMTPMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+func (m *SMTPMailer) Send(message MailMessage) error {
+	from, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %w", err)
+	}
+
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from.String())
+	fmt.Fprintf(&b, "To: %s\r\n", to.String())
+	fmt.Fprintf(&b, "Subject: %s\r\n", message.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(m.addr, auth, from.Address, []string{to.Address}, []byte(b.String())); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// LogMailer writes messages to the log instead of sending them, for development without an
+// SMTP server. Only used when MAIL_LOG is set, since the messages carry live reset links.
+type LogMailer struct{}
+
+func (LogMailer) Send(message MailMessage) error {
+	log.Printf("Mail to %s: %s\n%s", message.To, message.Subject, message.Body)
+	return nil
+}
+
+// MemoryMailer keeps the messages it is given, for tests
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []MailMessage
+}
+
+func (m *MemoryMailer) Send(message MailMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// Messages returns the messages sent so far
+func (m *MemoryMailer) Messages() []MailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MailMessage(nil), m.messages...)
+}
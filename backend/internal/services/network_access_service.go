@@ -0,0 +1,184 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
+)
+
+// ErrNetworkNotAllowed is returned when a request comes from outside a delivery's allow-list
+var ErrNetworkNotAllowed = errors.New("request origin is not allowed for this delivery")
+
+// ExamClientLocator resolves registered exam-client hosts
+type ExamClientLocator interface {
+	GetClientIP(clientID string) (string, bool)
+}
+
+// venueNetworksTTL is how long the networks of unfinished deliveries are cached
+const venueNetworksTTL = time.Minute
+
+// NetworkAccessService enforces per-delivery IP allow-lists
+type NetworkAccessService struct {
+	networkModel  *models.DeliveryNetworkModel
+	clientLocator ExamClientLocator
+
+	venueNetworks         []*net.IPNet
+	venueNetworksLoadedAt time.Time
+	venueMux              sync.Mutex
+}
+
+// NewNetworkAccessService creates a new network access service
+func NewNetworkAccessService(networkModel *models.DeliveryNetworkModel, clientLocator ExamClientLocator) *NetworkAccessService {
+	return &NetworkAccessService{
+		networkModel:  networkModel,
+		clientLocator: clientLocator,
+	}
+}
+
+// CheckAccess verifies that a participant request from ipAddress is allowed for a delivery.
+// Deliveries without rules are unrestricted. Rejected requests are logged.
+func (s *NetworkAccessService) CheckAccess(deliveryID, takerID int, attemptID *int, ipAddress, action string) error {
+	rules, err := s.networkModel.GetRules(deliveryID)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	if s.matchesRules(rules, ipAddress) {
+		return nil
+	}
+
+	allowed, err := s.networkModel.HasActiveOverride(deliveryID, takerID)
+	if err != nil {
+		return err
+	}
+	if allowed {
+		return nil
+	}
+
+	s.RecordViolation(&tables.DeliveryAccessViolation{
+		DeliveryID: deliveryID,
+		TakerID:    &takerID,
+		AttemptID:  attemptID,
+		IPAddress:  ipAddress,
+		Action:     action,
+		Source:     "coordinator",
+	})
+
+	return ErrNetworkNotAllowed
+}
+
+// IsVenueNetwork reports whether an address is on the allow-list of a delivery not finished
+// yet, such as an exam venue where many participants log in from one address
+func (s *NetworkAccessService) IsVenueNetwork(ipAddress string) bool {
+	s.venueMux.Lock()
+	defer s.venueMux.Unlock()
+
+	if time.Since(s.venueNetworksLoadedAt) > venueNetworksTTL {
+		values, err := s.networkModel.GetOpenNetworks()
+		if err != nil {
+			log.Printf("Failed to get venue networks: %v", err)
+			return false
+		}
+		s.venueNetworks = s.venueNetworks[:0]
+		for _, value := range values {
+			network, err := utils.ParseNetwork(value)
+			if err != nil {
+				continue
+			}
+			s.venueNetworks = append(s.venueNetworks, network)
+		}
+		s.venueNetworksLoadedAt = time.Now()
+	}
+	return utils.IPInNetworks(ipAddress, s.venueNetworks)
+}
+
+// RecordViolation logs a rejected request
+func (s *NetworkAccessService) RecordViolation(violation *tables.DeliveryAccessViolation) {
+	log.Printf("Rejected %s for delivery %d from %s (source: %s)",
+		violation.Action, violation.DeliveryID, violation.IPAddress, violation.Source)
+
+	if err := s.networkModel.LogViolation(violation); err != nil {
+		log.Printf("Failed to record access violation: %v", err)
+	}
+}
+
+// GetPolicy builds the allow-list sent to the exam-client running a delivery.
+// Exam-client host rules are resolved to the hosts' current addresses.
+func (s *NetworkAccessService) GetPolicy(deliveryID int) (*tables.DeliveryNetworkPolicy, error) {
+	rules, err := s.networkModel.GetRules(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &tables.DeliveryNetworkPolicy{
+		AllowedNetworks: []string{},
+		OverrideTakers:  []int{},
+	}
+	if len(rules) == 0 {
+		return policy, nil
+	}
+
+	// Exam-client hosts that cannot be resolved now are left out, but the delivery stays restricted
+	policy.Restricted = true
+	for _, rule := range rules {
+		switch rule.Kind {
+		case tables.NetworkRuleKindCIDR:
+			policy.AllowedNetworks = append(policy.AllowedNetworks, rule.Value)
+		case tables.NetworkRuleKindExamClient:
+			if ip, ok := s.resolveClient(rule.Value); ok {
+				policy.AllowedNetworks = append(policy.AllowedNetworks, ip)
+			}
+		}
+	}
+
+	policy.OverrideTakers, err = s.networkModel.GetActiveOverrideTakers(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+func (s *NetworkAccessService) matchesRules(rules []tables.DeliveryNetworkRule, ipAddress string) bool {
+	for _, rule := range rules {
+		var value string
+		switch rule.Kind {
+		case tables.NetworkRuleKindCIDR:
+			value = rule.Value
+		case tables.NetworkRuleKindExamClient:
+			ip, ok := s.resolveClient(rule.Value)
+			if !ok {
+				continue
+			}
+			value = ip
+		default:
+			continue
+		}
+
+		network, err := utils.ParseNetwork(value)
+		if err != nil {
+			log.Printf("Skipping invalid network rule %d: %v", rule.ID, err)
+			continue
+		}
+		if utils.IPInNetworks(ipAddress, []*net.IPNet{network}) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *NetworkAccessService) resolveClient(clientID string) (string, bool) {
+	if s.clientLocator == nil {
+		return "", false
+	}
+	return s.clientLocator.GetClientIP(clientID)
+}
@@ -0,0 +1,547 @@
+package services
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/config"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
+)
+
+const (
+	// How long the identity provider has to send the user back, and the frontend to
+	// exchange the code it was sent to for the session
+	oidcStateLifetime   = 10 * time.Minute
+	oidcHandoffLifetime = 1 * time.Minute
+	// Minimum time between refreshes of the identity provider's keys when a token is signed
+	// with an unknown key
+	oidcKeysRefreshInterval = 1 * time.Minute
+	// Clock drift between the API and the identity provider allowed when checking tokens
+	oidcClockSkew = 2 * time.Minute
+)
+
+// Reasons a single sign-on failed, passed to the frontend
+const (
+	OIDCErrorNoAccount = "no_account"
+	OIDCErrorCancelled = "cancelled"
+	OIDCErrorFailed    = "failed"
+)
+
+// oidcDiscovery is the part of the identity provider's discovery document that is used
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcTokenResponse is the answer of the token endpoint
+type oidcTokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// oidcIDClaims are the standard claims of an ID token that are checked
+type oidcIDClaims struct {
+	Issuer          string       `json:"iss"`
+	Subject         string       `json:"sub"`
+	Audience        oidcAudience `json:"aud"`
+	AuthorizedParty string       `json:"azp"`
+	ExpiresAt       int64        `json:"exp"`
+	IssuedAt        int64        `json:"iat"`
+	Nonce           string       `json:"nonce"`
+	Email           string       `json:"email"`
+	EmailVerified   any          `json:"email_verified"`
+}
+
+// oidcAudience is the aud claim, a string or an array of strings
+type oidcAudience []string
+
+func (a *oidcAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = oidcAudience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("invalid audience: %w", err)
+	}
+	*a = multiple
+	return nil
+}
+
+// OIDCService signs staff in through an OpenID Connect identity provider with the
+// authorization code flow and PKCE. Users are matched to existing accounts by the claims of
+// their ID token, and can get roles from their groups at the identity provider.
+type OIDCService struct {
+	oidcModel   *models.OIDCModel
+	userModel   *models.UserModel
+	roleModel   *models.RoleModel
+	authService *AuthService
+	config      *config.Config
+	httpClient  *http.Client
+
+	// Identity provider groups mapped to role names, and every mapped role name
+	roleMapping  map[string][]string
+	managedRoles []string
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]crypto.PublicKey
+	keyAlgs       map[string]string
+	keysFetchedAt time.Time
+}
+
+func NewOIDCService(oidcModel *models.OIDCModel, userModel *models.UserModel, roleModel *models.RoleModel, authService *AuthService, config *config.Config) (*OIDCService, error) {
+	s := &OIDCService{
+		oidcModel:   oidcModel,
+		userModel:   userModel,
+		roleModel:   roleModel,
+		authService: authService,
+		config:      config,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		roleMapping: map[string][]string{},
+	}
+
+	for _, pair := range config.OIDCRoleMapping {
+		group, role, ok := strings.Cut(pair, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" || role == "" {
+			return nil, fmt.Errorf("invalid OIDC role mapping %q, expected group=role", pair)
+		}
+		s.roleMapping[group] = append(s.roleMapping[group], role)
+		if !slices.Contains(s.managedRoles, role) {
+			s.managedRoles = append(s.managedRoles, role)
+		}
+	}
+
+	for _, claim := range config.OIDCMatchClaims {
+		if claim != "email" && claim != "username" {
+			return nil, fmt.Errorf("invalid OIDC match claim %q, expected email or username", claim)
+		}
+	}
+	if config.OIDCIssuer != "" && config.OIDCClientID == "" {
+		return nil, fmt.Errorf("OIDC_CLIENT_ID is required with OIDC_ISSUER")
+	}
+	return s, nil
+}
+
+// Enabled reports whether single sign-on is configured
+func (s *OIDCService) Enabled() bool {
+	return s.config.OIDCIssuer != ""
+}
+
+// Status tells the login page whether to offer single sign-on
+func (s *OIDCService) Status() tables.OIDCStatus {
+	if !s.Enabled() {
+		return tables.OIDCStatus{}
+	}
+	return tables.OIDCStatus{
+		Enabled:      true,
+		ProviderName: s.config.OIDCProviderName,
+		LoginURL:     "/api/auth/oidc/login",
+	}
+}
+
+// AuthorizationURL starts a single sign-on and returns where to send the browser
+func (s *OIDCService) AuthorizationURL() (string, error) {
+	discovery, err := s.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+
+	state, err := utils.GenerateSecret(16)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := utils.GenerateSecret(16)
+	if err != nil {
+		return "", err
+	}
+	verifier, challenge, err := utils.GeneratePKCEVerifier()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.oidcModel.CreateState(&tables.OIDCLoginState{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcStateLifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", s.config.OIDCClientID)
+	query.Set("redirect_uri", s.config.OIDCRedirectURL)
+	query.Set("scope", strings.Join(s.config.OIDCScopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", challenge)
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), nil
+}
+
+// Callback completes a single sign-on with the code the identity provider sent the browser
+// back with. It creates the session of the matching user and returns a single-use code the
+// frontend exchanges for it.
+func (s *OIDCService) Callback(code, state, ipAddress, userAgent string) (string, error) {
+	loginState, err := s.oidcModel.TakeState(state)
+	if err != nil {
+		return "", err
+	}
+
+	idToken, err := s.exchangeCode(code, loginState.CodeVerifier)
+	if err != nil {
+		return "", err
+	}
+	claims, rawClaims, err := s.verifyIDToken(idToken, loginState.Nonce)
+	if err != nil {
+		return "", err
+	}
+
+	user, err := s.matchUser(claims, rawClaims)
+	if err != nil {
+		return "", err
+	}
+	if len(s.managedRoles) > 0 {
+		granted := s.mappedRoles(rawClaims)
+		if err := s.roleModel.SyncManagedRoles(user.ID, s.managedRoles, granted); err != nil {
+			return "", err
+		}
+	}
+
+	session, _, _, err := s.authService.StartSession(user, ipAddress, userAgent)
+	if err != nil {
+		return "", err
+	}
+
+	handoff, err := utils.GenerateSecret(32)
+	if err != nil {
+		return "", err
+	}
+	if err := s.oidcModel.CreateHandoff(hashResetToken(handoff), session.ID, time.Now().Add(oidcHandoffLifetime)); err != nil {
+		return "", err
+	}
+	return handoff, nil
+}
+
+// Exchange hands the session created by a single sign-on to the frontend, once
+func (s *OIDCService) Exchange(code string) (string, *tables.User, *tables.SessionData, error) {
+	sessionID, err := s.oidcModel.TakeHandoff(hashResetToken(code))
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	user, sessionData, err := s.authService.ValidateSession(sessionID)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return sessionID, user, sessionData, nil
+}
+
+// PostLoginURL is where the browser is sent after a single sign-on, with the code to
+// exchange or the reason it failed
+func (s *OIDCService) PostLoginURL(code, reason string) string {
+	values := url.Values{}
+	if code != "" {
+		values.Set("code", code)
+	} else {
+		values.Set("error", reason)
+	}
+
+	separator := "?"
+	if strings.Contains(s.config.OIDCPostLoginURL, "?") {
+		separator = "&"
+	}
+	return s.config.OIDCPostLoginURL + separator + values.Encode()
+}
+
+// Cleanup deletes expired single sign-on states and handoffs
+func (s *OIDCService) Cleanup() error {
+	return s.oidcModel.Cleanup()
+}
+
+// exchangeCode redeems the authorization code at the token endpoint for an ID token
+func (s *OIDCService) exchangeCode(code, verifier string) (string, error) {
+	discovery, err := s.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", s.config.OIDCRedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", s.config.OIDCClientID)
+
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if s.config.OIDCClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(s.config.OIDCClientID), url.QueryEscape(s.config.OIDCClientSecret))
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokens oidcTokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokens); err != nil {
+		return "", fmt.Errorf("invalid token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || tokens.Error != "" {
+		return "", fmt.Errorf("token request refused: %s %s", tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return "", fmt.Errorf("token response has no ID token")
+	}
+	return tokens.IDToken, nil
+}
+
+// verifyIDToken checks the signature, issuer, audience, lifetime and nonce of an ID token
+// and returns its claims
+func (s *OIDCService) verifyIDToken(idToken, nonce string) (*oidcIDClaims, map[string]any, error) {
+	header, claimsJSON, signingInput, signature, err := utils.ParseJWT(idToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := s.signingKey(header)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := utils.VerifyJWTSignature(header.Alg, key, signingInput, signature); err != nil {
+		return nil, nil, err
+	}
+
+	claims := &oidcIDClaims{}
+	if err := json.Unmarshal(claimsJSON, claims); err != nil {
+		return nil, nil, fmt.Errorf("invalid ID token claims: %w", err)
+	}
+	rawClaims := map[string]any{}
+	if err := json.Unmarshal(claimsJSON, &rawClaims); err != nil {
+		return nil, nil, fmt.Errorf("invalid ID token claims: %w", err)
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Issuer != s.config.OIDCIssuer:
+		return nil, nil, fmt.Errorf("ID token from unexpected issuer %q", claims.Issuer)
+	case !slices.Contains(claims.Audience, s.config.OIDCClientID):
+		return nil, nil, fmt.Errorf("ID token not issued for this client")
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != s.config.OIDCClientID:
+		return nil, nil, fmt.Errorf("ID token not issued for this client")
+	case claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(oidcClockSkew)):
+		return nil, nil, fmt.Errorf("ID token expired")
+	case claims.IssuedAt != 0 && time.Unix(claims.IssuedAt, 0).After(now.Add(oidcClockSkew)):
+		return nil, nil, fmt.Errorf("ID token issued in the future")
+	case !utils.EqualCodes(claims.Nonce, nonce):
+		return nil, nil, fmt.Errorf("ID token nonce does not match")
+	case claims.Subject == "":
+		return nil, nil, fmt.Errorf("ID token has no subject")
+	}
+	return claims, rawClaims, nil
+}
+
+// matchUser finds the user of an ID token: the user linked to its subject, or else the
+// first user matching a configured claim, who is then linked to the subject
+func (s *OIDCService) matchUser(claims *oidcIDClaims, rawClaims map[string]any) (*tables.User, error) {
+	userID, err := s.oidcModel.GetUserIDBySubject(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if userID != 0 {
+		return s.userModel.GetByID(userID)
+	}
+
+	var user *tables.User
+	for _, claim := range s.config.OIDCMatchClaims {
+		switch claim {
+		case "email":
+			// Only addresses the identity provider says it verified identify anyone; a missing
+			// email_verified claim does not count as verified
+			if claims.Email != "" && claimTrue(claims.EmailVerified, false) {
+				user, _ = s.userModel.GetByEmail(claims.Email)
+			}
+		case "username":
+			if username, ok := rawClaims[s.config.OIDCUsernameClaim].(string); ok && username != "" {
+				user, _ = s.userModel.GetByUsername(username)
+			}
+		}
+		if user != nil {
+			break
+		}
+	}
+	if user == nil {
+		return nil, fmt.Errorf("no matching user")
+	}
+
+	if err := s.oidcModel.LinkSubject(user.ID, claims.Subject); err != nil {
+		return nil, err
+	}
+	log.Printf("Linked user %d to identity provider subject %s", user.ID, claims.Subject)
+	return user, nil
+}
+
+// mappedRoles returns the roles mapped from the groups claim
+func (s *OIDCService) mappedRoles(rawClaims map[string]any) []string {
+	var groups []string
+	switch value := rawClaims[s.config.OIDCGroupsClaim].(type) {
+	case string:
+		groups = []string{value}
+	case []any:
+		for _, item := range value {
+			if group, ok := item.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+	}
+
+	granted := []string{}
+	for _, group := range groups {
+		for _, role := range s.roleMapping[group] {
+			if !slices.Contains(granted, role) {
+				granted = append(granted, role)
+			}
+		}
+	}
+	return granted
+}
+
+// getDiscovery fetches the discovery document of the identity provider once
+func (s *OIDCService) getDiscovery() (*oidcDiscovery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.discovery != nil {
+		return s.discovery, nil
+	}
+	if !s.Enabled() {
+		return nil, fmt.Errorf("single sign-on is not configured")
+	}
+
+	discovery := &oidcDiscovery{}
+	if err := s.getJSON(s.config.OIDCIssuer+"/.well-known/openid-configuration", discovery); err != nil {
+		return nil, fmt.Errorf("failed to get identity provider configuration: %w", err)
+	}
+	if discovery.Issuer != s.config.OIDCIssuer {
+		return nil, fmt.Errorf("identity provider reports issuer %q, expected %q", discovery.Issuer, s.config.OIDCIssuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("identity provider configuration is incomplete")
+	}
+	s.discovery = discovery
+	return discovery, nil
+}
+
+// signingKey returns the identity provider key a token was signed with, refreshing the keys
+// when the token names one that is not known yet
+func (s *OIDCService) signingKey(header *utils.JWTHeader) (crypto.PublicKey, error) {
+	discovery, err := s.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, alg, found := s.findKey(header.Kid)
+	if !found && time.Since(s.keysFetchedAt) > oidcKeysRefreshInterval {
+		keySet := &utils.JWKSet{}
+		if err := s.getJSON(discovery.JWKSURI, keySet); err != nil {
+			return nil, fmt.Errorf("failed to get identity provider keys: %w", err)
+		}
+
+		s.keys = map[string]crypto.PublicKey{}
+		s.keyAlgs = map[string]string{}
+		for _, jwk := range keySet.Keys {
+			if jwk.Use != "" && jwk.Use != "sig" {
+				continue
+			}
+			publicKey, err := jwk.PublicKey()
+			if err != nil {
+				log.Printf("Skipping identity provider key %q: %v", jwk.Kid, err)
+				continue
+			}
+			s.keys[jwk.Kid] = publicKey
+			s.keyAlgs[jwk.Kid] = jwk.Alg
+		}
+		s.keysFetchedAt = time.Now()
+		key, alg, found = s.findKey(header.Kid)
+	}
+
+	if !found {
+		return nil, fmt.Errorf("ID token signed with unknown key %q", header.Kid)
+	}
+	if alg != "" && alg != header.Alg {
+		return nil, fmt.Errorf("ID token signed with %s, key is for %s", header.Alg, alg)
+	}
+	return key, nil
+}
+
+// findKey looks up a key by ID. Tokens without a key ID are accepted when there is only one
+// key. The caller holds s.mu.
+func (s *OIDCService) findKey(kid string) (crypto.PublicKey, string, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for id, key := range s.keys {
+			return key, s.keyAlgs[id], true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, s.keyAlgs[kid], ok
+}
+
+func (s *OIDCService) getJSON(url string, target any) error {
+	resp, err := s.httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(target)
+}
+
+// claimTrue interprets a boolean claim, which some identity providers send as a string.
+// A missing claim is missingValue.
+func claimTrue(value any, missingValue bool) bool {
+	switch v := value.(type) {
+	case nil:
+		return missingValue
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
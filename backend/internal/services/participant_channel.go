@@ -0,0 +1,324 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+const (
+	participantWriteWait  = 10 * time.Second
+	participantPongWait   = 60 * time.Second
+	participantPingPeriod = 54 * time.Second
+)
+
+// ParticipantChannel pushes proctor messages to participants over WebSocket. A message stays
+// pending until the exam UI acknowledges it and is sent again when the participant reconnects,
+// so the exam UI must ignore messages whose ID it has already handled.
+type ParticipantChannel struct {
+	db       *ExamDeliveryDB
+	upgrader websocket.Upgrader
+	conns    map[int]map[*participantConn]bool
+	mu       sync.Mutex
+
+	// onAck is called after a participant acknowledged a message
+	onAck func(messageID, participantID int)
+}
+
+type participantConn struct {
+	channel       *ParticipantChannel
+	conn          *websocket.Conn
+	participantID int
+	attemptID     int
+	send          chan []byte
+	closed        bool
+	sendMu        sync.Mutex
+}
+
+// ParticipantMessage is a proctor message as pushed to the exam UI
+type ParticipantMessage struct {
+	Type      string    `json:"type"`
+	ID        int       `json:"id"`
+	Kind      string    `json:"kind"`
+	Message   string    `json:"message"`
+	Minutes   int       `json:"minutes,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ParticipantStatus is sent when the channel opens so the exam UI can restore a pause or lock
+type ParticipantStatus struct {
+	Type      string `json:"type"`
+	AttemptID int    `json:"attempt_id"`
+	Paused    bool   `json:"paused"`
+	Locked    bool   `json:"locked"`
+}
+
+// participantInbound is a message sent by the exam UI ("ack" or "ping")
+type participantInbound struct {
+	Type      string `json:"type"`
+	MessageID int    `json:"message_id"`
+}
+
+// NewParticipantChannel creates the participant channel of a delivery
+func NewParticipantChannel(db *ExamDeliveryDB, onAck func(messageID, participantID int)) *ParticipantChannel {
+	return &ParticipantChannel{
+		db: db,
+		// Participants connect from exam devices on any origin, like the REST routes (see CORS)
+		upgrader: websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }},
+		conns:    make(map[int]map[*participantConn]bool),
+		onAck:    onAck,
+	}
+}
+
+// Serve upgrades an authenticated participant request and replays the pending messages
+func (pc *ParticipantChannel) Serve(w http.ResponseWriter, r *http.Request, participantID, attemptID int) {
+	conn, err := pc.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Participant channel upgrade failed: %v", err)
+		return
+	}
+
+	c := &participantConn{
+		channel:       pc,
+		conn:          conn,
+		participantID: participantID,
+		attemptID:     attemptID,
+		send:          make(chan []byte, 64),
+	}
+
+	pc.mu.Lock()
+	if pc.conns[participantID] == nil {
+		pc.conns[participantID] = make(map[*participantConn]bool)
+	}
+	pc.conns[participantID][c] = true
+	pc.mu.Unlock()
+
+	go c.writePump()
+	go c.readPump()
+
+	paused, locked, err := pc.db.GetParticipantHold(participantID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get hold status of participant %d: %v", participantID, err)
+	}
+	c.sendJSON(ParticipantStatus{Type: "status", AttemptID: attemptID, Paused: paused, Locked: locked})
+
+	pending, err := pc.db.GetPendingMessages(participantID)
+	if err != nil {
+		log.Printf("Failed to get pending messages of participant %d: %v", participantID, err)
+		return
+	}
+	for _, message := range pending {
+		if c.sendJSON(newParticipantMessage(&message)) {
+			if err := pc.db.MarkMessageDelivered(message.ID, participantID); err != nil {
+				log.Printf("Failed to mark message %d delivered: %v", message.ID, err)
+			}
+		}
+	}
+}
+
+// Send pushes a message to the connected recipients and returns how many received it.
+// Recipients that are offline get it when they reconnect.
+func (pc *ParticipantChannel) Send(message *tables.ProctorMessage, recipients []int) int {
+	payload, err := json.Marshal(newParticipantMessage(message))
+	if err != nil {
+		log.Printf("Failed to marshal proctor message: %v", err)
+		return 0
+	}
+
+	delivered := 0
+	for _, participantID := range recipients {
+		pc.mu.Lock()
+		conns := make([]*participantConn, 0, len(pc.conns[participantID]))
+		for c := range pc.conns[participantID] {
+			conns = append(conns, c)
+		}
+		pc.mu.Unlock()
+
+		sent := false
+		for _, c := range conns {
+			if c.trySend(payload) {
+				sent = true
+			}
+		}
+		if !sent {
+			continue
+		}
+
+		if err := pc.db.MarkMessageDelivered(message.ID, participantID); err != nil {
+			log.Printf("Failed to mark message %d delivered: %v", message.ID, err)
+		}
+		delivered++
+	}
+
+	return delivered
+}
+
+// Notify pushes a transient update (e.g. the status of a help request) to the connections
+// of a participant. Unlike proctor messages it is not stored or re-sent.
+func (pc *ParticipantChannel) Notify(participantID int, message interface{}) {
+	pc.mu.Lock()
+	conns := make([]*participantConn, 0, len(pc.conns[participantID]))
+	for c := range pc.conns[participantID] {
+		conns = append(conns, c)
+	}
+	pc.mu.Unlock()
+
+	for _, c := range conns {
+		c.sendJSON(message)
+	}
+}
+
+// Close disconnects every participant
+func (pc *ParticipantChannel) Close() {
+	pc.mu.Lock()
+	conns := []*participantConn{}
+	for _, set := range pc.conns {
+		for c := range set {
+			conns = append(conns, c)
+		}
+	}
+	pc.mu.Unlock()
+
+	for _, c := range conns {
+		c.close()
+	}
+}
+
+func (pc *ParticipantChannel) remove(c *participantConn) {
+	pc.mu.Lock()
+	if set, ok := pc.conns[c.participantID]; ok {
+		delete(set, c)
+		if len(set) == 0 {
+			delete(pc.conns, c.participantID)
+		}
+	}
+	pc.mu.Unlock()
+
+	c.close()
+}
+
+func newParticipantMessage(message *tables.ProctorMessage) ParticipantMessage {
+	return ParticipantMessage{
+		Type:      "message",
+		ID:        message.ID,
+		Kind:      message.Kind,
+		Message:   message.Message,
+		Minutes:   message.Minutes,
+		CreatedAt: message.CreatedAt,
+	}
+}
+
+func (c *participantConn) readPump() {
+	defer func() {
+		c.channel.remove(c)
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadDeadline(time.Now().Add(participantPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(participantPongWait))
+		return nil
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("Participant channel error: %v", err)
+			}
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(participantPongWait))
+
+		var inbound participantInbound
+		if err := json.Unmarshal(data, &inbound); err != nil {
+			continue
+		}
+
+		switch inbound.Type {
+		case "ack":
+			acknowledged, err := c.channel.db.AcknowledgeMessage(inbound.MessageID, c.participantID)
+			if err != nil {
+				log.Printf("Failed to acknowledge message %d: %v", inbound.MessageID, err)
+				continue
+			}
+			if acknowledged && c.channel.onAck != nil {
+				c.channel.onAck(inbound.MessageID, c.participantID)
+			}
+		case "ping":
+			c.sendJSON(map[string]string{"type": "pong"})
+		}
+	}
+}
+
+func (c *participantConn) writePump() {
+	ticker := time.NewTicker(participantPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(participantWriteWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(participantWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sendJSON marshals and queues a message; it returns false when the message was dropped
+func (c *participantConn) sendJSON(message interface{}) bool {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Failed to marshal participant message: %v", err)
+		return false
+	}
+	return c.trySend(data)
+}
+
+// trySend queues a message, dropping the connection when its send buffer is full
+func (c *participantConn) trySend(message []byte) bool {
+	c.sendMu.Lock()
+	if c.closed {
+		c.sendMu.Unlock()
+		return false
+	}
+	select {
+	case c.send <- message:
+		c.sendMu.Unlock()
+		return true
+	default:
+		c.sendMu.Unlock()
+		c.channel.remove(c)
+		return false
+	}
+}
+
+func (c *participantConn) close() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.send)
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/medxamion/medxamion/internal/config"
+	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
+)
+
+// PasswordPolicyError lists why a new password was refused
+type PasswordPolicyError struct {
+	Problems []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// PasswordPolicy checks new passwords for length, mixed character classes, breached
+// passwords and reuse of previous passwords
+type PasswordPolicy struct {
+	minLength  int
+	minClasses int
+	history    int
+	// Uppercase SHA-1 hex of the breached passwords
+	breached map[string]bool
+}
+
+// NewPasswordPolicy creates the configured policy, loading the breached password list
+func NewPasswordPolicy(cfg *config.Config) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{
+		minLength:  cfg.PasswordMinLength,
+		minClasses: min(max(cfg.PasswordMinClasses, 0), 4),
+		history:    max(cfg.PasswordHistory, 0),
+	}
+	if cfg.PasswordBreachedList == "" {
+		return policy, nil
+	}
+
+	breached, err := loadBreachedPasswords(cfg.PasswordBreachedList)
+	if err != nil {
+		return nil, err
+	}
+	policy.breached = breached
+	return policy, nil
+}
+
+// loadBreachedPasswords reads a list of breached passwords, one per line. Lines are either
+// plain passwords or SHA-1 hashes in hex, optionally followed by ":count" as in the Have I
+// Been Pwned downloads.
+func loadBreachedPasswords(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer file.Close()
+
+	breached := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); isSHA1Hex(hash) {
+			breached[strings.ToUpper(hash)] = true
+			continue
+		}
+		breached[passwordSHA1(line)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+	return breached, nil
+}
+
+// Info describes the policy to show to users choosing a password
+func (p *PasswordPolicy) Info() tables.PasswordPolicyInfo {
+	return tables.PasswordPolicyInfo{
+		MinLength:           p.minLength,
+		MinClasses:          p.minClasses,
+		History:             p.history,
+		BreachedListChecked: p.breached != nil,
+	}
+}
+
+// History is how many previous passwords may not be used again
+func (p *PasswordPolicy) History() int {
+	return p.history
+}
+
+// Validate checks a new password against the policy. previousHashes are the bcrypt hashes
+// of the current and previous passwords of the account, most recent first.
+func (p *PasswordPolicy) Validate(password string, previousHashes []string) error {
+	var problems []string
+
+	if len([]rune(password)) < p.minLength {
+		problems = append(problems, fmt.Sprintf("password must be at least %d characters", p.minLength))
+	}
+	if classes := characterClasses(password); classes < p.minClasses {
+		problems = append(problems, fmt.Sprintf("password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.minClasses))
+	}
+	if p.breached[passwordSHA1(password)] {
+		problems = append(problems, "password appears in a list of breached passwords")
+	}
+
+	if len(problems) == 0 {
+		for i, hash := range previousHashes {
+			if i >= p.history {
+				break
+			}
+			if hash != "" && utils.CheckPasswordHash(password, hash) {
+				problems = append(problems, fmt.Sprintf("password must differ from the last %d passwords", p.history))
+				break
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &PasswordPolicyError{Problems: problems}
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	return classes
+}
+
+func passwordSHA1(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isSHA1Hex(text string) bool {
+	if len(text) != sha1.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(text)
+	return err == nil
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/config"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
+)
+
+// PasswordService changes and resets the passwords of users and participants under the
+// password policy, and sends password reset links through the mailer
+type PasswordService struct {
+	passwordModel    *models.PasswordModel
+	userModel        *models.UserModel
+	participantModel *models.ParticipantModel
+	sessionModel     *models.SessionModel
+	permissionModel  *models.PermissionModel
+	policy           *PasswordPolicy
+	mailer           Mailer
+	config           *config.Config
+}
+
+func NewPasswordService(passwordModel *models.PasswordModel, userModel *models.UserModel, participantModel *models.ParticipantModel, sessionModel *models.SessionModel, permissionModel *models.PermissionModel, policy *PasswordPolicy, mailer Mailer, config *config.Config) *PasswordService {
+	return &PasswordService{
+		passwordModel:    passwordModel,
+		userModel:        userModel,
+		participantModel: participantModel,
+		sessionModel:     sessionModel,
+		permissionModel:  permissionModel,
+		policy:           policy,
+		mailer:           mailer,
+		config:           config,
+	}
+}
+
+// Policy describes the password policy
+func (s *PasswordService) Policy() tables.PasswordPolicyInfo {
+	return s.policy.Info()
+}
+
+// ValidateNew checks the password of an account that is being created
+func (s *PasswordService) ValidateNew(password string) error {
+	return s.policy.Validate(password, nil)
+}
+
+// RecordInitial records the password an account was created with in its history
+func (s *PasswordService) RecordInitial(accountType string, accountID int, hashedPassword string, mustChange bool) error {
+	return s.passwordModel.SetPassword(accountType, accountID, hashedPassword, mustChange, s.policy.History())
+}
+
+// ChangeUserPassword changes the password of a user who knows the current one, clearing
+// any forced password change. The other sessions of the user are signed out.
+func (s *PasswordService) ChangeUserPassword(userID int, currentPassword, newPassword, currentSessionID string) error {
+	user, err := s.userModel.GetByID(userID)
+	if err != nil {
+		return fmt.Errorf("user not found")
+	}
+	if !utils.CheckPasswordHash(currentPassword, user.Password) {
+		return fmt.Errorf("current password is incorrect")
+	}
+
+	if err := s.setPassword(tables.PasswordAccountUser, userID, newPassword, false); err != nil {
+		return err
+	}
+	if _, err := s.sessionModel.DeleteOthers(userID, currentSessionID); err != nil {
+		log.Printf("Failed to end other sessions of user %d after a password change: %v", userID, err)
+	}
+	return nil
+}
+
+// SetUserPassword sets the password of a user for an administrator. The user must change it
+// at their next login, and is signed out.
+func (s *PasswordService) SetUserPassword(userID int, newPassword string) error {
+	if _, err := s.userModel.GetByID(userID); err != nil {
+		return fmt.Errorf("user not found")
+	}
+	if err := s.setPassword(tables.PasswordAccountUser, userID, newPassword, true); err != nil {
+		return err
+	}
+	return s.sessionModel.DeleteByUserID(userID)
+}
+
+// ChangeParticipantPassword changes the password of a participant who knows the current one,
+// clearing any forced password change
+func (s *PasswordService) ChangeParticipantPassword(participant *tables.Participant, currentPassword, newPassword string) error {
+	if participant.Password == nil || *participant.Password == "" || !utils.CheckPasswordHash(currentPassword, *participant.Password) {
+		return fmt.Errorf("current password is incorrect")
+	}
+	return s.setPassword(tables.PasswordAccountParticipant, participant.ID, newPassword, false)
+}
+
+// SetMustChange sets whether an account must change its password at the next login
+func (s *PasswordService) SetMustChange(accountType string, accountID int, mustChange bool) error {
+	return s.passwordModel.SetMustChange(accountType, accountID, mustChange)
+}
+
+// RequestReset emails a reset link to the user or participant with an email address. Unknown
+// addresses are ignored without an error, so the request does not reveal which exist.
+func (s *PasswordService) RequestReset(accountType, email string) error {
+	if !s.config.PasswordResetEnabled || s.mailer == nil {
+		return fmt.Errorf("password reset disabled")
+	}
+
+	var accountID int
+	var name string
+	switch accountType {
+	case tables.PasswordAccountUser:
+		user, err := s.userModel.GetByEmail(email)
+		if err != nil {
+			return nil
+		}
+		accountID, name = user.ID, user.Name
+	case tables.PasswordAccountParticipant:
+		participant, err := s.participantModel.GetByEmail(email)
+		if err != nil {
+			return nil
+		}
+		accountID, name = participant.ID, participant.Name
+	default:
+		return fmt.Errorf("unknown account type %q", accountType)
+	}
+
+	resetURL, expiresAt, err := s.createResetToken(accountType, accountID, nil)
+	if err != nil {
+		return err
+	}
+	return s.sendResetLink(email, name, resetURL, expiresAt, false)
+}
+
+// AdminReset starts a password reset for an administrator: the password of the account stops
+// working, a user is signed out, and a reset link is emailed to the account. Accounts without
+// an email address get the link returned for the administrator to hand over. Participants
+// are only found in the client of scope. Users holding a permission the administrator lacks
+// are refused, so a reset cannot be used to take over a more privileged account.
+func (s *PasswordService) AdminReset(scope models.ClientScope, accountType string, accountID int, admin *tables.SessionData) (*tables.AdminPasswordReset, error) {
+	var email, name string
+	switch accountType {
+	case tables.PasswordAccountUser:
+		user, err := s.userModel.GetByID(accountID)
+		if err != nil {
+			return nil, fmt.Errorf("account not found")
+		}
+		permissions, err := s.permissionModel.GetEffective(accountID)
+		if err != nil {
+			return nil, err
+		}
+		for _, permission := range permissions {
+			if !admin.HasPermission(permission) {
+				return nil, fmt.Errorf("account has permissions the administrator lacks")
+			}
+		}
+		email, name = user.Email, user.Name
+	case tables.PasswordAccountParticipant:
+		participant, err := s.participantModel.GetByID(scope, accountID)
+		if err != nil {
+			return nil, fmt.Errorf("account not found")
+		}
+		name = participant.Name
+		if participant.Email != nil {
+			email = *participant.Email
+		}
+	default:
+		return nil, fmt.Errorf("unknown account type %q", accountType)
+	}
+
+	resetURL, expiresAt, err := s.createResetToken(accountType, accountID, &admin.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.passwordModel.ClearPassword(accountType, accountID); err != nil {
+		return nil, err
+	}
+	if accountType == tables.PasswordAccountUser {
+		if err := s.sessionModel.DeleteByUserID(accountID); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &tables.AdminPasswordReset{ExpiresAt: expiresAt}
+	if email != "" {
+		err := s.sendResetLink(email, name, resetURL, expiresAt, true)
+		if err == nil {
+			result.Emailed = true
+			return result, nil
+		}
+		log.Printf("Failed to email password reset link for %s %d: %v", accountType, accountID, err)
+	}
+	result.ResetURL = resetURL
+	return result, nil
+}
+
+// ResetPassword sets a new password with a reset token, which then stops working
+func (s *PasswordService) ResetPassword(token, newPassword string) error {
+	resetToken, err := s.passwordModel.GetResetToken(hashResetToken(token))
+	if err != nil {
+		return err
+	}
+
+	hashes, err := s.passwordModel.RecentHashes(resetToken.AccountType, resetToken.AccountID, s.policy.History())
+	if err != nil {
+		return err
+	}
+	if err := s.policy.Validate(newPassword, hashes); err != nil {
+		return err
+	}
+
+	if err := s.passwordModel.UseResetToken(resetToken.ID); err != nil {
+		return err
+	}
+	hashed, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.passwordModel.SetPassword(resetToken.AccountType, resetToken.AccountID, hashed, false, s.policy.History()); err != nil {
+		return err
+	}
+
+	if resetToken.AccountType == tables.PasswordAccountUser {
+		return s.sessionModel.DeleteByUserID(resetToken.AccountID)
+	}
+	return nil
+}
+
+// CleanupResetTokens deletes used and expired reset tokens
+func (s *PasswordService) CleanupResetTokens() error {
+	return s.passwordModel.CleanupResetTokens()
+}
+
+// setPassword checks a new password against the policy and the account's previous
+// passwords, and stores it
+func (s *PasswordService) setPassword(accountType string, accountID int, newPassword string, mustChange bool) error {
+	hashes, err := s.passwordModel.RecentHashes(accountType, accountID, s.policy.History())
+	if err != nil {
+		return err
+	}
+	if err := s.policy.Validate(newPassword, hashes); err != nil {
+		return err
+	}
+
+	hashed, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	return s.passwordModel.SetPassword(accountType, accountID, hashed, mustChange, s.policy.History())
+}
+
+// createResetToken stores a new reset token for an account and returns its reset link
+func (s *PasswordService) createResetToken(accountType string, accountID int, createdBy *int) (string, time.Time, error) {
+	token, err := utils.GenerateSecret(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(s.config.PasswordResetTTL)
+	if err := s.passwordModel.CreateResetToken(accountType, accountID, hashResetToken(token), expiresAt, createdBy); err != nil {
+		return "", time.Time{}, err
+	}
+
+	baseURL := s.config.PasswordResetURL
+	if accountType == tables.PasswordAccountParticipant {
+		baseURL = s.config.ParticipantPasswordResetURL
+	}
+	return baseURL + token, expiresAt, nil
+}
+
+func (s *PasswordService) sendResetLink(email, name, resetURL string, expiresAt time.Time, byAdmin bool) error {
+	if s.mailer == nil {
+		return fmt.Errorf("no mailer configured")
+	}
+
+	reason := "Someone, hopefully you, asked to reset the password of your MedXam account."
+	if byAdmin {
+		reason = "An administrator reset the password of your MedXam account. Your previous password no longer works."
+	}
+
+	return s.mailer.Send(MailMessage{
+		To:      email,
+		Subject: "Reset your MedXam password",
+		Body: fmt.Sprintf("Hello %s,\n\n%s\n\nSet a new password here until %s:\n%s\n\nThe link works once. If you did not ask for it, you can ignore this email.\n",
+			name, reason, expiresAt.Format(time.RFC1123), resetURL),
+	})
+}
+
+// hashResetToken returns the hash reset tokens are stored as. The tokens are random, so a
+// fast hash is enough.
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
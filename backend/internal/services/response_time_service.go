@@ -0,0 +1,253 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// ResponseTimeService reports item timing, rapid guessing and pacing
+type ResponseTimeService struct {
+	attemptModel *models.AttemptModel
+}
+
+// NewResponseTimeService creates a new response-time service
+func NewResponseTimeService(attemptModel *models.AttemptModel) *ResponseTimeService {
+	return &ResponseTimeService{attemptModel: attemptModel}
+}
+
+// Analyze builds the response-time report of a delivery
+func (s *ResponseTimeService) Analyze(deliveryID int, req tables.ResponseTimeAnalysisRequest) (*tables.ResponseTimeReport, error) {
+	times, err := s.attemptModel.GetDeliveryResponseTimes(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := AnalyzeResponseTimes(times, req)
+	report.DeliveryID = deliveryID
+	return report, nil
+}
+
+// AnalyzeResponseTimes computes per-item timing statistics and flags rapid guessing.
+// An answer is a rapid guess when it took less than ThresholdPercent of the item's median
+// time, capped at MaxThreshold seconds (the normative threshold method).
+func AnalyzeResponseTimes(times []tables.ItemResponseTime, req tables.ResponseTimeAnalysisRequest) *tables.ResponseTimeReport {
+	report := &tables.ResponseTimeReport{
+		ThresholdPercent: req.ThresholdPercent,
+		MaxThreshold:     req.MaxThreshold,
+		MinEffort:        req.MinEffort,
+		Items:            []tables.ItemTimingStats{},
+		Candidates:       []tables.CandidateTimingStats{},
+		GeneratedAt:      time.Now(),
+	}
+
+	// Item statistics are based on answered questions only
+	byItem := make(map[int][]tables.ItemResponseTime)
+	questionIDs := []int{}
+	for _, t := range times {
+		if !t.Answered {
+			continue
+		}
+		if _, ok := byItem[t.QuestionID]; !ok {
+			questionIDs = append(questionIDs, t.QuestionID)
+		}
+		byItem[t.QuestionID] = append(byItem[t.QuestionID], t)
+	}
+	sort.Ints(questionIDs)
+
+	thresholds := make(map[int]float64, len(questionIDs))
+	for _, questionID := range questionIDs {
+		responses := byItem[questionID]
+		seconds := make([]float64, len(responses))
+		visits, changes := 0, 0
+		for i, t := range responses {
+			seconds[i] = float64(t.TimeSpent)
+			visits += t.Visits
+			changes += t.AnswerChanges
+		}
+		sort.Float64s(seconds)
+
+		stats := tables.ItemTimingStats{
+			QuestionID:    questionID,
+			Responses:     len(responses),
+			MedianTime:    percentile(seconds, 0.5),
+			LowerQuartile: percentile(seconds, 0.25),
+			UpperQuartile: percentile(seconds, 0.75),
+			MeanTime:      mean(seconds),
+			AverageVisits: float64(visits) / float64(len(responses)),
+			AnswerChanges: changes,
+		}
+		stats.RapidThreshold = math.Min(stats.MedianTime*req.ThresholdPercent/100, req.MaxThreshold)
+		thresholds[questionID] = stats.RapidThreshold
+
+		correct, known := 0, 0
+		for _, t := range responses {
+			if float64(t.TimeSpent) >= stats.RapidThreshold {
+				continue
+			}
+			stats.RapidGuesses++
+			if t.IsCorrect != nil {
+				known++
+				if *t.IsCorrect {
+					correct++
+				}
+			}
+		}
+		stats.RapidGuessRate = float64(stats.RapidGuesses) / float64(len(responses))
+		if known > 0 {
+			accuracy := float64(correct) / float64(known)
+			stats.RapidGuessAccuracy = &accuracy
+		}
+
+		report.Items = append(report.Items, stats)
+	}
+
+	// Candidate statistics, in attempt order
+	byAttempt := make(map[int]*tables.CandidateTimingStats)
+	attemptSeconds := make(map[int][]float64)
+	attemptIDs := []int{}
+	for _, t := range times {
+		candidate, ok := byAttempt[t.AttemptID]
+		if !ok {
+			candidate = &tables.CandidateTimingStats{
+				AttemptID:           t.AttemptID,
+				TakerName:           t.TakerName,
+				TakerCode:           t.TakerCode,
+				RapidGuessQuestions: []int{},
+			}
+			byAttempt[t.AttemptID] = candidate
+			attemptIDs = append(attemptIDs, t.AttemptID)
+		}
+
+		candidate.TotalTime += t.TimeSpent
+		candidate.AnswerChanges += t.AnswerChanges
+		if !t.Answered {
+			continue
+		}
+		candidate.ItemsAnswered++
+		attemptSeconds[t.AttemptID] = append(attemptSeconds[t.AttemptID], float64(t.TimeSpent))
+		if float64(t.TimeSpent) < thresholds[t.QuestionID] {
+			candidate.RapidGuesses++
+			candidate.RapidGuessQuestions = append(candidate.RapidGuessQuestions, t.QuestionID)
+		}
+	}
+	sort.Ints(attemptIDs)
+
+	for _, attemptID := range attemptIDs {
+		candidate := byAttempt[attemptID]
+		if candidate.ItemsAnswered > 0 {
+			seconds := attemptSeconds[attemptID]
+			sort.Float64s(seconds)
+			candidate.MedianTime = percentile(seconds, 0.5)
+			candidate.ResponseTimeEffort = 1 - float64(candidate.RapidGuesses)/float64(candidate.ItemsAnswered)
+			candidate.Flagged = candidate.ResponseTimeEffort < req.MinEffort
+		}
+		report.Candidates = append(report.Candidates, *candidate)
+	}
+
+	return report
+}
+
+// GetPacingCurve builds the pacing curve of an attempt from its answer history
+func (s *ResponseTimeService) GetPacingCurve(attemptID int) (*tables.PacingCurve, error) {
+	attempt, err := s.attemptModel.GetByID(attemptID)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.attemptModel.GetAnswerHistory(attemptID)
+	if err != nil {
+		return nil, err
+	}
+
+	duration, totalQuestions, err := s.attemptModel.GetTimeLimits(attemptID)
+	if err != nil {
+		return nil, err
+	}
+
+	return BuildPacingCurve(attempt, history, duration, totalQuestions), nil
+}
+
+// BuildPacingCurve replays an answer history and compares progress with an even pace
+// over the allowed duration (seconds)
+func BuildPacingCurve(attempt *tables.Attempt, history []tables.AttemptQuestionHistory, duration, totalQuestions int) *tables.PacingCurve {
+	curve := &tables.PacingCurve{
+		AttemptID:      attempt.ID,
+		StartedAt:      attempt.StartedAt,
+		EndedAt:        attempt.EndedAt,
+		Duration:       duration,
+		TotalQuestions: totalQuestions,
+		Points:         []tables.PacingPoint{},
+	}
+
+	start := time.Time{}
+	if attempt.StartedAt != nil {
+		start = *attempt.StartedAt
+	} else if len(history) > 0 {
+		start = history[0].CreatedAt
+	}
+
+	answered := make(map[int]bool)
+	for i, entry := range history {
+		answered[entry.QuestionID] = entry.Answer != nil && strings.TrimSpace(*entry.Answer) != ""
+
+		count := 0
+		for _, ok := range answered {
+			if ok {
+				count++
+			}
+		}
+
+		elapsed := int(entry.CreatedAt.Sub(start).Seconds())
+		if elapsed < 0 {
+			elapsed = 0
+		}
+
+		expected := 0.0
+		if duration > 0 {
+			expected = math.Min(float64(totalQuestions)*float64(elapsed)/float64(duration), float64(totalQuestions))
+		}
+
+		curve.Points = append(curve.Points, tables.PacingPoint{
+			Sequence:         i + 1,
+			QuestionID:       entry.QuestionID,
+			Kind:             entry.Kind,
+			TimeSpent:        entry.TimeSpent,
+			At:               entry.CreatedAt,
+			Elapsed:          elapsed,
+			ItemsAnswered:    count,
+			ExpectedAnswered: expected,
+		})
+	}
+
+	return curve
+}
+
+// percentile interpolates the p-th quantile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	position := p * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	upper := int(math.Ceil(position))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(position-float64(lower))
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total / float64(len(values))
+}
@@ -4,32 +4,65 @@ import (
 	"context"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/tables"
 )
 
 // ExamClientAssigner interface for assigning deliveries to exam clients
 type ExamClientAssigner interface {
-	AssignDelivery(deliveryID int, deliveryName string, examData map[string]interface{})
+	AssignDelivery(deliveryID int, deliveryName string, examData map[string]interface{}) error
 	GetAvailableCapacity() int
+	FinishDelivery(deliveryID int) error
 }
 
-// SchedulerService handles automatic delivery scheduling
+// DeliveryEventPublisher pushes events to the users watching a delivery
+type DeliveryEventPublisher interface {
+	PublishDelta(deliveryID int, event string, data map[string]interface{})
+}
+
+// SchedulerService handles automatic delivery scheduling. The encrypted exam content of a
+// delivery is staged on an exam-client stagingLeadTime before its start; the delivery key
+// is released at the scheduled start. Staging that is not complete stagingAlertBefore the
+// start is alerted. Deliveries are closed closeGracePeriod after their end.
 type SchedulerService struct {
 	deliveryModel      *models.DeliveryModel
+	stagingModel       *models.DeliveryStagingModel
 	examClientAssigner ExamClientAssigner
+	networkAccess      *NetworkAccessService
+	examContent        *ExamContentService
+	publisher          DeliveryEventPublisher
+	collusion          *CollusionService
 	checkInterval      time.Duration
+	stagingLeadTime    time.Duration
+	stagingAlertBefore time.Duration
+	closeGracePeriod   time.Duration
 	stopChan           chan struct{}
+
+	// Timers waking the scheduler at the scheduled start of staged deliveries
+	releaseTimers map[int]*time.Timer
+	timersMux     sync.Mutex
+	wake          chan struct{}
 }
 
 // NewSchedulerService creates a new scheduler service
-func NewSchedulerService(deliveryModel *models.DeliveryModel, examClientAssigner ExamClientAssigner) *SchedulerService {
+func NewSchedulerService(deliveryModel *models.DeliveryModel, stagingModel *models.DeliveryStagingModel, examClientAssigner ExamClientAssigner, networkAccess *NetworkAccessService, examContent *ExamContentService, publisher DeliveryEventPublisher) *SchedulerService {
 	return &SchedulerService{
 		deliveryModel:      deliveryModel,
+		stagingModel:       stagingModel,
 		examClientAssigner: examClientAssigner,
+		networkAccess:      networkAccess,
+		examContent:        examContent,
+		publisher:          publisher,
 		checkInterval:      1 * time.Minute, // Check every minute
+		stagingLeadTime:    3 * time.Hour,
+		stagingAlertBefore: 30 * time.Minute,
+		closeGracePeriod:   5 * time.Minute,
 		stopChan:           make(chan struct{}),
+		releaseTimers:      make(map[int]*time.Timer),
+		wake:               make(chan struct{}, 1),
 	}
 }
 
@@ -37,6 +70,7 @@ func NewSchedulerService(deliveryModel *models.DeliveryModel, examClientAssigner
 func (s *SchedulerService) Start(ctx context.Context) {
 	ticker := time.NewTicker(s.checkInterval)
 	defer ticker.Stop()
+	defer s.stopReleaseTimers()
 
 	// Run initial check
 	s.checkAndStartDeliveries(ctx)
@@ -51,6 +85,8 @@ func (s *SchedulerService) Start(ctx context.Context) {
 			return
 		case <-ticker.C:
 			s.checkAndStartDeliveries(ctx)
+		case <-s.wake:
+			s.checkAndStartDeliveries(ctx)
 		}
 	}
 }
@@ -60,10 +96,16 @@ func (s *SchedulerService) Stop() {
 	close(s.stopChan)
 }
 
-// checkAndStartDeliveries checks for deliveries that need to be automatically started
+// checkAndStartDeliveries closes ended deliveries, stages upcoming deliveries, alerts
+// incomplete staging and starts the deliveries that are due
 func (s *SchedulerService) checkAndStartDeliveries(ctx context.Context) {
 	now := time.Now()
 
+	s.closeEndedDeliveries(now)
+	s.stageUpcomingDeliveries(now)
+	s.alertIncompleteStaging(now)
+	s.armReleaseTimers()
+
 	// Get deliveries that should be automatically started
 	deliveries, err := s.deliveryModel.GetDeliveriesForAutoStart(now)
 	if err != nil {
@@ -75,24 +117,21 @@ func (s *SchedulerService) checkAndStartDeliveries(ctx context.Context) {
 		return // No deliveries to start
 	}
 
-	// Check available capacity from exam clients
+	// Deliveries staged ahead already hold their exam-client; the others need capacity
 	availableCapacity := s.examClientAssigner.GetAvailableCapacity()
-	if availableCapacity == 0 {
-		log.Printf("Found %d deliveries to start but no exam client capacity available", len(deliveries))
-		return
-	}
 
 	log.Printf("Found %d deliveries to automatically start (available capacity: %d)",
 		len(deliveries), availableCapacity)
 
 	started := 0
 	for _, delivery := range deliveries {
-		if started >= availableCapacity {
+		staged := s.isStaging(delivery.ID)
+		if !staged && started >= availableCapacity {
 			log.Printf("Reached capacity limit (%d) - remaining deliveries will be processed in next cycle", availableCapacity)
-			break
+			continue
 		}
 
-		err := s.startDelivery(ctx, delivery)
+		err := s.startDelivery(ctx, delivery, staged)
 		if err != nil {
 			// Check if it's an "already started" error - this is expected and not a real error
 			if strings.Contains(err.Error(), "already started") || strings.Contains(err.Error(), "already finished") {
@@ -103,21 +142,144 @@ func (s *SchedulerService) checkAndStartDeliveries(ctx context.Context) {
 					delivery.ID, delivery.DisplayName, err)
 			}
 		} else {
-			log.Printf("Successfully queued delivery %d (%s) for exam client assignment",
+			log.Printf("Successfully started delivery %d (%s) and released its key",
 				delivery.ID, delivery.DisplayName)
-			started++
+			if !staged {
+				started++
+			}
 		}
 	}
 }
 
-// startDelivery starts a single delivery by assigning it to an exam client
-func (s *SchedulerService) startDelivery(ctx context.Context, delivery *models.DeliveryListItem) error {
+// startDelivery marks a delivery started and releases its key. A delivery that was not
+// staged ahead is staged now, so the exam-client receives content and key together.
+func (s *SchedulerService) startDelivery(ctx context.Context, delivery *models.DeliveryListItem, staged bool) error {
+	// Load the network allow-list first so a delivery never runs unrestricted by mistake
+	policy, err := s.networkAccess.GetPolicy(delivery.ID)
+	if err != nil {
+		return err
+	}
+
 	// First, mark delivery as started in database to prevent double start
-	err := s.deliveryModel.StartDelivery(delivery.ID)
+	err = s.deliveryModel.StartDelivery(models.AllClients(), delivery.ID)
+	if err != nil {
+		return err
+	}
+
+	if !staged {
+		if err := s.stageDelivery(delivery, policy); err != nil {
+			return err
+		}
+	}
+
+	// The exam-client staging the delivery can fetch the key from now on
+	if err := s.stagingModel.MarkReleased(delivery.ID); err != nil {
+		return err
+	}
+	s.disarmReleaseTimer(delivery.ID)
+
+	log.Printf("Released key of delivery: ID=%d, Name='%s', ScheduledAt=%v",
+		delivery.ID, delivery.DisplayName, delivery.ScheduledAt)
+
+	return nil
+}
+
+// closeEndedDeliveries finishes the deliveries whose end passed more than the grace period
+// ago. The exam-client running one force-submits the remaining attempts and exports the
+// results; it closes the delivery on its own at the same time if it cannot be reached.
+func (s *SchedulerService) closeEndedDeliveries(now time.Time) {
+	deliveries, err := s.deliveryModel.GetDeliveriesForClosing(now, s.closeGracePeriod)
+	if err != nil {
+		log.Printf("Error fetching deliveries for closing: %v", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		if err := s.deliveryModel.CloseDelivery(delivery.ID); err != nil {
+			log.Printf("Failed to close delivery %d (%s): %v", delivery.ID, delivery.DisplayName, err)
+			continue
+		}
+		s.disarmReleaseTimer(delivery.ID)
+
+		// Deliveries that never started have nothing running on an exam-client
+		if delivery.LastStatus != nil && *delivery.LastStatus != "" {
+			if err := s.examClientAssigner.FinishDelivery(delivery.ID); err != nil {
+				log.Printf("Failed to notify exam client of closing delivery %d: %v", delivery.ID, err)
+			}
+		}
+
+		log.Printf("Closed delivery %d (%s), ended at %v", delivery.ID, delivery.DisplayName, delivery.ClosesAt)
+
+		if s.collusion != nil {
+			if report, err := s.collusion.AnalyzeAndStore(delivery.ID); err != nil {
+				log.Printf("Failed to store collusion analysis of delivery %d: %v", delivery.ID, err)
+			} else {
+				log.Printf("Stored collusion analysis of delivery %d: %d candidates, %d pairs",
+					delivery.ID, report.Candidates, report.PairsAnalyzed)
+			}
+		}
+
+		if s.publisher != nil {
+			s.publisher.PublishDelta(delivery.ID, "delivery_closed", map[string]interface{}{
+				"closes_at": delivery.ClosesAt,
+				"closed_at": now,
+			})
+		}
+	}
+}
+
+// stageUpcomingDeliveries queues the encrypted exam content of deliveries starting within
+// the staging lead time for an exam-client to stage
+func (s *SchedulerService) stageUpcomingDeliveries(now time.Time) {
+	deliveries, err := s.deliveryModel.GetDeliveriesForStaging(now.Add(s.stagingLeadTime))
+	if err != nil {
+		log.Printf("Error fetching deliveries for staging: %v", err)
+		return
+	}
+
+	capacity := s.examClientAssigner.GetAvailableCapacity()
+	for _, delivery := range deliveries {
+		// Deliveries already due are staged by startDelivery
+		if !delivery.ScheduledAt.After(now) {
+			continue
+		}
+
+		if capacity <= 0 {
+			if err := s.stagingModel.MarkWaiting(delivery.ID, *delivery.ScheduledAt); err != nil {
+				log.Printf("Failed to record staging of delivery %d: %v", delivery.ID, err)
+			}
+			continue
+		}
+
+		policy, err := s.networkAccess.GetPolicy(delivery.ID)
+		if err != nil {
+			log.Printf("Failed to stage delivery %d (%s): %v", delivery.ID, delivery.DisplayName, err)
+			continue
+		}
+		if err := s.stageDelivery(delivery, policy); err != nil {
+			log.Printf("Failed to stage delivery %d (%s): %v", delivery.ID, delivery.DisplayName, err)
+			continue
+		}
+		capacity--
+
+		log.Printf("Queued delivery %d (%s) for staging, starting at %v",
+			delivery.ID, delivery.DisplayName, delivery.ScheduledAt)
+	}
+}
+
+// stageDelivery packages the exam content of a delivery and queues it for an exam-client
+func (s *SchedulerService) stageDelivery(delivery *models.DeliveryListItem, policy *tables.DeliveryNetworkPolicy) error {
+	// The exam content is encrypted with the delivery key, which the exam-client only
+	// receives at the scheduled start
+	content, err := s.examContent.SealContent(delivery.ID, delivery.ExamID)
 	if err != nil {
 		return err
 	}
 
+	if err := s.stagingModel.Queue(delivery.ID, content.Digest, len(content.Sealed), content.Questions, *delivery.ScheduledAt); err != nil {
+		return err
+	}
+
 	// Create exam data for the assignment
 	examData := map[string]interface{}{
 		"delivery_id":  delivery.ID,
@@ -126,20 +288,155 @@ func (s *SchedulerService) startDelivery(ctx context.Context, delivery *models.D
 		"scheduled_at": delivery.ScheduledAt,
 		"duration":     delivery.Duration,
 		"is_anytime":   delivery.IsAnytime,
-		"exam_title":   delivery.ExamTitle,
-		"group_name":   delivery.GroupName,
+		// Enforced locally by the exam-client, also when the coordinator cannot reach it
+		"attempts_until": s.attemptsUntil(delivery),
+		"finish_at":      s.finishAt(delivery),
+		"exam_title":     delivery.ExamTitle,
+		"group_name":     delivery.GroupName,
+		// Network allow-list enforced locally by the exam-client
+		"network_policy": policy,
+		// Exam content encrypted with the delivery key, and its digest
+		"content":         content.Sealed,
+		"content_digest":  content.Digest,
+		"total_questions": content.Questions,
 	}
 
 	// Assign to exam client
-	s.examClientAssigner.AssignDelivery(delivery.ID, delivery.DisplayName, examData)
+	if err := s.examClientAssigner.AssignDelivery(delivery.ID, delivery.DisplayName, examData); err != nil {
+		if markErr := s.stagingModel.MarkQueueFailed(delivery.ID, err.Error()); markErr != nil {
+			log.Printf("Failed to record staging of delivery %d: %v", delivery.ID, markErr)
+		}
+		return err
+	}
+	return nil
+}
 
-	log.Printf("Assigned delivery to exam client: ID=%d, Name='%s', ScheduledAt=%v",
-		delivery.ID, delivery.DisplayName, delivery.ScheduledAt)
+// attemptsUntil is the last moment an attempt of an anytime delivery can be started
+func (s *SchedulerService) attemptsUntil(delivery *models.DeliveryListItem) *time.Time {
+	if !delivery.IsAnytime {
+		return nil
+	}
+	return delivery.EndedAt
+}
 
-	return nil
+// finishAt is the moment a delivery is closed: its end plus the grace period
+func (s *SchedulerService) finishAt(delivery *models.DeliveryListItem) *time.Time {
+	if delivery.ClosesAt == nil {
+		return nil
+	}
+	finishAt := delivery.ClosesAt.Add(s.closeGracePeriod)
+	return &finishAt
+}
+
+// isStaging reports whether a delivery is staged or being staged on an exam-client
+func (s *SchedulerService) isStaging(deliveryID int) bool {
+	staging, err := s.stagingModel.Get(deliveryID)
+	if err != nil {
+		return false
+	}
+	switch staging.Status {
+	case tables.StagingStatusQueued, tables.StagingStatusAssigned, tables.StagingStatusStaged:
+		return true
+	}
+	return false
+}
+
+// alertIncompleteStaging alerts the deliveries starting within stagingAlertBefore whose
+// content is not staged yet
+func (s *SchedulerService) alertIncompleteStaging(now time.Time) {
+	stagings, err := s.stagingModel.ListIncomplete(now.Add(s.stagingAlertBefore))
+	if err != nil {
+		log.Printf("Error fetching incomplete stagings: %v", err)
+		return
+	}
+
+	for _, staging := range stagings {
+		log.Printf("ALERT: exam content of delivery %d is not staged (status: %s), starting at %v",
+			staging.DeliveryID, staging.Status, staging.ReleaseAt)
+
+		data := map[string]interface{}{
+			"status":     staging.Status,
+			"client_id":  staging.ClientID,
+			"release_at": staging.ReleaseAt,
+			"last_error": staging.LastError,
+		}
+		if s.publisher != nil {
+			s.publisher.PublishDelta(staging.DeliveryID, "staging_incomplete", data)
+		}
+
+		if err := s.stagingModel.MarkAlerted(staging.DeliveryID); err != nil {
+			log.Printf("Failed to mark staging of delivery %d alerted: %v", staging.DeliveryID, err)
+		}
+	}
+}
+
+// armReleaseTimers wakes the scheduler at the scheduled start of every staged delivery, so
+// the key is released on time rather than at the next check
+func (s *SchedulerService) armReleaseTimers() {
+	stagings, err := s.stagingModel.ListPendingRelease()
+	if err != nil {
+		log.Printf("Error fetching pending key releases: %v", err)
+		return
+	}
+
+	s.timersMux.Lock()
+	defer s.timersMux.Unlock()
+
+	for _, staging := range stagings {
+		if _, armed := s.releaseTimers[staging.DeliveryID]; armed {
+			continue
+		}
+		delay := time.Until(staging.ReleaseAt)
+		if delay <= 0 || delay > s.stagingLeadTime+s.checkInterval {
+			continue
+		}
+		s.releaseTimers[staging.DeliveryID] = time.AfterFunc(delay, func() {
+			select {
+			case s.wake <- struct{}{}:
+			default:
+			}
+		})
+	}
+}
+
+func (s *SchedulerService) disarmReleaseTimer(deliveryID int) {
+	s.timersMux.Lock()
+	defer s.timersMux.Unlock()
+
+	if timer, ok := s.releaseTimers[deliveryID]; ok {
+		timer.Stop()
+		delete(s.releaseTimers, deliveryID)
+	}
+}
+
+func (s *SchedulerService) stopReleaseTimers() {
+	s.timersMux.Lock()
+	defer s.timersMux.Unlock()
+
+	for deliveryID, timer := range s.releaseTimers {
+		timer.Stop()
+		delete(s.releaseTimers, deliveryID)
+	}
 }
 
 // SetCheckInterval allows customizing the check interval for testing
 func (s *SchedulerService) SetCheckInterval(interval time.Duration) {
 	s.checkInterval = interval
 }
+
+// SetCollusionAnalysis sets the service whose analysis is stored when a delivery closes
+func (s *SchedulerService) SetCollusionAnalysis(collusion *CollusionService) {
+	s.collusion = collusion
+}
+
+// SetCloseGracePeriod sets how long after their end deliveries are closed
+func (s *SchedulerService) SetCloseGracePeriod(grace time.Duration) {
+	s.closeGracePeriod = grace
+}
+
+// SetStagingWindow sets how long before the start exam content is staged, and how long
+// before the start incomplete staging is alerted
+func (s *SchedulerService) SetStagingWindow(leadTime, alertBefore time.Duration) {
+	s.stagingLeadTime = leadTime
+	s.stagingAlertBefore = alertBefore
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/medxamion/medxamion/internal/config"
+	"github.com/medxamion/medxamion/internal/models"
+	"github.com/medxamion/medxamion/internal/tables"
+	"github.com/medxamion/medxamion/internal/utils"
+)
+
+// TwoFactorService handles TOTP two-factor authentication: enrolling an authenticator,
+// checking codes and recovery codes, and completing sessions limited until a code is entered.
+// Wrong codes entered at sign-in count as failed logins of the user.
+type TwoFactorService struct {
+	userModel       *models.UserModel
+	sessionModel    *models.SessionModel
+	loginProtection *LoginProtectionService
+	config          *config.Config
+}
+
+func NewTwoFactorService(userModel *models.UserModel, sessionModel *models.SessionModel, loginProtection *LoginProtectionService, config *config.Config) *TwoFactorService {
+	return &TwoFactorService{
+		userModel:       userModel,
+		sessionModel:    sessionModel,
+		loginProtection: loginProtection,
+		config:          config,
+	}
+}
+
+// TwoFactorEnabled reports whether a user has confirmed two-factor authentication
+func TwoFactorEnabled(user *tables.User) bool {
+	return user.TwoFactorConfirmedAt != nil && user.TwoFactorSecret != nil
+}
+
+// TwoFactorRequired reports whether a role of the session's user requires two-factor
+// authentication
+func TwoFactorRequired(sessionData *tables.SessionData) bool {
+	for _, role := range sessionData.Roles {
+		if role.TwoFactorRequired {
+			return true
+		}
+	}
+	return false
+}
+
+// TwoFactorPending works out what a session still needs before it grants access: a code
+// when the user has two-factor authentication, or enrolling when a role requires it.
+// The session's roles must be resolved.
+func TwoFactorPending(user *tables.User, sessionData *tables.SessionData) string {
+	if TwoFactorEnabled(user) {
+		if !sessionData.TwoFactorVerified {
+			return tables.TwoFactorPendingVerify
+		}
+		return ""
+	}
+	if TwoFactorRequired(sessionData) {
+		return tables.TwoFactorPendingEnroll
+	}
+	return ""
+}
+
+// Setup generates a new secret for a user who has not confirmed two-factor authentication
+// yet, returning it with the otpauth URI to enroll it in an authenticator
+func (s *TwoFactorService) Setup(user *tables.User) (*tables.TwoFactorSetup, error) {
+	if TwoFactorEnabled(user) {
+		return nil, fmt.Errorf("two-factor authentication already enabled")
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userModel.SetTwoFactorSecret(user.ID, secret); err != nil {
+		return nil, err
+	}
+
+	return &tables.TwoFactorSetup{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPURI(s.config.TwoFactorIssuer, user.Username, secret),
+	}, nil
+}
+
+// Confirm turns on two-factor authentication once a code from the enrolled secret is
+// entered, and completes the session. It returns the recovery codes, which are only
+// shown this once.
+func (s *TwoFactorService) Confirm(user *tables.User, sessionID string, sessionData *tables.SessionData, code, ipAddress string) ([]string, error) {
+	if TwoFactorEnabled(user) {
+		return nil, fmt.Errorf("two-factor authentication already enabled")
+	}
+	if user.TwoFactorSecret == nil {
+		return nil, fmt.Errorf("two-factor authentication not set up")
+	}
+
+	step, ok := utils.ValidateTOTP(*user.TwoFactorSecret, code, time.Now())
+	if !ok {
+		return nil, s.failAttempt(sessionID, sessionData, ipAddress)
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userModel.ConfirmTwoFactor(user.ID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	if err := s.completeSession(sessionID, sessionData, ipAddress); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify checks the two-factor code or recovery code entered for a session limited until
+// it is, and completes the session. Too many wrong codes sign the session out. While the
+// user's logins are throttled it returns a LoginBlockedError without checking the code.
+func (s *TwoFactorService) Verify(user *tables.User, sessionID string, sessionData *tables.SessionData, code, ipAddress string) error {
+	if !TwoFactorEnabled(user) {
+		return fmt.Errorf("two-factor authentication not enabled")
+	}
+	if err := s.loginProtection.Check(tables.LoginScopeUser, user.Username, ipAddress); err != nil {
+		return err
+	}
+
+	if err := s.CheckCode(user, code); err != nil {
+		if err.Error() != "invalid two-factor code" {
+			return err
+		}
+		return s.failAttempt(sessionID, sessionData, ipAddress)
+	}
+	return s.completeSession(sessionID, sessionData, ipAddress)
+}
+
+// CheckCode checks a two-factor code or, failing that, a recovery code of a user. Each code
+// can only be used once.
+func (s *TwoFactorService) CheckCode(user *tables.User, code string) error {
+	if !TwoFactorEnabled(user) {
+		return fmt.Errorf("two-factor authentication not enabled")
+	}
+
+	if step, ok := utils.ValidateTOTP(*user.TwoFactorSecret, code, time.Now()); ok {
+		fresh, err := s.userModel.UseTwoFactorStep(user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return fmt.Errorf("invalid two-factor code")
+		}
+		return nil
+	}
+
+	used, err := s.userModel.UseRecoveryCode(user.ID, utils.HashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return fmt.Errorf("invalid two-factor code")
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user, after checking one of their
+// codes, and returns the new ones
+func (s *TwoFactorService) RegenerateRecoveryCodes(user *tables.User, code string) ([]string, error) {
+	if err := s.CheckCode(user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userModel.SetRecoveryCodes(user.ID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns off two-factor authentication for a user, after checking one of their codes.
+// Users whose role requires it cannot turn it off.
+func (s *TwoFactorService) Disable(user *tables.User, sessionData *tables.SessionData, code string) error {
+	if TwoFactorRequired(sessionData) {
+		return fmt.Errorf("two-factor authentication required by role")
+	}
+	if err := s.CheckCode(user, code); err != nil {
+		return err
+	}
+	return s.userModel.ResetTwoFactor(user.ID)
+}
+
+// Reset turns off two-factor authentication for a user who lost their authenticator and
+// recovery codes, and signs them out. With a role requiring it, they must enroll again at
+// their next sign-in.
+func (s *TwoFactorService) Reset(userID int) error {
+	if err := s.userModel.ResetTwoFactor(userID); err != nil {
+		return err
+	}
+	return s.sessionModel.DeleteByUserID(userID)
+}
+
+// Status gets the two-factor state of the session's user
+func (s *TwoFactorService) Status(user *tables.User, sessionData *tables.SessionData) (*tables.TwoFactorStatus, error) {
+	status := &tables.TwoFactorStatus{
+		Enabled:  TwoFactorEnabled(user),
+		Required: TwoFactorRequired(sessionData),
+		Pending:  sessionData.TwoFactorPending,
+	}
+	if status.Enabled {
+		count, err := s.userModel.GetRecoveryCodeCount(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		status.RecoveryCodesLeft = count
+	}
+	return status, nil
+}
+
+// completeSession lifts the two-factor limit of a session. Only now is the sign-in
+// successful, so the session counts toward the user's session limit and the failed logins
+// of the user are cleared.
+func (s *TwoFactorService) completeSession(sessionID string, sessionData *tables.SessionData, ipAddress string) error {
+	sessionData.TwoFactorVerified = true
+	sessionData.TwoFactorAttempts = 0
+	sessionData.TwoFactorPending = ""
+	if err := s.sessionModel.UpdateSessionData(sessionID, sessionData); err != nil {
+		return err
+	}
+	if err := s.sessionModel.EnforceLimit(sessionData.UserID, sessionID, maxSessions(s.config, sessionData.Roles)); err != nil {
+		return err
+	}
+	s.loginProtection.RecordSuccess(tables.LoginScopeUser, sessionData.Username, ipAddress)
+	return nil
+}
+
+// failAttempt counts a wrong code entered in a session as a failed login of the user,
+// signing the session out after too many
+func (s *TwoFactorService) failAttempt(sessionID string, sessionData *tables.SessionData, ipAddress string) error {
+	s.loginProtection.RecordFailure(tables.LoginScopeUser, sessionData.Username, ipAddress)
+
+	sessionData.TwoFactorAttempts++
+	if sessionData.TwoFactorAttempts >= s.config.TwoFactorMaxAttempts {
+		if err := s.sessionModel.Delete(sessionID); err != nil {
+			return err
+		}
+		return fmt.Errorf("too many invalid two-factor codes")
+	}
+
+	if err := s.sessionModel.UpdateSessionData(sessionID, sessionData); err != nil {
+		return err
+	}
+	return fmt.Errorf("invalid two-factor code")
+}
+
+// generateRecoveryCodes returns new recovery codes and the hashes to store
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, utils.HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
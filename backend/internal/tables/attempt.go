@@ -29,18 +29,62 @@ type AttemptQuestion struct {
 	IsCorrect  *bool      `db:"is_correct" json:"is_correct"`
 	AnsweredAt *time.Time `db:"answered_at" json:"answered_at"`
 	TimeSpent  int        `db:"time_spent" json:"time_spent"`
+	// Visits and AnswerChanges count the saves of a question and the times its answer was replaced
+	Visits        int `db:"visits" json:"visits"`
+	AnswerChanges int `db:"answer_changes" json:"answer_changes"`
+	// Flagged marks a question the candidate wants to review before submitting
+	Flagged   bool       `db:"flagged" json:"flagged"`
+	FlaggedAt *time.Time `db:"flagged_at" json:"flagged_at"`
 	Timestamps
 }
 
+// AttemptQuestionHistory records one visit of a question and the answer change it made
+type AttemptQuestionHistory struct {
+	ID             int       `db:"id" json:"id"`
+	AttemptID      int       `db:"attempt_id" json:"attempt_id"`
+	QuestionID     int       `db:"question_id" json:"question_id"`
+	Kind           string    `db:"kind" json:"kind"`
+	PreviousAnswer *string   `db:"previous_answer" json:"previous_answer"`
+	Answer         *string   `db:"answer" json:"answer"`
+	TimeSpent      int       `db:"time_spent" json:"time_spent"`
+	Source         string    `db:"source" json:"source"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+}
+
 type AttemptCreateRequest struct {
 	DeliveryID int    `json:"delivery_id" required:"true" minimum:"1"`
-	IPAddress  string `json:"ip_address" required:"true"`
+	IPAddress  string `json:"ip_address,omitempty" doc:"Ignored: the address the request comes from is recorded"`
 }
 
 type AttemptAnswerRequest struct {
 	QuestionID int     `json:"question_id" required:"true" minimum:"1"`
-	Answer     *string `json:"answer,omitempty"`
-	TimeSpent  int     `json:"time_spent" default:"0" minimum:"0"`
+	Answer     *string `json:"answer,omitempty" doc:"Omit to record time spent on the question without answering"`
+	TimeSpent  int     `json:"time_spent" default:"0" minimum:"0" doc:"Seconds spent on the question since it was displayed"`
+}
+
+type AttemptFlagRequest struct {
+	Flagged bool `json:"flagged" default:"true"`
+}
+
+// AttemptReviewQuestion is the state of one question shown on the review screen
+type AttemptReviewQuestion struct {
+	Number     int  `db:"number" json:"number"`
+	QuestionID int  `db:"question_id" json:"question_id"`
+	ItemID     int  `db:"item_id" json:"item_id"`
+	Answered   bool `db:"answered" json:"answered"`
+	Flagged    bool `db:"flagged" json:"flagged"`
+}
+
+// AttemptReview lists what is left to do in an attempt before it is submitted
+type AttemptReview struct {
+	AttemptID           int                     `json:"attempt_id"`
+	TotalQuestions      int                     `json:"total_questions"`
+	Answered            int                     `json:"answered"`
+	Unanswered          int                     `json:"unanswered"`
+	Flagged             int                     `json:"flagged"`
+	UnansweredQuestions []int                   `json:"unanswered_questions"`
+	FlaggedQuestions    []int                   `json:"flagged_questions"`
+	Questions           []AttemptReviewQuestion `json:"questions"`
 }
 
 type AttemptWithDetails struct {
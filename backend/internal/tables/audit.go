@@ -0,0 +1,69 @@
+package tables
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Changes recorded in the audit log
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+// Kinds of records whose changes are recorded in the audit log
+const (
+	AuditEntityExam        = "exam"
+	AuditEntityItem        = "item"
+	AuditEntityCategory    = "category"
+	AuditEntityGroup       = "group"
+	AuditEntityParticipant = "participant"
+	AuditEntityDelivery    = "delivery"
+	AuditEntityUser        = "user"
+	AuditEntityRole        = "role"
+	AuditEntityClient      = "client"
+	AuditEntityAttempt     = "attempt"
+)
+
+// AuditActor is who made a change, and from where
+type AuditActor struct {
+	UserID    int
+	Name      string
+	ClientID  int
+	IPAddress string
+}
+
+// AuditChange is a field of a record before and after a change. Old is null for created
+// records and New for deleted ones.
+type AuditChange struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// AuditEntry is a change of a record in the audit log
+type AuditEntry struct {
+	ID         int     `db:"id" json:"id"`
+	ClientID   *int    `db:"client_id" json:"client_id" doc:"Client of the record, null for users, roles and clients"`
+	ActorID    *int    `db:"actor_id" json:"actor_id" doc:"User who made the change, null when the user was deleted"`
+	ActorName  string  `db:"actor_name" json:"actor_name"`
+	IPAddress  *string `db:"ip_address" json:"ip_address"`
+	EntityType string  `db:"entity_type" json:"entity_type" enum:"exam,item,category,group,participant,delivery,user,role,client,attempt"`
+	EntityID   int     `db:"entity_id" json:"entity_id"`
+	Action     string  `db:"action" json:"action" enum:"create,update,delete"`
+	// The changed fields, as an object of AuditChange by field name
+	Changes   json.RawMessage `db:"changes" json:"changes"`
+	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+}
+
+// AuditSearchRequest filters the audit log. Zero values do not filter.
+type AuditSearchRequest struct {
+	ClientID   int
+	EntityType string
+	EntityID   int
+	ActorID    int
+	Action     string
+	Field      string
+	From       time.Time
+	To         time.Time
+}
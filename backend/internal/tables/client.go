@@ -0,0 +1,58 @@
+package tables
+
+// Client is a tenant: a college or organisation whose exams, items, categories, groups and
+// participants are kept apart from those of the other clients on the install
+type Client struct {
+	ID   int    `db:"id" json:"id"`
+	Name string `db:"name" json:"name"`
+	ClientSettings
+	Timestamps
+}
+
+// ClientSettings are the settings of a client
+type ClientSettings struct {
+	// Taker code format of new groups that do not set their own
+	TakerCodeFormat
+	// IANA time zone the client schedules deliveries in
+	Timezone string `db:"timezone" json:"timezone"`
+	// Logo the frontend shows for the client
+	LogoURL *string `db:"logo_url" json:"logo_url"`
+}
+
+// ClientWithUsers is a client with how many users work for it
+type ClientWithUsers struct {
+	Client
+	UserCount int `db:"user_count" json:"user_count"`
+}
+
+// CurrentClient is the client a session works with, and the clients it can switch to
+type CurrentClient struct {
+	Client    *Client  `json:"client"`
+	Available []Client `json:"available"`
+}
+
+type ClientCreateRequest struct {
+	Name string `json:"name" required:"true" minLength:"1" maxLength:"255"`
+	ClientSettingsRequest
+}
+
+type ClientUpdateRequest struct {
+	Name *string `json:"name,omitempty" minLength:"1" maxLength:"255"`
+	ClientSettingsRequest
+}
+
+type ClientSettingsRequest struct {
+	TakerCodePrefix    *string `json:"taker_code_prefix,omitempty" maxLength:"8" pattern:"^[2-9A-HJKMNP-TW-Z]*$" doc:"Prefix of the taker codes of new groups"`
+	TakerCodeLength    *int    `json:"taker_code_length,omitempty" minimum:"6" maximum:"16" doc:"Random characters in the taker codes of new groups"`
+	TakerCodeGroupSize *int    `json:"taker_code_group_size,omitempty" minimum:"0" maximum:"8" doc:"Characters between dashes when the codes of new groups are printed"`
+	Timezone           *string `json:"timezone,omitempty" minLength:"1" maxLength:"64" doc:"IANA time zone, such as Asia/Jakarta"`
+	LogoURL            *string `json:"logo_url,omitempty" maxLength:"255" doc:"Logo shown for the client, empty to remove it"`
+}
+
+type SwitchClientRequest struct {
+	ClientID int `json:"client_id" required:"true" minimum:"1" doc:"Client to work with"`
+}
+
+type UserClientsRequest struct {
+	ClientIDs []int `json:"client_ids" required:"true" doc:"Every client the user works for"`
+}
@@ -0,0 +1,69 @@
+package tables
+
+import "time"
+
+// CandidateResponse is one answered question of an attempt, used for response-pattern analysis
+type CandidateResponse struct {
+	AttemptID  int    `db:"attempt_id" json:"attempt_id"`
+	TakerID    int    `db:"taker_id" json:"taker_id"`
+	TakerName  string `db:"taker_name" json:"taker_name"`
+	TakerCode  string `db:"taker_code" json:"taker_code"`
+	IPAddress  string `db:"ip_address" json:"ip_address"`
+	QuestionID int    `db:"question_id" json:"question_id"`
+	Answer     string `db:"answer" json:"answer"`
+	IsCorrect  *bool  `db:"is_correct" json:"is_correct"`
+}
+
+// CollusionPair describes a pair of candidates with similar answer patterns
+type CollusionPair struct {
+	AttemptA   int    `json:"attempt_a"`
+	AttemptB   int    `json:"attempt_b"`
+	TakerA     string `json:"taker_a"`
+	TakerB     string `json:"taker_b"`
+	TakerCodeA string `json:"taker_code_a"`
+	TakerCodeB string `json:"taker_code_b"`
+
+	CommonItems        int `json:"common_items"`
+	IdenticalAnswers   int `json:"identical_answers"`
+	IdenticalIncorrect int `json:"identical_incorrect"`
+	IncorrectA         int `json:"incorrect_a"`
+	IncorrectB         int `json:"incorrect_b"`
+
+	// g2: identical answers beyond what option popularity predicts (max over both directions)
+	G2       float64 `json:"g2"`
+	G2PValue float64 `json:"g2_p_value"`
+	// Angoff's B: identical incorrect answers beyond what the pair's error counts predict
+	AngoffB       float64 `json:"angoff_b"`
+	AngoffBPValue float64 `json:"angoff_b_p_value"`
+	// Index is the larger of the two standardized statistics and is used for ranking
+	Index float64 `json:"index"`
+
+	SameIP     bool `json:"same_ip"`
+	SameSubnet bool `json:"same_subnet"`
+	Flagged    bool `json:"flagged"`
+
+	IdenticalIncorrectQuestions []int    `json:"identical_incorrect_questions"`
+	Evidence                    []string `json:"evidence"`
+}
+
+// CollusionReport is the result of a collusion analysis over one delivery
+type CollusionReport struct {
+	DeliveryID         int             `json:"delivery_id"`
+	Candidates         int             `json:"candidates"`
+	Items              int             `json:"items"`
+	PairsAnalyzed      int             `json:"pairs_analyzed"`
+	Threshold          float64         `json:"threshold"`
+	ProximityThreshold float64         `json:"proximity_threshold"`
+	MinCommonItems     int             `json:"min_common_items"`
+	Pairs              []CollusionPair `json:"pairs"`
+	GeneratedAt        time.Time       `json:"generated_at"`
+}
+
+// CollusionAnalysisRequest holds the tuning parameters of a collusion analysis
+type CollusionAnalysisRequest struct {
+	Threshold          float64 `query:"threshold" default:"3.09" minimum:"0" doc:"Index (z-score) above which a pair is flagged; 3.09 is p < 0.001"`
+	ProximityThreshold float64 `query:"proximity_threshold" default:"2.33" minimum:"0" doc:"Lower threshold for pairs that shared an IP address or subnet; 2.33 is p < 0.01"`
+	MinCommonItems     int     `query:"min_common_items" default:"10" minimum:"1" doc:"Minimum number of questions both candidates answered"`
+	Limit              int     `query:"limit" default:"100" minimum:"1" maximum:"1000"`
+	FlaggedOnly        bool    `query:"flagged_only" default:"false"`
+}
@@ -60,6 +60,9 @@ type Timestamps struct {
 	UpdatedAt *time.Time `db:"updated_at" json:"updated_at"`
 }
 
+// SoftDelete marks rows that are deleted but kept. Records returned on their own as a response
+// body (exams, items, groups, participants and deliveries) declare DeletedAt themselves
+// instead: huma cannot add its $schema field to structs embedding a single-pointer struct.
 type SoftDelete struct {
 	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
 }
@@ -17,6 +17,7 @@ type Delivery struct {
 	DisplayName    *string    `db:"display_name" json:"display_name"`
 	StartedAt      *time.Time `db:"started_at" json:"started_at"`
 	Timestamps
+	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
 }
 
 type DeliveryTaker struct {
@@ -32,6 +33,7 @@ type DeliveryCreateRequest struct {
 	Name           *string    `json:"name,omitempty" maxLength:"255"`
 	ScheduledAt    *time.Time `json:"scheduled_at,omitempty"`
 	Duration       int        `json:"duration" required:"true" minimum:"1" default:"60"`
+	EndedAt        *time.Time `json:"ended_at,omitempty" doc:"End of the delivery; for anytime deliveries the last moment an attempt can be started"`
 	IsAnytime      bool       `json:"is_anytime" default:"false"`
 	AutomaticStart bool       `json:"automatic_start" default:"true"`
 	DisplayName    *string    `json:"display_name,omitempty" maxLength:"255"`
@@ -41,6 +43,7 @@ type DeliveryUpdateRequest struct {
 	Name           *string    `json:"name,omitempty" maxLength:"255"`
 	ScheduledAt    *time.Time `json:"scheduled_at,omitempty"`
 	Duration       *int       `json:"duration,omitempty" minimum:"1"`
+	EndedAt        *time.Time `json:"ended_at,omitempty" doc:"End of the delivery; for anytime deliveries the last moment an attempt can be started"`
 	IsAnytime      *bool      `json:"is_anytime,omitempty"`
 	AutomaticStart *bool      `json:"automatic_start,omitempty"`
 	DisplayName    *string    `json:"display_name,omitempty" maxLength:"255"`
@@ -0,0 +1,12 @@
+package tables
+
+import "time"
+
+// DeliveryAccessCode is the second code, announced in the room, that participants must enter
+// with their taker code to log in to a delivery
+type DeliveryAccessCode struct {
+	DeliveryID int       `db:"delivery_id" json:"delivery_id"`
+	Code       string    `db:"code" json:"code"`
+	CreatedBy  *int      `db:"created_by" json:"created_by"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
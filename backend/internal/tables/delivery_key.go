@@ -0,0 +1,12 @@
+package tables
+
+import "time"
+
+// DeliveryKey encrypts the exam content, answers and final results of a delivery on its exam-client
+type DeliveryKey struct {
+	DeliveryID  int        `db:"delivery_id" json:"delivery_id"`
+	KeyMaterial string     `db:"key_material" json:"-"`
+	ReleasedAt  *time.Time `db:"released_at" json:"released_at"`
+	ReleasedTo  *string    `db:"released_to" json:"released_to"`
+	Timestamps
+}
@@ -0,0 +1,63 @@
+package tables
+
+import "time"
+
+const (
+	NetworkRuleKindCIDR       = "cidr"
+	NetworkRuleKindExamClient = "exam_client"
+)
+
+// DeliveryNetworkRule is a single allow-list entry for a delivery
+type DeliveryNetworkRule struct {
+	ID          int     `db:"id" json:"id"`
+	DeliveryID  int     `db:"delivery_id" json:"delivery_id"`
+	Kind        string  `db:"kind" json:"kind"`
+	Value       string  `db:"value" json:"value"`
+	Description *string `db:"description" json:"description"`
+	CreatedBy   *int    `db:"created_by" json:"created_by"`
+	Timestamps
+}
+
+// DeliveryNetworkOverride lets a participant bypass the allow-list of a delivery
+type DeliveryNetworkOverride struct {
+	ID         int        `db:"id" json:"id"`
+	DeliveryID int        `db:"delivery_id" json:"delivery_id"`
+	TakerID    int        `db:"taker_id" json:"taker_id"`
+	TakerName  *string    `db:"taker_name" json:"taker_name,omitempty"`
+	Reason     *string    `db:"reason" json:"reason"`
+	GrantedBy  *int       `db:"granted_by" json:"granted_by"`
+	ExpiresAt  *time.Time `db:"expires_at" json:"expires_at"`
+	Timestamps
+}
+
+// DeliveryAccessViolation records a request rejected by the allow-list
+type DeliveryAccessViolation struct {
+	ID         int        `db:"id" json:"id"`
+	DeliveryID int        `db:"delivery_id" json:"delivery_id"`
+	TakerID    *int       `db:"taker_id" json:"taker_id"`
+	AttemptID  *int       `db:"attempt_id" json:"attempt_id"`
+	IPAddress  string     `db:"ip_address" json:"ip_address"`
+	Action     string     `db:"action" json:"action"`
+	Source     string     `db:"source" json:"source"`
+	CreatedAt  *time.Time `db:"created_at" json:"created_at"`
+}
+
+type DeliveryNetworkRuleRequest struct {
+	Kind        string  `json:"kind" enum:"cidr,exam_client" default:"cidr"`
+	Value       string  `json:"value" required:"true" minLength:"1" maxLength:"255"`
+	Description *string `json:"description,omitempty" maxLength:"255"`
+}
+
+type DeliveryNetworkOverrideRequest struct {
+	TakerID   int        `json:"taker_id" required:"true" minimum:"1"`
+	Reason    *string    `json:"reason,omitempty" maxLength:"255"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// DeliveryNetworkPolicy is the allow-list shipped to exam-clients with an assignment. A
+// restricted policy whose networks could not be resolved allows no network at all.
+type DeliveryNetworkPolicy struct {
+	Restricted      bool     `json:"restricted"`
+	AllowedNetworks []string `json:"allowed_networks"`
+	OverrideTakers  []int    `json:"override_takers"`
+}
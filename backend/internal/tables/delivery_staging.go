@@ -0,0 +1,43 @@
+package tables
+
+import "time"
+
+const (
+	StagingStatusWaiting  = "waiting"
+	StagingStatusQueued   = "queued"
+	StagingStatusAssigned = "assigned"
+	StagingStatusStaged   = "staged"
+	StagingStatusFailed   = "failed"
+)
+
+// DeliveryStaging tracks the encrypted exam content of a delivery staged on an exam-client
+// ahead of its start, and the release of the delivery key
+type DeliveryStaging struct {
+	DeliveryID    int        `db:"delivery_id" json:"delivery_id"`
+	Status        string     `db:"status" json:"status"`
+	ClientID      *string    `db:"client_id" json:"client_id"`
+	ContentDigest *string    `db:"content_digest" json:"content_digest"`
+	ContentSize   *int       `db:"content_size" json:"content_size"`
+	QuestionCount *int       `db:"question_count" json:"question_count"`
+	ReleaseAt     time.Time  `db:"release_at" json:"release_at"`
+	QueuedAt      *time.Time `db:"queued_at" json:"queued_at"`
+	AssignedAt    *time.Time `db:"assigned_at" json:"assigned_at"`
+	StagedAt      *time.Time `db:"staged_at" json:"staged_at"`
+	ReleasedAt    *time.Time `db:"released_at" json:"released_at"`
+	AlertedAt     *time.Time `db:"alerted_at" json:"alerted_at"`
+	LastError     *string    `db:"last_error" json:"last_error"`
+	Timestamps
+}
+
+// StagingReportRequest is sent by an exam-client once it stored, or failed to store, staged content
+type StagingReportRequest struct {
+	Status        string `json:"status" enum:"staged,failed"`
+	ContentDigest string `json:"content_digest,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// ReleasedDeliveryKey is the delivery key released to the exam-client that staged the delivery
+type ReleasedDeliveryKey struct {
+	DeliveryID  int    `json:"delivery_id"`
+	DeliveryKey string `json:"delivery_key"` // wrapped with the client secret
+}
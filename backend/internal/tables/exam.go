@@ -1,5 +1,7 @@
 package tables
 
+import "time"
+
 type Exam struct {
 	ID          int     `db:"id" json:"id"`
 	Code        string  `db:"code" json:"code"`
@@ -11,6 +13,7 @@ type Exam struct {
 	IsRandom    bool    `db:"is_random" json:"is_random"`
 	ClientID    int     `db:"client_id" json:"client_id"`
 	Timestamps
+	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
 }
 
 type ExamItem struct {
@@ -0,0 +1,52 @@
+package tables
+
+import "time"
+
+// RegisteredClient represents a registered exam client
+type RegisteredClient struct {
+	ClientID      string    `json:"client_id"`
+	ClientIP      string    `json:"client_ip"`
+	Port          int       `json:"port"`
+	MaxDeliveries int       `json:"max_deliveries"`
+	Version       string    `json:"version"`
+	Capabilities  []string  `json:"capabilities"`
+	RegisteredAt  time.Time `json:"registered_at"`
+	LastSeen      time.Time `json:"last_seen"`
+	Status        string    `json:"status"` // "active", "inactive", "offline"
+
+	// Current status
+	ActiveDeliveries int                 `json:"active_deliveries"`
+	TotalProcessed   int                 `json:"total_processed"`
+	Uptime           int64               `json:"uptime"`
+	Deliveries       []*DeliveryInstance `json:"deliveries,omitempty"`
+	OutboxBacklog    int                 `json:"outbox_backlog"` // events and exports the client has not sent yet
+}
+
+// ExamClientStatus is the status an exam-client reports periodically
+type ExamClientStatus struct {
+	ActiveDeliveries int
+	TotalProcessed   int
+	Uptime           int64
+	Deliveries       []*DeliveryInstance
+	OutboxBacklog    int
+}
+
+// DeliveryInstance represents a running delivery instance
+type DeliveryInstance struct {
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	Status       string    `json:"status"`
+	StartedAt    time.Time `json:"started_at"`
+	Participants int       `json:"participants"`
+	Port         int       `json:"port"`
+}
+
+// DeliveryAssignment represents a delivery to be assigned to a client
+type DeliveryAssignment struct {
+	DeliveryID   int                    `json:"delivery_id"`
+	DeliveryName string                 `json:"delivery_name"`
+	ExamData     map[string]interface{} `json:"exam_data"`
+	Config       map[string]interface{} `json:"config"`
+	AssignedAt   time.Time              `json:"assigned_at"`
+	ClientID     string                 `json:"client_id,omitempty"`
+}
@@ -0,0 +1,33 @@
+package tables
+
+import "time"
+
+// ExamClientCredential is the signing secret of an enrolled exam-client
+type ExamClientCredential struct {
+	ID           int        `db:"id" json:"id"`
+	ClientID     string     `db:"client_id" json:"client_id"`
+	Secret       string     `db:"secret" json:"-"`
+	EnrolledIP   *string    `db:"enrolled_ip" json:"enrolled_ip"`
+	EnrolledAt   time.Time  `db:"enrolled_at" json:"enrolled_at"`
+	RevokedAt    *time.Time `db:"revoked_at" json:"revoked_at"`
+	RevokedBy    *int       `db:"revoked_by" json:"revoked_by"`
+	RevokeReason *string    `db:"revoke_reason" json:"revoke_reason"`
+	Timestamps
+}
+
+// ExamClientEnrollmentRequest exchanges the enrollment token for a client secret
+type ExamClientEnrollmentRequest struct {
+	ClientID        string `json:"client_id" minLength:"1" maxLength:"255"`
+	EnrollmentToken string `json:"enrollment_token" minLength:"1"`
+}
+
+// ExamClientEnrollment is the secret issued to an enrolled exam-client
+type ExamClientEnrollment struct {
+	ClientID string `json:"client_id"`
+	Secret   string `json:"secret"`
+}
+
+// RevokeExamClientRequest revokes the credentials of an exam-client
+type RevokeExamClientRequest struct {
+	Reason string `json:"reason,omitempty" maxLength:"500"`
+}
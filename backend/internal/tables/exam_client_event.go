@@ -0,0 +1,62 @@
+package tables
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event type recorded for the final results export of an exam-client
+const ExamClientEventFinalResults = "final_results"
+
+// ExamClientEventReceipt records an event received from the outbox of an exam-client
+type ExamClientEventReceipt struct {
+	ID         int             `db:"id" json:"id"`
+	EventID    string          `db:"event_id" json:"event_id"`
+	ClientID   string          `db:"client_id" json:"client_id"`
+	DeliveryID *int            `db:"delivery_id" json:"delivery_id"`
+	EventType  string          `db:"event_type" json:"event_type"`
+	Data       json.RawMessage `db:"data" json:"data,omitempty"`
+	OccurredAt *time.Time      `db:"occurred_at" json:"occurred_at"`
+	ReceivedAt time.Time       `db:"received_at" json:"received_at"`
+}
+
+// FinalResults is the part of the final results export of an exam-client the coordinator
+// imports. Participant IDs are taker IDs; attempt IDs are local to the exam-client.
+type FinalResults struct {
+	DeliveryID    int                       `json:"delivery_id"`
+	Attempts      []FinalResultsAttempt     `json:"attempts"`
+	Answers       []FinalResultsAnswer      `json:"answers"`
+	AnswerHistory []FinalResultsAnswerVisit `json:"answer_history"`
+}
+
+// FinalResultsAttempt is an attempt in the final results of an exam-client
+type FinalResultsAttempt struct {
+	ID            int        `json:"id"`
+	ParticipantID int        `json:"participant_id"`
+	StartedAt     *time.Time `json:"started_at"`
+	EndedAt       *time.Time `json:"ended_at"`
+}
+
+// FinalResultsAnswer is the last answer to a question in the final results of an exam-client
+type FinalResultsAnswer struct {
+	AttemptID     int        `json:"attempt_id"`
+	QuestionID    int        `json:"question_id"`
+	Answer        string     `json:"answer"`
+	SubmittedAt   time.Time  `json:"submitted_at"`
+	TimeSpent     int        `json:"time_spent"`
+	Visits        int        `json:"visits"`
+	AnswerChanges int        `json:"answer_changes"`
+	Flagged       bool       `json:"flagged"`
+	FlaggedAt     *time.Time `json:"flagged_at"`
+}
+
+// FinalResultsAnswerVisit is one visit of a question in the final results of an exam-client
+type FinalResultsAnswerVisit struct {
+	AttemptID      int       `json:"attempt_id"`
+	QuestionID     int       `json:"question_id"`
+	Kind           string    `json:"kind"`
+	PreviousAnswer *string   `json:"previous_answer"`
+	Answer         *string   `json:"answer"`
+	TimeSpent      int       `json:"time_spent"`
+	CreatedAt      time.Time `json:"created_at"`
+}
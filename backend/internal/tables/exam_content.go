@@ -0,0 +1,29 @@
+package tables
+
+// ExamContent is the exam content sent, encrypted, to the exam-client running a delivery.
+// Correct answers are not included.
+type ExamContent struct {
+	ExamID    int                   `json:"exam_id"`
+	Questions []ExamContentQuestion `json:"questions"`
+}
+
+// ExamContentQuestion is a question of the exam with its item (stem or vignette) and options
+type ExamContentQuestion struct {
+	ID          int                 `db:"id" json:"id"`
+	Position    int                 `db:"position" json:"position"`
+	ItemID      int                 `db:"item_id" json:"item_id"`
+	ItemTitle   string              `db:"item_title" json:"item_title"`
+	ItemContent *string             `db:"item_content" json:"item_content"`
+	Type        string              `db:"type" json:"type"`
+	Question    *string             `db:"question" json:"question"`
+	Score       int                 `db:"score" json:"score"`
+	Options     []ExamContentOption `db:"-" json:"options"`
+}
+
+// ExamContentOption is an answer option of a question
+type ExamContentOption struct {
+	ID         int     `db:"id" json:"id"`
+	QuestionID int     `db:"question_id" json:"-"`
+	Answer     *string `db:"answer" json:"answer"`
+	Order      int     `db:"order" json:"order"`
+}
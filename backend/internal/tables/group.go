@@ -10,19 +10,32 @@ type Group struct {
 	LastTakerCode int        `db:"last_taker_code" json:"last_taker_code"`
 	ClosedAt      *time.Time `db:"closed_at" json:"closed_at"`
 	ClientID      int        `db:"client_id" json:"client_id"`
+	TakerCodeFormat
 	Timestamps
+	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
+}
+
+// TakerCodeFormat is how the taker codes of a group are generated and printed
+type TakerCodeFormat struct {
+	TakerCodePrefix    string `db:"taker_code_prefix" json:"taker_code_prefix"`
+	TakerCodeLength    int    `db:"taker_code_length" json:"taker_code_length" doc:"Random characters in a code, besides the prefix and check character"`
+	TakerCodeGroupSize int    `db:"taker_code_group_size" json:"taker_code_group_size" doc:"Characters between dashes when a code is printed (0 prints it without dashes)"`
 }
 
 type GroupTaker struct {
-	GroupID int    `db:"group_id" json:"group_id"`
-	TakerID int    `db:"taker_id" json:"taker_id"`
-	Code    string `db:"taker_code" json:"code"`
+	GroupID int     `db:"group_id" json:"group_id"`
+	TakerID int     `db:"taker_id" json:"taker_id"`
+	Code    *string `db:"taker_code" json:"code" doc:"Taker code, or null when it was revoked"`
 }
 
 type GroupCreateRequest struct {
 	Name        string  `json:"name" required:"true" minLength:"1" maxLength:"255"`
 	Description *string `json:"description,omitempty"`
 	Code        *string `json:"code,omitempty" maxLength:"255"`
+
+	TakerCodePrefix    *string `json:"taker_code_prefix,omitempty" maxLength:"8" pattern:"^[2-9A-HJKMNP-TW-Z]*$" doc:"Prefix of new taker codes, from the characters codes are made of"`
+	TakerCodeLength    *int    `json:"taker_code_length,omitempty" minimum:"6" maximum:"16" doc:"Random characters in new taker codes"`
+	TakerCodeGroupSize *int    `json:"taker_code_group_size,omitempty" minimum:"0" maximum:"8" doc:"Characters between dashes when a code is printed"`
 }
 
 type GroupUpdateRequest struct {
@@ -30,6 +43,10 @@ type GroupUpdateRequest struct {
 	Description *string    `json:"description,omitempty"`
 	Code        *string    `json:"code,omitempty" maxLength:"255"`
 	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+
+	TakerCodePrefix    *string `json:"taker_code_prefix,omitempty" maxLength:"8" pattern:"^[2-9A-HJKMNP-TW-Z]*$" doc:"Prefix of new taker codes, from the characters codes are made of"`
+	TakerCodeLength    *int    `json:"taker_code_length,omitempty" minimum:"6" maximum:"16" doc:"Random characters in new taker codes"`
+	TakerCodeGroupSize *int    `json:"taker_code_group_size,omitempty" minimum:"0" maximum:"8" doc:"Characters between dashes when a code is printed"`
 }
 
 type GroupWithStats struct {
@@ -43,6 +60,7 @@ type GroupWithStats struct {
 	CreatedAt        time.Time  `db:"created_at" json:"created_at"`
 	UpdatedAt        time.Time  `db:"updated_at" json:"updated_at"`
 	ParticipantCount int        `db:"participant_count" json:"participant_count"`
+	TakerCodeFormat
 }
 
 type GroupSearchRequest struct {
@@ -50,3 +68,17 @@ type GroupSearchRequest struct {
 	Description string `query:"description" maxLength:"255"`
 	Pagination
 }
+
+// TakerCodeSlip is a participant with their taker code, as printed on an admission slip
+type TakerCodeSlip struct {
+	TakerID int     `db:"taker_id" json:"taker_id"`
+	Name    string  `db:"name" json:"name"`
+	Reg     *string `db:"reg" json:"reg"`
+	Code    *string `db:"taker_code" json:"code"`
+}
+
+type TakerCodeResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Code    string `json:"code,omitempty" doc:"The new taker code, formatted for printing"`
+}
@@ -0,0 +1,56 @@
+package tables
+
+import "time"
+
+// Statuses of a participant help request
+const (
+	HelpRequestOpen     = "open"
+	HelpRequestClaimed  = "claimed"
+	HelpRequestResolved = "resolved"
+)
+
+// HelpRequest is a participant's request for proctor assistance during a delivery
+type HelpRequest struct {
+	ID              int        `db:"id" json:"id"`
+	DeliveryID      int        `db:"delivery_id" json:"delivery_id"`
+	TakerID         int        `db:"taker_id" json:"taker_id"`
+	TakerName       *string    `db:"taker_name" json:"taker_name,omitempty"`
+	ClientRequestID int        `db:"client_request_id" json:"client_request_id"`
+	ClientID        *string    `db:"client_id" json:"client_id"`
+	Message         *string    `db:"message" json:"message"`
+	Status          string     `db:"status" json:"status"`
+	RequestedAt     time.Time  `db:"requested_at" json:"requested_at"`
+	ClaimedBy       *int       `db:"claimed_by" json:"claimed_by"`
+	ClaimedByName   *string    `db:"claimed_by_name" json:"claimed_by_name,omitempty"`
+	ClaimedAt       *time.Time `db:"claimed_at" json:"claimed_at"`
+	ResolvedBy      *int       `db:"resolved_by" json:"resolved_by"`
+	ResolvedAt      *time.Time `db:"resolved_at" json:"resolved_at"`
+	Resolution      *string    `db:"resolution" json:"resolution"`
+	ExtraMinutes    int        `db:"extra_minutes" json:"extra_minutes"`
+	// WaitSeconds is the time from the request until a proctor claimed it (or until now)
+	WaitSeconds int `db:"wait_seconds" json:"wait_seconds"`
+	// TimeLostSeconds is the time from the request until it was resolved (or until now)
+	TimeLostSeconds int `db:"time_lost_seconds" json:"time_lost_seconds"`
+	Timestamps
+}
+
+// HelpRequestEvent is a help request raised on an exam-client
+type HelpRequestEvent struct {
+	DeliveryID      int
+	TakerID         int
+	ClientRequestID int
+	ClientID        string
+	Message         string
+	RequestedAt     time.Time
+}
+
+type ResolveHelpRequestRequest struct {
+	Resolution   *string `json:"resolution,omitempty" maxLength:"1000"`
+	ExtraMinutes int     `json:"extra_minutes,omitempty" minimum:"0" maximum:"120" doc:"Extra time granted to the participant for the time lost; sent as a time extension"`
+}
+
+// HelpRequestStatusUpdate tells the exam-client that a proctor claimed or resolved a help request
+type HelpRequestStatusUpdate struct {
+	Status string `json:"status"`
+	By     string `json:"by"`
+}
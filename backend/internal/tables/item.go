@@ -1,5 +1,7 @@
 package tables
 
+import "time"
+
 type Item struct {
 	ID         int     `db:"id" json:"id"`
 	Title      string  `db:"title" json:"title"`
@@ -10,6 +12,7 @@ type Item struct {
 	Score      int     `db:"score" json:"score"`
 	ClientID   *int    `db:"client_id" json:"client_id"`
 	Timestamps
+	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
 }
 
 type ItemCreateRequest struct {
@@ -0,0 +1,48 @@
+package tables
+
+import "time"
+
+// Login scopes failures are counted in. Staff and participant logins are counted per
+// account, test-code logins per IP address since test codes are what is being guessed.
+const (
+	LoginScopeUser        = "user"
+	LoginScopeParticipant = "participant"
+	LoginScopeTestCode    = "test-code"
+)
+
+// Kinds of security alerts raised by suspicious login patterns
+const (
+	// One IP address failed logins for many different accounts or test codes
+	SecurityAlertManyIdentifiers = "many-identifiers"
+	// One account failed logins from many different IP addresses
+	SecurityAlertManyAddresses = "many-addresses"
+	// An account or IP address was locked out
+	SecurityAlertLockout = "lockout"
+)
+
+// LoginThrottle is the failure counter of an account, or of an IP address for test-code logins
+type LoginThrottle struct {
+	ID            int        `db:"id" json:"id"`
+	Scope         string     `db:"scope" json:"scope"`
+	Identifier    string     `db:"identifier" json:"identifier"`
+	Failures      int        `db:"failures" json:"failures"`
+	Lockouts      int        `db:"lockouts" json:"lockouts"`
+	LastFailureAt *time.Time `db:"last_failure_at" json:"last_failure_at"`
+	LastIP        *string    `db:"last_ip" json:"last_ip"`
+	NextAttemptAt *time.Time `db:"next_attempt_at" json:"next_attempt_at"`
+	LockedUntil   *time.Time `db:"locked_until" json:"locked_until"`
+	Timestamps
+}
+
+// SecurityAlert is raised by a suspicious login pattern
+type SecurityAlert struct {
+	ID             int        `db:"id" json:"id"`
+	Kind           string     `db:"kind" json:"kind"`
+	Scope          string     `db:"scope" json:"scope"`
+	Identifier     *string    `db:"identifier" json:"identifier"`
+	IPAddress      *string    `db:"ip_address" json:"ip_address"`
+	Details        string     `db:"details" json:"details"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	AcknowledgedAt *time.Time `db:"acknowledged_at" json:"acknowledged_at"`
+	AcknowledgedBy *int       `db:"acknowledged_by" json:"acknowledged_by"`
+}
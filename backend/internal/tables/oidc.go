@@ -0,0 +1,25 @@
+package tables
+
+import "time"
+
+// OIDCLoginState is a login sent to the identity provider, waiting for its callback
+type OIDCLoginState struct {
+	State        string     `db:"state"`
+	Nonce        string     `db:"nonce"`
+	CodeVerifier string     `db:"code_verifier"`
+	ExpiresAt    time.Time  `db:"expires_at"`
+	CreatedAt    *time.Time `db:"created_at"`
+}
+
+// OIDCStatus tells the login page whether to offer single sign-on
+type OIDCStatus struct {
+	Enabled bool `json:"enabled"`
+	// Name to show on the single sign-on button
+	ProviderName string `json:"provider_name,omitempty"`
+	// Path that starts single sign-on
+	LoginURL string `json:"login_url,omitempty"`
+}
+
+type OIDCExchangeRequest struct {
+	Code string `json:"code" required:"true" minLength:"1" maxLength:"255" doc:"Code the frontend received after single sign-on"`
+}
@@ -1,5 +1,7 @@
 package tables
 
+import "time"
+
 type Participant struct {
 	ID         int     `db:"id" json:"id"`
 	Name       string  `db:"name" json:"name"`
@@ -8,14 +10,17 @@ type Participant struct {
 	Password   *string `db:"password" json:"-"`
 	IsVerified bool    `db:"is_verified" json:"is_verified"`
 	ClientID   *int    `db:"client_id" json:"client_id"`
+	// Set when the participant must change the password at their next login
+	MustChangePassword bool `db:"must_change_password" json:"must_change_password"`
 	Timestamps
+	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
 }
 
 type ParticipantCreateRequest struct {
 	Name     string  `json:"name" required:"true" minLength:"1" maxLength:"255"`
 	Reg      *string `json:"reg,omitempty" maxLength:"255"`
 	Email    *string `json:"email,omitempty" format:"email" maxLength:"255"`
-	Password *string `json:"password,omitempty" minLength:"6" maxLength:"255"`
+	Password *string `json:"password,omitempty" maxLength:"255" doc:"Must meet the password policy"`
 	GroupIDs []int   `json:"group_ids,omitempty"`
 }
 
@@ -0,0 +1,61 @@
+package tables
+
+import "time"
+
+// Accounts that have passwords
+const (
+	PasswordAccountUser        = "user"
+	PasswordAccountParticipant = "participant"
+)
+
+// PasswordResetToken is a single-use token to set a new password with
+type PasswordResetToken struct {
+	ID          int        `db:"id" json:"id"`
+	AccountType string     `db:"account_type" json:"account_type"`
+	AccountID   int        `db:"account_id" json:"account_id"`
+	TokenHash   string     `db:"token_hash" json:"-"`
+	ExpiresAt   time.Time  `db:"expires_at" json:"expires_at"`
+	UsedAt      *time.Time `db:"used_at" json:"used_at"`
+	CreatedBy   *int       `db:"created_by" json:"created_by"`
+	CreatedAt   *time.Time `db:"created_at" json:"created_at"`
+}
+
+// PasswordPolicyInfo describes the requirements new passwords must meet
+type PasswordPolicyInfo struct {
+	MinLength int `json:"min_length"`
+	// Character classes (lowercase, uppercase, digits, symbols) a password must mix
+	MinClasses int `json:"min_classes"`
+	// Previous passwords that may not be used again
+	History int `json:"history"`
+	// Whether passwords are checked against a list of breached passwords
+	BreachedListChecked bool `json:"breached_list_checked"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email" required:"true" format:"email" maxLength:"255"`
+}
+
+type PasswordResetConfirmRequest struct {
+	Token           string `json:"token" required:"true" minLength:"1" maxLength:"255"`
+	NewPassword     string `json:"new_password" required:"true" maxLength:"255"`
+	ConfirmPassword string `json:"confirm_password" required:"true" maxLength:"255"`
+}
+
+type ParticipantChangePasswordRequest struct {
+	RegistrationNumber string `json:"registration_number" required:"true" minLength:"1" maxLength:"255"`
+	CurrentPassword    string `json:"current_password" required:"true" maxLength:"255"`
+	NewPassword        string `json:"new_password" required:"true" maxLength:"255"`
+	ConfirmPassword    string `json:"confirm_password" required:"true" maxLength:"255"`
+}
+
+type PasswordChangeRequiredRequest struct {
+	Required bool `json:"required" doc:"Whether the password must be changed at the next login"`
+}
+
+// AdminPasswordReset is the outcome of a password reset started by an administrator. The
+// reset link is only returned when the account has no email address to send it to.
+type AdminPasswordReset struct {
+	Emailed   bool      `json:"emailed"`
+	ResetURL  string    `json:"reset_url,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,108 @@
+package tables
+
+// Permissions checked by the API. Operations declare the permission they require, and users
+// get permissions through their roles or as direct grants.
+const (
+	PermissionUserManage        = "user:manage"
+	PermissionRoleManage        = "role:manage"
+	PermissionGroupManage       = "group:manage"
+	PermissionParticipantManage = "participant:manage"
+	PermissionExamCreate        = "exam:create"
+	PermissionExamUpdate        = "exam:update"
+	PermissionExamDelete        = "exam:delete"
+	PermissionCategoryManage    = "category:manage"
+	PermissionItemManage        = "item:manage"
+	PermissionDeliveryCreate    = "delivery:create"
+	PermissionDeliveryUpdate    = "delivery:update"
+	PermissionDeliveryDelete    = "delivery:delete"
+	PermissionDeliveryControl   = "delivery:control"
+	PermissionDeliveryAssign    = "delivery:assign"
+	PermissionDeliveryNetwork   = "delivery:network"
+	PermissionDeliveryAssigned  = "delivery:assigned"
+	PermissionAttemptScore      = "attempt:score"
+	PermissionResultRead        = "result:read"
+	PermissionExamClientManage  = "exam-client:manage"
+	PermissionSecurityManage    = "security:manage"
+	PermissionClientManage      = "client:manage"
+	PermissionAuditView         = "audit:view"
+)
+
+// AdministratorRole is the role holding every permission, including new ones
+const AdministratorRole = "administrator"
+
+// PermissionCatalog lists every permission known to the API. It is synced to the permissions
+// table at startup.
+var PermissionCatalog = []Permission{
+	{Name: PermissionUserManage, DisplayName: "Manage users", Description: "Create, update and delete any user, and change their passwords"},
+	{Name: PermissionRoleManage, DisplayName: "Manage roles", Description: "Manage roles, their permissions and the roles and permissions of users"},
+	{Name: PermissionGroupManage, DisplayName: "Manage groups", Description: "Create, update and delete groups and their participants"},
+	{Name: PermissionParticipantManage, DisplayName: "Manage participants", Description: "Create, update, delete and verify participants"},
+	{Name: PermissionExamCreate, DisplayName: "Create exams", Description: "Create exams"},
+	{Name: PermissionExamUpdate, DisplayName: "Update exams", Description: "Update exams and their question sets"},
+	{Name: PermissionExamDelete, DisplayName: "Delete exams", Description: "Delete exams"},
+	{Name: PermissionCategoryManage, DisplayName: "Manage categories", Description: "Create, update and delete categories and their questions"},
+	{Name: PermissionItemManage, DisplayName: "Manage question sets", Description: "Create, update and delete question sets"},
+	{Name: PermissionDeliveryCreate, DisplayName: "Create deliveries", Description: "Schedule deliveries"},
+	{Name: PermissionDeliveryUpdate, DisplayName: "Update deliveries", Description: "Update deliveries"},
+	{Name: PermissionDeliveryDelete, DisplayName: "Delete deliveries", Description: "Delete deliveries"},
+	{Name: PermissionDeliveryControl, DisplayName: "Control deliveries", Description: "Start and finish deliveries, and act as committee of every delivery"},
+	{Name: PermissionDeliveryAssign, DisplayName: "Assign deliveries", Description: "Assign the committee and scorers of deliveries"},
+	{Name: PermissionDeliveryNetwork, DisplayName: "Set delivery networks", Description: "Set the networks participants may take a delivery from"},
+	{Name: PermissionDeliveryAssigned, DisplayName: "View assigned deliveries", Description: "View the deliveries assigned to the user as committee or scorer"},
+	{Name: PermissionAttemptScore, DisplayName: "Score attempts", Description: "Update the score of attempts"},
+	{Name: PermissionResultRead, DisplayName: "View results", Description: "View the results of deliveries"},
+	{Name: PermissionExamClientManage, DisplayName: "Manage exam-clients", Description: "List exam-clients and revoke their credentials"},
+	{Name: PermissionSecurityManage, DisplayName: "Manage login security", Description: "View and clear login lockouts, and view and acknowledge security alerts"},
+	{Name: PermissionClientManage, DisplayName: "Manage clients", Description: "Create clients, change their settings and users, and switch to any client"},
+	{Name: PermissionAuditView, DisplayName: "View audit log", Description: "View who created, changed and deleted records, and what they changed"},
+}
+
+// IsKnownPermission reports whether name is in the permission catalog
+func IsKnownPermission(name string) bool {
+	for _, permission := range PermissionCatalog {
+		if permission.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+type RoleWithPermissions struct {
+	Role
+	Permissions []string `json:"permissions"`
+}
+
+type RoleCreateRequest struct {
+	Name        string   `json:"name" required:"true" minLength:"3" maxLength:"255" pattern:"^[a-z0-9_-]+$" doc:"Unique role name"`
+	DisplayName string   `json:"display_name" maxLength:"255"`
+	Description string   `json:"description" maxLength:"255"`
+	Permissions []string `json:"permissions,omitempty" doc:"Names of the permissions granted to the role"`
+
+	TwoFactorRequired bool `json:"two_factor_required,omitempty" doc:"Whether users with the role must use two-factor authentication"`
+	MaxSessions       *int `json:"max_sessions,omitempty" minimum:"0" maximum:"100" doc:"Sessions users with the role may have at the same time (0 is unlimited, omitted uses the default)"`
+}
+
+type RoleUpdateRequest struct {
+	DisplayName *string `json:"display_name,omitempty" maxLength:"255"`
+	Description *string `json:"description,omitempty" maxLength:"255"`
+
+	TwoFactorRequired  *bool `json:"two_factor_required,omitempty" doc:"Whether users with the role must use two-factor authentication"`
+	MaxSessions        *int  `json:"max_sessions,omitempty" minimum:"0" maximum:"100" doc:"Sessions users with the role may have at the same time (0 is unlimited)"`
+	DefaultMaxSessions bool  `json:"default_max_sessions,omitempty" doc:"Go back to the default session limit"`
+}
+
+type SetPermissionsRequest struct {
+	Permissions []string `json:"permissions" required:"true" doc:"Names of the permissions, replacing the current ones"`
+}
+
+type SetUserRolesRequest struct {
+	RoleIDs []int `json:"role_ids" required:"true" doc:"IDs of the roles, replacing the current ones"`
+}
+
+// UserAccess is how a user got their effective permissions
+type UserAccess struct {
+	UserID            int      `json:"user_id"`
+	Roles             []Role   `json:"roles"`
+	DirectPermissions []string `json:"direct_permissions"`
+	Permissions       []string `json:"permissions" doc:"Effective permissions, from roles and direct grants"`
+}
@@ -0,0 +1,50 @@
+package tables
+
+import "time"
+
+// Kinds of proctor messages sent to participants
+const (
+	ProctorMessageAnnouncement  = "announcement"
+	ProctorMessagePause         = "pause"
+	ProctorMessageResume        = "resume"
+	ProctorMessageTimeExtension = "time_extension"
+	ProctorMessageLock          = "lock"
+	ProctorMessageUnlock        = "unlock"
+)
+
+// ProctorMessageRequest is a message from a proctor to the participants of a delivery
+type ProctorMessageRequest struct {
+	Kind           string `json:"kind" enum:"announcement,pause,resume,time_extension,lock,unlock" doc:"Announcements are only displayed; the other kinds also pause, extend or lock the exam"`
+	Message        string `json:"message,omitempty" maxLength:"2000" doc:"Text shown to the participant (required for announcements)"`
+	Minutes        int    `json:"minutes,omitempty" minimum:"0" maximum:"600" doc:"Minutes added by a time extension"`
+	ParticipantIDs []int  `json:"participant_ids,omitempty" doc:"Recipients; empty sends the message to every participant"`
+}
+
+// ProctorMessageDispatch is a proctor message forwarded by the coordinator to the exam-client
+type ProctorMessageDispatch struct {
+	ProctorMessageRequest
+	SentBy string `json:"sent_by"`
+}
+
+// ProctorMessage is a sent proctor message with its delivery status
+type ProctorMessage struct {
+	ID           int                     `json:"id"`
+	Kind         string                  `json:"kind"`
+	Message      string                  `json:"message"`
+	Minutes      int                     `json:"minutes"`
+	Broadcast    bool                    `json:"broadcast"`
+	SentBy       string                  `json:"sent_by"`
+	CreatedAt    time.Time               `json:"created_at"`
+	Recipients   int                     `json:"recipients"`
+	Delivered    int                     `json:"delivered"`
+	Acknowledged int                     `json:"acknowledged"`
+	Receipts     []ProctorMessageReceipt `json:"receipts,omitempty"`
+}
+
+// ProctorMessageReceipt tracks one recipient of a proctor message. DeliveredAt is set when the
+// message was pushed over the participant's channel, AcknowledgedAt when the exam UI confirmed it.
+type ProctorMessageReceipt struct {
+	ParticipantID  int        `json:"participant_id"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at"`
+}
@@ -0,0 +1,108 @@
+package tables
+
+import "time"
+
+// Kinds of attempt_question_history entries
+const (
+	AnswerEventVisit  = "visit"
+	AnswerEventAnswer = "answer"
+	AnswerEventChange = "change"
+	AnswerEventClear  = "clear"
+)
+
+// Sources of attempt_question_history entries: answers saved through the coordinator API,
+// or imported from the final results of an exam-client
+const (
+	AnswerSourceCoordinator = "coordinator"
+	AnswerSourceExamClient  = "exam_client"
+)
+
+// ItemResponseTime is the time a candidate spent on one question, used for response-time analysis
+type ItemResponseTime struct {
+	AttemptID     int    `db:"attempt_id" json:"attempt_id"`
+	TakerName     string `db:"taker_name" json:"taker_name"`
+	TakerCode     string `db:"taker_code" json:"taker_code"`
+	QuestionID    int    `db:"question_id" json:"question_id"`
+	Answered      bool   `db:"answered" json:"answered"`
+	IsCorrect     *bool  `db:"is_correct" json:"is_correct"`
+	TimeSpent     int    `db:"time_spent" json:"time_spent"`
+	Visits        int    `db:"visits" json:"visits"`
+	AnswerChanges int    `db:"answer_changes" json:"answer_changes"`
+}
+
+// ItemTimingStats summarizes the response times of one question
+type ItemTimingStats struct {
+	QuestionID    int     `json:"question_id"`
+	Responses     int     `json:"responses"`
+	MedianTime    float64 `json:"median_time"`
+	LowerQuartile float64 `json:"lower_quartile"`
+	UpperQuartile float64 `json:"upper_quartile"`
+	MeanTime      float64 `json:"mean_time"`
+	AverageVisits float64 `json:"average_visits"`
+	AnswerChanges int     `json:"answer_changes"`
+	// RapidThreshold is the time (seconds) below which an answer counts as a rapid guess
+	RapidThreshold float64 `json:"rapid_threshold"`
+	RapidGuesses   int     `json:"rapid_guesses"`
+	RapidGuessRate float64 `json:"rapid_guess_rate"`
+	// RapidGuessAccuracy is the share of rapid guesses that were correct; near chance level confirms guessing
+	RapidGuessAccuracy *float64 `json:"rapid_guess_accuracy"`
+}
+
+// CandidateTimingStats summarizes the response times of one attempt
+type CandidateTimingStats struct {
+	AttemptID     int     `json:"attempt_id"`
+	TakerName     string  `json:"taker_name"`
+	TakerCode     string  `json:"taker_code"`
+	ItemsAnswered int     `json:"items_answered"`
+	TotalTime     int     `json:"total_time"`
+	MedianTime    float64 `json:"median_time"`
+	RapidGuesses  int     `json:"rapid_guesses"`
+	AnswerChanges int     `json:"answer_changes"`
+	// ResponseTimeEffort is the share of answers that were not rapid guesses
+	ResponseTimeEffort  float64 `json:"response_time_effort"`
+	RapidGuessQuestions []int   `json:"rapid_guess_questions"`
+	Flagged             bool    `json:"flagged"`
+}
+
+// ResponseTimeReport is the result of a response-time analysis over one delivery
+type ResponseTimeReport struct {
+	DeliveryID       int                    `json:"delivery_id"`
+	ThresholdPercent float64                `json:"threshold_percent"`
+	MaxThreshold     float64                `json:"max_threshold"`
+	MinEffort        float64                `json:"min_effort"`
+	Items            []ItemTimingStats      `json:"items"`
+	Candidates       []CandidateTimingStats `json:"candidates"`
+	GeneratedAt      time.Time              `json:"generated_at"`
+}
+
+// ResponseTimeAnalysisRequest holds the tuning parameters of a response-time analysis
+type ResponseTimeAnalysisRequest struct {
+	ThresholdPercent float64 `query:"threshold_percent" default:"10" minimum:"1" maximum:"100" doc:"Rapid-guess threshold as a percentage of the item's median time (normative threshold)"`
+	MaxThreshold     float64 `query:"max_threshold" default:"10" minimum:"1" doc:"Upper bound in seconds for the rapid-guess threshold"`
+	MinEffort        float64 `query:"min_effort" default:"0.9" minimum:"0" maximum:"1" doc:"Candidates with a response-time effort below this value are flagged"`
+}
+
+// PacingPoint is one step of a candidate's pacing curve
+type PacingPoint struct {
+	Sequence   int       `json:"sequence"`
+	QuestionID int       `json:"question_id"`
+	Kind       string    `json:"kind"`
+	TimeSpent  int       `json:"time_spent"`
+	At         time.Time `json:"at"`
+	// Elapsed is the number of seconds since the attempt started
+	Elapsed int `json:"elapsed"`
+	// ItemsAnswered is the number of questions holding an answer after this step
+	ItemsAnswered int `json:"items_answered"`
+	// ExpectedAnswered is the number of questions a candidate working at an even pace would have answered
+	ExpectedAnswered float64 `json:"expected_answered"`
+}
+
+// PacingCurve shows how a candidate progressed through an attempt over time
+type PacingCurve struct {
+	AttemptID      int           `json:"attempt_id"`
+	StartedAt      *time.Time    `json:"started_at"`
+	EndedAt        *time.Time    `json:"ended_at"`
+	Duration       int           `json:"duration"`
+	TotalQuestions int           `json:"total_questions"`
+	Points         []PacingPoint `json:"points"`
+}
@@ -1,12 +1,28 @@
 package tables
 
+import "time"
+
 type Session struct {
-	ID           string `db:"id" json:"id"`
-	UserID       *int64 `db:"user_id" json:"user_id"`
-	IPAddress    string `db:"ip_address" json:"ip_address"`
-	UserAgent    string `db:"user_agent" json:"user_agent"`
-	Payload      string `db:"payload" json:"-"`
-	LastActivity int    `db:"last_activity" json:"last_activity"`
+	ID           string     `db:"id" json:"id"`
+	UserID       *int64     `db:"user_id" json:"user_id"`
+	IPAddress    string     `db:"ip_address" json:"ip_address"`
+	UserAgent    string     `db:"user_agent" json:"user_agent"`
+	Payload      string     `db:"payload" json:"-"`
+	LastActivity int        `db:"last_activity" json:"last_activity"`
+	CreatedAt    *time.Time `db:"created_at" json:"created_at"`
+}
+
+// SessionInfo describes a signed-in session without its secret ID. ID is derived from the
+// session ID and is what sessions are revoked by.
+type SessionInfo struct {
+	ID           string     `json:"id"`
+	Device       string     `json:"device"`
+	UserAgent    string     `json:"user_agent"`
+	IPAddress    string     `json:"ip_address"`
+	CreatedAt    *time.Time `json:"created_at"`
+	LastActivity time.Time  `json:"last_activity"`
+	// Set on the session the request was made with
+	Current bool `json:"current"`
 }
 
 type SessionData struct {
@@ -15,4 +31,36 @@ type SessionData struct {
 	Email    string `json:"email"`
 	Name     string `json:"name"`
 	Roles    []Role `json:"roles"`
+	// Effective permissions, from the roles and direct grants of the user
+	Permissions []string `json:"permissions"`
+	// Set once a two-factor code was verified in the session
+	TwoFactorVerified bool `json:"two_factor_verified,omitempty"`
+	// Failed two-factor codes entered in the session
+	TwoFactorAttempts int `json:"two_factor_attempts,omitempty"`
+	// What the session still needs before it grants access (TwoFactorPendingVerify or
+	// TwoFactorPendingEnroll), worked out on every request
+	TwoFactorPending string `json:"two_factor_pending,omitempty"`
+	// Set while the user must change their password, worked out on every request
+	PasswordChangeRequired bool `json:"password_change_required,omitempty"`
+	// Client whose data the session works with, checked on every request. 0 when the user
+	// works for no client.
+	ClientID int `json:"client_id,omitempty"`
+}
+
+// Two-factor steps a signed-in session can be waiting for
+const (
+	// The user has two-factor authentication and has not entered a code yet
+	TwoFactorPendingVerify = "verify"
+	// A role of the user requires two-factor authentication, which they have not set up
+	TwoFactorPendingEnroll = "enroll"
+)
+
+// HasPermission reports whether the session grants permission
+func (s *SessionData) HasPermission(permission string) bool {
+	for _, granted := range s.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
 }
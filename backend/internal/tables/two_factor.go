@@ -0,0 +1,23 @@
+package tables
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" required:"true" minLength:"6" maxLength:"32" doc:"Code from the authenticator app, or a recovery code" example:"123456"`
+}
+
+type TwoFactorSetup struct {
+	Secret     string `json:"secret" doc:"Base32 secret, for authenticators that cannot scan the URI"`
+	OTPAuthURI string `json:"otpauth_uri" doc:"otpauth URI to show as a QR code"`
+}
+
+type TwoFactorStatus struct {
+	Enabled           bool   `json:"enabled"`
+	Required          bool   `json:"required" doc:"Whether a role of the user requires two-factor authentication"`
+	Pending           string `json:"pending,omitempty" enum:"verify,enroll" doc:"What the session still needs before it grants access"`
+	RecoveryCodesLeft int    `json:"recovery_codes_left"`
+}
+
+type RecoveryCodesResponse struct {
+	Success       bool     `json:"success"`
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recovery_codes" doc:"Single-use codes to sign in without the authenticator. They are only shown once."`
+}
@@ -14,12 +14,15 @@ type User struct {
 	Password               string     `db:"password" json:"-"`
 	TwoFactorSecret        *string    `db:"two_factor_secret" json:"-"`
 	TwoFactorRecoveryCodes *string    `db:"two_factor_recovery_codes" json:"-"`
+	TwoFactorConfirmedAt   *time.Time `db:"two_factor_confirmed_at" json:"two_factor_confirmed_at,omitempty"`
 	Gender                 Gender     `db:"gender" json:"gender"`
 	ProfilePhotoPath       *string    `db:"profile_photo_path" json:"profile_photo_path"`
 	Birthplace             *string    `db:"birthplace" json:"birthplace"`
 	Birthday               *time.Time `db:"birthday" json:"birthday"`
 	RememberToken          *string    `db:"remember_token" json:"-"`
 	LastLogin              *time.Time `db:"last_login" json:"last_login"`
+	MustChangePassword     bool       `db:"must_change_password" json:"must_change_password"`
+	PasswordChangedAt      *time.Time `db:"password_changed_at" json:"password_changed_at,omitempty"`
 	Timestamps
 	SoftDelete
 }
@@ -29,6 +32,10 @@ type Role struct {
 	Name        string `db:"name" json:"name"`
 	DisplayName string `db:"display_name" json:"display_name"`
 	Description string `db:"description" json:"description"`
+	// Users with the role must use two-factor authentication
+	TwoFactorRequired bool `db:"two_factor_required" json:"two_factor_required"`
+	// Sessions users with the role may have at the same time; nil uses the default, 0 is unlimited
+	MaxSessions *int `db:"max_sessions" json:"max_sessions"`
 	Timestamps
 }
 
@@ -65,17 +72,24 @@ type LoginResponse struct {
 	Message   string `json:"message"`
 	User      *User  `json:"user,omitempty"`
 	SessionID string `json:"session_id,omitempty"`
+	// Set when the session is limited until a two-factor code is verified ("verify") or
+	// two-factor authentication is set up ("enroll")
+	TwoFactorPending string `json:"two_factor_pending,omitempty" enum:"verify,enroll"`
+	// Set when the session is limited until the user changes their password
+	PasswordChangeRequired bool `json:"password_change_required,omitempty"`
 }
 
 type UserCreateRequest struct {
 	Name             string  `json:"name" required:"true" minLength:"3" maxLength:"255"`
 	Username         string  `json:"username" required:"true" minLength:"3" maxLength:"255"`
 	Email            string  `json:"email" required:"true" format:"email" maxLength:"255"`
-	Password         string  `json:"password" required:"true" minLength:"6" maxLength:"255"`
+	Password         string  `json:"password" required:"true" maxLength:"255" doc:"Must meet the password policy"`
 	Gender           Gender  `json:"gender" enum:"male,female,other" default:"other"`
 	Birthplace       *string `json:"birthplace,omitempty" maxLength:"255"`
 	Birthday         *string `json:"birthday,omitempty" format:"date"`
 	ProfilePhotoPath *string `json:"profile_photo_path,omitempty"`
+
+	MustChangePassword bool `json:"must_change_password,omitempty" doc:"Whether the user must change the password at their first login"`
 }
 
 type UserUpdateRequest struct {
@@ -89,6 +103,6 @@ type UserUpdateRequest struct {
 
 type ChangePasswordRequest struct {
 	CurrentPassword string `json:"current_password" required:"true"`
-	NewPassword     string `json:"new_password" required:"true" minLength:"6" maxLength:"255"`
-	ConfirmPassword string `json:"confirm_password" required:"true" minLength:"6" maxLength:"255"`
+	NewPassword     string `json:"new_password" required:"true" maxLength:"255" doc:"Must meet the password policy"`
+	ConfirmPassword string `json:"confirm_password" required:"true" maxLength:"255"`
 }
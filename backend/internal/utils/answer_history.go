@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// AnswerEventKind classifies a visit of a question by how it changed the answer.
+// A nil answer means the question was visited without answering.
+func AnswerEventKind(previous, answer *string) string {
+	prev := ""
+	if previous != nil {
+		prev = strings.TrimSpace(*previous)
+	}
+	if answer == nil {
+		return tables.AnswerEventVisit
+	}
+	next := strings.TrimSpace(*answer)
+
+	switch {
+	case next == prev:
+		return tables.AnswerEventVisit
+	case next == "":
+		return tables.AnswerEventClear
+	case prev == "":
+		return tables.AnswerEventAnswer
+	default:
+		return tables.AnswerEventChange
+	}
+}
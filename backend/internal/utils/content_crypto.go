@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// DeliveryKeySize is the size of a delivery key (AES-256)
+const DeliveryKeySize = 32
+
+// GenerateDeliveryKey returns a random key for the exam content and answers of a delivery
+func GenerateDeliveryKey() ([]byte, error) {
+	key := make([]byte, DeliveryKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate delivery key: %w", err)
+	}
+	return key, nil
+}
+
+// Seal encrypts plaintext with AES-256-GCM and returns the nonce and ciphertext, base64
+// encoded. The additional data is authenticated but not encrypted, and must be given again to Open.
+func Seal(key, plaintext, additionalData []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, additionalData)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value sealed with Seal
+func Open(key []byte, sealed string, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sealed value: %w", err)
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid sealed value: too short")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt sealed value: %w", err)
+	}
+	return plaintext, nil
+}
+
+// WrapDeliveryKey encrypts a delivery key for the exam-client holding secret, so only that
+// client can use it
+func WrapDeliveryKey(secret string, deliveryID int, key []byte) (string, error) {
+	return Seal(keyWrappingKey(secret), key, DeliveryAD(deliveryID, "key"))
+}
+
+// UnwrapDeliveryKey decrypts a delivery key wrapped with WrapDeliveryKey
+func UnwrapDeliveryKey(secret string, deliveryID int, wrapped string) ([]byte, error) {
+	key, err := Open(keyWrappingKey(secret), wrapped, DeliveryAD(deliveryID, "key"))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != DeliveryKeySize {
+		return nil, fmt.Errorf("invalid delivery key size")
+	}
+	return key, nil
+}
+
+// WipeKey overwrites a key in memory
+func WipeKey(key []byte) {
+	for i := range key {
+		key[i] = 0
+	}
+}
+
+// keyWrappingKey derives the key that wraps delivery keys from an exam-client secret, so the
+// secret itself is only used to sign requests
+func keyWrappingKey(secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("medxamion delivery key wrapping"))
+	return mac.Sum(nil)
+}
+
+// DeliveryAD is the additional data binding a sealed value to a delivery and its purpose
+// (e.g. "content" or "results"), so it cannot be swapped for another one
+func DeliveryAD(deliveryID int, purpose string) []byte {
+	return []byte(fmt.Sprintf("delivery:%d:%s", deliveryID, purpose))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != DeliveryKeySize {
+		return nil, fmt.Errorf("invalid key size %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return gcm, nil
+}
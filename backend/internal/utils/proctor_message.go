@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/medxamion/medxamion/internal/tables"
+)
+
+// ValidateProctorMessage checks that a proctor message carries what its kind needs
+func ValidateProctorMessage(req *tables.ProctorMessageRequest) error {
+	switch req.Kind {
+	case tables.ProctorMessageAnnouncement:
+		if strings.TrimSpace(req.Message) == "" {
+			return fmt.Errorf("announcement message is required")
+		}
+	case tables.ProctorMessageTimeExtension:
+		if req.Minutes <= 0 {
+			return fmt.Errorf("time extension minutes must be positive")
+		}
+	case tables.ProctorMessagePause, tables.ProctorMessageResume, tables.ProctorMessageLock, tables.ProctorMessageUnlock:
+	default:
+		return fmt.Errorf("unknown message kind %q", req.Kind)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// TakerCodeAlphabet are the characters of taker and access codes. It leaves out 0/O, 1/I/L
+// and U/V, which are easily mistaken for each other when read out or copied from paper.
+const TakerCodeAlphabet = "23456789ABCDEFGHJKMNPQRSTWXYZ"
+
+// Lengths of the random part of taker codes, and of delivery access codes
+const (
+	TakerCodeMinLength  = 6
+	TakerCodeMaxLength  = 16
+	AccessCodeLength    = 6
+	takerCodeSeparators = "- "
+)
+
+// GenerateTakerCode returns a random taker code: the prefix, length random characters and a
+// check character
+func GenerateTakerCode(prefix string, length int) (string, error) {
+	if length < TakerCodeMinLength || length > TakerCodeMaxLength {
+		return "", fmt.Errorf("taker code length must be between %d and %d", TakerCodeMinLength, TakerCodeMaxLength)
+	}
+	if !IsTakerCodeText(prefix) {
+		return "", fmt.Errorf("taker code prefix may only contain %s", TakerCodeAlphabet)
+	}
+
+	body, err := randomCodeChars(length)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate taker code: %w", err)
+	}
+	code := prefix + body
+	return code + string(takerCodeCheckChar(code)), nil
+}
+
+// GenerateAccessCode returns a random delivery access code. Access codes are announced in
+// the room rather than typed from paper, so they have no check character.
+func GenerateAccessCode() (string, error) {
+	code, err := randomCodeChars(AccessCodeLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate access code: %w", err)
+	}
+	return code, nil
+}
+
+// NormalizeTakerCode uppercases a code as typed and removes the separators it is printed with
+func NormalizeTakerCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(takerCodeSeparators, r) {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(code)))
+}
+
+// ValidTakerCode reports whether a normalized taker code has a valid check character, which
+// catches typos and guessed codes without a database lookup
+func ValidTakerCode(code string) bool {
+	if len(code) < TakerCodeMinLength+1 || !IsTakerCodeText(code) {
+		return false
+	}
+	body, check := code[:len(code)-1], code[len(code)-1]
+	return takerCodeCheckChar(body) == check
+}
+
+// FormatTakerCode splits a normalized code into groups of groupSize characters for printing.
+// A groupSize of 0 leaves it as it is.
+func FormatTakerCode(code string, groupSize int) string {
+	if groupSize <= 0 || len(code) <= groupSize {
+		return code
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(code); i += groupSize {
+		if i > 0 {
+			b.WriteByte('-')
+		}
+		b.WriteString(code[i:min(i+groupSize, len(code))])
+	}
+	return b.String()
+}
+
+// EqualCodes compares two normalized codes in constant time
+func EqualCodes(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// IsTakerCodeText reports whether text only contains characters of the code alphabet
+func IsTakerCodeText(text string) bool {
+	for _, r := range text {
+		if !strings.ContainsRune(TakerCodeAlphabet, r) {
+			return false
+		}
+	}
+	return true
+}
+
+func randomCodeChars(n int) (string, error) {
+	max := big.NewInt(int64(len(TakerCodeAlphabet)))
+	chars := make([]byte, n)
+	for i := range chars {
+		index, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		chars[i] = TakerCodeAlphabet[index.Int64()]
+	}
+	return string(chars), nil
+}
+
+// takerCodeCheckChar computes the Luhn mod N check character of a code over the code
+// alphabet, which detects any single mistyped character and most swapped neighbours
+func takerCodeCheckChar(code string) byte {
+	n := len(TakerCodeAlphabet)
+	factor := 2
+	sum := 0
+	for i := len(code) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(TakerCodeAlphabet, code[i])
+		if factor == 2 {
+			factor = 1
+		} else {
+			factor = 2
+		}
+		sum += addend/n + addend%n
+	}
+	return TakerCodeAlphabet[(n-sum%n)%n]
+}
@@ -0,0 +1,63 @@
+package utils
+
+import "strings"
+
+// userAgentBrowsers and userAgentSystems map User-Agent tokens to names, checked in order
+// because most browsers also send the tokens of the browsers they descend from
+var (
+	userAgentBrowsers = []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	}
+	userAgentSystems = []struct{ token, name string }{
+		{"iPad", "iPad"},
+		{"iPhone", "iPhone"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// DescribeUserAgent returns a short description of the device a User-Agent header comes
+// from, such as "Chrome on Windows", for users to recognize their sessions by
+func DescribeUserAgent(userAgent string) string {
+	if strings.TrimSpace(userAgent) == "" || userAgent == "unknown" {
+		return "Unknown device"
+	}
+
+	browser := ""
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	system := ""
+	for _, s := range userAgentSystems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+
+	// Other clients, such as scripts, usually start with their name and version
+	name, _, _ := strings.Cut(userAgent, " ")
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	return name
+}
@@ -0,0 +1,8 @@
+-- Migration to let candidates flag questions for review
+
+ALTER TABLE attempt_question
+ADD COLUMN IF NOT EXISTS flagged BOOLEAN NOT NULL DEFAULT false,
+ADD COLUMN IF NOT EXISTS flagged_at TIMESTAMP WITH TIME ZONE;
+
+-- Index for listing flagged questions of an attempt
+CREATE INDEX IF NOT EXISTS idx_attempt_question_flagged ON attempt_question(attempt_id) WHERE flagged;
@@ -0,0 +1,23 @@
+-- Migration for the audit log
+
+-- Every create, update and delete of exams, question sets, categories, groups,
+-- participants, deliveries, users, roles and clients, with who made it and the changed
+-- fields before and after. The actor's name is copied so entries stay readable after the
+-- user is deleted. Entries older than AUDIT_RETENTION_DAYS are removed.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    client_id BIGINT,
+    actor_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    actor_name VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(64),
+    entity_type VARCHAR(32) NOT NULL,
+    entity_id BIGINT NOT NULL,
+    action VARCHAR(16) NOT NULL CHECK (action IN ('create', 'update', 'delete')),
+    changes JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log(entity_type, entity_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id ON audit_log(actor_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_client_id ON audit_log(client_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
@@ -0,0 +1,69 @@
+-- Migration for client (tenant) isolation
+
+-- Clients are the colleges or organisations sharing an install. Exams, items, categories,
+-- groups and participants belong to one client through their client_id; deliveries and
+-- attempts belong to the client of their exam. The table comes from the original schema;
+-- it is only created here for databases without it.
+CREATE TABLE IF NOT EXISTS clients (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Client settings: the default taker code format of new groups, and how the frontend
+-- presents the client
+ALTER TABLE clients ADD COLUMN IF NOT EXISTS taker_code_prefix VARCHAR(8) NOT NULL DEFAULT '';
+ALTER TABLE clients ADD COLUMN IF NOT EXISTS taker_code_length INTEGER NOT NULL DEFAULT 8 CHECK (taker_code_length BETWEEN 6 AND 16);
+ALTER TABLE clients ADD COLUMN IF NOT EXISTS taker_code_group_size INTEGER NOT NULL DEFAULT 4 CHECK (taker_code_group_size BETWEEN 0 AND 8);
+ALTER TABLE clients ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'Asia/Jakarta';
+ALTER TABLE clients ADD COLUMN IF NOT EXISTS logo_url VARCHAR(255);
+
+-- Every client referenced by existing data exists
+INSERT INTO clients (id, name)
+SELECT DISTINCT client_id, 'Client ' || client_id
+FROM (
+    SELECT client_id FROM exams
+    UNION SELECT client_id FROM items
+    UNION SELECT client_id FROM categories
+    UNION SELECT client_id FROM groups
+    UNION SELECT client_id FROM takers
+) referenced
+WHERE client_id IS NOT NULL
+ON CONFLICT (id) DO NOTHING;
+
+INSERT INTO clients (name)
+SELECT 'Default client'
+WHERE NOT EXISTS (SELECT 1 FROM clients);
+
+SELECT setval(pg_get_serial_sequence('clients', 'id'), (SELECT MAX(id) FROM clients));
+
+-- Items and participants created without a client belong to the first one
+UPDATE items SET client_id = (SELECT MIN(id) FROM clients) WHERE client_id IS NULL;
+UPDATE takers SET client_id = (SELECT MIN(id) FROM clients) WHERE client_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_exams_client_id ON exams(client_id);
+CREATE INDEX IF NOT EXISTS idx_items_client_id ON items(client_id);
+CREATE INDEX IF NOT EXISTS idx_categories_client_id ON categories(client_id);
+CREATE INDEX IF NOT EXISTS idx_groups_client_id ON groups(client_id);
+CREATE INDEX IF NOT EXISTS idx_takers_client_id ON takers(client_id);
+
+-- The clients a user works for. Staff see the data of one of them at a time, and users
+-- with client:manage can switch to any client.
+CREATE TABLE IF NOT EXISTS client_user (
+    client_id BIGINT NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (client_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_client_user_user_id ON client_user(user_id);
+
+-- Existing users keep seeing what they saw before: every client. Remove them from the
+-- clients they do not work for.
+INSERT INTO client_user (client_id, user_id)
+SELECT c.id, u.id
+FROM clients c
+CROSS JOIN users u
+WHERE u.deleted_at IS NULL
+ON CONFLICT DO NOTHING;
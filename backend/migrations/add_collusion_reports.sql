@@ -0,0 +1,14 @@
+-- Migration for stored collusion analyses
+
+-- The answer-similarity analysis run when a delivery closes. A delivery keeps only its
+-- latest report; it is replaced when the analysis runs again.
+CREATE TABLE IF NOT EXISTS collusion_reports (
+    delivery_id INTEGER PRIMARY KEY,
+    candidates INTEGER NOT NULL DEFAULT 0,
+    flagged_pairs INTEGER NOT NULL DEFAULT 0,
+    report JSONB NOT NULL,
+    generated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    FOREIGN KEY (delivery_id) REFERENCES deliveries(id) ON DELETE CASCADE
+);
@@ -0,0 +1,22 @@
+-- Migration for encrypted exam content on exam-clients
+
+-- Per-delivery key (AES-256, base64) that encrypts the exam content, answers and final
+-- results of a delivery on the exam-client running it. The exam content is sent ahead
+-- encrypted; the key itself is only handed out, wrapped for the exam-client, when the
+-- delivery starts. The exam-client wipes it after exporting the results.
+CREATE TABLE IF NOT EXISTS delivery_keys (
+    delivery_id INTEGER PRIMARY KEY,
+    key_material VARCHAR(64) NOT NULL,
+    released_at TIMESTAMP WITH TIME ZONE,
+    released_to VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    FOREIGN KEY (delivery_id) REFERENCES deliveries(id) ON DELETE CASCADE
+);
+
+-- Add trigger to update updated_at automatically
+DROP TRIGGER IF EXISTS update_delivery_keys_updated_at ON delivery_keys;
+CREATE TRIGGER update_delivery_keys_updated_at
+    BEFORE UPDATE ON delivery_keys
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,65 @@
+-- Migration to restrict deliveries to allowed networks
+
+-- Allow-list entries per delivery. kind = 'cidr' holds an IP or CIDR range,
+-- kind = 'exam_client' holds the client_id of a registered exam-client host.
+CREATE TABLE IF NOT EXISTS delivery_network_rule (
+    id SERIAL PRIMARY KEY,
+    delivery_id INTEGER NOT NULL,
+    kind VARCHAR(20) NOT NULL DEFAULT 'cidr',
+    value VARCHAR(255) NOT NULL,
+    description VARCHAR(255),
+    created_by INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    FOREIGN KEY (delivery_id) REFERENCES deliveries(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
+    CHECK (kind IN ('cidr', 'exam_client')),
+    UNIQUE(delivery_id, kind, value)
+);
+
+-- Proctor overrides letting an individual participant bypass the allow-list
+CREATE TABLE IF NOT EXISTS delivery_network_override (
+    id SERIAL PRIMARY KEY,
+    delivery_id INTEGER NOT NULL,
+    taker_id INTEGER NOT NULL,
+    reason VARCHAR(255),
+    granted_by INTEGER,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    FOREIGN KEY (delivery_id) REFERENCES deliveries(id) ON DELETE CASCADE,
+    FOREIGN KEY (taker_id) REFERENCES takers(id) ON DELETE CASCADE,
+    FOREIGN KEY (granted_by) REFERENCES users(id) ON DELETE SET NULL,
+    UNIQUE(delivery_id, taker_id)
+);
+
+-- Rejected requests coming from outside the allow-list
+CREATE TABLE IF NOT EXISTS delivery_access_violation (
+    id SERIAL PRIMARY KEY,
+    delivery_id INTEGER NOT NULL,
+    taker_id INTEGER,
+    attempt_id INTEGER,
+    ip_address VARCHAR(45) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    source VARCHAR(20) NOT NULL DEFAULT 'coordinator',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    FOREIGN KEY (delivery_id) REFERENCES deliveries(id) ON DELETE CASCADE
+);
+
+-- Add indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_delivery_network_rule_delivery_id ON delivery_network_rule(delivery_id);
+CREATE INDEX IF NOT EXISTS idx_delivery_network_override_delivery_id ON delivery_network_override(delivery_id);
+CREATE INDEX IF NOT EXISTS idx_delivery_access_violation_delivery_id ON delivery_access_violation(delivery_id, created_at);
+
+-- Add triggers to update updated_at automatically
+DROP TRIGGER IF EXISTS update_delivery_network_rule_updated_at ON delivery_network_rule;
+CREATE TRIGGER update_delivery_network_rule_updated_at
+    BEFORE UPDATE ON delivery_network_rule
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+DROP TRIGGER IF EXISTS update_delivery_network_override_updated_at ON delivery_network_override;
+CREATE TRIGGER update_delivery_network_override_updated_at
+    BEFORE UPDATE ON delivery_network_override
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
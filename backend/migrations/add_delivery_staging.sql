@@ -0,0 +1,40 @@
+-- Migration for pre-staging exam content on exam-clients
+
+-- Staging of the encrypted exam content of a delivery on the exam-client that will run
+-- it. Content is staged hours before the start; the delivery key is only released at
+-- release_at (the scheduled start). status is:
+--   waiting  - no exam-client capacity to stage yet
+--   queued   - content packaged and waiting for an exam-client to pick it up
+--   assigned - picked up by client_id, which is downloading and verifying it
+--   staged   - stored by client_id and verified against content_digest
+--   failed   - the exam-client could not stage it (see last_error); staged again
+-- alerted_at is set when staging was still incomplete shortly before the start.
+CREATE TABLE IF NOT EXISTS delivery_staging (
+    delivery_id INTEGER PRIMARY KEY,
+    status VARCHAR(20) NOT NULL DEFAULT 'waiting',
+    client_id VARCHAR(255),
+    content_digest VARCHAR(64),
+    content_size INTEGER,
+    question_count INTEGER,
+    release_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    queued_at TIMESTAMP WITH TIME ZONE,
+    assigned_at TIMESTAMP WITH TIME ZONE,
+    staged_at TIMESTAMP WITH TIME ZONE,
+    released_at TIMESTAMP WITH TIME ZONE,
+    alerted_at TIMESTAMP WITH TIME ZONE,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    FOREIGN KEY (delivery_id) REFERENCES deliveries(id) ON DELETE CASCADE,
+    CHECK (status IN ('waiting', 'queued', 'assigned', 'staged', 'failed'))
+);
+
+-- Add indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_delivery_staging_release ON delivery_staging(release_at) WHERE released_at IS NULL;
+
+-- Add trigger to update updated_at automatically
+DROP TRIGGER IF EXISTS update_delivery_staging_updated_at ON delivery_staging;
+CREATE TRIGGER update_delivery_staging_updated_at
+    BEFORE UPDATE ON delivery_staging
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,26 @@
+-- Migration for exam-client enrollment
+
+-- Credentials of enrolled exam-clients. An exam-client exchanges the enrollment token
+-- for a secret once; it signs every internal request with the secret, and the
+-- coordinator signs its requests to the exam-client with it (HMAC-SHA256).
+-- A revoked client ID cannot enroll again.
+CREATE TABLE IF NOT EXISTS exam_client_credentials (
+    id SERIAL PRIMARY KEY,
+    client_id VARCHAR(255) NOT NULL UNIQUE,
+    secret VARCHAR(128) NOT NULL,
+    enrolled_ip VARCHAR(64),
+    enrolled_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    revoked_by INTEGER,
+    revoke_reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    FOREIGN KEY (revoked_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Add trigger to update updated_at automatically
+DROP TRIGGER IF EXISTS update_exam_client_credentials_updated_at ON exam_client_credentials;
+CREATE TRIGGER update_exam_client_credentials_updated_at
+    BEFORE UPDATE ON exam_client_credentials
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,18 @@
+-- Migration for events received from exam-clients
+
+-- Events sent by the outbox of an exam-client. The outbox retries a send until the
+-- coordinator accepts it, so event_id is unique and a retried event is ignored.
+-- Final result exports are recorded without their data.
+CREATE TABLE IF NOT EXISTS exam_client_events (
+    id SERIAL PRIMARY KEY,
+    event_id VARCHAR(64) NOT NULL UNIQUE,
+    client_id VARCHAR(255) NOT NULL,
+    delivery_id INTEGER,
+    event_type VARCHAR(64) NOT NULL,
+    data JSONB,
+    occurred_at TIMESTAMP WITH TIME ZONE,
+    received_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Add indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_exam_client_events_delivery ON exam_client_events(delivery_id, received_at);
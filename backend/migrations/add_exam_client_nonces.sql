@@ -0,0 +1,14 @@
+-- Migration for replay protection shared by all coordinator replicas
+
+-- Nonces of signed exam-client requests, kept while the signature timestamp is valid. The
+-- primary key makes a replayed request fail on every replica, not only the one that
+-- received the original.
+CREATE TABLE IF NOT EXISTS exam_client_nonces (
+    client_id VARCHAR(255) NOT NULL,
+    nonce TEXT NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (client_id, nonce)
+);
+
+-- Add indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_exam_client_nonces_used_at ON exam_client_nonces(used_at);
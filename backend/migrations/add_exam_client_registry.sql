@@ -0,0 +1,45 @@
+-- Migration for sharing exam-client state between coordinator replicas
+
+-- Exam-clients registered with the coordinator and the status they last reported. Any
+-- replica can receive registrations, status reports and assignment polls, so the
+-- registry is kept here rather than in the memory of one replica.
+CREATE TABLE IF NOT EXISTS exam_clients (
+    client_id VARCHAR(255) PRIMARY KEY,
+    client_ip VARCHAR(64) NOT NULL,
+    port INTEGER NOT NULL,
+    max_deliveries INTEGER NOT NULL DEFAULT 0,
+    version VARCHAR(50) NOT NULL DEFAULT '',
+    capabilities JSONB NOT NULL DEFAULT '[]',
+    registered_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_seen TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    active_deliveries INTEGER NOT NULL DEFAULT 0,
+    total_processed INTEGER NOT NULL DEFAULT 0,
+    uptime BIGINT NOT NULL DEFAULT 0,
+    deliveries JSONB NOT NULL DEFAULT '[]',
+    outbox_backlog INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_exam_clients_last_seen ON exam_clients(last_seen);
+
+-- Deliveries queued by the scheduler for the next exam-client asking for work. Replicas
+-- claim rows with FOR UPDATE SKIP LOCKED, so each delivery is handed out once. Queueing
+-- a delivery again replaces its previous assignment.
+CREATE TABLE IF NOT EXISTS delivery_queue (
+    delivery_id INTEGER PRIMARY KEY,
+    delivery_name VARCHAR(255) NOT NULL DEFAULT '',
+    exam_data JSONB NOT NULL,
+    config JSONB NOT NULL DEFAULT '{}',
+    queued_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (delivery_id) REFERENCES deliveries(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_delivery_queue_queued_at ON delivery_queue(queued_at);
+
+-- Add trigger to update updated_at automatically
+DROP TRIGGER IF EXISTS update_exam_clients_updated_at ON exam_clients;
+CREATE TRIGGER update_exam_clients_updated_at
+    BEFORE UPDATE ON exam_clients
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,38 @@
+-- Migration for the participant help request queue
+
+-- Help requests raised by participants through the exam-client. client_request_id is the
+-- ID of the request in the exam-client database; together with delivery_id it makes
+-- re-sent events idempotent.
+CREATE TABLE IF NOT EXISTS help_requests (
+    id SERIAL PRIMARY KEY,
+    delivery_id INTEGER NOT NULL,
+    taker_id INTEGER NOT NULL,
+    client_request_id INTEGER NOT NULL,
+    client_id VARCHAR(255),
+    message TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    requested_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    claimed_by INTEGER,
+    claimed_at TIMESTAMP WITH TIME ZONE,
+    resolved_by INTEGER,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    resolution TEXT,
+    extra_minutes INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    FOREIGN KEY (delivery_id) REFERENCES deliveries(id) ON DELETE CASCADE,
+    FOREIGN KEY (claimed_by) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (resolved_by) REFERENCES users(id) ON DELETE SET NULL,
+    CHECK (status IN ('open', 'claimed', 'resolved')),
+    UNIQUE(delivery_id, client_request_id)
+);
+
+-- Add indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_help_requests_delivery_status ON help_requests(delivery_id, status, requested_at);
+
+-- Add trigger to update updated_at automatically
+DROP TRIGGER IF EXISTS update_help_requests_updated_at ON help_requests;
+CREATE TRIGGER update_help_requests_updated_at
+    BEFORE UPDATE ON help_requests
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,58 @@
+-- Migration for login brute-force protection
+
+-- Failure counters per account (staff username, participant registration number) and per
+-- IP address for test-code logins. After a few failures every further attempt must wait
+-- longer (next_attempt_at); after too many the account or address is locked until
+-- locked_until. A successful login clears the counter.
+CREATE TABLE IF NOT EXISTS login_throttles (
+    id SERIAL PRIMARY KEY,
+    scope VARCHAR(32) NOT NULL,
+    identifier VARCHAR(255) NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    lockouts INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP WITH TIME ZONE,
+    last_ip VARCHAR(64),
+    next_attempt_at TIMESTAMP WITH TIME ZONE,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (scope, identifier)
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_throttles_locked_until ON login_throttles(locked_until);
+
+-- Every failed login, to detect suspicious patterns across accounts and addresses.
+-- Failures older than a day are removed.
+CREATE TABLE IF NOT EXISTS login_failures (
+    id BIGSERIAL PRIMARY KEY,
+    scope VARCHAR(32) NOT NULL,
+    identifier VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_failures_ip ON login_failures(ip_address, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_failures_identifier ON login_failures(scope, identifier, created_at);
+
+-- Alerts raised by suspicious login patterns, until an admin acknowledges them
+CREATE TABLE IF NOT EXISTS security_alerts (
+    id SERIAL PRIMARY KEY,
+    kind VARCHAR(64) NOT NULL,
+    scope VARCHAR(32) NOT NULL,
+    identifier VARCHAR(255),
+    ip_address VARCHAR(64),
+    details TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    acknowledged_at TIMESTAMP WITH TIME ZONE,
+    acknowledged_by INTEGER,
+    FOREIGN KEY (acknowledged_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_security_alerts_created_at ON security_alerts(created_at);
+
+-- Add trigger to update updated_at automatically
+DROP TRIGGER IF EXISTS update_login_throttles_updated_at ON login_throttles;
+CREATE TRIGGER update_login_throttles_updated_at
+    BEFORE UPDATE ON login_throttles
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,24 @@
+-- Migration for staff single sign-on through OpenID Connect
+
+-- Subject (sub claim) of the identity provider account a user signed in with. Users are
+-- matched by email or username on their first single sign-on, then by subject.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS oidc_subject VARCHAR(255);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_oidc_subject ON users(oidc_subject) WHERE oidc_subject IS NOT NULL;
+
+-- Logins sent to the identity provider, waiting for its callback
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state VARCHAR(64) PRIMARY KEY,
+    nonce VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Sessions created by a callback, handed to the frontend for a single-use code. Only the
+-- SHA-256 hash of the code is stored.
+CREATE TABLE IF NOT EXISTS oidc_login_handoffs (
+    code_hash VARCHAR(64) PRIMARY KEY,
+    session_id VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
@@ -0,0 +1,60 @@
+-- Migration for permission-based access control
+
+-- Permissions granted to roles (permission_role) or directly to users (permission_user).
+-- The tables come from the original schema; they are only created here for databases
+-- without them. The permissions themselves are synced from the API's permission catalog
+-- at startup, which also grants every one of them to the administrator role.
+CREATE TABLE IF NOT EXISTS permissions (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    display_name VARCHAR(255),
+    description VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS permission_role (
+    permission_id BIGINT NOT NULL,
+    role_id BIGINT NOT NULL,
+    PRIMARY KEY (permission_id, role_id),
+    FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE,
+    FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS permission_user (
+    permission_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    user_type VARCHAR(255) NOT NULL DEFAULT 'App\Models\User',
+    PRIMARY KEY (user_id, permission_id, user_type),
+    FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE
+);
+
+-- Role and permission grants made by the API are always for users
+ALTER TABLE role_user ADD COLUMN IF NOT EXISTS user_type VARCHAR(255) NOT NULL DEFAULT 'App\Models\User';
+ALTER TABLE role_user ALTER COLUMN user_type SET DEFAULT 'App\Models\User';
+ALTER TABLE permission_user ALTER COLUMN user_type SET DEFAULT 'App\Models\User';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_name ON roles(name);
+CREATE INDEX IF NOT EXISTS idx_permission_role_role_id ON permission_role(role_id);
+CREATE INDEX IF NOT EXISTS idx_permission_user_user_id ON permission_user(user_id);
+CREATE INDEX IF NOT EXISTS idx_role_user_user_id ON role_user(user_id);
+
+-- Committee and scorer users can see the deliveries assigned to them
+INSERT INTO permissions (name, display_name, description)
+VALUES ('delivery:assigned', 'View assigned deliveries', 'View the deliveries assigned to the user as committee or scorer')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO permission_role (permission_id, role_id)
+SELECT p.id, r.id
+FROM permissions p
+CROSS JOIN roles r
+WHERE p.name = 'delivery:assigned'
+  AND r.name IN ('scorer', 'Scorer / Committee')
+ON CONFLICT DO NOTHING;
+
+-- Add trigger to update updated_at automatically
+DROP TRIGGER IF EXISTS update_permissions_updated_at ON permissions;
+CREATE TRIGGER update_permissions_updated_at
+    BEFORE UPDATE ON permissions
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
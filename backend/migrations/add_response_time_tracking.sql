@@ -0,0 +1,28 @@
+-- Migration to record time spent per question, revisits and answer changes
+
+-- Accumulated time (seconds), number of visits and number of answer changes per question
+ALTER TABLE attempt_question
+ADD COLUMN IF NOT EXISTS time_spent INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS visits INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS answer_changes INTEGER NOT NULL DEFAULT 0;
+
+-- One row per visit of a question. previous_answer/answer record what changed during the visit.
+-- kind = 'visit' (no answer given or answer unchanged), 'answer' (first answer),
+-- 'change' (different answer) or 'clear' (answer removed).
+CREATE TABLE IF NOT EXISTS attempt_question_history (
+    id SERIAL PRIMARY KEY,
+    attempt_id INTEGER NOT NULL,
+    question_id INTEGER NOT NULL,
+    kind VARCHAR(10) NOT NULL,
+    previous_answer TEXT,
+    answer TEXT,
+    time_spent INTEGER NOT NULL DEFAULT 0,
+    source VARCHAR(20) NOT NULL DEFAULT 'coordinator',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    FOREIGN KEY (attempt_id) REFERENCES attempts(id) ON DELETE CASCADE,
+    CHECK (kind IN ('visit', 'answer', 'change', 'clear'))
+);
+
+-- Add indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_attempt_question_history_attempt_id ON attempt_question_history(attempt_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_attempt_question_history_question_id ON attempt_question_history(question_id);
@@ -0,0 +1,14 @@
+-- Migration for concurrent staff sessions
+
+-- Sessions a user with the role may have at the same time: NULL uses SESSION_MAX_CONCURRENT,
+-- 0 is unlimited. Users with several roles get the highest limit.
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS max_sessions INTEGER CHECK (max_sessions >= 0);
+
+-- When the session was signed in, shown with its device in the session list
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+
+-- Sessions still waiting for a two-factor code or enrollment neither count toward the limit
+-- nor end other sessions until the second factor is passed
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS two_factor_pending BOOLEAN NOT NULL DEFAULT FALSE;
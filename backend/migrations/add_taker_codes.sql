@@ -0,0 +1,24 @@
+-- Migration for random taker codes and per-delivery access codes
+
+-- Format of the taker codes of a group: an optional prefix, taker_code_length random
+-- characters and a check character, printed in groups of taker_code_group_size characters
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS taker_code_prefix VARCHAR(8) NOT NULL DEFAULT '';
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS taker_code_length INTEGER NOT NULL DEFAULT 8;
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS taker_code_group_size INTEGER NOT NULL DEFAULT 4;
+
+-- Codes are stored normalized (uppercase, without separators). A revoked code is NULL.
+-- Sequential codes issued before this migration fail the check character. They keep logging
+-- in until LEGACY_TAKER_CODES_UNTIL, and are refused when it is not set; before that date,
+-- regenerate the codes of groups with upcoming deliveries and print new admission slips.
+CREATE INDEX IF NOT EXISTS idx_group_taker_taker_code ON group_taker(taker_code);
+
+-- Optional second code per delivery, announced in the room, that participants must enter
+-- along with their taker code
+CREATE TABLE IF NOT EXISTS delivery_access_codes (
+    delivery_id INTEGER PRIMARY KEY,
+    code VARCHAR(32) NOT NULL,
+    created_by INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    FOREIGN KEY (delivery_id) REFERENCES deliveries(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
@@ -0,0 +1,15 @@
+-- Migration for TOTP two-factor authentication
+
+-- users.two_factor_secret holds the base32 TOTP secret and two_factor_recovery_codes a
+-- JSON array of SHA-256 hashes of the unused recovery codes. A secret only protects the
+-- account once a code generated from it was confirmed, so secrets left unconfirmed by the
+-- previous application are ignored. The last used time step stops a code from being used
+-- twice.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS two_factor_secret TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS two_factor_recovery_codes TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS two_factor_confirmed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS two_factor_last_step BIGINT;
+
+-- Users with a role requiring two-factor authentication must enroll before they can use
+-- the API
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS two_factor_required BOOLEAN NOT NULL DEFAULT FALSE;
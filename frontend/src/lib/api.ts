@@ -141,6 +141,12 @@ class ApiClient {
       this.post(`/deliveries/${id}/control`, { action }),
     getParticipantProgress: (id: string) =>
       this.get(`/deliveries/${id}/participant-progress`),
+    getHelpRequests: (id: string, status?: string) =>
+      this.get(`/deliveries/${id}/help-requests${status ? `?status=${status}` : ''}`),
+    claimHelpRequest: (id: string, requestId: number) =>
+      this.post(`/deliveries/${id}/help-requests/${requestId}/claim`),
+    resolveHelpRequest: (id: string, requestId: number, data: { resolution?: string; extra_minutes?: number }) =>
+      this.post(`/deliveries/${id}/help-requests/${requestId}/resolve`, data),
   }
 
   participants = {
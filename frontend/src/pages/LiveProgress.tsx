@@ -1,6 +1,5 @@
 import { useEffect, useRef } from 'react'
 import { useParams, useNavigate } from 'react-router-dom'
-import { useAuthStore } from '@/store/authStore'
 import { useLocalStateSync } from '@/hooks/useLocalState'
 import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card'
 import { Badge } from '@/components/ui/badge'
@@ -16,7 +15,8 @@ import {
   RefreshCw,
   Wifi,
   WifiOff,
-  Circle
+  Circle,
+  Hand
 } from 'lucide-react'
 import { apiClient } from '@/lib/api'
 import { MainContent } from '@/components/layout/MainContent'
@@ -39,15 +39,31 @@ interface ParticipantProgress {
   }
 }
 
+interface HelpRequest {
+  id: number
+  taker_id: number
+  taker_name?: string
+  message?: string
+  status: 'open' | 'claimed' | 'resolved'
+  requested_at: string
+  claimed_by_name?: string
+  claimed_at?: string
+}
+
 export function LiveProgress() {
   const { deliveryId } = useParams<{ deliveryId: string }>()
   const navigate = useNavigate()
-  const { user } = useAuthStore()
   const wsRef = useRef<WebSocket | null>(null)
   const reconnectTimeoutRef = useRef<NodeJS.Timeout>()
+  // Position in the server's delta stream, used to resume after a reconnect
+  const streamIdRef = useRef<string | null>(null)
+  const lastSeqRef = useRef<number | null>(null)
   
   const [state, setState] = useLocalStateSync({
     participants: [] as ParticipantProgress[],
+    helpRequests: [] as HelpRequest[],
+    // Extra minutes entered per help request before resolving it
+    extraMinutes: {} as Record<number, number>,
     deliveryInfo: null as any,
     isLoading: true,
     error: '',
@@ -79,7 +95,7 @@ export function LiveProgress() {
       // Send authentication message
       const authMessage = {
         type: 'auth',
-        session_id: user?.sessionId || 'anonymous'
+        session_id: localStorage.getItem('sessionId') || ''
       }
       ws.send(JSON.stringify(authMessage))
       console.log('Sent auth message:', authMessage)
@@ -98,14 +114,40 @@ export function LiveProgress() {
         if (message.type === 'auth_response') {
           if (message.success) {
             console.log('Authentication successful for delivery:', message.delivery_id)
+            // Resume the stream we were following, or ask for a full snapshot
+            if (streamIdRef.current === message.stream_id && lastSeqRef.current !== null) {
+              ws.send(JSON.stringify({ type: 'resume', stream_id: streamIdRef.current, last_seq: lastSeqRef.current }))
+            } else {
+              ws.send(JSON.stringify({ type: 'snapshot' }))
+            }
           } else {
             console.error('Authentication failed:', message.message)
             setState.error = `Authentication failed: ${message.message}`
           }
-        } else if (message.type === 'progress_update') {
+        } else if (message.type === 'snapshot') {
+          streamIdRef.current = message.stream_id
+          lastSeqRef.current = message.seq
           setState.participants = message.data.participants || []
+          setState.helpRequests = message.data.help_requests || []
           setState.deliveryInfo = message.data.delivery
           setState.lastUpdated = new Date(message.timestamp)
+        } else if (message.type === 'delta') {
+          if (message.stream_id !== streamIdRef.current || lastSeqRef.current === null) {
+            return
+          }
+          if (message.seq <= lastSeqRef.current) {
+            return // already applied
+          }
+          if (message.seq > lastSeqRef.current + 1) {
+            // Missed deltas, start over from a snapshot
+            ws.send(JSON.stringify({ type: 'snapshot' }))
+            return
+          }
+          lastSeqRef.current = message.seq
+          applyDelta(message.data)
+          setState.lastUpdated = new Date(message.timestamp)
+        } else if (message.type === 'snapshot_required') {
+          ws.send(JSON.stringify({ type: 'snapshot' }))
         } else if (message.type === 'pong') {
           console.log('Received pong from server')
         }
@@ -119,10 +161,16 @@ export function LiveProgress() {
       setState.error = 'Connection error. Retrying...'
     }
 
-    ws.onclose = () => {
+    ws.onclose = (event) => {
       console.log('WebSocket disconnected')
       setState.isConnected = false
       wsRef.current = null
+
+      // 4401/4403: not authenticated or not allowed to monitor this delivery, retrying won't help
+      if (event.code === 4401 || event.code === 4403) {
+        setState.error = event.reason || 'Not authorized to monitor this delivery'
+        return
+      }
       
       // Attempt to reconnect after 3 seconds
       reconnectTimeoutRef.current = setTimeout(() => {
@@ -132,6 +180,48 @@ export function LiveProgress() {
     }
   }
 
+  // Merge one participant's progress change into the roster
+  const applyDelta = (data: { participant_id: number; attempt?: Partial<ParticipantProgress['attempt']>; help_request?: HelpRequest }) => {
+    if (data.help_request) {
+      applyHelpRequest(data.help_request)
+      return
+    }
+    if (!data.attempt) return
+
+    setState.participants = setState.participants.map(p =>
+      p.participant.id === data.participant_id
+        ? { ...p, attempt: { ...p.attempt, ...data.attempt } as ParticipantProgress['attempt'] }
+        : p
+    )
+  }
+
+  // Keep the help queue in request order; resolved requests leave the queue
+  const applyHelpRequest = (request: HelpRequest) => {
+    const others = setState.helpRequests.filter(r => r.id !== request.id)
+    setState.helpRequests = request.status === 'resolved'
+      ? others
+      : [...others, request].sort((a, b) => new Date(a.requested_at).getTime() - new Date(b.requested_at).getTime())
+  }
+
+  const claimHelpRequest = async (request: HelpRequest) => {
+    const response = await apiClient.deliveries.claimHelpRequest(deliveryId!, request.id)
+    if (response.error) {
+      setState.error = response.error
+    } else if (response.data?.help_request) {
+      applyHelpRequest(response.data.help_request)
+    }
+  }
+
+  const resolveHelpRequest = async (request: HelpRequest) => {
+    const extraMinutes = setState.extraMinutes[request.id] || 0
+    const response = await apiClient.deliveries.resolveHelpRequest(deliveryId!, request.id, { extra_minutes: extraMinutes })
+    if (response.error) {
+      setState.error = response.error
+    } else if (response.data?.help_request) {
+      applyHelpRequest(response.data.help_request)
+    }
+  }
+
   // Initial load to get data immediately
   const loadInitialData = async () => {
     try {
@@ -394,6 +484,68 @@ export function LiveProgress() {
           </Card>
         </div>
 
+        {/* Help Requests */}
+        {state.helpRequests.length > 0 && (
+          <Card className="mb-8 border-amber-200 bg-amber-50/40">
+            <CardHeader>
+              <CardTitle className="flex items-center gap-2">
+                <Hand className="w-5 h-5 text-amber-600" />
+                Help Requests ({state.helpRequests.length})
+              </CardTitle>
+              <CardDescription>Participants waiting for a proctor, oldest first</CardDescription>
+            </CardHeader>
+            <CardContent>
+              <div className="space-y-3">
+                {state.helpRequests.map((request) => (
+                  <div key={request.id} className="flex items-center justify-between gap-4 rounded-md border bg-white p-3">
+                    <div className="min-w-0 flex-1">
+                      <div className="flex items-center gap-2">
+                        <span className="font-semibold text-gray-900 truncate">
+                          {request.taker_name || `Participant ${request.taker_id}`}
+                        </span>
+                        {request.status === 'claimed' ? (
+                          <Badge className="bg-blue-500 text-white">Claimed by {request.claimed_by_name || 'proctor'}</Badge>
+                        ) : (
+                          <Badge className="bg-amber-500 text-white">Waiting</Badge>
+                        )}
+                      </div>
+                      {request.message && (
+                        <p className="text-sm text-gray-600 truncate">{request.message}</p>
+                      )}
+                      <p className="text-xs text-gray-500 flex items-center gap-1 mt-1">
+                        <Clock className="w-3 h-3" />
+                        Requested {new Date(request.requested_at).toLocaleTimeString()} ({calculateTimeSpent(request.requested_at)})
+                      </p>
+                    </div>
+                    <div className="flex items-center gap-2">
+                      {request.status === 'open' && (
+                        <Button size="sm" variant="outline" onClick={() => claimHelpRequest(request)}>
+                          Claim
+                        </Button>
+                      )}
+                      <input
+                        type="number"
+                        min={0}
+                        max={120}
+                        className="w-16 rounded-md border px-2 py-1 text-sm"
+                        title="Extra minutes for the time lost"
+                        value={state.extraMinutes[request.id] ?? 0}
+                        onChange={(e) => {
+                          setState.extraMinutes[request.id] = Math.max(0, parseInt(e.target.value) || 0)
+                        }}
+                      />
+                      <span className="text-xs text-gray-500">min</span>
+                      <Button size="sm" onClick={() => resolveHelpRequest(request)}>
+                        Resolve
+                      </Button>
+                    </div>
+                  </div>
+                ))}
+              </div>
+            </CardContent>
+          </Card>
+        )}
+
         {/* Participant List */}
         <Card>
           <CardHeader>